@@ -63,11 +63,15 @@ type AsyncQueriesEvictor struct {
 	cancel               context.CancelFunc
 	AsyncRequestStorage  AsyncSearchStorageInMemory
 	AsyncQueriesContexts AsyncQueryContextStorageInMemory
+	ScrollContexts       ScrollContextStorageInMemory
+	PointsInTime         PointInTimeStorageInMemory
 }
 
-func NewAsyncQueriesEvictor(AsyncRequestStorage AsyncSearchStorageInMemory, AsyncQueriesContexts AsyncQueryContextStorageInMemory) *AsyncQueriesEvictor {
+func NewAsyncQueriesEvictor(AsyncRequestStorage AsyncSearchStorageInMemory, AsyncQueriesContexts AsyncQueryContextStorageInMemory,
+	ScrollContexts ScrollContextStorageInMemory, PointsInTime PointInTimeStorageInMemory) *AsyncQueriesEvictor {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &AsyncQueriesEvictor{ctx: ctx, cancel: cancel, AsyncRequestStorage: AsyncRequestStorage, AsyncQueriesContexts: AsyncQueriesContexts}
+	return &AsyncQueriesEvictor{ctx: ctx, cancel: cancel, AsyncRequestStorage: AsyncRequestStorage, AsyncQueriesContexts: AsyncQueriesContexts,
+		ScrollContexts: ScrollContexts, PointsInTime: PointsInTime}
 }
 
 func elapsedTime(t time.Time) time.Duration {
@@ -112,6 +116,15 @@ func (e *AsyncQueriesEvictor) tryEvictAsyncRequests(timeFun func(time.Time) time
 	}
 }
 
+func (e *AsyncQueriesEvictor) tryEvictSearchContexts(now time.Time) {
+	if evicted := e.ScrollContexts.EvictExpired(now); evicted > 0 {
+		logger.Info().Msgf("Evicted %d expired scroll contexts", evicted)
+	}
+	if evicted := e.PointsInTime.EvictExpired(now); evicted > 0 {
+		logger.Info().Msgf("Evicted %d expired points in time", evicted)
+	}
+}
+
 func (e *AsyncQueriesEvictor) AsyncQueriesGC() {
 	defer recovery.LogPanic()
 	for {
@@ -121,6 +134,7 @@ func (e *AsyncQueriesEvictor) AsyncQueriesGC() {
 			return
 		case <-time.After(GCInterval):
 			e.tryEvictAsyncRequests(elapsedTime)
+			e.tryEvictSearchContexts(time.Now())
 		}
 	}
 }
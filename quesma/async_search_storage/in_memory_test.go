@@ -12,7 +12,7 @@ import (
 func TestAsyncQueriesEvictorTimePassed(t *testing.T) {
 	queryContextStorage := NewAsyncQueryContextStorageInMemory()
 	queryContextStorage.idToContext.Store("1", &AsyncQueryContext{})
-	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage)
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage, NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
 	evictor.AsyncRequestStorage.Store("1", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("2", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("3", &AsyncRequestResult{added: time.Now()})
@@ -26,7 +26,7 @@ func TestAsyncQueriesEvictorTimePassed(t *testing.T) {
 func TestAsyncQueriesEvictorStillAlive(t *testing.T) {
 	queryContextStorage := NewAsyncQueryContextStorageInMemory()
 	queryContextStorage.idToContext.Store("1", &AsyncQueryContext{})
-	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage)
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage, NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
 	evictor.AsyncRequestStorage.idToResult = util.NewSyncMap[string, *AsyncRequestResult]()
 	evictor.AsyncRequestStorage.Store("1", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("2", &AsyncRequestResult{added: time.Now()})
@@ -0,0 +1,104 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package async_search_storage
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"sync"
+	"time"
+)
+
+// keepAlive is the lifetime of search contexts (scroll, point in time), which is extended by every request using them.
+// It's touched by requests while the evictor checks it, so it's guarded by its own mutex.
+type keepAlive struct {
+	m         sync.Mutex
+	duration  time.Duration
+	expiresAt time.Time
+}
+
+func newKeepAlive(duration time.Duration) *keepAlive {
+	return &keepAlive{duration: duration, expiresAt: time.Now().Add(duration)}
+}
+
+// KeepAlive returns the duration set by the last request
+func (k *keepAlive) KeepAlive() time.Duration {
+	k.m.Lock()
+	defer k.m.Unlock()
+	return k.duration
+}
+
+// Touch extends the lifetime of the context, each request sets a new keep alive.
+func (k *keepAlive) Touch(duration time.Duration) {
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.duration = duration
+	k.expiresAt = time.Now().Add(duration)
+}
+
+func (k *keepAlive) IsExpired(now time.Time) bool {
+	k.m.Lock()
+	defer k.m.Unlock()
+	return now.After(k.expiresAt)
+}
+
+type expirable interface {
+	IsExpired(now time.Time) bool
+}
+
+type keepAliveStorageInMemory[T expirable] struct {
+	idToContext *util.SyncMap[string, T]
+}
+
+func newKeepAliveStorageInMemory[T expirable]() keepAliveStorageInMemory[T] {
+	return keepAliveStorageInMemory[T]{
+		idToContext: util.NewSyncMap[string, T](),
+	}
+}
+
+func (s keepAliveStorageInMemory[T]) Store(id string, context T) {
+	s.idToContext.Store(id, context)
+}
+
+// Load doesn't return expired contexts, even if they were not evicted yet
+func (s keepAliveStorageInMemory[T]) Load(id string) (T, bool) {
+	context, ok := s.idToContext.Load(id)
+	if !ok || context.IsExpired(time.Now()) {
+		var empty T
+		return empty, false
+	}
+	return context, true
+}
+
+func (s keepAliveStorageInMemory[T]) Delete(id string) bool {
+	_, ok := s.idToContext.LoadAndDelete(id)
+	return ok
+}
+
+func (s keepAliveStorageInMemory[T]) DeleteAll() int {
+	deleted := 0
+	for _, id := range s.idToContext.Keys() {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (s keepAliveStorageInMemory[T]) Size() int {
+	return s.idToContext.Size()
+}
+
+// EvictExpired removes all contexts whose keep alive has passed and returns their number.
+func (s keepAliveStorageInMemory[T]) EvictExpired(now time.Time) int {
+	var ids []string
+	s.idToContext.Range(func(id string, context T) bool {
+		if context.IsExpired(now) {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.idToContext.Delete(id)
+	}
+	return len(ids)
+}
@@ -0,0 +1,45 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package async_search_storage
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const PitIdPrefix = "quesma_pit_"
+
+func GetPitId() string {
+	return PitIdPrefix + uuid.Must(uuid.NewV7()).String()
+}
+
+// PointInTime pins the view of the data for all searches using it.
+// ClickHouse has no snapshots, so the view is approximated: the set of tables is resolved once, when PIT is opened,
+// and documents ingested after that are filtered out by the ingest time column of tables created by Quesma.
+type PointInTime struct {
+	*keepAlive
+	Indexes        []string
+	AliasFilter    map[string]any // Query DSL filter of aliases the indexes were matched by, nil if there is none
+	TimestampField string         // default sort, empty if the indexes have no timestamp field
+	HasIngestTime  bool           // false if the table has no ingest time column, then there is no upper ingest time bound
+	OpenedAt       time.Time
+}
+
+func NewPointInTime(indexes []string, aliasFilter map[string]any, timestampField string, hasIngestTime bool, keepAlive time.Duration) *PointInTime {
+	return &PointInTime{keepAlive: newKeepAlive(keepAlive), Indexes: indexes, AliasFilter: aliasFilter,
+		TimestampField: timestampField, HasIngestTime: hasIngestTime, OpenedAt: time.Now()}
+}
+
+type PointInTimeStorage interface {
+	Store(id string, pit *PointInTime)
+	Load(id string) (*PointInTime, bool) // expired PITs are not returned
+	Delete(id string) bool
+}
+
+type PointInTimeStorageInMemory struct {
+	keepAliveStorageInMemory[*PointInTime]
+}
+
+func NewPointInTimeStorageInMemory() PointInTimeStorageInMemory {
+	return PointInTimeStorageInMemory{newKeepAliveStorageInMemory[*PointInTime]()}
+}
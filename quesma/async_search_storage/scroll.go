@@ -0,0 +1,47 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package async_search_storage
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+const ScrollIdPrefix = "quesma_scroll_"
+
+func GetScrollId() string {
+	return ScrollIdPrefix + uuid.Must(uuid.NewV7()).String()
+}
+
+// ScrollContext keeps everything we need to return the next page of a scroll search.
+// We don't keep any cursor open in ClickHouse, the next page is fetched with keyset pagination
+// (`search_after` on the sort columns), starting after the last returned hit.
+type ScrollContext struct {
+	*keepAlive
+	sync.Mutex      // held while a page is fetched, so pages of one scroll are returned one after another
+	IndexPattern    string
+	Body            types.JSON // original request body, without `from` and `search_after`
+	SearchAfter     []any      // sort values of the last returned hit, nil if nothing was returned yet
+	SearchAfterTies int        // number of returned hits with exactly the SearchAfter sort values
+}
+
+func NewScrollContext(indexPattern string, body types.JSON, searchAfter []any, keepAlive time.Duration) *ScrollContext {
+	return &ScrollContext{keepAlive: newKeepAlive(keepAlive), IndexPattern: indexPattern, Body: body, SearchAfter: searchAfter}
+}
+
+type ScrollContextStorage interface {
+	Store(id string, context *ScrollContext)
+	Load(id string) (*ScrollContext, bool) // expired contexts are not returned
+	Delete(id string) bool
+	DeleteAll() int
+}
+
+type ScrollContextStorageInMemory struct {
+	keepAliveStorageInMemory[*ScrollContext]
+}
+
+func NewScrollContextStorageInMemory() ScrollContextStorageInMemory {
+	return ScrollContextStorageInMemory{newKeepAliveStorageInMemory[*ScrollContext]()}
+}
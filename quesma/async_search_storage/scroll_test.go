@@ -0,0 +1,67 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package async_search_storage
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrollContextStorage(t *testing.T) {
+	storage := NewScrollContextStorageInMemory()
+	storage.Store("1", NewScrollContext("index", types.JSON{}, nil, time.Minute))
+	storage.Store("2", NewScrollContext("index", types.JSON{}, nil, time.Minute))
+	storage.Store("expired", NewScrollContext("index", types.JSON{}, nil, -time.Minute))
+
+	_, ok := storage.Load("1")
+	assert.True(t, ok)
+	_, ok = storage.Load("expired")
+	assert.False(t, ok)
+
+	assert.True(t, storage.Delete("1"))
+	assert.False(t, storage.Delete("1"))
+	assert.Equal(t, 2, storage.DeleteAll())
+	assert.Equal(t, 0, storage.Size())
+}
+
+func TestAsyncQueriesEvictorSearchContexts(t *testing.T) {
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), NewAsyncQueryContextStorageInMemory(), NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
+	evictor.ScrollContexts.Store("1", NewScrollContext("index", types.JSON{}, nil, time.Minute))
+	evictor.ScrollContexts.Store("2", NewScrollContext("index", types.JSON{}, nil, time.Hour))
+	evictor.PointsInTime.Store("1", NewPointInTime([]string{"index"}, nil, "@timestamp", true, time.Minute))
+
+	evictor.tryEvictSearchContexts(time.Now())
+	assert.Equal(t, 2, evictor.ScrollContexts.Size())
+	assert.Equal(t, 1, evictor.PointsInTime.Size())
+
+	evictor.tryEvictSearchContexts(time.Now().Add(10 * time.Minute))
+	assert.Equal(t, 1, evictor.ScrollContexts.Size())
+	assert.Equal(t, 0, evictor.PointsInTime.Size())
+	_, ok := evictor.ScrollContexts.Load("2")
+	assert.True(t, ok)
+}
+
+func TestScrollContextTouchedWhileEvicting(t *testing.T) {
+	storage := NewScrollContextStorageInMemory()
+	scrollContext := NewScrollContext("index", types.JSON{}, nil, time.Minute)
+	storage.Store("1", scrollContext)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			scrollContext.Touch(time.Hour)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		storage.EvictExpired(time.Now())
+	}
+	wg.Wait()
+
+	assert.Equal(t, time.Hour, scrollContext.KeepAlive())
+	assert.Equal(t, 0, storage.EvictExpired(time.Now().Add(30*time.Minute)))
+}
@@ -5,6 +5,7 @@ package clickhouse
 import (
 	"context"
 	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/QuesmaOrg/quesma/quesma/config"
 	"github.com/QuesmaOrg/quesma/quesma/end_user_errors"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
@@ -76,6 +77,7 @@ type LogManagerIFace interface {
 	CountMultiple(ctx context.Context, tables ...*Table) (int64, error)
 	Count(ctx context.Context, table *Table) (int64, error)
 	GetTableDefinitions() (TableMap, error)
+	ExecuteMutation(ctx context.Context, statement string) error
 }
 
 func NewTableMap() *TableMap {
@@ -221,6 +223,16 @@ func (lm *LogManager) Count(ctx context.Context, table *Table) (int64, error) {
 	return count, nil
 }
 
+// ExecuteMutation runs a lightweight `DELETE` or `ALTER TABLE ... UPDATE` statement
+// and waits until the mutation is applied on all replicas.
+func (lm *LogManager) ExecuteMutation(ctx context.Context, statement string) error {
+	settings := clickhouse.Settings{"mutations_sync": 2}
+	if err := lm.chDb.Exec(clickhouse.Context(ctx, clickhouse.WithSettings(settings)), statement); err != nil {
+		return end_user_errors.GuessClickhouseErrorType(err).InternalDetails("clickhouse: mutation failed. err: %v, statement: %v", err, statement)
+	}
+	return nil
+}
+
 func (lm *LogManager) executeRawQuery(query string) (quesma_api.Rows, error) {
 	if res, err := lm.chDb.Query(context.Background(), query); err != nil {
 		return nil, fmt.Errorf("error in executeRawQuery: query: %s\nerr:%v", query, err)
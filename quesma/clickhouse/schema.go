@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/util"
+	"maps"
 	"math"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 )
@@ -270,8 +272,10 @@ func NewType(value any, valueOrigin string) (Type, error) {
 	case bool:
 		return BaseType{Name: "Bool", GoType: reflect.TypeOf(true)}, nil
 	case map[string]interface{}:
-		cols := make([]*Column, len(valueCasted))
-		for k, v := range valueCasted {
+		cols := make([]*Column, 0, len(valueCasted))
+		// sorted, so the same object always gives the same Tuple (e.g. for nested documents: Array(Tuple(...)))
+		for _, k := range slices.Sorted(maps.Keys(valueCasted)) {
+			v := valueCasted[k]
 			innerName := fmt.Sprintf("%s.%s", valueOrigin, k)
 			innerType, err := NewType(v, innerName)
 			if err != nil {
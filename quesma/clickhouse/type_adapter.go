@@ -11,6 +11,10 @@ type SchemaTypeAdapter struct {
 }
 
 func (c SchemaTypeAdapter) Convert(s string) (schema.QuesmaType, bool) {
+	// array of objects, each object is matched separately (Elastic's `nested` field type)
+	if (isArray(s) && strings.HasPrefix(arrayType(s), "Tuple(")) || strings.HasPrefix(s, "Nested(") {
+		return schema.QuesmaTypeNested, true
+	}
 	for isArray(s) {
 		s = arrayType(s)
 	}
@@ -52,3 +56,28 @@ func isArray(s string) bool {
 func arrayType(s string) string {
 	return s[6 : len(s)-1]
 }
+
+// NestedElementType returns the type of `element` of a nested (Array(Tuple(...)) or Nested(...)) column, without Nullable(),
+// e.g. NestedElementType("Array(Tuple(author Nullable(String), stars Nullable(Int64)))", "stars") = "Int64"
+func NestedElementType(nestedType, element string) (string, bool) {
+	if elements, isNested := strings.CutPrefix(nestedType, "Nested("); isNested { // not flattened Nested is Array(Tuple(...))
+		nestedType = "Array(Tuple(" + elements + ")"
+	}
+	column := resolveColumn("nested", nestedType)
+	if column == nil {
+		return "", false
+	}
+	array, ok := column.Type.(CompoundType)
+	if !ok || !array.isArray() {
+		return "", false
+	}
+	tuple, ok := array.BaseType.(MultiValueType)
+	if !ok {
+		return "", false
+	}
+	elementColumn := tuple.GetColumn(element)
+	if elementColumn == nil {
+		return "", false
+	}
+	return elementColumn.Type.String(), true
+}
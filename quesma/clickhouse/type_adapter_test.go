@@ -0,0 +1,43 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package clickhouse
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSchemaTypeAdapter_nested(t *testing.T) {
+	const nestedType = "Array(Tuple(author Nullable(String), stars Nullable(Int64), posted DateTime64(3)))"
+
+	quesmaType, ok := SchemaTypeAdapter{}.Convert(nestedType)
+	assert.True(t, ok)
+	assert.Equal(t, schema.QuesmaTypeNested, quesmaType)
+
+	quesmaType, ok = SchemaTypeAdapter{}.Convert("Array(String)")
+	assert.True(t, ok)
+	assert.Equal(t, schema.QuesmaTypeKeyword, quesmaType)
+
+	elementType, ok := NestedElementType(nestedType, "stars")
+	assert.True(t, ok)
+	assert.Equal(t, "Int64", elementType)
+
+	elementType, ok = NestedElementType(nestedType, "author")
+	assert.True(t, ok)
+	assert.Equal(t, "String", elementType)
+
+	quesmaType, ok = SchemaTypeAdapter{}.Convert("Nested(author String, stars Int64)")
+	assert.True(t, ok)
+	assert.Equal(t, schema.QuesmaTypeNested, quesmaType)
+
+	elementType, ok = NestedElementType("Nested(author String, stars Int64)", "stars")
+	assert.True(t, ok)
+	assert.Equal(t, "Int64", elementType)
+
+	_, ok = NestedElementType(nestedType, "title")
+	assert.False(t, ok)
+
+	_, ok = NestedElementType("Array(String)", "author")
+	assert.False(t, ok)
+}
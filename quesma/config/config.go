@@ -55,6 +55,8 @@ type QuesmaConfiguration struct {
 	DefaultQueryTarget        []string
 	DefaultIngestOptimizers   map[string]OptimizerConfiguration
 	DefaultQueryOptimizers    map[string]OptimizerConfiguration
+	DeadLetterQueue           *DeadLetterQueueConfiguration // nil if documents rejected during ingest aren't stored
+	IngestBuffer              *IngestBufferConfiguration    // nil if documents are inserted into ClickHouse right away
 }
 
 func (c *QuesmaConfiguration) AliasFields(indexName string) map[string]string {
@@ -263,6 +265,8 @@ Quesma Configuration:
 	UseCommonTableForWildcard: %t,
 	DefaultIngestTarget: %v,
 	DefaultQueryTarget: %v,
+	DeadLetterQueue: %s,
+	IngestBuffer: %s,
 `,
 		c.TransparentProxy,
 		elasticUrl,
@@ -284,6 +288,8 @@ Quesma Configuration:
 		c.UseCommonTableForWildcard,
 		c.DefaultIngestTarget,
 		c.DefaultQueryTarget,
+		c.DeadLetterQueue.String(),
+		c.IngestBuffer.String(),
 	)
 }
 
@@ -115,8 +115,10 @@ const DefaultWildcardIndexName = "*"
 
 // Configuration of QuesmaV1ProcessorQuery and QuesmaV1ProcessorIngest
 type QuesmaProcessorConfig struct {
-	UseCommonTable bool           `koanf:"useCommonTable"`
-	IndexConfig    IndicesConfigs `koanf:"indexes"`
+	UseCommonTable  bool                          `koanf:"useCommonTable"`
+	IndexConfig     IndicesConfigs                `koanf:"indexes"`
+	DeadLetterQueue *DeadLetterQueueConfiguration `koanf:"deadLetterQueue"` // ingest processor only, nil if disabled
+	IngestBuffer    *IngestBufferConfiguration    `koanf:"ingestBuffer"`    // ingest processor only, nil if documents are inserted right away
 	// DefaultTargetConnectorType is used in V2 code only
 	DefaultTargetConnectorType string //it is not serialized to maintain configuration BWC, so it's basically just populated from '*' config in `config_v2.go`
 }
@@ -424,6 +426,22 @@ func (c *QuesmaNewConfiguration) validateProcessor(p Processor) error {
 			}
 		}
 	}
+	if p.Config.DeadLetterQueue != nil {
+		if p.Type != QuesmaV1ProcessorIngest {
+			return fmt.Errorf("dead letter queue can be configured only in the ingest processor")
+		}
+		if err := p.Config.DeadLetterQueue.validate(); err != nil {
+			return err
+		}
+	}
+	if p.Config.IngestBuffer != nil {
+		if p.Type != QuesmaV1ProcessorIngest {
+			return fmt.Errorf("ingest buffer can be configured only in the ingest processor")
+		}
+		if err := p.Config.IngestBuffer.validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -895,6 +913,8 @@ func (c *QuesmaNewConfiguration) TranslateToLegacyConfig() QuesmaConfiguration {
 
 		conf.EnableIngest = true
 		conf.IngestStatistics = c.IngestStatistics
+		conf.DeadLetterQueue = ingestProcessor.Config.DeadLetterQueue
+		conf.IngestBuffer = ingestProcessor.Config.IngestBuffer
 
 		if defaultIngestConfig, ok := ingestProcessor.Config.IndexConfig[DefaultWildcardIndexName]; ok {
 			conf.DefaultIngestOptimizers = defaultIngestConfig.Optimizers
@@ -968,6 +988,16 @@ func (c *QuesmaNewConfiguration) TranslateToLegacyConfig() QuesmaConfiguration {
 				}
 			}
 
+			if indexConfig.DefaultPipeline != "" {
+				processedConfig.DefaultPipeline = indexConfig.DefaultPipeline
+			}
+			for _, strategy := range indexConfig.SchemaEvolution {
+				if !slices.Contains([]string{SchemaEvolutionWiden, SchemaEvolutionArray, SchemaEvolutionShadow}, strategy) {
+					errAcc = multierror.Append(errAcc, fmt.Errorf("invalid schema evolution strategy %s in configuration of index %s", strategy, indexName))
+				}
+			}
+			processedConfig.SchemaEvolution = indexConfig.SchemaEvolution
+
 			// copy ingest optimizers to the destination
 			if indexConfig.Optimizers != nil {
 				if processedConfig.Optimizers == nil {
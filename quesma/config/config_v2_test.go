@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestQuesmaConfigurationLoading(t *testing.T) {
@@ -339,3 +340,17 @@ func TestIngestOptimizers(t *testing.T) {
 	_, ok = legacyConf.DefaultIngestOptimizers["query_only"]
 	assert.False(t, ok)
 }
+
+func TestIngestBuffer(t *testing.T) {
+	os.Setenv(configFileLocationEnvVar, "./test_configs/ingest_buffer.yaml")
+	cfg := LoadV2Config()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("error validating config: %v", err)
+	}
+	legacyConf := cfg.TranslateToLegacyConfig()
+	assert.NotNil(t, legacyConf.IngestBuffer)
+	assert.Equal(t, 5*time.Second, legacyConf.IngestBuffer.Interval())
+	assert.Equal(t, DefaultIngestBufferMaxBatchSize, legacyConf.IngestBuffer.BatchSize())
+	assert.Equal(t, 50000, legacyConf.IngestBuffer.BufferedDocs())
+	assert.Equal(t, "/var/quesma/wal", legacyConf.IngestBuffer.WriteAheadLogPath)
+}
@@ -0,0 +1,51 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package config
+
+import "fmt"
+
+const (
+	DeadLetterQueueClickhouse = "clickhouse"
+	DeadLetterQueueFile       = "file"
+
+	DefaultDeadLetterQueueTableName = "quesma_dead_letters"
+)
+
+// DeadLetterQueueConfiguration tells where documents rejected during ingest are stored
+type DeadLetterQueueConfiguration struct {
+	Type      string `koanf:"type"`      // "clickhouse" or "file"
+	TableName string `koanf:"tableName"` // ClickHouse table, DefaultDeadLetterQueueTableName if empty
+	Path      string `koanf:"path"`      // file with one JSON document per line, required by the "file" type
+}
+
+func (c *DeadLetterQueueConfiguration) validate() error {
+	switch c.Type {
+	case DeadLetterQueueClickhouse:
+		return nil
+	case DeadLetterQueueFile:
+		if c.Path == "" {
+			return fmt.Errorf("dead letter queue of type %s requires a path", c.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("dead letter queue type %s not recognized, only `%s` and `%s` are supported", c.Type, DeadLetterQueueClickhouse, DeadLetterQueueFile)
+	}
+}
+
+func (c *DeadLetterQueueConfiguration) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	if c.Type == DeadLetterQueueFile {
+		return fmt.Sprintf("file %s", c.Path)
+	}
+	return fmt.Sprintf("clickhouse table %s", c.Table())
+}
+
+// Table returns the name of the ClickHouse table storing dead letters
+func (c *DeadLetterQueueConfiguration) Table() string {
+	if c.TableName != "" {
+		return c.TableName
+	}
+	return DefaultDeadLetterQueueTableName
+}
@@ -19,12 +19,22 @@ type IndexConfiguration struct {
 	Override        string                            `koanf:"tableName"` // use method TableName()
 	UseCommonTable  bool                              `koanf:"useCommonTable"`
 	Target          any                               `koanf:"target"`
+	DefaultPipeline string                            `koanf:"defaultPipeline"` // ingest pipeline used when the request doesn't name one
+	Scoring         bool                              `koanf:"scoring"`         // compute relevance score (_score) of hits
+	SchemaEvolution []string                          `koanf:"schemaEvolution"` // strategies applied when a value doesn't match the type of its column
 
 	// Computed based on the overall configuration
 	QueryTarget  []string
 	IngestTarget []string
 }
 
+// Schema evolution strategies, see `schemaEvolution` in the configuration primer
+const (
+	SchemaEvolutionWiden  = "widen"  // widen numeric columns, Int32 → Int64 → Float64
+	SchemaEvolutionArray  = "array"  // migrate scalar columns to arrays
+	SchemaEvolutionShadow = "shadow" // store values of incompatible types in shadow columns
+)
+
 type OptimizerConfiguration struct {
 	Disabled   bool              `koanf:"disabled"`
 	Properties map[string]string `koanf:"properties"`
@@ -60,10 +70,25 @@ func (c IndexConfiguration) String(indexName string) string {
 	if c.UseCommonTable {
 		builder.WriteString(", useSingleTable: true")
 	}
+	if len(c.DefaultPipeline) > 0 {
+		builder.WriteString(", defaultPipeline: ")
+		builder.WriteString(c.DefaultPipeline)
+	}
+	if c.Scoring {
+		builder.WriteString(", scoring: true")
+	}
+	if len(c.SchemaEvolution) > 0 {
+		builder.WriteString(", schemaEvolution: ")
+		builder.WriteString(strings.Join(c.SchemaEvolution, ","))
+	}
 
 	return builder.String()
 }
 
+func (c IndexConfiguration) HasSchemaEvolution(strategy string) bool {
+	return slices.Contains(c.SchemaEvolution, strategy)
+}
+
 func (c IndexConfiguration) GetOptimizerConfiguration(optimizerName string) (props map[string]string, disabled bool) {
 	if optimizer, ok := c.Optimizers[optimizerName]; ok {
 		return optimizer.Properties, optimizer.Disabled
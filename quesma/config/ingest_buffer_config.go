@@ -0,0 +1,69 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultIngestBufferFlushInterval   = 1 * time.Second
+	DefaultIngestBufferMaxBatchSize    = 10_000
+	DefaultIngestBufferMaxBufferedDocs = 100_000
+)
+
+// IngestBufferConfiguration enables batching of documents ingested into ClickHouse.
+// Documents are buffered per index and inserted together, when the batch is big enough or flushInterval has passed.
+type IngestBufferConfiguration struct {
+	FlushInterval     time.Duration `koanf:"flushInterval"`     // DefaultIngestBufferFlushInterval if zero
+	MaxBatchSize      int           `koanf:"maxBatchSize"`      // documents of one index triggering a flush, DefaultIngestBufferMaxBatchSize if zero
+	MaxBufferedDocs   int           `koanf:"maxBufferedDocs"`   // above that ingest requests are rejected with 429, DefaultIngestBufferMaxBufferedDocs if zero
+	WriteAheadLogPath string        `koanf:"writeAheadLogPath"` // directory of the write-ahead log, buffered documents are lost on restart if empty
+	DisableWALSync    bool          `koanf:"disableWALSync"`    // skips fsync of the write-ahead log, faster but documents may be lost on a crash
+}
+
+func (c *IngestBufferConfiguration) validate() error {
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("ingest buffer flushInterval must be positive, got %s", c.FlushInterval)
+	}
+	if c.MaxBatchSize < 0 || c.MaxBufferedDocs < 0 {
+		return fmt.Errorf("ingest buffer maxBatchSize and maxBufferedDocs must be positive")
+	}
+	if c.MaxBufferedDocs > 0 && c.MaxBatchSize > c.MaxBufferedDocs {
+		return fmt.Errorf("ingest buffer maxBatchSize (%d) can't be greater than maxBufferedDocs (%d)", c.MaxBatchSize, c.MaxBufferedDocs)
+	}
+	return nil
+}
+
+func (c *IngestBufferConfiguration) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	wal := "no write-ahead log"
+	if c.WriteAheadLogPath != "" {
+		wal = "write-ahead log " + c.WriteAheadLogPath
+	}
+	return fmt.Sprintf("flush every %s or %d documents, up to %d buffered documents, %s", c.Interval(), c.BatchSize(), c.BufferedDocs(), wal)
+}
+
+func (c *IngestBufferConfiguration) Interval() time.Duration {
+	if c.FlushInterval > 0 {
+		return c.FlushInterval
+	}
+	return DefaultIngestBufferFlushInterval
+}
+
+func (c *IngestBufferConfiguration) BatchSize() int {
+	if c.MaxBatchSize > 0 {
+		return c.MaxBatchSize
+	}
+	return DefaultIngestBufferMaxBatchSize
+}
+
+func (c *IngestBufferConfiguration) BufferedDocs() int {
+	if c.MaxBufferedDocs > 0 {
+		return c.MaxBufferedDocs
+	}
+	return DefaultIngestBufferMaxBufferedDocs
+}
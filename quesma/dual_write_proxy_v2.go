@@ -57,6 +57,7 @@ type dualWriteHttpProxyV2 struct {
 	queryRunner         *frontend_connectors.QueryRunner
 	schemaRegistry      schema.Registry
 	schemaLoader        clickhouse.TableDiscovery
+	ingestProcessor     *ingest.IngestProcessor
 }
 
 func (q *dualWriteHttpProxyV2) Stop(ctx context.Context) {
@@ -117,8 +118,11 @@ func newDualWriteProxyV2(dependencies quesma_api.Dependencies, schemaLoader clic
 		asyncQueriesEvictor: async_search_storage.NewAsyncQueriesEvictor(
 			queryProcessor.AsyncRequestStorage.(async_search_storage.AsyncSearchStorageInMemory),
 			queryProcessor.AsyncQueriesContexts.(async_search_storage.AsyncQueryContextStorageInMemory),
+			queryProcessor.ScrollContexts.(async_search_storage.ScrollContextStorageInMemory),
+			queryProcessor.PointsInTime.(async_search_storage.PointInTimeStorageInMemory),
 		),
-		queryRunner: queryProcessor,
+		queryRunner:     queryProcessor,
+		ingestProcessor: ingestProcessor,
 	}
 }
 
@@ -133,11 +137,18 @@ func (q *dualWriteHttpProxyV2) Close(ctx context.Context) {
 		q.asyncQueriesEvictor.Close()
 	}
 	q.quesmaV2.Stop(ctx)
+	// after frontends are stopped, so buffered documents are flushed and no new ones come
+	if q.ingestProcessor != nil {
+		q.ingestProcessor.Stop()
+	}
 }
 
 func (q *dualWriteHttpProxyV2) Ingest() {
 	q.schemaLoader.ReloadTableDefinitions()
 	q.logManager.Start()
+	if q.ingestProcessor != nil {
+		q.ingestProcessor.Start()
+	}
 	go q.asyncQueriesEvictor.AsyncQueriesGC()
 	q.quesmaV2.Start()
 }
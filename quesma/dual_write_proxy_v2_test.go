@@ -0,0 +1,66 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/ab_testing"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/ingest"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/QuesmaOrg/quesma/quesma/v2/core/diag"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newDualWriteProxyTestSetup(t *testing.T, indexName string, cfg *config.QuesmaConfiguration) (*dualWriteHttpProxyV2, *ingest.IngestProcessor, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	chDb := backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+
+	tableDisco := clickhouse.NewEmptyTableDiscovery()
+	tableDisco.AddTable(indexName, &clickhouse.Table{
+		Name:    indexName,
+		Cols:    map[string]*clickhouse.Column{"message": {Name: "message", Type: clickhouse.NewBaseType("String")}},
+		Config:  ingest.NewDefaultCHConfig(),
+		Created: true,
+	})
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: indexName, ClickhouseIndexes: []string{indexName}}},
+	}
+	registry := schema.NewStaticRegistry(map[schema.IndexName]schema.Schema{}, map[string]schema.Table{}, map[schema.FieldEncodingKey]schema.EncodedFieldName{})
+
+	ip := ingest.NewIngestProcessor(cfg, chDb, diag.NewPhoneHomeEmptyAgent(), tableDisco, registry, persistence.NewStaticJSONDatabase(), resolver, persistence.NewStaticJSONDatabase(), persistence.NewStaticJSONDatabase(), persistence.NewStaticJSONDatabase())
+	logManager := clickhouse.NewEmptyLogManager(cfg, chDb, diag.NewPhoneHomeEmptyAgent(), tableDisco)
+	proxy := newDualWriteProxyV2(mux.EmptyDependencies(), tableDisco, logManager, registry, cfg, ip, resolver, ab_testing.NewEmptySender())
+	return proxy, ip, mock
+}
+
+func TestDualWriteProxyFlushesIngestBufferOnClose(t *testing.T) {
+	const indexName = "buffered_logs"
+	cfg := &config.QuesmaConfiguration{
+		PublicTcpPort: 0,
+		DisableAuth:   true,
+		Elasticsearch: config.ElasticsearchConfiguration{Url: &config.Url{}},
+		IngestBuffer:  &config.IngestBufferConfiguration{FlushInterval: time.Hour},
+	}
+	proxy, ip, mock := newDualWriteProxyTestSetup(t, indexName, cfg)
+	proxy.Ingest()
+
+	require.NoError(t, ip.Ingest(context.Background(), indexName, []types.JSON{{"message": "a"}}))
+
+	// documents buffered by the proxy are inserted when Quesma stops
+	mock.ExpectExec(`INSERT INTO "buffered_logs" FORMAT JSONEachRow {"message":"a"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	proxy.Close(context.Background())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -79,6 +79,8 @@ func ParseElasticType(t string) (schema.QuesmaType, bool) {
 		return schema.QuesmaTypeBoolean, true
 	case elasticsearch_field_types.FieldTypeIp:
 		return schema.QuesmaTypeIp, true
+	case elasticsearch_field_types.FieldTypeNested:
+		return schema.QuesmaTypeNested, true
 	case elasticsearch_field_types.FieldTypeGeoPoint:
 		return schema.QuesmaTypePoint, true
 	default:
@@ -108,6 +110,8 @@ func schemaTypeToElasticType(t schema.QuesmaType) string {
 		return elasticsearch_field_types.FieldTypeBoolean
 	case schema.QuesmaTypeObject.Name:
 		return elasticsearch_field_types.FieldTypeObject
+	case schema.QuesmaTypeNested.Name:
+		return elasticsearch_field_types.FieldTypeNested
 	case schema.QuesmaTypeIp.Name:
 		return elasticsearch_field_types.FieldTypeIp
 	case schema.QuesmaTypePoint.Name:
@@ -0,0 +1,99 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/end_user_errors"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"reflect"
+	"strings"
+)
+
+// applyAliasFilters adds the filter of aliases the indexes were matched by to the query (like Elasticsearch, as a `bool` filter).
+// EQL query is a string, so there the filter is added to the `filter` parameter, which is Query DSL.
+func applyAliasFilters(body types.JSON, queryLanguage QueryLanguage, indexes []string, aliasFilters map[string]any) (types.JSON, error) {
+	filter, err := commonAliasFilter(indexes, aliasFilters)
+	if err != nil || filter == nil {
+		return body, err
+	}
+
+	key := "query"
+	if queryLanguage == QueryLanguageEQL {
+		key = "filter"
+	}
+	filtered := make(types.JSON, len(body))
+	for k, value := range body {
+		filtered[k] = value
+	}
+	filtered[key] = filterQuery(body[key], filter)
+	return filtered, nil
+}
+
+// commonAliasFilter returns the filter of aliases the indexes were matched by, nil if there is none.
+// All indexes have to share the same filter, as there is no way to tell rows of different indexes apart in the query.
+func commonAliasFilter(indexes []string, aliasFilters map[string]any) (map[string]any, error) {
+	var filter any
+	for i, index := range indexes {
+		indexFilter := aliasFilters[index]
+		if i > 0 && !reflect.DeepEqual(filter, indexFilter) {
+			return nil, end_user_errors.ErrSearchCondition.New(fmt.Errorf("indexes %v are matched by aliases with different filters, it's not supported", indexes))
+		}
+		filter = indexFilter
+	}
+	if filter == nil {
+		return nil, nil
+	}
+	filterMap, ok := filter.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid filter of aliases of indexes %v: %v", indexes, filter)
+	}
+	return filterMap, nil
+}
+
+// filterQuery returns Query DSL query matching documents which match both the query (if any) and the filter
+func filterQuery(query any, filter map[string]any) map[string]any {
+	if query == nil {
+		query = map[string]any{"match_all": map[string]any{}}
+	}
+	return map[string]any{"bool": map[string]any{"must": []any{query}, "filter": []any{filter}}}
+}
+
+// matchingAliases returns aliases matching any of comma separated names, which may be patterns
+func matchingAliases(aliases []table_resolver.Alias, names string) []table_resolver.Alias {
+	var result []table_resolver.Alias
+	for _, alias := range aliases {
+		for _, name := range strings.Split(names, ",") {
+			if matches, _ := util.IndexPatternMatches(name, alias.Name); matches || name == alias.Name {
+				result = append(result, alias)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// aliasesResponse renders aliases in the format of `GET /_alias/:name`, grouped by index
+func aliasesResponse(aliases []table_resolver.Alias) types.JSON {
+	response := types.JSON{}
+	for _, alias := range aliases {
+		for _, target := range alias.Targets {
+			indexAliases, ok := response[target.Index].(types.JSON)
+			if !ok {
+				indexAliases = types.JSON{"aliases": types.JSON{}}
+				response[target.Index] = indexAliases
+			}
+			definition := types.JSON{}
+			if target.Filter != nil {
+				definition["filter"] = target.Filter
+			}
+			if target.IsWriteIndex {
+				definition["is_write_index"] = true
+			}
+			indexAliases["aliases"].(types.JSON)[alias.Name] = definition
+		}
+	}
+	return response
+}
@@ -0,0 +1,50 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyAliasFilters(t *testing.T) {
+	filter := map[string]any{"term": map[string]any{"level": "error"}}
+	body := types.MustJSON(`{"query": {"match": {"message": "timeout"}}, "size": 10}`)
+
+	filtered, err := applyAliasFilters(body, QueryLanguageDefault, []string{"logs-1", "logs-2"}, map[string]any{"logs-1": filter, "logs-2": filter})
+	require.NoError(t, err)
+	assert.Equal(t, types.MustJSON(`{"query": {"bool": {"must": [{"match": {"message": "timeout"}}], "filter": [{"term": {"level": "error"}}]}}, "size": 10}`), normalizeJSON(t, filtered))
+	assert.Equal(t, map[string]any{"match": map[string]any{"message": "timeout"}}, body["query"])
+
+	_, err = applyAliasFilters(body, QueryLanguageDefault, []string{"logs-1", "logs-2"}, map[string]any{"logs-2": filter})
+	assert.ErrorContains(t, err, "matched by aliases with different filters")
+
+	eqlBody := types.MustJSON(`{"query": "process where true", "filter": {"range": {"@timestamp": {"gte": "now-1d"}}}}`)
+	filtered, err = applyAliasFilters(eqlBody, QueryLanguageEQL, []string{"logs-1"}, map[string]any{"logs-1": filter})
+	require.NoError(t, err)
+	assert.Equal(t, types.MustJSON(`{"query": "process where true", "filter": {"bool": {"must": [{"range": {"@timestamp": {"gte": "now-1d"}}}], "filter": [{"term": {"level": "error"}}]}}}`), normalizeJSON(t, filtered))
+}
+
+func TestAliasesResponse(t *testing.T) {
+	aliases := []table_resolver.Alias{
+		{Name: "logs", Targets: []table_resolver.AliasTarget{{Index: "logs-1"}, {Index: "logs-2", IsWriteIndex: true}}},
+		{Name: "errors", Targets: []table_resolver.AliasTarget{{Index: "logs-1", Filter: map[string]any{"term": map[string]any{"level": "error"}}}}},
+	}
+
+	assert.Len(t, matchingAliases(aliases, "err*"), 1)
+	assert.Len(t, matchingAliases(aliases, "logs,errors"), 2)
+	assert.Empty(t, matchingAliases(aliases, "metrics"))
+
+	assert.Equal(t, types.MustJSON(`{
+		"logs-1": {"aliases": {"logs": {}, "errors": {"filter": {"term": {"level": "error"}}}}},
+		"logs-2": {"aliases": {"logs": {"is_write_index": true}}}}`), normalizeJSON(t, aliasesResponse(aliases)))
+}
+
+func normalizeJSON(t *testing.T, value types.JSON) types.JSON {
+	data, err := value.Bytes()
+	require.NoError(t, err)
+	return types.MustJSON(string(data))
+}
@@ -0,0 +1,324 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/recovery"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `_delete_by_query` and `_update_by_query` are translated into ClickHouse lightweight `DELETE FROM`
+// and `ALTER TABLE ... UPDATE` mutations, with the WHERE clause built from the Query DSL, exactly as for `_search`.
+// A mutation is applied to all matching rows at once, so there are no batches, version conflicts nor partial failures.
+// Documents are counted before the mutation, the count is reported as the number of deleted/updated documents
+// (ClickHouse doesn't report rows affected by a mutation), so documents ingested in the meantime aren't counted.
+// The query is translated in strict mode, queries which search would relax (e.g. `minimum_should_match` > 1) are refused.
+
+const (
+	deleteByQueryAction = "indices:data/write/delete/byquery"
+	updateByQueryAction = "indices:data/write/update/byquery"
+)
+
+type byQueryRetries struct {
+	Bulk   int `json:"bulk"`
+	Search int `json:"search"`
+}
+
+// byQueryStatus is the status of a running task, and a part of the final response
+type byQueryStatus struct {
+	Total                int64          `json:"total"`
+	Updated              int64          `json:"updated"`
+	Created              int64          `json:"created"`
+	Deleted              int64          `json:"deleted"`
+	Batches              int            `json:"batches"`
+	VersionConflicts     int            `json:"version_conflicts"`
+	Noops                int64          `json:"noops"`
+	Retries              byQueryRetries `json:"retries"`
+	ThrottledMillis      int            `json:"throttled_millis"`
+	RequestsPerSecond    float64        `json:"requests_per_second"`
+	ThrottledUntilMillis int            `json:"throttled_until_millis"`
+}
+
+type byQueryResponse struct {
+	Took     int64 `json:"took"`
+	TimedOut bool  `json:"timed_out"`
+	byQueryStatus
+	Failures []any `json:"failures"`
+}
+
+type byQueryMutation struct {
+	action      string
+	description string
+	table       *clickhouse.Table
+	countQuery  *model.Query // already transformed
+	statement   string       // empty if there is nothing to change (update without a script)
+}
+
+func newByQueryStatus() byQueryStatus {
+	return byQueryStatus{RequestsPerSecond: -1}
+}
+
+// HandleDeleteByQuery handles `_delete_by_query`. With waitForCompletion=false it returns just the task id.
+func (q *QueryRunner) HandleDeleteByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error) {
+	mutation, err := q.prepareByQueryMutation(ctx, indexPattern, body, deleteByQueryAction)
+	if err != nil {
+		return nil, err
+	}
+	return q.runByQueryMutation(ctx, mutation, waitForCompletion)
+}
+
+// HandleUpdateByQuery handles `_update_by_query`. Only scripts assigning values to `ctx._source` fields are supported.
+func (q *QueryRunner) HandleUpdateByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error) {
+	mutation, err := q.prepareByQueryMutation(ctx, indexPattern, body, updateByQueryAction)
+	if err != nil {
+		return nil, err
+	}
+	return q.runByQueryMutation(ctx, mutation, waitForCompletion)
+}
+
+// HandleGetTask returns the status of a task, and its result if it's completed
+func (q *QueryRunner) HandleGetTask(taskId string) ([]byte, error) {
+	t, err := q.Tasks.load(taskId)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(t.toResponse(time.Now()))
+}
+
+func (q *QueryRunner) prepareByQueryMutation(ctx context.Context, indexPattern string, body types.JSON, action string) (*byQueryMutation, error) {
+	if _, ok := body["max_docs"]; ok {
+		return nil, fmt.Errorf("%w: [max_docs] is not supported", quesma_errors.ErrCouldNotParseRequest())
+	}
+
+	table, currentSchema, indexes, aliasFilter, err := q.resolveClickhouseSource(indexPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	queryMap := elastic_query_dsl.QueryMap{"match_all": map[string]any{}}
+	if queryAsAny, ok := body["query"]; ok {
+		if queryMap, ok = queryAsAny.(map[string]any); !ok {
+			return nil, fmt.Errorf("%w: [query] must be an object, got %T", quesma_errors.ErrCouldNotParseRequest(), queryAsAny)
+		}
+	}
+	if aliasFilter != nil {
+		queryMap = filterQuery(queryMap, aliasFilter)
+	}
+
+	// the query is translated strictly, documents it doesn't match exactly mustn't be changed
+	translator := &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: ctx, DateMathRenderer: q.DateMathRenderer, Indexes: indexes, Schema: currentSchema, Table: table, Strict: true}
+	simpleQuery := translator.ParseQueryMap(queryMap)
+	if relaxations := translator.Relaxations(); len(relaxations) > 0 {
+		return nil, fmt.Errorf("%w: query can't be translated exactly, no documents were changed: %s", quesma_errors.ErrCouldNotParseRequest(), strings.Join(relaxations, "; "))
+	}
+	if !simpleQuery.CanParse {
+		return nil, fmt.Errorf("%w: can't parse query", quesma_errors.ErrCouldNotParseRequest())
+	}
+
+	countQuery := translator.BuildCountQuery(simpleQuery.WhereClause, 0)
+	countQuery.TableName = table.Name
+	countQuery.Indexes = indexes
+	countQuery.Schema = currentSchema
+
+	// the count query goes through the same transformations as queries of `_search`,
+	// its FROM and WHERE clauses (physical table, encoded column names, index name filter) are used by the mutation
+	plan := &model.ExecutionPlan{
+		Name:                  model.MainExecutionPlan,
+		Queries:               []*model.Query{countQuery},
+		QueryRowsTransformers: make([]model.QueryRowsTransformer, 1),
+		StartTime:             time.Now(),
+	}
+	if err = q.transformQueries(plan); err != nil {
+		return nil, err
+	}
+	countQuery = plan.Queries[0]
+
+	mutation := &byQueryMutation{action: action, table: table, countQuery: countQuery}
+	from := model.AsString(countQuery.SelectCommand.FromClause)
+	if table.ClusterName != "" {
+		from += " ON CLUSTER " + strconv.Quote(table.ClusterName)
+	}
+	where := "1"
+	if countQuery.SelectCommand.WhereClause != nil {
+		where = model.AsString(countQuery.SelectCommand.WhereClause)
+	}
+
+	switch action {
+	case deleteByQueryAction:
+		mutation.description = fmt.Sprintf("delete-by-query [%s]", indexPattern)
+		mutation.statement = fmt.Sprintf("DELETE FROM %s WHERE %s", from, where)
+	case updateByQueryAction:
+		mutation.description = fmt.Sprintf("update-by-query [%s]", indexPattern)
+		script, ok := body["script"]
+		if !ok {
+			return mutation, nil
+		}
+		assignments, err := buildUpdateAssignments(script, currentSchema)
+		if err != nil {
+			return nil, err
+		}
+		mutation.description += fmt.Sprintf(" updated with [%s]", strings.Join(assignments, ", "))
+		mutation.statement = fmt.Sprintf("ALTER TABLE %s UPDATE %s WHERE %s", from, strings.Join(assignments, ", "), where)
+	}
+	return mutation, nil
+}
+
+// buildUpdateAssignments translates update script into assignments of `ALTER TABLE ... UPDATE`
+func buildUpdateAssignments(script any, currentSchema schema.Schema) ([]string, error) {
+	var source string
+	var params map[string]any
+	switch script := script.(type) {
+	case string:
+		source = script
+	case map[string]any:
+		if lang, ok := script["lang"]; ok && lang != "painless" {
+			return nil, fmt.Errorf("%w: script lang [%v] is not supported", quesma_errors.ErrCouldNotParseRequest(), lang)
+		}
+		source, _ = script["source"].(string)
+		params, _ = script["params"].(map[string]any)
+	default:
+		return nil, fmt.Errorf("%w: [script] must be a string or an object, got %T", quesma_errors.ErrCouldNotParseRequest(), script)
+	}
+
+	sourceAssignments, err := painful.ParseSourceAssignments(source, params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	resolveColumn := func(fieldName string) (model.ColumnRef, error) {
+		field, ok := currentSchema.ResolveField(fieldName)
+		if !ok {
+			return model.ColumnRef{}, fmt.Errorf("%w: field [%s] not found in the schema", quesma_errors.ErrCouldNotParseRequest(), fieldName)
+		}
+		return model.NewColumnRef(field.InternalPropertyName.AsString()), nil
+	}
+
+	assignments := make([]string, 0, len(sourceAssignments))
+	for _, assignment := range sourceAssignments {
+		column, err := resolveColumn(assignment.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		var value model.Expr
+		switch v := assignment.Value.(type) {
+		case nil:
+			value = model.NewLiteral("NULL")
+		case string:
+			value = model.NewLiteralSingleQuoteString(v)
+		case painful.SourceField:
+			if value, err = resolveColumn(string(v)); err != nil {
+				return nil, err
+			}
+		default:
+			value = model.NewLiteral(v)
+		}
+
+		switch assignment.Operator {
+		case painful.RemoveOperator:
+			value = model.NewLiteral("NULL")
+		case "+=":
+			if _, isString := assignment.Value.(string); isString {
+				value = model.NewFunction("concat", column, value)
+			} else {
+				value = model.NewInfixExpr(column, "+", value)
+			}
+		case "-=":
+			value = model.NewInfixExpr(column, "-", value)
+		case "*=":
+			value = model.NewInfixExpr(column, "*", value)
+		}
+		assignments = append(assignments, model.AsString(column)+" = "+model.AsString(value))
+	}
+	return assignments, nil
+}
+
+func (q *QueryRunner) runByQueryMutation(ctx context.Context, mutation *byQueryMutation, waitForCompletion bool) ([]byte, error) {
+	if waitForCompletion {
+		response, err := q.executeByQueryMutation(ctx, mutation, nil)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(response)
+	}
+
+	t := q.Tasks.start(mutation.action, mutation.description)
+	t.setStatus(newByQueryStatus())
+	go func() {
+		ctx := context.WithoutCancel(ctx) // the task outlives the request
+		defer recovery.LogAndHandlePanic(ctx, func(err error) {
+			t.complete(nil, err)
+		})
+		response, err := q.executeByQueryMutation(ctx, mutation, t)
+		if err != nil {
+			logger.ErrorWithCtx(ctx).Msgf("task %s failed: %v", taskId(t), err)
+			t.complete(nil, err)
+			return
+		}
+		t.complete(response, nil)
+	}()
+	return json.Marshal(types.JSON{"task": taskId(t)})
+}
+
+// executeByQueryMutation counts matching documents and runs the mutation. Progress is reported to the task, if any.
+func (q *QueryRunner) executeByQueryMutation(ctx context.Context, mutation *byQueryMutation, t *task) (*byQueryResponse, error) {
+	startTime := time.Now()
+	status := newByQueryStatus()
+
+	plan := &model.ExecutionPlan{
+		Name:                  model.MainExecutionPlan,
+		Queries:               []*model.Query{mutation.countQuery},
+		QueryRowsTransformers: make([]model.QueryRowsTransformer, 1),
+		StartTime:             startTime,
+	}
+	_, results, err := q.searchWorkerCommon(ctx, plan, mutation.table)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 0 && len(results[0]) > 0 && len(results[0][0].Cols) > 0 {
+		if status.Total, err = util.ExtractInt64(results[0][0].Cols[0].Value); err != nil {
+			return nil, fmt.Errorf("could not read count of documents: %w", err)
+		}
+	}
+	if t != nil {
+		t.setStatus(status)
+	}
+
+	switch {
+	case mutation.statement == "": // update without a script, documents stay as they are
+		status.Updated = status.Total
+	case status.Total > 0:
+		if err = q.logManager.ExecuteMutation(ctx, mutation.statement); err != nil {
+			return nil, err
+		}
+		status.Batches = 1
+		if mutation.action == deleteByQueryAction {
+			status.Deleted = status.Total
+		} else {
+			status.Updated = status.Total
+		}
+	}
+	if t != nil {
+		t.setStatus(status)
+	}
+
+	return &byQueryResponse{
+		Took:          time.Since(startTime).Milliseconds(),
+		byQueryStatus: status,
+		Failures:      []any{},
+	}, nil
+}
@@ -0,0 +1,134 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newByQueryTestRunner(t *testing.T) (*QueryRunner, sqlmock.Sqlmock) {
+	fields := map[schema.FieldName]schema.Field{
+		"status":  {PropertyName: "status", InternalPropertyName: "status", Type: schema.QuesmaTypeKeyword},
+		"count":   {PropertyName: "count", InternalPropertyName: "count", Type: schema.QuesmaTypeInteger},
+		"message": {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	}
+	staticRegistry := schema.NewStaticRegistry(
+		map[schema.IndexName]schema.Schema{tableName: schema.NewSchema(fields, true, "")},
+		map[string]schema.Table{},
+		map[schema.FieldEncodingKey]schema.EncodedFieldName{},
+	)
+	tab := util.NewSyncMapWith(tableName, &clickhouse.Table{
+		Name:   tableName,
+		Config: clickhouse.NewChTableConfigTimestampStringAttr(),
+		Cols: map[string]*clickhouse.Column{
+			"status":  {Name: "status", Type: clickhouse.NewBaseType("String")},
+			"count":   {Name: "count", Type: clickhouse.NewBaseType("Int64")},
+			"message": {Name: "message", Type: clickhouse.NewBaseType("String")},
+		},
+		Created: true,
+	})
+
+	conn, mock := util.InitSqlMockWithPrettySqlAndPrint(t, false)
+	t.Cleanup(func() { conn.Close() })
+	db := backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	return NewQueryRunnerDefaultForTests(db, &DefaultConfig, tableName, tab, staticRegistry), mock
+}
+
+func TestDeleteByQuery(t *testing.T) {
+	queryRunner, mock := newByQueryTestRunner(t)
+
+	mock.ExpectQuery(`SELECT count(*) AS "column_0" FROM __quesma_table_name WHERE "status"='closed'`).
+		WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(3)))
+	mock.ExpectExec(`DELETE FROM __quesma_table_name WHERE "status"='closed'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	response, err := queryRunner.HandleDeleteByQuery(ctx, tableName, types.MustJSON(`{"query": {"term": {"status": "closed"}}}`), true)
+	require.NoError(t, err)
+
+	var responseMap types.JSON
+	require.NoError(t, json.Unmarshal(response, &responseMap))
+	assert.Equal(t, 3.0, responseMap["total"])
+	assert.Equal(t, 3.0, responseMap["deleted"])
+	assert.Equal(t, []any{}, responseMap["failures"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateByQueryAsTask(t *testing.T) {
+	queryRunner, mock := newByQueryTestRunner(t)
+
+	mock.ExpectQuery(`SELECT count(*) AS "column_0" FROM __quesma_table_name`).
+		WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(5)))
+	mock.ExpectExec(`ALTER TABLE __quesma_table_name UPDATE "status" = 'it\'s done', "count" = "count"+2, "message" = NULL WHERE 1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	body := types.MustJSON(`{"script": {"source": "ctx._source.status = params.status; ctx._source.count += 2; ctx._source.remove('message')",
+		"params": {"status": "it's done"}}}`)
+	response, err := queryRunner.HandleUpdateByQuery(ctx, tableName, body, false)
+	require.NoError(t, err)
+
+	var responseMap types.JSON
+	require.NoError(t, json.Unmarshal(response, &responseMap))
+	taskId, _ := responseMap["task"].(string)
+
+	var task types.JSON
+	assert.Eventually(t, func() bool {
+		taskResponse, err := queryRunner.HandleGetTask(taskId)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(taskResponse, &task))
+		return task["completed"] == true
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Nil(t, task["error"])
+	assert.Equal(t, updateByQueryAction, task["task"].(map[string]any)["action"])
+	assert.Equal(t, 5.0, task["response"].(map[string]any)["updated"])
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = queryRunner.HandleGetTask("quesma:12345")
+	assert.True(t, errors.Is(err, errTaskMissing))
+}
+
+func TestByQueryErrors(t *testing.T) {
+	queryRunner, _ := newByQueryTestRunner(t)
+	for _, body := range []string{
+		`{"max_docs": 10}`,
+		`{"script": {"source": "ctx._source.unknown = 1"}}`,
+		`{"script": {"source": "ctx._source.count = 1", "lang": "expression"}}`,
+		`{"script": "ctx._source.count++"}`,
+	} {
+		_, err := queryRunner.HandleUpdateByQuery(ctx, tableName, types.MustJSON(body), true)
+		assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()), body)
+	}
+}
+
+func TestByQueryRefusesRelaxedQueries(t *testing.T) {
+	queryRunner, mock := newByQueryTestRunner(t)
+	// search translates these leniently (matching more documents), mutations mustn't run on such a translation
+	for _, query := range []string{
+		`{"bool": {"should": [{"term": {"status": "a"}}, {"term": {"status": "b"}}], "minimum_should_match": 2}}`,
+		`{"bool": {"should": [{"term": {"status": "a"}}], "minimum_should_match": "50%"}}`,
+		`{"bool": {"filter": [{"term": {"_index": "other"}}]}}`,
+		`{"terms": {"_tier": ["data_hot"]}}`,
+		`{"term": {"status": "a"}, "range": {"count": {"gte": 1}}}`,
+		`{"match": {"message": {"query": "a b", "operator": "and"}}}`,
+		`{"range": {"count": {"gte": 1, "time_zone": "+01:00"}}}`,
+		`{"percolate": {"field": "query"}}`,
+	} {
+		body := types.MustJSON(`{"query": ` + query + `}`)
+		_, err := queryRunner.HandleDeleteByQuery(ctx, tableName, body, true)
+		assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()), "%s %v", query, err)
+		_, err = queryRunner.HandleUpdateByQuery(ctx, tableName, body, true)
+		assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()), query)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
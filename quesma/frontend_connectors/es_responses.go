@@ -118,8 +118,15 @@ func bulkInsertResult(ctx context.Context, ops []bulk.BulkItem, err error) (*que
 		}, nil
 	}
 
+	hasErrors := false
+	allRejected := len(ops) > 0
+	for _, op := range ops {
+		hasErrors = hasErrors || op.HasError()
+		allRejected = allRejected && op.IsRejected()
+	}
+
 	body, err := json.Marshal(bulk.BulkResponse{
-		Errors: false,
+		Errors: hasErrors,
 		Items:  ops,
 		Took:   42,
 	})
@@ -127,7 +134,12 @@ func bulkInsertResult(ctx context.Context, ops []bulk.BulkItem, err error) (*que
 		return nil, err
 	}
 
-	return elasticsearchInsertResult(string(body), http.StatusOK), nil
+	statusCode := http.StatusOK
+	if allRejected {
+		// the ingest buffer is full, clients should back off and retry the whole request
+		statusCode = http.StatusTooManyRequests
+	}
+	return elasticsearchInsertResult(string(body), statusCode), nil
 }
 
 // ElasticsearchInsertResult is a low-effort way to export widely used func without too much refactoring
@@ -166,6 +178,9 @@ func indexDocResult(bulkItem bulk.BulkItem) (*quesma_api.Result, error) {
 	if err != nil {
 		return nil, err
 	}
+	if bulkItem.IsRejected() {
+		return elasticsearchInsertResult(string(body), http.StatusTooManyRequests), nil
+	}
 	return elasticsearchInsertResult(string(body), http.StatusOK), nil
 }
 
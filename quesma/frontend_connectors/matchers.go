@@ -3,12 +3,20 @@
 package frontend_connectors
 
 import (
+	"github.com/QuesmaOrg/quesma/quesma/async_search_storage"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
+	"github.com/QuesmaOrg/quesma/quesma/ingest"
 	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_sql"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/esql"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
 	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
 	"github.com/QuesmaOrg/quesma/quesma/v2/core"
 	"github.com/QuesmaOrg/quesma/quesma/v2/core/tracing"
 	"github.com/goccy/go-json"
+	"slices"
 	"strings"
 )
 
@@ -21,6 +29,271 @@ func matchedAgainstAsyncId() quesma_api.RequestMatcher {
 	})
 }
 
+// matchedAgainstScrollId matches only scroll ids issued by Quesma, the rest is handled by Elasticsearch
+func matchedAgainstScrollId() quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		scrollIds := scrollIdsFromRequest(req)
+		if len(scrollIds) == 0 {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		for _, scrollId := range scrollIds {
+			if scrollId != scrollAllIds && !strings.HasPrefix(scrollId, async_search_storage.ScrollIdPrefix) {
+				return quesma_api.MatchResult{Matched: false}
+			}
+		}
+		return quesma_api.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstPitId matches only PIT ids issued by Quesma, the rest is handled by Elasticsearch
+func matchedAgainstPitId() quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		if !strings.HasPrefix(pitIdFromRequest(req), async_search_storage.PitIdPrefix) {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		return quesma_api.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstTaskId matches only task ids issued by Quesma, the rest is handled by Elasticsearch
+func matchedAgainstTaskId() quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		if !strings.HasPrefix(req.Params["id"], TaskIdPrefix) {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		return quesma_api.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstMgetIndexes matches `_mget` without index in the path, if all requested docs are in ClickHouse
+func matchedAgainstMgetIndexes(indexRegistry table_resolver.TableResolver) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		docs, ok := body["docs"].([]any)
+		if !ok || len(docs) == 0 {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		for _, d := range docs {
+			doc, _ := d.(map[string]any)
+			index, _ := doc["_index"].(string)
+			if index == "" || !isClickhouseDecision(indexRegistry.Resolve(quesma_api.QueryPipeline, index)) {
+				return quesma_api.MatchResult{Matched: false}
+			}
+		}
+		return quesma_api.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstAliasActions matches `POST /_aliases` if indexes of all actions are in ClickHouse
+func matchedAgainstAliasActions(indexRegistry table_resolver.TableResolver) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		actions, err := table_resolver.ParseAliasActions(body)
+		if err != nil || len(actions) == 0 {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		for _, action := range actions {
+			if !isClickhouseDecision(indexRegistry.Resolve(quesma_api.QueryPipeline, action.Index)) {
+				return quesma_api.MatchResult{Matched: false}
+			}
+		}
+		return quesma_api.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstAliasName matches if any of the requested aliases is managed by Quesma
+func matchedAgainstAliasName(indexRegistry table_resolver.TableResolver) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		return quesma_api.MatchResult{Matched: len(matchingAliases(indexRegistry.Aliases(), req.Params["name"])) > 0}
+	})
+}
+
+// matchedExactIngestPathOrClosed matches indexes stored in ClickHouse, including closed ones
+func matchedExactIngestPathOrClosed(indexRegistry table_resolver.TableResolver) quesma_api.RequestMatcher {
+	ingestPath := matchedExactIngestPath(indexRegistry)
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		if slices.Contains(indexRegistry.ClosedIndexes(), req.Params["index"]) {
+			return quesma_api.MatchResult{Matched: true}
+		}
+		return ingestPath.Matches(req)
+	})
+}
+
+// matchedAgainstStoredResource matches requests for cluster-wide resources (like lifecycle policies) handled by Quesma.
+// If some indexes are ingested into Elasticsearch, resources unknown to Quesma are read and deleted there,
+// and resources stored by Quesma are also sent to Elasticsearch (see mirrorToElasticsearch).
+// isStored tells if Quesma has any resource matching the comma separated list of names or patterns.
+func matchedAgainstStoredResource(elasticsearchIngest bool, param string, isStored func(names string) bool) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		if !elasticsearchIngest || req.Method == "PUT" || req.Method == "POST" {
+			return quesma_api.MatchResult{Matched: true}
+		}
+		names := req.Params[param]
+		if names == "" {
+			// Elasticsearch has all resources, Quesma only the ones stored through it
+			return quesma_api.MatchResult{Matched: false}
+		}
+		return quesma_api.MatchResult{Matched: isStored(names)}
+	})
+}
+
+// matchedAgainstLifecyclePolicy matches lifecycle policy requests handled by Quesma, see matchedAgainstStoredResource
+func matchedAgainstLifecyclePolicy(ip *ingest.IngestProcessor, elasticsearchIngest bool) quesma_api.RequestMatcher {
+	return matchedAgainstStoredResource(elasticsearchIngest, "name", func(names string) bool {
+		return len(ip.IndexLifecycle().FindPolicies(names)) > 0
+	})
+}
+
+// matchedAgainstComponentTemplate matches component template requests handled by Quesma, see matchedAgainstStoredResource
+func matchedAgainstComponentTemplate(ip *ingest.IngestProcessor, elasticsearchIngest bool) quesma_api.RequestMatcher {
+	return matchedAgainstStoredResource(elasticsearchIngest, "name", func(names string) bool {
+		return len(ip.IndexTemplates().FindComponentTemplates(names)) > 0
+	})
+}
+
+// matchedAgainstIngestPipeline matches ingest pipeline requests handled by Quesma, see matchedAgainstStoredResource
+func matchedAgainstIngestPipeline(ip *ingest.IngestProcessor, elasticsearchIngest bool) quesma_api.RequestMatcher {
+	return matchedAgainstStoredResource(elasticsearchIngest, "id", func(ids string) bool {
+		return len(ip.Pipelines().Find(ids)) > 0
+	})
+}
+
+// matchedAgainstSimulatedPipeline matches `_simulate` of pipelines stored by Quesma, or pipelines from the request body.
+// Pipelines unknown to Quesma are simulated by Elasticsearch, if some indexes are ingested into it.
+func matchedAgainstSimulatedPipeline(ip *ingest.IngestProcessor, elasticsearchIngest bool) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		id := req.Params["id"]
+		if !elasticsearchIngest || id == "" {
+			return quesma_api.MatchResult{Matched: true}
+		}
+		_, found := ip.Pipelines().Get(id)
+		return quesma_api.MatchResult{Matched: found}
+	})
+}
+
+// matchedAgainstIndexTemplate matches index template requests handled by Quesma. Templates are created by Quesma,
+// if any of their `index_patterns` is ingested into ClickHouse (or they were created by Quesma before),
+// otherwise they're created in Elasticsearch. Reading and deleting works as in matchedAgainstStoredResource.
+func matchedAgainstIndexTemplate(ip *ingest.IngestProcessor, cfg *config.QuesmaConfiguration, tableResolver table_resolver.TableResolver, elasticsearchIngest bool) quesma_api.RequestMatcher {
+	isStored := func(names string) bool {
+		return len(ip.IndexTemplates().FindIndexTemplates(names)) > 0
+	}
+	stored := matchedAgainstStoredResource(elasticsearchIngest, "name", isStored)
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		if req.Method != "PUT" && req.Method != "POST" {
+			return stored.Matches(req)
+		}
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok || isStored(req.Params["name"]) {
+			return quesma_api.MatchResult{Matched: true}
+		}
+		var indexPatterns []any
+		switch patterns := body["index_patterns"].(type) {
+		case string:
+			indexPatterns = []any{patterns}
+		case []any:
+			indexPatterns = patterns
+		default:
+			return quesma_api.MatchResult{Matched: true} // invalid template, Quesma responds with an error
+		}
+		for _, pattern := range indexPatterns {
+			if patternAsString, ok := pattern.(string); ok && indexPatternIngestedIntoClickhouse(cfg, tableResolver, patternAsString) {
+				return quesma_api.MatchResult{Matched: true}
+			}
+		}
+		return quesma_api.MatchResult{Matched: false}
+	})
+}
+
+// indexPatternIngestedIntoClickhouse returns true if any index matching the pattern is (or would be, if it's new) ingested into ClickHouse
+func indexPatternIngestedIntoClickhouse(cfg *config.QuesmaConfiguration, tableResolver table_resolver.TableResolver, pattern string) bool {
+	if !elasticsearch.IsIndexPattern(pattern) {
+		return isClickhouseDecision(tableResolver.Resolve(quesma_api.IngestPipeline, pattern))
+	}
+	// ingest resolver doesn't accept patterns
+	if slices.Contains(cfg.DefaultIngestTarget, config.ClickhouseTarget) {
+		return true
+	}
+	for indexName := range cfg.IndexConfig {
+		if matches, _ := util.IndexPatternMatches(pattern, indexName); matches && isClickhouseDecision(tableResolver.Resolve(quesma_api.IngestPipeline, indexName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestsIntoElasticsearch returns true if any index (or any index without configuration) is ingested into Elasticsearch
+func ingestsIntoElasticsearch(cfg *config.QuesmaConfiguration) bool {
+	if slices.Contains(cfg.DefaultIngestTarget, config.ElasticsearchTarget) {
+		return true
+	}
+	for _, indexConfig := range cfg.IndexConfig {
+		if indexConfig.IsElasticIngestEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func isClickhouseDecision(decision *quesma_api.Decision) bool {
+	if decision.Err != nil {
+		return false
+	}
+	for _, connector := range decision.UseConnectors {
+		if _, ok := connector.(*quesma_api.ConnectorDecisionClickhouse); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pitIdFromRequest returns PIT id from `_search` body (`pit.id`) or `_pit` body (`id`)
+func pitIdFromRequest(req *quesma_api.Request) string {
+	body, ok := req.ParsedBody.(types.JSON)
+	if !ok {
+		return ""
+	}
+	if pit, ok := body["pit"].(map[string]any); ok {
+		pitId, _ := pit["id"].(string)
+		return pitId
+	}
+	pitId, _ := body["id"].(string)
+	return pitId
+}
+
+// scrollIdsFromRequest returns scroll ids from the path, `scroll_id` query parameter or the body
+func scrollIdsFromRequest(req *quesma_api.Request) []string {
+	if id := req.Params["id"]; id != "" {
+		return strings.Split(id, ",")
+	}
+	if id := req.QueryParams.Get("scroll_id"); id != "" {
+		return strings.Split(id, ",")
+	}
+	body, ok := req.ParsedBody.(types.JSON)
+	if !ok {
+		return nil
+	}
+	switch scrollId := body["scroll_id"].(type) {
+	case string:
+		return strings.Split(scrollId, ",")
+	case []any:
+		scrollIds := make([]string, 0, len(scrollId))
+		for _, id := range scrollId {
+			if idAsString, ok := id.(string); ok {
+				scrollIds = append(scrollIds, idAsString)
+			}
+		}
+		return scrollIds
+	}
+	return nil
+}
+
 // Query path only (looks at QueryTarget)
 func matchedAgainstPattern(indexRegistry table_resolver.TableResolver) quesma_api.RequestMatcher {
 	return matchAgainstTableResolver(indexRegistry, quesma_api.QueryPipeline)
@@ -137,3 +410,66 @@ func matchAgainstIndexNameInScriptRequestBody(tableResolver table_resolver.Table
 		return quesma_api.MatchResult{Matched: false, Decision: nil}
 	})
 }
+
+// matchAgainstSQLRequestBody checks whether the index from the FROM clause of the SQL query
+// (or the index of the query the cursor was issued for) is handled by ClickHouse
+func matchAgainstSQLRequestBody(tableResolver table_resolver.TableResolver) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		if cursor, ok := body["cursor"].(string); ok && cursor != "" {
+			return quesma_api.MatchResult{Matched: elastic_sql.IsQuesmaCursor(cursor)}
+		}
+
+		request, err := elastic_sql.ParseRequest(body)
+		if err != nil {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		statement, err := request.ParseStatement()
+		if err != nil {
+			return quesma_api.MatchResult{Matched: false}
+		}
+
+		decision := tableResolver.Resolve(quesma_api.QueryPipeline, statement.Index)
+		if decision.Err != nil {
+			return quesma_api.MatchResult{Matched: false, Decision: decision}
+		}
+		for _, connector := range decision.UseConnectors {
+			if _, ok := connector.(*quesma_api.ConnectorDecisionClickhouse); ok {
+				return quesma_api.MatchResult{Matched: true, Decision: decision}
+			}
+		}
+		return quesma_api.MatchResult{Matched: false, Decision: decision}
+	})
+}
+
+// matchAgainstESQLRequestBody checks whether indexes from the FROM command of ES|QL query are handled by ClickHouse
+func matchAgainstESQLRequestBody(tableResolver table_resolver.TableResolver) quesma_api.RequestMatcher {
+	return quesma_api.RequestMatcherFunc(func(req *quesma_api.Request) quesma_api.MatchResult {
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		request, err := esql.ParseRequest(body)
+		if err != nil {
+			return quesma_api.MatchResult{Matched: false}
+		}
+		query, err := request.ParseQuery()
+		if err != nil {
+			return quesma_api.MatchResult{Matched: false}
+		}
+
+		decision := tableResolver.Resolve(quesma_api.QueryPipeline, query.IndexPattern())
+		if decision.Err != nil {
+			return quesma_api.MatchResult{Matched: false, Decision: decision}
+		}
+		for _, connector := range decision.UseConnectors {
+			if _, ok := connector.(*quesma_api.ConnectorDecisionClickhouse); ok {
+				return quesma_api.MatchResult{Matched: true, Decision: decision}
+			}
+		}
+		return quesma_api.MatchResult{Matched: false, Decision: decision}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/eql"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/types"
 )
@@ -24,6 +25,18 @@ type IQueryTranslator interface {
 	MakeSearchResponse(queries []*model.Query, ResultSets [][]model.QueryResultRow) *model.SearchResp
 }
 
-func NewQueryTranslator(ctx context.Context, schema schema.Schema, table *clickhouse.Table, logManager clickhouse.LogManagerIFace, dateMathRenderer string, indexes []string) (queryTranslator IQueryTranslator) {
-	return &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: ctx, DateMathRenderer: dateMathRenderer, Indexes: indexes, Schema: schema, Table: table}
+type QueryLanguage string
+
+const (
+	QueryLanguageDefault QueryLanguage = "default"
+	QueryLanguageEQL     QueryLanguage = "eql"
+)
+
+func NewQueryTranslator(ctx context.Context, language QueryLanguage, schema schema.Schema, table *clickhouse.Table, logManager clickhouse.LogManagerIFace, dateMathRenderer string, indexes []string, scoring bool) (queryTranslator IQueryTranslator) {
+	switch language {
+	case QueryLanguageEQL:
+		return &eql.ClickhouseEQLQueryTranslator{Ctx: ctx, Schema: schema, Table: table, Indexes: indexes}
+	default:
+		return &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: ctx, DateMathRenderer: dateMathRenderer, Indexes: indexes, Schema: schema, Table: table, Scoring: scoring}
+	}
 }
@@ -6,6 +6,7 @@ package frontend_connectors
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/config"
@@ -19,12 +20,20 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/ingest"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_sql"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/esql"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
 	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
 	quesma_api "github.com/QuesmaOrg/quesma/quesma/v2/core"
 	"github.com/QuesmaOrg/quesma/quesma/v2/core/tracing"
+	"github.com/goccy/go-json"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func HandleDeletingAsyncSearchById(queryRunner QueryRunnerIFace, asyncSearchId string) (*quesma_api.Result, error) {
@@ -70,6 +79,111 @@ func HandleIndexSearch(ctx context.Context, indexPattern string, query types.JSO
 	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
 }
 
+func HandleEQLSearch(ctx context.Context, indexPattern string, query types.JSON, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleEQLSearch(ctx, indexPattern, query)
+	if err != nil {
+		if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &quesma_api.Result{StatusCode: http.StatusNotFound, GenericResult: make([]byte, 0)}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &quesma_api.Result{
+				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+				StatusCode:    http.StatusBadRequest,
+				GenericResult: elastic_query_dsl.BadRequestParseError(err),
+			}, nil
+		} else {
+			return nil, err
+		}
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleSQL(ctx context.Context, body types.JSON, format string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	response, err := queryRunner.HandleSQL(ctx, body)
+	if err != nil {
+		if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &quesma_api.Result{StatusCode: http.StatusNotFound, GenericResult: make([]byte, 0)}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &quesma_api.Result{
+				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+				StatusCode:    http.StatusBadRequest,
+				GenericResult: elastic_query_dsl.BadRequestParseError(err),
+			}, nil
+		} else {
+			return nil, err
+		}
+	}
+
+	responseBody, err := response.Render(format)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]any{
+		ContentTypeHeaderKey:      elastic_sql.ContentType(format),
+		"X-Quesma-Headers-Source": "Quesma",
+	}
+	if format != elastic_sql.FormatJSON && response.Cursor != "" {
+		meta["Cursor"] = response.Cursor
+	}
+	return &quesma_api.Result{Body: string(responseBody), Meta: meta, StatusCode: http.StatusOK, GenericResult: responseBody}, nil
+}
+
+func HandleSQLTranslate(ctx context.Context, body types.JSON, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	translated, err := queryRunner.HandleSQLTranslate(ctx, body)
+	if err != nil {
+		if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &quesma_api.Result{StatusCode: http.StatusNotFound, GenericResult: make([]byte, 0)}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &quesma_api.Result{
+				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+				StatusCode:    http.StatusBadRequest,
+				GenericResult: elastic_query_dsl.BadRequestParseError(err),
+			}, nil
+		} else {
+			return nil, err
+		}
+	}
+	responseBody, err := translated.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+// HandleESQL runs ES|QL query. Async queries (`_query/async`) are run synchronously too,
+// so their response is always complete.
+func HandleESQL(ctx context.Context, body types.JSON, async bool, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	response, err := queryRunner.HandleESQL(ctx, body)
+	if err != nil {
+		if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &quesma_api.Result{StatusCode: http.StatusNotFound, GenericResult: make([]byte, 0)}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &quesma_api.Result{
+				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+				StatusCode:    http.StatusBadRequest,
+				GenericResult: elastic_query_dsl.BadRequestParseError(err),
+			}, nil
+		} else {
+			return nil, err
+		}
+	}
+
+	var responseBody []byte
+	if async {
+		responseBody, err = json.Marshal(esql.AsyncResponse{IsRunning: false, Response: response})
+	} else {
+		responseBody, err = json.Marshal(response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+// HandleSQLClose closes the cursor. Quesma cursors are stateless, so there's nothing to release.
+func HandleSQLClose() (*quesma_api.Result, error) {
+	return elasticsearchQueryResult(`{"succeeded":true}`, http.StatusOK), nil
+}
+
 func HandleIndexAsyncSearch(ctx context.Context, indexPattern string, query types.JSON, waitForResultsMs int, keepOnCompletion bool, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
 	responseBody, err := queryRunner.HandleAsyncSearch(ctx, indexPattern, query, waitForResultsMs, keepOnCompletion)
 	if err != nil {
@@ -88,6 +202,208 @@ func HandleIndexAsyncSearch(ctx context.Context, indexPattern string, query type
 	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
 }
 
+// HandleIndexScrollSearch handles the first page of a scroll, `_search?scroll=...`
+func HandleIndexScrollSearch(ctx context.Context, indexPattern string, query types.JSON, keepAlive string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleScrollSearch(ctx, indexPattern, query, keepAlive)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleScroll(ctx context.Context, scrollId string, keepAlive string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleScroll(ctx, scrollId, keepAlive)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleClearScroll(scrollIds []string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	freed := queryRunner.ClearScroll(scrollIds)
+	statusCode := http.StatusOK
+	if freed == 0 {
+		statusCode = http.StatusNotFound
+	}
+	responseBody, err := json.Marshal(freedSearchContextsResponse{Succeeded: true, NumFreed: freed})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), statusCode), nil
+}
+
+func HandleOpenPointInTime(ctx context.Context, indexPattern string, keepAlive string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	pitId, err := queryRunner.HandleOpenPointInTime(ctx, indexPattern, keepAlive)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	responseBody, err := json.Marshal(openPointInTimeResponse{
+		Id:     pitId,
+		Shards: map[string]int{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleClosePointInTime(pitId string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	response := freedSearchContextsResponse{Succeeded: true}
+	statusCode := http.StatusNotFound
+	if queryRunner.HandleClosePointInTime(pitId) {
+		response.NumFreed = 1
+		statusCode = http.StatusOK
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), statusCode), nil
+}
+
+func HandlePointInTimeSearch(ctx context.Context, query types.JSON, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandlePointInTimeSearch(ctx, query)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleUpdateAliases(body types.JSON, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
+	actions, err := table_resolver.ParseAliasActions(body)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	if err = tableResolver.UpdateAliases(actions); err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(`{"acknowledged":true}`, http.StatusOK), nil
+}
+
+func HandleGetAlias(names string, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
+	aliases := matchingAliases(tableResolver.Aliases(), names)
+	if len(aliases) == 0 {
+		responseBody, _ := json.Marshal(types.JSON{"error": fmt.Sprintf("alias [%s] missing", names), "status": http.StatusNotFound})
+		return elasticsearchQueryResult(string(responseBody), http.StatusNotFound), nil
+	}
+	responseBody, err := json.Marshal(aliasesResponse(aliases))
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func sourceFilterFromRequest(req *quesma_api.Request) SourceFilter {
+	return ParseSourceFilter(req.QueryParams.Get("_source"), req.QueryParams.Get("_source_includes"), req.QueryParams.Get("_source_excludes"))
+}
+
+func HandleGetDocument(ctx context.Context, index, id string, sourceFilter SourceFilter, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	document, err := queryRunner.HandleGetDocument(ctx, index, id, sourceFilter)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	statusCode := http.StatusOK
+	if found, _ := document["found"].(bool); !found {
+		statusCode = http.StatusNotFound
+	}
+	responseBody, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), statusCode), nil
+}
+
+// HandleGetSource returns just `_source` of the document (`GET /:index/_source/:id`)
+func HandleGetSource(ctx context.Context, index, id string, sourceFilter SourceFilter, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	sourceFilter.Disabled = false
+	document, err := queryRunner.HandleGetDocument(ctx, index, id, sourceFilter)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	if found, _ := document["found"].(bool); !found {
+		reason := fmt.Sprintf("Document not found [%s]/[%s]", index, id)
+		responseBody, _ := json.Marshal(elastic_query_dsl.DashboardErrorResponse{
+			Error: elastic_query_dsl.Error{
+				RootCause: []elastic_query_dsl.RootCause{{Type: "resource_not_found_exception", Reason: reason}},
+				Type:      "resource_not_found_exception",
+				Reason:    reason,
+			},
+			Status: http.StatusNotFound,
+		})
+		return elasticsearchQueryResult(string(responseBody), http.StatusNotFound), nil
+	}
+	responseBody, err := json.Marshal(document["_source"])
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleMultiGet(ctx context.Context, defaultIndex string, body types.JSON, sourceFilter SourceFilter, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleMultiGet(ctx, defaultIndex, body, sourceFilter)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleDeleteByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleDeleteByQuery(ctx, indexPattern, body, waitForCompletion)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleUpdateByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleUpdateByQuery(ctx, indexPattern, body, waitForCompletion)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleGetTask(taskId string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
+	responseBody, err := queryRunner.HandleGetTask(taskId)
+	if err != nil {
+		return searchContextErrorResult(err)
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func searchContextErrorResult(err error) (*quesma_api.Result, error) {
+	if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+		return &quesma_api.Result{StatusCode: http.StatusNotFound, GenericResult: make([]byte, 0)}, nil
+	} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+		return &quesma_api.Result{
+			Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+			StatusCode:    http.StatusBadRequest,
+			GenericResult: elastic_query_dsl.BadRequestParseError(err),
+		}, nil
+	} else if errors.Is(err, errSearchContextMissing) {
+		responseBody, _ := json.Marshal(elastic_query_dsl.DashboardErrorResponse{
+			Error: elastic_query_dsl.Error{
+				RootCause: []elastic_query_dsl.RootCause{{Type: "search_context_missing_exception", Reason: err.Error()}},
+				Type:      "search_phase_execution_exception",
+				Reason:    "all shards failed",
+			},
+			Status: http.StatusNotFound,
+		})
+		return elasticsearchQueryResult(string(responseBody), http.StatusNotFound), nil
+	} else if errors.Is(err, errTaskMissing) {
+		responseBody, _ := json.Marshal(elastic_query_dsl.DashboardErrorResponse{
+			Error: elastic_query_dsl.Error{
+				RootCause: []elastic_query_dsl.RootCause{{Type: "resource_not_found_exception", Reason: err.Error()}},
+				Type:      "resource_not_found_exception",
+				Reason:    err.Error(),
+			},
+			Status: http.StatusNotFound,
+		})
+		return elasticsearchQueryResult(string(responseBody), http.StatusNotFound), nil
+	}
+	return nil, err
+}
+
 func HandleResolveIndex(_ context.Context, indexPattern string, sr schema.Registry, esConfig config.ElasticsearchConfiguration) (*quesma_api.Result, error) {
 	ir := elasticsearch.NewIndexResolver(esConfig)
 	sources, err := resolve.HandleResolve(indexPattern, sr, ir)
@@ -187,13 +503,13 @@ func HandleGetIndexMapping(sr schema.Registry, index string) (*quesma_api.Result
 	return getIndexMappingResult(index, mappings)
 }
 
-func HandleBulkIndex(ctx context.Context, index string, body types.NDJSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
-	results, err := bulk.Write(ctx, &index, body, ip, ingestStatsEnabled, esConn, dependencies.PhoneHomeAgent(), tableResolver)
+func HandleBulkIndex(ctx context.Context, index string, pipeline string, body types.NDJSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
+	results, err := bulk.Write(ctx, &index, pipeline, body, ip, ingestStatsEnabled, esConn, dependencies.PhoneHomeAgent(), tableResolver)
 	return bulkInsertResult(ctx, results, err)
 }
 
-func HandleIndexDoc(ctx context.Context, index string, body types.JSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
-	result, err := doc.Write(ctx, &index, body, ip, ingestStatsEnabled, dependencies.PhoneHomeAgent(), tableResolver, esConn)
+func HandleIndexDoc(ctx context.Context, index string, pipeline string, body types.JSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
+	result, err := doc.Write(ctx, &index, pipeline, body, ip, ingestStatsEnabled, dependencies.PhoneHomeAgent(), tableResolver, esConn)
 	if err != nil {
 		return &quesma_api.Result{
 			Body:          string(elastic_query_dsl.BadRequestParseError(err)),
@@ -205,11 +521,348 @@ func HandleIndexDoc(ctx context.Context, index string, body types.JSON, ip *inge
 	return indexDocResult(result)
 }
 
-func HandleBulk(ctx context.Context, body types.NDJSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
-	results, err := bulk.Write(ctx, nil, body, ip, ingestStatsEnabled, esConn, dependencies.PhoneHomeAgent(), tableResolver)
+func HandleBulk(ctx context.Context, pipeline string, body types.NDJSON, ip *ingest.IngestProcessor, ingestStatsEnabled bool, esConn *backend_connectors.ElasticsearchBackendConnector, dependencies quesma_api.Dependencies, tableResolver table_resolver.TableResolver) (*quesma_api.Result, error) {
+	results, err := bulk.Write(ctx, nil, pipeline, body, ip, ingestStatsEnabled, esConn, dependencies.PhoneHomeAgent(), tableResolver)
 	return bulkInsertResult(ctx, results, err)
 }
 
+func HandlePutPipeline(id string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	return templateResult(ip.Pipelines().Put(id, body))
+}
+
+// HandleGetPipeline returns definitions of pipelines, ids is a comma separated list of ids or patterns
+func HandleGetPipeline(ids string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	pipelines := ip.Pipelines().Find(ids)
+	if len(pipelines) == 0 && ids != "*" {
+		return elasticsearchInsertResult(`{}`, http.StatusNotFound), nil
+	}
+
+	response := make(map[string]any, len(pipelines))
+	for _, pipeline := range pipelines {
+		response[pipeline.Id] = pipeline.Definition
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleDeletePipeline(id string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.Pipelines().Delete(id)
+	if !found {
+		return resourceNotFoundResult(fmt.Sprintf("pipeline [%s] is missing", id)), nil
+	}
+	return templateResult(err)
+}
+
+func resourceNotFoundResult(reason string) *quesma_api.Result {
+	return notFoundResult("resource_not_found_exception", reason)
+}
+
+func indexNotFoundResult(index string) *quesma_api.Result {
+	return notFoundResult("index_not_found_exception", fmt.Sprintf("no such index [%s]", index))
+}
+
+func notFoundResult(errorType, reason string) *quesma_api.Result {
+	responseBody, _ := json.Marshal(elastic_query_dsl.DashboardErrorResponse{
+		Error: elastic_query_dsl.Error{
+			RootCause: []elastic_query_dsl.RootCause{{Type: errorType, Reason: reason}},
+			Type:      errorType,
+			Reason:    reason,
+		},
+		Status: http.StatusNotFound,
+	})
+	return elasticsearchInsertResult(string(responseBody), http.StatusNotFound)
+}
+
+// HandleSimulatePipeline runs a pipeline on documents from the request body, without ingesting them.
+// The pipeline is either a stored one (id is not empty) or the one defined in the body.
+func HandleSimulatePipeline(id string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	badRequest := func(err error) (*quesma_api.Result, error) {
+		return &quesma_api.Result{
+			Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+			StatusCode:    http.StatusBadRequest,
+			GenericResult: elastic_query_dsl.BadRequestParseError(err),
+		}, nil
+	}
+
+	var pipeline *ingest.Pipeline
+	if id != "" {
+		var found bool
+		if pipeline, found = ip.Pipelines().Get(id); !found {
+			return badRequest(fmt.Errorf("pipeline [%s] does not exist", id))
+		}
+	} else {
+		definition, ok := body["pipeline"].(map[string]any)
+		if !ok {
+			return badRequest(fmt.Errorf("[pipeline] required property is missing"))
+		}
+		var err error
+		if pipeline, err = ingest.ParsePipeline("_simulate_pipeline", definition); err != nil {
+			return badRequest(err)
+		}
+	}
+
+	docs, ok := body["docs"].([]any)
+	if !ok || len(docs) == 0 {
+		return badRequest(fmt.Errorf("must specify at least one document in [docs]"))
+	}
+
+	results := make([]any, 0, len(docs))
+	for _, d := range docs {
+		doc, _ := d.(map[string]any)
+		source, ok := doc["_source"].(map[string]any)
+		if !ok {
+			return badRequest(fmt.Errorf("[_source] required property is missing"))
+		}
+
+		transformed, err := pipeline.Transform(types.JSON(source).Clone())
+		if err != nil {
+			results = append(results, map[string]any{"error": elastic_query_dsl.Error{
+				RootCause: []elastic_query_dsl.RootCause{{Type: "illegal_argument_exception", Reason: err.Error()}},
+				Type:      "illegal_argument_exception",
+				Reason:    err.Error(),
+			}})
+			continue
+		}
+
+		index, _ := doc["_index"].(string)
+		if index == "" {
+			index = "_index"
+		}
+		docId, _ := doc["_id"].(string)
+		if docId == "" {
+			docId = "_id"
+		}
+		results = append(results, map[string]any{"doc": map[string]any{
+			"_index":   index,
+			"_id":      docId,
+			"_version": "-3",
+			"_source":  transformed,
+			"_ingest":  map[string]any{"timestamp": time.Now().UTC().Format(time.RFC3339Nano)},
+		}})
+	}
+
+	responseBody, err := json.Marshal(map[string]any{"docs": results})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+// templateResult handles the result of modifying index or component templates
+func templateResult(err error) (*quesma_api.Result, error) {
+	if err == nil {
+		return elasticsearchInsertResult(`{"acknowledged":true}`, http.StatusOK), nil
+	}
+	if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+		return &quesma_api.Result{
+			Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+			StatusCode:    http.StatusBadRequest,
+			GenericResult: elastic_query_dsl.BadRequestParseError(err),
+		}, nil
+	}
+	return nil, err
+}
+
+func HandlePutIndexTemplate(name string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	return templateResult(ip.IndexTemplates().PutIndexTemplate(name, body))
+}
+
+func HandlePutComponentTemplate(name string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	return templateResult(ip.IndexTemplates().PutComponentTemplate(name, body))
+}
+
+// HandleGetIndexTemplate returns definitions of index templates, names is a comma separated list of names or patterns
+func HandleGetIndexTemplate(names string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	templates := ip.IndexTemplates().FindIndexTemplates(names)
+	if len(templates) == 0 && names != "*" {
+		return resourceNotFoundResult(fmt.Sprintf("index template matching [%s] not found", names)), nil
+	}
+
+	response := make([]any, 0, len(templates))
+	for _, template := range templates {
+		response = append(response, map[string]any{"name": template.Name, "index_template": template.Definition})
+	}
+	responseBody, err := json.Marshal(map[string]any{"index_templates": response})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+// HandleGetComponentTemplate returns definitions of component templates, names is a comma separated list of names or patterns
+func HandleGetComponentTemplate(names string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	components := ip.IndexTemplates().FindComponentTemplates(names)
+	if len(components) == 0 && names != "*" {
+		return resourceNotFoundResult(fmt.Sprintf("component template matching [%s] not found", names)), nil
+	}
+
+	response := make([]any, 0, len(components))
+	for _, component := range components {
+		response = append(response, map[string]any{"name": component.Name, "component_template": component.Definition})
+	}
+	responseBody, err := json.Marshal(map[string]any{"component_templates": response})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleDeleteIndexTemplate(name string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.IndexTemplates().DeleteIndexTemplate(name)
+	if !found {
+		return resourceNotFoundResult(fmt.Sprintf("index_template [%s] missing", name)), nil
+	}
+	return templateResult(err)
+}
+
+func HandleDeleteComponentTemplate(name string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.IndexTemplates().DeleteComponentTemplate(name)
+	if !found {
+		return resourceNotFoundResult(fmt.Sprintf("component template matching [%s] not found", name)), nil
+	}
+	return templateResult(err)
+}
+
+func HandleDeleteIndex(ctx context.Context, index string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.DeleteIndex(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return indexNotFoundResult(index), nil
+	}
+	return elasticsearchInsertResult(`{"acknowledged":true}`, http.StatusOK), nil
+}
+
+func HandleCloseIndex(index string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.CloseIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return indexNotFoundResult(index), nil
+	}
+	responseBody, err := json.Marshal(map[string]any{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"indices":             map[string]any{index: map[string]any{"closed": true}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleOpenIndex(index string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.OpenIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return indexNotFoundResult(index), nil
+	}
+	return elasticsearchInsertResult(`{"acknowledged":true,"shards_acknowledged":true}`, http.StatusOK), nil
+}
+
+// HandlePutIndexSettings applies the `index.lifecycle.name` setting (null removes the policy), other settings are ignored
+func HandlePutIndexSettings(ctx context.Context, index string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	settings := body
+	if nested, ok := body["settings"].(map[string]any); ok {
+		settings = nested
+	}
+	for key, value := range util.FlattenMap(settings, ".") {
+		if strings.TrimPrefix(key, "index.") != "lifecycle.name" {
+			logger.InfoWithCtx(ctx).Msgf("setting %s of index %s is ignored", key, index)
+			continue
+		}
+		policy, ok := value.(string)
+		if !ok && value != nil {
+			return templateResult(fmt.Errorf("%w: [index.lifecycle.name] must be a string", quesma_errors.ErrCouldNotParseRequest()))
+		}
+		if err := ip.SetIndexLifecyclePolicy(ctx, index, policy); err != nil {
+			return templateResult(err)
+		}
+	}
+	return elasticsearchInsertResult(`{"acknowledged":true}`, http.StatusOK), nil
+}
+
+func HandleExplainLifecycle(index string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	explain := map[string]any{"index": index, "managed": false}
+	if policy := ip.IndexLifecycle().IndexPolicy(index); policy != nil {
+		explain["managed"] = true
+		explain["policy"] = policy.Name
+	}
+	responseBody, err := json.Marshal(map[string]any{"indices": map[string]any{index: explain}})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleRemoveLifecycle(ctx context.Context, index string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	if err := ip.SetIndexLifecyclePolicy(ctx, index, ""); err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(`{"has_failures":false,"failed_indexes":[]}`, http.StatusOK), nil
+}
+
+func HandlePutLifecyclePolicy(ctx context.Context, name string, body types.JSON, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	return templateResult(ip.PutLifecyclePolicy(ctx, name, body))
+}
+
+// HandleGetLifecyclePolicy returns lifecycle policies, names is a comma separated list of names or patterns
+func HandleGetLifecyclePolicy(names string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	policies := ip.IndexLifecycle().FindPolicies(names)
+	if len(policies) == 0 && names != "*" {
+		return resourceNotFoundResult(fmt.Sprintf("Lifecycle policy not found: %s", names)), nil
+	}
+
+	response := make(map[string]any, len(policies))
+	for _, policy := range policies {
+		indexes := ip.IndexLifecycle().Indexes(policy.Name)
+		if indexes == nil {
+			indexes = []string{}
+		}
+		response[policy.Name] = map[string]any{"policy": policy.Definition, "in_use_by": map[string]any{"indices": indexes}}
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+func HandleDeleteLifecyclePolicy(name string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	found, err := ip.IndexLifecycle().DeletePolicy(name)
+	if !found {
+		return resourceNotFoundResult(fmt.Sprintf("Lifecycle policy not found: %s", name)), nil
+	}
+	return templateResult(err)
+}
+
+// mirrorToElasticsearch sends a request, which Quesma handled successfully, to Elasticsearch too.
+// It's used for cluster-wide resources (like lifecycle policies), which indexes stored in both ClickHouse and Elasticsearch use.
+func mirrorToElasticsearch(ctx context.Context, req *quesma_api.Request, esConn *backend_connectors.ElasticsearchBackendConnector, result *quesma_api.Result, err error) (*quesma_api.Result, error) {
+	if err != nil || result == nil || result.StatusCode != http.StatusOK {
+		return result, err
+	}
+	response, err := esConn.Request(ctx, req.Method, strings.TrimPrefix(req.Path, "/"), []byte(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("could not send %s %s to Elasticsearch: %w", req.Method, req.Path, err)
+	}
+	defer response.Body.Close()
+	// a resource deleted from Quesma may have never been stored in Elasticsearch
+	if response.StatusCode >= http.StatusMultipleChoices && !(req.Method == "DELETE" && response.StatusCode == http.StatusNotFound) {
+		body, _ := io.ReadAll(response.Body)
+		logger.WarnWithCtx(ctx).Msgf("%s %s was handled by Quesma, but failed in Elasticsearch: %s", req.Method, req.Path, body)
+		return elasticsearchInsertResult(string(body), response.StatusCode), nil
+	}
+	return result, nil
+}
+
 func HandleMultiSearch(ctx context.Context, req *quesma_api.Request, defaultIndexName string, queryRunner QueryRunnerIFace) (*quesma_api.Result, error) {
 
 	body, err := types.ExpectNDJSON(req.ParsedBody)
@@ -235,3 +888,72 @@ func HandleMultiSearch(ctx context.Context, req *quesma_api.Request, defaultInde
 
 	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
 }
+
+const defaultDeadLettersSize = 100
+
+// HandleListDeadLetters returns the oldest documents of the index rejected during ingest, "_all" lists all indexes
+func HandleListDeadLetters(ctx context.Context, index, size string, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	if !ip.DeadLetterQueueEnabled() {
+		return resourceNotFoundResult("dead letter queue is not enabled"), nil
+	}
+	limit := defaultDeadLettersSize
+	if size != "" {
+		var err error
+		if limit, err = strconv.Atoi(size); err != nil || limit < 0 {
+			badRequest := elastic_query_dsl.BadRequestParseError(fmt.Errorf("invalid size [%s]", size))
+			return &quesma_api.Result{Body: string(badRequest), StatusCode: http.StatusBadRequest, GenericResult: badRequest}, nil
+		}
+	}
+	letters, err := ip.ListDeadLetters(ctx, index, limit)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := json.Marshal(map[string]any{"count": len(letters), "dead_letters": letters})
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+// HandleReplayDeadLetters ingests documents of the index rejected during ingest again,
+// the body may limit them to `ids`, otherwise all documents of the index are replayed
+func HandleReplayDeadLetters(ctx context.Context, index string, body quesma_api.RequestBody, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	if !ip.DeadLetterQueueEnabled() {
+		return resourceNotFoundResult("dead letter queue is not enabled"), nil
+	}
+	replay, err := ip.ReplayDeadLetters(ctx, index, deadLetterIdsFromBody(body))
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := json.Marshal(replay)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(string(responseBody), http.StatusOK), nil
+}
+
+// HandleDeleteDeadLetters removes documents of the index from the dead letter queue, the body may limit them to `ids`
+func HandleDeleteDeadLetters(ctx context.Context, index string, body quesma_api.RequestBody, ip *ingest.IngestProcessor) (*quesma_api.Result, error) {
+	if !ip.DeadLetterQueueEnabled() {
+		return resourceNotFoundResult("dead letter queue is not enabled"), nil
+	}
+	deleted, err := ip.DeleteDeadLetters(ctx, index, deadLetterIdsFromBody(body))
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchInsertResult(fmt.Sprintf(`{"deleted":%d}`, deleted), http.StatusOK), nil
+}
+
+func deadLetterIdsFromBody(body quesma_api.RequestBody) []string {
+	var ids []string
+	if body, ok := body.(types.JSON); ok {
+		if values, ok := body["ids"].([]any); ok {
+			for _, value := range values {
+				if id, ok := value.(string); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/painful"
 	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
 	"github.com/QuesmaOrg/quesma/quesma/telemetry"
@@ -30,7 +31,10 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/v2/core/tracing"
 	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -105,7 +109,7 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 			return nil, err
 		}
 
-		results, err := bulk.Write(ctx, nil, body, ip, cfg.IngestStatistics, elasticsearchConnector, phoneHomeAgent, tableResolver)
+		results, err := bulk.Write(ctx, nil, "", body, ip, cfg.IngestStatistics, elasticsearchConnector, phoneHomeAgent, tableResolver)
 		return bulkInsertResult(ctx, results, err)
 	})
 
@@ -125,7 +129,7 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 			}, nil
 		}
 
-		result, err := doc.Write(ctx, &index, body, ip, cfg.IngestStatistics, phoneHomeAgent, tableResolver, elasticsearchConnector)
+		result, err := doc.Write(ctx, &index, "", body, ip, cfg.IngestStatistics, phoneHomeAgent, tableResolver, elasticsearchConnector)
 		if err != nil {
 			return &quesma_api.Result{
 				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
@@ -145,7 +149,7 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 			return nil, err
 		}
 
-		results, err := bulk.Write(ctx, &index, body, ip, cfg.IngestStatistics, elasticsearchConnector, phoneHomeAgent, tableResolver)
+		results, err := bulk.Write(ctx, &index, "", body, ip, cfg.IngestStatistics, elasticsearchConnector, phoneHomeAgent, tableResolver)
 		return bulkInsertResult(ctx, results, err)
 	})
 
@@ -751,6 +755,7 @@ func TestConfigureRouter(t *testing.T) {
 		{routes.QuesmaTableResolverPath, "POST", false},
 		{routes.QuesmaTableResolverPath, "PUT", false},
 		{routes.QuesmaTableResolverPath, "DELETE", false},
+		{routes.ScrollIdPath, "GET", false}, // not a Quesma scroll id
 	}
 
 	for _, tt := range tests {
@@ -792,3 +797,179 @@ func (t TestTableResolver) Pipelines() []string { return []string{} }
 func (t TestTableResolver) RecentDecisions() []quesma_api.PatternDecisions {
 	return []quesma_api.PatternDecisions{}
 }
+
+func (t TestTableResolver) UpdateAliases(_ []table_resolver.AliasAction) error { return nil }
+
+func (t TestTableResolver) Aliases() []table_resolver.Alias { return nil }
+
+func (t TestTableResolver) CloseIndex(_ string) error { return nil }
+
+func (t TestTableResolver) OpenIndex(_ string) error { return nil }
+
+func (t TestTableResolver) ClosedIndexes() []string { return nil }
+
+func TestLifecyclePolicyRouting(t *testing.T) {
+	var elasticsearchRequests []string
+	elasticsearch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elasticsearchRequests = append(elasticsearchRequests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer elasticsearch.Close()
+	elasticsearchUrl, err := url.Parse(elasticsearch.URL)
+	require.NoError(t, err)
+
+	newRouter := func(cfg *config.QuesmaConfiguration) (quesma_api.Router, *ingest.IngestProcessor) {
+		cfg.Elasticsearch = config.ElasticsearchConfiguration{Url: (*config.Url)(elasticsearchUrl)}
+		ip := ingest.NewIngestProcessor(cfg, nil, nil, clickhouse.NewEmptyTableDiscovery(), nil, nil, table_resolver.NewEmptyTableResolver(), nil, persistence.NewStaticJSONDatabase(), nil)
+		esConn := backend_connectors.NewElasticsearchBackendConnector(cfg.Elasticsearch)
+		return ConfigureIngestRouterV2(cfg, quesma_api.EmptyDependencies(), ip, table_resolver.NewEmptyTableResolver(), esConn), ip
+	}
+	handle := func(router quesma_api.Router, method, path, body string) *quesma_api.Result {
+		req := &quesma_api.Request{Method: method, Path: path, Body: body}
+		if body != "" {
+			req.ParsedBody = types.MustJSON(body)
+		}
+		handler, _ := router.Matches(req)
+		if handler == nil {
+			return nil // forwarded to Elasticsearch
+		}
+		result, err := handler.Handler(context.Background(), req, nil)
+		require.NoError(t, err)
+		return result
+	}
+	const policy = `{"policy": {"phases": {"hot": {"actions": {}}}}}`
+
+	// without indexes ingested into Elasticsearch, all policies are managed by Quesma
+	router, _ := newRouter(&config.QuesmaConfiguration{DefaultIngestTarget: []string{config.ClickhouseTarget}})
+	assert.Equal(t, http.StatusNotFound, handle(router, "GET", "/_ilm/policy/missing", "").StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "PUT", "/_ilm/policy/logs", policy).StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "GET", "/_ilm/policy", "").StatusCode)
+	assert.Empty(t, elasticsearchRequests)
+
+	// otherwise policies unknown to Quesma are in Elasticsearch, and stored policies are sent there too
+	router, ip := newRouter(&config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		"es_logs": {IngestTarget: []string{config.ElasticsearchTarget}},
+	}})
+	assert.Nil(t, handle(router, "GET", "/_ilm/policy/missing", ""))
+	assert.Nil(t, handle(router, "DELETE", "/_ilm/policy/missing", ""))
+	assert.Nil(t, handle(router, "GET", "/_ilm/policy", ""))
+	assert.Equal(t, http.StatusOK, handle(router, "PUT", "/_ilm/policy/logs", policy).StatusCode)
+	assert.Len(t, ip.IndexLifecycle().FindPolicies("logs"), 1)
+	assert.Equal(t, http.StatusOK, handle(router, "GET", "/_ilm/policy/logs", "").StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "DELETE", "/_ilm/policy/logs", "").StatusCode)
+	assert.Empty(t, ip.IndexLifecycle().FindPolicies("logs"))
+	assert.Equal(t, []string{"PUT /_ilm/policy/logs", "DELETE /_ilm/policy/logs"}, elasticsearchRequests)
+}
+
+func TestIndexTemplateRouting(t *testing.T) {
+	var elasticsearchRequests []string
+	elasticsearch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elasticsearchRequests = append(elasticsearchRequests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer elasticsearch.Close()
+	elasticsearchUrl, err := url.Parse(elasticsearch.URL)
+	require.NoError(t, err)
+
+	cfg := &config.QuesmaConfiguration{
+		Elasticsearch: config.ElasticsearchConfiguration{Url: (*config.Url)(elasticsearchUrl)},
+		IndexConfig: map[string]config.IndexConfiguration{
+			"ch_logs": {IngestTarget: []string{config.ClickhouseTarget}},
+			"es_logs": {IngestTarget: []string{config.ElasticsearchTarget}},
+		},
+	}
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions["ch_logs"] = &quesma_api.Decision{UseConnectors: []quesma_api.ConnectorDecision{&quesma_api.ConnectorDecisionClickhouse{ClickhouseTableName: "ch_logs"}}}
+	resolver.Decisions["es_logs"] = &quesma_api.Decision{UseConnectors: []quesma_api.ConnectorDecision{&quesma_api.ConnectorDecisionElastic{}}}
+	ip := ingest.NewIngestProcessor(cfg, nil, nil, clickhouse.NewEmptyTableDiscovery(), nil, nil, resolver, nil, nil, nil)
+	router := ConfigureIngestRouterV2(cfg, quesma_api.EmptyDependencies(), ip, resolver, backend_connectors.NewElasticsearchBackendConnector(cfg.Elasticsearch))
+
+	handle := func(method, path, body string) *quesma_api.Result {
+		req := &quesma_api.Request{Method: method, Path: path, Body: body}
+		if body != "" {
+			req.ParsedBody = types.MustJSON(body)
+		}
+		handler, _ := router.Matches(req)
+		if handler == nil {
+			return nil // forwarded to Elasticsearch
+		}
+		result, err := handler.Handler(context.Background(), req, nil)
+		require.NoError(t, err)
+		return result
+	}
+
+	// templates of indexes ingested into ClickHouse are created by Quesma, and sent to Elasticsearch too
+	assert.Equal(t, http.StatusOK, handle("PUT", "/_component_template/logs@settings", `{"template": {"settings": {"index.sort.field": "@timestamp"}}}`).StatusCode)
+	assert.Equal(t, http.StatusOK, handle("PUT", "/_index_template/ch", `{"index_patterns": ["ch_*"], "composed_of": ["logs@settings"]}`).StatusCode)
+	assert.Equal(t, http.StatusOK, handle("PUT", "/_index_template/ch_logs", `{"index_patterns": "ch_logs"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, handle("PUT", "/_index_template/invalid", `{"index_patterns": ["ch_*"], "_meta": {"quesma": {"engine": "Log"}}}`).StatusCode)
+	assert.Len(t, ip.IndexTemplates().FindIndexTemplates("*"), 2)
+
+	// others are created in Elasticsearch only
+	assert.Nil(t, handle("PUT", "/_index_template/es", `{"index_patterns": ["es_*", "other_*"]}`))
+	assert.Nil(t, handle("GET", "/_index_template/es", ""))
+	assert.Nil(t, handle("GET", "/_index_template", ""))
+	assert.Nil(t, handle("GET", "/_component_template/missing", ""))
+
+	assert.Equal(t, http.StatusOK, handle("GET", "/_index_template/ch", "").StatusCode)
+	assert.Equal(t, http.StatusOK, handle("DELETE", "/_index_template/ch", "").StatusCode)
+	assert.Len(t, ip.IndexTemplates().FindIndexTemplates("*"), 1)
+
+	assert.Equal(t, []string{
+		"PUT /_component_template/logs@settings", "PUT /_index_template/ch", "PUT /_index_template/ch_logs", "DELETE /_index_template/ch",
+	}, elasticsearchRequests)
+}
+
+func TestIngestPipelineRouting(t *testing.T) {
+	var elasticsearchRequests []string
+	elasticsearch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elasticsearchRequests = append(elasticsearchRequests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer elasticsearch.Close()
+	elasticsearchUrl, err := url.Parse(elasticsearch.URL)
+	require.NoError(t, err)
+
+	newRouter := func(cfg *config.QuesmaConfiguration) quesma_api.Router {
+		cfg.Elasticsearch = config.ElasticsearchConfiguration{Url: (*config.Url)(elasticsearchUrl)}
+		ip := ingest.NewIngestProcessor(cfg, nil, nil, clickhouse.NewEmptyTableDiscovery(), nil, nil, table_resolver.NewEmptyTableResolver(), nil, nil, nil)
+		esConn := backend_connectors.NewElasticsearchBackendConnector(cfg.Elasticsearch)
+		return ConfigureIngestRouterV2(cfg, quesma_api.EmptyDependencies(), ip, table_resolver.NewEmptyTableResolver(), esConn)
+	}
+	handle := func(router quesma_api.Router, method, path, body string) *quesma_api.Result {
+		req := &quesma_api.Request{Method: method, Path: path, Body: body}
+		if body != "" {
+			req.ParsedBody = types.MustJSON(body)
+		}
+		handler, _ := router.Matches(req)
+		if handler == nil {
+			return nil // forwarded to Elasticsearch
+		}
+		result, err := handler.Handler(context.Background(), req, nil)
+		require.NoError(t, err)
+		return result
+	}
+	const pipeline = `{"processors": [{"set": {"field": "env", "value": "prod"}}]}`
+	const docs = `{"docs": [{"_source": {"message": "hello"}}]}`
+
+	// without indexes ingested into Elasticsearch, all pipelines are managed by Quesma
+	router := newRouter(&config.QuesmaConfiguration{DefaultIngestTarget: []string{config.ClickhouseTarget}})
+	assert.Equal(t, http.StatusNotFound, handle(router, "GET", "/_ingest/pipeline/missing", "").StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "PUT", "/_ingest/pipeline/logs", pipeline).StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "GET", "/_ingest/pipeline", "").StatusCode)
+	assert.Empty(t, elasticsearchRequests)
+
+	// otherwise pipelines unknown to Quesma are in Elasticsearch, and stored pipelines are sent there too
+	router = newRouter(&config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		"es_logs": {IngestTarget: []string{config.ElasticsearchTarget}},
+	}})
+	assert.Nil(t, handle(router, "GET", "/_ingest/pipeline/missing", ""))
+	assert.Nil(t, handle(router, "DELETE", "/_ingest/pipeline/missing", ""))
+	assert.Nil(t, handle(router, "GET", "/_ingest/pipeline", ""))
+	assert.Nil(t, handle(router, "POST", "/_ingest/pipeline/missing/_simulate", docs))
+	assert.Equal(t, http.StatusOK, handle(router, "PUT", "/_ingest/pipeline/logs", pipeline).StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "GET", "/_ingest/pipeline/logs", "").StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "POST", "/_ingest/pipeline/logs/_simulate", docs).StatusCode)
+	assert.Equal(t, http.StatusOK, handle(router, "DELETE", "/_ingest/pipeline/logs", "").StatusCode)
+	assert.Equal(t, []string{"PUT /_ingest/pipeline/logs", "DELETE /_ingest/pipeline/logs"}, elasticsearchRequests)
+}
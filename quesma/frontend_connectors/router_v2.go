@@ -13,6 +13,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/painful"
 	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_sql"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
 	"github.com/QuesmaOrg/quesma/quesma/types"
@@ -73,7 +74,7 @@ func ConfigureIngestRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 		if err != nil {
 			return nil, err
 		}
-		return HandleBulk(ctx, body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
+		return HandleBulk(ctx, req.QueryParams.Get("pipeline"), body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
 	})
 	router.Register(routes.IndexDocPath, and(method("POST"), matchedExactIngestPath(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
 		index := req.Params["index"]
@@ -87,7 +88,7 @@ func ConfigureIngestRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 			}, nil
 		}
 
-		return HandleIndexDoc(ctx, index, body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
+		return HandleIndexDoc(ctx, index, req.QueryParams.Get("pipeline"), body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
 	})
 
 	router.Register(routes.IndexBulkPath, and(method("POST", "PUT"), matchedExactIngestPath(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
@@ -98,8 +99,158 @@ func ConfigureIngestRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 			return nil, err
 		}
 
-		return HandleBulkIndex(ctx, index, body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
+		return HandleBulkIndex(ctx, index, req.QueryParams.Get("pipeline"), body, ip, cfg.IngestStatistics, esConn, dependencies, tableResolver)
 	})
+
+	// without ingest processor, pipelines, index templates and index lifecycle are handled by Elasticsearch
+	if ip != nil {
+		elasticsearchIngest := ingestsIntoElasticsearch(cfg)
+
+		// `_simulate` has to be registered before `/_ingest/pipeline/:id`
+		router.Register(routes.IngestPipelineSimulatePath, method("GET", "POST"), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			body, err := types.ExpectJSON(req.ParsedBody)
+			if err != nil {
+				return nil, err
+			}
+			return HandleSimulatePipeline("", body, ip)
+		})
+		router.Register(routes.IngestPipelineIdSimulatePath, and(method("GET", "POST"), matchedAgainstSimulatedPipeline(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			body, err := types.ExpectJSON(req.ParsedBody)
+			if err != nil {
+				return nil, err
+			}
+			return HandleSimulatePipeline(req.Params["id"], body, ip)
+		})
+		router.Register(routes.IngestPipelinesPath, and(method("GET"), matchedAgainstIngestPipeline(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleGetPipeline("*", ip)
+		})
+		router.Register(routes.IngestPipelinePath, and(method("GET", "PUT", "DELETE"), matchedAgainstIngestPipeline(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			id := req.Params["id"]
+			var result *quesma_api.Result
+			var err error
+			switch req.Method {
+			case "PUT":
+				body, parseErr := types.ExpectJSON(req.ParsedBody)
+				if parseErr != nil {
+					return nil, parseErr
+				}
+				result, err = HandlePutPipeline(id, body, ip)
+			case "DELETE":
+				result, err = HandleDeletePipeline(id, ip)
+			default:
+				return HandleGetPipeline(id, ip)
+			}
+			if elasticsearchIngest {
+				return mirrorToElasticsearch(ctx, req, esConn, result, err)
+			}
+			return result, err
+		})
+
+		router.Register(routes.IndexTemplatesPath, and(method("GET"), matchedAgainstIndexTemplate(ip, cfg, tableResolver, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleGetIndexTemplate("*", ip)
+		})
+		router.Register(routes.IndexTemplatePath, and(method("GET", "PUT", "POST", "DELETE"), matchedAgainstIndexTemplate(ip, cfg, tableResolver, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			name := req.Params["name"]
+			var result *quesma_api.Result
+			var err error
+			switch req.Method {
+			case "PUT", "POST":
+				body, parseErr := types.ExpectJSON(req.ParsedBody)
+				if parseErr != nil {
+					return nil, parseErr
+				}
+				result, err = HandlePutIndexTemplate(name, body, ip)
+			case "DELETE":
+				result, err = HandleDeleteIndexTemplate(name, ip)
+			default:
+				return HandleGetIndexTemplate(name, ip)
+			}
+			if elasticsearchIngest {
+				return mirrorToElasticsearch(ctx, req, esConn, result, err)
+			}
+			return result, err
+		})
+		router.Register(routes.ComponentTemplatesPath, and(method("GET"), matchedAgainstComponentTemplate(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleGetComponentTemplate("*", ip)
+		})
+		router.Register(routes.ComponentTemplatePath, and(method("GET", "PUT", "POST", "DELETE"), matchedAgainstComponentTemplate(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			name := req.Params["name"]
+			var result *quesma_api.Result
+			var err error
+			switch req.Method {
+			case "PUT", "POST":
+				body, parseErr := types.ExpectJSON(req.ParsedBody)
+				if parseErr != nil {
+					return nil, parseErr
+				}
+				result, err = HandlePutComponentTemplate(name, body, ip)
+			case "DELETE":
+				result, err = HandleDeleteComponentTemplate(name, ip)
+			default:
+				return HandleGetComponentTemplate(name, ip)
+			}
+			if elasticsearchIngest {
+				return mirrorToElasticsearch(ctx, req, esConn, result, err)
+			}
+			return result, err
+		})
+
+		router.Register(routes.IndexPath, and(method("DELETE"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleDeleteIndex(ctx, req.Params["index"], ip)
+		})
+		router.Register(routes.IndexClosePath, and(method("POST"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleCloseIndex(req.Params["index"], ip)
+		})
+		router.Register(routes.IndexOpenPath, and(method("POST"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleOpenIndex(req.Params["index"], ip)
+		})
+		router.Register(routes.IndexSettingsPath, and(method("PUT"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			body, err := types.ExpectJSON(req.ParsedBody)
+			if err != nil {
+				return nil, err
+			}
+			return HandlePutIndexSettings(ctx, req.Params["index"], body, ip)
+		})
+		router.Register(routes.IndexLifecycleExplainPath, and(method("GET"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleExplainLifecycle(req.Params["index"], ip)
+		})
+		router.Register(routes.IndexLifecycleRemovePath, and(method("POST"), matchedExactIngestPathOrClosed(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleRemoveLifecycle(ctx, req.Params["index"], ip)
+		})
+		router.Register(routes.QuesmaDeadLettersPath, method("GET", "DELETE"), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			if req.Method == "DELETE" {
+				return HandleDeleteDeadLetters(ctx, req.Params["index"], req.ParsedBody, ip)
+			}
+			return HandleListDeadLetters(ctx, req.Params["index"], req.QueryParams.Get("size"), ip)
+		})
+		router.Register(routes.QuesmaDeadLettersReplayPath, method("POST"), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleReplayDeadLetters(ctx, req.Params["index"], req.ParsedBody, ip)
+		})
+		router.Register(routes.LifecyclePoliciesPath, and(method("GET"), matchedAgainstLifecyclePolicy(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			return HandleGetLifecyclePolicy("*", ip)
+		})
+		router.Register(routes.LifecyclePolicyPath, and(method("GET", "PUT", "DELETE"), matchedAgainstLifecyclePolicy(ip, elasticsearchIngest)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+			name := req.Params["name"]
+			var result *quesma_api.Result
+			var err error
+			switch req.Method {
+			case "PUT":
+				body, parseErr := types.ExpectJSON(req.ParsedBody)
+				if parseErr != nil {
+					return nil, parseErr
+				}
+				result, err = HandlePutLifecyclePolicy(ctx, name, body, ip)
+			case "DELETE":
+				result, err = HandleDeleteLifecyclePolicy(name, ip)
+			default:
+				return HandleGetLifecyclePolicy(name, ip)
+			}
+			if elasticsearchIngest {
+				return mirrorToElasticsearch(ctx, req, esConn, result, err)
+			}
+			return result, err
+		})
+	}
 	return router
 }
 
@@ -137,6 +288,79 @@ func ConfigureSearchRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 		return HandleIndexCount(ctx, req.Params["index"], queryRunner)
 	})
 
+	router.Register(routes.IndexPitPath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleOpenPointInTime(ctx, req.Params["index"], req.QueryParams.Get("keep_alive"), queryRunner)
+	})
+
+	router.Register(routes.PitPath, and(method("DELETE"), matchedAgainstPitId()), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleClosePointInTime(pitIdFromRequest(req), queryRunner)
+	})
+
+	router.Register(routes.AliasesPath, and(method("POST"), matchedAgainstAliasActions(tableResolver)), func(_ context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleUpdateAliases(body, tableResolver)
+	})
+
+	router.Register(routes.AliasPath, and(method("GET"), matchedAgainstAliasName(tableResolver)), func(_ context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleGetAlias(req.Params["name"], tableResolver)
+	})
+
+	router.Register(routes.IndexDocIdPath, and(method("GET"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleGetDocument(ctx, req.Params["index"], req.Params["id"], sourceFilterFromRequest(req), queryRunner)
+	})
+
+	router.Register(routes.IndexSourceIdPath, and(method("GET"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleGetSource(ctx, req.Params["index"], req.Params["id"], sourceFilterFromRequest(req), queryRunner)
+	})
+
+	router.Register(routes.IndexMgetPath, and(method("GET", "POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleMultiGet(ctx, req.Params["index"], body, sourceFilterFromRequest(req), queryRunner)
+	})
+
+	router.Register(routes.MgetPath, and(method("GET", "POST"), matchedAgainstMgetIndexes(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleMultiGet(ctx, "", body, sourceFilterFromRequest(req), queryRunner)
+	})
+
+	router.Register(routes.IndexDeleteByQueryPath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleDeleteByQuery(ctx, req.Params["index"], body, req.QueryParams.Get("wait_for_completion") != "false", queryRunner)
+	})
+
+	router.Register(routes.IndexUpdateByQueryPath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleUpdateByQuery(ctx, req.Params["index"], body, req.QueryParams.Get("wait_for_completion") != "false", queryRunner)
+	})
+
+	router.Register(routes.TaskPath, and(method("GET"), matchedAgainstTaskId()), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleGetTask(req.Params["id"], queryRunner)
+	})
+
+	// searches with PIT don't have index in the path, the PIT id tells where to search
+	router.Register(routes.GlobalSearchPath, and(method("GET", "POST"), matchedAgainstPitId()), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandlePointInTimeSearch(ctx, body, queryRunner)
+	})
+
 	// TODO: This endpoint is currently disabled (mux.Never()) as it's pretty much used only by internal Kibana requests,
 	// it's error-prone to detect them in matchAgainstKibanaInternal() and Quesma can't handle well the cases of wildcard
 	// matching many indices either way.
@@ -164,9 +388,31 @@ func ConfigureSearchRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 		if err != nil {
 			return nil, err
 		}
+		if keepAlive := req.QueryParams.Get("scroll"); keepAlive != "" {
+			return HandleIndexScrollSearch(ctx, req.Params["index"], body, keepAlive, queryRunner)
+		}
 		return HandleIndexSearch(ctx, req.Params["index"], body, queryRunner)
 	})
 
+	scrollHandler := func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		scrollIds := scrollIdsFromRequest(req)
+		switch req.Method {
+		case "GET", "POST":
+			keepAlive := req.QueryParams.Get("scroll")
+			if body, ok := req.ParsedBody.(types.JSON); ok {
+				if bodyKeepAlive, ok := body["scroll"].(string); ok {
+					keepAlive = bodyKeepAlive
+				}
+			}
+			return HandleScroll(ctx, scrollIds[0], keepAlive, queryRunner)
+		case "DELETE":
+			return HandleClearScroll(scrollIds, queryRunner)
+		}
+		return nil, errors.New("unsupported method")
+	}
+	router.Register(routes.ScrollPath, and(method("GET", "POST", "DELETE"), matchedAgainstScrollId()), scrollHandler)
+	router.Register(routes.ScrollIdPath, and(method("GET", "POST", "DELETE"), matchedAgainstScrollId()), scrollHandler)
+
 	router.Register(routes.IndexAsyncSearchPath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
 		query, err := types.ExpectJSON(req.ParsedBody)
 		if err != nil {
@@ -246,7 +492,55 @@ func ConfigureSearchRouterV2(cfg *config.QuesmaConfiguration, dependencies quesm
 	})
 
 	router.Register(routes.EQLSearch, and(method("GET", "POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
-		return nil, errors.New("EQL is not supported")
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleEQLSearch(ctx, req.Params["index"], body, queryRunner)
+	})
+
+	router.Register(routes.SQLPath, and(method("GET", "POST"), matchAgainstSQLRequestBody(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		format, err := elastic_sql.ResolveFormat(req.QueryParams.Get("format"), req.Headers.Get("Accept"))
+		if err != nil {
+			return &quesma_api.Result{
+				Body:          string(elastic_query_dsl.BadRequestParseError(err)),
+				StatusCode:    http.StatusBadRequest,
+				GenericResult: elastic_query_dsl.BadRequestParseError(err),
+			}, nil
+		}
+		return HandleSQL(ctx, body, format, queryRunner)
+	})
+
+	router.Register(routes.SQLTranslatePath, and(method("GET", "POST"), matchAgainstSQLRequestBody(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleSQLTranslate(ctx, body, queryRunner)
+	})
+
+	router.Register(routes.SQLClosePath, and(method("POST"), matchAgainstSQLRequestBody(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		return HandleSQLClose()
+	})
+
+	router.Register(routes.ESQLPath, and(method("POST"), matchAgainstESQLRequestBody(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleESQL(ctx, body, false, queryRunner)
+	})
+
+	router.Register(routes.ESQLAsyncPath, and(method("POST"), matchAgainstESQLRequestBody(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return HandleESQL(ctx, body, true, queryRunner)
 	})
 
 	router.Register(routes.IndexPath, and(method("GET", "PUT"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *quesma_api.Request, _ http.ResponseWriter) (*quesma_api.Result, error) {
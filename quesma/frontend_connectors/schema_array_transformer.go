@@ -81,6 +81,11 @@ func (v *arrayTypeResolver) dbColumnType(columName string) string {
 		return ""
 	}
 
+	// nested documents (arrays of objects) are already translated by the query parser
+	if field.Type.Equal(schema.QuesmaTypeNested) {
+		return ""
+	}
+
 	return field.InternalPropertyType
 }
 
@@ -101,6 +101,9 @@ func (s searchAfterStrategyBasicAndFast) validateAndParse(query *model.Query, in
 	}
 
 	asArray, ok := query.SearchAfter.([]any)
+	if inclusive, isInclusive := query.SearchAfter.(model.SearchAfterInclusive); isInclusive {
+		asArray, ok = inclusive, true
+	}
 	if !ok {
 		return nil, fmt.Errorf("search_after must be an array, got: %v", query.SearchAfter)
 	}
@@ -155,7 +158,11 @@ func (s searchAfterStrategyBasicAndFast) transform(query *model.Query, searchAft
 		}
 	}
 
-	newWhereClause := model.NewInfixExpr(lhs, ">", rhs)
+	operator := ">"
+	if _, isInclusive := query.SearchAfter.(model.SearchAfterInclusive); isInclusive {
+		operator = ">="
+	}
+	newWhereClause := model.NewInfixExpr(lhs, operator, rhs)
 	query.SelectCommand.WhereClause = model.And([]model.Expr{query.SelectCommand.WhereClause, newWhereClause})
 	return query, nil
 }
@@ -7,11 +7,13 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/common_table"
 	"github.com/QuesmaOrg/quesma/quesma/config"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/model/typical_queries"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -272,7 +274,9 @@ func (s *SchemaCheckPass) applyGeoTransformations(schemaInstance schema.Schema,
 				limitBy = append(limitBy, expr.Accept(v).(model.Expr))
 			}
 		}
-		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand := model.NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand.Offset = query.Offset
+		return selectCommand
 	}
 
 	expr := query.SelectCommand.Accept(visitor)
@@ -494,7 +498,9 @@ func (s *SchemaCheckPass) applyPhysicalFromExpression(currentSchema schema.Schem
 			}
 		}
 
-		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, selectStm.LimitBy, selectStm.Limit, selectStm.SampleLimit, selectStm.IsDistinct, namedCTEs)
+		selectCommand := model.NewSelectCommand(columns, groupBy, orderBy, from, where, selectStm.LimitBy, selectStm.Limit, selectStm.SampleLimit, selectStm.IsDistinct, namedCTEs)
+		selectCommand.Offset = selectStm.Offset
+		return selectCommand
 	}
 
 	expr := query.SelectCommand.Accept(visitor)
@@ -593,6 +599,9 @@ func (s *SchemaCheckPass) applyFullTextField(indexSchema schema.Schema, query *m
 			if col.ColumnName == model.FullTextFieldNamePlaceHolder {
 
 				if len(fullTextFields) == 0 {
+					if e.Op == model.ScoreOperator {
+						return model.NewLiteral(0)
+					}
 					if (strings.ToUpper(e.Op) == "LIKE" || strings.ToUpper(e.Op) == "ILIKE") && model.AsString(e.Right) == "'%'" {
 						return model.NewLiteral(true)
 					}
@@ -606,6 +615,10 @@ func (s *SchemaCheckPass) applyFullTextField(indexSchema schema.Schema, query *m
 					expressions = append(expressions, model.NewInfixExpr(colRef, e.Op, e.Right))
 				}
 
+				if e.Op == model.ScoreOperator {
+					// scores of all full-text fields add up
+					return model.ScoreSum(expressions...)
+				}
 				res := model.Or(expressions)
 				return res
 			}
@@ -702,7 +715,8 @@ func (s *SchemaCheckPass) applyFieldEncoding(indexSchema schema.Schema, query *m
 	visitor.OverrideVisitColumnRef = func(b *model.BaseExprVisitor, e model.ColumnRef) interface{} {
 
 		// we don't want to resolve our well know technical fields
-		if e.ColumnName == model.FullTextFieldNamePlaceHolder || e.ColumnName == common_table.IndexNameColumn {
+		if e.ColumnName == model.FullTextFieldNamePlaceHolder || e.ColumnName == common_table.IndexNameColumn || e.ColumnName == model.ScoreFieldName ||
+			e.ColumnName == schema.IngestTimeColumnName {
 			return e
 		}
 
@@ -772,7 +786,9 @@ func (s *SchemaCheckPass) applyFieldEncoding(indexSchema schema.Schema, query *m
 				limitBy = append(limitBy, expr.Accept(v).(model.Expr))
 			}
 		}
-		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand := model.NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand.Offset = query.Offset
+		return selectCommand
 	}
 
 	expr := query.SelectCommand.Accept(visitor)
@@ -943,6 +959,98 @@ func (s *SchemaCheckPass) applyAliasColumns(indexSchema schema.Schema, query *mo
 	return query, nil
 }
 
+// applyFuzzyOperator translates `column __quesma_fuzzy FuzzyMatch` to edit distance functions.
+// Text fields are matched word by word (as they're analyzed in Elasticsearch), other string fields by the whole value.
+func (s *SchemaCheckPass) applyFuzzyOperator(indexSchema schema.Schema, query *model.Query) (*model.Query, error) {
+
+	visitor := model.NewBaseVisitor()
+
+	var err error
+
+	visitor.OverrideVisitInfix = func(b *model.BaseExprVisitor, e model.InfixExpr) interface{} {
+		lhs, ok := e.Left.(model.ColumnRef)
+		rhs, ok2 := e.Right.(model.LiteralExpr)
+
+		if ok && ok2 && e.Op == model.FuzzyOperator {
+			match, isFuzzyMatch := rhs.Value.(model.FuzzyMatch)
+			if !isFuzzyMatch {
+				logger.Error().Msgf("unexpected right side of fuzzy operator: %v (%T)", rhs.Value, rhs.Value)
+				return model.NewLiteral(false)
+			}
+
+			field, _ := indexSchema.ResolveFieldByInternalName(lhs.ColumnName)
+			switch field.Type.String() {
+			case schema.QuesmaTypeInteger.Name, schema.QuesmaTypeLong.Name, schema.QuesmaTypeUnsignedLong.Name, schema.QuesmaTypeBoolean.Name:
+				// like in Elasticsearch, fuzziness doesn't apply to those
+				value, parseErr := parseExactFuzzyTerm(field.Type, match.Term)
+				if parseErr != nil {
+					err = fmt.Errorf("%w: fuzzy query on field [%s]: %v", quesma_errors.ErrCouldNotParseRequest(), field.PropertyName, parseErr)
+					return model.NewLiteral(false)
+				}
+				return model.NewInfixExpr(lhs, "=", model.NewLiteral(value))
+			default:
+				return match.ToSQL(lhs, field.Type.IsFullText())
+			}
+		}
+
+		return model.NewInfixExpr(e.Left.Accept(b).(model.Expr), e.Op, e.Right.Accept(b).(model.Expr))
+	}
+
+	expr := query.SelectCommand.Accept(visitor)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := expr.(*model.SelectCommand); ok {
+		query.SelectCommand = *expr.(*model.SelectCommand)
+	}
+	return query, nil
+}
+
+// parseExactFuzzyTerm parses the term of a fuzzy query on a numeric or boolean field, it's matched exactly
+func parseExactFuzzyTerm(fieldType schema.QuesmaType, term string) (any, error) {
+	switch fieldType.Name {
+	case schema.QuesmaTypeBoolean.Name:
+		return strconv.ParseBool(term)
+	case schema.QuesmaTypeUnsignedLong.Name:
+		return strconv.ParseUint(term, 10, 64)
+	default:
+		return strconv.ParseInt(term, 10, 64)
+	}
+}
+
+// applyScoreOperator translates `column __quesma_score ScoreTerm` to the term frequency in full-text fields.
+// Other fields (keywords, numbers, etc.) have a constant score of 1, as they're matched by the whole value.
+func (s *SchemaCheckPass) applyScoreOperator(indexSchema schema.Schema, query *model.Query) (*model.Query, error) {
+
+	visitor := model.NewBaseVisitor()
+
+	visitor.OverrideVisitInfix = func(b *model.BaseExprVisitor, e model.InfixExpr) interface{} {
+		lhs, ok := e.Left.(model.ColumnRef)
+		rhs, ok2 := e.Right.(model.LiteralExpr)
+
+		if ok && ok2 && e.Op == model.ScoreOperator {
+			term, isScoreTerm := rhs.Value.(model.ScoreTerm)
+			if !isScoreTerm {
+				logger.Error().Msgf("unexpected right side of score operator: %v (%T)", rhs.Value, rhs.Value)
+				return model.NewLiteral(0)
+			}
+
+			if field, _ := indexSchema.ResolveFieldByInternalName(lhs.ColumnName); field.Type.IsFullText() {
+				return term.ToSQL(lhs)
+			}
+			return model.NewLiteral(1)
+		}
+
+		return model.NewInfixExpr(e.Left.Accept(b).(model.Expr), e.Op, e.Right.Accept(b).(model.Expr))
+	}
+
+	expr := query.SelectCommand.Accept(visitor)
+	if _, ok := expr.(*model.SelectCommand); ok {
+		query.SelectCommand = *expr.(*model.SelectCommand)
+	}
+	return query, nil
+}
+
 func (s *SchemaCheckPass) Transform(queries []*model.Query) ([]*model.Query, error) {
 
 	transformationChain := []struct {
@@ -973,6 +1081,8 @@ func (s *SchemaCheckPass) Transform(queries []*model.Query) ([]*model.Query, err
 		{TransformationName: "ArrayTransformation", Transformation: s.applyArrayTransformations},
 		{TransformationName: "MapTransformation", Transformation: s.applyMapTransformations},
 		{TransformationName: "MatchOperatorTransformation", Transformation: s.applyMatchOperator},
+		{TransformationName: "FuzzyOperatorTransformation", Transformation: s.applyFuzzyOperator},
+		{TransformationName: "ScoreOperatorTransformation", Transformation: s.applyScoreOperator},
 		{TransformationName: "AggOverUnsupportedType", Transformation: s.checkAggOverUnsupportedType},
 
 		// Section 4: compensations and checks
@@ -6,6 +6,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/common_table"
 	"github.com/QuesmaOrg/quesma/quesma/config"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/types"
@@ -834,6 +835,33 @@ func TestApplyPhysicalFromExpression(t *testing.T) {
 			},
 		},
 
+		{
+			name:    "subquery with common table",
+			indexes: []string{"test2"},
+			input: model.SelectCommand{
+				FromClause: model.NewTableRef(model.SingleTableNamePlaceHolder),
+				Columns: []model.Expr{
+					model.NewColumnRef("a"),
+					model.NewParenExpr(model.SelectCommand{
+						FromClause: model.NewTableRef(model.SingleTableNamePlaceHolder),
+						Columns:    []model.Expr{model.NewCountFunc()},
+					}),
+				},
+			},
+			expected: model.SelectCommand{
+				FromClause: model.NewTableRef(common_table.TableName),
+				Columns: []model.Expr{
+					model.NewColumnRef("a"),
+					model.NewParenExpr(model.SelectCommand{
+						FromClause:  model.NewTableRef(common_table.TableName),
+						Columns:     []model.Expr{model.NewCountFunc()},
+						WhereClause: model.NewInfixExpr(model.NewColumnRef(common_table.IndexNameColumn), "=", model.NewLiteral("'test2'")),
+					}),
+				},
+				WhereClause: model.NewInfixExpr(model.NewColumnRef(common_table.IndexNameColumn), "=", model.NewLiteral("'test2'")),
+			},
+		},
+
 		{
 			name: "cte with fixed table name",
 			input: model.SelectCommand{
@@ -1204,6 +1232,186 @@ func Test_applyMatchOperator(t *testing.T) {
 	}
 }
 
+func Test_applyFuzzyOperator(t *testing.T) {
+	schemaTable := schema.Table{
+		Columns: map[string]schema.Column{
+			"message":  {Name: "message", Type: "String"},
+			"customer": {Name: "customer", Type: "LowCardinality(String)"},
+			"count":    {Name: "count", Type: "Int64"},
+			"active":   {Name: "active", Type: "Bool"},
+		},
+	}
+	indexConfig := map[string]config.IndexConfiguration{
+		"test": {SchemaOverrides: &config.SchemaConfiguration{Fields: map[config.FieldName]config.FieldConfiguration{
+			"message":  {Type: "text"},
+			"customer": {Type: "keyword"},
+		}}},
+	}
+
+	tests := []struct {
+		name     string
+		where    model.Expr
+		expected string // "" if the query should be rejected
+	}{
+		{
+			name:     "text field is matched word by word",
+			where:    model.NewFuzzyMatchExpr(model.NewColumnRef("message"), model.FuzzyMatch{Term: "Smith", Fuzziness: model.FuzzinessAuto, Transpositions: true}),
+			expected: `arrayExists((x) -> damerauLevenshteinDistance(x,'smith')<=1,splitByRegexp('[^\\p{L}\\p{N}]+',lower("message")))`,
+		},
+		{
+			name:     "keyword field is matched by the whole value, with prefix",
+			where:    model.NewFuzzyMatchExpr(model.NewColumnRef("customer"), model.FuzzyMatch{Term: "jon smith", Fuzziness: model.Fuzziness{Edits: 2}, PrefixLength: 2}),
+			expected: `(startsWith(lower("customer"),'jo') AND editDistance(lower("customer"),'jon smith')<=2)`,
+		},
+		{
+			name:     "short term needs exact match with AUTO fuzziness",
+			where:    model.NewFuzzyMatchExpr(model.NewColumnRef("customer"), model.FuzzyMatch{Term: "Al", Fuzziness: model.FuzzinessAuto}),
+			expected: `lower("customer")='al'`,
+		},
+		{
+			name:     "numeric field",
+			where:    model.NewFuzzyMatchExpr(model.NewColumnRef("count"), model.FuzzyMatch{Term: "123", Fuzziness: model.FuzzinessAuto}),
+			expected: `"count"=123`,
+		},
+		{
+			name:     "boolean field",
+			where:    model.NewFuzzyMatchExpr(model.NewColumnRef("active"), model.FuzzyMatch{Term: "true", Fuzziness: model.FuzzinessAuto}),
+			expected: `"active"=true`,
+		},
+		{
+			name:  "numeric field with a term which isn't a number",
+			where: model.NewFuzzyMatchExpr(model.NewColumnRef("count"), model.FuzzyMatch{Term: "0 OR 1=1", Fuzziness: model.FuzzinessAuto}),
+		},
+		{
+			name:  "boolean field with a term which isn't a boolean",
+			where: model.NewFuzzyMatchExpr(model.NewColumnRef("active"), model.FuzzyMatch{Term: "true OR 1=1", Fuzziness: model.FuzzinessAuto}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableDiscovery :=
+				fixedTableProvider{tables: map[string]schema.Table{
+					"test": schemaTable,
+				}}
+			cfg := config.QuesmaConfiguration{
+				IndexConfig: indexConfig,
+			}
+
+			s := schema.NewSchemaRegistry(tableDiscovery, &cfg, clickhouse.SchemaTypeAdapter{})
+			s.Start()
+			defer s.Stop()
+
+			transform := NewSchemaCheckPass(&cfg, nil, defaultSearchAfterStrategy)
+
+			indexSchema, ok := s.FindSchema("test")
+			if !ok {
+				t.Fatal("schema not found")
+			}
+
+			query := &model.Query{
+				TableName: "test",
+				SelectCommand: model.SelectCommand{
+					FromClause:  model.NewTableRef("test"),
+					Columns:     []model.Expr{model.NewColumnRef("message")},
+					WhereClause: tt.where,
+				},
+			}
+			actual, err := transform.applyFuzzyOperator(indexSchema, query)
+			if tt.expected == "" {
+				assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expected, model.AsString(actual.SelectCommand.WhereClause))
+		})
+	}
+}
+
+func Test_applyScoreOperator(t *testing.T) {
+	schemaTable := schema.Table{
+		Columns: map[string]schema.Column{
+			"message":  {Name: "message", Type: "String"},
+			"title":    {Name: "title", Type: "String"},
+			"customer": {Name: "customer", Type: "LowCardinality(String)"},
+		},
+	}
+	indexConfig := map[string]config.IndexConfiguration{
+		"test": {SchemaOverrides: &config.SchemaConfiguration{Fields: map[config.FieldName]config.FieldConfiguration{
+			"message":  {Type: "text"},
+			"title":    {Type: "text"},
+			"customer": {Type: "keyword"},
+		}}},
+	}
+
+	tests := []struct {
+		name     string
+		score    model.Expr
+		expected string
+	}{
+		{
+			name:     "text field",
+			score:    model.NewScoreTermExpr(model.NewColumnRef("message"), "fox"),
+			expected: `divide(multiply(ifNull(countSubstringsCaseInsensitive("message",'fox'),0),2.2),plus(ifNull(countSubstringsCaseInsensitive("message",'fox'),0),1.2)) AS "_score"`,
+		},
+		{
+			name:     "keyword field has a constant score",
+			score:    model.NewScoreTermExpr(model.NewColumnRef("customer"), "fox"),
+			expected: `1 AS "_score"`,
+		},
+		{
+			name:  "scores of all full-text fields add up",
+			score: model.NewScoreTermExpr(model.NewColumnRef(model.FullTextFieldNamePlaceHolder), "fox"),
+			expected: `plus(divide(multiply(ifNull(countSubstringsCaseInsensitive("message",'fox'),0),2.2),plus(ifNull(countSubstringsCaseInsensitive("message",'fox'),0),1.2)),` +
+				`divide(multiply(ifNull(countSubstringsCaseInsensitive("title",'fox'),0),2.2),plus(ifNull(countSubstringsCaseInsensitive("title",'fox'),0),1.2))) AS "_score"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableDiscovery :=
+				fixedTableProvider{tables: map[string]schema.Table{
+					"test": schemaTable,
+				}}
+			cfg := config.QuesmaConfiguration{
+				IndexConfig: indexConfig,
+			}
+
+			s := schema.NewSchemaRegistry(tableDiscovery, &cfg, clickhouse.SchemaTypeAdapter{})
+			s.Start()
+			defer s.Stop()
+
+			transform := NewSchemaCheckPass(&cfg, nil, defaultSearchAfterStrategy)
+
+			indexSchema, ok := s.FindSchema("test")
+			if !ok {
+				t.Fatal("schema not found")
+			}
+
+			query := &model.Query{
+				TableName: "test",
+				SelectCommand: model.SelectCommand{
+					FromClause: model.NewTableRef("test"),
+					Columns:    []model.Expr{model.NewAliasedExpr(tt.score, model.ScoreFieldName)},
+				},
+			}
+			actual, err := transform.applyFullTextField(indexSchema, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err = transform.applyScoreOperator(indexSchema, actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expected, model.AsString(actual.SelectCommand.Columns[0]))
+		})
+	}
+}
+
 func Test_checkAggOverUnsupportedType(t *testing.T) {
 	schemaTable := schema.Table{
 		Columns: map[string]schema.Column{
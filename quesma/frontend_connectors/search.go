@@ -19,6 +19,8 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/optimize"
 	"github.com/QuesmaOrg/quesma/quesma/painful"
 	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_sql"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/esql"
 	"github.com/QuesmaOrg/quesma/quesma/recovery"
 	"github.com/QuesmaOrg/quesma/quesma/schema"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
@@ -47,6 +49,9 @@ type QueryRunner struct {
 	cancel               context.CancelFunc
 	AsyncRequestStorage  async_search_storage.AsyncRequestResultStorage
 	AsyncQueriesContexts async_search_storage.AsyncQueryContextStorage
+	ScrollContexts       async_search_storage.ScrollContextStorage
+	PointsInTime         async_search_storage.PointInTimeStorage
+	Tasks                *TaskManager
 	logManager           clickhouse.LogManagerIFace
 	cfg                  *config.QuesmaConfiguration
 	debugInfoCollector   diag.DebugInfoCollector
@@ -69,9 +74,24 @@ type QueryRunner struct {
 // moving forwards as we remove two implementations we might look at making all these methods private again.
 type QueryRunnerIFace interface {
 	HandleSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error)
+	HandleEQLSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error)
+	HandleSQL(ctx context.Context, body types.JSON) (*elastic_sql.Response, error)
+	HandleSQLTranslate(ctx context.Context, body types.JSON) (types.JSON, error)
+	HandleESQL(ctx context.Context, body types.JSON) (*esql.Response, error)
 	HandleAsyncSearch(ctx context.Context, indexPattern string, body types.JSON, waitForResultsMs int, keepOnCompletion bool) ([]byte, error)
 	HandleAsyncSearchStatus(_ context.Context, id string) ([]byte, error)
+	HandleScrollSearch(ctx context.Context, indexPattern string, body types.JSON, keepAlive string) ([]byte, error)
+	HandleScroll(ctx context.Context, scrollId string, keepAlive string) ([]byte, error)
+	ClearScroll(scrollIds []string) int
+	HandleOpenPointInTime(ctx context.Context, indexPattern string, keepAlive string) (string, error)
+	HandleClosePointInTime(pitId string) bool
+	HandlePointInTimeSearch(ctx context.Context, body types.JSON) ([]byte, error)
 	HandleCount(ctx context.Context, indexPattern string) (int64, error)
+	HandleDeleteByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error)
+	HandleUpdateByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error)
+	HandleGetTask(taskId string) ([]byte, error)
+	HandleGetDocument(ctx context.Context, index, id string, sourceFilter SourceFilter) (types.JSON, error)
+	HandleMultiGet(ctx context.Context, defaultIndex string, body types.JSON, sourceFilter SourceFilter) ([]byte, error)
 	// Todo: consider removing this getters for these two below, this was required for temporary Field Caps impl in v2 api
 	GetSchemaRegistry() schema.Registry
 	GetLogManager() clickhouse.LogManagerIFace
@@ -99,6 +119,9 @@ func NewQueryRunner(lm clickhouse.LogManagerIFace,
 		executionCtx: ctx, cancel: cancel,
 		AsyncRequestStorage:    async_search_storage.NewAsyncSearchStorageInMemory(),
 		AsyncQueriesContexts:   async_search_storage.NewAsyncQueryContextStorageInMemory(),
+		ScrollContexts:         async_search_storage.NewScrollContextStorageInMemory(),
+		PointsInTime:           async_search_storage.NewPointInTimeStorageInMemory(),
+		Tasks:                  NewTaskManager(),
 		transformationPipeline: *transformationPipeline,
 		schemaRegistry:         schemaRegistry,
 		ABResultsSender:        abResultsRepository,
@@ -328,7 +351,11 @@ func (q *QueryRunner) shouldRouteQueryToElasticsearch(query msearchQuery) bool {
 }
 
 func (q *QueryRunner) HandleSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error) {
-	return q.handleSearchCommon(ctx, indexPattern, body, nil)
+	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageDefault)
+}
+
+func (q *QueryRunner) HandleEQLSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error) {
+	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageEQL)
 }
 
 func (q *QueryRunner) HandleAsyncSearch(ctx context.Context, indexPattern string, body types.JSON,
@@ -342,7 +369,7 @@ func (q *QueryRunner) HandleAsyncSearch(ctx context.Context, indexPattern string
 	}
 	ctx = context.WithValue(ctx, tracing.AsyncIdCtxKey, async.asyncId)
 	logger.InfoWithCtx(ctx).Msgf("async search request id: %s started", async.asyncId)
-	return q.handleSearchCommon(ctx, indexPattern, body, &async)
+	return q.handleSearchCommon(ctx, indexPattern, body, &async, QueryLanguageDefault)
 }
 
 type asyncSearchWithError struct {
@@ -362,7 +389,7 @@ func (q *QueryRunner) transformQueries(plan *model.ExecutionPlan) error {
 	var err error
 	plan.Queries, err = q.transformationPipeline.Transform(plan.Queries)
 	if err != nil {
-		return fmt.Errorf("error transforming queries: %v", err)
+		return fmt.Errorf("error transforming queries: %w", err)
 	}
 	return nil
 }
@@ -454,7 +481,7 @@ func (q *QueryRunner) executePlan(ctx context.Context, plan *model.ExecutionPlan
 	}
 }
 
-func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern string, body types.JSON, optAsync *AsyncQuery) ([]byte, error) {
+func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern string, body types.JSON, optAsync *AsyncQuery, queryLanguage QueryLanguage) ([]byte, error) {
 
 	decision := q.tableResolver.Resolve(quesma_api.QueryPipeline, indexPattern)
 
@@ -522,30 +549,97 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		}
 	}
 
-	tables, err := q.logManager.GetTableDefinitions()
+	table, currentSchema, resolvedIndexes, err := q.loadTableAndSchema(clickhouseConnector)
 	if err != nil {
+		return []byte{}, err
+	}
+	if len(resolvedIndexes) == 0 {
+		if optAsync != nil {
+			return elastic_query_dsl.EmptyAsyncSearchResponse(optAsync.asyncId, false, 200)
+		} else {
+			return elastic_query_dsl.EmptySearchResponse(ctx), nil
+		}
+	}
+
+	if len(clickhouseConnector.AliasFilters) > 0 {
+		if body, err = applyAliasFilters(body, queryLanguage, resolvedIndexes, clickhouseConnector.AliasFilters); err != nil {
+			return nil, err
+		}
+	}
+
+	queryTranslator := NewQueryTranslator(ctx, queryLanguage, currentSchema, table, q.logManager, q.DateMathRenderer, resolvedIndexes, q.scoringEnabled(resolvedIndexes))
+
+	plan, err := queryTranslator.ParseQuery(body)
+
+	if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+		logger.WarnWithCtx(ctx).Msgf("invalid request: %v", err)
 		return nil, err
 	}
+	if err != nil {
+		logger.ErrorWithCtx(ctx).Msgf("parsing error: %v", err)
+		queries := plan.Queries
+		queriesBody := make([]diag.TranslatedSQLQuery, len(queries))
+		queriesBodyConcat := ""
+		for i, query := range queries {
+			queriesBody[i].Query = []byte(query.SelectCommand.String())
+			queriesBodyConcat += query.SelectCommand.String() + "\n"
+		}
+		responseBody = []byte(fmt.Sprintf("Invalid Queries: %v, err: %v", queriesBody, err))
+		logger.ErrorWithCtxAndReason(ctx, "Quesma generated invalid SQL query").Msg(queriesBodyConcat)
+		bodyAsBytes, _ := body.Bytes()
+		pushSecondaryInfo(q.debugInfoCollector, id, "", path, bodyAsBytes, queriesBody, responseBody, startTime)
+		return responseBody, errors.New(string(responseBody))
+	}
+	err = q.transformQueries(plan)
+	if err != nil {
+		return responseBody, err
+	}
+	plan.IndexPattern = indexPattern
+	plan.StartTime = startTime
+	plan.Name = model.MainExecutionPlan
 
-	var table *clickhouse.Table // TODO we should use schema here only
-	var currentSchema schema.Schema
-	resolvedIndexes := clickhouseConnector.ClickhouseIndexes
+	if decision.EnableABTesting {
+		return q.executeABTesting(ctx, plan, queryTranslator, table, body, optAsync, decision, indexPattern)
+	}
+	return q.executePlan(ctx, plan, queryTranslator, table, body, optAsync, nil, true)
+
+}
+
+// scoringEnabled returns true <=> relevance scoring is enabled in the configuration of all the indexes
+func (q *QueryRunner) scoringEnabled(indexes []string) bool {
+	for _, indexName := range indexes {
+		if !q.cfg.IndexConfig[indexName].Scoring {
+			return false
+		}
+	}
+	return len(indexes) > 0
+}
+
+// loadTableAndSchema loads the table and the schema of indexes resolved to ClickHouse.
+// For the common table, only indexes actually stored there are kept, so resolvedIndexes may be empty.
+func (q *QueryRunner) loadTableAndSchema(clickhouseConnector *quesma_api.ConnectorDecisionClickhouse) (table *clickhouse.Table, currentSchema schema.Schema, resolvedIndexes []string, err error) {
+	tables, err := q.logManager.GetTableDefinitions()
+	if err != nil {
+		return nil, schema.Schema{}, nil, err
+	}
+
+	resolvedIndexes = clickhouseConnector.ClickhouseIndexes
 
 	if !clickhouseConnector.IsCommonTable {
 		if len(resolvedIndexes) < 1 {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load [%s] schema", resolvedIndexes)).Details("Table: [%v]", resolvedIndexes)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load [%s] schema", resolvedIndexes)).Details("Table: [%v]", resolvedIndexes)
 		}
 		indexName := resolvedIndexes[0] // we got exactly one table here because of the check above
 		resolvedTableName := q.cfg.IndexConfig[indexName].TableName(indexName)
 
 		resolvedSchema, ok := q.schemaRegistry.FindSchema(schema.IndexName(indexName))
 		if !ok {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", resolvedTableName)).Details("Table: %s", resolvedTableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", resolvedTableName)).Details("Table: %s", resolvedTableName)
 		}
 
 		table, _ = tables.Load(resolvedTableName)
 		if table == nil {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", resolvedTableName)).Details("Table: %s", resolvedTableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", resolvedTableName)).Details("Table: %s", resolvedTableName)
 		}
 
 		currentSchema = resolvedSchema
@@ -566,16 +660,12 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		resolvedIndexes = virtualOnlyTables
 
 		if len(resolvedIndexes) == 0 {
-			if optAsync != nil {
-				return elastic_query_dsl.EmptyAsyncSearchResponse(optAsync.asyncId, false, 200)
-			} else {
-				return elastic_query_dsl.EmptySearchResponse(ctx), nil
-			}
+			return nil, schema.Schema{}, nil, nil
 		}
 
 		commonTable, ok := tables.Load(common_table.TableName)
 		if !ok {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", common_table.TableName)).Details("Table: %s", common_table.TableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", common_table.TableName)).Details("Table: %s", common_table.TableName)
 		}
 
 		// Let's build a  union of schemas
@@ -591,7 +681,7 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		for _, idx := range resolvedIndexes {
 			scm, ok := schemas[schema.IndexName(idx)]
 			if !ok {
-				return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", idx)).Details("Table: %s", idx)
+				return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", idx)).Details("Table: %s", idx)
 			}
 
 			for fieldName := range scm.Fields {
@@ -603,39 +693,7 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		currentSchema = resolvedSchema
 		table = commonTable
 	}
-
-	queryTranslator := NewQueryTranslator(ctx, currentSchema, table, q.logManager, q.DateMathRenderer, resolvedIndexes)
-
-	plan, err := queryTranslator.ParseQuery(body)
-
-	if err != nil {
-		logger.ErrorWithCtx(ctx).Msgf("parsing error: %v", err)
-		queries := plan.Queries
-		queriesBody := make([]diag.TranslatedSQLQuery, len(queries))
-		queriesBodyConcat := ""
-		for i, query := range queries {
-			queriesBody[i].Query = []byte(query.SelectCommand.String())
-			queriesBodyConcat += query.SelectCommand.String() + "\n"
-		}
-		responseBody = []byte(fmt.Sprintf("Invalid Queries: %v, err: %v", queriesBody, err))
-		logger.ErrorWithCtxAndReason(ctx, "Quesma generated invalid SQL query").Msg(queriesBodyConcat)
-		bodyAsBytes, _ := body.Bytes()
-		pushSecondaryInfo(q.debugInfoCollector, id, "", path, bodyAsBytes, queriesBody, responseBody, startTime)
-		return responseBody, errors.New(string(responseBody))
-	}
-	err = q.transformQueries(plan)
-	if err != nil {
-		return responseBody, err
-	}
-	plan.IndexPattern = indexPattern
-	plan.StartTime = startTime
-	plan.Name = model.MainExecutionPlan
-
-	if decision.EnableABTesting {
-		return q.executeABTesting(ctx, plan, queryTranslator, table, body, optAsync, decision, indexPattern)
-	}
-	return q.executePlan(ctx, plan, queryTranslator, table, body, optAsync, nil, true)
-
+	return table, currentSchema, resolvedIndexes, nil
 }
 
 func (q *QueryRunner) storeAsyncSearch(qmc diag.DebugInfoCollector, id, asyncId string,
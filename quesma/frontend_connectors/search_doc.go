@@ -0,0 +1,247 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/goccy/go-json"
+	"regexp"
+	"strings"
+)
+
+// Documents are fetched by `_id` (`GET /:index/_doc/:id`, `GET /:index/_source/:id`, `_mget`) with an `ids` query,
+// so `_id` is decoded exactly like in searches. The `_id` generated by Quesma is based on the timestamp,
+// if there are more documents with the same timestamp, the first one is returned.
+
+// SourceFilter selects fields of `_source` returned with documents (`_source`, `_source_includes`, `_source_excludes`)
+type SourceFilter struct {
+	Disabled bool
+	Includes []string
+	Excludes []string
+}
+
+// ParseSourceFilter parses URL parameters, `source` is either a boolean or a comma separated list of includes
+func ParseSourceFilter(source, includes, excludes string) SourceFilter {
+	var filter SourceFilter
+	switch source {
+	case "false":
+		filter.Disabled = true
+	case "", "true":
+	default:
+		filter.Includes = splitFieldPatterns(source)
+	}
+	if includes != "" {
+		filter.Includes = splitFieldPatterns(includes)
+	}
+	filter.Excludes = splitFieldPatterns(excludes)
+	return filter
+}
+
+// parseSourceFilterFromBody parses `_source` of a `_mget` doc: a boolean, a list of includes, or an object
+func parseSourceFilterFromBody(source any, defaultFilter SourceFilter) (SourceFilter, error) {
+	switch source := source.(type) {
+	case nil:
+		return defaultFilter, nil
+	case bool:
+		return SourceFilter{Disabled: !source}, nil
+	case string:
+		return SourceFilter{Includes: splitFieldPatterns(source)}, nil
+	case []any:
+		return SourceFilter{Includes: toFieldPatterns(source)}, nil
+	case map[string]any:
+		filter := SourceFilter{}
+		for key, value := range source {
+			patterns := toFieldPatterns(value)
+			switch key {
+			case "includes", "include":
+				filter.Includes = patterns
+			case "excludes", "exclude":
+				filter.Excludes = patterns
+			default:
+				return filter, fmt.Errorf("%w: unknown key [%s] in [_source]", quesma_errors.ErrCouldNotParseRequest(), key)
+			}
+		}
+		return filter, nil
+	default:
+		return defaultFilter, fmt.Errorf("%w: unsupported [_source] value %v", quesma_errors.ErrCouldNotParseRequest(), source)
+	}
+}
+
+func splitFieldPatterns(patterns string) []string {
+	var result []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+func toFieldPatterns(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return splitFieldPatterns(value)
+	case []any:
+		var result []string
+		for _, pattern := range value {
+			if pattern, ok := pattern.(string); ok {
+				result = append(result, pattern)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// Apply filters the source, a pattern matching an object matches all its fields
+func (f SourceFilter) Apply(source map[string]any) map[string]any {
+	if len(f.Includes) == 0 && len(f.Excludes) == 0 {
+		return source
+	}
+	return filterSource(source, "", compileFieldPatterns(f.Includes), compileFieldPatterns(f.Excludes), len(f.Includes) == 0)
+}
+
+func compileFieldPatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, regexp.MustCompile("^"+strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")+"$"))
+	}
+	return compiled
+}
+
+func matchesAnyPattern(patterns []*regexp.Regexp, path string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterSource(source map[string]any, prefix string, includes, excludes []*regexp.Regexp, included bool) map[string]any {
+	result := make(map[string]any)
+	for key, value := range source {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if matchesAnyPattern(excludes, path) {
+			continue
+		}
+		pathIncluded := included || matchesAnyPattern(includes, path)
+		if nested, ok := value.(map[string]any); ok {
+			if filtered := filterSource(nested, path, includes, excludes, pathIncluded); len(filtered) > 0 || (pathIncluded && len(nested) == 0) {
+				result[key] = filtered
+			}
+			continue
+		}
+		if pathIncluded {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// HandleGetDocument returns the document in the format of `GET /:index/_doc/:id`, with `found: false` if there is none
+func (q *QueryRunner) HandleGetDocument(ctx context.Context, index, id string, sourceFilter SourceFilter) (types.JSON, error) {
+	body := types.JSON{
+		"query":            map[string]any{"ids": map[string]any{"values": []any{id}}},
+		"size":             1.0, // as if parsed from JSON
+		"track_total_hits": false,
+	}
+	responseBody, err := q.handleSearchCommon(ctx, index, body, nil, QueryLanguageDefault)
+	if err != nil {
+		// ids which were not generated by Quesma can't be parsed, there is no document with such id
+		if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return types.JSON{"_index": index, "_id": id, "found": false}, nil
+		}
+		return nil, err
+	}
+
+	var response model.SearchResp
+	if err = json.Unmarshal(responseBody, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Hits.Hits) == 0 {
+		return types.JSON{"_index": index, "_id": id, "found": false}, nil
+	}
+
+	hit := response.Hits.Hits[0]
+	if hit.Index != "" {
+		index = hit.Index
+	}
+	document := types.JSON{"_index": index, "_id": id, "_version": 1, "_seq_no": 0, "_primary_term": 1, "found": true}
+	if !sourceFilter.Disabled {
+		source := make(map[string]any)
+		if len(hit.Source) > 0 {
+			if err = json.Unmarshal(hit.Source, &source); err != nil {
+				return nil, err
+			}
+		}
+		document["_source"] = sourceFilter.Apply(source)
+	}
+	return document, nil
+}
+
+// HandleMultiGet handles `_mget`, body has either `docs` (with `_index`, `_id` and optional `_source`) or `ids`
+func (q *QueryRunner) HandleMultiGet(ctx context.Context, defaultIndex string, body types.JSON, sourceFilter SourceFilter) ([]byte, error) {
+	type docRequest struct {
+		index        string
+		id           string
+		sourceFilter SourceFilter
+	}
+	var requests []docRequest
+
+	if ids, ok := body["ids"].([]any); ok {
+		for _, id := range ids {
+			requests = append(requests, docRequest{index: defaultIndex, id: fmt.Sprint(id), sourceFilter: sourceFilter})
+		}
+	} else if docs, ok := body["docs"].([]any); ok {
+		for _, d := range docs {
+			doc, ok := d.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: [docs] must contain objects", quesma_errors.ErrCouldNotParseRequest())
+			}
+			request := docRequest{index: defaultIndex}
+			if index, ok := doc["_index"].(string); ok {
+				request.index = index
+			}
+			if id, ok := doc["_id"]; ok {
+				request.id = fmt.Sprint(id)
+			}
+			if request.index == "" || request.id == "" {
+				return nil, fmt.Errorf("%w: [_index] and [_id] are required for each doc", quesma_errors.ErrCouldNotParseRequest())
+			}
+			var err error
+			if request.sourceFilter, err = parseSourceFilterFromBody(doc["_source"], sourceFilter); err != nil {
+				return nil, err
+			}
+			requests = append(requests, request)
+		}
+	} else {
+		return nil, fmt.Errorf("%w: [docs] or [ids] is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+
+	documents := make([]types.JSON, 0, len(requests))
+	for _, request := range requests {
+		document, err := q.HandleGetDocument(ctx, request.index, request.id, request.sourceFilter)
+		if err != nil {
+			errorType := "exception"
+			if errors.Is(err, quesma_errors.ErrIndexNotExists()) {
+				errorType = "index_not_found_exception"
+			}
+			document = types.JSON{"_index": request.index, "_id": request.id, "error": types.JSON{
+				"root_cause": []types.JSON{{"type": errorType, "reason": err.Error()}},
+				"type":       errorType,
+				"reason":     err.Error(),
+			}}
+		}
+		documents = append(documents, document)
+	}
+	return json.Marshal(types.JSON{"docs": documents})
+}
@@ -0,0 +1,118 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newGetDocumentTestRunner(t *testing.T) (*QueryRunner, sqlmock.Sqlmock) {
+	fields := map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"host.name":  {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+	}
+	staticRegistry := schema.NewStaticRegistry(
+		map[schema.IndexName]schema.Schema{tableName: schema.NewSchema(fields, true, "")},
+		map[string]schema.Table{},
+		map[schema.FieldEncodingKey]schema.EncodedFieldName{},
+	)
+	tab := util.NewSyncMapWith(tableName, &clickhouse.Table{
+		Name:   tableName,
+		Config: clickhouse.NewChTableConfigTimestampStringAttr(),
+		Cols: map[string]*clickhouse.Column{
+			"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+			"message":    {Name: "message", Type: clickhouse.NewBaseType("String")},
+			"host_name":  {Name: "host_name", Type: clickhouse.NewBaseType("String")},
+		},
+		Created: true,
+	})
+
+	conn, mock := util.InitSqlMockWithPrettySqlAndPrint(t, false)
+	t.Cleanup(func() { conn.Close() })
+	db := backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	return NewQueryRunnerDefaultForTests(db, &DefaultConfig, tableName, tab, staticRegistry), mock
+}
+
+const getDocumentSql = `SELECT "@timestamp", "host_name", "message" FROM __quesma_table_name WHERE "@timestamp" = toDateTime64('2024-01-29 18:11:36.491',3) LIMIT 1`
+
+func TestGetDocument(t *testing.T) {
+	queryRunner, mock := newGetDocumentTestRunner(t)
+	timestamp := time.Date(2024, 1, 29, 18, 11, 36, 491_000_000, time.UTC)
+	mock.ExpectQuery(getDocumentSql).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "host_name", "message"}).AddRow(timestamp, "server-1", "hello"))
+
+	document, err := queryRunner.HandleGetDocument(ctx, tableName, "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", SourceFilter{Excludes: []string{"host.*"}})
+	require.NoError(t, err)
+	assert.Equal(t, true, document["found"])
+	assert.Equal(t, "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", document["_id"])
+	assert.Equal(t, map[string]any{"@timestamp": "2024-01-29 18:11:36.491 +0000 UTC", "message": "hello"}, document["_source"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDocumentNotFound(t *testing.T) {
+	queryRunner, mock := newGetDocumentTestRunner(t)
+	mock.ExpectQuery(getDocumentSql).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "host_name", "message"}))
+
+	document, err := queryRunner.HandleGetDocument(ctx, tableName, "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", SourceFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{"_index": tableName, "_id": "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", "found": false}, document)
+
+	document, err = queryRunner.HandleGetDocument(ctx, tableName, "not-a-quesma-id", SourceFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, false, document["found"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMultiGet(t *testing.T) {
+	queryRunner, mock := newGetDocumentTestRunner(t)
+	timestamp := time.Date(2024, 1, 29, 18, 11, 36, 491_000_000, time.UTC)
+	mock.ExpectQuery(getDocumentSql).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "host_name", "message"}).AddRow(timestamp, "server-1", "hello"))
+	mock.ExpectQuery(getDocumentSql).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "host_name", "message"}).AddRow(timestamp, "server-1", "hello"))
+
+	body := types.MustJSON(`{"docs": [
+		{"_index": "` + tableName + `", "_id": "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", "_source": ["message"]},
+		{"_index": "` + tableName + `", "_id": "323032342d30312d32392031383a31313a33362e343931202b3030303020555443q1", "_source": false}]}`)
+	response, err := queryRunner.HandleMultiGet(ctx, "", body, SourceFilter{})
+	require.NoError(t, err)
+
+	var responseMap struct {
+		Docs []types.JSON `json:"docs"`
+	}
+	require.NoError(t, json.Unmarshal(response, &responseMap))
+	require.Len(t, responseMap.Docs, 2)
+	assert.Equal(t, map[string]any{"message": "hello"}, responseMap.Docs[0]["_source"])
+	assert.Equal(t, true, responseMap.Docs[1]["found"])
+	assert.NotContains(t, responseMap.Docs[1], "_source")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSourceFilter(t *testing.T) {
+	source := map[string]any{
+		"message": "hello",
+		"host":    map[string]any{"name": "server-1", "ip": "10.0.0.1"},
+		"user":    map[string]any{"name": "alice"},
+	}
+
+	assert.Equal(t, source, ParseSourceFilter("", "", "").Apply(source))
+	assert.True(t, ParseSourceFilter("false", "", "").Disabled)
+	assert.Equal(t, map[string]any{"host": map[string]any{"name": "server-1", "ip": "10.0.0.1"}},
+		ParseSourceFilter("host", "", "").Apply(source))
+	assert.Equal(t, map[string]any{"host": map[string]any{"name": "server-1"}, "user": map[string]any{"name": "alice"}},
+		ParseSourceFilter("", "*.name", "").Apply(source))
+	assert.Equal(t, map[string]any{"host": map[string]any{"name": "server-1"}},
+		ParseSourceFilter("", "host", "host.ip").Apply(source))
+}
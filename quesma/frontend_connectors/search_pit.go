@@ -0,0 +1,113 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/async_search_storage"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"slices"
+	"strings"
+)
+
+// Point in time (PIT) pins the set of tables resolved when it was opened, and filters out documents ingested
+// after that (by schema.IngestTimeColumnName), so pages requested with `search_after` don't shift while new data arrives.
+// Paging itself is the same keyset pagination as in scroll, see search_scroll.go. As in Elasticsearch,
+// sort values of hits end with an implicit tie-breaker (`_shard_doc` there), here it's the number of hits
+// with the same sort values up to this one. Sending it back in `search_after` makes the next page start
+// right after the hit, even if the following ones have the same sort values.
+
+type openPointInTimeResponse struct {
+	Id     string         `json:"id"`
+	Shards map[string]int `json:"_shards"`
+}
+
+// HandleOpenPointInTime opens PIT (`POST /:index/_pit?keep_alive=...`) and returns its id
+func (q *QueryRunner) HandleOpenPointInTime(_ context.Context, indexPattern string, keepAlive string) (string, error) {
+	if keepAlive == "" {
+		return "", fmt.Errorf("%w: [keep_alive] is not specified", quesma_errors.ErrCouldNotParseRequest())
+	}
+	duration, err := parseKeepAlive(keepAlive)
+	if err != nil {
+		return "", err
+	}
+
+	table, currentSchema, indexes, aliasFilter, err := q.resolveClickhouseSource(indexPattern)
+	if err != nil {
+		return "", err
+	}
+	timestampField, _ := keysetTimestampField(currentSchema, table)
+	_, hasIngestTime := table.Cols[schema.IngestTimeColumnName]
+	if !hasIngestTime {
+		logger.Warn().Msgf("table %s has no ingest time column, documents ingested after opening point in time will be visible", table.Name)
+	}
+
+	pitId := async_search_storage.GetPitId()
+	q.PointsInTime.Store(pitId, async_search_storage.NewPointInTime(indexes, aliasFilter, timestampField, hasIngestTime, duration))
+	return pitId, nil
+}
+
+// HandleClosePointInTime closes PIT (`DELETE /_pit`), it returns false if there was no such PIT
+func (q *QueryRunner) HandleClosePointInTime(pitId string) bool {
+	return q.PointsInTime.Delete(pitId)
+}
+
+// HandlePointInTimeSearch handles `_search` with `pit` in the body
+func (q *QueryRunner) HandlePointInTimeSearch(ctx context.Context, body types.JSON) ([]byte, error) {
+	pitParam, _ := body["pit"].(map[string]any)
+	pitId, _ := pitParam["id"].(string)
+	pit, ok := q.PointsInTime.Load(pitId)
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", errSearchContextMissing, pitId)
+	}
+	if keepAlive, ok := pitParam["keep_alive"].(string); ok {
+		duration, err := parseKeepAlive(keepAlive)
+		if err != nil {
+			return nil, err
+		}
+		pit.Touch(duration)
+	}
+
+	body = body.Clone()
+	delete(body, "pit")
+	if pit.AliasFilter != nil {
+		body["query"] = filterQuery(body["query"], pit.AliasFilter)
+	}
+	if pit.HasIngestTime {
+		body["query"] = filterQuery(body["query"], map[string]any{"range": map[string]any{
+			schema.IngestTimeColumnName: map[string]any{"lte": pit.OpenedAt.UnixMilli(), "format": "epoch_millis"},
+		}})
+	}
+
+	sortFields := keysetSortFields(body["sort"])
+	if len(sortFields) == 0 {
+		if pit.TimestampField == "" {
+			return nil, fmt.Errorf("%w: indexes %v have no date field to paginate on, please provide [sort]", quesma_errors.ErrCouldNotParseRequest(), pit.Indexes)
+		}
+		sortFields = []any{map[string]any{pit.TimestampField: map[string]any{"order": "asc"}}}
+	}
+	body["sort"] = sortFields
+
+	var after keysetPosition
+	if searchAfter, ok := body["search_after"].([]any); ok && len(searchAfter) == len(sortFields)+1 {
+		ties, ok := util.ExtractNumeric64Maybe(searchAfter[len(searchAfter)-1])
+		if !ok || ties < 0 {
+			return nil, fmt.Errorf("%w: invalid tie-breaker in [search_after]: %v", quesma_errors.ErrCouldNotParseRequest(), searchAfter[len(searchAfter)-1])
+		}
+		after = keysetPosition{sortValues: searchAfter[:len(searchAfter)-1], ties: int(ties)}
+		delete(body, "search_after")
+	} // otherwise it's a regular search_after without the tie-breaker
+
+	responseBody, _, err := q.searchKeysetPage(ctx, strings.Join(pit.Indexes, ","), body, after, func(hit map[string]any, position keysetPosition) {
+		hit["sort"] = append(slices.Clone(position.sortValues), position.ties)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withLeadingResponseField(responseBody, "pit_id", pitId), nil
+}
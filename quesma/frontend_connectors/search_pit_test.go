@@ -0,0 +1,137 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPointInTime(t *testing.T) {
+	fields := map[schema.FieldName]schema.Field{
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+	}
+	staticRegistry := schema.NewStaticRegistry(
+		map[schema.IndexName]schema.Schema{tableName: schema.NewSchema(fields, true, "")},
+		map[string]schema.Table{},
+		map[schema.FieldEncodingKey]schema.EncodedFieldName{},
+	)
+	tab := util.NewSyncMapWith(tableName, &clickhouse.Table{
+		Name:   tableName,
+		Config: clickhouse.NewChTableConfigTimestampStringAttr(),
+		Cols: map[string]*clickhouse.Column{
+			"message":                   {Name: "message", Type: clickhouse.NewBaseType("String")},
+			"@timestamp":                {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+			schema.IngestTimeColumnName: {Name: schema.IngestTimeColumnName, Type: clickhouse.NewBaseType("DateTime64")},
+		},
+		Created: true,
+	})
+
+	start := time.Date(2024, 1, 29, 18, 11, 36, 491000000, time.UTC) // 1706551896491 in UnixMilli
+	sub := func(seconds int) time.Time {
+		return start.Add(time.Second * time.Duration(-seconds))
+	}
+
+	conn, mock := util.InitSqlMockWithPrettySqlAndPrint(t, false)
+	defer conn.Close()
+	db := backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	queryRunner := NewQueryRunnerDefaultForTests(db, &DefaultConfig, tableName, tab, staticRegistry)
+
+	pitId, err := queryRunner.HandleOpenPointInTime(ctx, tableName, "1m")
+	require.NoError(t, err)
+	pit, ok := queryRunner.PointsInTime.Load(pitId)
+	require.True(t, ok)
+	pit.OpenedAt = start
+
+	iterations := []struct {
+		request          string
+		expectedSQL      string
+		resultRowsFromDB [][]any
+		expectedMessages []string
+		expectedLastSort []any
+	}{
+		{
+			request: `{"size": 2, "track_total_hits": false, "sort": [{"@timestamp": {"order": "desc"}}, {"_shard_doc": "desc"}],
+				"query": {"match_all": {}}, "pit": {"id": "%s", "keep_alive": "1m"}}`,
+			expectedSQL: `SELECT "@timestamp", "message" FROM __quesma_table_name ` +
+				`WHERE "__quesma_ingest_time"<=fromUnixTimestamp64Milli(1706551896491) ORDER BY "@timestamp" DESC LIMIT 2`,
+			resultRowsFromDB: [][]any{{sub(1), "m1"}, {sub(2), "m2"}},
+			expectedMessages: []string{"m1", "m2"},
+			expectedLastSort: []any{1706551894491.0, 1.0},
+		},
+		{
+			// m3 has the same timestamp as m2, it's not skipped thanks to the tie-breaker
+			request: `{"size": 2, "track_total_hits": false, "sort": [{"@timestamp": {"order": "desc"}}, {"_shard_doc": "desc"}],
+				"search_after": [1706551894491, 1], "pit": {"id": "%s"}}`,
+			expectedSQL: `SELECT "@timestamp", "message" FROM __quesma_table_name ` +
+				`WHERE ("__quesma_ingest_time"<=fromUnixTimestamp64Milli(1706551896491) AND fromUnixTimestamp64Milli(1706551894491)>="@timestamp") ORDER BY "@timestamp" DESC LIMIT 3`,
+			resultRowsFromDB: [][]any{{sub(2), "m2"}, {sub(2), "m3"}, {sub(3), "m4"}},
+			expectedMessages: []string{"m3", "m4"},
+			expectedLastSort: []any{1706551893491.0, 1.0},
+		},
+		{
+			// search_after without the tie-breaker is a regular one
+			request: `{"size": 2, "track_total_hits": false, "sort": [{"@timestamp": {"order": "desc"}}],
+				"search_after": [1706551893491], "pit": {"id": "%s"}}`,
+			expectedSQL: `SELECT "@timestamp", "message" FROM __quesma_table_name ` +
+				`WHERE ("__quesma_ingest_time"<=fromUnixTimestamp64Milli(1706551896491) AND fromUnixTimestamp64Milli(1706551893491)>"@timestamp") ORDER BY "@timestamp" DESC LIMIT 2`,
+			resultRowsFromDB: [][]any{{sub(4), "m5"}},
+			expectedMessages: []string{"m5"},
+			expectedLastSort: []any{1706551892491.0, 1.0},
+		},
+	}
+	for _, iteration := range iterations {
+		rows := sqlmock.NewRows([]string{"@timestamp", "message"})
+		for _, row := range iteration.resultRowsFromDB {
+			rows.AddRow(row[0], row[1])
+		}
+		mock.ExpectQuery(iteration.expectedSQL).WillReturnRows(rows)
+	}
+
+	for _, iteration := range iterations {
+		response, err := queryRunner.HandlePointInTimeSearch(ctx, types.MustJSON(fmt.Sprintf(iteration.request, pitId)))
+		require.NoError(t, err)
+
+		var responseMap model.JsonMap
+		require.NoError(t, json.Unmarshal(response, &responseMap))
+		assert.Equal(t, pitId, responseMap["pit_id"])
+		hits := responseMap["hits"].(model.JsonMap)["hits"].([]any)
+		messages := []string{}
+		for _, hit := range hits {
+			messages = append(messages, hit.(model.JsonMap)["_source"].(model.JsonMap)["message"].(string))
+		}
+		assert.Equal(t, iteration.expectedMessages, messages)
+		assert.Equal(t, iteration.expectedLastSort, hits[len(hits)-1].(model.JsonMap)["sort"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("there were unfulfilled expections:", err)
+	}
+
+	assert.True(t, queryRunner.HandleClosePointInTime(pitId))
+	assert.False(t, queryRunner.HandleClosePointInTime(pitId))
+	_, err = queryRunner.HandlePointInTimeSearch(ctx, types.MustJSON(fmt.Sprintf(`{"pit": {"id": "%s"}}`, pitId)))
+	assert.True(t, errors.Is(err, errSearchContextMissing))
+}
+
+func TestOpenPointInTimeRequiresKeepAlive(t *testing.T) {
+	queryRunner := &QueryRunner{}
+	_, err := queryRunner.HandleOpenPointInTime(ctx, tableName, "")
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+	_, err = queryRunner.HandleOpenPointInTime(ctx, tableName, "2d")
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+}
@@ -0,0 +1,305 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/async_search_storage"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scroll is emulated with keyset pagination: we don't keep any cursor open in ClickHouse.
+// Every page is a regular search with `search_after` set to the sort values of the last hit of the previous page.
+// This requires a sort on real columns, so sorts like `_doc` (the usual one for exports) are replaced
+// by the timestamp field of the index.
+//
+// Rows have no unique id we could break ties on, so the next page starts at (not after) the last sort values,
+// and skips as many hits with exactly these values as were already returned. That relies on ClickHouse returning
+// rows with equal sort values in the same order, add a tie-breaker column to the sort if that's not the case.
+
+const (
+	scrollAllIds = "_all"
+	maxKeepAlive = 24 * time.Hour
+	maxPageSize  = 10000 // hits queries are limited to that many rows
+)
+
+var errSearchContextMissing = errors.New("no search context found")
+
+// freedSearchContextsResponse is the response of clearing scroll and closing PIT
+type freedSearchContextsResponse struct {
+	Succeeded bool `json:"succeeded"`
+	NumFreed  int  `json:"num_freed"`
+}
+
+func parseKeepAlive(keepAlive string) (time.Duration, error) {
+	duration, err := util.ParseInterval(keepAlive)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse keep alive [%s]", quesma_errors.ErrCouldNotParseRequest(), keepAlive)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%w: keep alive must be positive, got [%s]", quesma_errors.ErrCouldNotParseRequest(), keepAlive)
+	}
+	if duration > maxKeepAlive {
+		return 0, fmt.Errorf("%w: keep alive (%s) is too large, it must be less than (%s)", quesma_errors.ErrCouldNotParseRequest(), keepAlive, maxKeepAlive)
+	}
+	return duration, nil
+}
+
+// HandleScrollSearch handles the first request of a scroll (`_search?scroll=...`)
+func (q *QueryRunner) HandleScrollSearch(ctx context.Context, indexPattern string, body types.JSON, keepAlive string) ([]byte, error) {
+	duration, err := parseKeepAlive(keepAlive)
+	if err != nil {
+		return nil, err
+	}
+
+	body = body.Clone()
+	if from, ok := util.ExtractNumeric64Maybe(body["from"]); ok && from > 0 {
+		return nil, fmt.Errorf("%w: using [from] is not allowed in a scroll context", quesma_errors.ErrCouldNotParseRequest())
+	}
+	if _, ok := body["search_after"]; ok {
+		return nil, fmt.Errorf("%w: [search_after] cannot be used in a scroll context", quesma_errors.ErrCouldNotParseRequest())
+	}
+	delete(body, "from")
+
+	sortFields := keysetSortFields(body["sort"])
+	if len(sortFields) == 0 {
+		table, currentSchema, _, _, err := q.resolveClickhouseSource(indexPattern)
+		if err != nil {
+			return nil, err
+		}
+		timestampField, found := keysetTimestampField(currentSchema, table)
+		if !found {
+			return nil, fmt.Errorf("%w: index [%s] has no date field to scroll on, please provide [sort]", quesma_errors.ErrCouldNotParseRequest(), indexPattern)
+		}
+		sortFields = []any{map[string]any{timestampField: map[string]any{"order": "asc"}}}
+	}
+	body["sort"] = sortFields
+
+	scrollContext := async_search_storage.NewScrollContext(indexPattern, body, nil, duration)
+	responseBody, err := q.searchScrollPage(ctx, scrollContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// aggregations are returned only with the first page, as in Elasticsearch
+	delete(scrollContext.Body, "aggs")
+	delete(scrollContext.Body, "aggregations")
+
+	scrollId := async_search_storage.GetScrollId()
+	q.ScrollContexts.Store(scrollId, scrollContext)
+	return withScrollId(responseBody, scrollId), nil
+}
+
+// HandleScroll returns the next page of a scroll (`_search/scroll`). Empty keepAlive keeps the previous one.
+func (q *QueryRunner) HandleScroll(ctx context.Context, scrollId string, keepAlive string) ([]byte, error) {
+	scrollContext, ok := q.ScrollContexts.Load(scrollId)
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", errSearchContextMissing, scrollId)
+	}
+
+	duration := scrollContext.KeepAlive()
+	if keepAlive != "" {
+		var err error
+		if duration, err = parseKeepAlive(keepAlive); err != nil {
+			return nil, err
+		}
+	}
+	scrollContext.Touch(duration)
+
+	responseBody, err := q.searchScrollPage(ctx, scrollContext)
+	if err != nil {
+		return nil, err
+	}
+	return withScrollId(responseBody, scrollId), nil
+}
+
+// ClearScroll frees scroll contexts, `_all` frees all of them. It returns the number of freed contexts.
+func (q *QueryRunner) ClearScroll(scrollIds []string) int {
+	freed := 0
+	for _, scrollId := range scrollIds {
+		if scrollId == scrollAllIds {
+			freed += q.ScrollContexts.DeleteAll()
+		} else if q.ScrollContexts.Delete(scrollId) {
+			freed++
+		}
+	}
+	return freed
+}
+
+// searchScrollPage runs a search for the next page and moves the scroll context past its last hit
+func (q *QueryRunner) searchScrollPage(ctx context.Context, scrollContext *async_search_storage.ScrollContext) ([]byte, error) {
+	scrollContext.Lock()
+	defer scrollContext.Unlock()
+
+	after := keysetPosition{sortValues: scrollContext.SearchAfter, ties: scrollContext.SearchAfterTies}
+	responseBody, last, err := q.searchKeysetPage(ctx, scrollContext.IndexPattern, scrollContext.Body.Clone(), after, nil)
+	if err != nil {
+		return nil, err
+	}
+	scrollContext.SearchAfter, scrollContext.SearchAfterTies = last.sortValues, last.ties
+	return responseBody, nil
+}
+
+// keysetPosition is a position in the sorted hits: right after the ties-th hit with exactly sortValues
+type keysetPosition struct {
+	sortValues []any // nil means the beginning
+	ties       int
+}
+
+// searchKeysetPage runs a search for the page of hits after the given position, and returns the position after
+// its last hit. If withPosition isn't nil, it's called for every returned hit with its position, and can modify it.
+func (q *QueryRunner) searchKeysetPage(ctx context.Context, indexPattern string, body types.JSON, after keysetPosition,
+	withPosition func(hit map[string]any, position keysetPosition)) ([]byte, keysetPosition, error) {
+
+	size := model.DefaultSizeListQuery
+	if sizeRaw, ok := util.ExtractNumeric64Maybe(body["size"]); ok {
+		size = int(sizeRaw)
+	}
+	if after.sortValues != nil {
+		if size+after.ties > maxPageSize {
+			return nil, after, fmt.Errorf("%w: more than %d hits have the same sort values %v, please add a tie-breaker field to [sort]",
+				quesma_errors.ErrCouldNotParseRequest(), maxPageSize-size, after.sortValues)
+		}
+		// hits with exactly the same sort values might not have been returned yet, so we start at them
+		body["search_after"] = model.SearchAfterInclusive(after.sortValues)
+		body["size"] = float64(size + after.ties) // as if it was parsed from JSON
+	}
+
+	responseBody, err := q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageDefault)
+	if err != nil {
+		return nil, after, err
+	}
+	if after.sortValues == nil && withPosition == nil && size == 0 {
+		return responseBody, after, nil
+	}
+
+	var response map[string]any
+	if err = json.Unmarshal(responseBody, &response); err != nil {
+		return nil, after, err
+	}
+	hitsObject, _ := response["hits"].(map[string]any)
+	hits, _ := hitsObject["hits"].([]any)
+
+	// skip hits we've already returned, they're the first ones
+	skipped := 0
+	for skipped < after.ties && skipped < len(hits) && reflect.DeepEqual(hitSortValues(hits[skipped]), after.sortValues) {
+		skipped++
+	}
+	hits = hits[skipped:]
+
+	position := after
+	for _, hit := range hits {
+		sortValues := hitSortValues(hit)
+		if len(sortValues) == 0 {
+			return nil, after, fmt.Errorf("page has no sort values, can't continue the pagination")
+		}
+		if position.sortValues != nil && reflect.DeepEqual(sortValues, position.sortValues) {
+			position.ties++
+		} else {
+			position = keysetPosition{sortValues: sortValues, ties: 1}
+		}
+		if hitObject, ok := hit.(map[string]any); ok && withPosition != nil {
+			withPosition(hitObject, position)
+		}
+	}
+
+	if skipped == 0 && withPosition == nil {
+		return responseBody, position, nil
+	}
+	hitsObject["hits"] = hits
+	if responseBody, err = json.Marshal(response); err != nil {
+		return nil, after, err
+	}
+	return responseBody, position, nil
+}
+
+func hitSortValues(hit any) []any {
+	if hitObject, ok := hit.(map[string]any); ok {
+		sortValues, _ := hitObject["sort"].([]any)
+		return sortValues
+	}
+	return nil
+}
+
+// keysetSortFields returns sort of the request without special fields like `_doc` or `_score`,
+// which can't be used for keyset pagination.
+func keysetSortFields(sortParam any) []any {
+	var sortFields []any
+	switch sortParam := sortParam.(type) {
+	case []any:
+		sortFields = sortParam
+	case nil:
+		return nil
+	default:
+		sortFields = []any{sortParam}
+	}
+
+	result := make([]any, 0, len(sortFields))
+	for _, sortField := range sortFields {
+		var fieldName string
+		switch sortField := sortField.(type) {
+		case string:
+			fieldName = sortField
+		case map[string]any:
+			for name := range sortField {
+				fieldName = name
+			}
+		}
+		if fieldName != "" && !strings.HasPrefix(fieldName, "_") {
+			result = append(result, sortField)
+		}
+	}
+	return result
+}
+
+// keysetTimestampField picks the field we paginate on, when the request doesn't say anything about it
+func keysetTimestampField(currentSchema schema.Schema, table *clickhouse.Table) (string, bool) {
+	if _, ok := currentSchema.ResolveField(model.TimestampFieldName); ok {
+		return model.TimestampFieldName, true
+	}
+	if table != nil && table.DiscoveredTimestampFieldName != nil {
+		if field, ok := currentSchema.ResolveFieldByInternalName(*table.DiscoveredTimestampFieldName); ok {
+			return field.PropertyName.AsString(), true
+		}
+	}
+
+	var dateFields []string
+	for name, field := range currentSchema.Fields {
+		if field.Type.Name == schema.QuesmaTypeDate.Name || field.Type.Name == schema.QuesmaTypeTimestamp.Name {
+			dateFields = append(dateFields, name.AsString())
+		}
+	}
+	if len(dateFields) == 0 {
+		return "", false
+	}
+	sort.Strings(dateFields)
+	return dateFields[0], true
+}
+
+func withScrollId(responseBody []byte, scrollId string) []byte {
+	return withLeadingResponseField(responseBody, "_scroll_id", scrollId)
+}
+
+// withLeadingResponseField adds a field at the beginning of the JSON response, without re-encoding the rest of it
+func withLeadingResponseField(responseBody []byte, name string, value string) []byte {
+	valueJson, _ := json.Marshal(value)
+	prefix := `{"` + name + `":` + string(valueJson)
+	rest := strings.TrimSpace(string(responseBody))
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "{"))
+	if rest == "}" || rest == "" {
+		return []byte(prefix + "}")
+	}
+	return []byte(prefix + "," + rest)
+}
@@ -0,0 +1,163 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestScroll(t *testing.T) {
+	fields := map[schema.FieldName]schema.Field{
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+	}
+	staticRegistry := schema.NewStaticRegistry(
+		map[schema.IndexName]schema.Schema{tableName: schema.NewSchema(fields, true, "")},
+		map[string]schema.Table{},
+		map[schema.FieldEncodingKey]schema.EncodedFieldName{},
+	)
+	tab := util.NewSyncMapWith(tableName, &clickhouse.Table{
+		Name:   tableName,
+		Config: clickhouse.NewChTableConfigTimestampStringAttr(),
+		Cols: map[string]*clickhouse.Column{
+			"message":    {Name: "message", Type: clickhouse.NewBaseType("String")},
+			"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+		},
+		Created: true,
+	})
+
+	someTime := time.Date(2024, 1, 29, 18, 11, 36, 491000000, time.UTC) // 1706551896491 in UnixMilli
+	add := func(seconds int) time.Time {
+		return someTime.Add(time.Second * time.Duration(seconds))
+	}
+
+	conn, mock := util.InitSqlMockWithPrettySqlAndPrint(t, false)
+	defer conn.Close()
+	db := backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	queryRunner := NewQueryRunnerDefaultForTests(db, &DefaultConfig, tableName, tab, staticRegistry)
+
+	// "m3" has the same timestamp as the last hit of the first page, so it's returned on the second one.
+	// Hits with the same timestamp which were already returned are skipped.
+	pages := []struct {
+		expectedSQL      string
+		resultRowsFromDB [][]any
+		expectedMessages []string
+	}{
+		{
+			expectedSQL:      `SELECT "@timestamp", "message" FROM __quesma_table_name ORDER BY "@timestamp" ASC LIMIT 2`,
+			resultRowsFromDB: [][]any{{add(0), "m1"}, {add(1), "m2"}},
+			expectedMessages: []string{"m1", "m2"},
+		},
+		{
+			expectedSQL:      `SELECT "@timestamp", "message" FROM __quesma_table_name WHERE "@timestamp">=fromUnixTimestamp64Milli(1706551897491) ORDER BY "@timestamp" ASC LIMIT 3`,
+			resultRowsFromDB: [][]any{{add(1), "m2"}, {add(1), "m3"}, {add(2), "m4"}},
+			expectedMessages: []string{"m3", "m4"},
+		},
+		{
+			expectedSQL:      `SELECT "@timestamp", "message" FROM __quesma_table_name WHERE "@timestamp">=fromUnixTimestamp64Milli(1706551898491) ORDER BY "@timestamp" ASC LIMIT 3`,
+			resultRowsFromDB: [][]any{{add(2), "m4"}, {add(2), "m5"}},
+			expectedMessages: []string{"m5"},
+		},
+		{
+			expectedSQL:      `SELECT "@timestamp", "message" FROM __quesma_table_name WHERE "@timestamp">=fromUnixTimestamp64Milli(1706551898491) ORDER BY "@timestamp" ASC LIMIT 4`,
+			resultRowsFromDB: [][]any{{add(2), "m4"}, {add(2), "m5"}},
+			expectedMessages: []string{},
+		},
+	}
+	for _, page := range pages {
+		rows := sqlmock.NewRows([]string{"@timestamp", "message"})
+		for _, row := range page.resultRowsFromDB {
+			rows.AddRow(row[0], row[1])
+		}
+		mock.ExpectQuery(page.expectedSQL).WillReturnRows(rows)
+	}
+
+	var scrollId string
+	for i, page := range pages {
+		var response []byte
+		var err error
+		if i == 0 {
+			response, err = queryRunner.HandleScrollSearch(ctx, tableName, types.MustJSON(`{"size": 2, "track_total_hits": false, "sort": ["_doc"]}`), "1m")
+		} else {
+			response, err = queryRunner.HandleScroll(ctx, scrollId, "")
+		}
+		require.NoError(t, err)
+
+		var responseMap model.JsonMap
+		require.NoError(t, json.Unmarshal(response, &responseMap))
+		if i == 0 {
+			scrollId = responseMap["_scroll_id"].(string)
+		}
+		assert.Equal(t, scrollId, responseMap["_scroll_id"])
+		messages := []string{}
+		for _, hit := range responseMap["hits"].(model.JsonMap)["hits"].([]any) {
+			messages = append(messages, hit.(model.JsonMap)["_source"].(model.JsonMap)["message"].(string))
+		}
+		assert.Equal(t, page.expectedMessages, messages)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("there were unfulfilled expections:", err)
+	}
+
+	assert.Equal(t, 1, queryRunner.ClearScroll([]string{scrollId}))
+	assert.Equal(t, 0, queryRunner.ClearScroll([]string{scrollId}))
+	_, err := queryRunner.HandleScroll(ctx, scrollId, "")
+	assert.True(t, errors.Is(err, errSearchContextMissing))
+}
+
+func TestScrollRequestValidation(t *testing.T) {
+	queryRunner := &QueryRunner{}
+	tests := []struct {
+		name      string
+		body      string
+		keepAlive string
+	}{
+		{"invalid keep alive", `{}`, "abc"},
+		{"too long keep alive", `{}`, "2d"},
+		{"from", `{"from": 10}`, "1m"},
+		{"search_after", `{"search_after": [1]}`, "1m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := queryRunner.HandleScrollSearch(ctx, tableName, types.MustJSON(tt.body), tt.keepAlive)
+			assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+		})
+	}
+}
+
+func TestKeysetSortFields(t *testing.T) {
+	tests := []struct {
+		sort     string
+		expected []any
+	}{
+		{`{"sort": null}`, nil},
+		{`{"sort": "_doc"}`, []any{}},
+		{`{"sort": ["_doc", {"_score": "desc"}]}`, []any{}},
+		{`{"sort": ["message", {"_doc": "asc"}]}`, []any{"message"}},
+		{`{"sort": [{"@timestamp": {"order": "desc"}}]}`, []any{map[string]any{"@timestamp": map[string]any{"order": "desc"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			assert.Equal(t, tt.expected, keysetSortFields(types.MustJSON(tt.sort)["sort"]))
+		})
+	}
+}
+
+func TestWithScrollId(t *testing.T) {
+	assert.Equal(t, `{"_scroll_id":"id","hits":{}}`, string(withScrollId([]byte(`{"hits":{}}`), "id")))
+	assert.Equal(t, `{"_scroll_id":"id"}`, string(withScrollId([]byte(`{}`), "id")))
+}
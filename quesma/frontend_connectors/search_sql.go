@@ -0,0 +1,161 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_sql"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/esql"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/QuesmaOrg/quesma/quesma/v2/core/tracing"
+	"time"
+)
+
+// This file contains handlers of query languages returning tabular results (columns and rows), not hits.
+
+// resolveClickhouseSource resolves index pattern to ClickHouse table and schema, and the filter of aliases
+// the indexes were matched by (nil if there is none), which has to be applied to queries
+func (q *QueryRunner) resolveClickhouseSource(indexPattern string) (*clickhouse.Table, schema.Schema, []string, map[string]any, error) {
+	decision := q.tableResolver.Resolve(quesma_api.QueryPipeline, indexPattern)
+	if decision.Err != nil {
+		return nil, schema.Schema{}, nil, nil, decision.Err
+	}
+	if decision.IsEmpty || decision.IsClosed {
+		return nil, schema.Schema{}, nil, nil, quesma_errors.ErrIndexNotExists()
+	}
+
+	for _, connector := range decision.UseConnectors {
+		if clickhouseConnector, ok := connector.(*quesma_api.ConnectorDecisionClickhouse); ok {
+			table, currentSchema, resolvedIndexes, err := q.loadTableAndSchema(clickhouseConnector)
+			if err != nil {
+				return nil, schema.Schema{}, nil, nil, err
+			}
+			if len(resolvedIndexes) == 0 {
+				return nil, schema.Schema{}, nil, nil, quesma_errors.ErrIndexNotExists()
+			}
+			aliasFilter, err := commonAliasFilter(resolvedIndexes, clickhouseConnector.AliasFilters)
+			if err != nil {
+				return nil, schema.Schema{}, nil, nil, err
+			}
+			return table, currentSchema, resolvedIndexes, aliasFilter, nil
+		}
+	}
+	return nil, schema.Schema{}, nil, nil, fmt.Errorf("index pattern [%s] is not handled by ClickHouse", indexPattern)
+}
+
+// runTabularQuery runs a single query, through the same transformations as queries of `_search`
+func (q *QueryRunner) runTabularQuery(ctx context.Context, table *clickhouse.Table, query *model.Query, body types.JSON) ([]model.QueryResultRow, error) {
+	plan := &model.ExecutionPlan{
+		Name:                  model.MainExecutionPlan,
+		Queries:               []*model.Query{query},
+		QueryRowsTransformers: make([]model.QueryRowsTransformer, 1),
+		StartTime:             time.Now(),
+	}
+	if err := q.transformQueries(plan); err != nil {
+		return nil, err
+	}
+
+	translatedQueryBody, results, err := q.searchWorkerCommon(ctx, plan, table)
+	if q.debugInfoCollector != nil {
+		contextValues := tracing.ExtractValues(ctx)
+		bodyAsBytes, _ := body.Bytes()
+		pushSecondaryInfo(q.debugInfoCollector, contextValues.RequestId, "", contextValues.RequestPath, bodyAsBytes, translatedQueryBody, nil, plan.StartTime)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results, err = q.postProcessResults(plan, results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// HandleSQL handles Elasticsearch SQL query (`_sql`), both the first page and the next ones (with `cursor`)
+func (q *QueryRunner) HandleSQL(ctx context.Context, body types.JSON) (*elastic_sql.Response, error) {
+	request, err := elastic_sql.ParseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := request.ParseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	table, currentSchema, indexes, aliasFilter, err := q.resolveClickhouseSource(statement.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	translator := &elastic_sql.ClickhouseSQLTranslator{Ctx: ctx, Schema: currentSchema, Table: table, Indexes: indexes, AliasFilter: aliasFilter}
+	query, err := translator.BuildQuery(statement, request)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.runTabularQuery(ctx, table, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return translator.MakeResponse(query, rows)
+}
+
+// HandleSQLTranslate returns Query DSL equivalent of Elasticsearch SQL query (`_sql/translate`)
+func (q *QueryRunner) HandleSQLTranslate(ctx context.Context, body types.JSON) (types.JSON, error) {
+	request, err := elastic_sql.ParseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := request.ParseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	// the translated query is run against the same indexes (or aliases), so their filters apply anyway
+	table, currentSchema, indexes, _, err := q.resolveClickhouseSource(statement.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	translator := &elastic_sql.ClickhouseSQLTranslator{Ctx: ctx, Schema: currentSchema, Table: table, Indexes: indexes}
+	return translator.Translate(statement, request)
+}
+
+// HandleESQL handles ES|QL query (`_query`)
+func (q *QueryRunner) HandleESQL(ctx context.Context, body types.JSON) (*esql.Response, error) {
+	request, err := esql.ParseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	parsedQuery, err := request.ParseQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	table, currentSchema, indexes, aliasFilter, err := q.resolveClickhouseSource(parsedQuery.IndexPattern())
+	if err != nil {
+		return nil, err
+	}
+
+	translator := &esql.ClickhouseESQLTranslator{Ctx: ctx, Schema: currentSchema, Table: table, Indexes: indexes, AliasFilter: aliasFilter}
+	query, err := translator.BuildQuery(parsedQuery, request)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.runTabularQuery(ctx, table, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return translator.MakeResponse(query, rows)
+}
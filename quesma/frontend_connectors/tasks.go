@@ -0,0 +1,152 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package frontend_connectors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Long-running requests (`_delete_by_query`, `_update_by_query` with `wait_for_completion=false`) are run as tasks,
+// and their progress and results can be checked with `GET /_tasks/:id`, like in Elasticsearch.
+// Tasks are kept in memory only, results of completed tasks are kept for taskResultRetention.
+
+const (
+	TaskIdPrefix        = "quesma:"
+	taskNodeName        = "quesma"
+	taskResultRetention = 24 * time.Hour
+)
+
+var errTaskMissing = errors.New("task isn't running and hasn't stored its results")
+
+type task struct {
+	id          int64
+	action      string
+	description string
+	startTime   time.Time
+
+	mu          sync.Mutex
+	status      any // action specific progress, e.g. byQueryStatus
+	completedAt time.Time
+	response    any
+	err         error
+}
+
+func (t *task) setStatus(status any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = status
+}
+
+func (t *task) complete(response any, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.response, t.err = response, err
+	t.completedAt = time.Now()
+}
+
+type taskInfo struct {
+	Node               string `json:"node"`
+	Id                 int64  `json:"id"`
+	Type               string `json:"type"`
+	Action             string `json:"action"`
+	Status             any    `json:"status,omitempty"`
+	Description        string `json:"description"`
+	StartTimeInMillis  int64  `json:"start_time_in_millis"`
+	RunningTimeInNanos int64  `json:"running_time_in_nanos"`
+	Cancellable        bool   `json:"cancellable"`
+}
+
+type taskResponse struct {
+	Completed bool       `json:"completed"`
+	Task      taskInfo   `json:"task"`
+	Response  any        `json:"response,omitempty"`
+	Error     types.JSON `json:"error,omitempty"`
+}
+
+func (t *task) toResponse(now time.Time) taskResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	completed := !t.completedAt.IsZero()
+	runningTime := now.Sub(t.startTime)
+	if completed {
+		runningTime = t.completedAt.Sub(t.startTime)
+	}
+	response := taskResponse{
+		Completed: completed,
+		Task: taskInfo{
+			Node:               taskNodeName,
+			Id:                 t.id,
+			Type:               "transport",
+			Action:             t.action,
+			Status:             t.status,
+			Description:        t.description,
+			StartTimeInMillis:  t.startTime.UnixMilli(),
+			RunningTimeInNanos: runningTime.Nanoseconds(),
+		},
+		Response: t.response,
+	}
+	if t.err != nil {
+		response.Error = types.JSON{"type": "exception", "reason": t.err.Error()}
+	}
+	return response
+}
+
+type TaskManager struct {
+	lastId atomic.Int64
+	mu     sync.Mutex
+	tasks  map[int64]*task
+}
+
+func NewTaskManager() *TaskManager {
+	return &TaskManager{tasks: make(map[int64]*task)}
+}
+
+// start registers a new running task, it also evicts results of tasks completed long ago
+func (m *TaskManager) start(action, description string) *task {
+	t := &task{id: m.lastId.Add(1), action: action, description: description, startTime: time.Now()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictCompleted(t.startTime)
+	m.tasks[t.id] = t
+	return t
+}
+
+func (m *TaskManager) evictCompleted(now time.Time) {
+	for id, t := range m.tasks {
+		t.mu.Lock()
+		expired := !t.completedAt.IsZero() && now.Sub(t.completedAt) > taskResultRetention
+		t.mu.Unlock()
+		if expired {
+			delete(m.tasks, id)
+		}
+	}
+}
+
+func (m *TaskManager) load(taskId string) (*task, error) {
+	number, found := strings.CutPrefix(taskId, TaskIdPrefix)
+	id, err := strconv.ParseInt(number, 10, 64)
+	if !found || err != nil {
+		return nil, fmt.Errorf("%w: [%s]", errTaskMissing, taskId)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", errTaskMissing, taskId)
+	}
+	return t, nil
+}
+
+func taskId(t *task) string {
+	return fmt.Sprintf("%s%d", TaskIdPrefix, t.id)
+}
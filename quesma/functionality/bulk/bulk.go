@@ -4,6 +4,7 @@ package bulk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
@@ -28,6 +29,8 @@ type (
 	BulkRequestEntry struct {
 		operation string
 		index     string
+		id        string // used only by `delete` and `update` for ClickHouse, `create` and `index` ignore it
+		pipeline  string // ingest pipeline given in the bulk entry, overrides the one from the request
 		document  types.JSON
 		response  *BulkItem
 	}
@@ -66,7 +69,7 @@ type (
 	}
 )
 
-func Write(ctx context.Context, defaultIndex *string, bulk types.NDJSON, ip *ingest.IngestProcessor,
+func Write(ctx context.Context, defaultIndex *string, defaultPipeline string, bulk types.NDJSON, ip *ingest.IngestProcessor,
 	ingestStatsEnabled bool, esBackendConn *backend_connectors.ElasticsearchBackendConnector, phoneHomeClient diag.PhoneHomeClient, tableResolver table_resolver.TableResolver) (results []BulkItem, err error) {
 	defer recovery.LogPanic()
 
@@ -103,7 +106,7 @@ func Write(ctx context.Context, defaultIndex *string, bulk types.NDJSON, ip *ing
 	}
 
 	if ip != nil {
-		sendToClickhouse(ctx, clickhouseBulkEntries, phoneHomeClient, ingestStatsEnabled, ip)
+		sendToClickhouse(ctx, clickhouseBulkEntries, defaultPipeline, phoneHomeClient, ingestStatsEnabled, ip)
 	}
 
 	// Here we filter out empty results so that final response does not contain empty elements
@@ -132,6 +135,8 @@ func SplitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, max
 		entryWithResponse := BulkRequestEntry{
 			operation: operation,
 			index:     index,
+			id:        op.GetId(),
+			pipeline:  op.GetPipeline(),
 			document:  document,
 			response:  &results[entryNumber],
 		}
@@ -179,6 +184,12 @@ func SplitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, max
 			case "index":
 				entryWithResponse.response.Index = bulkSingleResponse
 
+			case "update":
+				entryWithResponse.response.Update = bulkSingleResponse
+
+			case "delete":
+				entryWithResponse.response.Delete = bulkSingleResponse
+
 			default:
 				return fmt.Errorf("unsupported bulk operation type: %s. Document: %v", operation, document)
 			}
@@ -210,7 +221,7 @@ func SplitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, max
 			case *quesma_api.ConnectorDecisionClickhouse:
 
 				// Bulk entry for Clickhouse
-				if operation != "create" && operation != "index" {
+				if operation != "create" && operation != "index" && operation != "update" && operation != "delete" {
 					// Elastic also fails the entire bulk in such case
 					logger.ErrorWithCtxAndReason(ctx, "unsupported bulk operation type").Msgf("unsupported bulk operation type: %s", operation)
 					return fmt.Errorf("unsupported bulk operation type: %s. Operation: %v, Document: %v", operation, rawOp, document)
@@ -266,69 +277,285 @@ func sendToElastic(elasticRequestBody []byte, esBackendConn *backend_connectors.
 	return nil
 }
 
-func sendToClickhouse(ctx context.Context, clickhouseBulkEntries map[string][]BulkRequestEntry, emptyPhoneHomeClient diag.PhoneHomeClient, ingestStatsEnabled bool, ip *ingest.IngestProcessor) {
+// sendToClickhouse applies operations of each index in the bulk order: consecutive `create` and `index` operations
+// are inserted together, consecutive `delete` and `update` operations are applied together with one mutation,
+// so deletes and updates see the documents inserted before them in the same bulk, but not those inserted after.
+func sendToClickhouse(ctx context.Context, clickhouseBulkEntries map[string][]BulkRequestEntry, defaultPipeline string, emptyPhoneHomeClient diag.PhoneHomeClient, ingestStatsEnabled bool, ip *ingest.IngestProcessor) {
 	for indexName, documents := range clickhouseBulkEntries {
 		emptyPhoneHomeClient.IngestCounters().Add(indexName, int64(len(documents)))
 
-		for _, document := range documents {
-			stats.GlobalStatistics.Process(ingestStatsEnabled, indexName, document.document, clickhouse.NestedSeparator)
+		for start := 0; start < len(documents); {
+			mutation := isMutation(documents[start])
+			end := start + 1
+			for end < len(documents) && isMutation(documents[end]) == mutation {
+				end++
+			}
+			if mutation {
+				mutateDocuments(ctx, indexName, documents[start:end], defaultPipeline, ingestStatsEnabled, ip)
+			} else {
+				insertDocuments(ctx, indexName, documents[start:end], defaultPipeline, ingestStatsEnabled, ip)
+			}
+			start = end
+		}
+	}
+}
+
+func isMutation(document BulkRequestEntry) bool {
+	return document.operation == "update" || document.operation == "delete"
+}
+
+func insertDocuments(ctx context.Context, indexName string, documents []BulkRequestEntry, defaultPipeline string, ingestStatsEnabled bool, ip *ingest.IngestProcessor) {
+	// documents failed in the ingest pipeline are not inserted, they get their own error response
+	pipelineErrors := make([]error, len(documents))
+	inserts := make([]types.JSON, 0, len(documents))
+	for i, document := range documents {
+		transformed, err := applyPipeline(ctx, ip, indexName, document, defaultPipeline, ingestStatsEnabled)
+		if err != nil {
+			pipelineErrors[i] = err
+			continue
+		}
+		inserts = append(inserts, transformed)
+	}
+
+	var err error
+	if len(inserts) > 0 {
+		err = ip.Ingest(ctx, indexName, inserts)
+	}
+
+	for i, document := range documents {
+		bulkSingleResponse := BulkSingleResponse{
+			ID:          "fakeId",
+			Index:       document.index,
+			PrimaryTerm: 1,
+			SeqNo:       0,
+			Shards: BulkShardsResponse{
+				Failed:     0,
+				Successful: 1,
+				Total:      1,
+			},
+			Version: 0,
+			Result:  "created",
+			Status:  201,
+			Type:    "_doc",
 		}
 
-		inserts := make([]types.JSON, len(documents))
-		for i, document := range documents {
-			inserts[i] = document.document
+		if pipelineErrors[i] != nil {
+			bulkSingleResponse.setError("illegal_argument_exception", pipelineErrors[i])
+		} else if err != nil {
+			bulkSingleResponse.setIngestError(err)
 		}
 
-		err := ip.Ingest(ctx, indexName, inserts)
+		// Fill out the response pointer (a pointer to the results array we will return for a bulk)
+		switch document.operation {
+		case "create":
+			document.response.Create = bulkSingleResponse
 
-		for _, document := range documents {
-			bulkSingleResponse := BulkSingleResponse{
-				ID:          "fakeId",
-				Index:       document.index,
-				PrimaryTerm: 1,
-				SeqNo:       0,
-				Shards: BulkShardsResponse{
-					Failed:     0,
-					Successful: 1,
-					Total:      1,
-				},
-				Version: 0,
-				Result:  "created",
-				Status:  201,
-				Type:    "_doc",
+		case "index":
+			document.response.Index = bulkSingleResponse
+
+		default:
+			logger.Error().Msgf("unsupported bulk operation type: %s. Document: %v", document.operation, document.document)
+		}
+	}
+}
+
+// applyPipeline runs the ingest pipeline, documents it rejects are stored in the dead letter queue
+func applyPipeline(ctx context.Context, ip *ingest.IngestProcessor, indexName string, document BulkRequestEntry, defaultPipeline string, ingestStatsEnabled bool) (types.JSON, error) {
+	pipeline := document.pipeline
+	if pipeline == "" {
+		pipeline = defaultPipeline
+	}
+	original := document.document
+	if ip.DeadLetterQueueEnabled() {
+		// pipelines modify documents in place
+		original = original.Clone()
+	}
+	transformed, err := ip.ApplyPipeline(indexName, pipeline, document.document)
+	if err != nil {
+		ip.CaptureDeadLetters(ctx, indexName, ingest.DeadLetterStagePipeline, pipeline, err, original)
+		return nil, err
+	}
+	stats.GlobalStatistics.Process(ingestStatsEnabled, indexName, transformed, clickhouse.NestedSeparator)
+	return transformed, nil
+}
+
+func newMutationResponse(document BulkRequestEntry) BulkSingleResponse {
+	return BulkSingleResponse{
+		ID:          document.id,
+		Index:       document.index,
+		PrimaryTerm: 1,
+		Shards: BulkShardsResponse{
+			Failed:     0,
+			Successful: 1,
+			Total:      1,
+		},
+		Version: 1,
+		Type:    "_doc",
+	}
+}
+
+// newDocumentMutation validates a `delete` or `update` operation, it returns the type of the error if it's invalid.
+// Only partial updates (`doc`) are supported, scripts are not.
+func newDocumentMutation(document BulkRequestEntry) (mutation ingest.DocumentMutation, errorType string, err error) {
+	if document.id == "" {
+		return mutation, "action_request_validation_exception", errors.New("Validation Failed: 1: id is missing;")
+	}
+	mutation.Id = document.id
+	if document.operation == "delete" {
+		return mutation, "", nil
+	}
+	if _, ok := document.document["script"]; ok {
+		return mutation, "illegal_argument_exception", errors.New("scripted updates are not supported in _bulk, use _update_by_query instead")
+	}
+	partialDocument, ok := document.document["doc"].(map[string]any)
+	if !ok {
+		return mutation, "action_request_validation_exception", errors.New("Validation Failed: 1: script or doc is missing;")
+	}
+	mutation.PartialDocument = partialDocument
+	return mutation, "", nil
+}
+
+// mutateDocuments applies consecutive `delete` and `update` operations, updates of missing documents with
+// an upsert (`doc_as_upsert` or `upsert`) insert the upsert document after that
+func mutateDocuments(ctx context.Context, indexName string, documents []BulkRequestEntry, defaultPipeline string, ingestStatsEnabled bool, ip *ingest.IngestProcessor) {
+	responses := make([]BulkSingleResponse, len(documents))
+	var mutations []ingest.DocumentMutation
+	var mutated []int // index of the document of each mutation
+	for i, document := range documents {
+		responses[i] = newMutationResponse(document)
+		mutation, errorType, err := newDocumentMutation(document)
+		if err != nil {
+			responses[i].setError(errorType, err)
+			continue
+		}
+		mutations = append(mutations, mutation)
+		mutated = append(mutated, i)
+	}
+
+	var upserts []types.JSON
+	var upserted []int // index of the document of each upsert
+	for j, result := range ip.MutateDocuments(ctx, indexName, mutations) {
+		i := mutated[j]
+		document, response := documents[i], &responses[i]
+		switch {
+		case errors.Is(result.Err, ingest.ErrAmbiguousDocumentId):
+			response.setConflict(result.Err)
+		case result.Err != nil && document.operation == "delete":
+			response.setError("quesma_error", result.Err)
+		case result.Err != nil:
+			response.setError("illegal_argument_exception", result.Err)
+		case result.Found && document.operation == "delete":
+			response.Result = "deleted"
+			response.Status = http.StatusOK
+		case result.Found:
+			response.Result = "updated"
+			response.Status = http.StatusOK
+		case document.operation == "delete":
+			response.Result = "not_found"
+			response.Status = http.StatusNotFound
+		default:
+			var upsert types.JSON
+			if docAsUpsert, _ := document.document["doc_as_upsert"].(bool); docAsUpsert {
+				upsert = mutations[j].PartialDocument
+			} else if upsertDocument, ok := document.document["upsert"].(map[string]any); ok {
+				upsert = upsertDocument
+			} else {
+				response.setError("document_missing_exception", fmt.Errorf("[%s]: document missing", document.id))
+				response.Status = http.StatusNotFound
+				continue
 			}
 
+			document.document = upsert
+			transformed, err := applyPipeline(ctx, ip, indexName, document, defaultPipeline, ingestStatsEnabled)
 			if err != nil {
-				bulkSingleResponse.Result = ""
-				bulkSingleResponse.Status = 400
-				bulkSingleResponse.Shards = BulkShardsResponse{
-					Failed:     1,
-					Successful: 0,
-					Total:      1,
-				}
-				bulkSingleResponse.Error = elastic_query_dsl.Error{
-					RootCause: []elastic_query_dsl.RootCause{
-						{
-							Type:   "quesma_error",
-							Reason: err.Error(),
-						},
-					},
-					Type:   "quesma_error",
-					Reason: err.Error(),
-				}
+				response.setError("illegal_argument_exception", err)
+				continue
 			}
+			upserts = append(upserts, transformed)
+			upserted = append(upserted, i)
+		}
+	}
 
-			// Fill out the response pointer (a pointer to the results array we will return for a bulk)
-			switch document.operation {
-			case "create":
-				document.response.Create = bulkSingleResponse
+	if len(upserts) > 0 {
+		err := ip.Ingest(ctx, indexName, upserts)
+		for _, i := range upserted {
+			if err != nil {
+				responses[i].setIngestError(err)
+			} else {
+				responses[i].Result = "created"
+				responses[i].Status = http.StatusCreated
+			}
+		}
+	}
 
-			case "index":
-				document.response.Index = bulkSingleResponse
+	for i, document := range documents {
+		if document.operation == "delete" {
+			document.response.Delete = responses[i]
+		} else {
+			document.response.Update = responses[i]
+		}
+	}
+}
 
-			default:
-				logger.Error().Msgf("unsupported bulk operation type: %s. Document: %v", document.operation, document.document)
+// IsRejected tells whether the operation was rejected because the ingest buffer was full, so it can be retried
+func (item BulkItem) IsRejected() bool {
+	for _, response := range []any{item.Create, item.Index, item.Update, item.Delete} {
+		if response, ok := response.(BulkSingleResponse); ok && response.Status == http.StatusTooManyRequests {
+			return true
+		}
+	}
+	return false
+}
+
+// HasError tells whether the operation failed, Elastic sets `errors` of the bulk response if any of them did
+func (item BulkItem) HasError() bool {
+	for _, response := range []any{item.Create, item.Index, item.Update, item.Delete} {
+		switch response := response.(type) {
+		case BulkSingleResponse:
+			if response.Error != nil {
+				return true
+			}
+		case map[string]any:
+			if _, ok := response["error"]; ok {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+func (r *BulkSingleResponse) setError(errorType string, err error) {
+	r.Result = ""
+	r.Status = 400
+	r.Shards = BulkShardsResponse{
+		Failed:     1,
+		Successful: 0,
+		Total:      1,
+	}
+	r.Error = elastic_query_dsl.Error{
+		RootCause: []elastic_query_dsl.RootCause{
+			{
+				Type:   errorType,
+				Reason: err.Error(),
+			},
+		},
+		Type:   errorType,
+		Reason: err.Error(),
+	}
+}
+
+// setConflict refuses to change a document, whose id matches more documents
+func (r *BulkSingleResponse) setConflict(err error) {
+	r.setError("version_conflict_engine_exception", err)
+	r.Status = http.StatusConflict
+}
+
+// setIngestError reports documents rejected by a full ingest buffer the way Elasticsearch reports a full write queue
+func (r *BulkSingleResponse) setIngestError(err error) {
+	if errors.Is(err, ingest.ErrIngestBufferFull) {
+		r.setError("es_rejected_execution_exception", err)
+		r.Status = http.StatusTooManyRequests
+		return
+	}
+	r.setError("quesma_error", err)
 }
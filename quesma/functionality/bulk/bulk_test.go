@@ -4,6 +4,7 @@ package bulk
 
 import (
 	"context"
+	"errors"
 	"github.com/QuesmaOrg/quesma/quesma/config"
 	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
 	"github.com/QuesmaOrg/quesma/quesma/types"
@@ -223,3 +224,58 @@ func TestSplitBulkMixedPayload(t *testing.T) {
 	assert.NotEmpty(t, elasticRequestBody)
 	assert.Len(t, elasticBulkEntries, 4)
 }
+
+func TestSplitBulkPipeline(t *testing.T) {
+	ctx := context.Background()
+	defaultIndex := ""
+	var payload = `{"create":{"_index":"kibana_sample_data_ecommerce","pipeline":"parse_orders"}}
+{"message":"order 1"}
+{"create":{"_index":"kibana_sample_data_ecommerce"}}
+{"message":"order 2"}
+`
+	bulk, err := types.ExpectNDJSON(types.ParseRequestBody(payload))
+	if err != nil {
+		t.Errorf("error while parsing ndjson: %v", err)
+	}
+
+	_, clickhouseBulkEntries, _, _, err := SplitBulk(ctx, &defaultIndex, bulk, len(bulk), testTableResolver)
+
+	assert.NoError(t, err)
+	entries := clickhouseBulkEntries["kibana_sample_data_ecommerce"]
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "parse_orders", entries[0].pipeline)
+	assert.Equal(t, "", entries[1].pipeline)
+}
+
+func TestSplitBulkClickhouseDeleteAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	defaultIndex := ""
+	var payload = `{"delete":{"_index":"kibana_sample_data_ecommerce","_id":"1"}}
+{"update":{"_index":"kibana_sample_data_ecommerce","_id":"2"}}
+{"doc":{"status":"shipped"},"doc_as_upsert":true}
+`
+	bulk, err := types.ExpectNDJSON(types.ParseRequestBody(payload))
+	if err != nil {
+		t.Errorf("error while parsing ndjson: %v", err)
+	}
+
+	_, clickhouseBulkEntries, elasticRequestBody, _, err := SplitBulk(ctx, &defaultIndex, bulk, len(bulk), testTableResolver)
+
+	assert.NoError(t, err)
+	assert.Empty(t, elasticRequestBody)
+	entries := clickhouseBulkEntries["kibana_sample_data_ecommerce"]
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "delete", entries[0].operation)
+	assert.Equal(t, "1", entries[0].id)
+	assert.Equal(t, "update", entries[1].operation)
+	assert.Equal(t, "2", entries[1].id)
+}
+
+func TestBulkItemHasError(t *testing.T) {
+	failed := BulkSingleResponse{}
+	failed.setError("quesma_error", errors.New("failed"))
+
+	assert.False(t, BulkItem{Delete: BulkSingleResponse{Result: "not_found", Status: 404}}.HasError())
+	assert.True(t, BulkItem{Update: failed}.HasError())
+	assert.True(t, BulkItem{Index: map[string]any{"error": map[string]any{"type": "mapper_parsing_exception"}}}.HasError())
+}
@@ -139,6 +139,8 @@ func asElasticType(t schema.QuesmaType) string {
 		return elasticsearch_field_types.FieldTypeIp
 	case schema.QuesmaTypeObject.Name:
 		return elasticsearch_field_types.FieldTypeObject
+	case schema.QuesmaTypeNested.Name:
+		return elasticsearch_field_types.FieldTypeNested
 	case schema.QuesmaTypePoint.Name:
 		return elasticsearch_field_types.FieldTypeGeoPoint
 	case schema.QuesmaTypeInteger.Name:
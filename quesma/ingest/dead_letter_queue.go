@@ -0,0 +1,448 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	quesma_api "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dead letter queue (the `deadLetterQueue` option of the ingest processor) stores documents rejected during ingest,
+// so they can be audited and replayed, e.g. after fixing the mapping. Documents are stored either in a ClickHouse table
+// or in a local file, together with the index, the stage which rejected them and the reason.
+//
+// Documents rejected by the ingest pipeline are stored as they were sent. Documents rejected later are stored as they
+// were after the pipeline, so replaying them skips it. Letters of the validation stage are informational,
+// their documents are inserted with the invalid fields in attributes, so they aren't replayed.
+
+const (
+	DeadLetterStagePipeline   = stats.DeadLetterStagePipeline
+	DeadLetterStageValidation = stats.DeadLetterStageValidation
+	DeadLetterStageInsert     = stats.DeadLetterStageInsert
+)
+
+// maxDeadLettersReplayed limits how many documents are replayed at once
+const maxDeadLettersReplayed = 10000
+
+type DeadLetter struct {
+	Id        string    `json:"id"`
+	Timestamp time.Time `json:"@timestamp"`
+	Index     string    `json:"index"`
+	Stage     string    `json:"stage"`
+	Reason    string    `json:"reason"`
+	Pipeline  string    `json:"pipeline"` // pipeline applied when the document is replayed, "" means the default pipeline of the index
+	Document  string    `json:"document"` // the rejected document as JSON
+}
+
+type deadLetterSink interface {
+	store(ctx context.Context, letters []DeadLetter) error
+	// list returns the oldest letters of the index, or of all indexes if index is ""
+	list(ctx context.Context, index string, size int) ([]DeadLetter, error)
+	delete(ctx context.Context, ids []string) error
+}
+
+func newDeadLetterSink(cfg *config.DeadLetterQueueConfiguration, chDb quesma_api.BackendConnector) deadLetterSink {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Type == config.DeadLetterQueueFile {
+		return &fileDeadLetterSink{path: cfg.Path}
+	}
+	return &clickhouseDeadLetterSink{chDb: chDb, tableName: cfg.Table()}
+}
+
+type deadLetterReplayKey struct{}
+
+func (ip *IngestProcessor) DeadLetterQueueEnabled() bool {
+	return ip.deadLetters != nil
+}
+
+// CaptureDeadLetters stores rejected documents in the dead letter queue, if it's enabled.
+// Documents rejected while replaying dead letters aren't stored again, they stay in the queue.
+func (ip *IngestProcessor) CaptureDeadLetters(ctx context.Context, index, stage, pipeline string, reason error, documents ...types.JSON) {
+	if ip.deadLetters == nil || len(documents) == 0 || ctx.Value(deadLetterReplayKey{}) != nil {
+		return
+	}
+	now := time.Now()
+	letters := make([]DeadLetter, 0, len(documents))
+	for _, document := range documents {
+		documentBytes, err := document.Bytes()
+		if err != nil {
+			logger.WarnWithCtx(ctx).Msgf("could not serialize a document rejected by index %s: %v", index, err)
+			stats.GlobalDeadLetters.AddLost(index, 1)
+			continue
+		}
+		letters = append(letters, DeadLetter{
+			Id:        uuid.NewString(),
+			Timestamp: now,
+			Index:     index,
+			Stage:     stage,
+			Reason:    reason.Error(),
+			Pipeline:  pipeline,
+			Document:  string(documentBytes),
+		})
+	}
+	if err := ip.deadLetters.store(ctx, letters); err != nil {
+		logger.ErrorWithCtx(ctx).Msgf("could not store %d documents rejected by index %s in the dead letter queue: %v", len(letters), index, err)
+		stats.GlobalDeadLetters.AddLost(index, int64(len(letters)))
+		return
+	}
+	stats.GlobalDeadLetters.AddStored(index, stage, int64(len(letters)))
+}
+
+// invalidDocument is a document inserted with fields, which failed validation, stored in attributes
+type invalidDocument struct {
+	index    string
+	reason   error
+	original types.JSON
+}
+
+// invalidDocuments returns documents, whose fields failed validation, originals are documents before field encoding.
+// They're captured with captureInvalidDocuments after the insert, so documents of a failed insert are captured once, in the insert stage.
+func invalidDocuments(tableName string, originals, transformedJsons, invalidJsons []types.JSON) []invalidDocument {
+	var documents []invalidDocument
+	for i, invalidJson := range invalidJsons {
+		if len(invalidJson) == 0 || i >= len(originals) {
+			continue
+		}
+		index := tableName
+		if tableName == common_table.TableName {
+			if indexName, ok := transformedJsons[i][common_table.IndexNameColumn].(string); ok {
+				index = indexName
+			}
+		}
+		fields := make([]string, 0, len(invalidJson))
+		for field := range invalidJson {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		reason := fmt.Errorf("fields [%s] don't match types of their columns, they were stored in attributes", strings.Join(fields, ", "))
+		documents = append(documents, invalidDocument{index: index, reason: reason, original: originals[i]})
+	}
+	return documents
+}
+
+func (ip *IngestProcessor) captureInvalidDocuments(ctx context.Context, documents []invalidDocument) {
+	for _, document := range documents {
+		ip.CaptureDeadLetters(ctx, document.index, DeadLetterStageValidation, NoPipeline, document.reason, document.original)
+	}
+}
+
+// cloneForDeadLetters keeps copies of documents, as ingest modifies them in place
+func (ip *IngestProcessor) cloneForDeadLetters(jsonData []types.JSON) []types.JSON {
+	if ip.deadLetters == nil {
+		return nil
+	}
+	clones := make([]types.JSON, 0, len(jsonData))
+	for _, document := range jsonData {
+		clones = append(clones, document.Clone())
+	}
+	return clones
+}
+
+// ListDeadLetters returns the oldest dead letters of the index, "_all" lists all indexes
+func (ip *IngestProcessor) ListDeadLetters(ctx context.Context, index string, size int) ([]DeadLetter, error) {
+	if ip.deadLetters == nil {
+		return nil, fmt.Errorf("dead letter queue is not enabled")
+	}
+	if index == "_all" {
+		index = ""
+	}
+	return ip.deadLetters.list(ctx, index, size)
+}
+
+// DeleteDeadLetters removes dead letters of the index, all of them if ids are empty
+func (ip *IngestProcessor) DeleteDeadLetters(ctx context.Context, index string, ids []string) (int, error) {
+	letters, err := ip.selectDeadLetters(ctx, index, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(letters) == 0 {
+		return 0, nil
+	}
+	return len(letters), ip.deadLetters.delete(ctx, deadLetterIds(letters))
+}
+
+type DeadLetterReplay struct {
+	Replayed int      `json:"replayed"`
+	Failed   int      `json:"failed"`
+	Skipped  int      `json:"skipped"` // letters of the validation stage, their documents are already inserted
+	Failures []string `json:"failures"`
+}
+
+// ReplayDeadLetters ingests dead letters of the index again, all of them if ids are empty.
+// Replayed letters are removed from the queue, letters failing again stay there.
+// Letters of the validation stage stay in the queue until they're deleted, replaying them would duplicate their documents.
+func (ip *IngestProcessor) ReplayDeadLetters(ctx context.Context, index string, ids []string) (DeadLetterReplay, error) {
+	replay := DeadLetterReplay{Failures: []string{}}
+	letters, err := ip.selectDeadLetters(ctx, index, ids)
+	if err != nil {
+		return replay, err
+	}
+
+	ctx = context.WithValue(ctx, deadLetterReplayKey{}, true)
+	byIndex := make(map[string][]DeadLetter)
+	var indexes []string
+	for _, letter := range letters {
+		if letter.Stage == DeadLetterStageValidation {
+			replay.Skipped++
+			continue
+		}
+		if _, ok := byIndex[letter.Index]; !ok {
+			indexes = append(indexes, letter.Index)
+		}
+		byIndex[letter.Index] = append(byIndex[letter.Index], letter)
+	}
+
+	for _, indexName := range indexes {
+		var documents []types.JSON
+		var replayed []DeadLetter
+		for _, letter := range byIndex[indexName] {
+			document, err := types.ParseJSON(letter.Document)
+			if err == nil {
+				document, err = ip.ApplyPipeline(indexName, letter.Pipeline, document)
+			}
+			if err != nil {
+				replay.Failed++
+				replay.Failures = append(replay.Failures, fmt.Sprintf("%s: %v", letter.Id, err))
+				continue
+			}
+			documents = append(documents, document)
+			replayed = append(replayed, letter)
+		}
+		if len(documents) == 0 {
+			continue
+		}
+		// replayed documents skip the ingest buffer, so their result is known
+		if err = ip.ingest(ctx, indexName, documents); err != nil {
+			replay.Failed += len(replayed)
+			replay.Failures = append(replay.Failures, fmt.Sprintf("index %s: %v", indexName, err))
+			continue
+		}
+		if err = ip.deadLetters.delete(ctx, deadLetterIds(replayed)); err != nil {
+			// documents are already ingested, so they would be duplicated by the next replay
+			logger.ErrorWithCtx(ctx).Msgf("could not remove replayed documents of index %s from the dead letter queue: %v", indexName, err)
+		}
+		replay.Replayed += len(replayed)
+		stats.GlobalDeadLetters.AddReplayed(indexName, int64(len(replayed)))
+	}
+	return replay, nil
+}
+
+func (ip *IngestProcessor) selectDeadLetters(ctx context.Context, index string, ids []string) ([]DeadLetter, error) {
+	letters, err := ip.ListDeadLetters(ctx, index, maxDeadLettersReplayed)
+	if err != nil || len(ids) == 0 {
+		return letters, err
+	}
+	selectedIds := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selectedIds[id] = true
+	}
+	var selected []DeadLetter
+	for _, letter := range letters {
+		if selectedIds[letter.Id] {
+			selected = append(selected, letter)
+		}
+	}
+	return selected, nil
+}
+
+func deadLetterIds(letters []DeadLetter) []string {
+	ids := make([]string, 0, len(letters))
+	for _, letter := range letters {
+		ids = append(ids, letter.Id)
+	}
+	return ids
+}
+
+// clickhouseDeadLetterSink stores dead letters in a ClickHouse table, created when it's used for the first time
+type clickhouseDeadLetterSink struct {
+	chDb         quesma_api.BackendConnector
+	tableName    string
+	m            sync.Mutex
+	tableCreated bool
+}
+
+func (s *clickhouseDeadLetterSink) ensureTable(ctx context.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.tableCreated {
+		return nil
+	}
+	ddl := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ("id" String, "@timestamp" DateTime64(3), "index" LowCardinality(String), `+
+		`"stage" LowCardinality(String), "reason" String, "pipeline" String, "document" String) `+
+		`ENGINE = MergeTree ORDER BY ("index", "@timestamp") COMMENT 'Quesma managed. Documents rejected during ingest.'`, strconv.Quote(s.tableName))
+	if err := s.chDb.Exec(ctx, ddl); err != nil {
+		return err
+	}
+	s.tableCreated = true
+	return nil
+}
+
+func (s *clickhouseDeadLetterSink) store(ctx context.Context, letters []DeadLetter) error {
+	if err := s.ensureTable(ctx); err != nil {
+		return err
+	}
+	rows := make([]string, 0, len(letters))
+	for _, letter := range letters {
+		row, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, string(row))
+	}
+	insert := fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow %s", strconv.Quote(s.tableName), strings.Join(rows, ", "))
+	return s.chDb.Exec(clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"date_time_input_format": "best_effort"})), insert)
+}
+
+func (s *clickhouseDeadLetterSink) list(ctx context.Context, index string, size int) ([]DeadLetter, error) {
+	if err := s.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	var where string
+	if index != "" {
+		where = ` WHERE "index" = ` + model.AsString(model.NewLiteralSingleQuoteString(index))
+	}
+	query := fmt.Sprintf(`SELECT "id", "@timestamp", "index", "stage", "reason", "pipeline", "document" FROM %s%s ORDER BY "@timestamp" LIMIT %d`,
+		strconv.Quote(s.tableName), where, size)
+	rows, err := s.chDb.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: query failed: %v", err)
+	}
+	defer rows.Close()
+	letters := []DeadLetter{}
+	for rows.Next() {
+		var letter DeadLetter
+		if err = rows.Scan(&letter.Id, &letter.Timestamp, &letter.Index, &letter.Stage, &letter.Reason, &letter.Pipeline, &letter.Document); err != nil {
+			return nil, fmt.Errorf("clickhouse: scan failed: %v", err)
+		}
+		letters = append(letters, letter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("clickhouse: reading rows failed: %v", err)
+	}
+	return letters, nil
+}
+
+func (s *clickhouseDeadLetterSink) delete(ctx context.Context, ids []string) error {
+	quoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quoted = append(quoted, model.AsString(model.NewLiteralSingleQuoteString(id)))
+	}
+	statement := fmt.Sprintf(`DELETE FROM %s WHERE "id" IN (%s)`, strconv.Quote(s.tableName), strings.Join(quoted, ", "))
+	return s.chDb.Exec(ctx, statement)
+}
+
+// fileDeadLetterSink stores dead letters in a local file, one JSON document per line
+type fileDeadLetterSink struct {
+	path string
+	m    sync.Mutex
+}
+
+func (s *fileDeadLetterSink) store(_ context.Context, letters []DeadLetter) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, letter := range letters {
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileDeadLetterSink) readAll() ([]DeadLetter, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	letters := []DeadLetter{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err = json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return nil, fmt.Errorf("corrupted dead letter queue file %s: %v", s.path, err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, scanner.Err()
+}
+
+func (s *fileDeadLetterSink) list(_ context.Context, index string, size int) ([]DeadLetter, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	letters, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	result := []DeadLetter{}
+	for _, letter := range letters {
+		if len(result) == size {
+			break
+		}
+		if index == "" || letter.Index == index {
+			result = append(result, letter)
+		}
+	}
+	return result, nil
+}
+
+// delete rewrites the file without the letters, the file is replaced atomically
+func (s *fileDeadLetterSink) delete(_ context.Context, ids []string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	letters, err := s.readAll()
+	if err != nil {
+		return err
+	}
+	deletedIds := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		deletedIds[id] = true
+	}
+	var content []byte
+	for _, letter := range letters {
+		if deletedIds[letter.Id] {
+			continue
+		}
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		content = append(append(content, line...), '\n')
+	}
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
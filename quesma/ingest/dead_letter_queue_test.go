@@ -0,0 +1,171 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newDeadLetterTestProcessor(t *testing.T, indexName string, sink deadLetterSink) (*IngestProcessor, sqlmock.Sqlmock) {
+	tables := util.NewSyncMapWith(indexName, &clickhouse.Table{
+		Name: indexName,
+		Cols: map[string]*clickhouse.Column{
+			"message": {Name: "message", Type: clickhouse.NewBaseType("String")},
+			"count":   {Name: "count", Type: clickhouse.NewBaseType("Int64")},
+		},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	})
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: indexName, ClickhouseIndexes: []string{indexName}}},
+	}
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.tableResolver = resolver
+	ip.deadLetters = sink
+	return ip, mock
+}
+
+func TestDeadLetterQueueCaptureAndReplay(t *testing.T) {
+	const indexName = "dlq_logs"
+	ip, mock := newDeadLetterTestProcessor(t, indexName, &fileDeadLetterSink{path: filepath.Join(t.TempDir(), "dead_letters.ndjson")})
+	ctx := context.Background()
+
+	// a failed insert stores the documents as they were before ingest
+	mock.ExpectExec(`INSERT INTO "dlq_logs"`).WillReturnError(errors.New("connection refused"))
+	require.Error(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "hello"}}))
+
+	// fields not matching their columns are stored in attributes, and the document in the dead letter queue
+	mock.ExpectExec(`INSERT INTO "dlq_logs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "world", "count": "many"}}))
+
+	ip.CaptureDeadLetters(ctx, "other", DeadLetterStagePipeline, "my-pipeline", errors.New("field [x] not present"), types.JSON{"x": nil})
+
+	letters, err := ip.ListDeadLetters(ctx, indexName, 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, DeadLetterStageInsert, letters[0].Stage)
+	assert.Equal(t, `{"message":"hello"}`, letters[0].Document)
+	assert.Contains(t, letters[0].Reason, "connection refused")
+	assert.Equal(t, DeadLetterStageValidation, letters[1].Stage)
+	assert.Equal(t, `{"count":"many","message":"world"}`, letters[1].Document)
+	assert.Equal(t, "fields [count] don't match types of their columns, they were stored in attributes", letters[1].Reason)
+
+	all, err := ip.ListDeadLetters(ctx, "_all", 10)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	// documents failing again stay in the queue, and aren't duplicated
+	mock.ExpectExec(`INSERT INTO "dlq_logs"`).WillReturnError(errors.New("connection refused"))
+	replay, err := ip.ReplayDeadLetters(ctx, indexName, []string{letters[0].Id})
+	require.NoError(t, err)
+	assert.Equal(t, 0, replay.Replayed)
+	assert.Equal(t, 1, replay.Failed)
+	letters, err = ip.ListDeadLetters(ctx, indexName, 10)
+	require.NoError(t, err)
+	assert.Len(t, letters, 2)
+
+	// documents of the validation stage are already inserted, so they aren't replayed
+	mock.ExpectExec(`INSERT INTO "dlq_logs" FORMAT JSONEachRow {"message":"hello"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	replay, err = ip.ReplayDeadLetters(ctx, indexName, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DeadLetterReplay{Replayed: 1, Skipped: 1, Failures: []string{}}, replay)
+	letters, err = ip.ListDeadLetters(ctx, indexName, 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, DeadLetterStageValidation, letters[0].Stage)
+
+	replay, err = ip.ReplayDeadLetters(ctx, indexName, []string{letters[0].Id})
+	require.NoError(t, err)
+	assert.Equal(t, DeadLetterReplay{Skipped: 1, Failures: []string{}}, replay)
+	deleted, err := ip.DeleteDeadLetters(ctx, indexName, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	deleted, err = ip.DeleteDeadLetters(ctx, "other", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	var counters stats.DeadLetterStatistics
+	for _, statistics := range stats.GlobalDeadLetters.Sorted() {
+		if statistics.Index == indexName {
+			counters = statistics
+		}
+	}
+	assert.Equal(t, map[string]int64{DeadLetterStageInsert: 1, DeadLetterStageValidation: 1}, counters.Stored)
+	assert.Equal(t, int64(1), counters.Replayed)
+}
+
+func TestDeadLetterQueueFailedInsertOfInvalidDocument(t *testing.T) {
+	const indexName = "dlq_invalid_logs"
+	ip, mock := newDeadLetterTestProcessor(t, indexName, &fileDeadLetterSink{path: filepath.Join(t.TempDir(), "dead_letters.ndjson")})
+	ctx := context.Background()
+
+	// the document isn't inserted, so it's stored once, in the insert stage
+	mock.ExpectExec(`INSERT INTO "dlq_invalid_logs"`).WillReturnError(errors.New("connection refused"))
+	require.Error(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "world", "count": "many"}}))
+
+	letters, err := ip.ListDeadLetters(ctx, indexName, 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, DeadLetterStageInsert, letters[0].Stage)
+	assert.Equal(t, `{"count":"many","message":"world"}`, letters[0].Document)
+
+	// documents of a replay aren't stored again, even if their fields fail validation
+	mock.ExpectExec(`INSERT INTO "dlq_invalid_logs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	replay, err := ip.ReplayDeadLetters(ctx, indexName, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DeadLetterReplay{Replayed: 1, Failures: []string{}}, replay)
+	letters, err = ip.ListDeadLetters(ctx, indexName, 10)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClickhouseDeadLetterSink(t *testing.T) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+	sink := &clickhouseDeadLetterSink{chDb: backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn), tableName: config.DefaultDeadLetterQueueTableName}
+	ctx := context.Background()
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "quesma_dead_letters" ("id" String, "@timestamp" DateTime64(3), "index" LowCardinality(String), ` +
+		`"stage" LowCardinality(String), "reason" String, "pipeline" String, "document" String) ` +
+		`ENGINE = MergeTree ORDER BY ("index", "@timestamp") COMMENT 'Quesma managed. Documents rejected during ingest.'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "quesma_dead_letters" FORMAT JSONEachRow {"id":"1","@timestamp":"2024-01-01T12:00:00Z","index":"logs","stage":"insert","reason":"failed","pipeline":"_none","document":"{}"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, sink.store(ctx, []DeadLetter{{Id: "1", Timestamp: timestamp, Index: "logs", Stage: DeadLetterStageInsert, Reason: "failed", Pipeline: NoPipeline, Document: "{}"}}))
+
+	mock.ExpectQuery(`SELECT "id", "@timestamp", "index", "stage", "reason", "pipeline", "document" FROM "quesma_dead_letters" WHERE "index" = 'logs' ORDER BY "@timestamp" LIMIT 10`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "@timestamp", "index", "stage", "reason", "pipeline", "document"}).
+			AddRow("1", timestamp, "logs", DeadLetterStageInsert, "failed", NoPipeline, "{}"))
+	letters, err := sink.list(ctx, "logs", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []DeadLetter{{Id: "1", Timestamp: timestamp, Index: "logs", Stage: DeadLetterStageInsert, Reason: "failed", Pipeline: NoPipeline, Document: "{}"}}, letters)
+
+	mock.ExpectExec(`DELETE FROM "quesma_dead_letters" WHERE "id" IN ('1', '2')`).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, sink.delete(ctx, []string{"1", "2"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,298 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	chLib "github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Single documents are deleted and updated (bulk `delete` and `update`) by their `_id`.
+// ClickHouse tables have no `_id` column, Quesma synthesizes it for hits from the timestamp,
+// so here `_id` is translated back into a timestamp filter, exactly like in the `ids` query.
+// Documents are changed with lightweight `DELETE FROM` and `ALTER TABLE ... UPDATE` mutations, consecutive deletes
+// and updates of a bulk are batched into one count query and one mutation, as each mutation waits until it's applied.
+// As the timestamp doesn't identify a row, ids matching more than one row are refused, they would change all of them.
+
+var ErrDocumentIdNotSupported = errors.New("document ids are supported only for tables with a timestamp column")
+
+var ErrAmbiguousDocumentId = errors.New("document id is ambiguous, more documents share its timestamp")
+
+type documentTarget struct {
+	indexSchema schema.Schema
+	where       model.Expr // nil if the id can't match any document
+}
+
+// DocumentMutation deletes (PartialDocument is nil) or partially updates the document with given `_id`
+type DocumentMutation struct {
+	Id              string
+	PartialDocument types.JSON
+}
+
+// DocumentMutationResult has Found false if there was no such document, Err is ErrAmbiguousDocumentId if the id matches more documents
+type DocumentMutationResult struct {
+	Found bool
+	Err   error
+}
+
+// DeleteDocument deletes the document with given `_id`, returns false if there was no such document
+// and ErrAmbiguousDocumentId if the id matches more documents
+func (ip *IngestProcessor) DeleteDocument(ctx context.Context, indexName, id string) (found bool, err error) {
+	result := ip.MutateDocuments(ctx, indexName, []DocumentMutation{{Id: id}})[0]
+	return result.Found, result.Err
+}
+
+// UpdateDocument sets fields of the document with given `_id` to the values from the partial document,
+// returns false if there was no such document and ErrAmbiguousDocumentId if the id matches more documents
+func (ip *IngestProcessor) UpdateDocument(ctx context.Context, indexName, id string, partialDocument types.JSON) (found bool, err error) {
+	result := ip.MutateDocuments(ctx, indexName, []DocumentMutation{{Id: id, PartialDocument: partialDocument}})[0]
+	return result.Found, result.Err
+}
+
+// MutateDocuments applies deletes and updates of documents in the given order, with one existence check
+// and one mutation for all of them, instead of a check and a synchronous mutation per document.
+// Results are in the order of mutations. Documents are looked up before any of them is changed,
+// a document deleted by an earlier mutation is not found by later ones.
+func (ip *IngestProcessor) MutateDocuments(ctx context.Context, indexName string, mutations []DocumentMutation) []DocumentMutationResult {
+	results := make([]DocumentMutationResult, len(mutations))
+	ip.FlushIngestBuffer(ctx) // buffered documents may be the ones to change
+
+	table, clickhouseDecision, err := ip.resolveClickhouseTable(indexName)
+	if err != nil || table == nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	targets := make([]*documentTarget, len(mutations))
+	assignments := make([][]string, len(mutations))
+	var existing []*documentTarget // targets to look up, the others can't match any document or are invalid
+	for i, mutation := range mutations {
+		if targets[i], results[i].Err = ip.resolveDocumentTarget(ctx, table, clickhouseDecision, indexName, mutation.Id); results[i].Err != nil {
+			continue
+		}
+		if mutation.PartialDocument != nil {
+			if assignments[i], results[i].Err = documentAssignments(targets[i].indexSchema, mutation.PartialDocument); results[i].Err != nil {
+				continue
+			}
+		}
+		if targets[i].where != nil {
+			existing = append(existing, targets[i])
+		}
+	}
+
+	counts, err := ip.countDocuments(ctx, table, existing)
+	if err != nil {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+		return results
+	}
+
+	var commands, deletes []string
+	var applied []int // mutations changing a document
+	deleted := make(map[string]bool)
+	for i, mutation := range mutations {
+		if results[i].Err != nil || targets[i].where == nil {
+			continue
+		}
+		where := model.AsString(targets[i].where)
+		if count := counts[where]; count > 1 {
+			results[i].Err = fmt.Errorf("%w: %d documents match", ErrAmbiguousDocumentId, count)
+			continue
+		} else if count == 0 || deleted[where] {
+			continue
+		}
+		results[i].Found = true
+		switch {
+		case mutation.PartialDocument == nil:
+			deleted[where] = true
+			deletes = append(deletes, where)
+			commands = append(commands, "DELETE WHERE "+where)
+		case len(assignments[i]) > 0:
+			commands = append(commands, fmt.Sprintf("UPDATE %s WHERE %s", strings.Join(assignments[i], ", "), where))
+		default:
+			continue
+		}
+		applied = append(applied, i)
+	}
+	if len(commands) == 0 {
+		return results
+	}
+
+	var statement string
+	if len(deletes) == len(commands) {
+		// only deletes, they're lightweight
+		statement = fmt.Sprintf("DELETE FROM %s WHERE %s", tableWithCluster(table), strings.Join(deletes, " OR "))
+	} else {
+		// one mutation applies all commands in order
+		statement = fmt.Sprintf("ALTER TABLE %s %s", tableWithCluster(table), strings.Join(commands, ", "))
+	}
+	if err = ip.executeMutation(ctx, statement); err != nil {
+		for _, i := range applied {
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+// resolveClickhouseTable returns the table storing the index (the common table for virtual tables),
+// nil if the table doesn't exist yet
+func (ip *IngestProcessor) resolveClickhouseTable(indexName string) (*chLib.Table, *quesma_api.ConnectorDecisionClickhouse, error) {
+	decision := ip.tableResolver.Resolve(quesma_api.IngestPipeline, indexName)
+	if decision.Err != nil {
+		return nil, nil, decision.Err
+	}
+
+	var clickhouseDecision *quesma_api.ConnectorDecisionClickhouse
+	for _, connectorDecision := range decision.UseConnectors {
+		if d, ok := connectorDecision.(*quesma_api.ConnectorDecisionClickhouse); ok {
+			clickhouseDecision = d
+		}
+	}
+	if clickhouseDecision == nil {
+		return nil, nil, fmt.Errorf("index %s is not stored in ClickHouse", indexName)
+	}
+
+	tableName := clickhouseDecision.ClickhouseTableName
+	if clickhouseDecision.IsCommonTable {
+		tableName = common_table.TableName
+	}
+	table, ok := ip.tableDiscovery.TableDefinitions().Load(tableName)
+	if !ok {
+		return nil, clickhouseDecision, nil
+	}
+	return table, clickhouseDecision, nil
+}
+
+func (ip *IngestProcessor) resolveDocumentTarget(ctx context.Context, table *chLib.Table, clickhouseDecision *quesma_api.ConnectorDecisionClickhouse, indexName, id string) (*documentTarget, error) {
+	if _, ok := table.Cols[timestampFieldName]; !ok {
+		return nil, ErrDocumentIdNotSupported
+	}
+
+	target := &documentTarget{}
+	if ip.schemaRegistry != nil {
+		target.indexSchema, _ = ip.schemaRegistry.FindSchema(schema.IndexName(indexName))
+	}
+
+	translator := &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: ctx, Schema: target.indexSchema, Table: table, Indexes: []string{indexName}}
+	idsQuery := translator.ParseQueryMap(elastic_query_dsl.QueryMap{"ids": map[string]any{"values": []any{id}}})
+	if !idsQuery.CanParse {
+		// not an id generated by Quesma, there is no such document
+		return target, nil
+	}
+	target.where = idsQuery.WhereClause
+	if clickhouseDecision.IsCommonTable {
+		indexFilter := model.NewInfixExpr(model.NewColumnRef(common_table.IndexNameColumn), "=", model.NewLiteralSingleQuoteString(indexName))
+		target.where = model.And([]model.Expr{target.where, indexFilter})
+	}
+	return target, nil
+}
+
+// tableWithCluster returns the table name followed by `ON CLUSTER`, if the table is replicated
+func tableWithCluster(table *chLib.Table) string {
+	from := table.FullTableName()
+	if table.ClusterName != "" {
+		from += " ON CLUSTER " + strconv.Quote(table.ClusterName)
+	}
+	return from
+}
+
+// countDocuments returns the number of documents matching each target, by its WHERE clause
+func (ip *IngestProcessor) countDocuments(ctx context.Context, table *chLib.Table, targets []*documentTarget) (map[string]int64, error) {
+	counts := make(map[string]int64, len(targets))
+	if len(targets) == 0 {
+		return counts, nil
+	}
+	var wheres, columns []string
+	for _, target := range targets {
+		where := model.AsString(target.where)
+		if _, exists := counts[where]; !exists {
+			counts[where] = 0
+			wheres = append(wheres, where)
+			columns = append(columns, fmt.Sprintf("countIf(%s)", where))
+		}
+	}
+
+	var query string
+	if len(wheres) == 1 {
+		query = fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", table.FullTableName(), wheres[0])
+	} else {
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), table.FullTableName(), strings.Join(wheres, " OR "))
+	}
+	values := make([]int64, len(wheres))
+	dest := make([]any, len(wheres))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := ip.chDb.QueryRow(ctx, query).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("clickhouse: query row failed: %v", err)
+	}
+	for i, where := range wheres {
+		counts[where] = values[i]
+	}
+	return counts, nil
+}
+
+// executeMutation waits until the mutation is applied, so that subsequent reads see the change
+func (ip *IngestProcessor) executeMutation(ctx context.Context, statement string) error {
+	return ip.execute(clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"mutations_sync": 2})), statement)
+}
+
+// documentAssignments translates a partial document into assignments of `ALTER TABLE ... UPDATE`, sorted by column
+func documentAssignments(indexSchema schema.Schema, partialDocument types.JSON) ([]string, error) {
+	var assignments []string
+	for fieldName, value := range util.FlattenMap(partialDocument, ".") {
+		field, ok := indexSchema.ResolveField(fieldName)
+		if !ok {
+			return nil, fmt.Errorf("field [%s] does not exist, updates can't add new fields", fieldName)
+		}
+		valueExpr, err := documentValueExpr(fieldName, value)
+		if err != nil {
+			return nil, err
+		}
+		column := model.NewColumnRef(field.InternalPropertyName.AsString())
+		assignments = append(assignments, model.AsString(column)+" = "+model.AsString(valueExpr))
+	}
+	sort.Strings(assignments)
+	return assignments, nil
+}
+
+func documentValueExpr(fieldName string, value any) (model.Expr, error) {
+	switch v := value.(type) {
+	case nil:
+		return model.NewLiteral("NULL"), nil
+	case string:
+		return model.NewLiteralSingleQuoteString(v), nil
+	case bool, float64, int64, int:
+		return model.NewLiteral(v), nil
+	case []any:
+		elements := make([]model.Expr, 0, len(v))
+		for _, element := range v {
+			elementExpr, err := documentValueExpr(fieldName, element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, elementExpr)
+		}
+		return model.NewFunction("array", elements...), nil
+	default:
+		return nil, fmt.Errorf("field [%s] has unsupported value of type %T", fieldName, value)
+	}
+}
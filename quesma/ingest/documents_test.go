@@ -0,0 +1,108 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDeleteAndUpdateDocument(t *testing.T) {
+	const indexName = "logs"
+	tables := util.NewSyncMapWith(indexName, &clickhouse.Table{
+		Name: indexName,
+		Cols: map[string]*clickhouse.Column{
+			"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+			"message":    {Name: "message", Type: clickhouse.NewBaseType("String")},
+			"host_name":  {Name: "host_name", Type: clickhouse.NewBaseType("String")},
+		},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	})
+	fields := map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"host.name":  {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+	}
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: indexName, ClickhouseIndexes: []string{indexName}}},
+	}
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.tableResolver = resolver
+	ip.schemaRegistry = schema.NewStaticRegistry(map[schema.IndexName]schema.Schema{indexName: schema.NewSchema(fields, true, "")}, nil, nil)
+
+	// `_id` of a hit, as generated by Quesma
+	id := fmt.Sprintf("%xq1", time.Date(2024, 1, 29, 18, 11, 36, 491000000, time.UTC))
+	where := `"@timestamp" = toDateTime64('2024-01-29 18:11:36.491',3)`
+
+	mock.ExpectQuery(`SELECT count(*) FROM "logs" WHERE ` + where).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(1))
+	mock.ExpectExec(`DELETE FROM "logs" WHERE ` + where).WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err := ip.DeleteDocument(context.Background(), indexName, id)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	mock.ExpectQuery(`SELECT count(*) FROM "logs" WHERE ` + where).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(1))
+	mock.ExpectExec(`ALTER TABLE "logs" UPDATE "host_name" = 'a\'b', "message" = NULL WHERE ` + where).WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err = ip.UpdateDocument(context.Background(), indexName, id, types.MustJSON(`{"host": {"name": "a'b"}, "message": null}`))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	mock.ExpectQuery(`SELECT count(*) FROM "logs" WHERE ` + where).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(0))
+	found, err = ip.DeleteDocument(context.Background(), indexName, id)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// two documents share the timestamp, neither of them is changed
+	mock.ExpectQuery(`SELECT count(*) FROM "logs" WHERE ` + where).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(2))
+	_, err = ip.DeleteDocument(context.Background(), indexName, id)
+	assert.ErrorIs(t, err, ErrAmbiguousDocumentId)
+	mock.ExpectQuery(`SELECT count(*) FROM "logs" WHERE ` + where).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(2))
+	_, err = ip.UpdateDocument(context.Background(), indexName, id, types.MustJSON(`{"message": "changed"}`))
+	assert.ErrorIs(t, err, ErrAmbiguousDocumentId)
+
+	// ids not generated by Quesma can't match any document
+	found, err = ip.DeleteDocument(context.Background(), indexName, "custom-id")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = ip.UpdateDocument(context.Background(), indexName, id, types.MustJSON(`{"unknown": 1}`))
+	assert.Error(t, err)
+
+	// mutations are batched into one count query and one mutation, applied in order
+	otherId := fmt.Sprintf("%xq1", time.Date(2024, 1, 29, 18, 11, 37, 491000000, time.UTC))
+	otherWhere := `"@timestamp" = toDateTime64('2024-01-29 18:11:37.491',3)`
+	mock.ExpectQuery(`SELECT countIf(` + where + `), countIf(` + otherWhere + `) FROM "logs" WHERE ` + where + ` OR ` + otherWhere).
+		WillReturnRows(sqlmock.NewRows([]string{"c1", "c2"}).AddRow(1, 1))
+	mock.ExpectExec(`ALTER TABLE "logs" UPDATE "message" = 'changed' WHERE ` + where + `, DELETE WHERE ` + where + `, DELETE WHERE ` + otherWhere).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	results := ip.MutateDocuments(context.Background(), indexName, []DocumentMutation{
+		{Id: id, PartialDocument: types.MustJSON(`{"message": "changed"}`)},
+		{Id: id},
+		{Id: id},
+		{Id: otherId},
+		{Id: "custom-id"},
+	})
+	assert.Equal(t, []DocumentMutationResult{{Found: true}, {Found: true}, {Found: false}, {Found: true}, {Found: false}}, results)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
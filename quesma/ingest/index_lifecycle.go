@@ -0,0 +1,582 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"fmt"
+	chLib "github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/recovery"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Index lifecycle policies (https://www.elastic.co/guide/en/elasticsearch/reference/current/index-lifecycle-management.html)
+// created with `PUT /_ilm/policy/:name`, and assigned to indexes with the `index.lifecycle.name` setting,
+// either by `PUT /:index/_settings` or by the index template used to create the table.
+//
+// Only the delete phase is translated, its `min_age` is the retention of documents counted from their `@timestamp`:
+//   - a dedicated table gets a table TTL (`ALTER TABLE ... MODIFY TTL`), and partitions with only expired documents
+//     are dropped periodically, which frees space without waiting for TTL merges,
+//   - rows of an index in the common table are deleted periodically, as its TTL and partitions are shared.
+//
+// Other phases (hot, warm, cold, frozen) are accepted and ignored.
+// Policies and their assignments to indexes are stored in a JSONDatabase.
+
+const IndexLifecycleElasticIndexName = "quesma_index_lifecycle"
+
+const (
+	lifecyclePolicyKeyPrefix = "policy:"
+	lifecycleIndexKeyPrefix  = "index:"
+)
+
+const indexLifecycleInterval = 10 * time.Minute
+
+type LifecyclePolicy struct {
+	Name           string
+	Definition     types.JSON // the `policy` object
+	HasDeletePhase bool
+	DeleteAfter    time.Duration // `min_age` of the delete phase
+}
+
+// ttl returns TTL expression of tables using the policy, "" if documents are never deleted
+func (p *LifecyclePolicy) ttl() string {
+	if p == nil || !p.HasDeletePhase {
+		return ""
+	}
+	return retentionTtl(p.DeleteAfter)
+}
+
+func retentionTtl(retention time.Duration) string {
+	return fmt.Sprintf(`toDateTime("%s") + INTERVAL %d SECOND`, timestampFieldName, int64(retention.Seconds()))
+}
+
+func ParseLifecyclePolicy(name string, body types.JSON) (*LifecyclePolicy, error) {
+	badRequest := func(format string, args ...any) error {
+		return fmt.Errorf("%w: lifecycle policy [%s]: %s", quesma_errors.ErrCouldNotParseRequest(), name, fmt.Sprintf(format, args...))
+	}
+
+	definition, ok := body["policy"].(map[string]any)
+	if !ok {
+		return nil, badRequest("[policy] is required")
+	}
+	policy := &LifecyclePolicy{Name: name, Definition: definition}
+
+	phases, ok := definition["phases"].(map[string]any)
+	if !ok {
+		return nil, badRequest("[policy.phases] is required")
+	}
+	for phaseName, phaseRaw := range phases {
+		phase, ok := phaseRaw.(map[string]any)
+		if !ok {
+			return nil, badRequest("phase [%s] must be an object", phaseName)
+		}
+		if phaseName != "delete" {
+			continue
+		}
+		if minAgeRaw, exists := phase["min_age"]; exists {
+			minAge, isString := minAgeRaw.(string)
+			if !isString {
+				return nil, badRequest("[min_age] of the delete phase must be a string")
+			}
+			deleteAfter, err := util.ParseInterval(minAge)
+			if err != nil || deleteAfter < 0 {
+				return nil, badRequest("invalid [min_age] of the delete phase: %s", minAge)
+			}
+			policy.DeleteAfter = deleteAfter
+		}
+		actions, _ := phase["actions"].(map[string]any)
+		for action := range actions {
+			if action != "delete" {
+				return nil, badRequest("action [%s] of the delete phase is not supported", action)
+			}
+		}
+		policy.HasDeletePhase = true
+	}
+	return policy, nil
+}
+
+// IndexLifecycleRegistry keeps lifecycle policies and their assignments to indexes
+type IndexLifecycleRegistry struct {
+	m        sync.Mutex
+	storage  persistence.JSONDatabase // nil if policies are kept in memory only
+	policies map[string]*LifecyclePolicy
+	indexes  map[string]string // index name -> policy name
+}
+
+type storedLifecyclePolicy struct {
+	Name   string     `json:"name"`
+	Policy types.JSON `json:"policy"`
+}
+
+type storedIndexLifecycle struct {
+	Index  string `json:"index"`
+	Policy string `json:"policy"`
+}
+
+func NewIndexLifecycleRegistry(storage persistence.JSONDatabase) *IndexLifecycleRegistry {
+	r := &IndexLifecycleRegistry{
+		storage:  storage,
+		policies: make(map[string]*LifecyclePolicy),
+		indexes:  make(map[string]string),
+	}
+	r.load()
+	return r
+}
+
+func (r *IndexLifecycleRegistry) load() {
+	if r.storage == nil {
+		return
+	}
+	keys, err := r.storage.List()
+	if err != nil {
+		logger.Warn().Msgf("could not load lifecycle policies: %v", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := r.storage.Get(key)
+		if err != nil || !ok {
+			logger.Warn().Msgf("could not load lifecycle entry %s: %v", key, err)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, lifecyclePolicyKeyPrefix):
+			var stored storedLifecyclePolicy
+			if err = json.Unmarshal([]byte(data), &stored); err != nil {
+				logger.Warn().Msgf("could not parse lifecycle policy %s: %v", key, err)
+				continue
+			}
+			if policy, err := ParseLifecyclePolicy(stored.Name, types.JSON{"policy": map[string]any(stored.Policy)}); err == nil {
+				r.policies[stored.Name] = policy
+			} else {
+				logger.Warn().Msgf("could not parse lifecycle policy %s: %v", key, err)
+			}
+		case strings.HasPrefix(key, lifecycleIndexKeyPrefix):
+			var stored storedIndexLifecycle
+			if err = json.Unmarshal([]byte(data), &stored); err != nil {
+				logger.Warn().Msgf("could not parse lifecycle of index %s: %v", key, err)
+				continue
+			}
+			r.indexes[stored.Index] = stored.Policy
+		}
+	}
+}
+
+func (r *IndexLifecycleRegistry) store(key string, value any) error {
+	if r.storage == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.storage.Put(key, string(data))
+}
+
+func (r *IndexLifecycleRegistry) remove(key string) error {
+	if r.storage == nil {
+		return nil
+	}
+	return r.storage.Delete(key)
+}
+
+// PutPolicy creates or updates the policy, returns its previous version (nil if it's a new policy)
+func (r *IndexLifecycleRegistry) PutPolicy(name string, body types.JSON) (previous *LifecyclePolicy, err error) {
+	policy, err := ParseLifecyclePolicy(name, body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if err = r.store(lifecyclePolicyKeyPrefix+name, storedLifecyclePolicy{Name: name, Policy: policy.Definition}); err != nil {
+		return nil, fmt.Errorf("could not store lifecycle policy [%s]: %w", name, err)
+	}
+	previous = r.policies[name]
+	r.policies[name] = policy
+	return previous, nil
+}
+
+// DeletePolicy returns false if there's no such policy. Policies used by indexes can't be deleted.
+func (r *IndexLifecycleRegistry) DeletePolicy(name string) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, exists := r.policies[name]; !exists {
+		return false, nil
+	}
+	if usedBy := r.indexesUsing(name); len(usedBy) > 0 {
+		return true, fmt.Errorf("%w: cannot delete policy [%s], it is in use by one or more indices: %v", quesma_errors.ErrCouldNotParseRequest(), name, usedBy)
+	}
+	if err := r.remove(lifecyclePolicyKeyPrefix + name); err != nil {
+		return true, fmt.Errorf("could not delete lifecycle policy [%s]: %w", name, err)
+	}
+	delete(r.policies, name)
+	return true, nil
+}
+
+// FindPolicies returns policies matching a comma separated list of names (with `*` wildcards), sorted by name
+func (r *IndexLifecycleRegistry) FindPolicies(names string) []*LifecyclePolicy {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var result []*LifecyclePolicy
+	for name, policy := range r.policies {
+		if matchesAnyName(names, name) {
+			result = append(result, policy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// SetIndexPolicy assigns the policy to the index, or makes the index unmanaged if the policy is "".
+// It returns the policy used by the index so far (nil if the index wasn't managed).
+func (r *IndexLifecycleRegistry) SetIndexPolicy(index, policyName string) (previous *LifecyclePolicy, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	previous = r.policies[r.indexes[index]]
+	if policyName == "" {
+		if _, managed := r.indexes[index]; !managed {
+			return nil, nil
+		}
+		if err = r.remove(lifecycleIndexKeyPrefix + index); err != nil {
+			return previous, fmt.Errorf("could not remove lifecycle policy of index [%s]: %w", index, err)
+		}
+		delete(r.indexes, index)
+		return previous, nil
+	}
+
+	if _, exists := r.policies[policyName]; !exists {
+		return previous, fmt.Errorf("%w: lifecycle policy [%s] does not exist", quesma_errors.ErrCouldNotParseRequest(), policyName)
+	}
+	if err = r.store(lifecycleIndexKeyPrefix+index, storedIndexLifecycle{Index: index, Policy: policyName}); err != nil {
+		return previous, fmt.Errorf("could not store lifecycle policy of index [%s]: %w", index, err)
+	}
+	r.indexes[index] = policyName
+	return previous, nil
+}
+
+// IndexPolicy returns the policy of the index, nil if the index isn't managed
+func (r *IndexLifecycleRegistry) IndexPolicy(index string) *LifecyclePolicy {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.policies[r.indexes[index]]
+}
+
+// Indexes returns indexes using the policy, or all managed indexes if the policy is "", sorted
+func (r *IndexLifecycleRegistry) Indexes(policyName string) []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if policyName == "" {
+		return util.MapKeysSorted(r.indexes)
+	}
+	return r.indexesUsing(policyName)
+}
+
+func (r *IndexLifecycleRegistry) indexesUsing(policyName string) []string {
+	var result []string
+	for index, name := range r.indexes {
+		if name == policyName {
+			result = append(result, index)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// lifecycleTarget is the table of an existing index
+type lifecycleTarget struct {
+	table       *chLib.Table
+	commonTable bool
+}
+
+// resolveLifecycleTarget returns nil if the index doesn't exist
+func (ip *IngestProcessor) resolveLifecycleTarget(index string) (*lifecycleTarget, error) {
+	table, clickhouseDecision, err := ip.resolveClickhouseTable(index)
+	if err != nil || table == nil {
+		return nil, err
+	}
+	if clickhouseDecision.IsCommonTable {
+		if ip.virtualTableStorage == nil {
+			return nil, nil
+		}
+		if _, exists, err := ip.virtualTableStorage.Get(index); err != nil || !exists {
+			return nil, err
+		}
+	}
+	return &lifecycleTarget{table: table, commonTable: clickhouseDecision.IsCommonTable}, nil
+}
+
+func (ip *IngestProcessor) IndexLifecycle() *IndexLifecycleRegistry {
+	return ip.indexLifecycle
+}
+
+// PutLifecyclePolicy creates or updates the policy, and applies it to tables of indexes already using it
+func (ip *IngestProcessor) PutLifecyclePolicy(ctx context.Context, name string, body types.JSON) error {
+	previous, err := ip.indexLifecycle.PutPolicy(name, body)
+	if err != nil {
+		return err
+	}
+	for _, index := range ip.indexLifecycle.Indexes(name) {
+		if err = ip.alterTableLifecycle(ctx, index, previous); err != nil {
+			logger.ErrorWithCtx(ctx).Msgf("could not apply lifecycle policy %s to index %s: %v", name, index, err)
+		}
+	}
+	return nil
+}
+
+// SetIndexLifecyclePolicy assigns the policy to the index (or removes it, if the policy is "") and alters its table
+func (ip *IngestProcessor) SetIndexLifecyclePolicy(ctx context.Context, index, policyName string) error {
+	if policyName != "" {
+		if policies := ip.indexLifecycle.FindPolicies(policyName); len(policies) == 1 && policies[0].HasDeletePhase {
+			target, err := ip.resolveLifecycleTarget(index)
+			if err != nil {
+				return err
+			}
+			if target != nil && !target.commonTable {
+				if _, ok := target.table.Cols[timestampFieldName]; !ok {
+					return fmt.Errorf("%w: index [%s] has no [%s] field, required by the delete phase", quesma_errors.ErrCouldNotParseRequest(), index, timestampFieldName)
+				}
+			}
+		}
+	}
+
+	previous, err := ip.indexLifecycle.SetIndexPolicy(index, policyName)
+	if err != nil {
+		return err
+	}
+	if policyName == "" {
+		stats.GlobalIndexLifecycle.Remove(index)
+	}
+	return ip.alterTableLifecycle(ctx, index, previous)
+}
+
+// alterTableLifecycle sets TTL of the index table according to its policy, `previous` is the policy applied so far
+func (ip *IngestProcessor) alterTableLifecycle(ctx context.Context, index string, previous *LifecyclePolicy) error {
+	policy := ip.indexLifecycle.IndexPolicy(index)
+	target, err := ip.resolveLifecycleTarget(index)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		ip.updateLifecycleStatus(index, policy, target)
+	}
+	if target == nil || target.commonTable {
+		// TTL is set when the table is created, and the common table is shared with other indexes
+		return nil
+	}
+
+	ttl, previousTtl := policy.ttl(), previous.ttl()
+	var statement string
+	switch {
+	case ttl == previousTtl:
+		return nil
+	case ttl == "":
+		statement = fmt.Sprintf("ALTER TABLE %s REMOVE TTL", tableWithCluster(target.table))
+	default:
+		statement = fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", tableWithCluster(target.table), ttl)
+	}
+	if err = ip.execute(ctx, statement); err != nil {
+		return fmt.Errorf("could not alter TTL of table %s: %w", target.table.Name, err)
+	}
+	target.table.Config.Ttl = ttl
+	return nil
+}
+
+// lifecycleTableConfig is called when a table for a new index is created. It returns the config of the table,
+// with TTL defined by the lifecycle policy of the index, if any.
+func (ip *IngestProcessor) lifecycleTableConfig(index string, config *chLib.ChTableConfig) *chLib.ChTableConfig {
+	if ip.indexLifecycle == nil {
+		return config
+	}
+	policy := ip.indexLifecycle.IndexPolicy(index)
+	if policy == nil {
+		return config
+	}
+	ip.updateLifecycleStatus(index, policy, &lifecycleTarget{table: &chLib.Table{Name: index}})
+	if ttl := policy.ttl(); ttl != "" {
+		config.Ttl = ttl
+	}
+	return config
+}
+
+func (ip *IngestProcessor) updateLifecycleStatus(index string, policy *LifecyclePolicy, target *lifecycleTarget) {
+	stats.GlobalIndexLifecycle.Update(index, func(status *stats.IndexLifecycleStatus) {
+		status.Policy = policy.Name
+		status.DeletePhase = policy.HasDeletePhase
+		status.DeleteAfter = policy.DeleteAfter
+		if target != nil {
+			status.Table = target.table.Name
+			status.CommonTable = target.commonTable
+		}
+	})
+}
+
+func (ip *IngestProcessor) startIndexLifecycleJob() {
+	go func() {
+		defer recovery.LogPanic()
+		for {
+			select {
+			case <-ip.ctx.Done():
+				return
+			case <-time.After(indexLifecycleInterval):
+				ip.EnforceIndexLifecycle(ip.ctx)
+			}
+		}
+	}()
+}
+
+// EnforceIndexLifecycle deletes documents older than retention of managed indexes
+func (ip *IngestProcessor) EnforceIndexLifecycle(ctx context.Context) {
+	now := time.Now()
+	for _, index := range ip.indexLifecycle.Indexes("") {
+		policy := ip.indexLifecycle.IndexPolicy(index)
+		if policy == nil || !policy.HasDeletePhase {
+			continue
+		}
+		target, err := ip.resolveLifecycleTarget(index)
+		if err == nil && target == nil {
+			continue
+		}
+
+		var dropped int64
+		if err == nil {
+			if target.commonTable {
+				err = ip.deleteExpiredRows(ctx, target.table, index, policy.DeleteAfter)
+			} else {
+				dropped, err = ip.dropExpiredPartitions(ctx, target.table, now.Add(-policy.DeleteAfter))
+			}
+		}
+		if err != nil {
+			logger.ErrorWithCtx(ctx).Msgf("could not enforce lifecycle policy %s of index %s: %v", policy.Name, index, err)
+		}
+
+		ip.updateLifecycleStatus(index, policy, target)
+		stats.GlobalIndexLifecycle.Update(index, func(status *stats.IndexLifecycleStatus) {
+			status.LastRun = now
+			status.LastError = ""
+			if err != nil {
+				status.LastError = err.Error()
+			}
+			status.DroppedPartitions += dropped
+		})
+	}
+}
+
+// dropExpiredPartitions drops partitions, whose newest document is older than `cutoff`
+func (ip *IngestProcessor) dropExpiredPartitions(ctx context.Context, table *chLib.Table, cutoff time.Time) (int64, error) {
+	query := fmt.Sprintf("SELECT _partition_id, max(%s) FROM %s GROUP BY _partition_id", strconv.Quote(timestampFieldName), table.FullTableName())
+	rows, err := ip.chDb.Query(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("clickhouse: query failed: %v", err)
+	}
+	var expired []string
+	for rows.Next() {
+		var partitionId string
+		var newest time.Time
+		if err = rows.Scan(&partitionId, &newest); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("clickhouse: scan failed: %v", err)
+		}
+		// "all" is the only partition of a table without PARTITION BY
+		if partitionId != "all" && newest.Before(cutoff) {
+			expired = append(expired, partitionId)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("clickhouse: reading rows failed: %v", err)
+	}
+
+	slices.Sort(expired)
+	var dropped int64
+	for _, partitionId := range expired {
+		statement := fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID %s", tableWithCluster(table), model.AsString(model.NewLiteralSingleQuoteString(partitionId)))
+		if err = ip.execute(ctx, statement); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// deleteExpiredRows deletes rows of the index from the common table, which are older than retention
+func (ip *IngestProcessor) deleteExpiredRows(ctx context.Context, table *chLib.Table, index string, retention time.Duration) error {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE %s = %s AND %s < now() - INTERVAL %d SECOND", tableWithCluster(table),
+		strconv.Quote(common_table.IndexNameColumn), model.AsString(model.NewLiteralSingleQuoteString(index)),
+		strconv.Quote(timestampFieldName), int64(retention.Seconds()))
+	return ip.executeMutation(ctx, statement)
+}
+
+// DeleteIndex drops the table of the index, or deletes its rows from the common table.
+// It returns false if there's no such index.
+func (ip *IngestProcessor) DeleteIndex(ctx context.Context, index string) (bool, error) {
+	// otherwise buffered documents would create the table again
+	ip.FlushIngestBuffer(ctx)
+	if slices.Contains(ip.tableResolver.ClosedIndexes(), index) {
+		if err := ip.tableResolver.OpenIndex(index); err != nil {
+			return true, err
+		}
+	}
+	target, err := ip.resolveLifecycleTarget(index)
+	if err != nil || target == nil {
+		return false, err
+	}
+
+	if target.commonTable {
+		statement := fmt.Sprintf("DELETE FROM %s WHERE %s = %s", tableWithCluster(target.table),
+			strconv.Quote(common_table.IndexNameColumn), model.AsString(model.NewLiteralSingleQuoteString(index)))
+		if err = ip.executeMutation(ctx, statement); err != nil {
+			return true, err
+		}
+		if err = ip.virtualTableStorage.Delete(index); err != nil {
+			return true, fmt.Errorf("could not delete virtual table %s: %w", index, err)
+		}
+		ip.tableDiscovery.TableDefinitions().Delete(index)
+	} else {
+		if err = ip.execute(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", tableWithCluster(target.table))); err != nil {
+			return true, err
+		}
+		// the table name may differ from the index name
+		ip.tableDiscovery.TableDefinitions().Delete(target.table.Name)
+	}
+
+	if _, err = ip.indexLifecycle.SetIndexPolicy(index, ""); err != nil {
+		logger.WarnWithCtx(ctx).Msgf("could not remove lifecycle policy of deleted index %s: %v", index, err)
+	}
+	stats.GlobalIndexLifecycle.Remove(index)
+	return true, nil
+}
+
+// CloseIndex blocks searches and writes to the index, returns false if there's no such index
+func (ip *IngestProcessor) CloseIndex(index string) (bool, error) {
+	if slices.Contains(ip.tableResolver.ClosedIndexes(), index) {
+		return true, nil
+	}
+	target, err := ip.resolveLifecycleTarget(index)
+	if err != nil || target == nil {
+		return false, err
+	}
+	return true, ip.tableResolver.CloseIndex(index)
+}
+
+// OpenIndex reopens a closed index, returns false if there's no such index
+func (ip *IngestProcessor) OpenIndex(index string) (bool, error) {
+	if slices.Contains(ip.tableResolver.ClosedIndexes(), index) {
+		return true, ip.tableResolver.OpenIndex(index)
+	}
+	target, err := ip.resolveLifecycleTarget(index)
+	return target != nil, err
+}
@@ -0,0 +1,215 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLifecyclePolicyRegistry(t *testing.T) {
+	storage := persistence.NewStaticJSONDatabase()
+	registry := NewIndexLifecycleRegistry(storage)
+
+	_, err := registry.PutPolicy("logs", types.MustJSON(`{"policy": {"phases": {
+		"hot": {"actions": {"rollover": {"max_age": "1d"}}},
+		"delete": {"min_age": "30d", "actions": {"delete": {}}}}}}`))
+	require.NoError(t, err)
+	_, err = registry.PutPolicy("keep", types.MustJSON(`{"policy": {"phases": {"hot": {"actions": {}}}}}`))
+	require.NoError(t, err)
+
+	policies := registry.FindPolicies("*")
+	require.Len(t, policies, 2)
+	assert.Equal(t, "keep", policies[0].Name)
+	assert.False(t, policies[0].HasDeletePhase)
+	assert.Equal(t, "", policies[0].ttl())
+	assert.True(t, policies[1].HasDeletePhase)
+	assert.Equal(t, 30*24*time.Hour, policies[1].DeleteAfter)
+	assert.Equal(t, `toDateTime("@timestamp") + INTERVAL 2592000 SECOND`, policies[1].ttl())
+
+	for _, body := range []string{
+		`{"phases": {}}`,
+		`{"policy": {}}`,
+		`{"policy": {"phases": {"delete": {"min_age": "forever"}}}}`,
+		`{"policy": {"phases": {"delete": {"actions": {"wait_for_snapshot": {}}}}}}`,
+	} {
+		_, err = registry.PutPolicy("invalid", types.MustJSON(body))
+		assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()), body)
+	}
+
+	_, err = registry.SetIndexPolicy("logs-1", "missing")
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+	previous, err := registry.SetIndexPolicy("logs-1", "logs")
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	assert.Equal(t, []string{"logs-1"}, registry.Indexes("logs"))
+
+	// policies in use can't be deleted
+	found, err := registry.DeletePolicy("logs")
+	assert.True(t, found)
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+
+	// policies and assignments are loaded from the storage
+	reloaded := NewIndexLifecycleRegistry(storage)
+	assert.Len(t, reloaded.FindPolicies("*"), 2)
+	assert.Equal(t, "logs", reloaded.IndexPolicy("logs-1").Name)
+
+	previous, err = registry.SetIndexPolicy("logs-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "logs", previous.Name)
+	found, err = registry.DeletePolicy("logs")
+	assert.True(t, found)
+	require.NoError(t, err)
+	found, _ = registry.DeletePolicy("logs")
+	assert.False(t, found)
+
+	reloaded = NewIndexLifecycleRegistry(storage)
+	assert.Len(t, reloaded.FindPolicies("*"), 1)
+	assert.Nil(t, reloaded.IndexPolicy("logs-1"))
+}
+
+func TestIndexLifecycleOfDedicatedTable(t *testing.T) {
+	const indexName = "logs"
+	tables := util.NewSyncMapWith(indexName, &clickhouse.Table{
+		Name:    indexName,
+		Cols:    map[string]*clickhouse.Column{"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")}},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	})
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: indexName, ClickhouseIndexes: []string{indexName}}},
+	}
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.tableResolver = resolver
+	ip.indexLifecycle = NewIndexLifecycleRegistry(nil)
+	ctx := context.Background()
+
+	require.NoError(t, ip.PutLifecyclePolicy(ctx, "week", types.MustJSON(`{"policy": {"phases": {"delete": {"min_age": "7d", "actions": {"delete": {}}}}}}`)))
+
+	mock.ExpectExec(`ALTER TABLE "logs" MODIFY TTL toDateTime("@timestamp") + INTERVAL 604800 SECOND`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, ip.SetIndexLifecyclePolicy(ctx, indexName, "week"))
+
+	// updating the policy alters tables using it
+	mock.ExpectExec(`ALTER TABLE "logs" MODIFY TTL toDateTime("@timestamp") + INTERVAL 86400 SECOND`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, ip.PutLifecyclePolicy(ctx, "week", types.MustJSON(`{"policy": {"phases": {"delete": {"min_age": "1d", "actions": {"delete": {}}}}}}`)))
+
+	// only partitions with expired documents are dropped
+	now := time.Now()
+	mock.ExpectQuery(`SELECT _partition_id, max("@timestamp") FROM "logs" GROUP BY _partition_id`).WillReturnRows(sqlmock.NewRows([]string{"_partition_id", "max"}).
+		AddRow("20240101", now.Add(-48*time.Hour)).
+		AddRow("20240102", now.Add(-time.Hour)))
+	mock.ExpectExec(`ALTER TABLE "logs" DROP PARTITION ID '20240101'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	ip.EnforceIndexLifecycle(ctx)
+
+	status := stats.GlobalIndexLifecycle.Sorted()
+	require.Len(t, status, 1)
+	assert.Equal(t, "week", status[0].Policy)
+	assert.Equal(t, indexName, status[0].Table)
+	assert.Equal(t, int64(1), status[0].DroppedPartitions)
+	assert.Empty(t, status[0].LastError)
+
+	mock.ExpectExec(`ALTER TABLE "logs" REMOVE TTL`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, ip.SetIndexLifecyclePolicy(ctx, indexName, ""))
+	assert.Empty(t, stats.GlobalIndexLifecycle.Sorted())
+
+	mock.ExpectExec(`DROP TABLE IF EXISTS "logs"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err := ip.DeleteIndex(ctx, indexName)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, tables.Has(indexName))
+
+	found, err = ip.DeleteIndex(ctx, indexName)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteIndexOfTableWithAnotherName(t *testing.T) {
+	const indexName, tableName = "logs", "logs_table"
+	tables := util.NewSyncMapWith(tableName, &clickhouse.Table{Name: tableName, Config: NewDefaultCHConfig(), Created: true})
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: tableName, ClickhouseIndexes: []string{indexName}}},
+	}
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.tableResolver = resolver
+	ip.indexLifecycle = NewIndexLifecycleRegistry(nil)
+
+	mock.ExpectExec(`DROP TABLE IF EXISTS "logs_table"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err := ip.DeleteIndex(context.Background(), indexName)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, tables.Has(tableName))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIndexLifecycleOfCommonTable(t *testing.T) {
+	const indexName = "logs"
+	tables := util.NewSyncMapWith(common_table.TableName, &clickhouse.Table{
+		Name:    common_table.TableName,
+		Cols:    map[string]*clickhouse.Column{"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")}},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	})
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: common_table.TableName, ClickhouseIndexes: []string{indexName}, IsCommonTable: true}},
+	}
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.tableResolver = resolver
+	ip.indexLifecycle = NewIndexLifecycleRegistry(nil)
+	require.NoError(t, ip.virtualTableStorage.Put(indexName, `{}`))
+	ctx := context.Background()
+
+	// the common table is shared, so its TTL isn't altered
+	require.NoError(t, ip.PutLifecyclePolicy(ctx, "day", types.MustJSON(`{"policy": {"phases": {"delete": {"min_age": "1d", "actions": {"delete": {}}}}}}`)))
+	require.NoError(t, ip.SetIndexLifecyclePolicy(ctx, indexName, "day"))
+
+	mock.ExpectExec(`DELETE FROM "quesma_common_table" WHERE "__quesma_index_name" = 'logs' AND "@timestamp" < now() - INTERVAL 86400 SECOND`).WillReturnResult(sqlmock.NewResult(0, 0))
+	ip.EnforceIndexLifecycle(ctx)
+
+	mock.ExpectExec(`DELETE FROM "quesma_common_table" WHERE "__quesma_index_name" = 'logs'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err := ip.DeleteIndex(ctx, indexName)
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, exists, _ := ip.virtualTableStorage.Get(indexName)
+	assert.False(t, exists)
+	assert.Nil(t, ip.IndexLifecycle().IndexPolicy(indexName))
+	assert.Empty(t, stats.GlobalIndexLifecycle.Sorted())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
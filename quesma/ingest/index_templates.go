@@ -0,0 +1,581 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"fmt"
+	chLib "github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/goccy/go-json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Composable index templates (https://www.elastic.co/guide/en/elasticsearch/reference/current/index-templates.html)
+// created with `PUT /_index_template/:name` and `PUT /_component_template/:name`.
+//
+// When Quesma creates a table for a new index, the matching index template (the one with the highest priority),
+// merged with its component templates, defines:
+//   - the schema of the index, from `template.mappings` (unless the index has a schema already),
+//   - table options, from `_meta.quesma` (`engine`, `order_by`, `partition_by`, `primary_key`, `ttl`, `settings`),
+//     or otherwise from the `index.sort.field` setting (ORDER BY) and `template.lifecycle.data_retention` (TTL).
+//   - the lifecycle policy of the index, from the `index.lifecycle.name` setting (see index_lifecycle.go).
+//
+// Templates are stored in a JSONDatabase, one entry per template. Deleted templates are stored without a definition.
+
+const IndexTemplatesElasticIndexName = "quesma_index_templates"
+
+const (
+	indexTemplateKeyPrefix     = "index_template:"
+	componentTemplateKeyPrefix = "component_template:"
+)
+
+var templateTableOptionNames = []string{"engine", "order_by", "partition_by", "primary_key", "ttl", "settings"}
+
+// templateTableOptions are ClickHouse table options defined by a template, "" if not defined. They're validated, see table_options.go.
+type templateTableOptions struct {
+	Engine      string `json:"engine"`
+	OrderBy     string `json:"order_by"`
+	PartitionBy string `json:"partition_by"`
+	PrimaryKey  string `json:"primary_key"`
+	Ttl         string `json:"ttl"`
+	Settings    string `json:"settings"`
+
+	nullableOrderBy bool // OrderBy is built from the `index.sort.field` setting, its columns may be Nullable
+}
+
+// merge overrides options with those defined in `other`
+func (o templateTableOptions) merge(other templateTableOptions) templateTableOptions {
+	if other.Engine != "" {
+		o.Engine = other.Engine
+	}
+	if other.OrderBy != "" {
+		o.OrderBy = other.OrderBy
+		o.nullableOrderBy = other.nullableOrderBy
+	}
+	if other.PartitionBy != "" {
+		o.PartitionBy = other.PartitionBy
+	}
+	if other.PrimaryKey != "" {
+		o.PrimaryKey = other.PrimaryKey
+	}
+	if other.Ttl != "" {
+		o.Ttl = other.Ttl
+	}
+	if other.Settings != "" {
+		o.Settings = other.Settings
+	}
+	return o
+}
+
+// templateContent is the part common to index and component templates
+type templateContent struct {
+	mappings        map[string]any
+	tableOptions    templateTableOptions
+	lifecyclePolicy string // "" if not defined
+}
+
+type IndexTemplate struct {
+	Name          string
+	IndexPatterns []string
+	Priority      int64
+	ComposedOf    []string
+	Definition    types.JSON
+	content       templateContent
+}
+
+type ComponentTemplate struct {
+	Name       string
+	Definition types.JSON
+	content    templateContent
+}
+
+// ResolvedIndexTemplate is an index template merged with its component templates
+type ResolvedIndexTemplate struct {
+	Name            string
+	Mappings        map[string]any
+	LifecyclePolicy string // from the `index.lifecycle.name` setting, "" if not defined
+	tableOptions    templateTableOptions
+}
+
+// Columns returns the schema defined by template's mappings
+func (t *ResolvedIndexTemplate) Columns() map[string]schema.Column {
+	if len(t.Mappings) == 0 {
+		return map[string]schema.Column{}
+	}
+	return elasticsearch.ParseMappings("", t.Mappings)
+}
+
+// TableConfig returns `base` config with table options defined by the template
+func (t *ResolvedIndexTemplate) TableConfig(base *chLib.ChTableConfig) *chLib.ChTableConfig {
+	config := *base
+	if t.tableOptions.Engine != "" {
+		config.Engine = t.tableOptions.Engine
+	}
+	if t.tableOptions.OrderBy != "" {
+		config.OrderBy = t.tableOptions.OrderBy
+	}
+	if t.tableOptions.PartitionBy != "" {
+		config.PartitionBy = t.tableOptions.PartitionBy
+	}
+	if t.tableOptions.PrimaryKey != "" {
+		config.PrimaryKey = t.tableOptions.PrimaryKey
+	}
+	if t.tableOptions.Ttl != "" {
+		config.Ttl = t.tableOptions.Ttl
+	}
+	if t.tableOptions.Settings != "" {
+		config.Settings = t.tableOptions.Settings
+	}
+	// ClickHouse rejects Nullable sorting keys unless they're allowed explicitly
+	if t.tableOptions.nullableOrderBy && !strings.Contains(config.Settings, "allow_nullable_key") {
+		if config.Settings != "" {
+			config.Settings += ", "
+		}
+		config.Settings += "allow_nullable_key = 1"
+	}
+	return &config
+}
+
+func parseTemplateContent(name string, definition types.JSON) (templateContent, error) {
+	var content templateContent
+	badRequest := func(format string, args ...any) error {
+		return fmt.Errorf("%w: template [%s]: %s", quesma_errors.ErrCouldNotParseRequest(), name, fmt.Sprintf(format, args...))
+	}
+
+	if metaRaw, exists := definition["_meta"]; exists {
+		meta, ok := metaRaw.(map[string]any)
+		if !ok {
+			return content, badRequest("[_meta] must be an object")
+		}
+		if quesmaMeta, exists := meta["quesma"]; exists {
+			options, ok := quesmaMeta.(map[string]any)
+			if !ok {
+				return content, badRequest("[_meta.quesma] must be an object")
+			}
+			for key, value := range options {
+				if !slices.Contains(templateTableOptionNames, key) {
+					return content, badRequest("unknown option [_meta.quesma.%s], supported ones are %v", key, templateTableOptionNames)
+				}
+				if _, isString := value.(string); !isString {
+					return content, badRequest("[_meta.quesma.%s] must be a string", key)
+				}
+			}
+			data, _ := json.Marshal(options)
+			if err := json.Unmarshal(data, &content.tableOptions); err != nil {
+				return content, badRequest("invalid [_meta.quesma]: %v", err)
+			}
+			if err := content.tableOptions.validate(); err != nil {
+				return content, badRequest("invalid [_meta.quesma]: %v", err)
+			}
+		}
+	}
+
+	templateRaw, exists := definition["template"]
+	if !exists {
+		return content, nil
+	}
+	template, ok := templateRaw.(map[string]any)
+	if !ok {
+		return content, badRequest("[template] must be an object")
+	}
+
+	if mappingsRaw, exists := template["mappings"]; exists {
+		if content.mappings, ok = mappingsRaw.(map[string]any); !ok {
+			return content, badRequest("[template.mappings] must be an object")
+		}
+	}
+
+	if settingsRaw, exists := template["settings"]; exists {
+		settings, ok := settingsRaw.(map[string]any)
+		if !ok {
+			return content, badRequest("[template.settings] must be an object")
+		}
+		for key, value := range util.FlattenMap(settings, ".") {
+			if strings.TrimPrefix(key, "index.") == "lifecycle.name" {
+				if content.lifecyclePolicy, ok = value.(string); !ok {
+					return content, badRequest("[index.lifecycle.name] must be a string")
+				}
+				continue
+			}
+			if strings.TrimPrefix(key, "index.") != "sort.field" || content.tableOptions.OrderBy != "" {
+				continue
+			}
+			var fields []string
+			switch sortFields := value.(type) {
+			case string:
+				fields = []string{sortFields}
+			case []any:
+				for _, field := range sortFields {
+					if fieldAsString, isString := field.(string); isString {
+						fields = append(fields, fieldAsString)
+					}
+				}
+			}
+			for i, field := range fields {
+				fields[i] = strconv.Quote(util.FieldToColumnEncoder(field))
+			}
+			if len(fields) > 0 {
+				content.tableOptions.OrderBy = "(" + strings.Join(fields, ", ") + ")"
+				content.tableOptions.nullableOrderBy = true
+			}
+		}
+	}
+
+	if lifecycle, ok := template["lifecycle"].(map[string]any); ok && content.tableOptions.Ttl == "" {
+		if retention, ok := lifecycle["data_retention"].(string); ok {
+			duration, err := util.ParseInterval(retention)
+			if err != nil || duration.Seconds() < 1 {
+				return content, badRequest("invalid [template.lifecycle.data_retention]: %s", retention)
+			}
+			content.tableOptions.Ttl = retentionTtl(duration)
+		}
+	}
+	return content, nil
+}
+
+func ParseIndexTemplate(name string, definition types.JSON) (*IndexTemplate, error) {
+	indexPatterns := stringOrStrings(definition["index_patterns"])
+	if len(indexPatterns) == 0 {
+		return nil, fmt.Errorf("%w: index template [%s]: [index_patterns] is required", quesma_errors.ErrCouldNotParseRequest(), name)
+	}
+
+	var priority int64
+	if priorityRaw, exists := definition["priority"]; exists {
+		priorityAsFloat, ok := priorityRaw.(float64)
+		if !ok || priorityAsFloat < 0 || priorityAsFloat != float64(int64(priorityAsFloat)) {
+			return nil, fmt.Errorf("%w: index template [%s]: [priority] must be a non-negative integer", quesma_errors.ErrCouldNotParseRequest(), name)
+		}
+		priority = int64(priorityAsFloat)
+	}
+
+	content, err := parseTemplateContent(name, definition)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexTemplate{
+		Name:          name,
+		IndexPatterns: indexPatterns,
+		Priority:      priority,
+		ComposedOf:    stringOrStrings(definition["composed_of"]),
+		Definition:    definition,
+		content:       content,
+	}, nil
+}
+
+func ParseComponentTemplate(name string, definition types.JSON) (*ComponentTemplate, error) {
+	if _, ok := definition["template"].(map[string]any); !ok {
+		return nil, fmt.Errorf("%w: component template [%s]: [template] is required", quesma_errors.ErrCouldNotParseRequest(), name)
+	}
+	content, err := parseTemplateContent(name, definition)
+	if err != nil {
+		return nil, err
+	}
+	return &ComponentTemplate{Name: name, Definition: definition, content: content}, nil
+}
+
+func stringOrStrings(value any) []string {
+	switch valueTyped := value.(type) {
+	case string:
+		return []string{valueTyped}
+	case []any:
+		var result []string
+		for _, element := range valueTyped {
+			if s, ok := element.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// IndexTemplateRegistry keeps index and component templates
+type IndexTemplateRegistry struct {
+	m          sync.Mutex
+	storage    persistence.JSONDatabase // nil if templates are kept in memory only
+	templates  map[string]*IndexTemplate
+	components map[string]*ComponentTemplate
+}
+
+type storedTemplate struct {
+	Name       string     `json:"name"`
+	Definition types.JSON `json:"definition,omitempty"` // nil if the template has been deleted
+}
+
+func NewIndexTemplateRegistry(storage persistence.JSONDatabase) *IndexTemplateRegistry {
+	r := &IndexTemplateRegistry{
+		storage:    storage,
+		templates:  make(map[string]*IndexTemplate),
+		components: make(map[string]*ComponentTemplate),
+	}
+	r.load()
+	return r
+}
+
+func (r *IndexTemplateRegistry) load() {
+	if r.storage == nil {
+		return
+	}
+	keys, err := r.storage.List()
+	if err != nil {
+		logger.Warn().Msgf("could not load index templates: %v", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := r.storage.Get(key)
+		if err != nil || !ok {
+			logger.Warn().Msgf("could not load index template %s: %v", key, err)
+			continue
+		}
+		var stored storedTemplate
+		if err = json.Unmarshal([]byte(data), &stored); err != nil {
+			logger.Warn().Msgf("could not parse index template %s: %v", key, err)
+			continue
+		}
+		if stored.Definition == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, indexTemplateKeyPrefix):
+			if template, err := ParseIndexTemplate(stored.Name, stored.Definition); err == nil {
+				r.templates[stored.Name] = template
+			} else {
+				logger.Warn().Msgf("could not parse index template %s: %v", key, err)
+			}
+		case strings.HasPrefix(key, componentTemplateKeyPrefix):
+			if component, err := ParseComponentTemplate(stored.Name, stored.Definition); err == nil {
+				r.components[stored.Name] = component
+			} else {
+				logger.Warn().Msgf("could not parse component template %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func (r *IndexTemplateRegistry) store(key, name string, definition types.JSON) error {
+	if r.storage == nil {
+		return nil
+	}
+	data, err := json.Marshal(storedTemplate{Name: name, Definition: definition})
+	if err != nil {
+		return err
+	}
+	if err = r.storage.Put(key, string(data)); err != nil {
+		return fmt.Errorf("could not store template [%s]: %w", name, err)
+	}
+	return nil
+}
+
+func (r *IndexTemplateRegistry) PutIndexTemplate(name string, definition types.JSON) error {
+	template, err := ParseIndexTemplate(name, definition)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	var missing []string
+	for _, component := range template.ComposedOf {
+		if _, exists := r.components[component]; !exists {
+			missing = append(missing, component)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: index template [%s] specifies component templates %v that do not exist", quesma_errors.ErrCouldNotParseRequest(), name, missing)
+	}
+
+	if err = r.store(indexTemplateKeyPrefix+name, name, definition); err != nil {
+		return err
+	}
+	r.templates[name] = template
+	return nil
+}
+
+func (r *IndexTemplateRegistry) PutComponentTemplate(name string, definition types.JSON) error {
+	component, err := ParseComponentTemplate(name, definition)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if err = r.store(componentTemplateKeyPrefix+name, name, definition); err != nil {
+		return err
+	}
+	r.components[name] = component
+	return nil
+}
+
+// DeleteIndexTemplate returns false if there's no such template
+func (r *IndexTemplateRegistry) DeleteIndexTemplate(name string) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, exists := r.templates[name]; !exists {
+		return false, nil
+	}
+	if err := r.store(indexTemplateKeyPrefix+name, name, nil); err != nil {
+		return true, err
+	}
+	delete(r.templates, name)
+	return true, nil
+}
+
+// DeleteComponentTemplate returns false if there's no such template. Templates used by index templates can't be deleted.
+func (r *IndexTemplateRegistry) DeleteComponentTemplate(name string) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, exists := r.components[name]; !exists {
+		return false, nil
+	}
+	var usedBy []string
+	for _, template := range r.templates {
+		for _, component := range template.ComposedOf {
+			if component == name {
+				usedBy = append(usedBy, template.Name)
+			}
+		}
+	}
+	if len(usedBy) > 0 {
+		sort.Strings(usedBy)
+		return true, fmt.Errorf("%w: component template [%s] cannot be removed as it is still in use by index templates %v", quesma_errors.ErrCouldNotParseRequest(), name, usedBy)
+	}
+	if err := r.store(componentTemplateKeyPrefix+name, name, nil); err != nil {
+		return true, err
+	}
+	delete(r.components, name)
+	return true, nil
+}
+
+// FindIndexTemplates returns index templates matching a comma separated list of names (with `*` wildcards), sorted by name
+func (r *IndexTemplateRegistry) FindIndexTemplates(names string) []*IndexTemplate {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var result []*IndexTemplate
+	for name, template := range r.templates {
+		if matchesAnyName(names, name) {
+			result = append(result, template)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// FindComponentTemplates returns component templates matching a comma separated list of names (with `*` wildcards), sorted by name
+func (r *IndexTemplateRegistry) FindComponentTemplates(names string) []*ComponentTemplate {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var result []*ComponentTemplate
+	for name, component := range r.components {
+		if matchesAnyName(names, name) {
+			result = append(result, component)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func matchesAnyName(names, name string) bool {
+	for _, pattern := range strings.Split(names, ",") {
+		if matches, _ := util.IndexPatternMatches(strings.TrimSpace(pattern), name); matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the index template with the highest priority matching the index, merged with its component templates.
+// Templates with equal priority are ordered by name.
+func (r *IndexTemplateRegistry) Resolve(index string) (*ResolvedIndexTemplate, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var best *IndexTemplate
+	for _, template := range r.templates {
+		matches := false
+		for _, pattern := range template.IndexPatterns {
+			if patternMatches, _ := util.IndexPatternMatches(pattern, index); patternMatches {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		if best == nil || template.Priority > best.Priority || (template.Priority == best.Priority && template.Name < best.Name) {
+			best = template
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+
+	// component templates are applied in order, and the index template itself is the last one
+	contents := make([]templateContent, 0, len(best.ComposedOf)+1)
+	for _, name := range best.ComposedOf {
+		if component, exists := r.components[name]; exists {
+			contents = append(contents, component.content)
+		}
+	}
+	contents = append(contents, best.content)
+
+	resolved := &ResolvedIndexTemplate{Name: best.Name, Mappings: map[string]any{}}
+	for _, content := range contents {
+		mergeMaps(resolved.Mappings, content.mappings)
+		resolved.tableOptions = resolved.tableOptions.merge(content.tableOptions)
+		if content.lifecyclePolicy != "" {
+			resolved.LifecyclePolicy = content.lifecyclePolicy
+		}
+	}
+	return resolved, true
+}
+
+// mergeMaps deeply copies `src` into `dst`, values from `src` win
+func mergeMaps(dst, src map[string]any) {
+	for key, value := range src {
+		if srcMap, isMap := value.(map[string]any); isMap {
+			dstMap, isDstMap := dst[key].(map[string]any)
+			if !isDstMap {
+				dstMap = make(map[string]any, len(srcMap))
+				dst[key] = dstMap
+			}
+			mergeMaps(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// applyIndexTemplate is called when a table for a new index is created. It returns the config of the table,
+// and sets the schema of the index to the one from template's mappings, unless the index already has a schema.
+// The lifecycle policy of the template is assigned to the index, unless the index has a policy already.
+func (ip *IngestProcessor) applyIndexTemplate(index string, config *chLib.ChTableConfig) *chLib.ChTableConfig {
+	if ip.indexTemplates == nil {
+		return config
+	}
+	template, found := ip.indexTemplates.Resolve(index)
+	if !found {
+		return config
+	}
+	logger.Info().Msgf("creating table for index %s using index template %s", index, template.Name)
+	if _, hasSchema := ip.schemaRegistry.FindSchema(schema.IndexName(index)); !hasSchema {
+		if columns := template.Columns(); len(columns) > 0 {
+			ip.schemaRegistry.UpdateDynamicConfiguration(schema.IndexName(index), schema.Table{Columns: columns})
+		}
+	}
+	if template.LifecyclePolicy != "" && ip.indexLifecycle != nil && ip.indexLifecycle.IndexPolicy(index) == nil {
+		if _, err := ip.indexLifecycle.SetIndexPolicy(index, template.LifecyclePolicy); err != nil {
+			logger.Warn().Msgf("could not assign lifecycle policy of index template %s to index %s: %v", template.Name, index, err)
+		}
+	}
+	return template.TableConfig(config)
+}
@@ -0,0 +1,182 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/table_resolver"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIndexTemplateResolve(t *testing.T) {
+	storage := persistence.NewStaticJSONDatabase()
+	registry := NewIndexTemplateRegistry(storage)
+
+	require.NoError(t, registry.PutComponentTemplate("logs@mappings", types.MustJSON(`{
+		"template": {"mappings": {"properties": {"host": {"properties": {"name": {"type": "keyword"}}}, "message": {"type": "text"}}}}
+	}`)))
+	require.NoError(t, registry.PutComponentTemplate("logs@settings", types.MustJSON(`{
+		"template": {"settings": {"index": {"sort.field": ["host.name", "@timestamp"], "lifecycle.name": "logs-policy"}}, "lifecycle": {"data_retention": "7d"}},
+		"_meta": {"quesma": {"engine": "ReplacingMergeTree"}}
+	}`)))
+	require.NoError(t, registry.PutIndexTemplate("logs", types.MustJSON(`{
+		"index_patterns": ["logs-*"],
+		"composed_of": ["logs@mappings", "logs@settings"],
+		"template": {"mappings": {"properties": {"message": {"type": "keyword"}, "bytes": {"type": "long"}}}},
+		"_meta": {"quesma": {"partition_by": "toYYYYMM(\"@timestamp\")"}}
+	}`)))
+	require.NoError(t, registry.PutIndexTemplate("logs-nginx", types.MustJSON(`{"index_patterns": "logs-nginx*", "priority": 100}`)))
+
+	resolved, found := registry.Resolve("logs-app")
+	require.True(t, found)
+	assert.Equal(t, "logs", resolved.Name)
+	assert.Equal(t, "logs-policy", resolved.LifecyclePolicy)
+	assert.Equal(t, map[string]schema.Column{
+		"host.name": {Name: "host.name", Type: "keyword"},
+		"message":   {Name: "message", Type: "keyword"},
+		"bytes":     {Name: "bytes", Type: "long"},
+	}, resolved.Columns())
+
+	tableConfig := resolved.TableConfig(NewOnlySchemaFieldsCHConfig("cluster"))
+	assert.Equal(t, "ReplacingMergeTree", tableConfig.Engine)
+	assert.Equal(t, `("host_name", "@timestamp")`, tableConfig.OrderBy)
+	assert.Equal(t, `toYYYYMM("@timestamp")`, tableConfig.PartitionBy)
+	assert.Equal(t, `toDateTime("@timestamp") + INTERVAL 604800 SECOND`, tableConfig.Ttl)
+	assert.Equal(t, "allow_nullable_key = 1", tableConfig.Settings)
+	assert.Equal(t, "cluster", tableConfig.ClusterName)
+
+	resolved, found = registry.Resolve("logs-nginx-1")
+	require.True(t, found)
+	assert.Equal(t, "logs-nginx", resolved.Name)
+	assert.Equal(t, NewOnlySchemaFieldsCHConfig(""), resolved.TableConfig(NewOnlySchemaFieldsCHConfig("")))
+
+	_, found = registry.Resolve("metrics")
+	assert.False(t, found)
+
+	// templates are loaded from the storage
+	reloaded := NewIndexTemplateRegistry(storage)
+	assert.Len(t, reloaded.FindIndexTemplates("*"), 2)
+	assert.Len(t, reloaded.FindComponentTemplates("logs@*"), 2)
+	resolvedAgain, found := reloaded.Resolve("logs-app")
+	require.True(t, found)
+	assert.Equal(t, tableConfig, resolvedAgain.TableConfig(NewOnlySchemaFieldsCHConfig("cluster")))
+
+	// component templates in use can't be deleted
+	found, err := registry.DeleteComponentTemplate("logs@settings")
+	assert.True(t, found)
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+
+	found, err = registry.DeleteIndexTemplate("logs")
+	assert.True(t, found)
+	require.NoError(t, err)
+	found, err = registry.DeleteComponentTemplate("logs@settings")
+	assert.True(t, found)
+	require.NoError(t, err)
+	found, _ = registry.DeleteIndexTemplate("logs")
+	assert.False(t, found)
+
+	_, found = registry.Resolve("logs-app")
+	assert.False(t, found)
+	reloaded = NewIndexTemplateRegistry(storage)
+	assert.Len(t, reloaded.FindIndexTemplates("*"), 1)
+	assert.Len(t, reloaded.FindComponentTemplates("*"), 1)
+}
+
+func TestIndexTemplateInvalid(t *testing.T) {
+	registry := NewIndexTemplateRegistry(nil)
+	for _, definition := range []string{
+		`{"template": {}}`,
+		`{"index_patterns": ["logs-*"], "priority": -1}`,
+		`{"index_patterns": ["logs-*"], "template": {"lifecycle": {"data_retention": "forever"}}}`,
+		`{"index_patterns": ["logs-*"], "_meta": {"quesma": {"engine": 1}}}`,
+		`{"index_patterns": ["logs-*"], "composed_of": ["missing"]}`,
+	} {
+		t.Run(definition, func(t *testing.T) {
+			err := registry.PutIndexTemplate("test", types.MustJSON(definition))
+			assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+		})
+	}
+	err := registry.PutComponentTemplate("test", types.MustJSON(`{"_meta": {}}`))
+	assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+}
+
+func TestIndexTemplateTableOptions(t *testing.T) {
+	registry := NewIndexTemplateRegistry(nil)
+	valid := []string{
+		`{"engine": "ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/logs', '{replica}', \"version\")"}`,
+		`{"order_by": "(\"host_name\", toStartOfHour(\"@timestamp\"))", "primary_key": "\"host_name\""}`,
+		`{"ttl": "toDateTime(\"@timestamp\") + INTERVAL 1 DAY TO VOLUME 'cold', toDateTime(\"@timestamp\") + INTERVAL 1 MONTH DELETE"}`,
+		`{"settings": "index_granularity = 8192, storage_policy = 'tiered', allow_nullable_key = true"}`,
+	}
+	for _, options := range valid {
+		t.Run(options, func(t *testing.T) {
+			assert.NoError(t, registry.PutIndexTemplate("test", types.MustJSON(`{"index_patterns": ["logs-*"], "_meta": {"quesma": `+options+`}}`)))
+		})
+	}
+
+	// options are put into CREATE TABLE as they are, so they can't be anything
+	invalid := []string{
+		`{"comment": "hello"}`,
+		`{"engine": "File(JSONEachRow, '/etc/passwd')"}`,
+		`{"engine": "MergeTree ORDER BY tuple()"}`,
+		`{"order_by": "(\"@timestamp\")) SETTINGS index_granularity = 1 --"}`,
+		`{"order_by": "\"@timestamp\"; DROP TABLE logs"}`,
+		`{"order_by": "\"@timestamp\" /* comment */"}`,
+		`{"partition_by": "(SELECT 1)"}`,
+		`{"primary_key": "\"@timestamp\" COMMENT 'x'"}`,
+		`{"ttl": "toDateTime(\"@timestamp\" + INTERVAL 1 DAY"}`,
+		`{"settings": "index_granularity = toUInt64(1)"}`,
+		`{"settings": "index_granularity 8192"}`,
+	}
+	for _, options := range invalid {
+		t.Run(options, func(t *testing.T) {
+			err := registry.PutIndexTemplate("test", types.MustJSON(`{"index_patterns": ["logs-*"], "_meta": {"quesma": `+options+`}}`))
+			assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()), err)
+		})
+	}
+}
+
+func TestCreateTableFromIndexTemplate(t *testing.T) {
+	const indexName = "logs-app"
+	quesmaConfig := &config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{indexName: {}}}
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[indexName] = &mux.Decision{
+		UseConnectors: []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{ClickhouseTableName: indexName}},
+	}
+	schemaRegistry := &schema.StaticRegistry{DynamicConfiguration: make(map[string]schema.Table)}
+
+	ip := newIngestProcessorWithEmptyTableMap(NewTableMap(), quesmaConfig)
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	ip.schemaRegistry = schemaRegistry
+	ip.tableResolver = resolver
+	ip.indexTemplates = NewIndexTemplateRegistry(nil)
+	require.NoError(t, ip.IndexTemplates().PutIndexTemplate("logs", types.MustJSON(`{
+		"index_patterns": ["logs-*"],
+		"template": {"mappings": {"properties": {"message": {"type": "keyword"}}}, "settings": {"index.sort.field": "@timestamp"}},
+		"_meta": {"quesma": {"engine": "ReplacingMergeTree", "partition_by": "toYYYYMM(\"@timestamp\")", "ttl": "toDateTime(\"@timestamp\") + INTERVAL 1 MONTH"}}
+	}`)))
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "logs-app" ( "@timestamp" DateTime64(3) DEFAULT now64(), "attributes_values" Map(String,String), "attributes_metadata" Map(String,String), "message" Nullable(String) COMMENT 'quesmaMetadataV1:fieldName=message', "__quesma_ingest_time" DateTime64(3) DEFAULT now64(3) ) ENGINE = ReplacingMergeTree ORDER BY ("@timestamp") PARTITION BY toYYYYMM("@timestamp") TTL toDateTime("@timestamp") + INTERVAL 1 MONTH SETTINGS allow_nullable_key = 1 COMMENT 'created by Quesma'`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO "logs-app" FORMAT JSONEachRow {"message":"hello"}`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = ip.ProcessInsertQuery(context.Background(), indexName, []types.JSON{{"message": "hello"}}, IngestTransformerFor(indexName, quesmaConfig), DefaultColumnNameFormatter())
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, schema.Table{Columns: map[string]schema.Column{"message": {Name: "message", Type: "keyword"}}}, schemaRegistry.DynamicConfiguration[indexName])
+}
@@ -0,0 +1,266 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/recovery"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ingest buffer (the `ingestBuffer` option of the ingest processor) batches documents of many small ingest requests,
+// so ClickHouse gets fewer, bigger inserts and doesn't end up with too many parts.
+// Documents are acknowledged once they're written to the write-ahead log, and inserted when a batch
+// of an index is big enough or the flush interval passes. When the buffer is full, ingest requests are rejected
+// with ErrIngestBufferFull, translated to 429 Too Many Requests, so clients retry later.
+// Acknowledged documents are never dropped: a batch failing to insert stays buffered (and in the log) until it's
+// inserted, unless the dead letter queue is enabled, then it's stored there after the first failure.
+
+var ErrIngestBufferFull = errors.New("ingest buffer is full, retry later")
+
+const finalFlushTimeout = 30 * time.Second
+
+type (
+	ingestBuffer struct {
+		ip      *IngestProcessor
+		cfg     *config.IngestBufferConfiguration
+		m       sync.Mutex
+		batches map[string]*ingestBatch // by index name
+		// buffered counts documents in batches and being flushed, it's limited by cfg.BufferedDocs()
+		buffered int
+		wal      *writeAheadLog // nil if documents are kept only in memory
+		walErr   error          // the write-ahead log couldn't be opened, ingest is rejected
+		closed   bool
+		flushM   sync.Mutex // one flush at a time
+		flushCh  chan struct{}
+		running  sync.WaitGroup
+	}
+	ingestBatch struct {
+		documents []types.JSON
+		attempts  int
+	}
+)
+
+func newIngestBuffer(cfg *config.IngestBufferConfiguration, ip *IngestProcessor) *ingestBuffer {
+	if cfg == nil {
+		return nil
+	}
+	b := &ingestBuffer{ip: ip, cfg: cfg, batches: make(map[string]*ingestBatch), flushCh: make(chan struct{}, 1)}
+	if cfg.WriteAheadLogPath == "" {
+		return b
+	}
+	wal, records, err := openWriteAheadLog(cfg.WriteAheadLogPath, !cfg.DisableWALSync)
+	if err != nil {
+		logger.Error().Msgf("could not open the ingest write-ahead log %s, ingest will be rejected: %v", cfg.WriteAheadLogPath, err)
+		b.walErr = fmt.Errorf("ingest write-ahead log is not available: %w", err)
+		return b
+	}
+	b.wal = wal
+	recovered := 0
+	for _, record := range records {
+		b.batch(record.Index).documents = append(b.batch(record.Index).documents, record.Documents...)
+		recovered += len(record.Documents)
+	}
+	if recovered > 0 {
+		logger.Info().Msgf("recovered %d documents from the ingest write-ahead log %s", recovered, cfg.WriteAheadLogPath)
+		b.buffered = recovered
+		stats.GlobalIngestBuffer.AddRecovered(int64(recovered))
+		stats.GlobalIngestBuffer.AddBuffered(int64(recovered))
+	}
+	return b
+}
+
+func (b *ingestBuffer) batch(index string) *ingestBatch {
+	batch, ok := b.batches[index]
+	if !ok {
+		batch = &ingestBatch{}
+		b.batches[index] = batch
+	}
+	return batch
+}
+
+// add returns once documents are buffered and written to the write-ahead log
+func (b *ingestBuffer) add(index string, documents []types.JSON) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.walErr != nil {
+		return b.walErr
+	}
+	if b.closed {
+		return errors.New("ingest buffer is closed, Quesma is stopping")
+	}
+	if b.buffered+len(documents) > b.cfg.BufferedDocs() {
+		stats.GlobalIngestBuffer.AddRejected(int64(len(documents)))
+		return ErrIngestBufferFull
+	}
+	if b.wal != nil {
+		if err := b.wal.append(index, documents); err != nil {
+			return fmt.Errorf("could not write documents to the ingest write-ahead log: %w", err)
+		}
+	}
+	batch := b.batch(index)
+	batch.documents = append(batch.documents, documents...)
+	b.buffered += len(documents)
+	stats.GlobalIngestBuffer.AddBuffered(int64(len(documents)))
+	if len(batch.documents) >= b.cfg.BatchSize() {
+		select {
+		case b.flushCh <- struct{}{}:
+		default: // a flush is already requested
+		}
+	}
+	return nil
+}
+
+func (b *ingestBuffer) start(ctx context.Context) {
+	b.running.Add(1)
+	go func() {
+		defer recovery.LogPanic()
+		defer b.running.Done()
+		ticker := time.NewTicker(b.cfg.Interval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// the processor context is cancelled already, buffered documents are inserted with a new one
+				finalCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+				b.flush(finalCtx)
+				cancel()
+				b.close()
+				return
+			case <-ticker.C:
+				b.flush(ctx)
+			case <-b.flushCh:
+				b.flush(ctx)
+			}
+		}
+	}()
+}
+
+// wait returns after the final flush, when the buffer was started
+func (b *ingestBuffer) wait() {
+	b.running.Wait()
+}
+
+func (b *ingestBuffer) close() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.closed = true
+	if b.wal == nil && b.buffered > 0 {
+		logger.Error().Msgf("%d buffered documents could not be inserted before Quesma stopped, they are lost without the write-ahead log", b.buffered)
+		stats.GlobalIngestBuffer.AddLost(int64(b.buffered))
+	}
+	if b.wal != nil {
+		if err := b.wal.close(); err != nil {
+			logger.Error().Msgf("could not close the ingest write-ahead log: %v", err)
+		}
+	}
+}
+
+// flush inserts all buffered documents. Batches failing with the dead letter queue disabled are kept in the buffer,
+// and retried with the next flush. They're written to the write-ahead log again, before the sealed segments
+// holding them are removed.
+func (b *ingestBuffer) flush(ctx context.Context) {
+	b.flushM.Lock()
+	defer b.flushM.Unlock()
+
+	b.m.Lock()
+	batches := b.batches
+	b.batches = make(map[string]*ingestBatch)
+	var sealed []string
+	if b.wal != nil {
+		var err error
+		if sealed, err = b.wal.seal(); err != nil {
+			logger.ErrorWithCtx(ctx).Msgf("could not seal the ingest write-ahead log segment: %v", err)
+		}
+	}
+	b.m.Unlock()
+
+	indexes := make([]string, 0, len(batches))
+	for index := range batches {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+
+	walRequeueFailed := false
+	for _, index := range indexes {
+		batch := batches[index]
+		batch.attempts++
+		retry := !b.ip.DeadLetterQueueEnabled()
+		documents := batch.documents
+		if retry {
+			// ingest modifies documents in place
+			documents = make([]types.JSON, 0, len(batch.documents))
+			for _, document := range batch.documents {
+				documents = append(documents, document.Clone())
+			}
+		}
+
+		err := b.ip.ingest(ctx, index, documents)
+		switch {
+		case err == nil:
+			stats.GlobalIngestBuffer.AddFlush(int64(len(documents)))
+		case retry:
+			logger.ErrorWithCtx(ctx).Msgf("could not insert %d buffered documents into index %s (attempt %d), they will be inserted with the next flush: %v", len(documents), index, batch.attempts, err)
+			if !b.requeue(index, batch) {
+				walRequeueFailed = true
+			}
+			continue
+		default:
+			logger.ErrorWithCtx(ctx).Msgf("could not insert %d buffered documents into index %s, they were stored in the dead letter queue: %v", len(documents), index, err)
+		}
+
+		b.m.Lock()
+		b.buffered -= len(documents)
+		b.m.Unlock()
+		stats.GlobalIngestBuffer.AddBuffered(-int64(len(documents)))
+	}
+
+	if b.wal != nil {
+		if walRequeueFailed {
+			// sealed segments are recovered after a restart then, some documents may be inserted twice, but none is lost
+			logger.ErrorWithCtx(ctx).Msgf("keeping sealed ingest write-ahead log segments %v, as failed batches couldn't be written to the log again", sealed)
+			b.m.Lock()
+			b.wal.keep(sealed)
+			b.m.Unlock()
+		} else {
+			b.wal.remove(sealed)
+		}
+	}
+}
+
+// requeue puts a failed batch back, before documents buffered in the meantime.
+// It returns false if the batch couldn't be written to the write-ahead log again.
+func (b *ingestBuffer) requeue(index string, batch *ingestBatch) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	logged := true
+	if b.wal != nil {
+		if err := b.wal.append(index, batch.documents); err != nil {
+			logger.Error().Msgf("could not write %d buffered documents of index %s to the ingest write-ahead log again: %v", len(batch.documents), index, err)
+			logged = false
+		}
+	}
+	if newer, ok := b.batches[index]; ok {
+		batch.documents = append(batch.documents, newer.documents...)
+	}
+	b.batches[index] = batch
+	return logged
+}
+
+// FlushIngestBuffer inserts buffered documents right away, e.g. before documents are updated or deleted
+func (ip *IngestProcessor) FlushIngestBuffer(ctx context.Context) {
+	if ip.ingestBuffer != nil {
+		ip.ingestBuffer.flush(ctx)
+	}
+}
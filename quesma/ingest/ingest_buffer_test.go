@@ -0,0 +1,129 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestIngestBufferBatchesDocuments(t *testing.T) {
+	const indexName = "buffered_logs"
+	ip, mock := newDeadLetterTestProcessor(t, indexName, nil)
+	ip.ingestBuffer = newIngestBuffer(&config.IngestBufferConfiguration{MaxBufferedDocs: 3}, ip)
+	ctx := context.Background()
+
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "a"}}))
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "b"}, {"message": "c"}}))
+	assert.ErrorIs(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "d"}}), ErrIngestBufferFull)
+
+	// documents of both requests are inserted at once
+	mock.ExpectExec(`INSERT INTO "buffered_logs" FORMAT JSONEachRow {"message":"a"}, {"message":"b"}, {"message":"c"}`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	ip.FlushIngestBuffer(ctx)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "d"}}))
+	assert.Equal(t, 1, ip.ingestBuffer.buffered)
+}
+
+func TestIngestBufferRetriesFailedBatches(t *testing.T) {
+	const indexName = "buffered_logs"
+	ip, mock := newDeadLetterTestProcessor(t, indexName, nil)
+	ip.ingestBuffer = newIngestBuffer(&config.IngestBufferConfiguration{}, ip)
+	ctx := context.Background()
+
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "a"}}))
+	mock.ExpectExec(`INSERT INTO "buffered_logs"`).WillReturnError(errors.New("too many parts"))
+	ip.FlushIngestBuffer(ctx)
+
+	// the failed batch goes before documents buffered later
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "b"}}))
+	mock.ExpectExec(`INSERT INTO "buffered_logs" FORMAT JSONEachRow {"message":"a"}, {"message":"b"}`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	ip.FlushIngestBuffer(ctx)
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 0, ip.ingestBuffer.buffered)
+}
+
+func TestIngestBufferKeepsFailedBatchesInWriteAheadLog(t *testing.T) {
+	const indexName = "buffered_logs"
+	cfg := &config.IngestBufferConfiguration{WriteAheadLogPath: t.TempDir()}
+	ctx := context.Background()
+
+	ip, mock := newDeadLetterTestProcessor(t, indexName, nil)
+	ip.ingestBuffer = newIngestBuffer(cfg, ip)
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "a"}}))
+	// ClickHouse is down for longer, documents are never dropped
+	for i := 0; i < 5; i++ {
+		mock.ExpectExec(`INSERT INTO "buffered_logs"`).WillReturnError(errors.New("connection refused"))
+		ip.FlushIngestBuffer(ctx)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, ip.ingestBuffer.buffered)
+	// Quesma stops without inserting them
+
+	restarted, mock := newDeadLetterTestProcessor(t, indexName, nil)
+	restarted.ingestBuffer = newIngestBuffer(cfg, restarted)
+	assert.Equal(t, 1, restarted.ingestBuffer.buffered)
+	mock.ExpectExec(`INSERT INTO "buffered_logs" FORMAT JSONEachRow {"message":"a"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	restarted.FlushIngestBuffer(ctx)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngestBufferWriteAheadLog(t *testing.T) {
+	const indexName = "buffered_logs"
+	dir := t.TempDir()
+	cfg := &config.IngestBufferConfiguration{WriteAheadLogPath: dir}
+	ctx := context.Background()
+
+	ip, _ := newDeadLetterTestProcessor(t, indexName, nil)
+	ip.ingestBuffer = newIngestBuffer(cfg, ip)
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "a"}}))
+	require.NoError(t, ip.Ingest(ctx, indexName, []types.JSON{{"message": "b"}}))
+	// Quesma stops without flushing the buffer
+
+	restarted, mock := newDeadLetterTestProcessor(t, indexName, nil)
+	restarted.ingestBuffer = newIngestBuffer(cfg, restarted)
+	assert.Equal(t, 2, restarted.ingestBuffer.buffered)
+	require.NoError(t, restarted.Ingest(ctx, indexName, []types.JSON{{"message": "c"}}))
+
+	mock.ExpectExec(`INSERT INTO "buffered_logs" FORMAT JSONEachRow {"message":"a"}, {"message":"b"}, {"message":"c"}`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	restarted.FlushIngestBuffer(ctx)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// inserted documents are removed from the log
+	restarted.ingestBuffer.close()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestWriteAheadLogSealFailureKeepsActiveSegment(t *testing.T) {
+	dir := t.TempDir()
+	wal, _, err := openWriteAheadLog(dir, true)
+	require.NoError(t, err)
+	require.NoError(t, wal.append("logs", []types.JSON{{"message": "a"}}))
+
+	// a new segment can't be created
+	require.NoError(t, os.RemoveAll(dir))
+	sealed, err := wal.seal()
+	assert.Error(t, err)
+	assert.Empty(t, sealed)
+	assert.NoError(t, wal.append("logs", []types.JSON{{"message": "b"}}))
+
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	sealed, err = wal.seal()
+	require.NoError(t, err)
+	assert.Len(t, sealed, 1)
+	require.NoError(t, wal.close())
+}
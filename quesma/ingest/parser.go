@@ -137,6 +137,9 @@ func SchemaToColumns(schemaMapping *schema.Schema, nameFormatter TableColumNameF
 			resultColumns[schema.FieldName(lat)] = CreateTableEntry{ClickHouseColumnName: lat, ClickHouseType: "Nullable(String)"}
 			resultColumns[schema.FieldName(lon)] = CreateTableEntry{ClickHouseColumnName: lon, ClickHouseType: "Nullable(String)"}
 			continue
+		case schema.QuesmaTypeNested.Name:
+			// nested documents are stored as Array(Tuple(...)), its elements' types are inferred from the first ingested document
+			continue
 
 		// Simple types:
 		case schema.QuesmaTypeText.Name:
@@ -0,0 +1,290 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ingest pipelines transform documents before they are inserted into ClickHouse,
+// like Elasticsearch ingest pipelines: https://www.elastic.co/guide/en/elasticsearch/reference/current/ingest.html
+// Each processor is an IngestTransformer, see pipeline_processors.go.
+
+const IngestPipelinesElasticIndexName = "quesma_ingest_pipelines"
+
+const (
+	NoPipeline = "_none" // `?pipeline=_none` disables the default pipeline of the index
+
+	ingestMetadataField = "_ingest"
+)
+
+type Pipeline struct {
+	Id          string
+	Description string
+	Processors  []*PipelineProcessor
+	OnFailure   []*PipelineProcessor
+	Definition  types.JSON // as provided by the user, returned by `GET /_ingest/pipeline/:id`
+}
+
+type PipelineProcessor struct {
+	Type          string
+	Tag           string
+	IgnoreFailure bool
+	OnFailure     []*PipelineProcessor
+	transformer   IngestTransformer
+}
+
+// processorError remembers which processor failed, it's exposed to `on_failure` processors in `_ingest` metadata
+type processorError struct {
+	processor *PipelineProcessor
+	err       error
+}
+
+func (e *processorError) Error() string {
+	return e.err.Error()
+}
+
+func (e *processorError) Unwrap() error {
+	return e.err
+}
+
+func ParsePipeline(id string, definition types.JSON) (*Pipeline, error) {
+	pipeline := &Pipeline{Id: id, Definition: definition}
+	pipeline.Description, _ = definition["description"].(string)
+
+	var err error
+	if pipeline.Processors, err = parseProcessors(definition["processors"]); err != nil {
+		return nil, err
+	}
+	if pipeline.OnFailure, err = parseProcessors(definition["on_failure"]); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+func parseProcessors(definition any) ([]*PipelineProcessor, error) {
+	if definition == nil {
+		return nil, nil
+	}
+	definitions, ok := definition.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: processors must be an array, got %T", quesma_errors.ErrCouldNotParseRequest(), definition)
+	}
+
+	processors := make([]*PipelineProcessor, 0, len(definitions))
+	for _, d := range definitions {
+		processorDefinition, ok := d.(map[string]any)
+		if !ok || len(processorDefinition) != 1 {
+			return nil, fmt.Errorf("%w: processor must be an object with a single key, got %v", quesma_errors.ErrCouldNotParseRequest(), d)
+		}
+		for processorType, config := range processorDefinition {
+			processor, err := parseProcessor(processorType, config)
+			if err != nil {
+				return nil, err
+			}
+			processors = append(processors, processor)
+		}
+	}
+	return processors, nil
+}
+
+func parseProcessor(processorType string, definition any) (*PipelineProcessor, error) {
+	config, ok := definition.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s] processor config must be an object", quesma_errors.ErrCouldNotParseRequest(), processorType)
+	}
+	if _, ok := config["if"]; ok {
+		return nil, fmt.Errorf("%w: [%s] conditional processors ([if]) are not supported", quesma_errors.ErrCouldNotParseRequest(), processorType)
+	}
+
+	newTransformer, ok := processorFactories[processorType]
+	if !ok {
+		return nil, fmt.Errorf("%w: No processor type exists with name [%s]", quesma_errors.ErrCouldNotParseRequest(), processorType)
+	}
+	transformer, err := newTransformer(processorConfig(config))
+	if err != nil {
+		return nil, fmt.Errorf("%w: [%s] %v", quesma_errors.ErrCouldNotParseRequest(), processorType, err)
+	}
+
+	processor := &PipelineProcessor{Type: processorType, transformer: transformer}
+	processor.Tag, _ = config["tag"].(string)
+	processor.IgnoreFailure, _ = config["ignore_failure"].(bool)
+	if processor.OnFailure, err = parseProcessors(config["on_failure"]); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+// Transform runs the pipeline on the document. The document is modified in place.
+//
+// When a processor fails:
+//   - with `ignore_failure` the failure is ignored,
+//   - with its own `on_failure` processors, they are run, and the pipeline continues,
+//   - otherwise pipeline's `on_failure` processors are run and the pipeline stops,
+//   - if there are none, the whole document fails.
+func (p *Pipeline) Transform(document types.JSON) (types.JSON, error) {
+	document[ingestMetadataField] = map[string]any{"timestamp": time.Now().UTC().Format(time.RFC3339Nano)}
+	defer delete(document, ingestMetadataField)
+
+	document, err := runProcessors(p.Processors, document)
+	if err != nil && len(p.OnFailure) > 0 {
+		setFailureMetadata(document, err)
+		document, err = runProcessors(p.OnFailure, document)
+	}
+	return document, err
+}
+
+func runProcessors(processors []*PipelineProcessor, document types.JSON) (types.JSON, error) {
+	for _, processor := range processors {
+		result, err := processor.transformer.Transform(document)
+		if err == nil {
+			document = result
+			continue
+		}
+
+		err = &processorError{processor: processor, err: err}
+		switch {
+		case processor.IgnoreFailure:
+		case len(processor.OnFailure) > 0:
+			setFailureMetadata(document, err)
+			if document, err = runProcessors(processor.OnFailure, document); err != nil {
+				return document, err
+			}
+		default:
+			return document, err
+		}
+	}
+	return document, nil
+}
+
+func setFailureMetadata(document types.JSON, err error) {
+	metadata, ok := document[ingestMetadataField].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		document[ingestMetadataField] = metadata
+	}
+	metadata["on_failure_message"] = err.Error()
+
+	var processorErr *processorError
+	if errors.As(err, &processorErr) {
+		metadata["on_failure_processor_type"] = processorErr.processor.Type
+		if processorErr.processor.Tag != "" {
+			metadata["on_failure_processor_tag"] = processorErr.processor.Tag
+		}
+	}
+}
+
+// PipelineRegistry keeps pipelines created with `PUT /_ingest/pipeline/:id`.
+// They are stored in a JSONDatabase, one entry per pipeline.
+type PipelineRegistry struct {
+	m         sync.Mutex               // serializes updates of storage and pipelines
+	storage   persistence.JSONDatabase // nil if pipelines are kept in memory only
+	pipelines *util.SyncMap[string, *Pipeline]
+}
+
+type storedPipeline struct {
+	Id         string     `json:"id"`
+	Definition types.JSON `json:"definition"`
+}
+
+func NewPipelineRegistry(storage persistence.JSONDatabase) *PipelineRegistry {
+	r := &PipelineRegistry{storage: storage, pipelines: util.NewSyncMap[string, *Pipeline]()}
+	r.load()
+	return r
+}
+
+func (r *PipelineRegistry) load() {
+	if r.storage == nil {
+		return
+	}
+	keys, err := r.storage.List()
+	if err != nil {
+		logger.Warn().Msgf("could not load ingest pipelines: %v", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := r.storage.Get(key)
+		if err != nil || !ok {
+			logger.Warn().Msgf("could not load ingest pipeline %s: %v", key, err)
+			continue
+		}
+		var stored storedPipeline
+		if err = json.Unmarshal([]byte(data), &stored); err != nil {
+			logger.Warn().Msgf("could not parse ingest pipeline %s: %v", key, err)
+			continue
+		}
+		if pipeline, err := ParsePipeline(stored.Id, stored.Definition); err == nil {
+			r.pipelines.Store(stored.Id, pipeline)
+		} else {
+			logger.Warn().Msgf("could not parse ingest pipeline %s: %v", key, err)
+		}
+	}
+}
+
+func (r *PipelineRegistry) Put(id string, definition types.JSON) error {
+	pipeline, err := ParsePipeline(id, definition)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.storage != nil {
+		data, err := json.Marshal(storedPipeline{Id: id, Definition: definition})
+		if err != nil {
+			return err
+		}
+		if err = r.storage.Put(id, string(data)); err != nil {
+			return fmt.Errorf("could not store pipeline [%s]: %w", id, err)
+		}
+	}
+	r.pipelines.Store(id, pipeline)
+	return nil
+}
+
+func (r *PipelineRegistry) Get(id string) (*Pipeline, bool) {
+	return r.pipelines.Load(id)
+}
+
+// Delete returns false if there's no such pipeline
+func (r *PipelineRegistry) Delete(id string) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, exists := r.pipelines.Load(id); !exists {
+		return false, nil
+	}
+	if r.storage != nil {
+		if err := r.storage.Delete(id); err != nil {
+			return true, fmt.Errorf("could not delete pipeline [%s]: %w", id, err)
+		}
+	}
+	r.pipelines.Delete(id)
+	return true, nil
+}
+
+// Find returns pipelines matching a comma separated list of ids (with `*` wildcards), sorted by id
+func (r *PipelineRegistry) Find(ids string) []*Pipeline {
+	var result []*Pipeline
+	r.pipelines.Range(func(id string, pipeline *Pipeline) bool {
+		for _, pattern := range strings.Split(ids, ",") {
+			if matches, _ := util.IndexPatternMatches(strings.TrimSpace(pattern), id); matches {
+				result = append(result, pipeline)
+				break
+			}
+		}
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
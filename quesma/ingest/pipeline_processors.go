@@ -0,0 +1,820 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util/grok"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processorFactories are the supported Elasticsearch ingest processors,
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/processors.html
+var processorFactories = map[string]func(config processorConfig) (IngestTransformer, error){
+	"set":     newSetProcessor,
+	"remove":  newRemoveProcessor,
+	"rename":  newRenameProcessor,
+	"convert": newConvertProcessor,
+	"date":    newDateProcessor,
+	"grok":    newGrokProcessor,
+	"dissect": newDissectProcessor,
+}
+
+type processorConfig map[string]any
+
+func (c processorConfig) requiredString(key string) (string, error) {
+	value, ok := c[key]
+	if !ok {
+		return "", fmt.Errorf("[%s] required property is missing", key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("[%s] property isn't a string, but of type [%T]", key, value)
+	}
+	return s, nil
+}
+
+func (c processorConfig) optionalString(key, defaultValue string) (string, error) {
+	if _, ok := c[key]; !ok {
+		return defaultValue, nil
+	}
+	return c.requiredString(key)
+}
+
+func (c processorConfig) optionalBool(key string, defaultValue bool) (bool, error) {
+	value, ok := c[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("[%s] property isn't a boolean, but of type [%T]", key, value)
+	}
+	return b, nil
+}
+
+// requiredStrings accepts both a single string and an array of strings
+func (c processorConfig) requiredStrings(key string) ([]string, error) {
+	value, ok := c[key]
+	if !ok {
+		return nil, fmt.Errorf("[%s] required property is missing", key)
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, element := range v {
+			s, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("[%s] property must contain strings only, got [%T]", key, element)
+			}
+			result = append(result, s)
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("[%s] property must not be empty", key)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("[%s] property isn't a string or an array, but of type [%T]", key, value)
+	}
+}
+
+// Fields are referenced by dotted paths, e.g. `client.ip` is either a `client.ip` key
+// or an `ip` key of a `client` object.
+
+func getField(document map[string]any, path string) (any, bool) {
+	if value, ok := document[path]; ok {
+		return value, true
+	}
+	for i := strings.IndexByte(path, '.'); i >= 0; i = nextDot(path, i) {
+		if nested, ok := document[path[:i]].(map[string]any); ok {
+			if value, ok := getField(nested, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func setField(document map[string]any, path string, value any) error {
+	if _, ok := document[path]; ok {
+		document[path] = value
+		return nil
+	}
+	for i := strings.IndexByte(path, '.'); i >= 0; i = nextDot(path, i) {
+		if nested, ok := document[path[:i]].(map[string]any); ok {
+			return setField(nested, path[i+1:], value)
+		}
+	}
+
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		document[path] = value
+		return nil
+	}
+	if existing, ok := document[head]; ok && existing != nil {
+		return fmt.Errorf("cannot set [%s] with parent object of type [%T] as part of path [%s]", rest, existing, path)
+	}
+	child := map[string]any{}
+	document[head] = child
+	return setField(child, rest, value)
+}
+
+func removeField(document map[string]any, path string) bool {
+	if _, ok := document[path]; ok {
+		delete(document, path)
+		return true
+	}
+	for i := strings.IndexByte(path, '.'); i >= 0; i = nextDot(path, i) {
+		if nested, ok := document[path[:i]].(map[string]any); ok && removeField(nested, path[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func nextDot(path string, previous int) int {
+	next := strings.IndexByte(path[previous+1:], '.')
+	if next < 0 {
+		return -1
+	}
+	return previous + 1 + next
+}
+
+func errFieldMissing(field string) error {
+	return fmt.Errorf("field [%s] not present as part of path [%s]", field, field)
+}
+
+// getSourceField returns a value of the processed field, with `ignore_missing` a missing field (or null) is not an error
+func getSourceField(document types.JSON, field string, ignoreMissing bool) (value any, skip bool, err error) {
+	value, ok := getField(document, field)
+	if ok && value != nil {
+		return value, false, nil
+	}
+	if ignoreMissing {
+		return nil, true, nil
+	}
+	if ok {
+		return nil, false, fmt.Errorf("field [%s] is null, cannot process it", field)
+	}
+	return nil, false, errFieldMissing(field)
+}
+
+var templateRegex = regexp.MustCompile(`\{\{\{?\s*([^{}\s]+)\s*}?}}`)
+
+// renderTemplate substitutes `{{field}}` (and `{{{field}}}`) with field values, missing fields are rendered empty
+func renderTemplate(template string, document types.JSON) string {
+	return templateRegex.ReplaceAllStringFunc(template, func(match string) string {
+		field := templateRegex.FindStringSubmatch(match)[1]
+		value, ok := getField(document, field)
+		if !ok || value == nil {
+			return ""
+		}
+		return stringValue(value)
+	})
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+type setProcessor struct {
+	field            string
+	value            any
+	copyFrom         string
+	override         bool
+	ignoreEmptyValue bool
+}
+
+func newSetProcessor(config processorConfig) (IngestTransformer, error) {
+	var p setProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.copyFrom, err = config.optionalString("copy_from", ""); err != nil {
+		return nil, err
+	}
+	value, hasValue := config["value"]
+	if hasValue == (p.copyFrom != "") {
+		return nil, fmt.Errorf("exactly one of [value] or [copy_from] must be specified")
+	}
+	p.value = value
+	if p.override, err = config.optionalBool("override", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreEmptyValue, err = config.optionalBool("ignore_empty_value", false); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *setProcessor) Transform(document types.JSON) (types.JSON, error) {
+	var value any
+	if p.copyFrom != "" {
+		var ok bool
+		if value, ok = getField(document, p.copyFrom); !ok {
+			return document, errFieldMissing(p.copyFrom)
+		}
+	} else {
+		value = renderTemplates(p.value, document)
+	}
+
+	if p.ignoreEmptyValue && (value == nil || value == "") {
+		return document, nil
+	}
+	if !p.override {
+		if existing, ok := getField(document, p.field); ok && existing != nil {
+			return document, nil
+		}
+	}
+	return document, setField(document, p.field, value)
+}
+
+func renderTemplates(value any, document types.JSON) any {
+	switch v := value.(type) {
+	case string:
+		return renderTemplate(v, document)
+	case []any:
+		result := make([]any, len(v))
+		for i, element := range v {
+			result[i] = renderTemplates(element, document)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, element := range v {
+			result[key] = renderTemplates(element, document)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+type removeProcessor struct {
+	fields        []string
+	ignoreMissing bool
+}
+
+func newRemoveProcessor(config processorConfig) (IngestTransformer, error) {
+	var p removeProcessor
+	var err error
+	if p.fields, err = config.requiredStrings("field"); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = config.optionalBool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *removeProcessor) Transform(document types.JSON) (types.JSON, error) {
+	for _, field := range p.fields {
+		if !removeField(document, field) && !p.ignoreMissing {
+			return document, errFieldMissing(field)
+		}
+	}
+	return document, nil
+}
+
+type renameProcessor struct {
+	field         string
+	targetField   string
+	ignoreMissing bool
+	override      bool
+}
+
+func newRenameProcessor(config processorConfig) (IngestTransformer, error) {
+	var p renameProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.targetField, err = config.requiredString("target_field"); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = config.optionalBool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if p.override, err = config.optionalBool("override", false); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *renameProcessor) Transform(document types.JSON) (types.JSON, error) {
+	value, ok := getField(document, p.field)
+	if !ok {
+		if p.ignoreMissing {
+			return document, nil
+		}
+		return document, errFieldMissing(p.field)
+	}
+	if _, exists := getField(document, p.targetField); exists && !p.override {
+		return document, fmt.Errorf("field [%s] already exists", p.targetField)
+	}
+	removeField(document, p.field)
+	return document, setField(document, p.targetField, value)
+}
+
+type convertProcessor struct {
+	field         string
+	targetField   string
+	targetType    string
+	ignoreMissing bool
+}
+
+func newConvertProcessor(config processorConfig) (IngestTransformer, error) {
+	var p convertProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.targetField, err = config.optionalString("target_field", p.field); err != nil {
+		return nil, err
+	}
+	if p.targetType, err = config.requiredString("type"); err != nil {
+		return nil, err
+	}
+	switch p.targetType {
+	case "integer", "long", "float", "double", "boolean", "string", "ip", "auto":
+	default:
+		return nil, fmt.Errorf("type [%s] not supported, cannot convert field", p.targetType)
+	}
+	if p.ignoreMissing, err = config.optionalBool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *convertProcessor) Transform(document types.JSON) (types.JSON, error) {
+	value, skip, err := getSourceField(document, p.field, p.ignoreMissing)
+	if skip || err != nil {
+		return document, err
+	}
+
+	var converted any
+	if values, ok := value.([]any); ok {
+		convertedValues := make([]any, len(values))
+		for i, v := range values {
+			if convertedValues[i], err = p.convert(v); err != nil {
+				return document, err
+			}
+		}
+		converted = convertedValues
+	} else if converted, err = p.convert(value); err != nil {
+		return document, err
+	}
+	return document, setField(document, p.targetField, converted)
+}
+
+func (p *convertProcessor) convert(value any) (any, error) {
+	s := stringValue(value)
+	switch p.targetType {
+	case "integer":
+		return strconv.ParseInt(s, 0, 32)
+	case "long":
+		return strconv.ParseInt(s, 0, 64)
+	case "float", "double":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("[%s] is not a boolean value, cannot convert to boolean", s)
+	case "ip":
+		if net.ParseIP(s) == nil {
+			return nil, fmt.Errorf("'%s' is not an IP string literal", s)
+		}
+		return s, nil
+	case "auto":
+		if _, isString := value.(string); !isString {
+			return value, nil
+		}
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+		if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+			return b, nil
+		}
+		return s, nil
+	default: // "string"
+		return s, nil
+	}
+}
+
+const defaultDateOutputFormat = "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+
+type dateProcessor struct {
+	field        string
+	targetField  string
+	formats      []string
+	layouts      []string // Go layouts of Java formats, empty for the special ones (ISO8601, UNIX, ...)
+	location     *time.Location
+	outputLayout string
+}
+
+func newDateProcessor(config processorConfig) (IngestTransformer, error) {
+	var p dateProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.targetField, err = config.optionalString("target_field", "@timestamp"); err != nil {
+		return nil, err
+	}
+	if p.formats, err = config.requiredStrings("formats"); err != nil {
+		return nil, err
+	}
+	p.layouts = make([]string, len(p.formats))
+	for i, format := range p.formats {
+		switch format {
+		case "ISO8601", "UNIX", "UNIX_MS", "TAI64N":
+		default:
+			if p.layouts[i], err = javaDateLayout(format); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	timezone, err := config.optionalString("timezone", "UTC")
+	if err != nil {
+		return nil, err
+	}
+	if p.location, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("unknown timezone [%s]", timezone)
+	}
+
+	outputFormat, err := config.optionalString("output_format", defaultDateOutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	if p.outputLayout, err = javaDateLayout(outputFormat); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *dateProcessor) Transform(document types.JSON) (types.JSON, error) {
+	value, _, err := getSourceField(document, p.field, false)
+	if err != nil {
+		return document, err
+	}
+	s := stringValue(value)
+
+	for i, format := range p.formats {
+		if parsed, err := p.parse(s, format, p.layouts[i]); err == nil {
+			return document, setField(document, p.targetField, parsed.Format(p.outputLayout))
+		}
+	}
+	return document, fmt.Errorf("unable to parse date [%s] with formats %v", s, p.formats)
+}
+
+func (p *dateProcessor) parse(value, format, layout string) (time.Time, error) {
+	switch format {
+	case "ISO8601":
+		for _, isoLayout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.ParseInLocation(isoLayout, value, p.location); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("not an ISO8601 date")
+	case "UNIX":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)).In(p.location), nil
+	case "UNIX_MS":
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(millis).In(p.location), nil
+	case "TAI64N":
+		// 12 bytes in hex: 2^62 + seconds, nanoseconds, optionally prefixed with `@`
+		raw, err := hex.DecodeString(strings.TrimPrefix(value, "@"))
+		if err != nil || len(raw) != 12 {
+			return time.Time{}, fmt.Errorf("not a TAI64N date")
+		}
+		var seconds, nanos int64
+		for _, b := range raw[:8] {
+			seconds = seconds<<8 | int64(b)
+		}
+		for _, b := range raw[8:] {
+			nanos = nanos<<8 | int64(b)
+		}
+		return time.Unix(seconds-(1<<62), nanos).In(p.location), nil
+	}
+
+	t, err := time.ParseInLocation(layout, value, p.location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Year() == 0 { // format without a year, like in syslog
+		t = t.AddDate(time.Now().In(p.location).Year(), 0, 0)
+	}
+	return t, nil
+}
+
+// javaDateLayout converts the most common Java DateTimeFormatter patterns to Go layouts
+func javaDateLayout(pattern string) (string, error) {
+	replacements := map[string]string{
+		"yyyy": "2006", "uuuu": "2006", "yy": "06", "uu": "06",
+		"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+		"dd": "02", "d": "2",
+		"EEEE": "Monday", "EEE": "Mon", "E": "Mon",
+		"HH": "15", "H": "15", "hh": "03", "h": "3",
+		"mm": "04", "m": "4",
+		"ss": "05", "s": "5",
+		"a":   "PM",
+		"XXX": "Z07:00", "XX": "Z0700", "X": "Z07",
+		"xxx": "-07:00", "xx": "-0700", "Z": "-0700", "ZZ": "-0700", "ZZZ": "-0700",
+		"z": "MST",
+	}
+
+	var layout strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated quote in date format [%s]", pattern)
+			}
+			if end == 0 {
+				layout.WriteByte('\'')
+			} else {
+				layout.WriteString(pattern[i+1 : i+1+end])
+			}
+			i += end + 2
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			letters := pattern[i:j]
+			if c == 'S' {
+				layout.WriteString(strings.Repeat("0", len(letters)))
+			} else if replacement, ok := replacements[letters]; ok {
+				layout.WriteString(replacement)
+			} else {
+				return "", fmt.Errorf("unsupported pattern [%s] in date format [%s]", letters, pattern)
+			}
+			i = j
+		default:
+			layout.WriteByte(c)
+			i++
+		}
+	}
+	return layout.String(), nil
+}
+
+type grokProcessor struct {
+	field         string
+	groks         []*grok.Grok
+	ignoreMissing bool
+}
+
+func newGrokProcessor(config processorConfig) (IngestTransformer, error) {
+	var p grokProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = config.optionalBool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+
+	definitions := map[string]string{}
+	if rawDefinitions, ok := config["pattern_definitions"].(map[string]any); ok {
+		for name, definition := range rawDefinitions {
+			if definitions[name], ok = definition.(string); !ok {
+				return nil, fmt.Errorf("[pattern_definitions] property must contain strings only")
+			}
+		}
+	}
+
+	patterns, err := config.requiredStrings("patterns")
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		g, err := grok.Compile(pattern, definitions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grok pattern [%s]: %v", pattern, err)
+		}
+		p.groks = append(p.groks, g)
+	}
+	return &p, nil
+}
+
+func (p *grokProcessor) Transform(document types.JSON) (types.JSON, error) {
+	value, skip, err := getSourceField(document, p.field, p.ignoreMissing)
+	if skip || err != nil {
+		return document, err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return document, fmt.Errorf("field [%s] of type [%T] cannot be cast to string", p.field, value)
+	}
+
+	for _, g := range p.groks {
+		if matches, ok := g.Match(s); ok {
+			for key, matched := range matches {
+				if err := setField(document, key, matched); err != nil {
+					return document, err
+				}
+			}
+			return document, nil
+		}
+	}
+	return document, fmt.Errorf("Provided Grok expressions do not match field value: [%s]", s)
+}
+
+type dissectKey struct {
+	name         string
+	modifier     byte // 0, '+' (append), '?' (skip), '*' (name of a field), '&' (value of a field)
+	appendOrder  int
+	rightPadding bool
+	delimiter    string // text after the key, up to the next key
+}
+
+type dissectProcessor struct {
+	field           string
+	pattern         string
+	prefix          string
+	keys            []dissectKey
+	appendSeparator string
+	ignoreMissing   bool
+}
+
+var dissectKeyRegex = regexp.MustCompile(`%\{([^}]*)}`)
+
+func newDissectProcessor(config processorConfig) (IngestTransformer, error) {
+	var p dissectProcessor
+	var err error
+	if p.field, err = config.requiredString("field"); err != nil {
+		return nil, err
+	}
+	if p.pattern, err = config.requiredString("pattern"); err != nil {
+		return nil, err
+	}
+	if p.appendSeparator, err = config.optionalString("append_separator", ""); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = config.optionalBool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+
+	locations := dissectKeyRegex.FindAllStringSubmatchIndex(p.pattern, -1)
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("unable to find any keys in dissect pattern [%s]", p.pattern)
+	}
+	p.prefix = p.pattern[:locations[0][0]]
+	for i, location := range locations {
+		key := parseDissectKey(p.pattern[location[2]:location[3]])
+		end := len(p.pattern)
+		if i+1 < len(locations) {
+			end = locations[i+1][0]
+		}
+		key.delimiter = p.pattern[location[1]:end]
+		if key.delimiter == "" && i+1 < len(locations) {
+			return nil, fmt.Errorf("keys without a delimiter between them are not supported in dissect pattern [%s]", p.pattern)
+		}
+		p.keys = append(p.keys, key)
+	}
+	return &p, nil
+}
+
+func parseDissectKey(key string) dissectKey {
+	var result dissectKey
+	if strings.HasSuffix(key, "->") {
+		result.rightPadding = true
+		key = strings.TrimSuffix(key, "->")
+	}
+	if key != "" && strings.ContainsRune("+?*&", rune(key[0])) {
+		result.modifier = key[0]
+		key = key[1:]
+	}
+	if name, order, found := strings.Cut(key, "/"); found && result.modifier == '+' {
+		if n, err := strconv.Atoi(order); err == nil {
+			key, result.appendOrder = name, n
+		}
+	}
+	result.name = key
+	return result
+}
+
+func (p *dissectProcessor) Transform(document types.JSON) (types.JSON, error) {
+	value, skip, err := getSourceField(document, p.field, p.ignoreMissing)
+	if skip || err != nil {
+		return document, err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return document, fmt.Errorf("field [%s] of type [%T] cannot be cast to string", p.field, value)
+	}
+
+	values, ok := p.match(s)
+	if !ok {
+		return document, fmt.Errorf("Unable to find match for dissect pattern: %s against source: %s", p.pattern, s)
+	}
+
+	type appended struct {
+		order int
+		value string
+	}
+	var results []struct{ name, value string }
+	appendedValues := map[string][]appended{}
+	var appendedNames []string
+	referenceNames, referenceValues := map[string]string{}, map[string]string{}
+
+	for i, key := range p.keys {
+		switch {
+		case key.modifier == '?' || key.name == "":
+		case key.modifier == '+':
+			if _, seen := appendedValues[key.name]; !seen {
+				appendedNames = append(appendedNames, key.name)
+			}
+			appendedValues[key.name] = append(appendedValues[key.name], appended{key.appendOrder, values[i]})
+		case key.modifier == '*':
+			referenceNames[key.name] = values[i]
+		case key.modifier == '&':
+			referenceValues[key.name] = values[i]
+		default:
+			results = append(results, struct{ name, value string }{key.name, values[i]})
+		}
+	}
+	for _, name := range appendedNames {
+		parts := appendedValues[name]
+		sort.SliceStable(parts, func(i, j int) bool { return parts[i].order < parts[j].order })
+		joined := make([]string, len(parts))
+		for i, part := range parts {
+			joined[i] = part.value
+		}
+		results = append(results, struct{ name, value string }{name, strings.Join(joined, p.appendSeparator)})
+	}
+	for reference, name := range referenceNames {
+		results = append(results, struct{ name, value string }{name, referenceValues[reference]})
+	}
+
+	for _, result := range results {
+		if err := setField(document, result.name, result.value); err != nil {
+			return document, err
+		}
+	}
+	return document, nil
+}
+
+// match splits the input on the delimiters, it returns values in the same order as keys
+func (p *dissectProcessor) match(input string) ([]string, bool) {
+	if !strings.HasPrefix(input, p.prefix) {
+		return nil, false
+	}
+	position := len(p.prefix)
+	values := make([]string, len(p.keys))
+	for i, key := range p.keys {
+		if key.delimiter == "" {
+			values[i] = input[position:]
+			position = len(input)
+			continue
+		}
+		end := strings.Index(input[position:], key.delimiter)
+		if end < 0 {
+			return nil, false
+		}
+		values[i] = input[position : position+end]
+		position += end + len(key.delimiter)
+		if key.rightPadding {
+			for strings.HasPrefix(input[position:], key.delimiter) {
+				position += len(key.delimiter)
+			}
+		}
+	}
+	return values, true
+}
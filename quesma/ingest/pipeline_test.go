@@ -0,0 +1,202 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"errors"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPipelineProcessors(t *testing.T) {
+	currentYear := time.Now().UTC().Year()
+	tests := []struct {
+		name       string
+		processors string
+		document   string
+		expected   string
+	}{
+		{
+			name:       "set with template",
+			processors: `[{"set": {"field": "event.summary", "value": "{{user}} did {{{action}}}"}}]`,
+			document:   `{"user": "alice", "action": "login"}`,
+			expected:   `{"user": "alice", "action": "login", "event": {"summary": "alice did login"}}`,
+		},
+		{
+			name:       "set without override",
+			processors: `[{"set": {"field": "a", "value": 2, "override": false}}, {"set": {"field": "b", "copy_from": "a"}}]`,
+			document:   `{"a": 1}`,
+			expected:   `{"a": 1, "b": 1}`,
+		},
+		{
+			name:       "remove",
+			processors: `[{"remove": {"field": ["a", "nested.b"]}}, {"remove": {"field": "missing", "ignore_missing": true}}]`,
+			document:   `{"a": 1, "nested": {"b": 2, "c": 3}}`,
+			expected:   `{"nested": {"c": 3}}`,
+		},
+		{
+			name:       "rename",
+			processors: `[{"rename": {"field": "msg", "target_field": "message"}}]`,
+			document:   `{"msg": "hello"}`,
+			expected:   `{"message": "hello"}`,
+		},
+		{
+			name: "convert",
+			processors: `[{"convert": {"field": "count", "type": "integer"}},
+				{"convert": {"field": "ratio", "type": "double", "target_field": "ratio_double"}},
+				{"convert": {"field": "flags", "type": "boolean"}},
+				{"convert": {"field": "code", "type": "string"}},
+				{"convert": {"field": "guess", "type": "auto"}}]`,
+			document: `{"count": "42", "ratio": "0.5", "flags": ["true", "FALSE"], "code": 404, "guess": "3.5"}`,
+			expected: `{"count": 42, "ratio": "0.5", "ratio_double": 0.5, "flags": [true, false], "code": "404", "guess": 3.5}`,
+		},
+		{
+			name: "date",
+			processors: `[{"date": {"field": "ts", "formats": ["dd/MMM/yyyy:HH:mm:ss Z"]}},
+				{"date": {"field": "epoch", "formats": ["UNIX_MS"], "target_field": "epoch_date", "output_format": "yyyy-MM-dd"}},
+				{"date": {"field": "syslog", "formats": ["ISO8601", "MMM d HH:mm:ss"], "timezone": "Europe/Warsaw", "target_field": "syslog_date"}}]`,
+			document: `{"ts": "10/Oct/2000:13:55:36 -0700", "epoch": 1706551896491, "syslog": "Jan 5 10:00:00"}`,
+			expected: `{"ts": "10/Oct/2000:13:55:36 -0700", "@timestamp": "2000-10-10T13:55:36.000-07:00",
+				"epoch": 1706551896491, "epoch_date": "2024-01-29",
+				"syslog": "Jan 5 10:00:00", "syslog_date": "` + strconv.Itoa(currentYear) + `-01-05T10:00:00.000+01:00"}`,
+		},
+		{
+			name:       "grok",
+			processors: `[{"grok": {"field": "message", "patterns": ["%{IP:client.ip} %{WORD:http.method} %{NUMBER:http.bytes:int}"]}}]`,
+			document:   `{"message": "55.3.244.1 GET 15824"}`,
+			expected:   `{"message": "55.3.244.1 GET 15824", "client": {"ip": "55.3.244.1"}, "http": {"method": "GET", "bytes": 15824}}`,
+		},
+		{
+			name:       "dissect",
+			processors: `[{"dissect": {"field": "message", "pattern": "[%{ts}] %{level->} %{+msg/2} %{+msg/1} %{?ignored} %{*key}=%{&key}", "append_separator": " "}}]`,
+			document:   `{"message": "[2024-01-01] INFO   world hello x user=bob"}`,
+			expected:   `{"message": "[2024-01-01] INFO   world hello x user=bob", "ts": "2024-01-01", "level": "INFO", "msg": "hello world", "user": "bob"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := ParsePipeline("test", types.MustJSON(`{"processors": `+tt.processors+`}`))
+			require.NoError(t, err)
+			result, err := pipeline.Transform(types.MustJSON(tt.document))
+			require.NoError(t, err)
+			resultBytes, err := result.Bytes()
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(resultBytes))
+		})
+	}
+}
+
+func TestPipelineFailureHandling(t *testing.T) {
+	tests := []struct {
+		name          string
+		pipeline      string
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:          "failure",
+			pipeline:      `{"processors": [{"rename": {"field": "missing", "target_field": "a"}}, {"set": {"field": "b", "value": 1}}]}`,
+			expectedError: true,
+		},
+		{
+			name:     "ignore_failure",
+			pipeline: `{"processors": [{"rename": {"field": "missing", "target_field": "a", "ignore_failure": true}}, {"set": {"field": "b", "value": 1}}]}`,
+			expected: `{"message": "x", "b": 1}`,
+		},
+		{
+			name: "processor on_failure continues the pipeline",
+			pipeline: `{"processors": [
+				{"grok": {"field": "message", "patterns": ["%{INT:n}"], "tag": "parse", "on_failure": [
+					{"set": {"field": "error", "value": "{{_ingest.on_failure_processor_type}}/{{_ingest.on_failure_processor_tag}}"}}]}},
+				{"set": {"field": "b", "value": 1}}]}`,
+			expected: `{"message": "x", "error": "grok/parse", "b": 1}`,
+		},
+		{
+			name: "pipeline on_failure stops the pipeline",
+			pipeline: `{"processors": [{"rename": {"field": "missing", "target_field": "a"}}, {"set": {"field": "b", "value": 1}}],
+				"on_failure": [{"set": {"field": "error", "value": "{{_ingest.on_failure_message}}"}}]}`,
+			expected: `{"message": "x", "error": "field [missing] not present as part of path [missing]"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := ParsePipeline("test", types.MustJSON(tt.pipeline))
+			require.NoError(t, err)
+			result, err := pipeline.Transform(types.MustJSON(`{"message": "x"}`))
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			resultBytes, err := result.Bytes()
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(resultBytes))
+		})
+	}
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	for _, definition := range []string{
+		`{"processors": {"set": {}}}`,
+		`{"processors": [{"unknown": {}}]}`,
+		`{"processors": [{"set": {"field": "a"}}]}`,
+		`{"processors": [{"set": {"field": "a", "value": 1, "if": "ctx.a == null"}}]}`,
+		`{"processors": [{"date": {"field": "a", "formats": ["yyyy-MM-dd QQQ"]}}]}`,
+		`{"processors": [{"dissect": {"field": "a", "pattern": "%{a}%{b}"}}]}`,
+		`{"processors": [{"grok": {"field": "a", "patterns": ["%{UNKNOWN:a}"]}}]}`,
+	} {
+		t.Run(definition, func(t *testing.T) {
+			_, err := ParsePipeline("test", types.MustJSON(definition))
+			assert.True(t, errors.Is(err, quesma_errors.ErrCouldNotParseRequest()))
+		})
+	}
+}
+
+func TestApplyPipeline(t *testing.T) {
+	storage := persistence.NewStaticJSONDatabase()
+	ip := &IngestProcessor{
+		cfg:       &config.QuesmaConfiguration{IndexConfig: config.IndicesConfigs{"logs": {DefaultPipeline: "default"}}},
+		pipelines: NewPipelineRegistry(storage),
+	}
+	require.NoError(t, ip.Pipelines().Put("default", types.MustJSON(`{"processors": [{"set": {"field": "by", "value": "default"}}]}`)))
+	require.NoError(t, ip.Pipelines().Put("other", types.MustJSON(`{"processors": [{"set": {"field": "by", "value": "other"}}]}`)))
+
+	result, err := ip.ApplyPipeline("logs", "", types.JSON{})
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{"by": "default"}, result)
+
+	result, err = ip.ApplyPipeline("logs", "other", types.JSON{})
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{"by": "other"}, result)
+
+	result, err = ip.ApplyPipeline("logs", NoPipeline, types.JSON{})
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{}, result)
+
+	_, err = ip.ApplyPipeline("logs", "missing", types.JSON{})
+	assert.Error(t, err)
+
+	assert.Len(t, ip.Pipelines().Find("*"), 2)
+	assert.Len(t, ip.Pipelines().Find("oth*,none"), 1)
+
+	// pipelines are loaded from the storage
+	reloaded := NewPipelineRegistry(storage)
+	assert.Len(t, reloaded.Find("*"), 2)
+	pipeline, found := reloaded.Get("other")
+	require.True(t, found)
+	assert.Equal(t, types.MustJSON(`{"processors": [{"set": {"field": "by", "value": "other"}}]}`), pipeline.Definition)
+
+	found, err = ip.Pipelines().Delete("other")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, _ = ip.Pipelines().Delete("other")
+	assert.False(t, found)
+	assert.Len(t, NewPipelineRegistry(storage).Find("*"), 1)
+}
@@ -68,6 +68,13 @@ type (
 		ingestFieldStatisticsLock sync.Mutex
 		virtualTableStorage       persistence.JSONDatabase
 		tableResolver             table_resolver.TableResolver
+		pipelines                 *PipelineRegistry
+		indexTemplates            *IndexTemplateRegistry
+		indexLifecycle            *IndexLifecycleRegistry
+		schemaEvolutionLock       sync.Mutex
+		columnRewriteLocks        sync.Map       // by table name, see columnRewriteLock
+		deadLetters               deadLetterSink // nil if the dead letter queue is disabled
+		ingestBuffer              *ingestBuffer  // nil if documents are inserted right away
 	}
 	TableMap  = util.SyncMap[string, *chLib.Table]
 	SchemaMap = map[string]interface{} // TODO remove
@@ -119,10 +126,18 @@ func (ip *IngestProcessor) Start() {
 			}
 		}
 	}()
+
+	ip.startIndexLifecycleJob()
+	if ip.ingestBuffer != nil {
+		ip.ingestBuffer.start(ip.ctx)
+	}
 }
 
 func (ip *IngestProcessor) Stop() {
 	ip.cancel()
+	if ip.ingestBuffer != nil {
+		ip.ingestBuffer.wait()
+	}
 }
 
 func (ip *IngestProcessor) Close() {
@@ -232,11 +247,11 @@ func createTableQuery(name string, columns string, config *chLib.ChTableConfig)
 	createTableCmd := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" %s
 (
 
-%s
+%s%s"%s" DateTime64(3) DEFAULT now64(3)
 )
 %s
 COMMENT 'created by Quesma'`,
-		name, onClusterClause, columns,
+		name, onClusterClause, columns, util.Indent(1), schema.IngestTimeColumnName,
 		config.CreateTablePostFieldsString())
 	return createTableCmd
 }
@@ -593,16 +608,21 @@ func populateFieldEncodings(jsonData []types.JSON, tableName string) map[schema.
 func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 	tableName string,
 	jsonData []types.JSON, transformer IngestTransformer,
-	tableFormatter TableColumNameFormatter, tableDefinitionChangeOnly bool) ([]string, error) {
+	tableFormatter TableColumNameFormatter, tableDefinitionChangeOnly bool) ([]string, []invalidDocument, error) {
 	// this is pre ingest transformer
 	// here we transform the data before it's structure evaluation and insertion
 	//
+	var originals []types.JSON
+	if !tableDefinitionChangeOnly {
+		originals = ip.cloneForDeadLetters(jsonData)
+	}
+
 	preIngestTransformer := &util.RewriteArrayOfObject{}
 	var processed []types.JSON
 	for _, jsonValue := range jsonData {
 		result, err := preIngestTransformer.Transform(jsonValue)
 		if err != nil {
-			return nil, fmt.Errorf("error while rewriting json: %v", err)
+			return nil, nil, fmt.Errorf("error while rewriting json: %v", err)
 		}
 		processed = append(processed, result)
 	}
@@ -632,7 +652,7 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 	for _, jsonValue := range jsonData {
 		transformedJson, err := transformer.Transform(jsonValue)
 		if err != nil {
-			return nil, fmt.Errorf("error while transforming json: %v", err)
+			return nil, nil, fmt.Errorf("error while transforming json: %v", err)
 		}
 		transformedJsons = append(transformedJsons, transformedJson)
 	}
@@ -641,7 +661,8 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 	var tableConfig *chLib.ChTableConfig
 	var createTableCmd string
 	if table == nil {
-		tableConfig = NewOnlySchemaFieldsCHConfig(ip.cfg.ClusterName)
+		tableConfig = ip.applyIndexTemplate(tableName, NewOnlySchemaFieldsCHConfig(ip.cfg.ClusterName))
+		tableConfig = ip.lifecycleTableConfig(tableName, tableConfig)
 		columnsFromJson := JsonToColumns(transformedJsons[0], tableConfig)
 
 		fieldOrigins := make(map[schema.FieldName]schema.FieldSource)
@@ -661,7 +682,7 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 		createTableCmd, err = ip.createTableObjectAndAttributes(ctx, createTableCmd, tableConfig, tableName, tableDefinitionChangeOnly)
 		if err != nil {
 			logger.ErrorWithCtx(ctx).Msgf("error createTableObjectAndAttributes, can't create table: %v", err)
-			return nil, err
+			return nil, nil, err
 		}
 		// Set pointer to table after creating it
 		table = ip.FindTable(tableName)
@@ -669,31 +690,32 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 		createTableCmd = table.CreateTableString()
 	}
 	if table == nil {
-		return nil, fmt.Errorf("table %s not found", tableName)
+		return nil, nil, fmt.Errorf("table %s not found", tableName)
 	}
 	tableConfig = table.Config
+	ip.evolveSchema(ctx, table, transformedJsons, encodings)
 	var jsonsReadyForInsertion []string
 	var alterCmd []string
 	var validatedJsons []types.JSON
 	var invalidJsons []types.JSON
 	validatedJsons, invalidJsons, err := ip.preprocessJsons(ctx, table.Name, transformedJsons)
 	if err != nil {
-		return nil, fmt.Errorf("error preprocessJsons: %v", err)
+		return nil, nil, fmt.Errorf("error preprocessJsons: %v", err)
 	}
 	for i, preprocessedJson := range validatedJsons {
 		alter, onlySchemaFields, nonSchemaFields, err := ip.GenerateIngestContent(table, preprocessedJson,
 			invalidJsons[i], tableConfig, encodings)
 
 		if err != nil {
-			return nil, fmt.Errorf("error BuildInsertJson, tablename: '%s' : %v", table.Name, err)
+			return nil, nil, fmt.Errorf("error BuildInsertJson, tablename: '%s' : %v", table.Name, err)
 		}
 		insertJson, err := generateInsertJson(nonSchemaFields, onlySchemaFields)
 		if err != nil {
-			return nil, fmt.Errorf("error generatateInsertJson, tablename: '%s' json: '%s': %v", table.Name, PrettyJson(insertJson), err)
+			return nil, nil, fmt.Errorf("error generatateInsertJson, tablename: '%s' json: '%s': %v", table.Name, PrettyJson(insertJson), err)
 		}
 		alterCmd = append(alterCmd, alter...)
 		if err != nil {
-			return nil, fmt.Errorf("error BuildInsertJson, tablename: '%s' json: '%s': %v", table.Name, PrettyJson(insertJson), err)
+			return nil, nil, fmt.Errorf("error BuildInsertJson, tablename: '%s' json: '%s': %v", table.Name, PrettyJson(insertJson), err)
 		}
 		jsonsReadyForInsertion = append(jsonsReadyForInsertion, insertJson)
 	}
@@ -701,9 +723,11 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 	insertValues := strings.Join(jsonsReadyForInsertion, ", ")
 	insert := fmt.Sprintf("INSERT INTO \"%s\" FORMAT JSONEachRow %s", table.Name, insertValues)
 
-	return generateSqlStatements(createTableCmd, alterCmd, insert), nil
+	return generateSqlStatements(createTableCmd, alterCmd, insert), invalidDocuments(table.Name, originals, transformedJsons, invalidJsons), nil
 }
 
+// Ingest inserts documents into ClickHouse, or buffers them if the ingest buffer is enabled.
+// It returns ErrIngestBufferFull if they don't fit into the buffer.
 func (lm *IngestProcessor) Ingest(ctx context.Context, indexName string, jsonData []types.JSON) error {
 
 	err := elasticsearch.IsValidIndexName(indexName)
@@ -711,9 +735,52 @@ func (lm *IngestProcessor) Ingest(ctx context.Context, indexName string, jsonDat
 		return err
 	}
 
+	if lm.ingestBuffer != nil {
+		return lm.ingestBuffer.add(indexName, jsonData)
+	}
+	return lm.ingest(ctx, indexName, jsonData)
+}
+
+func (lm *IngestProcessor) ingest(ctx context.Context, indexName string, jsonData []types.JSON) error {
 	nameFormatter := DefaultColumnNameFormatter()
 	transformer := IngestTransformerFor(indexName, lm.cfg)
-	return lm.ProcessInsertQuery(ctx, indexName, jsonData, transformer, nameFormatter)
+	originals := lm.cloneForDeadLetters(jsonData)
+	err := lm.ProcessInsertQuery(ctx, indexName, jsonData, transformer, nameFormatter)
+	if err != nil {
+		lm.CaptureDeadLetters(ctx, indexName, DeadLetterStageInsert, NoPipeline, err, originals...)
+	}
+	return err
+}
+
+func (ip *IngestProcessor) Pipelines() *PipelineRegistry {
+	return ip.pipelines
+}
+
+func (ip *IngestProcessor) IndexTemplates() *IndexTemplateRegistry {
+	return ip.indexTemplates
+}
+
+// ApplyPipeline runs an ingest pipeline on a document before it's ingested,
+// if pipelineId is empty, the default pipeline of the index is used
+func (ip *IngestProcessor) ApplyPipeline(indexName, pipelineId string, document types.JSON) (types.JSON, error) {
+	if pipelineId == "" && ip.cfg != nil {
+		if indexConfig, found := ip.cfg.IndexConfig[indexName]; found {
+			pipelineId = indexConfig.DefaultPipeline
+		}
+	}
+	if pipelineId == "" || pipelineId == NoPipeline {
+		return document, nil
+	}
+
+	var pipeline *Pipeline
+	var found bool
+	if ip.pipelines != nil {
+		pipeline, found = ip.pipelines.Get(pipelineId)
+	}
+	if !found {
+		return document, fmt.Errorf("pipeline with id [%s] does not exist", pipelineId)
+	}
+	return pipeline.Transform(document)
 }
 
 func (lm *IngestProcessor) ProcessInsertQuery(ctx context.Context, tableName string,
@@ -817,7 +884,11 @@ func (ip *IngestProcessor) applyAsyncInsertOptimizer(tableName string, clickhous
 func (ip *IngestProcessor) processInsertQueryInternal(ctx context.Context, tableName string,
 	jsonData []types.JSON, transformer IngestTransformer,
 	tableFormatter TableColumNameFormatter, isVirtualTable bool) error {
-	statements, err := ip.processInsertQuery(ctx, tableName, jsonData, transformer, tableFormatter, isVirtualTable)
+	if lock := ip.columnRewriteLock(tableName); lock != nil && !isVirtualTable {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	statements, invalid, err := ip.processInsertQuery(ctx, tableName, jsonData, transformer, tableFormatter, isVirtualTable)
 	if err != nil {
 		return err
 	}
@@ -845,7 +916,11 @@ func (ip *IngestProcessor) processInsertQueryInternal(ctx context.Context, table
 	// We expect to have date format set to `best_effort`
 	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouseSettings))
 
-	return ip.executeStatements(ctx, statements)
+	if err = ip.executeStatements(ctx, statements); err != nil {
+		return err
+	}
+	ip.captureInvalidDocuments(ctx, invalid)
+	return nil
 }
 
 // This function removes fields that are part of anotherDoc from inputDoc
@@ -929,8 +1004,8 @@ func (ip *IngestProcessor) storeVirtualTable(table *chLib.Table) error {
 
 	var columnsToStore []string
 	for _, col := range table.Cols {
-		// We don't want to store attributes columns in the virtual table
-		if col.Name == chLib.AttributesValuesColumn || col.Name == chLib.AttributesMetadataColumn {
+		// We don't want to store attributes columns (and the internal ingest time) in the virtual table
+		if col.Name == chLib.AttributesValuesColumn || col.Name == chLib.AttributesMetadataColumn || col.Name == schema.IngestTimeColumnName {
 			continue
 		}
 		columnsToStore = append(columnsToStore, col.Name)
@@ -1000,9 +1075,11 @@ func (ip *IngestProcessor) Ping() error {
 	return ip.chDb.Ping()
 }
 
-func NewIngestProcessor(cfg *config.QuesmaConfiguration, chDb quesma_api.BackendConnector, phoneHomeClient diag.PhoneHomeClient, loader chLib.TableDiscovery, schemaRegistry schema.Registry, virtualTableStorage persistence.JSONDatabase, tableResolver table_resolver.TableResolver) *IngestProcessor {
+func NewIngestProcessor(cfg *config.QuesmaConfiguration, chDb quesma_api.BackendConnector, phoneHomeClient diag.PhoneHomeClient, loader chLib.TableDiscovery, schemaRegistry schema.Registry, virtualTableStorage persistence.JSONDatabase, tableResolver table_resolver.TableResolver, templateStorage persistence.JSONDatabase, lifecycleStorage persistence.JSONDatabase, pipelineStorage persistence.JSONDatabase) *IngestProcessor {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &IngestProcessor{ctx: ctx, cancel: cancel, chDb: chDb, tableDiscovery: loader, cfg: cfg, phoneHomeClient: phoneHomeClient, schemaRegistry: schemaRegistry, virtualTableStorage: virtualTableStorage, tableResolver: tableResolver}
+	ip := &IngestProcessor{ctx: ctx, cancel: cancel, chDb: chDb, tableDiscovery: loader, cfg: cfg, phoneHomeClient: phoneHomeClient, schemaRegistry: schemaRegistry, virtualTableStorage: virtualTableStorage, tableResolver: tableResolver, pipelines: NewPipelineRegistry(pipelineStorage), indexTemplates: NewIndexTemplateRegistry(templateStorage), indexLifecycle: NewIndexLifecycleRegistry(lifecycleStorage), deadLetters: newDeadLetterSink(cfg.DeadLetterQueue, chDb)}
+	ip.ingestBuffer = newIngestBuffer(cfg.IngestBuffer, ip)
+	return ip
 }
 
 func NewOnlySchemaFieldsCHConfig(clusterName string) *chLib.ChTableConfig {
@@ -0,0 +1,368 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"fmt"
+	chLib "github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/comment_metadata"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema evolution changes the table when an ingested value doesn't match the type of its column,
+// instead of storing the value in attributes as a string. Strategies are enabled per index
+// with the `schemaEvolution` option and tried in this order:
+//   - widen: numeric columns are widened to fit the value, Int32 → Int64 → Float64 (`ALTER TABLE ... MODIFY COLUMN`),
+//   - array: a scalar column receiving arrays of its type is migrated to an Array column,
+//     scalar values of Array columns are wrapped in arrays,
+//   - shadow: values of an incompatible type are stored in a shadow column named after their type, e.g. `__quesma_shadow_status_keyword`.
+//     The reserved prefix keeps shadow columns apart from ingested fields.
+//
+// Only dedicated tables evolve, the common table and virtual tables are shared by many indexes.
+// Inserts into tables with the array strategy are serialized (see columnRewriteLock), as a column rewrite
+// mustn't run together with an insert.
+// Every change is recorded in stats.GlobalSchemaEvolution and the schema registry is refreshed,
+// so `_mapping` reflects it immediately.
+
+const shadowFieldPrefix = "__quesma_shadow_"
+
+// suffixes of temporary columns of the array migration, see promoteToArray
+const (
+	arrayColumnSuffix  = "__quesma_array"
+	scalarColumnSuffix = "__quesma_scalar"
+)
+
+// shadowColumnSuffixes maps ClickHouse types of incoming values to suffixes of shadow columns, named after Elasticsearch types
+var shadowColumnSuffixes = map[string]string{
+	"String":     "keyword",
+	"Int64":      "long",
+	"Float64":    "double",
+	"Bool":       "boolean",
+	"DateTime64": "date",
+}
+
+// evolveSchema changes the table, so values of the documents can be stored in columns. Documents are modified in place.
+func (ip *IngestProcessor) evolveSchema(ctx context.Context, table *chLib.Table, jsons []types.JSON,
+	encodings map[schema.FieldEncodingKey]schema.EncodedFieldName) {
+	if ip.cfg == nil || table.VirtualTable || table.Name == common_table.TableName || !table.Created {
+		return
+	}
+	indexConfig, found := ip.cfg.IndexConfig[table.Name]
+	if !found || len(indexConfig.SchemaEvolution) == 0 {
+		return
+	}
+
+	ip.schemaEvolutionLock.Lock()
+	defer ip.schemaEvolutionLock.Unlock()
+	if indexConfig.HasSchemaEvolution(config.SchemaEvolutionArray) {
+		ip.recoverColumnRewrites(ctx, table)
+	}
+
+	reverseMap := reverseFieldEncoding(encodings, table.Name)
+	evolvedFields := make(map[schema.FieldEncodingKey]schema.EncodedFieldName)
+	for _, document := range jsons {
+		for _, columnName := range slices.Sorted(maps.Keys(document)) {
+			value := document[columnName]
+			column := table.Cols[columnName]
+			if value == nil || column == nil || validateValueAgainstType(columnName, value, column.Type) {
+				continue
+			}
+			fieldName := columnName
+			if field, ok := reverseMap[schema.EncodedFieldName(columnName)]; ok {
+				fieldName = field.FieldName
+			}
+			evolution := schemaEvolution{ip: ip, ctx: ctx, table: table, column: column, fieldName: fieldName}
+			if evolved := evolution.apply(indexConfig, document, value); evolved != nil {
+				for name, encoded := range evolved {
+					evolvedFields[schema.FieldEncodingKey{TableName: table.Name, FieldName: name}] = encoded
+				}
+			}
+		}
+	}
+
+	if len(evolvedFields) > 0 && ip.schemaRegistry != nil {
+		ip.schemaRegistry.UpdateFieldEncodings(evolvedFields)
+	}
+}
+
+// schemaEvolution evolves a single column of the table
+type schemaEvolution struct {
+	ip        *IngestProcessor
+	ctx       context.Context
+	table     *chLib.Table
+	column    *chLib.Column
+	fieldName string // Elasticsearch name of the column
+}
+
+// apply tries enabled strategies, returns fields which changed (field name → column name) or nil if the value can't be stored
+func (e schemaEvolution) apply(indexConfig config.IndexConfiguration, document types.JSON, value any) map[string]schema.EncodedFieldName {
+	if indexConfig.HasSchemaEvolution(config.SchemaEvolutionWiden) && e.widen(value) {
+		return map[string]schema.EncodedFieldName{e.fieldName: schema.EncodedFieldName(e.column.Name)}
+	}
+	if indexConfig.HasSchemaEvolution(config.SchemaEvolutionArray) {
+		if arrayColumn, isArray := e.column.Type.(chLib.CompoundType); isArray && arrayColumn.Name == "Array" {
+			// no schema change needed, the value becomes a single element array
+			if wrapped := []any{value}; validateValueAgainstType(e.column.Name, wrapped, e.column.Type) {
+				document[e.column.Name] = wrapped
+				return map[string]schema.EncodedFieldName{}
+			}
+		} else if e.promoteToArray(value) {
+			return map[string]schema.EncodedFieldName{e.fieldName: schema.EncodedFieldName(e.column.Name)}
+		}
+	}
+	if indexConfig.HasSchemaEvolution(config.SchemaEvolutionShadow) {
+		if shadowField, shadowColumn := e.shadow(value); shadowColumn != "" {
+			document[shadowColumn] = value
+			delete(document, e.column.Name)
+			return map[string]schema.EncodedFieldName{shadowField: schema.EncodedFieldName(shadowColumn)}
+		}
+	}
+	return nil
+}
+
+// widenedNumericType returns the type a numeric column has to be widened to, to store the value, or "" if it can't be widened
+func widenedNumericType(columnType string, value any) string {
+	incomingType, err := chLib.NewType(value, "")
+	if err != nil {
+		return ""
+	}
+	incomingBaseType, isBaseType := incomingType.(chLib.BaseType)
+	if !isBaseType || !isNumericType(columnType) || !isNumericType(incomingBaseType.Name) {
+		return ""
+	}
+	if isFloatingPointType(columnType) {
+		// both Float32 and Float64 accept any number, so there's nothing to widen
+		return ""
+	}
+	narrowIntegers := []string{"UInt8", "UInt16", "UInt32", "Int8", "Int16", "Int32"}
+	if slices.Contains(narrowIntegers, columnType) && isIntegerType(incomingBaseType.Name) && validateNumericRange("Int64", value) {
+		return "Int64"
+	}
+	return "Float64"
+}
+
+func (e schemaEvolution) widen(value any) bool {
+	columnType, isBaseType := e.column.Type.(chLib.BaseType)
+	if !isBaseType {
+		return false
+	}
+	widenedType := widenedNumericType(removeLowCardinality(columnType.Name), value)
+	if widenedType == "" {
+		return false
+	}
+	newType := chLib.NewBaseType(widenedType)
+	newType.Nullable = e.isNullable()
+
+	statement := fmt.Sprintf(`ALTER TABLE "%s"%s MODIFY COLUMN "%s" %s`, e.table.Name, e.onCluster(), e.column.Name, newType.StringWithNullable())
+	if err := e.ip.execute(e.ctx, statement); err != nil {
+		logger.WarnWithCtx(e.ctx).Msgf("could not widen column %s of table %s: %v", e.column.Name, e.table.Name, err)
+		return false
+	}
+	e.replaceColumn(e.column.Name, &chLib.Column{Name: e.column.Name, Type: newType, Modifiers: e.column.Modifiers, Comment: e.column.Comment})
+	e.record(config.SchemaEvolutionWiden, e.column.Name, e.column.Type.StringWithNullable(), newType.StringWithNullable())
+	return true
+}
+
+// promoteToArray migrates a scalar column to an array column, when the value is an array of elements of the column's type.
+// ClickHouse can't convert a scalar column to an array, so the column is rewritten: existing values become single element arrays.
+func (e schemaEvolution) promoteToArray(value any) bool {
+	columnType, isBaseType := e.column.Type.(chLib.BaseType)
+	elements, isArray := value.([]any)
+	if !isBaseType || !isArray || len(elements) == 0 {
+		return false
+	}
+	elementType := chLib.NewBaseType(columnType.Name)
+	for i, element := range elements {
+		if !validateValueAgainstType(fmt.Sprintf("%s[%d]", e.column.Name, i), element, elementType) {
+			return false
+		}
+	}
+	newType := chLib.CompoundType{Name: "Array", BaseType: elementType}
+	arrayColumn := e.column.Name + arrayColumnSuffix
+	scalarColumn := e.column.Name + scalarColumnSuffix
+
+	// The old column is kept until the new one replaces it, so a failed migration loses no data.
+	// It's repeated from the start with the next array value (a leftover array column is filled again),
+	// a leftover scalar column is dropped by recoverColumnRewrites.
+	statements := []string{
+		fmt.Sprintf(`ALTER TABLE "%s"%s ADD COLUMN IF NOT EXISTS "%s" %s`, e.table.Name, e.onCluster(), arrayColumn, newType.String()),
+		fmt.Sprintf(`ALTER TABLE "%s"%s UPDATE "%s" = if(isNull("%s"), [], [assumeNotNull("%s")]) WHERE true`, e.table.Name, e.onCluster(), arrayColumn, e.column.Name, e.column.Name),
+		fmt.Sprintf(`ALTER TABLE "%s"%s RENAME COLUMN "%s" TO "%s", RENAME COLUMN "%s" TO "%s"`, e.table.Name, e.onCluster(), e.column.Name, scalarColumn, arrayColumn, e.column.Name),
+	}
+	if e.column.Comment != "" {
+		statements = append(statements, fmt.Sprintf(`ALTER TABLE "%s"%s COMMENT COLUMN "%s" '%s'`, e.table.Name, e.onCluster(), e.column.Name, e.column.Comment))
+	}
+	for i, statement := range statements {
+		// the update has to finish before the columns are swapped
+		if err := e.ip.executeMutation(e.ctx, statement); err != nil {
+			logger.ErrorWithCtx(e.ctx).Msgf("could not migrate column %s of table %s to an array, failed at '%s': %v", e.column.Name, e.table.Name, statement, err)
+			if i < 2 {
+				// the scalar column is still in place
+				if i == 1 {
+					e.replaceColumn(arrayColumn, &chLib.Column{Name: arrayColumn, Type: newType})
+				}
+				return false
+			}
+			break // columns are swapped already, only the comment is missing
+		}
+	}
+	e.replaceColumn(e.column.Name, &chLib.Column{Name: e.column.Name, Type: newType, Comment: e.column.Comment})
+	e.replaceColumn(scalarColumn, &chLib.Column{Name: scalarColumn, Type: e.column.Type, Modifiers: e.column.Modifiers})
+	e.deleteColumn(arrayColumn)
+	e.dropColumn(scalarColumn)
+	e.record(config.SchemaEvolutionArray, e.column.Name, e.column.Type.StringWithNullable(), newType.String())
+	return true
+}
+
+// dropColumn drops the column, which isn't needed anymore. Failures are logged only, recoverColumnRewrites retries it.
+func (e schemaEvolution) dropColumn(name string) {
+	statement := fmt.Sprintf(`ALTER TABLE "%s"%s DROP COLUMN IF EXISTS "%s"`, e.table.Name, e.onCluster(), name)
+	if err := e.ip.execute(e.ctx, statement); err != nil {
+		logger.WarnWithCtx(e.ctx).Msgf("could not drop column %s of table %s: %v", name, e.table.Name, err)
+		return
+	}
+	e.deleteColumn(name)
+}
+
+// recoverColumnRewrites finishes array migrations interrupted by a failure or a restart (see promoteToArray):
+//   - an array column without its scalar column (left by a migration dropping the scalar column first) is renamed,
+//   - a scalar column left next to the migrated array column is dropped.
+//
+// An array column next to its scalar column is filled again, when the migration is repeated.
+func (ip *IngestProcessor) recoverColumnRewrites(ctx context.Context, table *chLib.Table) {
+	e := schemaEvolution{ip: ip, ctx: ctx, table: table}
+	for _, name := range slices.Sorted(maps.Keys(table.Cols)) {
+		switch {
+		case strings.HasSuffix(name, arrayColumnSuffix):
+			column := strings.TrimSuffix(name, arrayColumnSuffix)
+			if _, exists := table.Cols[column]; exists {
+				continue
+			}
+			statement := fmt.Sprintf(`ALTER TABLE "%s"%s RENAME COLUMN "%s" TO "%s"`, table.Name, e.onCluster(), name, column)
+			if err := ip.execute(ctx, statement); err != nil {
+				logger.WarnWithCtx(ctx).Msgf("could not recover column %s of table %s: %v", column, table.Name, err)
+				continue
+			}
+			e.replaceColumn(column, &chLib.Column{Name: column, Type: table.Cols[name].Type})
+			e.deleteColumn(name)
+			logger.InfoWithCtx(ctx).Msgf("recovered array column %s of table %s", column, table.Name)
+		case strings.HasSuffix(name, scalarColumnSuffix):
+			column, exists := table.Cols[strings.TrimSuffix(name, scalarColumnSuffix)]
+			if arrayType, isArray := column.Type.(chLib.CompoundType); exists && isArray && arrayType.Name == "Array" {
+				e.dropColumn(name)
+			}
+		}
+	}
+}
+
+// shadow finds or creates the shadow column for the value, returns its field and column names, or "" if the value can't be shadowed
+func (e schemaEvolution) shadow(value any) (shadowField, shadowColumn string) {
+	incomingType, err := chLib.NewType(value, e.column.Name)
+	if err != nil {
+		return "", ""
+	}
+	incomingBaseType, isBaseType := incomingType.(chLib.BaseType)
+	if !isBaseType {
+		return "", ""
+	}
+	suffix, found := shadowColumnSuffixes[incomingBaseType.Name]
+	if !found {
+		return "", ""
+	}
+	shadowField = shadowFieldPrefix + e.fieldName + "_" + suffix
+	shadowColumn = util.FieldToColumnEncoder(shadowField)
+
+	if existing := e.table.Cols[shadowColumn]; existing != nil {
+		if validateValueAgainstType(shadowColumn, value, existing.Type) {
+			return shadowField, shadowColumn
+		}
+		return "", ""
+	}
+
+	metadata := comment_metadata.NewCommentMetadata()
+	metadata.Values[comment_metadata.ElasticFieldName] = shadowField
+	comment := metadata.Marshall()
+	newType := chLib.NewBaseType(incomingBaseType.Name)
+	newType.Nullable = true
+
+	statements := []string{
+		fmt.Sprintf(`ALTER TABLE "%s"%s ADD COLUMN IF NOT EXISTS "%s" %s`, e.table.Name, e.onCluster(), shadowColumn, newType.StringWithNullable()),
+		fmt.Sprintf(`ALTER TABLE "%s"%s COMMENT COLUMN "%s" '%s'`, e.table.Name, e.onCluster(), shadowColumn, comment),
+	}
+	for _, statement := range statements {
+		if err := e.ip.execute(e.ctx, statement); err != nil {
+			logger.WarnWithCtx(e.ctx).Msgf("could not add shadow column %s to table %s: %v", shadowColumn, e.table.Name, err)
+			return "", ""
+		}
+	}
+	e.replaceColumn(shadowColumn, &chLib.Column{Name: shadowColumn, Type: newType, Modifiers: "Nullable", Comment: comment})
+	e.record(config.SchemaEvolutionShadow, shadowColumn, e.column.Type.StringWithNullable(), newType.StringWithNullable())
+	return shadowField, shadowColumn
+}
+
+// columnRewriteLock returns the lock of a table, whose columns can be rewritten by the array strategy, or nil for other tables.
+// Inserts into the table hold it from the schema evolution until the insert is executed, so no document is inserted
+// while a column is copied and dropped (see promoteToArray). Inserts of other Quesma instances aren't blocked.
+func (ip *IngestProcessor) columnRewriteLock(tableName string) *sync.Mutex {
+	if ip.cfg == nil || tableName == common_table.TableName {
+		return nil
+	}
+	if indexConfig, found := ip.cfg.IndexConfig[tableName]; !found || !indexConfig.HasSchemaEvolution(config.SchemaEvolutionArray) {
+		return nil
+	}
+	lock, _ := ip.columnRewriteLocks.LoadOrStore(tableName, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+func (e schemaEvolution) isNullable() bool {
+	return e.column.Type.IsNullable() || strings.Contains(e.column.Modifiers, "Nullable")
+}
+
+func (e schemaEvolution) onCluster() string {
+	if e.table.ClusterName != "" {
+		return " ON CLUSTER " + strconv.Quote(e.table.ClusterName)
+	}
+	return ""
+}
+
+// deleteColumn swaps the columns map, as it's read concurrently (see generateNewColumns)
+func (e schemaEvolution) deleteColumn(name string) {
+	newColumns := maps.Clone(e.table.Cols)
+	delete(newColumns, name)
+	e.table.Cols = newColumns
+}
+
+// replaceColumn swaps the columns map, as it's read concurrently (see generateNewColumns)
+func (e schemaEvolution) replaceColumn(name string, column *chLib.Column) {
+	newColumns := make(map[string]*chLib.Column, len(e.table.Cols)+1)
+	for k, v := range e.table.Cols {
+		newColumns[k] = v
+	}
+	newColumns[name] = column
+	e.table.Cols = newColumns
+}
+
+func (e schemaEvolution) record(kind, column, from, to string) {
+	logger.InfoWithCtx(e.ctx).Msgf("schema evolution (%s) of table %s: column %s changed from %s to %s", kind, e.table.Name, column, from, to)
+	stats.GlobalSchemaEvolution.Record(stats.SchemaEvolutionEvent{
+		Time:   time.Now(),
+		Table:  e.table.Name,
+		Column: column,
+		Kind:   kind,
+		From:   from,
+		To:     to,
+	})
+}
@@ -0,0 +1,203 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuesmaOrg/quesma/quesma/backend_connectors"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWidenedNumericType(t *testing.T) {
+	tests := []struct {
+		columnType string
+		value      any
+		expected   string
+	}{
+		{"Int32", float64(3_000_000_000), "Int64"},
+		{"UInt8", float64(-1), "Int64"},
+		{"Int32", 1.5, "Float64"},
+		{"Int64", 1.5, "Float64"},
+		{"UInt64", float64(-1), "Float64"},
+		{"Int64", 1e20, "Float64"},
+		{"Float32", 1e40, ""},
+		{"Int32", "abc", ""},
+		{"Int32", true, ""},
+		{"String", float64(1), ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, widenedNumericType(tt.columnType, tt.value), "%s %v", tt.columnType, tt.value)
+	}
+}
+
+func TestSchemaEvolution(t *testing.T) {
+	const tableName = "logs"
+	table := &clickhouse.Table{
+		Name: tableName,
+		Cols: map[string]*clickhouse.Column{
+			"bytes":  {Name: "bytes", Type: clickhouse.BaseType{Name: "Int32", Nullable: true}},
+			"tags":   {Name: "tags", Type: clickhouse.NewBaseType("String"), Modifiers: "Nullable"},
+			"labels": {Name: "labels", Type: clickhouse.CompoundType{Name: "Array", BaseType: clickhouse.NewBaseType("String")}},
+			"status": {Name: "status", Type: clickhouse.BaseType{Name: "Int64", Nullable: true}},
+		},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	}
+	tables := util.NewSyncMapWith(tableName, table)
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cfg := &config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		tableName: {SchemaEvolution: []string{config.SchemaEvolutionWiden, config.SchemaEvolutionArray, config.SchemaEvolutionShadow}},
+	}}
+	ip := newIngestProcessorWithEmptyTableMap(tables, cfg)
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+	registry := &schema.StaticRegistry{FieldEncodings: make(map[schema.FieldEncodingKey]schema.EncodedFieldName)}
+	ip.schemaRegistry = registry
+
+	mock.ExpectExec(`ALTER TABLE "logs" MODIFY COLUMN "bytes" Nullable(Int64)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" ADD COLUMN IF NOT EXISTS "__quesma_shadow_status_keyword" Nullable(String)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" COMMENT COLUMN "__quesma_shadow_status_keyword" 'quesmaMetadataV1:fieldName=__quesma_shadow_status_keyword'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" MODIFY COLUMN "bytes" Nullable(Float64)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" ADD COLUMN IF NOT EXISTS "tags__quesma_array" Array(String)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" UPDATE "tags__quesma_array" = if(isNull("tags"), [], [assumeNotNull("tags")]) WHERE true`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" RENAME COLUMN "tags" TO "tags__quesma_scalar", RENAME COLUMN "tags__quesma_array" TO "tags"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" DROP COLUMN IF EXISTS "tags__quesma_scalar"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	jsons := []types.JSON{
+		{"bytes": float64(5_000_000_000), "status": "ok", "labels": "a"},
+		{"bytes": 1.5, "status": "failed", "tags": []any{"x", "y"}},
+	}
+	ip.evolveSchema(context.Background(), table, jsons, nil)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, types.JSON{"bytes": float64(5_000_000_000), "__quesma_shadow_status_keyword": "ok", "labels": []any{"a"}}, jsons[0])
+	assert.Equal(t, types.JSON{"bytes": 1.5, "__quesma_shadow_status_keyword": "failed", "tags": []any{"x", "y"}}, jsons[1])
+	assert.Equal(t, "Nullable(Float64)", table.Cols["bytes"].Type.StringWithNullable())
+	assert.Equal(t, "Array(String)", table.Cols["tags"].Type.String())
+	assert.NotContains(t, table.Cols, "tags__quesma_array")
+	assert.NotContains(t, table.Cols, "tags__quesma_scalar")
+	assert.Equal(t, "Nullable(String)", table.Cols["__quesma_shadow_status_keyword"].Type.StringWithNullable())
+	assert.Equal(t, "Int64", table.Cols["status"].Type.String())
+	assert.Equal(t, schema.EncodedFieldName("__quesma_shadow_status_keyword"), registry.FieldEncodings[schema.FieldEncodingKey{TableName: tableName, FieldName: "__quesma_shadow_status_keyword"}])
+
+	for _, document := range jsons {
+		invalid, err := ip.validateIngest(tableName, document)
+		require.NoError(t, err)
+		assert.Empty(t, invalid)
+	}
+
+	events := stats.GlobalSchemaEvolution.Recent()
+	require.GreaterOrEqual(t, len(events), 4)
+	assert.Equal(t, stats.SchemaEvolutionEvent{Time: events[0].Time, Table: tableName, Column: "tags", Kind: config.SchemaEvolutionArray, From: "String", To: "Array(String)"}, events[0])
+	assert.Equal(t, stats.SchemaEvolutionEvent{Time: events[1].Time, Table: tableName, Column: "bytes", Kind: config.SchemaEvolutionWiden, From: "Nullable(Int64)", To: "Nullable(Float64)"}, events[1])
+	assert.Equal(t, config.SchemaEvolutionShadow, events[2].Kind)
+	assert.Equal(t, "__quesma_shadow_status_keyword", events[2].Column)
+}
+
+func TestSchemaEvolutionArrayRecovery(t *testing.T) {
+	const tableName = "logs"
+	arrayOfStrings := clickhouse.CompoundType{Name: "Array", BaseType: clickhouse.NewBaseType("String")}
+	table := &clickhouse.Table{
+		Name: tableName,
+		Cols: map[string]*clickhouse.Column{
+			// the scalar column was dropped, but the array column wasn't renamed yet
+			"labels__quesma_array": {Name: "labels__quesma_array", Type: arrayOfStrings},
+			// the columns were swapped, but the scalar column wasn't dropped yet
+			"tags":                {Name: "tags", Type: arrayOfStrings},
+			"tags__quesma_scalar": {Name: "tags__quesma_scalar", Type: clickhouse.NewBaseType("String"), Modifiers: "Nullable"},
+			// the array column was added, but the migration failed before the columns were swapped
+			"hosts":               {Name: "hosts", Type: clickhouse.NewBaseType("String"), Modifiers: "Nullable"},
+			"hosts__quesma_array": {Name: "hosts__quesma_array", Type: arrayOfStrings},
+		},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	}
+
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cfg := &config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		tableName: {SchemaEvolution: []string{config.SchemaEvolutionArray}},
+	}}
+	ip := newIngestProcessorWithEmptyTableMap(util.NewSyncMapWith(tableName, table), cfg)
+	ip.chDb = backend_connectors.NewClickHouseBackendConnectorWithConnection("", conn)
+
+	mock.ExpectExec(`ALTER TABLE "logs" RENAME COLUMN "labels__quesma_array" TO "labels"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" DROP COLUMN IF EXISTS "tags__quesma_scalar"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the migration is repeated, filling the leftover array column again
+	mock.ExpectExec(`ALTER TABLE "logs" ADD COLUMN IF NOT EXISTS "hosts__quesma_array" Array(String)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" UPDATE "hosts__quesma_array" = if(isNull("hosts"), [], [assumeNotNull("hosts")]) WHERE true`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" RENAME COLUMN "hosts" TO "hosts__quesma_scalar", RENAME COLUMN "hosts__quesma_array" TO "hosts"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "logs" DROP COLUMN IF EXISTS "hosts__quesma_scalar"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ip.evolveSchema(context.Background(), table, []types.JSON{{"hosts": []any{"a", "b"}}}, nil)
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []string{"hosts", "labels", "tags"}, slices.Sorted(maps.Keys(table.Cols)))
+	assert.Equal(t, "Array(String)", table.Cols["labels"].Type.String())
+	assert.Equal(t, "Array(String)", table.Cols["hosts"].Type.String())
+}
+
+func TestSchemaEvolutionDisabled(t *testing.T) {
+	const tableName = "logs"
+	table := &clickhouse.Table{
+		Name:    tableName,
+		Cols:    map[string]*clickhouse.Column{"bytes": {Name: "bytes", Type: clickhouse.NewBaseType("Int32")}},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	}
+	ip := newIngestProcessorWithEmptyTableMap(util.NewSyncMapWith(tableName, table), &config.QuesmaConfiguration{})
+
+	// no statements are executed, as there's no connection
+	jsons := []types.JSON{{"bytes": 1.5}}
+	ip.evolveSchema(context.Background(), table, jsons, nil)
+	assert.Equal(t, "Int32", table.Cols["bytes"].Type.String())
+
+	invalid, err := ip.validateIngest(tableName, jsons[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{"bytes": 1.5}, invalid)
+}
+
+func TestSchemaEvolutionArraySerializesInserts(t *testing.T) {
+	const tableName = "logs"
+	ip, mock := newDeadLetterTestProcessor(t, tableName, nil)
+	assert.Nil(t, ip.columnRewriteLock(tableName))
+	ip.cfg = &config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		tableName: {SchemaEvolution: []string{config.SchemaEvolutionArray}},
+	}}
+
+	// a column of the table is being rewritten
+	lock := ip.columnRewriteLock(tableName)
+	require.NotNil(t, lock)
+	lock.Lock()
+
+	mock.ExpectExec(`INSERT INTO "logs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	done := make(chan error)
+	go func() {
+		done <- ip.ProcessInsertQuery(context.Background(), tableName, []types.JSON{{"message": "a"}}, &IngestTransformerTest{}, DefaultColumnNameFormatter())
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("insert didn't wait for the column rewrite: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lock.Unlock()
+	require.NoError(t, <-done)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,193 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Table options of templates end up in CREATE TABLE as they are, so they're validated first.
+// The engine has to be one of the MergeTree family. Expressions (ORDER BY, PARTITION BY, PRIMARY KEY, TTL)
+// are split into tokens, and can't leave their clause: no semicolons, comments, unbalanced parentheses,
+// subqueries or keywords starting other clauses. Settings have to be `name = value` pairs with literal values.
+
+var allowedTableEngines = []string{
+	"MergeTree", "ReplacingMergeTree", "SummingMergeTree", "AggregatingMergeTree", "CollapsingMergeTree", "VersionedCollapsingMergeTree",
+	"ReplicatedMergeTree", "ReplicatedReplacingMergeTree", "ReplicatedSummingMergeTree", "ReplicatedAggregatingMergeTree",
+	"ReplicatedCollapsingMergeTree", "ReplicatedVersionedCollapsingMergeTree", "SharedMergeTree", "SharedReplacingMergeTree",
+}
+
+// forbiddenExpressionKeywords start other clauses of CREATE TABLE, or a subquery
+var forbiddenExpressionKeywords = []string{"SELECT", "ENGINE", "ORDER", "PARTITION", "PRIMARY", "SAMPLE", "TTL", "SETTINGS", "COMMENT", "AS", "EMPTY"}
+
+var settingNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type optionTokenKind int
+
+const (
+	optionTokenWord optionTokenKind = iota
+	optionTokenQuotedIdentifier
+	optionTokenString
+	optionTokenNumber
+	optionTokenSymbol
+)
+
+type optionToken struct {
+	kind optionTokenKind
+	text string
+}
+
+func tokenizeTableOption(option string) ([]optionToken, error) {
+	var tokens []optionToken
+	isWordChar := func(c byte) bool {
+		return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(option); {
+		c := option[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`' || c == '\'':
+			end := i + 1
+			for end < len(option) && option[end] != c {
+				if option[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(option) {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			kind := optionTokenQuotedIdentifier
+			if c == '\'' {
+				kind = optionTokenString
+			}
+			tokens = append(tokens, optionToken{kind, option[i : end+1]})
+			i = end + 1
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(option) && isWordChar(option[end]) {
+				end++
+			}
+			tokens = append(tokens, optionToken{optionTokenNumber, option[i:end]})
+			i = end
+		case isWordChar(c):
+			end := i
+			for end < len(option) && isWordChar(option[end]) {
+				end++
+			}
+			tokens = append(tokens, optionToken{optionTokenWord, option[i:end]})
+			i = end
+		case strings.HasPrefix(option[i:], "--") || strings.HasPrefix(option[i:], "/*"):
+			return nil, fmt.Errorf("comments are not allowed")
+		case strings.ContainsRune("(),+-*/%=<>!", rune(c)):
+			tokens = append(tokens, optionToken{optionTokenSymbol, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// validateTableExpression checks that the option is an expression (or a tuple of them) which stays within its clause
+func validateTableExpression(option string) error {
+	tokens, err := tokenizeTableOption(option)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("empty expression")
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch {
+		case token.kind == optionTokenWord && slices.Contains(forbiddenExpressionKeywords, strings.ToUpper(token.text)):
+			return fmt.Errorf("keyword %s is not allowed", token.text)
+		case token.text == "(" && token.kind == optionTokenSymbol:
+			depth++
+		case token.text == ")" && token.kind == optionTokenSymbol:
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("unbalanced parentheses")
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses")
+	}
+	return nil
+}
+
+// validateTableEngine checks that the engine is one of allowedTableEngines, optionally with parameters
+func validateTableEngine(engine string) error {
+	tokens, err := tokenizeTableOption(engine)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 || tokens[0].kind != optionTokenWord || !slices.Contains(allowedTableEngines, tokens[0].text) {
+		return fmt.Errorf("engine must be one of %v", allowedTableEngines)
+	}
+	if len(tokens) == 1 {
+		return nil
+	}
+	parameters := tokens[1:]
+	if parameters[0].text != "(" || parameters[len(parameters)-1].text != ")" {
+		return fmt.Errorf("engine parameters must be in parentheses")
+	}
+	return validateTableExpression(strings.TrimSpace(engine[len(tokens[0].text):]))
+}
+
+// validateTableSettings checks that the settings are comma separated `name = value` pairs, with literal values
+func validateTableSettings(settings string) error {
+	tokens, err := tokenizeTableOption(settings)
+	if err != nil {
+		return err
+	}
+	for len(tokens) > 0 {
+		if len(tokens) < 3 || tokens[0].kind != optionTokenWord || !settingNameRegexp.MatchString(tokens[0].text) || tokens[1].text != "=" {
+			return fmt.Errorf("settings must be comma separated `name = value` pairs")
+		}
+		value := tokens[2]
+		if value.kind != optionTokenNumber && value.kind != optionTokenString && !slices.Contains([]string{"true", "false"}, strings.ToLower(value.text)) {
+			return fmt.Errorf("value of setting %s must be a number, a string or a boolean", tokens[0].text)
+		}
+		tokens = tokens[3:]
+		if len(tokens) > 0 {
+			if tokens[0].text != "," {
+				return fmt.Errorf("settings must be comma separated `name = value` pairs")
+			}
+			tokens = tokens[1:]
+		}
+	}
+	return nil
+}
+
+// validate checks options which are set, see the comment at the top of the file
+func (o templateTableOptions) validate() error {
+	if o.Engine != "" {
+		if err := validateTableEngine(o.Engine); err != nil {
+			return fmt.Errorf("[engine]: %w", err)
+		}
+	}
+	expressions := []struct{ name, value string }{
+		{"order_by", o.OrderBy}, {"partition_by", o.PartitionBy}, {"primary_key", o.PrimaryKey}, {"ttl", o.Ttl},
+	}
+	for _, expression := range expressions {
+		if expression.value == "" {
+			continue
+		}
+		if err := validateTableExpression(expression.value); err != nil {
+			return fmt.Errorf("[%s]: %w", expression.name, err)
+		}
+	}
+	if o.Settings != "" {
+		if err := validateTableSettings(o.Settings); err != nil {
+			return fmt.Errorf("[settings]: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/goccy/go-json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const writeAheadLogSuffix = ".wal"
+
+// writeAheadLog keeps buffered documents on disk until they're inserted into ClickHouse.
+// It's a directory of segments, each line of a segment is a JSON record with documents of one ingest request.
+// The active segment is appended to. When the buffer is flushed, the active segment is sealed
+// and a new one is started. Sealed segments are removed after their documents are inserted.
+type writeAheadLog struct {
+	dir     string
+	sync    bool
+	active  *os.File
+	nextId  int64
+	sealed  []string
+	written int64 // bytes written to the active segment
+}
+
+type writeAheadLogRecord struct {
+	Index     string       `json:"index"`
+	Documents []types.JSON `json:"documents"`
+}
+
+// openWriteAheadLog returns records of segments left by the previous run, they're removed with the first sealed segment
+func openWriteAheadLog(dir string, sync bool) (*writeAheadLog, []writeAheadLogRecord, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	segments, err := writeAheadLogSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	wal := &writeAheadLog{dir: dir, sync: sync}
+	var records []writeAheadLogRecord
+	for _, segment := range segments {
+		segmentRecords, err := readWriteAheadLogSegment(segment)
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, segmentRecords...)
+		wal.sealed = append(wal.sealed, segment)
+		if id := writeAheadLogSegmentId(segment); id >= wal.nextId {
+			wal.nextId = id + 1
+		}
+	}
+	if err = wal.openSegment(); err != nil {
+		return nil, nil, err
+	}
+	return wal, records, nil
+}
+
+func writeAheadLogSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), writeAheadLogSuffix) && writeAheadLogSegmentId(entry.Name()) >= 0 {
+			segments = append(segments, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return writeAheadLogSegmentId(segments[i]) < writeAheadLogSegmentId(segments[j]) })
+	return segments, nil
+}
+
+// writeAheadLogSegmentId returns -1 for files which aren't segments
+func writeAheadLogSegmentId(path string) int64 {
+	id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), writeAheadLogSuffix), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+// readWriteAheadLogSegment skips a partially written last record, left when Quesma stopped during a write
+func readWriteAheadLogSegment(path string) ([]writeAheadLogRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []writeAheadLogRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for scanner.Scan() {
+		var record writeAheadLogRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warn().Msgf("skipping corrupted record of write-ahead log segment %s: %v", path, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func (w *writeAheadLog) openSegment() error {
+	path := filepath.Join(w.dir, fmt.Sprintf("%020d%s", w.nextId, writeAheadLogSuffix))
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.nextId++
+	w.active = file
+	w.written = 0
+	return nil
+}
+
+// append returns after the record is written and, unless disabled, synced to disk
+func (w *writeAheadLog) append(index string, documents []types.JSON) error {
+	line, err := json.Marshal(writeAheadLogRecord{Index: index, Documents: documents})
+	if err != nil {
+		return err
+	}
+	if _, err = w.active.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	w.written += int64(len(line)) + 1
+	if w.sync {
+		return w.active.Sync()
+	}
+	return nil
+}
+
+// seal starts a new segment and returns segments, which can be removed once their documents are inserted.
+// If the new segment can't be opened, the active one is still appended to and is sealed next time.
+func (w *writeAheadLog) seal() ([]string, error) {
+	if w.written > 0 {
+		previous := w.active
+		if err := w.openSegment(); err != nil {
+			return nil, err
+		}
+		if err := previous.Close(); err != nil {
+			logger.Warn().Msgf("could not close write-ahead log segment %s: %v", previous.Name(), err)
+		}
+		w.sealed = append(w.sealed, previous.Name())
+	}
+	sealed := w.sealed
+	w.sealed = nil
+	return sealed, nil
+}
+
+// keep returns sealed segments back, they're returned by the next seal again
+func (w *writeAheadLog) keep(segments []string) {
+	w.sealed = append(segments, w.sealed...)
+}
+
+func (w *writeAheadLog) remove(segments []string) {
+	for _, segment := range segments {
+		if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+			logger.Error().Msgf("could not remove write-ahead log segment %s: %v", segment, err)
+		}
+	}
+}
+
+func (w *writeAheadLog) close() error {
+	if w.written == 0 {
+		// nothing to recover from an empty segment
+		_ = w.active.Close()
+		return os.Remove(w.active.Name())
+	}
+	return w.active.Close()
+}
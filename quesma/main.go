@@ -123,7 +123,9 @@ func main() {
 	lm := connManager.GetConnector()
 
 	// TODO index configuration for ingest and query is the same for now
-	tableResolver := table_resolver.NewTableResolver(cfg, tableDisco, im)
+	aliasStorage := persistence.NewElasticJSONDatabase(cfg.Elasticsearch, table_resolver.AliasesElasticIndexName)
+	closedIndexStorage := persistence.NewElasticJSONDatabase(cfg.Elasticsearch, table_resolver.ClosedIndexesElasticIndexName)
+	tableResolver := table_resolver.NewTableResolver(cfg, tableDisco, im, aliasStorage, closedIndexStorage)
 	tableResolver.Start()
 
 	var ingestProcessor *ingest.IngestProcessor
@@ -134,7 +136,10 @@ func main() {
 			common_table.EnsureCommonTableExists(connectionPool, cfg.ClusterName)
 		}
 
-		ingestProcessor = ingest.NewIngestProcessor(&cfg, connectionPool, phoneHomeAgent, tableDisco, schemaRegistry, virtualTableStorage, tableResolver)
+		templateStorage := persistence.NewElasticJSONDatabase(cfg.Elasticsearch, ingest.IndexTemplatesElasticIndexName)
+		lifecycleStorage := persistence.NewElasticJSONDatabase(cfg.Elasticsearch, ingest.IndexLifecycleElasticIndexName)
+		pipelineStorage := persistence.NewElasticJSONDatabase(cfg.Elasticsearch, ingest.IngestPipelinesElasticIndexName)
+		ingestProcessor = ingest.NewIngestProcessor(&cfg, connectionPool, phoneHomeAgent, tableDisco, schemaRegistry, virtualTableStorage, tableResolver, templateStorage, lifecycleStorage, pipelineStorage)
 	} else {
 		logger.Info().Msg("Ingest processor is disabled.")
 	}
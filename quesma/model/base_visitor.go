@@ -183,7 +183,9 @@ func (v *BaseExprVisitor) VisitSelectCommand(query SelectCommand) interface{} {
 		}
 	}
 
-	return NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+	selectCommand := NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+	selectCommand.Offset = query.Offset
+	return selectCommand
 }
 
 func (v *BaseExprVisitor) VisitParenExpr(p ParenExpr) interface{} {
@@ -208,7 +210,11 @@ func (v *BaseExprVisitor) VisitJoinExpr(j JoinExpr) interface{} {
 	if v.OverrideVisitJoinExpr != nil {
 		return v.OverrideVisitJoinExpr(v, j)
 	}
-	return NewJoinExpr(j.Lhs.Accept(v).(Expr), j.Rhs.Accept(v).(Expr), j.JoinType, j.On.Accept(v).(Expr))
+	var on Expr
+	if j.On != nil { // ARRAY JOIN has no ON clause
+		on = j.On.Accept(v).(Expr)
+	}
+	return NewJoinExpr(j.Lhs.Accept(v).(Expr), j.Rhs.Accept(v).(Expr), j.JoinType, on)
 }
 
 func (v *BaseExprVisitor) VisitCTE(e CTE) interface{} {
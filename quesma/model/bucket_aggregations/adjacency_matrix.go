@@ -0,0 +1,88 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"sort"
+)
+
+// AdjacencyMatrix returns a bucket for every filter, and for every pair of filters (their intersection).
+// Buckets are sorted by key, and empty ones are omitted, like in Elastic.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-adjacency-matrix-aggregation.html
+type AdjacencyMatrix struct {
+	ctx    context.Context
+	groups []CombinatorGroup
+}
+
+// NewAdjacencyMatrix creates groups for 'filters' (sorted by name) and all their pairs, with keys "A", "A<separator>B", ...
+func NewAdjacencyMatrix(ctx context.Context, filters []Filter, separator string) AdjacencyMatrix {
+	groups := make([]CombinatorGroup, 0, len(filters)*(len(filters)+1)/2)
+	for i, filter := range filters {
+		groups = append(groups, CombinatorGroup{Key: filter.Name, WhereClause: filter.Sql.WhereClause})
+		for _, other := range filters[i+1:] {
+			groups = append(groups, CombinatorGroup{
+				Key:         filter.Name + separator + other.Name,
+				WhereClause: model.And([]model.Expr{filter.Sql.WhereClause, other.Sql.WhereClause}),
+			})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	for i := range groups {
+		groups[i].idx = i
+		if len(groups) > 1 {
+			groups[i].Prefix = fmt.Sprintf("adjacency_%d__", i)
+		}
+	}
+	return AdjacencyMatrix{ctx: ctx, groups: groups}
+}
+
+func (query AdjacencyMatrix) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query AdjacencyMatrix) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	var value any = 0
+	if len(rows) > 0 && len(rows[0].Cols) > 0 {
+		value = rows[0].Cols[len(rows[0].Cols)-1].Value
+	} else {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for adjacency_matrix aggregation")
+	}
+	return model.JsonMap{"doc_count": value}
+}
+
+func (query AdjacencyMatrix) String() string {
+	return fmt.Sprintf("adjacency_matrix(groups: %d)", len(query.groups))
+}
+
+func (query AdjacencyMatrix) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query AdjacencyMatrix) CombinatorGroups() []CombinatorGroup {
+	return query.groups
+}
+
+// CombinatorTranslateSqlResponseToJson returns nil for an empty bucket, as Elastic doesn't return those.
+func (query AdjacencyMatrix) CombinatorTranslateSqlResponseToJson(subGroup CombinatorGroup, rows []model.QueryResultRow) model.JsonMap {
+	response := query.TranslateSqlResponseToJson(rows)
+	if docCount, ok := util.ExtractInt64Maybe(response["doc_count"]); ok && docCount == 0 {
+		return nil
+	}
+	return response
+}
+
+func (query AdjacencyMatrix) CombinatorSplit() []model.QueryType {
+	result := make([]model.QueryType, 0, len(query.groups))
+	for _, group := range query.groups {
+		group.idx, group.Prefix = 0, ""
+		result = append(result, AdjacencyMatrix{ctx: query.ctx, groups: []CombinatorGroup{group}})
+	}
+	return result
+}
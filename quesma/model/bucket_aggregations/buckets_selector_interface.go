@@ -0,0 +1,13 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import "github.com/QuesmaOrg/quesma/quesma/model"
+
+// BucketsSelectorInterface is a bucket aggregation which filters and orders its buckets in Quesma, not in SQL.
+// Example: significant_terms, which orders buckets by a score computed from the whole response.
+// Rows of sub-aggregations need to be reordered in the same way.
+type BucketsSelectorInterface interface {
+	// SelectBuckets returns indexes of rows (one per bucket) which are returned as buckets, in the returned order.
+	SelectBuckets(rows []model.QueryResultRow) []int
+}
@@ -253,6 +253,19 @@ func (query *DateHistogram) OriginalKeyToKeyAsString(originalKey any) string {
 	return query.calculateKeyAsString(responseKey)
 }
 
+// Interval returns the interval and its type. After GenerateSQL, calendar minute/hour/day are already fixed intervals.
+func (query *DateHistogram) Interval() (string, DateHistogramIntervalType) {
+	return query.interval, query.intervalType
+}
+
+func (query *DateHistogram) Field() model.Expr {
+	return query.field
+}
+
+func (query *DateHistogram) Timezone() *time.Location {
+	return query.wantedTimezone
+}
+
 func (query *DateHistogram) SetMinDocCountToZero() {
 	query.minDocCount = 0
 }
@@ -0,0 +1,53 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// DiversifiedSampler is a sampler, which takes at most maxDocsPerValue documents with the same value of field.
+// We do 'LIMIT maxDocsPerValue BY field' in the sample subquery (currently only if it's the top-most aggregation)
+type DiversifiedSampler struct {
+	ctx             context.Context
+	size            int // "shard_size" from the request
+	field           model.Expr
+	maxDocsPerValue int
+}
+
+func NewDiversifiedSampler(ctx context.Context, size int, field model.Expr, maxDocsPerValue int) DiversifiedSampler {
+	return DiversifiedSampler{ctx: ctx, size: size, field: field, maxDocsPerValue: maxDocsPerValue}
+}
+
+func (query DiversifiedSampler) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query DiversifiedSampler) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for diversified sampler")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query DiversifiedSampler) String() string {
+	return fmt.Sprintf("diversified_sampler(size: %d, field: %s, max_docs_per_value: %d)",
+		query.size, model.AsString(query.field), query.maxDocsPerValue)
+}
+
+func (query DiversifiedSampler) GetSampleLimit() int {
+	return shardSizeToSampleLimitRatio * query.size
+}
+
+// DiversifyBy returns the field and max number of sampled documents with the same value of it
+func (query DiversifiedSampler) DiversifyBy() (field model.Expr, maxDocsPerValue int) {
+	return query.field, query.maxDocsPerValue
+}
+
+func (query DiversifiedSampler) DoesNotHaveGroupBy() bool {
+	return true
+}
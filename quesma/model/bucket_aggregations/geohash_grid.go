@@ -0,0 +1,48 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// GeoHashGrid groups points into geohash cells, key is the geohash of the cell (computed by ClickHouse geohashEncode)
+type GeoHashGrid struct {
+	ctx context.Context
+}
+
+func NewGeoHashGrid(ctx context.Context) GeoHashGrid {
+	return GeoHashGrid{ctx: ctx}
+}
+
+func (query GeoHashGrid) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query GeoHashGrid) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) > 0 && len(rows[0].Cols) < 2 {
+		logger.ErrorWithCtx(query.ctx).Msgf(
+			"unexpected number of columns in geohash_grid aggregation response, len(rows[0].Cols): %d",
+			len(rows[0].Cols),
+		)
+		return model.JsonMap{"buckets": []model.JsonMap{}}
+	}
+
+	buckets := make([]model.JsonMap, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, model.JsonMap{
+			"key":       fmt.Sprint(row.Cols[0].Value),
+			"doc_count": row.LastColValue(),
+		})
+	}
+	return model.JsonMap{
+		"buckets": buckets,
+	}
+}
+
+func (query GeoHashGrid) String() string {
+	return "geohash_grid"
+}
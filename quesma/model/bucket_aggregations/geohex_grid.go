@@ -0,0 +1,58 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strconv"
+)
+
+// GeoHexGrid groups points into H3 cells. ClickHouse geoToH3 returns the cell index as UInt64,
+// Elasticsearch key is the same index as a lowercase hex string, e.g. "861f09b07ffffff"
+type GeoHexGrid struct {
+	ctx context.Context
+}
+
+func NewGeoHexGrid(ctx context.Context) GeoHexGrid {
+	return GeoHexGrid{ctx: ctx}
+}
+
+func (query GeoHexGrid) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query GeoHexGrid) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) > 0 && len(rows[0].Cols) < 2 {
+		logger.ErrorWithCtx(query.ctx).Msgf(
+			"unexpected number of columns in geohex_grid aggregation response, len(rows[0].Cols): %d",
+			len(rows[0].Cols),
+		)
+		return model.JsonMap{"buckets": []model.JsonMap{}}
+	}
+
+	buckets := make([]model.JsonMap, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, model.JsonMap{
+			"key":       query.calcKey(row.Cols[0].Value),
+			"doc_count": row.LastColValue(),
+		})
+	}
+	return model.JsonMap{
+		"buckets": buckets,
+	}
+}
+
+func (query GeoHexGrid) calcKey(cell any) string {
+	if cellUint, ok := cell.(uint64); ok {
+		return strconv.FormatUint(cellUint, 16)
+	}
+	cellInt, _ := util.ExtractInt64(cell)
+	return strconv.FormatUint(uint64(cellInt), 16)
+}
+
+func (query GeoHexGrid) String() string {
+	return "geohex_grid"
+}
@@ -0,0 +1,57 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// Missing is a single bucket of all documents without a value of the field.
+// It's a filter aggregation with "field IS NULL" condition.
+type Missing struct {
+	ctx   context.Context
+	field model.Expr
+}
+
+func NewMissing(ctx context.Context, field model.Expr) Missing {
+	return Missing{ctx: ctx, field: field}
+}
+
+func (query Missing) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query Missing) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for missing aggregation")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query Missing) String() string {
+	return "missing"
+}
+
+func (query Missing) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query Missing) CombinatorGroups() []CombinatorGroup {
+	return []CombinatorGroup{{
+		idx:         0,
+		Prefix:      "",
+		Key:         "",
+		WhereClause: model.NewInfixExpr(query.field, "IS", model.NullExpr),
+	}}
+}
+
+func (query Missing) CombinatorTranslateSqlResponseToJson(subGroup CombinatorGroup, rows []model.QueryResultRow) model.JsonMap {
+	return query.TranslateSqlResponseToJson(rows)
+}
+
+func (query Missing) CombinatorSplit() []model.QueryType {
+	return []model.QueryType{query}
+}
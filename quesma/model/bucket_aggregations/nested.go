@@ -0,0 +1,48 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+)
+
+// Nested is a single bucket of nested documents (objects of an array of objects) of all documents matching the query.
+// Its sub-aggregations are computed over nested documents, not over the parent ones.
+// It can only be a top-level aggregation. Its pancake selects from parent documents ARRAY JOIN nested ones.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-nested-aggregation.html
+type Nested struct {
+	ctx   context.Context
+	field schema.Field // field of nested type
+}
+
+func NewNested(ctx context.Context, field schema.Field) Nested {
+	return Nested{ctx: ctx, field: field}
+}
+
+func (query Nested) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query Nested) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for nested aggregation")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query Nested) String() string {
+	return fmt.Sprintf("nested(path: %s)", query.field.PropertyName)
+}
+
+func (query Nested) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query Nested) Field() schema.Field {
+	return query.field
+}
@@ -0,0 +1,55 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+)
+
+// RareTermsLimit is the max number of buckets we request from the database.
+// Buckets are ordered by doc_count ascending, so all rare ones come first.
+const RareTermsLimit = 10000
+
+// RareTerms is like terms, but returns only terms with at most maxDocCount documents.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-rare-terms-aggregation.html
+type RareTerms struct {
+	ctx         context.Context
+	maxDocCount int64
+}
+
+func NewRareTerms(ctx context.Context, maxDocCount int) RareTerms {
+	return RareTerms{ctx: ctx, maxDocCount: int64(maxDocCount)}
+}
+
+func (query RareTerms) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query RareTerms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	buckets := make([]model.JsonMap, 0, len(rows))
+	for _, row := range rows {
+		if len(row.Cols) < 2 {
+			logger.ErrorWithCtx(query.ctx).Msgf(
+				"unexpected number of columns in rare_terms aggregation response, len: %d, row: %v", len(row.Cols), row)
+			continue
+		}
+		docCount := row.Cols[len(row.Cols)-1].Value
+		// we can't filter by count in SQL, so we do it here
+		if docCountAsInt, ok := util.ExtractInt64Maybe(docCount); ok && docCountAsInt > query.maxDocCount {
+			continue
+		}
+		buckets = append(buckets, model.JsonMap{
+			"key":       row.Cols[len(row.Cols)-2].Value,
+			"doc_count": docCount,
+		})
+	}
+	return model.JsonMap{"buckets": buckets}
+}
+
+func (query RareTerms) String() string {
+	return fmt.Sprintf("rare_terms(max_doc_count: %d)", query.maxDocCount)
+}
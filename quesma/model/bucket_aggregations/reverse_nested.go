@@ -0,0 +1,37 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// ReverseNested is a single bucket of parent documents of nested documents in the current bucket (inside nested aggregation).
+// We support it only without sub-aggregations, so it's computed like a metrics aggregation:
+// a count of distinct parent documents. Its only column is that count.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-reverse-nested-aggregation.html
+type ReverseNested struct {
+	ctx context.Context
+}
+
+func NewReverseNested(ctx context.Context) ReverseNested {
+	return ReverseNested{ctx: ctx}
+}
+
+func (query ReverseNested) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query ReverseNested) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for reverse_nested aggregation")
+		return model.JsonMap{"doc_count": 0}
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[len(rows[0].Cols)-1].Value}
+}
+
+func (query ReverseNested) String() string {
+	return "reverse_nested"
+}
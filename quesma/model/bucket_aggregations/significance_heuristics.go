@@ -0,0 +1,170 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"fmt"
+	"math"
+)
+
+// SignificanceHeuristic scores a term of significant_terms/significant_text.
+// Foreground (subset) is the current bucket, background (superset) is the whole table, or docs matching background_filter.
+// Formulas are the same as in Elastic:
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-significantterms-aggregation.html#significantterms-aggregation-parameters
+type SignificanceHeuristic interface {
+	Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64
+	String() string
+}
+
+// JLH is the default heuristic: absolute change in popularity * relative change in popularity
+type JLH struct{}
+
+func (h JLH) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	if subsetSize == 0 || supersetSize == 0 {
+		return 0
+	}
+	if supersetFreq == 0 {
+		// possible only if background isn't a superset of foreground. Elastic assumes 1 to avoid infinity.
+		supersetFreq = 1
+	}
+	subsetProbability := float64(subsetFreq) / float64(subsetSize)
+	supersetProbability := float64(supersetFreq) / float64(supersetSize)
+	absoluteProbabilityChange := subsetProbability - supersetProbability
+	if absoluteProbabilityChange <= 0 {
+		return 0
+	}
+	return absoluteProbabilityChange * (subsetProbability / supersetProbability)
+}
+
+func (h JLH) String() string {
+	return "jlh"
+}
+
+// Percentage is subsetFreq / supersetFreq
+type Percentage struct{}
+
+func (h Percentage) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	if supersetFreq == 0 {
+		return 0
+	}
+	return float64(subsetFreq) / float64(supersetFreq)
+}
+
+func (h Percentage) String() string {
+	return "percentage"
+}
+
+// GND is Google normalized distance
+type GND struct {
+	BackgroundIsSuperset bool
+}
+
+func (h GND) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	fx, fy, fxy, n := float64(supersetFreq), float64(subsetSize), float64(subsetFreq), float64(supersetSize)
+	if fxy == 0 { // no co-occurrence
+		return 0
+	}
+	if fx == fy && fx == fxy { // perfect co-occurrence
+		return 1
+	}
+	if !h.BackgroundIsSuperset {
+		fx += fxy
+		n += fy
+	}
+	score := (math.Max(math.Log(fx), math.Log(fy)) - math.Log(fxy)) / (math.Log(n) - math.Min(math.Log(fx), math.Log(fy)))
+	// GND scores relevant terms low, so we invert it
+	return math.Exp(-score)
+}
+
+func (h GND) String() string {
+	return fmt.Sprintf("gnd(background_is_superset: %v)", h.BackgroundIsSuperset)
+}
+
+// MutualInformation and ChiSquare are computed from the contingency table of (in foreground, contains term)
+type MutualInformation struct {
+	IncludeNegatives     bool
+	BackgroundIsSuperset bool
+}
+
+func (h MutualInformation) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	f := newFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize, h.BackgroundIsSuperset)
+	score := (miTerm(f.n00, f.n0_, f.n_0, f.n) + miTerm(f.n01, f.n0_, f.n_1, f.n) +
+		miTerm(f.n10, f.n1_, f.n_0, f.n) + miTerm(f.n11, f.n1_, f.n_1, f.n)) / math.Ln2
+	if math.IsNaN(score) {
+		score = math.Inf(-1)
+	}
+	if !h.IncludeNegatives && f.isNegative() {
+		return math.Inf(-1)
+	}
+	return score
+}
+
+func (h MutualInformation) String() string {
+	return fmt.Sprintf("mutual_information(include_negatives: %v, background_is_superset: %v)", h.IncludeNegatives, h.BackgroundIsSuperset)
+}
+
+type ChiSquare struct {
+	IncludeNegatives     bool
+	BackgroundIsSuperset bool
+}
+
+func (h ChiSquare) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	f := newFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize, h.BackgroundIsSuperset)
+	if !h.IncludeNegatives && f.isNegative() {
+		return math.Inf(-1)
+	}
+	return f.n * math.Pow(f.n11*f.n00-f.n01*f.n10, 2) / (f.n_1 * f.n1_ * f.n0_ * f.n_0)
+}
+
+func (h ChiSquare) String() string {
+	return fmt.Sprintf("chi_square(include_negatives: %v, background_is_superset: %v)", h.IncludeNegatives, h.BackgroundIsSuperset)
+}
+
+// frequencies: nXY - number of docs, X = 1 <=> doc contains the term, Y = 1 <=> doc is in the foreground.
+// '_' means any value.
+type frequencies struct {
+	n00, n01, n10, n11, n0_, n1_, n_0, n_1, n float64
+}
+
+func newFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize int64, backgroundIsSuperset bool) frequencies {
+	subFreq, subSize, superFreq, superSize := float64(subsetFreq), float64(subsetSize), float64(supersetFreq), float64(supersetSize)
+	if backgroundIsSuperset {
+		return frequencies{
+			n00: superSize - superFreq - (subSize - subFreq),
+			n01: subSize - subFreq,
+			n10: superFreq - subFreq,
+			n11: subFreq,
+			n0_: superSize - superFreq,
+			n1_: superFreq,
+			n_0: superSize - subSize,
+			n_1: subSize,
+			n:   superSize,
+		}
+	}
+	return frequencies{
+		n00: superSize - superFreq,
+		n01: subSize - subFreq,
+		n10: superFreq,
+		n11: subFreq,
+		n0_: superSize - superFreq + subSize - subFreq,
+		n1_: superFreq + subFreq,
+		n_0: superSize,
+		n_1: subSize,
+		n:   superSize + subSize,
+	}
+}
+
+// isNegative <=> term is less frequent in the foreground than in the rest of the background
+func (f frequencies) isNegative() bool {
+	return f.n11/f.n_1 < f.n10/f.n_0
+}
+
+func miTerm(nxy, nx_, n_y, n float64) float64 {
+	numerator := math.Abs(n * nxy)
+	denominator := math.Abs(nx_ * n_y)
+	factor := math.Abs(nxy / n)
+	if numerator < 1e-7 && factor < 1e-7 {
+		return 0
+	}
+	return factor * math.Log(numerator/denominator)
+}
@@ -0,0 +1,56 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestSignificanceHeuristics(t *testing.T) {
+	// subsetFreq, subsetSize, supersetFreq, supersetSize
+	const subFreq, subSize, superFreq, superSize = 10, 100, 20, 1000
+	testcases := []struct {
+		heuristic SignificanceHeuristic
+		expected  float64
+	}{
+		{JLH{}, 0.4},
+		{Percentage{}, 0.5},
+		{GND{BackgroundIsSuperset: true}, 0.5551083771984573},
+		{MutualInformation{BackgroundIsSuperset: true}, 0.015275950046279206},
+		{ChiSquare{BackgroundIsSuperset: true}, 36.281179138321995},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%s(%d)", tc.heuristic, i), func(t *testing.T) {
+			assert.InDelta(t, tc.expected, tc.heuristic.Score(subFreq, subSize, superFreq, superSize), 1e-9)
+		})
+	}
+}
+
+func TestSignificanceHeuristics_lessFrequentInForeground(t *testing.T) {
+	// 1% of the foreground, 50% of the background
+	const subFreq, subSize, superFreq, superSize = 1, 100, 500, 1000
+
+	assert.Equal(t, 0.0, JLH{}.Score(subFreq, subSize, superFreq, superSize))
+	assert.Equal(t, math.Inf(-1), ChiSquare{BackgroundIsSuperset: true}.Score(subFreq, subSize, superFreq, superSize))
+	assert.Equal(t, math.Inf(-1), MutualInformation{BackgroundIsSuperset: true}.Score(subFreq, subSize, superFreq, superSize))
+	assert.Greater(t, ChiSquare{IncludeNegatives: true, BackgroundIsSuperset: true}.Score(subFreq, subSize, superFreq, superSize), 0.0)
+	assert.Greater(t, MutualInformation{IncludeNegatives: true, BackgroundIsSuperset: true}.Score(subFreq, subSize, superFreq, superSize), 0.0)
+}
+
+func TestSelectSignificantBuckets(t *testing.T) {
+	candidates := []significantBucket{
+		{key: "a", docCount: 50, bgCount: 100, rowIdx: 0},  // significant
+		{key: "b", docCount: 2, bgCount: 2, rowIdx: 1},     // below min_doc_count
+		{key: "c", docCount: 10, bgCount: 1000, rowIdx: 2}, // less frequent in foreground
+		{key: "d", docCount: 30, bgCount: 30, rowIdx: 3},   // the most significant
+		{key: "e", docCount: 20, bgCount: 100, rowIdx: 4},  // significant, but over size
+	}
+	buckets := selectSignificantBuckets(candidates, JLH{}, 100, 10000, SignificantTermsDefaultMinDocCount, 2)
+	assert.Len(t, buckets, 2)
+	assert.Equal(t, "d", buckets[0].key)
+	assert.Equal(t, "a", buckets[1].key)
+	assert.Greater(t, buckets[0].score, buckets[1].score)
+}
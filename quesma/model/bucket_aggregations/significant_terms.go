@@ -0,0 +1,143 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"sort"
+)
+
+// SignificantTermsDefaultMinDocCount is Elastic's default, the same for significant_terms and significant_text
+const SignificantTermsDefaultMinDocCount = 3
+
+// SignificantTerms is terms aggregation, but buckets are the terms which are the most significant in the foreground
+// (current bucket) compared to the background (whole table, or documents matching background_filter).
+// SQL returns up to shard_size most frequent terms, and we score, filter and order them here.
+// Columns of a bucket are: parent count (foreground size), key, background count of the key, background size, count.
+// Background counts are computed only for those terms, see pancakeSqlQueryGenerator.generateSignificantTermsQuery.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-significantterms-aggregation.html
+type SignificantTerms struct {
+	ctx              context.Context
+	heuristic        SignificanceHeuristic
+	backgroundFilter model.Expr // nil <=> whole table is the background
+	minDocCount      int64
+	size             int
+}
+
+func NewSignificantTerms(ctx context.Context, heuristic SignificanceHeuristic, backgroundFilter model.Expr, minDocCount int64, size int) SignificantTerms {
+	return SignificantTerms{ctx: ctx, heuristic: heuristic, backgroundFilter: backgroundFilter, minDocCount: minDocCount, size: size}
+}
+
+func (query SignificantTerms) BackgroundFilter() model.Expr {
+	return query.backgroundFilter
+}
+
+func (query SignificantTerms) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+const significantTermsColumnsNr = 5
+
+func (query SignificantTerms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		return model.JsonMap{"buckets": []model.JsonMap{}}
+	}
+	if len(rows[0].Cols) < significantTermsColumnsNr {
+		logger.ErrorWithCtx(query.ctx).Msgf(
+			"unexpected number of columns in significant_terms aggregation response, len: %d, rows[0]: %v", len(rows[0].Cols), rows[0])
+		return model.JsonMap{"buckets": []model.JsonMap{}}
+	}
+
+	subsetSize, supersetSize := query.sizes(rows[0])
+	buckets := make([]model.JsonMap, 0, query.size)
+	for _, bucket := range query.selectBuckets(rows) {
+		buckets = append(buckets, bucket.toJson())
+	}
+	return model.JsonMap{
+		"doc_count": subsetSize,
+		"bg_count":  supersetSize,
+		"buckets":   buckets,
+	}
+}
+
+func (query SignificantTerms) SelectBuckets(rows []model.QueryResultRow) []int {
+	buckets := query.selectBuckets(rows)
+	indexes := make([]int, 0, len(buckets))
+	for _, bucket := range buckets {
+		indexes = append(indexes, bucket.rowIdx)
+	}
+	return indexes
+}
+
+func (query SignificantTerms) selectBuckets(rows []model.QueryResultRow) []significantBucket {
+	if len(rows) == 0 || len(rows[0].Cols) < significantTermsColumnsNr {
+		return nil
+	}
+	subsetSize, supersetSize := query.sizes(rows[0])
+	candidates := make([]significantBucket, 0, len(rows))
+	for i, row := range rows {
+		cols := row.Cols[len(row.Cols)-significantTermsColumnsNr+1:]
+		docCount, _ := util.ExtractInt64Maybe(cols[3].Value)
+		bgCount, _ := util.ExtractInt64Maybe(cols[1].Value)
+		candidates = append(candidates, significantBucket{key: cols[0].Value, docCount: docCount, bgCount: bgCount, rowIdx: i})
+	}
+	return selectSignificantBuckets(candidates, query.heuristic, subsetSize, supersetSize, query.minDocCount, query.size)
+}
+
+// sizes returns foreground (parent bucket) and background doc counts, they're the same in every row
+func (query SignificantTerms) sizes(row model.QueryResultRow) (subsetSize, supersetSize int64) {
+	cols := row.Cols[len(row.Cols)-significantTermsColumnsNr:]
+	subsetSize, _ = util.ExtractInt64Maybe(cols[0].Value)
+	supersetSize, _ = util.ExtractInt64Maybe(cols[3].Value)
+	return subsetSize, supersetSize
+}
+
+func (query SignificantTerms) String() string {
+	return fmt.Sprintf("significant_terms(heuristic: %s, min_doc_count: %d, size: %d)", query.heuristic, query.minDocCount, query.size)
+}
+
+// significantBucket is a term with its foreground (docCount) and background (bgCount) doc counts
+type significantBucket struct {
+	key      any
+	docCount int64
+	bgCount  int64
+	score    float64
+	rowIdx   int
+}
+
+func (bucket significantBucket) toJson() model.JsonMap {
+	return model.JsonMap{
+		"key":       bucket.key,
+		"doc_count": bucket.docCount,
+		"score":     bucket.score,
+		"bg_count":  bucket.bgCount,
+	}
+}
+
+// selectSignificantBuckets scores the candidates and returns at most size of them with a positive score
+// and at least minDocCount documents, sorted by score descending (ties keep the original order).
+func selectSignificantBuckets(candidates []significantBucket, heuristic SignificanceHeuristic,
+	subsetSize, supersetSize, minDocCount int64, size int) []significantBucket {
+
+	buckets := make([]significantBucket, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.docCount < minDocCount {
+			continue
+		}
+		candidate.score = heuristic.Score(candidate.docCount, subsetSize, candidate.bgCount, supersetSize)
+		if candidate.score > 0 {
+			buckets = append(buckets, candidate)
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].score > buckets[j].score
+	})
+	if len(buckets) > size {
+		buckets = buckets[:size]
+	}
+	return buckets
+}
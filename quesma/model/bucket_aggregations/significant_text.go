@@ -0,0 +1,89 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"reflect"
+)
+
+// SignificantText is significant_terms over words of a full-text field.
+// It can't have sub-aggregations, so it's computed like a metrics aggregation: in a single row, without GROUP BY,
+// because splitting documents into words would change counts of everything else in the query.
+// Columns are: foreground size, foreground doc counts of words ([words], [counts]),
+// background doc counts of the same words, background size.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-significanttext-aggregation.html
+type SignificantText struct {
+	ctx         context.Context
+	heuristic   SignificanceHeuristic
+	minDocCount int64
+	size        int
+}
+
+func NewSignificantText(ctx context.Context, heuristic SignificanceHeuristic, minDocCount int64, size int) SignificantText {
+	return SignificantText{ctx: ctx, heuristic: heuristic, minDocCount: minDocCount, size: size}
+}
+
+func (query SignificantText) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+const significantTextColumnsNr = 4
+
+func (query SignificantText) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < significantTextColumnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("not enough columns returned for significant_text aggregation, rows: %v", rows)
+		return model.JsonMap{"buckets": []model.JsonMap{}}
+	}
+
+	cols := rows[0].Cols[len(rows[0].Cols)-significantTextColumnsNr:]
+	subsetSize, _ := util.ExtractInt64Maybe(cols[0].Value)
+	supersetSize, _ := util.ExtractInt64Maybe(cols[3].Value)
+	candidates, err := query.candidates(cols[1].Value, cols[2].Value)
+	if err != nil {
+		logger.ErrorWithCtx(query.ctx).Msgf("significant_text: %v", err)
+	}
+
+	buckets := make([]model.JsonMap, 0, query.size)
+	for _, bucket := range selectSignificantBuckets(candidates, query.heuristic, subsetSize, supersetSize, query.minDocCount, query.size) {
+		buckets = append(buckets, bucket.toJson())
+	}
+	return model.JsonMap{
+		"doc_count": subsetSize,
+		"bg_count":  supersetSize,
+		"buckets":   buckets,
+	}
+}
+
+// candidates parses sumMap's result: ([words], [counts]), and background counts of the same words
+func (query SignificantText) candidates(foreground, background any) ([]significantBucket, error) {
+	tuple := reflect.ValueOf(foreground)
+	if tuple.Kind() != reflect.Slice || tuple.Len() != 2 {
+		return nil, fmt.Errorf("expected (keys, values) tuple, got %T, value: %v", foreground, foreground)
+	}
+	keys, docCounts := reflect.ValueOf(tuple.Index(0).Interface()), reflect.ValueOf(tuple.Index(1).Interface())
+	bgCounts := reflect.ValueOf(background)
+	if keys.Kind() != reflect.Slice || docCounts.Kind() != reflect.Slice || bgCounts.Kind() != reflect.Slice ||
+		keys.Len() != docCounts.Len() || keys.Len() != bgCounts.Len() {
+		return nil, fmt.Errorf("expected keys, foreground and background counts of the same length, got %v and %v", foreground, background)
+	}
+
+	candidates := make([]significantBucket, 0, keys.Len())
+	for i := 0; i < keys.Len(); i++ {
+		docCount, okDocCount := util.ExtractInt64Maybe(docCounts.Index(i).Interface())
+		bgCount, okBgCount := util.ExtractInt64Maybe(bgCounts.Index(i).Interface())
+		if !okDocCount || !okBgCount {
+			return candidates, fmt.Errorf("invalid counts of %v: %v, %v", keys.Index(i).Interface(), docCounts.Index(i).Interface(), bgCounts.Index(i).Interface())
+		}
+		candidates = append(candidates, significantBucket{key: keys.Index(i).Interface(), docCount: docCount, bgCount: bgCount, rowIdx: i})
+	}
+	return candidates, nil
+}
+
+func (query SignificantText) String() string {
+	return fmt.Sprintf("significant_text(heuristic: %s, min_doc_count: %d, size: %d)", query.heuristic, query.minDocCount, query.size)
+}
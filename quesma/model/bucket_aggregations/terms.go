@@ -14,8 +14,7 @@ import (
 
 // TODO when adding include/exclude, check escaping of ' and \ in those fields
 type Terms struct {
-	ctx         context.Context
-	significant bool // true <=> significant_terms, false <=> terms
+	ctx context.Context
 	// include is either:
 	//   - single value: then for strings, it can be a regex.
 	//   - array: then field must match exactly one of the values (never a regex)
@@ -28,8 +27,8 @@ type Terms struct {
 	exclude any
 }
 
-func NewTerms(ctx context.Context, significant bool, include, exclude any) Terms {
-	return Terms{ctx: ctx, significant: significant, include: include, exclude: exclude}
+func NewTerms(ctx context.Context, include, exclude any) Terms {
+	return Terms{ctx: ctx, include: include, exclude: exclude}
 }
 
 func (query Terms) AggregationType() model.AggregationType {
@@ -51,10 +50,6 @@ func (query Terms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model
 		bucket := model.JsonMap{
 			"doc_count": docCount,
 		}
-		if query.significant {
-			bucket["score"] = docCount
-			bucket["bg_count"] = docCount
-		}
 
 		// response for bool keys is different
 		key := query.key(row)
@@ -71,33 +66,17 @@ func (query Terms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model
 		buckets = append(buckets, bucket)
 	}
 
-	if !query.significant {
-		parentCountAsInt, _ := util.ExtractInt64(query.parentCount(rows[0]))
-		sumOtherDocCount := int(parentCountAsInt) - query.sumDocCounts(rows)
-		return model.JsonMap{
-			"sum_other_doc_count":         sumOtherDocCount,
-			"doc_count_error_upper_bound": 0,
-			"buckets":                     buckets,
-		}
-	} else {
-		parentDocCount, _ := util.ExtractInt64(query.parentCount(rows[0]))
-		return model.JsonMap{
-			"buckets":   buckets,
-			"doc_count": parentDocCount,
-			"bg_count":  parentDocCount,
-		}
+	parentCountAsInt, _ := util.ExtractInt64(query.parentCount(rows[0]))
+	sumOtherDocCount := int(parentCountAsInt) - query.sumDocCounts(rows)
+	return model.JsonMap{
+		"sum_other_doc_count":         sumOtherDocCount,
+		"doc_count_error_upper_bound": 0,
+		"buckets":                     buckets,
 	}
 }
 
 func (query Terms) String() string {
-	if !query.significant {
-		return "terms"
-	}
-	return "significant_terms"
-}
-
-func (query Terms) IsSignificant() bool {
-	return query.significant
+	return "terms"
 }
 
 func (query Terms) sumDocCounts(rows []model.QueryResultRow) int {
@@ -0,0 +1,81 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+	"reflect"
+)
+
+// VariableWidthHistogram is computed by Clickhouse's adaptive histogram(buckets)(field) function,
+// which returns an array of (lower, upper, height) tuples in one row.
+// That's why it's processed like a metrics aggregation, and doesn't support sub-aggregations.
+// Elastic's key is the centroid of the bucket, we return the middle of [min, max] instead.
+type VariableWidthHistogram struct {
+	ctx     context.Context
+	buckets int
+}
+
+func NewVariableWidthHistogram(ctx context.Context, buckets int) VariableWidthHistogram {
+	return VariableWidthHistogram{ctx: ctx, buckets: buckets}
+}
+
+func (query VariableWidthHistogram) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query VariableWidthHistogram) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	buckets := make([]model.JsonMap, 0, query.buckets)
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for variable_width_histogram aggregation")
+		return model.JsonMap{"buckets": buckets}
+	}
+
+	histogram := reflect.ValueOf(rows[0].Cols[0].Value)
+	if histogram.Kind() != reflect.Slice {
+		logger.ErrorWithCtx(query.ctx).Msgf("unexpected type of histogram: %T, value: %v", rows[0].Cols[0].Value, rows[0].Cols[0].Value)
+		return model.JsonMap{"buckets": buckets}
+	}
+	for i := 0; i < histogram.Len(); i++ {
+		lower, upper, height, ok := query.parseBin(histogram.Index(i).Interface())
+		if !ok {
+			logger.ErrorWithCtx(query.ctx).Msgf("unexpected histogram bin: %v", histogram.Index(i).Interface())
+			continue
+		}
+		docCount := int64(math.Round(height))
+		if docCount == 0 {
+			continue
+		}
+		buckets = append(buckets, model.JsonMap{
+			"min":       lower,
+			"key":       (lower + upper) / 2,
+			"max":       upper,
+			"doc_count": docCount,
+		})
+	}
+	return model.JsonMap{"buckets": buckets}
+}
+
+// parseBin parses (lower, upper, height) tuple, which is returned by the driver as a slice
+func (query VariableWidthHistogram) parseBin(bin any) (lower, upper, height float64, ok bool) {
+	binValue := reflect.ValueOf(bin)
+	if binValue.Kind() != reflect.Slice || binValue.Len() != 3 {
+		return 0, 0, 0, false
+	}
+	var values [3]float64
+	for i := range values {
+		if values[i], ok = util.ExtractNumeric64Maybe(binValue.Index(i).Interface()); !ok {
+			return 0, 0, 0, false
+		}
+	}
+	return values[0], values[1], values[2], true
+}
+
+func (query VariableWidthHistogram) String() string {
+	return fmt.Sprintf("variable_width_histogram(buckets: %d)", query.buckets)
+}
@@ -9,4 +9,7 @@ const (
 
 	DateHourFunction = "__quesma_date_hour"
 	MatchOperator    = "__quesma_match"
+	FuzzyOperator    = "__quesma_fuzzy"
+	ScoreOperator    = "__quesma_score"
+	BoostFunction    = "__quesma_boost"
 )
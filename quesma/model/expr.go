@@ -300,7 +300,8 @@ func (l LambdaExpr) Accept(v ExprVisitor) interface{} {
 	return v.VisitLambdaExpr(l)
 }
 
-// JoinExpr represents a JOIN expression, e.g. `table1 INNER JOIN table2 ON (table1.id = table2.id)`
+// JoinExpr represents a JOIN expression, e.g. `table1 INNER JOIN table2 ON (table1.id = table2.id)`,
+// or `table ARRAY JOIN "array" AS "element"` (then On is nil)
 type JoinExpr struct {
 	Lhs      Expr
 	JoinType string
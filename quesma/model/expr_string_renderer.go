@@ -268,11 +268,14 @@ func (v *renderer) VisitSelectCommand(c SelectCommand) interface{} {
 	}
 
 	if c.Limit != noLimit {
-		if len(c.LimitBy) <= 1 {
+		if len(c.LimitBy) == 0 {
 			sb.WriteString(fmt.Sprintf(" LIMIT %d", c.Limit))
+			if c.Offset > 0 {
+				sb.WriteString(fmt.Sprintf(" OFFSET %d", c.Offset))
+			}
 		} else {
-			limitBys := make([]string, 0, len(c.LimitBy)-1)
-			for _, col := range c.LimitBy[:len(c.LimitBy)-1] {
+			limitBys := make([]string, 0, len(c.LimitBy))
+			for _, col := range c.LimitBy {
 				limitBys = append(limitBys, AsString(col))
 			}
 			sb.WriteString(fmt.Sprintf(" LIMIT %d BY %s", c.Limit, strings.Join(limitBys, ", ")))
@@ -354,10 +357,12 @@ func (v *renderer) VisitJoinExpr(j JoinExpr) interface{} {
 			sb.WriteString(join.Rhs.Accept(v).(string))
 		}
 
-		sb.WriteString(" ON ")
-		sb.WriteString("(")
-		sb.WriteString(join.On.Accept(v).(string))
-		sb.WriteString(")")
+		if join.On != nil { // ARRAY JOIN has no ON clause
+			sb.WriteString(" ON ")
+			sb.WriteString("(")
+			sb.WriteString(join.On.Accept(v).(string))
+			sb.WriteString(")")
+		}
 
 		join = nextJoin
 	}
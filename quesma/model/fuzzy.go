@@ -0,0 +1,132 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package model
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fuzziness is the maximum edit distance allowed in fuzzy matching, either a fixed number of edits (0, 1 or 2),
+// or AUTO, which depends on the length of the term.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/common-options.html#fuzziness
+type Fuzziness struct {
+	Edits    int
+	Auto     bool
+	AutoLow  int // AUTO:[low],[high]: terms shorter than low must match exactly,
+	AutoHigh int // terms shorter than high may have 1 edit, longer ones 2 edits
+}
+
+const maxFuzzyEdits = 2
+
+var FuzzinessAuto = Fuzziness{Auto: true, AutoLow: 3, AutoHigh: 6}
+
+// ParseFuzziness parses `fuzziness` parameter: a number of edits, "AUTO" or "AUTO:[low],[high]"
+func ParseFuzziness(fuzziness any) (Fuzziness, error) {
+	switch f := fuzziness.(type) {
+	case float64:
+		return newFuzzinessEdits(f)
+	case int:
+		return newFuzzinessEdits(float64(f))
+	case string:
+		f = strings.TrimSpace(f)
+		if !strings.HasPrefix(strings.ToUpper(f), "AUTO") {
+			edits, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return Fuzziness{}, fmt.Errorf("invalid fuzziness: %s", f)
+			}
+			return newFuzzinessEdits(edits)
+		}
+		if len(f) == len("AUTO") {
+			return FuzzinessAuto, nil
+		}
+		lowStr, highStr, found := strings.Cut(strings.TrimPrefix(f[len("AUTO"):], ":"), ",")
+		low, errLow := strconv.Atoi(strings.TrimSpace(lowStr))
+		high, errHigh := strconv.Atoi(strings.TrimSpace(highStr))
+		if !found || errLow != nil || errHigh != nil || low < 0 || high < low {
+			return Fuzziness{}, fmt.Errorf("invalid fuzziness: %s", f)
+		}
+		return Fuzziness{Auto: true, AutoLow: low, AutoHigh: high}, nil
+	}
+	return Fuzziness{}, fmt.Errorf("invalid fuzziness: %v", fuzziness)
+}
+
+func newFuzzinessEdits(edits float64) (Fuzziness, error) {
+	if edits < 0 || edits > maxFuzzyEdits {
+		return Fuzziness{}, fmt.Errorf("invalid fuzziness: %v, only 0, 1 and 2 edits are allowed", edits)
+	}
+	return Fuzziness{Edits: int(edits)}, nil
+}
+
+// MaxEdits returns the maximum edit distance for the term
+func (f Fuzziness) MaxEdits(term string) int {
+	if !f.Auto {
+		return f.Edits
+	}
+	switch length := utf8.RuneCountInString(term); {
+	case length < f.AutoLow:
+		return 0
+	case length < f.AutoHigh:
+		return 1
+	default:
+		return maxFuzzyEdits
+	}
+}
+
+// FuzzyMatch is the right side of FuzzyOperator: `column __quesma_fuzzy FuzzyMatch`.
+// It's translated to SQL by the schema transformation, as it depends on the field type.
+type FuzzyMatch struct {
+	Term           string
+	Fuzziness      Fuzziness
+	PrefixLength   int  // the first PrefixLength characters have to match exactly
+	Transpositions bool // if true, ab -> ba counts as one edit (Elasticsearch default), otherwise as two
+}
+
+func NewFuzzyMatchExpr(column Expr, match FuzzyMatch) Expr {
+	return NewInfixExpr(column, FuzzyOperator, NewLiteral(match))
+}
+
+func (m FuzzyMatch) String() string {
+	if m.Fuzziness.Auto {
+		return fmt.Sprintf("'%s'~AUTO:%d,%d", m.Term, m.Fuzziness.AutoLow, m.Fuzziness.AutoHigh)
+	}
+	return fmt.Sprintf("'%s'~%d", m.Term, m.Fuzziness.Edits)
+}
+
+// ToSQL returns an expression checking if the (string) column is within the edit distance from the term, case-insensitive.
+// If splitWords, any word of the column has to match, like in an analyzed text field (unless the term has more words).
+func (m FuzzyMatch) ToSQL(column Expr, splitWords bool) Expr {
+	term := strings.ToLower(m.Term)
+	edits := m.Fuzziness.MaxEdits(term)
+
+	distanceFunction := "editDistance"
+	if m.Transpositions {
+		distanceFunction = "damerauLevenshteinDistance"
+	}
+	match := func(value Expr) Expr {
+		var predicate Expr
+		if edits == 0 {
+			predicate = NewInfixExpr(value, "=", NewLiteral(util.SingleQuote(term)))
+		} else {
+			predicate = NewInfixExpr(NewFunction(distanceFunction, value, NewLiteral(util.SingleQuote(term))), "<=", NewLiteral(edits))
+		}
+		if m.PrefixLength > 0 && edits > 0 {
+			prefix := string([]rune(term)[:min(m.PrefixLength, utf8.RuneCountInString(term))])
+			predicate = And([]Expr{NewFunction("startsWith", value, NewLiteral(util.SingleQuote(prefix))), predicate})
+		}
+		return predicate
+	}
+
+	lowerColumn := NewFunction("lower", column)
+	if !splitWords || strings.IndexFunc(term, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) >= 0 {
+		return match(lowerColumn)
+	}
+	// words are split like by the standard analyzer, on anything but letters and digits
+	const word = "x"
+	words := NewFunction("splitByRegexp", NewLiteral(`'[^\p{L}\p{N}]+'`), lowerColumn)
+	return NewFunction("arrayExists", NewLambdaExpr([]string{word}, match(NewLiteral(word))), words)
+}
@@ -0,0 +1,41 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseFuzziness(t *testing.T) {
+	tests := []struct {
+		fuzziness any
+		expected  Fuzziness
+		wantErr   bool
+	}{
+		{"AUTO", FuzzinessAuto, false},
+		{"auto:2,4", Fuzziness{Auto: true, AutoLow: 2, AutoHigh: 4}, false},
+		{"AUTO:4", Fuzziness{}, true},
+		{1.0, Fuzziness{Edits: 1}, false},
+		{"2", Fuzziness{Edits: 2}, false},
+		{3.0, Fuzziness{}, true},
+		{"abc", Fuzziness{}, true},
+	}
+	for _, tt := range tests {
+		fuzziness, err := ParseFuzziness(tt.fuzziness)
+		if tt.wantErr {
+			assert.Error(t, err, tt.fuzziness)
+		} else {
+			assert.NoError(t, err, tt.fuzziness)
+			assert.Equal(t, tt.expected, fuzziness, tt.fuzziness)
+		}
+	}
+}
+
+func TestFuzzinessMaxEdits(t *testing.T) {
+	assert.Equal(t, 0, FuzzinessAuto.MaxEdits("ab"))
+	assert.Equal(t, 1, FuzzinessAuto.MaxEdits("abc"))
+	assert.Equal(t, 1, FuzzinessAuto.MaxEdits("łódź"))
+	assert.Equal(t, 2, FuzzinessAuto.MaxEdits("abcdef"))
+	assert.Equal(t, 1, Fuzziness{Edits: 1}.MaxEdits("abcdef"))
+}
@@ -0,0 +1,70 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"reflect"
+)
+
+// Boxplot columns are: min, max, [q1, q2, q3] (one array column), lower whisker, upper whisker.
+// Whiskers are the lowest/highest values within 1.5 IQR from q1/q3, like in Elastic.
+type Boxplot struct {
+	ctx context.Context
+}
+
+func NewBoxplot(ctx context.Context) Boxplot {
+	return Boxplot{ctx: ctx}
+}
+
+const boxplotColumnsNr = 5
+
+func (query Boxplot) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query Boxplot) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	// that's what Elastic returns for no values
+	emptyResult := model.JsonMap{
+		"min":   "Infinity",
+		"max":   "-Infinity",
+		"q1":    "NaN",
+		"q2":    "NaN",
+		"q3":    "NaN",
+		"lower": "Infinity",
+		"upper": "-Infinity",
+	}
+	if len(rows) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for boxplot aggregation")
+		return emptyResult
+	}
+	if len(rows[0].Cols) < boxplotColumnsNr {
+		logger.ErrorWithCtx(query.ctx).Msgf("unexpected number of columns in boxplot aggregation response, len(rows[0].Cols): %d", len(rows[0].Cols))
+		return emptyResult
+	}
+
+	cols := rows[0].Cols[len(rows[0].Cols)-boxplotColumnsNr:]
+	if cols[0].Value == nil {
+		return emptyResult
+	}
+	quartiles := reflect.ValueOf(cols[2].Value)
+	if quartiles.Kind() != reflect.Slice || quartiles.Len() != 3 {
+		logger.ErrorWithCtx(query.ctx).Msgf("unexpected quartiles in boxplot aggregation response: %v", cols[2].Value)
+		return emptyResult
+	}
+	return model.JsonMap{
+		"min":   cols[0].Value,
+		"max":   cols[1].Value,
+		"q1":    quartiles.Index(0).Interface(),
+		"q2":    quartiles.Index(1).Interface(),
+		"q3":    quartiles.Index(2).Interface(),
+		"lower": cols[3].Value,
+		"upper": cols[4].Value,
+	}
+}
+
+func (query Boxplot) String() string {
+	return "boxplot"
+}
@@ -4,23 +4,45 @@ package metrics_aggregations
 
 import (
 	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
+	"reflect"
 )
 
 type Cardinality struct {
 	ctx context.Context
+	// fromValues: we select distinct values (not only their number), because some pipeline aggregation
+	// (cumulative_cardinality) needs them. Cardinality is then their count.
+	fromValues bool
 }
 
 func NewCardinality(ctx context.Context) Cardinality {
 	return Cardinality{ctx: ctx}
 }
 
+func NewCardinalityFromValues(ctx context.Context) Cardinality {
+	return Cardinality{ctx: ctx, fromValues: true}
+}
+
 func (query Cardinality) AggregationType() model.AggregationType {
 	return model.MetricsAggregation
 }
 
 func (query Cardinality) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
-	return metricsTranslateSqlResponseToJson(query.ctx, rows)
+	if !query.fromValues {
+		return metricsTranslateSqlResponseToJson(query.ctx, rows)
+	}
+
+	cardinality := 0
+	if resultRowsAreNonEmpty(query.ctx, rows) {
+		values := reflect.ValueOf(rows[0].LastColValue())
+		if values.Kind() == reflect.Slice {
+			cardinality = values.Len()
+		} else {
+			logger.WarnWithCtx(query.ctx).Msgf("cardinality values are not an array: %v, type: %T", rows[0].LastColValue(), rows[0].LastColValue())
+		}
+	}
+	return model.JsonMap{"value": cardinality}
 }
 
 func (query Cardinality) String() string {
@@ -0,0 +1,47 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// GeoBounds computes the bounding box of all points, columns are: top (max lat), left (min lon), bottom (min lat), right (max lon)
+type GeoBounds struct {
+	ctx context.Context
+}
+
+func NewGeoBounds(ctx context.Context) GeoBounds {
+	return GeoBounds{ctx: ctx}
+}
+
+func (query GeoBounds) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query GeoBounds) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		return model.JsonMap{}
+	}
+	if len(rows[0].Cols) < 4 {
+		logger.ErrorWithCtx(query.ctx).Msgf("unexpected number of columns in geo_bounds aggregation response, len(rows[0].Cols): %d", len(rows[0].Cols))
+		return model.JsonMap{}
+	}
+	top, left, bottom, right := rows[0].Cols[0].Value, rows[0].Cols[1].Value, rows[0].Cols[2].Value, rows[0].Cols[3].Value
+	if top == nil || left == nil || bottom == nil || right == nil {
+		// no points, Elasticsearch returns no bounds then
+		return model.JsonMap{}
+	}
+	return model.JsonMap{
+		"bounds": model.JsonMap{
+			"top_left":     model.JsonMap{"lat": top, "lon": left},
+			"bottom_right": model.JsonMap{"lat": bottom, "lon": right},
+		},
+	}
+}
+
+func (query GeoBounds) String() string {
+	return "geo_bounds"
+}
@@ -0,0 +1,97 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+)
+
+// MatrixStats is computed only on documents, which have all fields, like in Elastic.
+// Columns are: doc count, then for every field: avg, varSamp, skewPop, kurtPop,
+// then for every pair of fields (i < j): covarSamp, corr.
+type MatrixStats struct {
+	ctx        context.Context
+	fieldNames []string
+}
+
+func NewMatrixStats(ctx context.Context, fieldNames []string) MatrixStats {
+	return MatrixStats{ctx: ctx, fieldNames: fieldNames}
+}
+
+const (
+	matrixStatsColumnsPerField = 4
+	matrixStatsColumnsPerPair  = 2
+)
+
+func (query MatrixStats) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query MatrixStats) columnsNr() int {
+	n := len(query.fieldNames)
+	return 1 + n*matrixStatsColumnsPerField + n*(n-1)/2*matrixStatsColumnsPerPair
+}
+
+func (query MatrixStats) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < query.columnsNr() {
+		logger.WarnWithCtx(query.ctx).Msgf("no rows or not enough columns returned for matrix_stats aggregation, rows: %v", rows)
+		return model.JsonMap{"doc_count": 0}
+	}
+
+	cols := rows[0].Cols[len(rows[0].Cols)-query.columnsNr():]
+	docCount := cols[0].Value
+	if count, ok := util.ExtractInt64Maybe(docCount); !ok || count == 0 {
+		return model.JsonMap{"doc_count": 0}
+	}
+
+	n := len(query.fieldNames)
+	fields := make([]model.JsonMap, 0, n)
+	for i, name := range query.fieldNames {
+		fieldCols := cols[1+i*matrixStatsColumnsPerField:]
+		variance := query.value(fieldCols[1].Value)
+		fields = append(fields, model.JsonMap{
+			"name":        name,
+			"count":       docCount,
+			"mean":        query.value(fieldCols[0].Value),
+			"variance":    variance,
+			"skewness":    query.value(fieldCols[2].Value),
+			"kurtosis":    query.value(fieldCols[3].Value),
+			"covariance":  model.JsonMap{name: variance},
+			"correlation": model.JsonMap{name: 1.0},
+		})
+	}
+
+	pairCols := cols[1+n*matrixStatsColumnsPerField:]
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			covariance, correlation := query.value(pairCols[0].Value), query.value(pairCols[1].Value)
+			fields[i]["covariance"].(model.JsonMap)[query.fieldNames[j]] = covariance
+			fields[j]["covariance"].(model.JsonMap)[query.fieldNames[i]] = covariance
+			fields[i]["correlation"].(model.JsonMap)[query.fieldNames[j]] = correlation
+			fields[j]["correlation"].(model.JsonMap)[query.fieldNames[i]] = correlation
+			pairCols = pairCols[matrixStatsColumnsPerPair:]
+		}
+	}
+
+	return model.JsonMap{
+		"doc_count": docCount,
+		"fields":    fields,
+	}
+}
+
+// value returns "NaN" instead of NaN, like Elastic (e.g. variance of 1 value)
+func (query MatrixStats) value(value any) any {
+	if valueAsFloat, ok := value.(float64); value == nil || (ok && math.IsNaN(valueAsFloat)) {
+		return "NaN"
+	}
+	return value
+}
+
+func (query MatrixStats) String() string {
+	return fmt.Sprintf("matrix_stats(fields: %v)", query.fieldNames)
+}
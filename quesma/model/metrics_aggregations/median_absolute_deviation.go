@@ -0,0 +1,34 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"math"
+)
+
+// MedianAbsoluteDeviation is median(|x - median(x)|). Unlike Elastic (TDigest), we compute it exactly.
+type MedianAbsoluteDeviation struct {
+	ctx context.Context
+}
+
+func NewMedianAbsoluteDeviation(ctx context.Context) MedianAbsoluteDeviation {
+	return MedianAbsoluteDeviation{ctx: ctx}
+}
+
+func (query MedianAbsoluteDeviation) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query MedianAbsoluteDeviation) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	response := metricsTranslateSqlResponseToJson(query.ctx, rows)
+	if value, ok := response["value"].(float64); ok && math.IsNaN(value) {
+		response["value"] = nil // no values
+	}
+	return response
+}
+
+func (query MedianAbsoluteDeviation) String() string {
+	return "median_absolute_deviation"
+}
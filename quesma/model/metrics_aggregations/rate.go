@@ -0,0 +1,140 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"time"
+)
+
+// Rate is sum of values (or their count, or doc count) in a parent date_histogram's bucket, converted to a rate per 'unit'.
+// First column is the sum/count. If the bucket's length varies (month-based calendar interval, but e.g. 'day' unit),
+// there's a second column with the smallest timestamp in the bucket, so we know which month it is.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-rate-aggregation.html
+type Rate struct {
+	ctx  context.Context
+	unit string // "" means rate per bucket
+	// set by SetDateHistogramInterval
+	multiplier   float64        // unit length / bucket length, for buckets of fixed length
+	bucketMonths int            // > 0 <=> bucket's length varies, and we need the second column to compute it
+	timezone     *time.Location // only used if bucketMonths > 0
+}
+
+// NewRate returns a rate, which needs SetDateHistogramInterval to be called before it's used.
+func NewRate(ctx context.Context, unit string) *Rate {
+	return &Rate{ctx: ctx, unit: unit, multiplier: 1}
+}
+
+// IsRateUnit returns true if 'unit' is a valid rate unit (e.g. "day", "month")
+func IsRateUnit(unit string) bool {
+	_, isFixed := rateFixedUnits[unit]
+	_, isMonthBased := rateMonthBasedUnits[unit]
+	return isFixed || isMonthBased
+}
+
+var (
+	rateFixedUnits = map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	}
+	rateMonthBasedUnits = map[string]int{
+		"month":   1,
+		"quarter": 3,
+		"year":    12,
+	}
+	rateMonthBasedIntervals = map[string]int{
+		"1M": 1,
+		"1q": 3,
+		"1y": 12,
+	}
+)
+
+// SetDateHistogramInterval sets the parent date_histogram's interval (e.g. "1M" or "30s").
+// It returns needsBucketStart == true, if the second column (min timestamp in the bucket) is needed.
+func (query *Rate) SetDateHistogramInterval(interval string, isCalendar bool, timezone *time.Location) (needsBucketStart bool, err error) {
+	if query.unit == "" {
+		return false, nil
+	}
+
+	unitMonths, unitIsMonthBased := rateMonthBasedUnits[query.unit]
+	if bucketMonths, ok := rateMonthBasedIntervals[interval]; ok && isCalendar {
+		if unitIsMonthBased {
+			query.multiplier = float64(unitMonths) / float64(bucketMonths)
+			return false, nil
+		}
+		query.bucketMonths = bucketMonths
+		query.timezone = timezone
+		if query.timezone == nil {
+			query.timezone = time.UTC
+		}
+		return true, nil
+	}
+
+	if unitIsMonthBased {
+		return false, fmt.Errorf("cannot use month-based rate unit [%s] with non-month based date_histogram interval [%s]", query.unit, interval)
+	}
+	bucketLength, err := util.ParseInterval(interval)
+	if err != nil || bucketLength <= 0 {
+		return false, fmt.Errorf("can't parse date_histogram interval [%s] for rate aggregation: %v", interval, err)
+	}
+	query.multiplier = float64(rateFixedUnits[query.unit]) / float64(bucketLength)
+	return false, nil
+}
+
+func (query *Rate) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query *Rate) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for rate aggregation")
+		return model.JsonMap{"value": nil}
+	}
+	cols := rows[0].Cols
+	valueCol := cols[len(cols)-1]
+	if query.bucketMonths > 0 {
+		if len(cols) < 2 {
+			logger.ErrorWithCtx(query.ctx).Msgf("no bucket start column in rate aggregation response, row: %v", rows[0])
+			return model.JsonMap{"value": nil}
+		}
+		valueCol = cols[len(cols)-2]
+	}
+
+	value, ok := util.ExtractNumeric64Maybe(valueCol.Value)
+	if !ok {
+		if valueCol.Value != nil {
+			logger.ErrorWithCtx(query.ctx).Msgf("unexpected value in rate aggregation: %v (%T)", valueCol.Value, valueCol.Value)
+		}
+		value = 0 // no values in the bucket
+	}
+
+	multiplier := query.multiplier
+	if query.bucketMonths > 0 {
+		bucketStart, ok := cols[len(cols)-1].Value.(time.Time)
+		if !ok {
+			// no documents in the bucket, so rate is 0 anyway
+			return model.JsonMap{"value": 0.0}
+		}
+		multiplier = float64(rateFixedUnits[query.unit]) / float64(query.bucketLength(bucketStart))
+	}
+	return model.JsonMap{"value": value * multiplier}
+}
+
+// bucketLength returns the length of the month-based bucket containing 'timestamp'
+func (query *Rate) bucketLength(timestamp time.Time) time.Duration {
+	timestamp = timestamp.In(query.timezone)
+	month := (int(timestamp.Month())-1)/query.bucketMonths*query.bucketMonths + 1
+	start := time.Date(timestamp.Year(), time.Month(month), 1, 0, 0, 0, 0, query.timezone)
+	return start.AddDate(0, query.bucketMonths, 0).Sub(start)
+}
+
+func (query *Rate) String() string {
+	return fmt.Sprintf("rate(unit: %s)", query.unit)
+}
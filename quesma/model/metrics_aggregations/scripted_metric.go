@@ -0,0 +1,141 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"reflect"
+)
+
+// ScriptedMetricMaxDocs is the maximum number of documents (in a single bucket) we evaluate scripted_metric on.
+// Scripts are run by Quesma, not by ClickHouse, so all used fields of all documents are sent to Quesma.
+const ScriptedMetricMaxDocs = 100_000
+
+// ScriptedMetricScripts are parsed scripts of scripted_metric aggregation, Init is optional (nil if absent)
+type ScriptedMetricScripts struct {
+	Init, Map, Combine, Reduce painful.Expr
+	Params                     map[string]any
+}
+
+// ScriptedMetric is evaluated by the Painless interpreter, over documents returned by ClickHouse.
+// Columns are: doc count, and (if scripts use any doc fields) array of tuples of field values, one tuple per document.
+// We have a single "shard", so reduce script gets a single combined state in `states`.
+type ScriptedMetric struct {
+	ctx        context.Context
+	scripts    ScriptedMetricScripts
+	fieldNames []string
+}
+
+func NewScriptedMetric(ctx context.Context, scripts ScriptedMetricScripts, fieldNames []string) ScriptedMetric {
+	return ScriptedMetric{ctx: ctx, scripts: scripts, fieldNames: fieldNames}
+}
+
+func (query ScriptedMetric) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query ScriptedMetric) columnsNr() int {
+	if len(query.fieldNames) == 0 {
+		return 1
+	}
+	return 2
+}
+
+func (query ScriptedMetric) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	var docs []map[string]any
+	if len(rows) > 0 && len(rows[0].Cols) >= query.columnsNr() {
+		cols := rows[0].Cols[len(rows[0].Cols)-query.columnsNr():]
+		count, _ := util.ExtractInt64Maybe(cols[0].Value)
+		if count > ScriptedMetricMaxDocs {
+			logger.ErrorWithCtx(query.ctx).Msgf("scripted_metric: too many documents (%d), the limit is %d", count, ScriptedMetricMaxDocs)
+			return model.JsonMap{"value": nil}
+		}
+		var err error
+		if docs, err = query.docs(count, cols); err != nil {
+			logger.ErrorWithCtx(query.ctx).Msgf("scripted_metric: %v", err)
+			return model.JsonMap{"value": nil}
+		}
+	} else if len(rows) > 0 {
+		logger.WarnWithCtx(query.ctx).Msgf("not enough columns returned for scripted_metric aggregation, rows: %v", rows)
+	}
+
+	value, err := query.evaluate(docs)
+	if err != nil {
+		logger.ErrorWithCtx(query.ctx).Msgf("scripted_metric: script failed: %v", err)
+		return model.JsonMap{"value": nil}
+	}
+	return model.JsonMap{"value": painful.PlainValue(value)}
+}
+
+// docs returns documents with the fields used by scripts. Values of Nullable columns are dereferenced.
+func (query ScriptedMetric) docs(count int64, cols []model.QueryResultCol) ([]map[string]any, error) {
+	if len(query.fieldNames) == 0 {
+		return make([]map[string]any, count), nil
+	}
+
+	tuples := reflect.ValueOf(cols[1].Value)
+	if tuples.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected array of documents, got %T", cols[1].Value)
+	}
+	docs := make([]map[string]any, 0, tuples.Len())
+	for i := 0; i < tuples.Len(); i++ {
+		tuple := reflect.Indirect(reflect.ValueOf(tuples.Index(i).Interface()))
+		if tuple.Kind() != reflect.Slice || tuple.Len() != len(query.fieldNames) {
+			return nil, fmt.Errorf("expected tuple of %d field values, got %v", len(query.fieldNames), tuples.Index(i).Interface())
+		}
+		doc := make(map[string]any, len(query.fieldNames))
+		for j, fieldName := range query.fieldNames {
+			value := reflect.ValueOf(tuple.Index(j).Interface())
+			for value.Kind() == reflect.Pointer && !value.IsNil() {
+				value = value.Elem()
+			}
+			doc[fieldName] = nil
+			if value.IsValid() && value.Kind() != reflect.Pointer {
+				doc[fieldName] = value.Interface()
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// evaluate runs init and map scripts on a shared state, then combine and reduce, like Elastic does
+func (query ScriptedMetric) evaluate(docs []map[string]any) (any, error) {
+	state := make(map[string]any)
+	if query.scripts.Init != nil {
+		if _, err := query.scripts.Init.Eval(query.env(nil, "state", state)); err != nil {
+			return nil, fmt.Errorf("init_script: %v", err)
+		}
+	}
+	for _, doc := range docs {
+		if _, err := query.scripts.Map.Eval(query.env(doc, "state", state)); err != nil {
+			return nil, fmt.Errorf("map_script: %v", err)
+		}
+	}
+
+	combined, err := query.scripts.Combine.Eval(query.env(nil, "state", state))
+	if err != nil {
+		return nil, fmt.Errorf("combine_script: %v", err)
+	}
+
+	states := []any{combined}
+	reduced, err := query.scripts.Reduce.Eval(query.env(nil, "states", &states))
+	if err != nil {
+		return nil, fmt.Errorf("reduce_script: %v", err)
+	}
+	return reduced, nil
+}
+
+// env is a fresh environment for every script run, so only state is shared between them
+func (query ScriptedMetric) env(doc map[string]any, stateName string, state any) *painful.Env {
+	return &painful.Env{Doc: doc, Params: query.scripts.Params, Variables: map[string]any{stateName: state}}
+}
+
+func (query ScriptedMetric) String() string {
+	return fmt.Sprintf("scripted_metric(fields: %v)", query.fieldNames)
+}
@@ -0,0 +1,39 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestScriptedMetric(t *testing.T) {
+	parse := func(script string) painful.Expr {
+		expr, err := painful.ParsePainless(script)
+		require.NoError(t, err)
+		return expr
+	}
+	scripts := ScriptedMetricScripts{
+		Init:    parse("state.values = []"),
+		Map:     parse("if (!doc['x'].empty) { state.values.add(doc['x'].value) }"),
+		Combine: parse("return state.values"),
+		Reduce:  parse("def all = []; for (s in states) { all.addAll(s) } Collections.sort(all); return all"),
+	}
+	query := NewScriptedMetric(context.Background(), scripts, []string{"x"})
+
+	x := int64(3)
+	rows := func(count int64) []model.QueryResultRow {
+		return []model.QueryResultRow{{Cols: []model.QueryResultCol{
+			model.NewQueryResultCol("metric__a_col_0", count),
+			model.NewQueryResultCol("metric__a_col_1", []any{[]any{&x}, []any{(*int64)(nil)}, []any{int64(1)}}),
+		}}}
+	}
+
+	assert.Equal(t, model.JsonMap{"value": []any{int64(1), int64(3)}}, query.TranslateSqlResponseToJson(rows(3)))
+	assert.Equal(t, model.JsonMap{"value": nil}, query.TranslateSqlResponseToJson(rows(ScriptedMetricMaxDocs+1)))
+	assert.Equal(t, model.JsonMap{"value": []any{}}, query.TranslateSqlResponseToJson(nil))
+}
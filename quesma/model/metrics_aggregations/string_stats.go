@@ -0,0 +1,111 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+	"reflect"
+)
+
+// StringStats columns are: count, min length, max length, avg length, and character counts as (keys, values) tuple.
+// Entropy (and distribution, if requested) are computed from character counts.
+type StringStats struct {
+	ctx              context.Context
+	showDistribution bool
+}
+
+func NewStringStats(ctx context.Context, showDistribution bool) StringStats {
+	return StringStats{ctx: ctx, showDistribution: showDistribution}
+}
+
+const stringStatsColumnsNr = 5
+
+func (query StringStats) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query StringStats) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < stringStatsColumnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("no rows or not enough columns returned for string_stats aggregation, rows: %v", rows)
+		return query.emptyResult()
+	}
+	cols := rows[0].Cols[len(rows[0].Cols)-stringStatsColumnsNr:]
+	if count, ok := util.ExtractInt64Maybe(cols[0].Value); !ok || count == 0 {
+		return query.emptyResult()
+	}
+
+	charCounts, err := query.parseCharCounts(cols[4].Value)
+	if err != nil {
+		logger.ErrorWithCtx(query.ctx).Msgf("error parsing string_stats character counts: %v", err)
+	}
+	var allChars int64
+	for _, count := range charCounts {
+		allChars += count
+	}
+	entropy := 0.0
+	distribution := make(model.JsonMap, len(charCounts))
+	for char, count := range charCounts {
+		probability := float64(count) / float64(allChars)
+		entropy -= probability * math.Log2(probability)
+		distribution[char] = probability
+	}
+
+	result := model.JsonMap{
+		"count":      cols[0].Value,
+		"min_length": cols[1].Value,
+		"max_length": cols[2].Value,
+		"avg_length": cols[3].Value,
+		"entropy":    entropy,
+	}
+	if query.showDistribution {
+		result["distribution"] = distribution
+	}
+	return result
+}
+
+func (query StringStats) String() string {
+	return fmt.Sprintf("string_stats(show_distribution: %v)", query.showDistribution)
+}
+
+func (query StringStats) emptyResult() model.JsonMap {
+	result := model.JsonMap{
+		"count":      0,
+		"min_length": nil,
+		"max_length": nil,
+		"avg_length": nil,
+		"entropy":    0.0,
+	}
+	if query.showDistribution {
+		result["distribution"] = model.JsonMap{}
+	}
+	return result
+}
+
+// parseCharCounts parses sumMap's result: ([chars], [counts])
+func (query StringStats) parseCharCounts(value any) (map[string]int64, error) {
+	tuple := reflect.ValueOf(value)
+	if tuple.Kind() != reflect.Slice || tuple.Len() != 2 {
+		return nil, fmt.Errorf("expected (keys, values) tuple, got %T, value: %v", value, value)
+	}
+	keys, values := reflect.ValueOf(tuple.Index(0).Interface()), reflect.ValueOf(tuple.Index(1).Interface())
+	if keys.Kind() != reflect.Slice || values.Kind() != reflect.Slice || keys.Len() != values.Len() {
+		return nil, fmt.Errorf("expected keys and values arrays of the same length, got %v", value)
+	}
+	charCounts := make(map[string]int64, keys.Len())
+	for i := 0; i < keys.Len(); i++ {
+		char, okKey := keys.Index(i).Interface().(string)
+		count, okValue := util.ExtractInt64Maybe(values.Index(i).Interface())
+		if !okKey || !okValue {
+			return charCounts, fmt.Errorf("invalid character count: %v: %v", keys.Index(i).Interface(), values.Index(i).Interface())
+		}
+		if count > 0 {
+			charCounts[char] = count
+		}
+	}
+	return charCounts, nil
+}
@@ -0,0 +1,152 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+)
+
+type TTestType string
+
+const (
+	TTestPaired          TTestType = "paired"
+	TTestHomoscedastic   TTestType = "homoscedastic"
+	TTestHeteroscedastic TTestType = "heteroscedastic"
+)
+
+// TTest returns p-value of Student's t-test.
+// We don't use Clickhouse's studentTTest/welchTTest, as one document can belong to both samples (with different fields,
+// or overlapping filters), and there's no paired test there. Instead, we select (count, avg, varSamp) for every sample
+// (for paired test: one sample of differences a - b), and compute the p-value here.
+type TTest struct {
+	ctx      context.Context
+	testType TTestType
+	tails    int
+}
+
+func NewTTest(ctx context.Context, testType TTestType, tails int) TTest {
+	return TTest{ctx: ctx, testType: testType, tails: tails}
+}
+
+func (query TTest) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+// columnsNr returns the number of columns selected for this test
+func (query TTest) columnsNr() int {
+	if query.testType == TTestPaired {
+		return 3
+	}
+	return 6
+}
+
+func (query TTest) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < query.columnsNr() {
+		logger.WarnWithCtx(query.ctx).Msgf("no rows or not enough columns returned for t_test aggregation, rows: %v", rows)
+		return model.JsonMap{"value": nil}
+	}
+
+	cols := rows[0].Cols[len(rows[0].Cols)-query.columnsNr():]
+	values := make([]float64, len(cols))
+	for i, col := range cols {
+		var ok bool
+		if values[i], ok = util.ExtractNumeric64Maybe(col.Value); !ok {
+			return model.JsonMap{"value": nil} // e.g. no values in a sample
+		}
+	}
+
+	var t, degreesOfFreedom float64
+	switch query.testType {
+	case TTestPaired:
+		count, avg, variance := values[0], values[1], values[2]
+		t = avg / math.Sqrt(variance/count)
+		degreesOfFreedom = count - 1
+	case TTestHomoscedastic:
+		countA, avgA, varianceA, countB, avgB, varianceB := values[0], values[1], values[2], values[3], values[4], values[5]
+		degreesOfFreedom = countA + countB - 2
+		pooledVariance := ((countA-1)*varianceA + (countB-1)*varianceB) / degreesOfFreedom
+		t = (avgA - avgB) / math.Sqrt(pooledVariance*(1/countA+1/countB))
+	case TTestHeteroscedastic:
+		countA, avgA, varianceA, countB, avgB, varianceB := values[0], values[1], values[2], values[3], values[4], values[5]
+		standardErrorA, standardErrorB := varianceA/countA, varianceB/countB
+		t = (avgA - avgB) / math.Sqrt(standardErrorA+standardErrorB)
+		degreesOfFreedom = math.Pow(standardErrorA+standardErrorB, 2) /
+			(standardErrorA*standardErrorA/(countA-1) + standardErrorB*standardErrorB/(countB-1))
+	}
+
+	pValue := float64(query.tails) * studentTCumulativeProbability(-math.Abs(t), degreesOfFreedom)
+	if math.IsNaN(pValue) || math.IsInf(pValue, 0) {
+		return model.JsonMap{"value": nil}
+	}
+	return model.JsonMap{"value": pValue}
+}
+
+func (query TTest) String() string {
+	return fmt.Sprintf("t_test(type: %s, tails: %d)", query.testType, query.tails)
+}
+
+// studentTCumulativeProbability returns P(T <= t) for Student's t-distribution, t <= 0.
+func studentTCumulativeProbability(t, degreesOfFreedom float64) float64 {
+	if math.IsNaN(t) || degreesOfFreedom <= 0 {
+		return math.NaN()
+	}
+	return 0.5 * regularizedIncompleteBeta(degreesOfFreedom/(degreesOfFreedom+t*t), degreesOfFreedom/2, 0.5)
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), computed with continued fractions (Numerical Recipes, 6.4)
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	case x > (a+1)/(a+b+2):
+		// continued fraction converges quickly only for x < (a+1)/(a+b+2)
+		return 1 - regularizedIncompleteBeta(1-x, b, a)
+	}
+
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB-lgammaA-lgammaB+a*math.Log(x)+b*math.Log(1-x)) / a
+
+	// modified Lentz's method
+	const (
+		maxIterations = 300
+		epsilon       = 1e-15
+		tiny          = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1; m <= maxIterations; m++ {
+		mf := float64(m)
+		for _, numerator := range []float64{
+			mf * (b - mf) * x / ((a + 2*mf - 1) * (a + 2*mf)),
+			-(a + mf) * (a + b + mf) * x / ((a + 2*mf) * (a + 2*mf + 1)),
+		} {
+			d = 1 + numerator*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + numerator/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			result *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return front * result
+}
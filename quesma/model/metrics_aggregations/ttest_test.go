@@ -0,0 +1,65 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func Test_studentTCumulativeProbability(t *testing.T) {
+	// closed forms: df=1 is Cauchy distribution, and for df=2: CDF(t) = 1/2 + t / (2 * sqrt(2 + t^2))
+	tests := []struct {
+		t, degreesOfFreedom, expected float64
+	}{
+		{0, 1, 0.5},
+		{-1, 1, 0.5 - math.Atan(1)/math.Pi},
+		{-10, 1, 0.5 - math.Atan(10)/math.Pi},
+		{-2, 2, 0.5 - 2/(2*math.Sqrt(6))},
+		{-0.5, 2, 0.5 - 0.5/(2*math.Sqrt(2.25))},
+		{-1.959963984540054, 1e7, 0.025}, // ~normal distribution
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.InDelta(t, tt.expected, studentTCumulativeProbability(tt.t, tt.degreesOfFreedom), 1e-6)
+		})
+	}
+}
+
+func TestTTest_TranslateSqlResponseToJson(t *testing.T) {
+	row := func(values ...any) []model.QueryResultRow {
+		cols := make([]model.QueryResultCol, 0, len(values))
+		for i, value := range values {
+			cols = append(cols, model.NewQueryResultCol("metric__t_col_"+strconv.Itoa(i), value))
+		}
+		return []model.QueryResultRow{{Cols: cols}}
+	}
+	pValueT2DF2 := 2 * (0.5 - 2/(2*math.Sqrt(6))) // two-tailed p-value for t=2, df=2
+	tests := []struct {
+		name     string
+		tTest    TTest
+		rows     []model.QueryResultRow
+		expected any
+	}{
+		{"paired", NewTTest(context.Background(), TTestPaired, 2), row(uint64(3), 2.0, 3.0), pValueT2DF2},
+		{"paired, 1 tail", NewTTest(context.Background(), TTestPaired, 1), row(uint64(3), -2.0, 3.0), pValueT2DF2 / 2},
+		{"homoscedastic", NewTTest(context.Background(), TTestHomoscedastic, 2), row(uint64(2), 3.0, 1.0, uint64(2), 1.0, 1.0), pValueT2DF2},
+		{"heteroscedastic", NewTTest(context.Background(), TTestHeteroscedastic, 2), row(uint64(2), 3.0, 1.0, uint64(2), 1.0, 1.0), pValueT2DF2},
+		{"no values", NewTTest(context.Background(), TTestPaired, 2), row(uint64(0), nil, nil), nil},
+		{"one value", NewTTest(context.Background(), TTestPaired, 2), row(uint64(1), 1.0, math.NaN()), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.tTest.TranslateSqlResponseToJson(tt.rows)["value"]
+			if tt.expected == nil {
+				assert.Nil(t, value)
+			} else {
+				assert.InDelta(t, tt.expected, value, 1e-9)
+			}
+		})
+	}
+}
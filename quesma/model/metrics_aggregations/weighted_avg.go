@@ -0,0 +1,28 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+type WeightedAvg struct {
+	ctx context.Context
+}
+
+func NewWeightedAvg(ctx context.Context) WeightedAvg {
+	return WeightedAvg{ctx: ctx}
+}
+
+func (query WeightedAvg) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query WeightedAvg) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return metricsTranslateSqlResponseToJson(query.ctx, rows)
+}
+
+func (query WeightedAvg) String() string {
+	return "weighted_avg"
+}
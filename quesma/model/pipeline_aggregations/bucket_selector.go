@@ -0,0 +1,84 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+)
+
+// BucketSelector is a parent pipeline aggregation which keeps only those buckets of a parent multi-bucket aggregation,
+// for which a (Painless) script returns true. Script sees values pointed by `buckets_path` as `params`.
+// It doesn't compute anything itself, it only prunes already rendered buckets (see TransformBuckets).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-bucket-selector-aggregation.html
+type BucketSelector struct {
+	*PipelineAggregation
+	bucketsPaths map[string]string // script variable -> path
+	script       painful.Expr
+	params       map[string]any
+}
+
+func NewBucketSelector(ctx context.Context, bucketsPaths map[string]string, script painful.Expr, params map[string]any) BucketSelector {
+	return BucketSelector{PipelineAggregation: newPipelineAggregation(ctx, BucketsPathCount),
+		bucketsPaths: bucketsPaths, script: script, params: params}
+}
+
+func (query BucketSelector) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query BucketSelector) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query BucketSelector) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return parentRows
+}
+
+// TransformBuckets returns buckets for which the script returns true
+func (query BucketSelector) TransformBuckets(buckets []model.JsonMap) []model.JsonMap {
+	result := make([]model.JsonMap, 0, len(buckets))
+	for _, bucket := range buckets {
+		params := make(map[string]any, len(query.params)+len(query.bucketsPaths))
+		for name, value := range query.params {
+			params[name] = value
+		}
+		for name, path := range query.bucketsPaths {
+			value, ok := util.ExtractNumeric64Maybe(resolveBucketsPath(bucket, path))
+			if !ok {
+				value = math.NaN()
+			}
+			params[name] = value
+		}
+
+		selected, err := query.script.Eval(&painful.Env{Params: params})
+		if err != nil {
+			logger.WarnWithCtx(query.ctx).Msgf("could not evaluate bucket_selector script: %v. Keeping the bucket.", err)
+			result = append(result, bucket)
+			continue
+		}
+		selectedBool, ok := selected.(bool)
+		if !ok {
+			logger.WarnWithCtx(query.ctx).Msgf("bucket_selector script returned non-boolean value: %v, type: %T. Keeping the bucket.", selected, selected)
+			result = append(result, bucket)
+			continue
+		}
+		if selectedBool {
+			result = append(result, bucket)
+		}
+	}
+	return result
+}
+
+func (query BucketSelector) String() string {
+	return fmt.Sprintf("bucket_selector(bucketsPaths: %v)", query.bucketsPaths)
+}
+
+func (query BucketSelector) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
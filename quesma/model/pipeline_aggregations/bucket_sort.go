@@ -0,0 +1,117 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+	"slices"
+	"strings"
+)
+
+// BucketSort is a parent pipeline aggregation which sorts and/or truncates buckets of a parent multi-bucket aggregation.
+// It doesn't compute anything itself, it only reorders already rendered buckets (see TransformBuckets).
+// Like in Elastic (`skip` gap policy), buckets without a value for any of the sort fields are removed.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-bucket-sort-aggregation.html
+type BucketSort struct {
+	*PipelineAggregation
+	sort []BucketSortField
+	from int
+	size int
+}
+
+type BucketSortField struct {
+	BucketsPath string
+	Desc        bool
+}
+
+const BucketSortNoSize = 0 // return all buckets
+
+func NewBucketSort(ctx context.Context, sort []BucketSortField, from, size int) BucketSort {
+	return BucketSort{PipelineAggregation: newPipelineAggregation(ctx, BucketsPathCount), sort: sort, from: from, size: size}
+}
+
+func (query BucketSort) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query BucketSort) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query BucketSort) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return parentRows
+}
+
+// TransformBuckets returns sorted buckets[from:from+size]
+func (query BucketSort) TransformBuckets(buckets []model.JsonMap) []model.JsonMap {
+	type sortableBucket struct {
+		bucket     model.JsonMap
+		sortValues []any
+	}
+
+	sortable := make([]sortableBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		sortValues := make([]any, 0, len(query.sort))
+		for _, field := range query.sort {
+			value := resolveBucketsPath(bucket, field.BucketsPath)
+			if valueFloat, ok := value.(float64); value == nil || (ok && math.IsNaN(valueFloat)) {
+				break
+			}
+			sortValues = append(sortValues, value)
+		}
+		if len(sortValues) == len(query.sort) {
+			sortable = append(sortable, sortableBucket{bucket: bucket, sortValues: sortValues})
+		}
+	}
+
+	slices.SortStableFunc(sortable, func(a, b sortableBucket) int {
+		for i, field := range query.sort {
+			cmp := compareSortValues(a.sortValues[i], b.sortValues[i])
+			if field.Desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	})
+
+	from := min(query.from, len(sortable))
+	to := len(sortable)
+	if query.size != BucketSortNoSize {
+		to = min(from+query.size, len(sortable))
+	}
+	result := make([]model.JsonMap, 0, to-from)
+	for _, bucket := range sortable[from:to] {
+		result = append(result, bucket.bucket)
+	}
+	return result
+}
+
+func compareSortValues(a, b any) int {
+	aFloat, aIsNumber := util.ExtractNumeric64Maybe(a)
+	bFloat, bIsNumber := util.ExtractNumeric64Maybe(b)
+	if aIsNumber && bIsNumber {
+		switch {
+		case aFloat < bFloat:
+			return -1
+		case aFloat > bFloat:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func (query BucketSort) String() string {
+	return fmt.Sprintf("bucket_sort(sort: %v, from: %d, size: %d)", query.sort, query.from, query.size)
+}
+
+func (query BucketSort) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
@@ -4,9 +4,12 @@ package pipeline_aggregations
 
 import (
 	"context"
+	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+	"strings"
 )
 
 // translateSqlResponseToJsonCommon translates rows from DB (maybe postprocessed later), into JSON's format in which
@@ -102,3 +105,104 @@ func calculateResultWhenMissingCommonForDiffAggregations(ctx context.Context, pa
 	}
 	return resultRows
 }
+
+// bucketValues returns numeric values of the last column of rows, skipping missing ones (Elastic's default `skip` gap policy)
+func bucketValues(rows []model.QueryResultRow) []float64 {
+	values := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		if value, ok := util.ExtractNumeric64Maybe(row.LastColValue()); ok && !math.IsNaN(value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// nanToNil returns nil for NaN and infinities, which Elastic renders as null (and which we can't marshal to JSON)
+func nanToNil(value float64) any {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return value
+}
+
+// resolveBucketsPath returns the value `bucketsPath` points to in an already rendered bucket, e.g.
+// `_count`, `_key`, `the_sum`, `the_stats.avg`, `the_percentiles[99.0]`, `filter_agg>the_sum`, `filters_agg['a']>_count`.
+// Returns nil if there's no such value.
+func resolveBucketsPath(bucket model.JsonMap, bucketsPath string) any {
+	const aggregationDelimiter = ">"
+	current := bucket
+	parts := strings.Split(bucketsPath, aggregationDelimiter)
+	for _, part := range parts[:len(parts)-1] {
+		name, bucketKey, hasBucketKey := splitBucketsPathPart(part)
+		next, ok := current[name].(model.JsonMap)
+		if !ok {
+			return nil
+		}
+		if hasBucketKey {
+			if next, ok = findBucketByKey(next, bucketKey); !ok {
+				return nil
+			}
+		}
+		current = next
+	}
+
+	last := parts[len(parts)-1]
+	switch last {
+	case BucketsPathCount:
+		return current["doc_count"]
+	case "_key":
+		return current["key"]
+	}
+
+	name, metric, hasMetric := splitBucketsPathPart(last)
+	if !hasMetric {
+		if dotIdx := strings.LastIndex(last, "."); dotIdx != -1 {
+			name, metric, hasMetric = last[:dotIdx], last[dotIdx+1:], true
+		}
+	}
+	if !hasMetric {
+		metric = "value"
+	}
+	metricResult, ok := current[name].(model.JsonMap)
+	if !ok {
+		return nil
+	}
+	if value, exists := metricResult[metric]; exists {
+		return value
+	}
+	if values, ok := metricResult["values"].(model.JsonMap); ok { // e.g. percentiles
+		if value, exists := values[metric]; exists {
+			return value
+		}
+		return values[metric+".0"]
+	}
+	return nil
+}
+
+// splitBucketsPathPart splits `name[key]` (or `name['key']`) into name and key
+func splitBucketsPathPart(part string) (name, key string, hasKey bool) {
+	openIdx := strings.Index(part, "[")
+	if openIdx == -1 || !strings.HasSuffix(part, "]") {
+		return part, "", false
+	}
+	key = strings.Trim(part[openIdx+1:len(part)-1], `'"`)
+	return part[:openIdx], key, true
+}
+
+func findBucketByKey(aggregationResult model.JsonMap, key string) (model.JsonMap, bool) {
+	switch buckets := aggregationResult["buckets"].(type) {
+	case model.JsonMap: // keyed, e.g. filters
+		bucket, ok := buckets[key].(model.JsonMap)
+		return bucket, ok
+	case []model.JsonMap:
+		for _, bucket := range buckets {
+			if keyAsString, ok := bucket["key_as_string"]; ok && fmt.Sprint(keyAsString) == key {
+				return bucket, true
+			}
+			if fmt.Sprint(bucket["key"]) == key {
+				return bucket, true
+			}
+		}
+	}
+	return nil, false
+}
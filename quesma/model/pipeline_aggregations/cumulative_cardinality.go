@@ -0,0 +1,60 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"reflect"
+)
+
+// CumulativeCardinality is a parent pipeline aggregation which calculates the cumulative cardinality
+// of a cardinality metric in a parent (date_)histogram, e.g. total number of new users seen so far.
+// Its parent cardinality aggregation returns distinct values (not only their number) in each bucket, so we can union them.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-cumulative-cardinality-aggregation.html
+type CumulativeCardinality struct {
+	*PipelineAggregation
+}
+
+func NewCumulativeCardinality(ctx context.Context, bucketsPath string) CumulativeCardinality {
+	return CumulativeCardinality{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath)}
+}
+
+func (query CumulativeCardinality) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query CumulativeCardinality) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+}
+
+func (query CumulativeCardinality) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	resultRows := make([]model.QueryResultRow, 0, len(parentRows))
+	seen := make(map[any]struct{})
+	for _, parentRow := range parentRows {
+		if valuesRaw := parentRow.LastColValue(); valuesRaw != nil {
+			values := reflect.ValueOf(valuesRaw)
+			if values.Kind() == reflect.Slice {
+				for i := 0; i < values.Len(); i++ {
+					seen[values.Index(i).Interface()] = struct{}{}
+				}
+			} else {
+				logger.WarnWithCtx(query.ctx).Msgf("cardinality values are not an array: %v, type: %T. Skipping", valuesRaw, valuesRaw)
+			}
+		}
+		resultRow := parentRow.Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = int64(len(seen))
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query CumulativeCardinality) String() string {
+	return fmt.Sprintf("cumulative_cardinality(%s)", query.Parent)
+}
+
+func (query CumulativeCardinality) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
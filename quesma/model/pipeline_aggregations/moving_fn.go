@@ -0,0 +1,80 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+)
+
+// MovingFn is a parent pipeline aggregation which slides a window across the buckets of a parent (date_)histogram,
+// and for every bucket evaluates a script on the values of a specified metric in the window.
+// Script is a Painless one, usually a call to one of the `MovingFunctions` helpers.
+// Like in Elastic, buckets with a missing value are skipped: they don't get a result and don't count into windows.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-movfn-aggregation.html
+type MovingFn struct {
+	*PipelineAggregation
+	script painful.Expr
+	params map[string]any
+	window int
+	shift  int
+}
+
+func NewMovingFn(ctx context.Context, bucketsPath string, script painful.Expr, params map[string]any, window, shift int) MovingFn {
+	return MovingFn{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), script: script, params: params, window: window, shift: shift}
+}
+
+func (query MovingFn) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query MovingFn) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+}
+
+func (query MovingFn) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	resultRows := make([]model.QueryResultRow, 0, len(parentRows))
+	values := bucketValues(parentRows)
+
+	valueIdx := 0
+	for _, parentRow := range parentRows {
+		resultRow := parentRow.Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = nil
+		if value, ok := util.ExtractNumeric64Maybe(parentRow.LastColValue()); ok && !math.IsNaN(value) {
+			from := min(max(valueIdx-query.window+query.shift, 0), len(values))
+			to := min(max(valueIdx+query.shift, 0), len(values))
+			resultRow.Cols[len(resultRow.Cols)-1].Value = query.evalScript(values[from:to])
+			valueIdx++
+		}
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query MovingFn) evalScript(window []float64) any {
+	env := &painful.Env{Params: query.params, Variables: map[string]any{"values": window}}
+	result, err := query.script.Eval(env)
+	if err != nil {
+		logger.WarnWithCtx(query.ctx).Msgf("could not evaluate moving_fn script: %v. Returning nil.", err)
+		return nil
+	}
+	resultFloat, ok := util.ExtractNumeric64Maybe(result)
+	if !ok {
+		logger.WarnWithCtx(query.ctx).Msgf("moving_fn script returned non-numeric value: %v, type: %T. Returning nil.", result, result)
+		return nil
+	}
+	return nanToNil(resultFloat)
+}
+
+func (query MovingFn) String() string {
+	return fmt.Sprintf("moving_fn(%s, window: %d, shift: %d)", query.Parent, query.window, query.shift)
+}
+
+func (query MovingFn) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
@@ -0,0 +1,85 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+)
+
+// Normalize is a parent pipeline aggregation which calculates the normalized value of a specified metric
+// for every bucket of a parent multi-bucket aggregation.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-normalize-aggregation.html
+type Normalize struct {
+	*PipelineAggregation
+	method string
+}
+
+// NormalizeMethods are all methods supported by Elastic
+var NormalizeMethods = []string{"rescale_0_1", "rescale_0_100", "percent_of_sum", "mean", "z-score", "softmax"}
+
+func NewNormalize(ctx context.Context, bucketsPath, method string) Normalize {
+	return Normalize{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), method: method}
+}
+
+func (query Normalize) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query Normalize) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+}
+
+func (query Normalize) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	values := bucketValues(parentRows)
+	minValue, maxValue, sum, expSum := math.Inf(1), math.Inf(-1), 0.0, 0.0
+	for _, value := range values {
+		minValue = min(minValue, value)
+		maxValue = max(maxValue, value)
+		sum += value
+		expSum += math.Exp(value)
+	}
+	mean := sum / float64(len(values))
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(values)))
+
+	resultRows := make([]model.QueryResultRow, 0, len(parentRows))
+	for _, parentRow := range parentRows {
+		resultRow := parentRow.Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = nil
+		if value, ok := util.ExtractNumeric64Maybe(parentRow.LastColValue()); ok && !math.IsNaN(value) {
+			var normalized float64
+			switch query.method {
+			case "rescale_0_1":
+				normalized = (value - minValue) / (maxValue - minValue)
+			case "rescale_0_100":
+				normalized = 100 * (value - minValue) / (maxValue - minValue)
+			case "percent_of_sum":
+				normalized = value / sum
+			case "mean":
+				normalized = (value - mean) / (maxValue - minValue)
+			case "z-score":
+				normalized = (value - mean) / stdDev
+			case "softmax":
+				normalized = math.Exp(value) / expSum
+			}
+			resultRow.Cols[len(resultRow.Cols)-1].Value = nanToNil(normalized)
+		}
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query Normalize) String() string {
+	return fmt.Sprintf("normalize(%s, method: %s)", query.Parent, query.method)
+}
+
+func (query Normalize) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
@@ -0,0 +1,100 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PercentilesBucket is a sibling pipeline aggregation which calculates percentiles of a specified metric
+// across all buckets of a sibling multi-bucket aggregation.
+// Like in Elastic, percentiles are exact (nearest rank), not interpolated.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-percentiles-bucket-aggregation.html
+type PercentilesBucket struct {
+	*PipelineAggregation
+	percents []float64
+	keyed    bool
+}
+
+var PercentilesBucketDefaultPercents = []float64{1, 5, 25, 50, 75, 95, 99}
+
+func NewPercentilesBucket(ctx context.Context, bucketsPath string, percents []float64, keyed bool) PercentilesBucket {
+	return PercentilesBucket{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), percents: percents, keyed: keyed}
+}
+
+func (query PercentilesBucket) AggregationType() model.AggregationType {
+	return model.PipelineMetricsAggregation
+}
+
+func (query PercentilesBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		return query.calculatePercentiles(nil)
+	}
+	if len(rows) > 1 {
+		logger.WarnWithCtx(query.ctx).Msg("more than one row returned for percentiles bucket aggregation")
+	}
+	if returnMap, ok := rows[0].LastColValue().(model.JsonMap); ok {
+		return returnMap
+	}
+	logger.WarnWithCtx(query.ctx).Msgf("could not convert value to JsonMap: %v, type: %T", rows[0].LastColValue(), rows[0].LastColValue())
+	return model.JsonMap{}
+}
+
+func (query PercentilesBucket) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	resultRows := make([]model.QueryResultRow, 0)
+	if len(parentRows) == 0 {
+		return resultRows
+	}
+	parentFieldsCnt := len(parentRows[0].Cols) - 2 // -2, because row is [parent_cols..., current_key, current_value]
+	// we calculate percentiles of all current_keys with the same parent_cols, so we need to split into buckets based on parent_cols
+	for _, parentRowsOneBucket := range model.SplitResultSetIntoBuckets(parentRows, parentFieldsCnt) {
+		resultRow := parentRowsOneBucket[0].Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = query.calculatePercentiles(bucketValues(parentRowsOneBucket))
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query PercentilesBucket) calculatePercentiles(values []float64) model.JsonMap {
+	slices.Sort(values)
+
+	keyedValues := make(model.JsonMap, len(query.percents))
+	valuesArr := make([]model.JsonMap, 0, len(query.percents))
+	for _, percent := range query.percents {
+		value := math.NaN()
+		if len(values) > 0 {
+			value = values[int(math.Round(percent/100*float64(len(values)-1)))]
+		}
+		keyedValues[query.percentName(percent)] = nanToNil(value)
+		valuesArr = append(valuesArr, model.JsonMap{"key": percent, "value": nanToNil(value)})
+	}
+
+	if query.keyed {
+		return model.JsonMap{"values": keyedValues}
+	}
+	return model.JsonMap{"values": valuesArr}
+}
+
+// percentName returns the percent the way Elastic (Java's Double.toString) prints it, e.g. 50 -> "50.0"
+func (query PercentilesBucket) percentName(percent float64) string {
+	name := strconv.FormatFloat(percent, 'f', -1, 64)
+	if !strings.Contains(name, ".") {
+		name += ".0"
+	}
+	return name
+}
+
+func (query PercentilesBucket) String() string {
+	return fmt.Sprintf("percentiles_bucket(%s, percents: %v)", query.Parent, query.percents)
+}
+
+func (query PercentilesBucket) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineSiblingAggregation
+}
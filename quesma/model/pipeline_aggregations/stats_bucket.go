@@ -0,0 +1,82 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"math"
+)
+
+// StatsBucket is a sibling pipeline aggregation which calculates count, min, max, avg and sum of a specified metric
+// across all buckets of a sibling multi-bucket aggregation.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-stats-bucket-aggregation.html
+type StatsBucket struct {
+	*PipelineAggregation
+}
+
+func NewStatsBucket(ctx context.Context, bucketsPath string) StatsBucket {
+	return StatsBucket{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath)}
+}
+
+func (query StatsBucket) AggregationType() model.AggregationType {
+	return model.PipelineMetricsAggregation
+}
+
+func (query StatsBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		return query.calculateStats(nil)
+	}
+	if len(rows) > 1 {
+		logger.WarnWithCtx(query.ctx).Msg("more than one row returned for stats bucket aggregation")
+	}
+	if returnMap, ok := rows[0].LastColValue().(model.JsonMap); ok {
+		return returnMap
+	}
+	logger.WarnWithCtx(query.ctx).Msgf("could not convert value to JsonMap: %v, type: %T", rows[0].LastColValue(), rows[0].LastColValue())
+	return model.JsonMap{}
+}
+
+func (query StatsBucket) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	resultRows := make([]model.QueryResultRow, 0)
+	if len(parentRows) == 0 {
+		return resultRows
+	}
+	parentFieldsCnt := len(parentRows[0].Cols) - 2 // -2, because row is [parent_cols..., current_key, current_value]
+	// we calculate stats of all current_keys with the same parent_cols, so we need to split into buckets based on parent_cols
+	for _, parentRowsOneBucket := range model.SplitResultSetIntoBuckets(parentRows, parentFieldsCnt) {
+		resultRow := parentRowsOneBucket[0].Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = query.calculateStats(bucketValues(parentRowsOneBucket))
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query StatsBucket) calculateStats(values []float64) model.JsonMap {
+	if len(values) == 0 {
+		return model.JsonMap{"count": 0, "min": nil, "max": nil, "avg": nil, "sum": 0.0}
+	}
+	sum, minValue, maxValue := 0.0, math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		sum += value
+		minValue = min(minValue, value)
+		maxValue = max(maxValue, value)
+	}
+	return model.JsonMap{
+		"count": len(values),
+		"min":   minValue,
+		"max":   maxValue,
+		"avg":   sum / float64(len(values)),
+		"sum":   sum,
+	}
+}
+
+func (query StatsBucket) String() string {
+	return fmt.Sprintf("stats_bucket(%s)", query.Parent)
+}
+
+func (query StatsBucket) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineSiblingAggregation
+}
@@ -25,8 +25,8 @@ func (query SumBucket) AggregationType() model.AggregationType {
 
 func (query SumBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
 	if len(rows) == 0 {
-		logger.WarnWithCtx(query.ctx).Msg("no rows returned for average bucket aggregation")
-		return model.JsonMap{}
+		// no buckets (e.g. nothing matched the query), Elastic returns 0, the sum of an empty set
+		return model.JsonMap{"value": 0.0}
 	}
 	if len(rows) > 1 {
 		logger.WarnWithCtx(query.ctx).Msg("more than one row returned for average bucket aggregation")
@@ -87,6 +87,11 @@ type (
 
 var SearchAfterEmpty any = nil
 
+// SearchAfterInclusive is search_after which also matches hits with exactly the given sort values.
+// It's not a part of Elastic's API: scroll and point in time use it for keyset pagination,
+// skipping hits with the same sort values they've already returned.
+type SearchAfterInclusive []any
+
 // RuntimeMapping is a mapping of a field to a runtime expression
 type RuntimeMapping struct {
 	Field                 string
@@ -0,0 +1,165 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package model
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strings"
+)
+
+// Relevance scoring (_score) is computed in SQL, only when enabled in the index configuration.
+//
+// It's BM25-like: every matched term contributes its saturated term frequency tf*(k1+1)/(tf+k1).
+// We don't have index statistics, so there's no IDF and no length normalization.
+// Queries which don't match full-text (term, range, etc.) have a constant score of 1.
+
+const ScoreFieldName = "_score"
+
+const scoreK1 = 1.2 // BM25 term frequency saturation
+
+// ScoreTerm is the right side of ScoreOperator: `column __quesma_score ScoreTerm`, the score of one term of a full-text query.
+// It's translated to SQL by the schema transformation, as it depends on the field type.
+type ScoreTerm struct {
+	Term string
+}
+
+func NewScoreTermExpr(column Expr, term string) Expr {
+	return NewInfixExpr(column, ScoreOperator, NewLiteral(ScoreTerm{Term: term}))
+}
+
+func (t ScoreTerm) String() string {
+	return util.SingleQuote(t.Term)
+}
+
+// ToSQL returns the saturated frequency of the term in the (string) column, case-insensitive
+func (t ScoreTerm) ToSQL(column Expr) Expr {
+	tf := NewFunction("ifNull", NewFunction("countSubstringsCaseInsensitive", column, NewLiteral(util.SingleQuote(t.Term))), NewLiteral(0))
+	return NewFunction("divide", NewFunction("multiply", tf, NewLiteral(scoreK1+1)), NewFunction("plus", tf, NewLiteral(scoreK1)))
+}
+
+// NewBoostExpr marks a part of WHERE clause as boosted (e.g. `title:abc^2` in Lucene).
+// MatchScore takes it into account, and RemoveBoosts has to be called before the WHERE clause is used.
+func NewBoostExpr(expr Expr, boost float64) Expr {
+	return NewFunction(BoostFunction, expr, NewLiteral(boost))
+}
+
+// RemoveBoosts removes all NewBoostExpr markers
+func RemoveBoosts(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	visitor := NewBaseVisitor()
+	visitor.OverrideVisitFunction = func(b *BaseExprVisitor, e FunctionExpr) interface{} {
+		if e.Name == BoostFunction && len(e.Args) == 2 {
+			return e.Args[0].Accept(b)
+		}
+		return NewFunction(e.Name, b.VisitChildren(e.Args)...)
+	}
+	return expr.Accept(visitor).(Expr)
+}
+
+// MatchScore returns the score of a document matching the WHERE clause of a full-text query:
+// sum of scores of all matched terms (AND, OR), or 1 for other conditions.
+func MatchScore(whereClause Expr) Expr {
+	switch e := whereClause.(type) {
+	case nil:
+		return NewLiteral(1)
+	case InfixExpr:
+		switch strings.ToUpper(strings.TrimSpace(e.Op)) {
+		case "AND":
+			return ScoreSum(MatchScore(e.Left), MatchScore(e.Right))
+		case "OR":
+			return ScoreSum(ScoreIf(RemoveBoosts(e.Left), MatchScore(e.Left)), ScoreIf(RemoveBoosts(e.Right), MatchScore(e.Right)))
+		}
+		if term, ok := matchedTerm(e); ok {
+			return NewScoreTermExpr(e.Left, term)
+		}
+	case ParenExpr:
+		if len(e.Exprs) == 1 {
+			return MatchScore(e.Exprs[0])
+		}
+	case PrefixExpr:
+		if strings.ToUpper(e.Op) == "NOT" {
+			return NewLiteral(0)
+		}
+	case FunctionExpr:
+		if e.Name == BoostFunction && len(e.Args) == 2 {
+			return NewFunction("multiply", MatchScore(e.Args[0]), e.Args[1])
+		}
+	}
+	return NewLiteral(1)
+}
+
+// matchedTerm returns the term of `column MatchOperator 'term'` or `column ILIKE '%term%'`.
+// LIKE patterns with wildcards inside don't have a term.
+func matchedTerm(e InfixExpr) (term string, ok bool) {
+	if _, isColumn := e.Left.(ColumnRef); !isColumn {
+		return "", false
+	}
+	literal, isLiteral := e.Right.(LiteralExpr)
+	if !isLiteral {
+		return "", false
+	}
+	value, isString := literal.Value.(string)
+	if !isString {
+		return "", false
+	}
+
+	if e.Op == MatchOperator {
+		return strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'"), true
+	}
+	if op := strings.ToUpper(strings.TrimSpace(e.Op)); op != "LIKE" && op != "ILIKE" {
+		return "", false
+	}
+	switch literal.EscapeType {
+	case NotEscapedLikeFull:
+		return value, true
+	case NotEscapedLikePrefix:
+		return "", false
+	case NormalNotEscaped:
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'")
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "%"), "%")
+	var unescaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '%', '_':
+			return "", false
+		case '\\':
+			if i+1 < len(value) {
+				i++
+			}
+		}
+		unescaped.WriteByte(value[i])
+	}
+	return unescaped.String(), unescaped.Len() > 0
+}
+
+// ScoreSum returns the sum of scores, skipping nils
+func ScoreSum(scores ...Expr) Expr {
+	scores = FilterOutEmptyStatements(scores)
+	if len(scores) == 0 {
+		return NewLiteral(0)
+	}
+	sum := scores[0]
+	for _, score := range scores[1:] {
+		sum = NewFunction("plus", sum, score)
+	}
+	return sum
+}
+
+// ScoreIf returns the score if the condition is met, 0 otherwise
+func ScoreIf(condition, score Expr) Expr {
+	if condition == nil {
+		return score
+	}
+	return NewFunction("if", condition, score, NewLiteral(0))
+}
+
+// ScoreBoost multiplies the score by the boost
+func ScoreBoost(score Expr, boost float64) Expr {
+	if boost == 1 {
+		return score
+	}
+	return NewFunction("multiply", score, NewLiteral(boost))
+}
@@ -0,0 +1,48 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatchScore(t *testing.T) {
+	message := NewColumnRef("message")
+	tests := []struct {
+		name        string
+		whereClause Expr
+		wantedScore string
+	}{
+		{"nil", nil, "1"},
+		{"match operator", NewInfixExpr(message, MatchOperator, NewLiteral("'fox'")), `("message" __quesma_score 'fox')`},
+		{"ilike with escapes", NewInfixExpr(message, "ILIKE", NewLiteral(`'%50\%%'`)), `("message" __quesma_score '50%')`},
+		{"ilike with wildcard inside", NewInfixExpr(message, "ILIKE", NewLiteral("'%f_x%'")), "1"},
+		{"not a full-text condition", NewInfixExpr(NewColumnRef("age"), ">=", NewLiteral(18)), "1"},
+		{"negation", NewPrefixExpr("NOT", []Expr{NewInfixExpr(message, MatchOperator, NewLiteral("'fox'"))}), "0"},
+		{
+			"and with boost",
+			And([]Expr{NewBoostExpr(NewInfixExpr(message, MatchOperator, NewLiteral("'quick'")), 2), NewInfixExpr(message, MatchOperator, NewLiteral("'fox'"))}),
+			`plus(multiply(("message" __quesma_score 'quick'),2),("message" __quesma_score 'fox'))`,
+		},
+		{
+			"or",
+			Or([]Expr{NewInfixExpr(message, MatchOperator, NewLiteral("'quick'")), NewInfixExpr(message, MatchOperator, NewLiteral("'fox'"))}),
+			`plus(if(("message" __quesma_match 'quick'),("message" __quesma_score 'quick'),0),if(("message" __quesma_match 'fox'),("message" __quesma_score 'fox'),0))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantedScore, AsString(MatchScore(tt.whereClause)))
+		})
+	}
+}
+
+func TestRemoveBoosts(t *testing.T) {
+	whereClause := Or([]Expr{
+		NewBoostExpr(NewInfixExpr(NewColumnRef("message"), "ILIKE", NewLiteral("'%quick%'")), 3),
+		NewParenExpr(NewBoostExpr(NewInfixExpr(NewColumnRef("status"), "=", NewLiteral("'ok'")), 0.5)),
+	})
+	assert.Equal(t, `("message" ILIKE '%quick%' OR ("status"='ok'))`, AsString(RemoveBoosts(whereClause)))
+	assert.Nil(t, RemoveBoosts(nil))
+}
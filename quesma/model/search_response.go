@@ -44,10 +44,17 @@ func NewSearchHit(index string) SearchHit {
 }
 
 type SearchHits struct {
-	Total    *Total      `json:"total,omitempty"`
-	MaxScore *float32    `json:"max_score"`
-	Hits     []SearchHit `json:"hits"`
-	Events   []SearchHit `json:"events,omitempty"` // this one is used by EQL
+	Total     *Total        `json:"total,omitempty"`
+	MaxScore  *float32      `json:"max_score"`
+	Hits      []SearchHit   `json:"hits"`
+	Events    []SearchHit   `json:"events,omitempty"`    // this one is used by EQL
+	Sequences []EqlSequence `json:"sequences,omitempty"` // this one is used by EQL sequence and sample queries
+}
+
+// EqlSequence is a single match of EQL `sequence` (or `sample`) query
+type EqlSequence struct {
+	JoinKeys []any       `json:"join_keys,omitempty"`
+	Events   []SearchHit `json:"events"`
 }
 
 type Total struct {
@@ -63,6 +70,7 @@ type SearchResp struct {
 	Hits              SearchHits     `json:"hits"`
 	Aggregations      JsonMap        `json:"aggregations,omitempty"`
 	ScrollID          *string        `json:"_scroll_id,omitempty"`
+	IsPartial         *bool          `json:"is_partial,omitempty"` // used by EQL, when not all matches might have been found
 }
 
 func (response *SearchResp) Marshal() ([]byte, error) {
@@ -13,6 +13,7 @@ type SelectCommand struct {
 
 	LimitBy     []Expr // LIMIT BY clause (empty => maybe LIMIT, but no LIMIT BY)
 	Limit       int    // LIMIT clause, noLimit (0) means no limit
+	Offset      int    // OFFSET clause, only with LIMIT (without LIMIT BY), 0 means no offset
 	SampleLimit int    // LIMIT, but before grouping, 0 means no limit
 
 	NamedCTEs []*CTE // Named Common Table Expressions, so these parts of query: WITH cte_1 AS SELECT ..., cte_2 AS SELECT ...
@@ -6,6 +6,8 @@ type SimpleQuery struct {
 	WhereClause Expr
 	OrderBy     []OrderByExpr
 	CanParse    bool
+	// Score is the relevance score (_score) of matching documents, nil means a constant score of 1
+	Score Expr
 	// NeedCountWithLimit > 0 means we need count(*) LIMIT NeedCountWithLimit
 	// NeedCountWithLimit 0 (WeNeedUnlimitedCount) means we need count(*) (unlimited)
 	// NeedCountWithLimit -1 (WeDontNeedCount) means we don't need a count(*) query
@@ -32,6 +34,14 @@ func NewSimpleQueryInvalid() SimpleQuery {
 	return SimpleQuery{CanParse: false}
 }
 
+// ScoreOrDefault returns Score, or the constant score of 1 if Score isn't set
+func (s *SimpleQuery) ScoreOrDefault() Expr {
+	if s.Score == nil {
+		return NewLiteral(1)
+	}
+	return s.Score
+}
+
 // LimitForCount returns (limit, true) if we need count(*) with limit,
 // (not-important, false) if we don't need count/limit
 func (s *SimpleQuery) LimitForCount() (limit int, doWeNeedLimit bool) {
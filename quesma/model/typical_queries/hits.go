@@ -29,7 +29,7 @@ type Hits struct {
 	highlighter        *model.Highlighter
 	sortFieldNames     []string
 	addSource          bool // true <=> we add hit.Source field to the response
-	addScore           bool // true <=> we add hit.Score field to the response (whose value is always 1)
+	addScore           bool // true <=> we add hit.Score field to the response (1, unless there's model.ScoreFieldName column)
 	addVersion         bool // true <=> we add hit.Version field to the response (whose value is always 1)
 	indexes            []string
 	timestampFieldName string
@@ -43,7 +43,7 @@ func NewHits(ctx context.Context, table *clickhouse.Table, highlighter *model.Hi
 }
 
 const (
-	defaultScore   = 1 // if we add "score" field, it's always 1
+	defaultScore   = 1 // if we add "score" field and don't compute it, it's always 1
 	defaultVersion = 1 // if we  add "version" field, it's always 1
 )
 
@@ -54,6 +54,7 @@ func (query Hits) AggregationType() model.AggregationType {
 func (query Hits) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
 
 	hits := make([]model.SearchHit, 0, len(rows))
+	var maxScore *float32
 
 	lookForCommonTableIndexColumn := true
 
@@ -82,17 +83,25 @@ func (query Hits) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.
 		if query.addScore {
 			hit.Score = defaultScore
 		}
+		if score, found := query.extractScore(&row); found {
+			hit.Score = score
+			if maxScore == nil || score > *maxScore {
+				maxScore = &score
+			}
+		}
 		if query.addVersion {
 			hit.Version = defaultVersion
 		}
 		if query.addSource {
-			hit.Source = []byte(rows[i].String(query.ctx))
+			hit.Source = []byte(row.String(query.ctx))
 		}
 		query.addAndHighlightHit(&hit, &row)
 
 		hit.ID = query.computeIdForDocument(hit, strconv.Itoa(i+1))
 		for _, fieldName := range query.sortFieldNames {
-			if val, ok := hit.Fields[fieldName]; ok {
+			if fieldName == model.ScoreFieldName {
+				hit.Sort = append(hit.Sort, hit.Score)
+			} else if val, ok := hit.Fields[fieldName]; ok {
 				hit.Sort = append(hit.Sort, elasticsearch.FormatSortValue(val[0]))
 			} else {
 				logger.WarnWithCtx(query.ctx).Msgf("field %s not found in fields", fieldName)
@@ -107,7 +116,8 @@ func (query Hits) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.
 				Value:    len(rows),
 				Relation: "eq", // TODO fix in next PR
 			},
-			Hits: hits,
+			MaxScore: maxScore,
+			Hits:     hits,
 		},
 		"shards": model.ResponseShards{
 			Total:      1,
@@ -117,6 +127,17 @@ func (query Hits) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.
 	}
 }
 
+// extractScore removes the relevance score column (computed only if scoring is enabled) from the row and returns its value
+func (query Hits) extractScore(row *model.QueryResultRow) (score float32, found bool) {
+	for i, cell := range row.Cols {
+		if cell.ColName == model.ScoreFieldName {
+			row.Cols = append(row.Cols[:i:i], row.Cols[i+1:]...)
+			return float32(util.ExtractNumeric64(cell.Value)), true
+		}
+	}
+	return 0, false
+}
+
 func (query Hits) addAndHighlightHit(hit *model.SearchHit, resultRow *model.QueryResultRow) {
 	toInterfaceArray := func(val interface{}) []interface{} {
 		v := reflect.ValueOf(val)
@@ -165,7 +165,9 @@ func (s *materializedViewReplace) replace(rule materializedViewReplaceRule, quer
 					if whereReplaced {
 						replaced = true
 						from = model.NewTableRef(rule.materializedView) // config param
-						return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, newWhere, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+						selectCommand := model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, newWhere, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+						selectCommand.Offset = query.Offset
+						return selectCommand
 					}
 				}
 			} else {
@@ -176,7 +178,9 @@ func (s *materializedViewReplace) replace(rule materializedViewReplaceRule, quer
 		if query.WhereClause != nil {
 			where = query.WhereClause.Accept(v).(model.Expr)
 		}
-		return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, where, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand := model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, where, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		selectCommand.Offset = query.Offset
+		return selectCommand
 
 	}
 
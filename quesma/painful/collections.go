@@ -0,0 +1,216 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MaxLoopIterations guards against endless loops in scripts, it's a limit for a single loop
+const MaxLoopIterations = 1_000_000
+
+// asList returns elements of a list (*[]any), or of a plain slice, e.g. an array field of a document
+func asList(val any) ([]any, error) {
+	switch list := val.(type) {
+	case *[]any:
+		return *list, nil
+	case []any:
+		return list, nil
+	}
+
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list, got %T", val)
+	}
+	result := make([]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		result = append(result, v.Index(i).Interface())
+	}
+	return result, nil
+}
+
+func listIndex(position string, list []any, index any) (int, error) {
+	n, isNumber := asNumber(index)
+	if !isNumber || n < 0 || int(n) >= len(list) {
+		return 0, fmt.Errorf("%s: index %v out of bounds for length %d", position, index, len(list))
+	}
+	return int(n), nil
+}
+
+// ListMethodArgs is the number of arguments of supported List methods
+var ListMethodArgs = map[string]int{
+	"size": 0, "isEmpty": 0, "add": 1, "addAll": 1, "get": 1, "contains": 1, "indexOf": 1, "set": 2,
+}
+
+func evalListMethod(position string, list *[]any, name string, args []any) (any, error) {
+	wantArgs, ok := ListMethodArgs[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: '%s' method of List is not supported", position, name)
+	}
+	if len(args) != wantArgs {
+		return nil, fmt.Errorf("%s: wrong number of arguments of '%s' method: %d", position, name, len(args))
+	}
+
+	switch name {
+	case "size":
+		return int64(len(*list)), nil
+	case "isEmpty":
+		return len(*list) == 0, nil
+	case "add":
+		*list = append(*list, args[0])
+		return true, nil
+	case "addAll":
+		elements, err := asList(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: '%s' method: %v", position, name, err)
+		}
+		*list = append(*list, elements...)
+		return len(elements) > 0, nil
+	case "get":
+		i, err := listIndex(position, *list, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return (*list)[i], nil
+	case "set":
+		i, err := listIndex(position, *list, args[0])
+		if err != nil {
+			return nil, err
+		}
+		previous := (*list)[i]
+		(*list)[i] = args[1]
+		return previous, nil
+	default: // contains, indexOf
+		for i, element := range *list {
+			if equals(element, args[0]) {
+				if name == "contains" {
+					return true, nil
+				}
+				return int64(i), nil
+			}
+		}
+		if name == "contains" {
+			return false, nil
+		}
+		return int64(-1), nil
+	}
+}
+
+// MapMethodArgs is the number of arguments of supported Map methods
+var MapMethodArgs = map[string]int{
+	"size": 0, "isEmpty": 0, "keySet": 0, "values": 0,
+	"get": 1, "containsKey": 1, "remove": 1, "put": 2, "getOrDefault": 2,
+}
+
+func isMapMethod(name string) bool {
+	_, ok := MapMethodArgs[name]
+	return ok
+}
+
+// sortedKeys makes the order of keySet() and values() deterministic
+func sortedKeys(valMap map[string]any) []string {
+	keys := make([]string, 0, len(valMap))
+	for key := range valMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func evalMapMethod(position string, valMap map[string]any, name string, args []any) (any, error) {
+	if len(args) != MapMethodArgs[name] {
+		return nil, fmt.Errorf("%s: wrong number of arguments of '%s' method: %d", position, name, len(args))
+	}
+
+	var key string
+	if len(args) > 0 {
+		key = fmt.Sprintf("%v", args[0])
+	}
+
+	switch name {
+	case "size":
+		return int64(len(valMap)), nil
+	case "isEmpty":
+		return len(valMap) == 0, nil
+	case "keySet", "values":
+		result := make([]any, 0, len(valMap))
+		for _, k := range sortedKeys(valMap) {
+			if name == "keySet" {
+				result = append(result, k)
+			} else {
+				result = append(result, valMap[k])
+			}
+		}
+		return &result, nil
+	case "get":
+		return valMap[key], nil
+	case "containsKey":
+		_, ok := valMap[key]
+		return ok, nil
+	case "remove":
+		previous := valMap[key]
+		delete(valMap, key)
+		return previous, nil
+	case "put":
+		previous := valMap[key]
+		valMap[key] = args[1]
+		return previous, nil
+	default: // getOrDefault
+		if val, ok := valMap[key]; ok {
+			return val, nil
+		}
+		return args[1], nil
+	}
+}
+
+func evalCollectionsMethod(position, name string, args []any) (any, error) {
+	if name != "sort" || len(args) != 1 {
+		return nil, fmt.Errorf("%s: 'Collections.%s' method is not supported", position, name)
+	}
+	list, isList := args[0].(*[]any)
+	if !isList {
+		return nil, fmt.Errorf("%s: 'Collections.sort' expects a list, got %T", position, args[0])
+	}
+
+	var sortErr error
+	sort.SliceStable(*list, func(i, j int) bool {
+		less, err := evalComparison("<", (*list)[i], (*list)[j])
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return less
+	})
+	if sortErr != nil {
+		return nil, fmt.Errorf("%s: 'Collections.sort': %v", position, sortErr)
+	}
+	return nil, nil
+}
+
+// PlainValue converts a value computed by a script to plain Go values (e.g. *[]any to []any),
+// so that it can be rendered as JSON
+func PlainValue(val any) any {
+	switch v := val.(type) {
+	case *[]any:
+		result := make([]any, 0, len(*v))
+		for _, element := range *v {
+			result = append(result, PlainValue(element))
+		}
+		return result
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, element := range v {
+			result = append(result, PlainValue(element))
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, element := range v {
+			result[key] = PlainValue(element)
+		}
+		return result
+	default:
+		return val
+	}
+}
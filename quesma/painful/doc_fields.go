@@ -0,0 +1,90 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DocFields returns names of document fields used by the scripts, i.e. `doc['field']` and `doc.field`.
+// Field names have to be literals, as we need to know them before reading documents.
+func DocFields(exprs ...Expr) ([]string, error) {
+	fields := make(map[string]struct{})
+	for _, expr := range exprs {
+		if err := collectDocFields(expr, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]string, 0, len(fields))
+	for field := range fields {
+		result = append(result, field)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func collectDocFields(expr Expr, fields map[string]struct{}) error {
+	var children []Expr
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *DocExpr:
+		name, isLiteral := e.FieldName.(*LiteralExpr)
+		if !isLiteral {
+			return fmt.Errorf("doc fields accessed by non-literal names are not supported")
+		}
+		fields[fmt.Sprintf("%v", name.Value)] = struct{}{}
+	case *AccessorExpr:
+		if v, isVariable := e.Expr.(*VariableExpr); isVariable && v.Name == "doc" {
+			fields[e.PropertyName] = struct{}{}
+		} else {
+			children = []Expr{e.Expr}
+		}
+	case *MethodCallExpr:
+		if v, isVariable := e.Expr.(*VariableExpr); isVariable && v.Name == "doc" && e.MethodName == "containsKey" && len(e.Args) == 1 {
+			if name, isLiteral := e.Args[0].(*LiteralExpr); isLiteral {
+				fields[fmt.Sprintf("%v", name.Value)] = struct{}{}
+			}
+		}
+		children = append([]Expr{e.Expr}, e.Args...)
+	case *InfixOpExpr:
+		children = []Expr{e.Left, e.Right}
+	case *PrefixOpExpr:
+		children = []Expr{e.Expr}
+	case *ConditionalExpr:
+		children = []Expr{e.Cond, e.Then, e.Else}
+	case *IndexExpr:
+		children = []Expr{e.Expr, e.Index}
+	case *AssignExpr:
+		children = []Expr{e.Expr}
+	case *SetExpr:
+		children = []Expr{e.Container, e.Key, e.Expr}
+	case *ReturnExpr:
+		children = []Expr{e.Expr}
+	case *StatementsExpr:
+		children = e.Statements
+	case *EmitExpr:
+		children = []Expr{e.Expr}
+	case *UrlEncodeExpr:
+		children = []Expr{e.Expr}
+	case *ForEachExpr:
+		children = []Expr{e.Iterable, e.Body}
+	case *ForExpr:
+		children = []Expr{e.Init, e.Cond, e.Update, e.Body}
+	case *ListExpr:
+		children = e.Elements
+	case *MapExpr:
+		children = append(append([]Expr{}, e.Keys...), e.Values...)
+	case *CastExpr:
+		children = []Expr{e.Expr}
+	}
+
+	for _, child := range children {
+		if err := collectDocFields(child, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -22,119 +22,173 @@ import (
 var g = &grammar{
 	rules: []*rule{
 		{
-			name: "Expr",
-			pos:  position{line: 8, col: 1, offset: 123},
-			expr: &choiceExpr{
-				pos: position{line: 8, col: 9, offset: 131},
-				alternatives: []any{
-					&labeledExpr{
-						pos:   position{line: 8, col: 9, offset: 131},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 14, offset: 136},
-							name: "OpExpr",
-						},
-					},
-					&labeledExpr{
-						pos:   position{line: 8, col: 23, offset: 145},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 28, offset: 150},
-							name: "MethodCall",
-						},
-					},
-					&labeledExpr{
-						pos:   position{line: 8, col: 41, offset: 163},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 46, offset: 168},
-							name: "Accessor",
-						},
-					},
-					&labeledExpr{
-						pos:   position{line: 8, col: 57, offset: 179},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 62, offset: 184},
-							name: "Doc",
+			name: "Script",
+			pos:  position{line: 10, col: 1, offset: 349},
+			expr: &actionExpr{
+				pos: position{line: 10, col: 10, offset: 358},
+				run: (*parser).callonScript1,
+				expr: &seqExpr{
+					pos: position{line: 10, col: 10, offset: 358},
+					exprs: []any{
+						&ruleRefExpr{
+							pos:  position{line: 10, col: 10, offset: 358},
+							name: "_",
 						},
-					},
-					&labeledExpr{
-						pos:   position{line: 8, col: 68, offset: 190},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 73, offset: 195},
-							name: "Emit",
+						&labeledExpr{
+							pos:   position{line: 10, col: 12, offset: 360},
+							label: "statements",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 10, col: 23, offset: 371},
+								expr: &ruleRefExpr{
+									pos:  position{line: 10, col: 23, offset: 371},
+									name: "Statement",
+								},
+							},
 						},
-					},
-					&labeledExpr{
-						pos:   position{line: 8, col: 80, offset: 202},
-						label: "expr",
-						expr: &ruleRefExpr{
-							pos:  position{line: 8, col: 85, offset: 207},
-							name: "String",
+						&ruleRefExpr{
+							pos:  position{line: 10, col: 34, offset: 382},
+							name: "EOF",
 						},
 					},
-					&actionExpr{
-						pos: position{line: 8, col: 94, offset: 216},
-						run: (*parser).callonExpr14,
-						expr: &labeledExpr{
-							pos:   position{line: 8, col: 94, offset: 216},
-							label: "expr",
-							expr: &ruleRefExpr{
-								pos:  position{line: 8, col: 99, offset: 221},
-								name: "UrlEncoder",
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Statement",
+			pos:  position{line: 14, col: 1, offset: 428},
+			expr: &actionExpr{
+				pos: position{line: 14, col: 13, offset: 440},
+				run: (*parser).callonStatement1,
+				expr: &seqExpr{
+					pos: position{line: 14, col: 13, offset: 440},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 14, col: 13, offset: 440},
+							label: "stmt",
+							expr: &choiceExpr{
+								pos: position{line: 14, col: 20, offset: 447},
+								alternatives: []any{
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 20, offset: 447},
+										name: "If",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 25, offset: 452},
+										name: "For",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 31, offset: 458},
+										name: "While",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 39, offset: 466},
+										name: "Return",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 48, offset: 475},
+										name: "Declaration",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 62, offset: 489},
+										name: "Assignment",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 75, offset: 502},
+										name: "Increment",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 14, col: 87, offset: 514},
+										name: "ExprStatement",
+									},
+								},
 							},
 						},
+						&ruleRefExpr{
+							pos:  position{line: 14, col: 103, offset: 530},
+							name: "_",
+						},
 					},
 				},
 			},
-			leader:        true,
-			leftRecursive: true,
+			leader:        false,
+			leftRecursive: false,
 		},
 		{
-			name: "Emit",
-			pos:  position{line: 12, col: 1, offset: 258},
+			name: "If",
+			pos:  position{line: 18, col: 1, offset: 558},
 			expr: &actionExpr{
-				pos: position{line: 12, col: 8, offset: 265},
-				run: (*parser).callonEmit1,
+				pos: position{line: 18, col: 6, offset: 563},
+				run: (*parser).callonIf1,
 				expr: &seqExpr{
-					pos: position{line: 12, col: 8, offset: 265},
+					pos: position{line: 18, col: 6, offset: 563},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 12, col: 8, offset: 265},
-							val:        "emit",
+							pos:        position{line: 18, col: 6, offset: 563},
+							val:        "if",
 							ignoreCase: false,
-							want:       "\"emit\"",
+							want:       "\"if\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 18, col: 11, offset: 568},
+							name: "_",
 						},
 						&litMatcher{
-							pos:        position{line: 12, col: 15, offset: 272},
+							pos:        position{line: 18, col: 13, offset: 570},
 							val:        "(",
 							ignoreCase: false,
 							want:       "\"(\"",
 						},
 						&ruleRefExpr{
-							pos:  position{line: 12, col: 19, offset: 276},
+							pos:  position{line: 18, col: 17, offset: 574},
 							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 12, col: 21, offset: 278},
-							label: "expr",
+							pos:   position{line: 18, col: 19, offset: 576},
+							label: "cond",
 							expr: &ruleRefExpr{
-								pos:  position{line: 12, col: 26, offset: 283},
+								pos:  position{line: 18, col: 24, offset: 581},
 								name: "Expr",
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 12, col: 31, offset: 288},
+							pos:  position{line: 18, col: 29, offset: 586},
 							name: "_",
 						},
 						&litMatcher{
-							pos:        position{line: 12, col: 33, offset: 290},
+							pos:        position{line: 18, col: 31, offset: 588},
 							val:        ")",
 							ignoreCase: false,
 							want:       "\")\"",
 						},
+						&ruleRefExpr{
+							pos:  position{line: 18, col: 35, offset: 592},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 18, col: 37, offset: 594},
+							label: "then",
+							expr: &ruleRefExpr{
+								pos:  position{line: 18, col: 42, offset: 599},
+								name: "Body",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 18, col: 47, offset: 604},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 18, col: 49, offset: 606},
+							label: "otherwise",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 18, col: 59, offset: 616},
+								expr: &ruleRefExpr{
+									pos:  position{line: 18, col: 59, offset: 616},
+									name: "Else",
+								},
+							},
+						},
 					},
 				},
 			},
@@ -142,40 +196,32 @@ var g = &grammar{
 			leftRecursive: false,
 		},
 		{
-			name: "Doc",
-			pos:  position{line: 22, col: 1, offset: 429},
+			name: "Else",
+			pos:  position{line: 41, col: 1, offset: 1043},
 			expr: &actionExpr{
-				pos: position{line: 22, col: 7, offset: 435},
-				run: (*parser).callonDoc1,
+				pos: position{line: 41, col: 8, offset: 1050},
+				run: (*parser).callonElse1,
 				expr: &seqExpr{
-					pos: position{line: 22, col: 7, offset: 435},
+					pos: position{line: 41, col: 8, offset: 1050},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 22, col: 7, offset: 435},
-							val:        "doc",
+							pos:        position{line: 41, col: 8, offset: 1050},
+							val:        "else",
 							ignoreCase: false,
-							want:       "\"doc\"",
+							want:       "\"else\"",
 						},
-						&litMatcher{
-							pos:        position{line: 22, col: 13, offset: 441},
-							val:        "[",
-							ignoreCase: false,
-							want:       "\"[\"",
+						&ruleRefExpr{
+							pos:  position{line: 41, col: 15, offset: 1057},
+							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 22, col: 17, offset: 445},
-							label: "key",
+							pos:   position{line: 41, col: 17, offset: 1059},
+							label: "body",
 							expr: &ruleRefExpr{
-								pos:  position{line: 22, col: 21, offset: 449},
-								name: "Expr",
+								pos:  position{line: 41, col: 22, offset: 1064},
+								name: "Body",
 							},
 						},
-						&litMatcher{
-							pos:        position{line: 22, col: 27, offset: 455},
-							val:        "]",
-							ignoreCase: false,
-							want:       "\"]\"",
-						},
 					},
 				},
 			},
@@ -183,172 +229,347 @@ var g = &grammar{
 			leftRecursive: false,
 		},
 		{
-			name: "Accessor",
-			pos:  position{line: 32, col: 1, offset: 597},
-			expr: &actionExpr{
-				pos: position{line: 32, col: 12, offset: 608},
-				run: (*parser).callonAccessor1,
-				expr: &seqExpr{
-					pos: position{line: 32, col: 12, offset: 608},
-					exprs: []any{
-						&labeledExpr{
-							pos:   position{line: 32, col: 12, offset: 608},
-							label: "expr",
-							expr: &ruleRefExpr{
-								pos:  position{line: 32, col: 17, offset: 613},
-								name: "Expr",
+			name: "For",
+			pos:  position{line: 45, col: 1, offset: 1095},
+			expr: &choiceExpr{
+				pos: position{line: 45, col: 7, offset: 1101},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 45, col: 7, offset: 1101},
+						run: (*parser).callonFor2,
+						expr: &seqExpr{
+							pos: position{line: 45, col: 7, offset: 1101},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 45, col: 7, offset: 1101},
+									val:        "for",
+									ignoreCase: false,
+									want:       "\"for\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 13, offset: 1107},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 45, col: 15, offset: 1109},
+									val:        "(",
+									ignoreCase: false,
+									want:       "\"(\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 19, offset: 1113},
+									name: "_",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 45, col: 23, offset: 1117},
+									expr: &seqExpr{
+										pos: position{line: 45, col: 23, offset: 1117},
+										exprs: []any{
+											&ruleRefExpr{
+												pos:  position{line: 45, col: 23, offset: 1117},
+												name: "Type",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 45, col: 28, offset: 1122},
+												name: "_",
+											},
+										},
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 45, col: 33, offset: 1127},
+									label: "name",
+									expr: &ruleRefExpr{
+										pos:  position{line: 45, col: 38, offset: 1132},
+										name: "Identifier",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 49, offset: 1143},
+									name: "_",
+								},
+								&choiceExpr{
+									pos: position{line: 45, col: 53, offset: 1147},
+									alternatives: []any{
+										&seqExpr{
+											pos: position{line: 45, col: 53, offset: 1147},
+											exprs: []any{
+												&litMatcher{
+													pos:        position{line: 45, col: 53, offset: 1147},
+													val:        "in",
+													ignoreCase: false,
+													want:       "\"in\"",
+												},
+												&notExpr{
+													pos: position{line: 45, col: 58, offset: 1152},
+													expr: &ruleRefExpr{
+														pos:  position{line: 45, col: 59, offset: 1153},
+														name: "IdentifierChar",
+													},
+												},
+											},
+										},
+										&litMatcher{
+											pos:        position{line: 45, col: 76, offset: 1170},
+											val:        ":",
+											ignoreCase: false,
+											want:       "\":\"",
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 82, offset: 1176},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 45, col: 84, offset: 1178},
+									label: "iterable",
+									expr: &ruleRefExpr{
+										pos:  position{line: 45, col: 93, offset: 1187},
+										name: "Expr",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 98, offset: 1192},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 45, col: 100, offset: 1194},
+									val:        ")",
+									ignoreCase: false,
+									want:       "\")\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 45, col: 104, offset: 1198},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 45, col: 106, offset: 1200},
+									label: "body",
+									expr: &ruleRefExpr{
+										pos:  position{line: 45, col: 111, offset: 1205},
+										name: "Body",
+									},
+								},
 							},
 						},
-						&litMatcher{
-							pos:        position{line: 32, col: 22, offset: 618},
-							val:        ".",
-							ignoreCase: false,
-							want:       "\".\"",
-						},
-						&labeledExpr{
-							pos:   position{line: 32, col: 26, offset: 622},
-							label: "field",
-							expr: &ruleRefExpr{
-								pos:  position{line: 32, col: 32, offset: 628},
-								name: "Identifier",
+					},
+					&actionExpr{
+						pos: position{line: 47, col: 5, offset: 1276},
+						run: (*parser).callonFor29,
+						expr: &seqExpr{
+							pos: position{line: 47, col: 5, offset: 1276},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 47, col: 5, offset: 1276},
+									val:        "for",
+									ignoreCase: false,
+									want:       "\"for\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 11, offset: 1282},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 47, col: 13, offset: 1284},
+									val:        "(",
+									ignoreCase: false,
+									want:       "\"(\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 17, offset: 1288},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 47, col: 19, offset: 1290},
+									label: "init",
+									expr: &zeroOrOneExpr{
+										pos: position{line: 47, col: 26, offset: 1297},
+										expr: &choiceExpr{
+											pos: position{line: 47, col: 26, offset: 1297},
+											alternatives: []any{
+												&ruleRefExpr{
+													pos:  position{line: 47, col: 26, offset: 1297},
+													name: "Declaration",
+												},
+												&ruleRefExpr{
+													pos:  position{line: 47, col: 40, offset: 1311},
+													name: "Assignment",
+												},
+											},
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 54, offset: 1325},
+									name: "_",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 47, col: 56, offset: 1327},
+									expr: &litMatcher{
+										pos:        position{line: 47, col: 56, offset: 1327},
+										val:        ";",
+										ignoreCase: false,
+										want:       "\";\"",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 61, offset: 1332},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 47, col: 63, offset: 1334},
+									label: "cond",
+									expr: &zeroOrOneExpr{
+										pos: position{line: 47, col: 68, offset: 1339},
+										expr: &ruleRefExpr{
+											pos:  position{line: 47, col: 68, offset: 1339},
+											name: "Expr",
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 74, offset: 1345},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 47, col: 76, offset: 1347},
+									val:        ";",
+									ignoreCase: false,
+									want:       "\";\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 80, offset: 1351},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 47, col: 82, offset: 1353},
+									label: "update",
+									expr: &zeroOrOneExpr{
+										pos: position{line: 47, col: 91, offset: 1362},
+										expr: &choiceExpr{
+											pos: position{line: 47, col: 91, offset: 1362},
+											alternatives: []any{
+												&ruleRefExpr{
+													pos:  position{line: 47, col: 91, offset: 1362},
+													name: "Assignment",
+												},
+												&ruleRefExpr{
+													pos:  position{line: 47, col: 104, offset: 1375},
+													name: "Increment",
+												},
+											},
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 117, offset: 1388},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 47, col: 119, offset: 1390},
+									val:        ")",
+									ignoreCase: false,
+									want:       "\")\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 47, col: 123, offset: 1394},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 47, col: 125, offset: 1396},
+									label: "body",
+									expr: &ruleRefExpr{
+										pos:  position{line: 47, col: 130, offset: 1401},
+										name: "Body",
+									},
+								},
 							},
 						},
 					},
 				},
 			},
 			leader:        false,
-			leftRecursive: true,
+			leftRecursive: false,
 		},
 		{
-			name: "MethodCall",
-			pos:  position{line: 47, col: 1, offset: 914},
+			name: "While",
+			pos:  position{line: 51, col: 1, offset: 1471},
 			expr: &actionExpr{
-				pos: position{line: 47, col: 14, offset: 927},
-				run: (*parser).callonMethodCall1,
+				pos: position{line: 51, col: 9, offset: 1479},
+				run: (*parser).callonWhile1,
 				expr: &seqExpr{
-					pos: position{line: 47, col: 14, offset: 927},
+					pos: position{line: 51, col: 9, offset: 1479},
 					exprs: []any{
-						&labeledExpr{
-							pos:   position{line: 47, col: 14, offset: 927},
-							label: "expr",
-							expr: &ruleRefExpr{
-								pos:  position{line: 47, col: 19, offset: 932},
-								name: "Expr",
-							},
-						},
 						&litMatcher{
-							pos:        position{line: 47, col: 24, offset: 937},
-							val:        ".",
+							pos:        position{line: 51, col: 9, offset: 1479},
+							val:        "while",
 							ignoreCase: false,
-							want:       "\".\"",
+							want:       "\"while\"",
 						},
-						&labeledExpr{
-							pos:   position{line: 47, col: 28, offset: 941},
-							label: "method",
-							expr: &ruleRefExpr{
-								pos:  position{line: 47, col: 35, offset: 948},
-								name: "Identifier",
-							},
+						&ruleRefExpr{
+							pos:  position{line: 51, col: 17, offset: 1487},
+							name: "_",
 						},
 						&litMatcher{
-							pos:        position{line: 47, col: 46, offset: 959},
+							pos:        position{line: 51, col: 19, offset: 1489},
 							val:        "(",
 							ignoreCase: false,
 							want:       "\"(\"",
 						},
-						&labeledExpr{
-							pos:   position{line: 47, col: 50, offset: 963},
-							label: "args",
-							expr: &zeroOrMoreExpr{
-								pos: position{line: 47, col: 55, offset: 968},
-								expr: &ruleRefExpr{
-									pos:  position{line: 47, col: 55, offset: 968},
-									name: "Expr",
-								},
-							},
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 47, col: 61, offset: 974},
-							expr: &litMatcher{
-								pos:        position{line: 47, col: 61, offset: 974},
-								val:        ",",
-								ignoreCase: false,
-								want:       "\",\"",
-							},
-						},
-						&litMatcher{
-							pos:        position{line: 47, col: 67, offset: 980},
-							val:        ")",
-							ignoreCase: false,
-							want:       "\")\"",
+						&ruleRefExpr{
+							pos:  position{line: 51, col: 23, offset: 1493},
+							name: "_",
 						},
-					},
-				},
-			},
-			leader:        false,
-			leftRecursive: true,
-		},
-		{
-			name: "OpExpr",
-			pos:  position{line: 91, col: 1, offset: 1910},
-			expr: &actionExpr{
-				pos: position{line: 91, col: 10, offset: 1919},
-				run: (*parser).callonOpExpr1,
-				expr: &seqExpr{
-					pos: position{line: 91, col: 10, offset: 1919},
-					exprs: []any{
 						&labeledExpr{
-							pos:   position{line: 91, col: 10, offset: 1919},
-							label: "left",
+							pos:   position{line: 51, col: 25, offset: 1495},
+							label: "cond",
 							expr: &ruleRefExpr{
-								pos:  position{line: 91, col: 15, offset: 1924},
+								pos:  position{line: 51, col: 30, offset: 1500},
 								name: "Expr",
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 91, col: 20, offset: 1929},
+							pos:  position{line: 51, col: 35, offset: 1505},
 							name: "_",
 						},
-						&labeledExpr{
-							pos:   position{line: 91, col: 23, offset: 1932},
-							label: "op",
-							expr: &ruleRefExpr{
-								pos:  position{line: 91, col: 26, offset: 1935},
-								name: "Op",
-							},
+						&litMatcher{
+							pos:        position{line: 51, col: 37, offset: 1507},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
 						},
 						&ruleRefExpr{
-							pos:  position{line: 91, col: 29, offset: 1938},
+							pos:  position{line: 51, col: 41, offset: 1511},
 							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 91, col: 32, offset: 1941},
-							label: "right",
+							pos:   position{line: 51, col: 43, offset: 1513},
+							label: "body",
 							expr: &ruleRefExpr{
-								pos:  position{line: 91, col: 38, offset: 1947},
-								name: "Expr",
+								pos:  position{line: 51, col: 48, offset: 1518},
+								name: "Body",
 							},
 						},
 					},
 				},
 			},
 			leader:        false,
-			leftRecursive: true,
+			leftRecursive: false,
 		},
 		{
-			name: "Op",
-			pos:  position{line: 110, col: 1, offset: 2316},
-			expr: &actionExpr{
-				pos: position{line: 110, col: 6, offset: 2321},
-				run: (*parser).callonOp1,
-				expr: &labeledExpr{
-					pos:   position{line: 110, col: 6, offset: 2321},
-					label: "op",
-					expr: &litMatcher{
-						pos:        position{line: 110, col: 9, offset: 2324},
-						val:        "+",
-						ignoreCase: false,
-						want:       "\"+\"",
+			name: "Body",
+			pos:  position{line: 55, col: 1, offset: 1584},
+			expr: &choiceExpr{
+				pos: position{line: 55, col: 8, offset: 1591},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 55, col: 8, offset: 1591},
+						name: "Block",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 55, col: 16, offset: 1599},
+						name: "Statement",
 					},
 				},
 			},
@@ -356,64 +577,40 @@ var g = &grammar{
 			leftRecursive: false,
 		},
 		{
-			name: "String",
-			pos:  position{line: 114, col: 1, offset: 2365},
+			name: "Block",
+			pos:  position{line: 57, col: 1, offset: 1610},
 			expr: &actionExpr{
-				pos: position{line: 114, col: 10, offset: 2374},
-				run: (*parser).callonString1,
+				pos: position{line: 57, col: 9, offset: 1618},
+				run: (*parser).callonBlock1,
 				expr: &seqExpr{
-					pos: position{line: 114, col: 10, offset: 2374},
+					pos: position{line: 57, col: 9, offset: 1618},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 114, col: 10, offset: 2374},
-							val:        "'",
+							pos:        position{line: 57, col: 9, offset: 1618},
+							val:        "{",
 							ignoreCase: false,
-							want:       "\"'\"",
+							want:       "\"{\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 57, col: 13, offset: 1622},
+							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 114, col: 15, offset: 2379},
-							label: "s",
+							pos:   position{line: 57, col: 15, offset: 1624},
+							label: "statements",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 114, col: 17, offset: 2381},
-								expr: &charClassMatcher{
-									pos:        position{line: 114, col: 17, offset: 2381},
-									val:        "[^']",
-									chars:      []rune{'\''},
-									ignoreCase: false,
-									inverted:   true,
+								pos: position{line: 57, col: 26, offset: 1635},
+								expr: &ruleRefExpr{
+									pos:  position{line: 57, col: 26, offset: 1635},
+									name: "Statement",
 								},
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 114, col: 23, offset: 2387},
-							val:        "'",
-							ignoreCase: false,
-							want:       "\"'\"",
-						},
-					},
-				},
-			},
-			leader:        false,
-			leftRecursive: false,
-		},
-		{
-			name: "Identifier",
-			pos:  position{line: 121, col: 1, offset: 2510},
-			expr: &actionExpr{
-				pos: position{line: 121, col: 14, offset: 2523},
-				run: (*parser).callonIdentifier1,
-				expr: &labeledExpr{
-					pos:   position{line: 121, col: 14, offset: 2523},
-					label: "id",
-					expr: &oneOrMoreExpr{
-						pos: position{line: 121, col: 17, offset: 2526},
-						expr: &charClassMatcher{
-							pos:        position{line: 121, col: 17, offset: 2526},
-							val:        "[a-zA-Z0-9_]",
-							chars:      []rune{'_'},
-							ranges:     []rune{'a', 'z', 'A', 'Z', '0', '9'},
+							pos:        position{line: 57, col: 37, offset: 1646},
+							val:        "}",
 							ignoreCase: false,
-							inverted:   false,
+							want:       "\"}\"",
 						},
 					},
 				},
@@ -422,42 +619,2326 @@ var g = &grammar{
 			leftRecursive: false,
 		},
 		{
-			name: "UrlEncoder",
-			pos:  position{line: 125, col: 1, offset: 2575},
+			name: "Return",
+			pos:  position{line: 61, col: 1, offset: 1692},
 			expr: &actionExpr{
-				pos: position{line: 125, col: 14, offset: 2588},
-				run: (*parser).callonUrlEncoder1,
+				pos: position{line: 61, col: 10, offset: 1701},
+				run: (*parser).callonReturn1,
 				expr: &seqExpr{
-					pos: position{line: 125, col: 14, offset: 2588},
+					pos: position{line: 61, col: 10, offset: 1701},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 125, col: 14, offset: 2588},
-							val:        "URLEncoder.encode",
+							pos:        position{line: 61, col: 10, offset: 1701},
+							val:        "return",
 							ignoreCase: false,
-							want:       "\"URLEncoder.encode\"",
+							want:       "\"return\"",
 						},
-						&litMatcher{
-							pos:        position{line: 125, col: 34, offset: 2608},
-							val:        "(",
-							ignoreCase: false,
-							want:       "\"(\"",
+						&notExpr{
+							pos: position{line: 61, col: 19, offset: 1710},
+							expr: &ruleRefExpr{
+								pos:  position{line: 61, col: 20, offset: 1711},
+								name: "IdentifierChar",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 61, col: 35, offset: 1726},
+							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 125, col: 38, offset: 2612},
+							pos:   position{line: 61, col: 37, offset: 1728},
 							label: "expr",
-							expr: &ruleRefExpr{
-								pos:  position{line: 125, col: 43, offset: 2617},
-								name: "Expr",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 61, col: 42, offset: 1733},
+								expr: &ruleRefExpr{
+									pos:  position{line: 61, col: 42, offset: 1733},
+									name: "Expr",
+								},
 							},
 						},
-						&litMatcher{
-							pos:        position{line: 125, col: 48, offset: 2622},
-							val:        ")",
-							ignoreCase: false,
-							want:       "\")\"",
+						&ruleRefExpr{
+							pos:  position{line: 61, col: 48, offset: 1739},
+							name: "_",
 						},
-					},
-				},
+						&zeroOrOneExpr{
+							pos: position{line: 61, col: 50, offset: 1741},
+							expr: &litMatcher{
+								pos:        position{line: 61, col: 50, offset: 1741},
+								val:        ";",
+								ignoreCase: false,
+								want:       "\";\"",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Declaration",
+			pos:  position{line: 75, col: 1, offset: 1968},
+			expr: &choiceExpr{
+				pos: position{line: 75, col: 15, offset: 1982},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 75, col: 15, offset: 1982},
+						run: (*parser).callonDeclaration2,
+						expr: &seqExpr{
+							pos: position{line: 75, col: 15, offset: 1982},
+							exprs: []any{
+								&ruleRefExpr{
+									pos:  position{line: 75, col: 15, offset: 1982},
+									name: "Type",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 75, col: 20, offset: 1987},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 75, col: 22, offset: 1989},
+									label: "assignment",
+									expr: &ruleRefExpr{
+										pos:  position{line: 75, col: 33, offset: 2000},
+										name: "Assignment",
+									},
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 77, col: 5, offset: 2044},
+						run: (*parser).callonDeclaration8,
+						expr: &seqExpr{
+							pos: position{line: 77, col: 5, offset: 2044},
+							exprs: []any{
+								&ruleRefExpr{
+									pos:  position{line: 77, col: 5, offset: 2044},
+									name: "Type",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 77, col: 10, offset: 2049},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 77, col: 12, offset: 2051},
+									label: "name",
+									expr: &ruleRefExpr{
+										pos:  position{line: 77, col: 17, offset: 2056},
+										name: "Identifier",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 77, col: 28, offset: 2067},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 77, col: 30, offset: 2069},
+									val:        ";",
+									ignoreCase: false,
+									want:       "\";\"",
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Type",
+			pos:  position{line: 81, col: 1, offset: 2212},
+			expr: &actionExpr{
+				pos: position{line: 81, col: 10, offset: 2221},
+				run: (*parser).callonType1,
+				expr: &seqExpr{
+					pos: position{line: 81, col: 10, offset: 2221},
+					exprs: []any{
+						&choiceExpr{
+							pos: position{line: 81, col: 10, offset: 2221},
+							alternatives: []any{
+								&litMatcher{
+									pos:        position{line: 81, col: 10, offset: 2221},
+									val:        "def",
+									ignoreCase: false,
+									want:       "\"def\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 18, offset: 2229},
+									val:        "int",
+									ignoreCase: false,
+									want:       "\"int\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 26, offset: 2237},
+									val:        "long",
+									ignoreCase: false,
+									want:       "\"long\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 35, offset: 2246},
+									val:        "float",
+									ignoreCase: false,
+									want:       "\"float\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 45, offset: 2256},
+									val:        "double",
+									ignoreCase: false,
+									want:       "\"double\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 56, offset: 2267},
+									val:        "boolean",
+									ignoreCase: false,
+									want:       "\"boolean\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 68, offset: 2279},
+									val:        "String",
+									ignoreCase: false,
+									want:       "\"String\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 79, offset: 2290},
+									val:        "Object",
+									ignoreCase: false,
+									want:       "\"Object\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 90, offset: 2301},
+									val:        "List",
+									ignoreCase: false,
+									want:       "\"List\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 99, offset: 2310},
+									val:        "ArrayList",
+									ignoreCase: false,
+									want:       "\"ArrayList\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 113, offset: 2324},
+									val:        "Map",
+									ignoreCase: false,
+									want:       "\"Map\"",
+								},
+								&litMatcher{
+									pos:        position{line: 81, col: 121, offset: 2332},
+									val:        "HashMap",
+									ignoreCase: false,
+									want:       "\"HashMap\"",
+								},
+							},
+						},
+						&notExpr{
+							pos: position{line: 81, col: 133, offset: 2344},
+							expr: &ruleRefExpr{
+								pos:  position{line: 81, col: 134, offset: 2345},
+								name: "IdentifierChar",
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 81, col: 151, offset: 2362},
+							expr: &seqExpr{
+								pos: position{line: 81, col: 151, offset: 2362},
+								exprs: []any{
+									&ruleRefExpr{
+										pos:  position{line: 81, col: 151, offset: 2362},
+										name: "_",
+									},
+									&litMatcher{
+										pos:        position{line: 81, col: 153, offset: 2364},
+										val:        "<",
+										ignoreCase: false,
+										want:       "\"<\"",
+									},
+									&zeroOrMoreExpr{
+										pos: position{line: 81, col: 157, offset: 2368},
+										expr: &charClassMatcher{
+											pos:        position{line: 81, col: 157, offset: 2368},
+											val:        "[^>]",
+											chars:      []rune{'>'},
+											ignoreCase: false,
+											inverted:   true,
+										},
+									},
+									&oneOrMoreExpr{
+										pos: position{line: 81, col: 163, offset: 2374},
+										expr: &litMatcher{
+											pos:        position{line: 81, col: 163, offset: 2374},
+											val:        ">",
+											ignoreCase: false,
+											want:       "\">\"",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Assignment",
+			pos:  position{line: 86, col: 1, offset: 2563},
+			expr: &actionExpr{
+				pos: position{line: 86, col: 14, offset: 2576},
+				run: (*parser).callonAssignment1,
+				expr: &seqExpr{
+					pos: position{line: 86, col: 14, offset: 2576},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 86, col: 14, offset: 2576},
+							label: "target",
+							expr: &ruleRefExpr{
+								pos:  position{line: 86, col: 21, offset: 2583},
+								name: "Postfix",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 86, col: 29, offset: 2591},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 86, col: 31, offset: 2593},
+							label: "op",
+							expr: &ruleRefExpr{
+								pos:  position{line: 86, col: 34, offset: 2596},
+								name: "AssignmentOp",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 86, col: 47, offset: 2609},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 86, col: 49, offset: 2611},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 86, col: 54, offset: 2616},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 86, col: 59, offset: 2621},
+							name: "_",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 86, col: 61, offset: 2623},
+							expr: &litMatcher{
+								pos:        position{line: 86, col: 61, offset: 2623},
+								val:        ";",
+								ignoreCase: false,
+								want:       "\";\"",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "AssignmentOp",
+			pos:  position{line: 90, col: 1, offset: 2692},
+			expr: &actionExpr{
+				pos: position{line: 90, col: 18, offset: 2709},
+				run: (*parser).callonAssignmentOp1,
+				expr: &choiceExpr{
+					pos: position{line: 90, col: 18, offset: 2709},
+					alternatives: []any{
+						&seqExpr{
+							pos: position{line: 90, col: 18, offset: 2709},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 90, col: 18, offset: 2709},
+									val:        "=",
+									ignoreCase: false,
+									want:       "\"=\"",
+								},
+								&notExpr{
+									pos: position{line: 90, col: 22, offset: 2713},
+									expr: &litMatcher{
+										pos:        position{line: 90, col: 23, offset: 2714},
+										val:        "=",
+										ignoreCase: false,
+										want:       "\"=\"",
+									},
+								},
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 90, col: 29, offset: 2720},
+							val:        "+=",
+							ignoreCase: false,
+							want:       "\"+=\"",
+						},
+						&litMatcher{
+							pos:        position{line: 90, col: 36, offset: 2727},
+							val:        "-=",
+							ignoreCase: false,
+							want:       "\"-=\"",
+						},
+						&litMatcher{
+							pos:        position{line: 90, col: 43, offset: 2734},
+							val:        "*=",
+							ignoreCase: false,
+							want:       "\"*=\"",
+						},
+						&litMatcher{
+							pos:        position{line: 90, col: 50, offset: 2741},
+							val:        "/=",
+							ignoreCase: false,
+							want:       "\"/=\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Increment",
+			pos:  position{line: 95, col: 1, offset: 2815},
+			expr: &actionExpr{
+				pos: position{line: 95, col: 13, offset: 2827},
+				run: (*parser).callonIncrement1,
+				expr: &seqExpr{
+					pos: position{line: 95, col: 13, offset: 2827},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 95, col: 13, offset: 2827},
+							label: "target",
+							expr: &ruleRefExpr{
+								pos:  position{line: 95, col: 20, offset: 2834},
+								name: "Postfix",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 95, col: 28, offset: 2842},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 95, col: 30, offset: 2844},
+							label: "op",
+							expr: &ruleRefExpr{
+								pos:  position{line: 95, col: 33, offset: 2847},
+								name: "IncrementOp",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 95, col: 45, offset: 2859},
+							name: "_",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 95, col: 47, offset: 2861},
+							expr: &litMatcher{
+								pos:        position{line: 95, col: 47, offset: 2861},
+								val:        ";",
+								ignoreCase: false,
+								want:       "\";\"",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "IncrementOp",
+			pos:  position{line: 99, col: 1, offset: 2955},
+			expr: &actionExpr{
+				pos: position{line: 99, col: 17, offset: 2971},
+				run: (*parser).callonIncrementOp1,
+				expr: &choiceExpr{
+					pos: position{line: 99, col: 17, offset: 2971},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 99, col: 17, offset: 2971},
+							val:        "++",
+							ignoreCase: false,
+							want:       "\"++\"",
+						},
+						&litMatcher{
+							pos:        position{line: 99, col: 24, offset: 2978},
+							val:        "--",
+							ignoreCase: false,
+							want:       "\"--\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "ExprStatement",
+			pos:  position{line: 103, col: 1, offset: 3031},
+			expr: &actionExpr{
+				pos: position{line: 103, col: 17, offset: 3047},
+				run: (*parser).callonExprStatement1,
+				expr: &seqExpr{
+					pos: position{line: 103, col: 17, offset: 3047},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 103, col: 17, offset: 3047},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 103, col: 22, offset: 3052},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 103, col: 27, offset: 3057},
+							name: "_",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 103, col: 29, offset: 3059},
+							expr: &litMatcher{
+								pos:        position{line: 103, col: 29, offset: 3059},
+								val:        ";",
+								ignoreCase: false,
+								want:       "\";\"",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Expr",
+			pos:  position{line: 107, col: 1, offset: 3090},
+			expr: &ruleRefExpr{
+				pos:  position{line: 107, col: 8, offset: 3097},
+				name: "Conditional",
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Conditional",
+			pos:  position{line: 109, col: 1, offset: 3110},
+			expr: &actionExpr{
+				pos: position{line: 109, col: 15, offset: 3124},
+				run: (*parser).callonConditional1,
+				expr: &seqExpr{
+					pos: position{line: 109, col: 15, offset: 3124},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 109, col: 15, offset: 3124},
+							label: "cond",
+							expr: &ruleRefExpr{
+								pos:  position{line: 109, col: 20, offset: 3129},
+								name: "Or",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 109, col: 23, offset: 3132},
+							label: "branches",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 109, col: 34, offset: 3143},
+								expr: &seqExpr{
+									pos: position{line: 109, col: 34, offset: 3143},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 34, offset: 3143},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 109, col: 36, offset: 3145},
+											val:        "?",
+											ignoreCase: false,
+											want:       "\"?\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 40, offset: 3149},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 42, offset: 3151},
+											name: "Expr",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 47, offset: 3156},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 109, col: 49, offset: 3158},
+											val:        ":",
+											ignoreCase: false,
+											want:       "\":\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 53, offset: 3162},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 109, col: 55, offset: 3164},
+											name: "Expr",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Or",
+			pos:  position{line: 113, col: 1, offset: 3219},
+			expr: &actionExpr{
+				pos: position{line: 113, col: 6, offset: 3224},
+				run: (*parser).callonOr1,
+				expr: &seqExpr{
+					pos: position{line: 113, col: 6, offset: 3224},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 113, col: 6, offset: 3224},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 113, col: 12, offset: 3230},
+								name: "And",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 113, col: 16, offset: 3234},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 113, col: 23, offset: 3241},
+								expr: &seqExpr{
+									pos: position{line: 113, col: 23, offset: 3241},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 113, col: 23, offset: 3241},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 113, col: 25, offset: 3243},
+											name: "OrOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 113, col: 30, offset: 3248},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 113, col: 32, offset: 3250},
+											name: "And",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "OrOp",
+			pos:  position{line: 117, col: 1, offset: 3316},
+			expr: &actionExpr{
+				pos: position{line: 117, col: 8, offset: 3323},
+				run: (*parser).callonOrOp1,
+				expr: &litMatcher{
+					pos:        position{line: 117, col: 8, offset: 3323},
+					val:        "||",
+					ignoreCase: false,
+					want:       "\"||\"",
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "And",
+			pos:  position{line: 121, col: 1, offset: 3364},
+			expr: &actionExpr{
+				pos: position{line: 121, col: 7, offset: 3370},
+				run: (*parser).callonAnd1,
+				expr: &seqExpr{
+					pos: position{line: 121, col: 7, offset: 3370},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 121, col: 7, offset: 3370},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 121, col: 13, offset: 3376},
+								name: "Equality",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 121, col: 22, offset: 3385},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 121, col: 29, offset: 3392},
+								expr: &seqExpr{
+									pos: position{line: 121, col: 29, offset: 3392},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 121, col: 29, offset: 3392},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 121, col: 31, offset: 3394},
+											name: "AndOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 121, col: 37, offset: 3400},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 121, col: 39, offset: 3402},
+											name: "Equality",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "AndOp",
+			pos:  position{line: 125, col: 1, offset: 3473},
+			expr: &actionExpr{
+				pos: position{line: 125, col: 9, offset: 3481},
+				run: (*parser).callonAndOp1,
+				expr: &litMatcher{
+					pos:        position{line: 125, col: 9, offset: 3481},
+					val:        "&&",
+					ignoreCase: false,
+					want:       "\"&&\"",
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Equality",
+			pos:  position{line: 129, col: 1, offset: 3522},
+			expr: &actionExpr{
+				pos: position{line: 129, col: 12, offset: 3533},
+				run: (*parser).callonEquality1,
+				expr: &seqExpr{
+					pos: position{line: 129, col: 12, offset: 3533},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 129, col: 12, offset: 3533},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 129, col: 18, offset: 3539},
+								name: "Relational",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 129, col: 29, offset: 3550},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 129, col: 36, offset: 3557},
+								expr: &seqExpr{
+									pos: position{line: 129, col: 36, offset: 3557},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 129, col: 36, offset: 3557},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 129, col: 38, offset: 3559},
+											name: "EqualityOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 129, col: 49, offset: 3570},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 129, col: 51, offset: 3572},
+											name: "Relational",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "EqualityOp",
+			pos:  position{line: 133, col: 1, offset: 3645},
+			expr: &actionExpr{
+				pos: position{line: 133, col: 16, offset: 3660},
+				run: (*parser).callonEqualityOp1,
+				expr: &choiceExpr{
+					pos: position{line: 133, col: 16, offset: 3660},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 133, col: 16, offset: 3660},
+							val:        "==",
+							ignoreCase: false,
+							want:       "\"==\"",
+						},
+						&litMatcher{
+							pos:        position{line: 133, col: 23, offset: 3667},
+							val:        "!=",
+							ignoreCase: false,
+							want:       "\"!=\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Relational",
+			pos:  position{line: 137, col: 1, offset: 3710},
+			expr: &actionExpr{
+				pos: position{line: 137, col: 14, offset: 3723},
+				run: (*parser).callonRelational1,
+				expr: &seqExpr{
+					pos: position{line: 137, col: 14, offset: 3723},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 137, col: 14, offset: 3723},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 137, col: 20, offset: 3729},
+								name: "Additive",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 137, col: 29, offset: 3738},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 137, col: 36, offset: 3745},
+								expr: &seqExpr{
+									pos: position{line: 137, col: 36, offset: 3745},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 137, col: 36, offset: 3745},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 137, col: 38, offset: 3747},
+											name: "RelationalOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 137, col: 51, offset: 3760},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 137, col: 53, offset: 3762},
+											name: "Additive",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "RelationalOp",
+			pos:  position{line: 141, col: 1, offset: 3833},
+			expr: &actionExpr{
+				pos: position{line: 141, col: 18, offset: 3850},
+				run: (*parser).callonRelationalOp1,
+				expr: &choiceExpr{
+					pos: position{line: 141, col: 18, offset: 3850},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 141, col: 18, offset: 3850},
+							val:        "<=",
+							ignoreCase: false,
+							want:       "\"<=\"",
+						},
+						&litMatcher{
+							pos:        position{line: 141, col: 25, offset: 3857},
+							val:        ">=",
+							ignoreCase: false,
+							want:       "\">=\"",
+						},
+						&litMatcher{
+							pos:        position{line: 141, col: 32, offset: 3864},
+							val:        "<",
+							ignoreCase: false,
+							want:       "\"<\"",
+						},
+						&litMatcher{
+							pos:        position{line: 141, col: 38, offset: 3870},
+							val:        ">",
+							ignoreCase: false,
+							want:       "\">\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Additive",
+			pos:  position{line: 145, col: 1, offset: 3912},
+			expr: &actionExpr{
+				pos: position{line: 145, col: 12, offset: 3923},
+				run: (*parser).callonAdditive1,
+				expr: &seqExpr{
+					pos: position{line: 145, col: 12, offset: 3923},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 145, col: 12, offset: 3923},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 145, col: 18, offset: 3929},
+								name: "Multiplicative",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 145, col: 33, offset: 3944},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 145, col: 40, offset: 3951},
+								expr: &seqExpr{
+									pos: position{line: 145, col: 40, offset: 3951},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 145, col: 40, offset: 3951},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 145, col: 42, offset: 3953},
+											name: "AdditiveOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 145, col: 53, offset: 3964},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 145, col: 55, offset: 3966},
+											name: "Multiplicative",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "AdditiveOp",
+			pos:  position{line: 149, col: 1, offset: 4043},
+			expr: &actionExpr{
+				pos: position{line: 149, col: 16, offset: 4058},
+				run: (*parser).callonAdditiveOp1,
+				expr: &choiceExpr{
+					pos: position{line: 149, col: 16, offset: 4058},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 149, col: 16, offset: 4058},
+							val:        "+",
+							ignoreCase: false,
+							want:       "\"+\"",
+						},
+						&litMatcher{
+							pos:        position{line: 149, col: 22, offset: 4064},
+							val:        "-",
+							ignoreCase: false,
+							want:       "\"-\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Multiplicative",
+			pos:  position{line: 153, col: 1, offset: 4106},
+			expr: &actionExpr{
+				pos: position{line: 153, col: 18, offset: 4123},
+				run: (*parser).callonMultiplicative1,
+				expr: &seqExpr{
+					pos: position{line: 153, col: 18, offset: 4123},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 153, col: 18, offset: 4123},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 153, col: 24, offset: 4129},
+								name: "Unary",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 153, col: 30, offset: 4135},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 153, col: 37, offset: 4142},
+								expr: &seqExpr{
+									pos: position{line: 153, col: 37, offset: 4142},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 153, col: 37, offset: 4142},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 153, col: 39, offset: 4144},
+											name: "MultiplicativeOp",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 153, col: 56, offset: 4161},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 153, col: 58, offset: 4163},
+											name: "Unary",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "MultiplicativeOp",
+			pos:  position{line: 157, col: 1, offset: 4231},
+			expr: &actionExpr{
+				pos: position{line: 157, col: 22, offset: 4252},
+				run: (*parser).callonMultiplicativeOp1,
+				expr: &choiceExpr{
+					pos: position{line: 157, col: 22, offset: 4252},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 157, col: 22, offset: 4252},
+							val:        "*",
+							ignoreCase: false,
+							want:       "\"*\"",
+						},
+						&litMatcher{
+							pos:        position{line: 157, col: 28, offset: 4258},
+							val:        "/",
+							ignoreCase: false,
+							want:       "\"/\"",
+						},
+						&litMatcher{
+							pos:        position{line: 157, col: 34, offset: 4264},
+							val:        "%",
+							ignoreCase: false,
+							want:       "\"%\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Unary",
+			pos:  position{line: 161, col: 1, offset: 4306},
+			expr: &choiceExpr{
+				pos: position{line: 161, col: 9, offset: 4314},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 161, col: 9, offset: 4314},
+						name: "Cast",
+					},
+					&actionExpr{
+						pos: position{line: 161, col: 16, offset: 4321},
+						run: (*parser).callonUnary3,
+						expr: &seqExpr{
+							pos: position{line: 161, col: 16, offset: 4321},
+							exprs: []any{
+								&labeledExpr{
+									pos:   position{line: 161, col: 16, offset: 4321},
+									label: "op",
+									expr: &ruleRefExpr{
+										pos:  position{line: 161, col: 19, offset: 4324},
+										name: "UnaryOp",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 161, col: 27, offset: 4332},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 161, col: 29, offset: 4334},
+									label: "expr",
+									expr: &ruleRefExpr{
+										pos:  position{line: 161, col: 34, offset: 4339},
+										name: "Unary",
+									},
+								},
+							},
+						},
+					},
+					&ruleRefExpr{
+						pos:  position{line: 174, col: 5, offset: 4608},
+						name: "Postfix",
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "UnaryOp",
+			pos:  position{line: 176, col: 1, offset: 4617},
+			expr: &actionExpr{
+				pos: position{line: 176, col: 13, offset: 4629},
+				run: (*parser).callonUnaryOp1,
+				expr: &choiceExpr{
+					pos: position{line: 176, col: 13, offset: 4629},
+					alternatives: []any{
+						&litMatcher{
+							pos:        position{line: 176, col: 13, offset: 4629},
+							val:        "!",
+							ignoreCase: false,
+							want:       "\"!\"",
+						},
+						&litMatcher{
+							pos:        position{line: 176, col: 19, offset: 4635},
+							val:        "-",
+							ignoreCase: false,
+							want:       "\"-\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Cast",
+			pos:  position{line: 180, col: 1, offset: 4677},
+			expr: &actionExpr{
+				pos: position{line: 180, col: 8, offset: 4684},
+				run: (*parser).callonCast1,
+				expr: &seqExpr{
+					pos: position{line: 180, col: 8, offset: 4684},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 180, col: 8, offset: 4684},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 180, col: 12, offset: 4688},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 180, col: 14, offset: 4690},
+							label: "typeName",
+							expr: &ruleRefExpr{
+								pos:  position{line: 180, col: 23, offset: 4699},
+								name: "Type",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 180, col: 28, offset: 4704},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 180, col: 30, offset: 4706},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 180, col: 34, offset: 4710},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 180, col: 36, offset: 4712},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 180, col: 41, offset: 4717},
+								name: "Unary",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Postfix",
+			pos:  position{line: 190, col: 1, offset: 4909},
+			expr: &actionExpr{
+				pos: position{line: 190, col: 11, offset: 4919},
+				run: (*parser).callonPostfix1,
+				expr: &seqExpr{
+					pos: position{line: 190, col: 11, offset: 4919},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 190, col: 11, offset: 4919},
+							label: "primary",
+							expr: &ruleRefExpr{
+								pos:  position{line: 190, col: 19, offset: 4927},
+								name: "Primary",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 190, col: 27, offset: 4935},
+							label: "selectors",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 190, col: 39, offset: 4947},
+								expr: &seqExpr{
+									pos: position{line: 190, col: 39, offset: 4947},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 190, col: 39, offset: 4947},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 190, col: 41, offset: 4949},
+											name: "Selector",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Selector",
+			pos:  position{line: 194, col: 1, offset: 5012},
+			expr: &choiceExpr{
+				pos: position{line: 194, col: 12, offset: 5023},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 194, col: 12, offset: 5023},
+						name: "MethodCall",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 194, col: 25, offset: 5036},
+						name: "Accessor",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 194, col: 36, offset: 5047},
+						name: "Index",
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "MethodCall",
+			pos:  position{line: 196, col: 1, offset: 5054},
+			expr: &actionExpr{
+				pos: position{line: 196, col: 14, offset: 5067},
+				run: (*parser).callonMethodCall1,
+				expr: &seqExpr{
+					pos: position{line: 196, col: 14, offset: 5067},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 196, col: 14, offset: 5067},
+							val:        ".",
+							ignoreCase: false,
+							want:       "\".\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 196, col: 18, offset: 5071},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 196, col: 20, offset: 5073},
+							label: "method",
+							expr: &ruleRefExpr{
+								pos:  position{line: 196, col: 27, offset: 5080},
+								name: "Identifier",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 196, col: 38, offset: 5091},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 196, col: 40, offset: 5093},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 196, col: 44, offset: 5097},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 196, col: 46, offset: 5099},
+							label: "args",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 196, col: 51, offset: 5104},
+								expr: &ruleRefExpr{
+									pos:  position{line: 196, col: 51, offset: 5104},
+									name: "Arguments",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 196, col: 62, offset: 5115},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 196, col: 64, offset: 5117},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Accessor",
+			pos:  position{line: 211, col: 1, offset: 5394},
+			expr: &actionExpr{
+				pos: position{line: 211, col: 12, offset: 5405},
+				run: (*parser).callonAccessor1,
+				expr: &seqExpr{
+					pos: position{line: 211, col: 12, offset: 5405},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 211, col: 12, offset: 5405},
+							val:        ".",
+							ignoreCase: false,
+							want:       "\".\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 211, col: 16, offset: 5409},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 211, col: 18, offset: 5411},
+							label: "field",
+							expr: &ruleRefExpr{
+								pos:  position{line: 211, col: 24, offset: 5417},
+								name: "Identifier",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Index",
+			pos:  position{line: 221, col: 1, offset: 5602},
+			expr: &actionExpr{
+				pos: position{line: 221, col: 9, offset: 5610},
+				run: (*parser).callonIndex1,
+				expr: &seqExpr{
+					pos: position{line: 221, col: 9, offset: 5610},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 221, col: 9, offset: 5610},
+							val:        "[",
+							ignoreCase: false,
+							want:       "\"[\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 221, col: 13, offset: 5614},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 221, col: 15, offset: 5616},
+							label: "index",
+							expr: &ruleRefExpr{
+								pos:  position{line: 221, col: 21, offset: 5622},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 221, col: 26, offset: 5627},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 221, col: 28, offset: 5629},
+							val:        "]",
+							ignoreCase: false,
+							want:       "\"]\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Arguments",
+			pos:  position{line: 231, col: 1, offset: 5799},
+			expr: &actionExpr{
+				pos: position{line: 231, col: 13, offset: 5811},
+				run: (*parser).callonArguments1,
+				expr: &seqExpr{
+					pos: position{line: 231, col: 13, offset: 5811},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 231, col: 13, offset: 5811},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 231, col: 19, offset: 5817},
+								name: "Expr",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 231, col: 24, offset: 5822},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 231, col: 31, offset: 5829},
+								expr: &seqExpr{
+									pos: position{line: 231, col: 31, offset: 5829},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 231, col: 31, offset: 5829},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 231, col: 33, offset: 5831},
+											val:        ",",
+											ignoreCase: false,
+											want:       "\",\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 231, col: 37, offset: 5835},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 231, col: 39, offset: 5837},
+											name: "Expr",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Primary",
+			pos:  position{line: 235, col: 1, offset: 5887},
+			expr: &choiceExpr{
+				pos: position{line: 235, col: 11, offset: 5897},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 11, offset: 5897},
+						name: "Emit",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 18, offset: 5904},
+						name: "UrlEncoder",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 31, offset: 5917},
+						name: "Doc",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 37, offset: 5923},
+						name: "New",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 43, offset: 5929},
+						name: "Number",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 52, offset: 5938},
+						name: "String",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 61, offset: 5947},
+						name: "Boolean",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 71, offset: 5957},
+						name: "Null",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 78, offset: 5964},
+						name: "MapLiteral",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 91, offset: 5977},
+						name: "ListLiteral",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 105, offset: 5991},
+						name: "Paren",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 235, col: 113, offset: 5999},
+						name: "Variable",
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Emit",
+			pos:  position{line: 237, col: 1, offset: 6009},
+			expr: &actionExpr{
+				pos: position{line: 237, col: 8, offset: 6016},
+				run: (*parser).callonEmit1,
+				expr: &seqExpr{
+					pos: position{line: 237, col: 8, offset: 6016},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 237, col: 8, offset: 6016},
+							val:        "emit",
+							ignoreCase: false,
+							want:       "\"emit\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 237, col: 15, offset: 6023},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 237, col: 17, offset: 6025},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 237, col: 21, offset: 6029},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 237, col: 23, offset: 6031},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 237, col: 28, offset: 6036},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 237, col: 33, offset: 6041},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 237, col: 35, offset: 6043},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Doc",
+			pos:  position{line: 247, col: 1, offset: 6182},
+			expr: &actionExpr{
+				pos: position{line: 247, col: 7, offset: 6188},
+				run: (*parser).callonDoc1,
+				expr: &seqExpr{
+					pos: position{line: 247, col: 7, offset: 6188},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 247, col: 7, offset: 6188},
+							val:        "doc",
+							ignoreCase: false,
+							want:       "\"doc\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 247, col: 13, offset: 6194},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 247, col: 15, offset: 6196},
+							val:        "[",
+							ignoreCase: false,
+							want:       "\"[\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 247, col: 19, offset: 6200},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 247, col: 21, offset: 6202},
+							label: "key",
+							expr: &ruleRefExpr{
+								pos:  position{line: 247, col: 25, offset: 6206},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 247, col: 30, offset: 6211},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 247, col: 32, offset: 6213},
+							val:        "]",
+							ignoreCase: false,
+							want:       "\"]\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "New",
+			pos:  position{line: 257, col: 1, offset: 6355},
+			expr: &actionExpr{
+				pos: position{line: 257, col: 7, offset: 6361},
+				run: (*parser).callonNew1,
+				expr: &seqExpr{
+					pos: position{line: 257, col: 7, offset: 6361},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 257, col: 7, offset: 6361},
+							val:        "new",
+							ignoreCase: false,
+							want:       "\"new\"",
+						},
+						&notExpr{
+							pos: position{line: 257, col: 13, offset: 6367},
+							expr: &ruleRefExpr{
+								pos:  position{line: 257, col: 14, offset: 6368},
+								name: "IdentifierChar",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 257, col: 29, offset: 6383},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 257, col: 31, offset: 6385},
+							label: "class",
+							expr: &ruleRefExpr{
+								pos:  position{line: 257, col: 37, offset: 6391},
+								name: "Identifier",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 257, col: 48, offset: 6402},
+							name: "_",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 257, col: 52, offset: 6406},
+							expr: &seqExpr{
+								pos: position{line: 257, col: 52, offset: 6406},
+								exprs: []any{
+									&litMatcher{
+										pos:        position{line: 257, col: 52, offset: 6406},
+										val:        "<",
+										ignoreCase: false,
+										want:       "\"<\"",
+									},
+									&zeroOrMoreExpr{
+										pos: position{line: 257, col: 56, offset: 6410},
+										expr: &charClassMatcher{
+											pos:        position{line: 257, col: 56, offset: 6410},
+											val:        "[^>]",
+											chars:      []rune{'>'},
+											ignoreCase: false,
+											inverted:   true,
+										},
+									},
+									&oneOrMoreExpr{
+										pos: position{line: 257, col: 62, offset: 6416},
+										expr: &litMatcher{
+											pos:        position{line: 257, col: 62, offset: 6416},
+											val:        ">",
+											ignoreCase: false,
+											want:       "\">\"",
+										},
+									},
+									&ruleRefExpr{
+										pos:  position{line: 257, col: 67, offset: 6421},
+										name: "_",
+									},
+								},
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 257, col: 72, offset: 6426},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 257, col: 76, offset: 6430},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 257, col: 78, offset: 6432},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "ListLiteral",
+			pos:  position{line: 261, col: 1, offset: 6515},
+			expr: &actionExpr{
+				pos: position{line: 261, col: 15, offset: 6529},
+				run: (*parser).callonListLiteral1,
+				expr: &seqExpr{
+					pos: position{line: 261, col: 15, offset: 6529},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 261, col: 15, offset: 6529},
+							val:        "[",
+							ignoreCase: false,
+							want:       "\"[\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 261, col: 19, offset: 6533},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 261, col: 21, offset: 6535},
+							label: "elements",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 261, col: 30, offset: 6544},
+								expr: &ruleRefExpr{
+									pos:  position{line: 261, col: 30, offset: 6544},
+									name: "Arguments",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 261, col: 41, offset: 6555},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 261, col: 43, offset: 6557},
+							val:        "]",
+							ignoreCase: false,
+							want:       "\"]\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "MapLiteral",
+			pos:  position{line: 271, col: 1, offset: 6715},
+			expr: &choiceExpr{
+				pos: position{line: 271, col: 14, offset: 6728},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 271, col: 14, offset: 6728},
+						run: (*parser).callonMapLiteral2,
+						expr: &seqExpr{
+							pos: position{line: 271, col: 14, offset: 6728},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 271, col: 14, offset: 6728},
+									val:        "[",
+									ignoreCase: false,
+									want:       "\"[\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 271, col: 18, offset: 6732},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 271, col: 20, offset: 6734},
+									val:        ":",
+									ignoreCase: false,
+									want:       "\":\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 271, col: 24, offset: 6738},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 271, col: 26, offset: 6740},
+									val:        "]",
+									ignoreCase: false,
+									want:       "\"]\"",
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 273, col: 5, offset: 6777},
+						run: (*parser).callonMapLiteral9,
+						expr: &seqExpr{
+							pos: position{line: 273, col: 5, offset: 6777},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 273, col: 5, offset: 6777},
+									val:        "[",
+									ignoreCase: false,
+									want:       "\"[\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 273, col: 9, offset: 6781},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 273, col: 11, offset: 6783},
+									label: "first",
+									expr: &ruleRefExpr{
+										pos:  position{line: 273, col: 17, offset: 6789},
+										name: "MapEntry",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 273, col: 26, offset: 6798},
+									label: "rest",
+									expr: &zeroOrMoreExpr{
+										pos: position{line: 273, col: 33, offset: 6805},
+										expr: &seqExpr{
+											pos: position{line: 273, col: 33, offset: 6805},
+											exprs: []any{
+												&ruleRefExpr{
+													pos:  position{line: 273, col: 33, offset: 6805},
+													name: "_",
+												},
+												&litMatcher{
+													pos:        position{line: 273, col: 35, offset: 6807},
+													val:        ",",
+													ignoreCase: false,
+													want:       "\",\"",
+												},
+												&ruleRefExpr{
+													pos:  position{line: 273, col: 39, offset: 6811},
+													name: "_",
+												},
+												&ruleRefExpr{
+													pos:  position{line: 273, col: 41, offset: 6813},
+													name: "MapEntry",
+												},
+											},
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 273, col: 53, offset: 6825},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 273, col: 55, offset: 6827},
+									val:        "]",
+									ignoreCase: false,
+									want:       "\"]\"",
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "MapEntry",
+			pos:  position{line: 277, col: 1, offset: 6867},
+			expr: &actionExpr{
+				pos: position{line: 277, col: 12, offset: 6878},
+				run: (*parser).callonMapEntry1,
+				expr: &seqExpr{
+					pos: position{line: 277, col: 12, offset: 6878},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 277, col: 12, offset: 6878},
+							label: "key",
+							expr: &ruleRefExpr{
+								pos:  position{line: 277, col: 16, offset: 6882},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 277, col: 21, offset: 6887},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 277, col: 23, offset: 6889},
+							val:        ":",
+							ignoreCase: false,
+							want:       "\":\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 277, col: 27, offset: 6893},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 277, col: 29, offset: 6895},
+							label: "value",
+							expr: &ruleRefExpr{
+								pos:  position{line: 277, col: 35, offset: 6901},
+								name: "Expr",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Number",
+			pos:  position{line: 281, col: 1, offset: 6945},
+			expr: &actionExpr{
+				pos: position{line: 281, col: 10, offset: 6954},
+				run: (*parser).callonNumber1,
+				expr: &seqExpr{
+					pos: position{line: 281, col: 10, offset: 6954},
+					exprs: []any{
+						&oneOrMoreExpr{
+							pos: position{line: 281, col: 10, offset: 6954},
+							expr: &charClassMatcher{
+								pos:        position{line: 281, col: 10, offset: 6954},
+								val:        "[0-9]",
+								ranges:     []rune{'0', '9'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 281, col: 19, offset: 6963},
+							expr: &seqExpr{
+								pos: position{line: 281, col: 19, offset: 6963},
+								exprs: []any{
+									&litMatcher{
+										pos:        position{line: 281, col: 19, offset: 6963},
+										val:        ".",
+										ignoreCase: false,
+										want:       "\".\"",
+									},
+									&oneOrMoreExpr{
+										pos: position{line: 281, col: 23, offset: 6967},
+										expr: &charClassMatcher{
+											pos:        position{line: 281, col: 23, offset: 6967},
+											val:        "[0-9]",
+											ranges:     []rune{'0', '9'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+								},
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 281, col: 35, offset: 6979},
+							expr: &seqExpr{
+								pos: position{line: 281, col: 35, offset: 6979},
+								exprs: []any{
+									&charClassMatcher{
+										pos:        position{line: 281, col: 35, offset: 6979},
+										val:        "[eE]",
+										chars:      []rune{'e', 'E'},
+										ignoreCase: false,
+										inverted:   false,
+									},
+									&zeroOrOneExpr{
+										pos: position{line: 281, col: 40, offset: 6984},
+										expr: &charClassMatcher{
+											pos:        position{line: 281, col: 40, offset: 6984},
+											val:        "[+-]",
+											chars:      []rune{'+', '-'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+									&oneOrMoreExpr{
+										pos: position{line: 281, col: 46, offset: 6990},
+										expr: &charClassMatcher{
+											pos:        position{line: 281, col: 46, offset: 6990},
+											val:        "[0-9]",
+											ranges:     []rune{'0', '9'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+								},
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 281, col: 56, offset: 7000},
+							expr: &charClassMatcher{
+								pos:        position{line: 281, col: 56, offset: 7000},
+								val:        "[lLfFdD]",
+								chars:      []rune{'l', 'L', 'f', 'F', 'd', 'D'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+						},
+						&notExpr{
+							pos: position{line: 281, col: 66, offset: 7010},
+							expr: &ruleRefExpr{
+								pos:  position{line: 281, col: 67, offset: 7011},
+								name: "IdentifierChar",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "String",
+			pos:  position{line: 285, col: 1, offset: 7070},
+			expr: &actionExpr{
+				pos: position{line: 285, col: 12, offset: 7081},
+				run: (*parser).callonString1,
+				expr: &choiceExpr{
+					pos: position{line: 285, col: 12, offset: 7081},
+					alternatives: []any{
+						&seqExpr{
+							pos: position{line: 285, col: 12, offset: 7081},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 285, col: 12, offset: 7081},
+									val:        "'",
+									ignoreCase: false,
+									want:       "\"'\"",
+								},
+								&zeroOrMoreExpr{
+									pos: position{line: 285, col: 19, offset: 7088},
+									expr: &choiceExpr{
+										pos: position{line: 285, col: 19, offset: 7088},
+										alternatives: []any{
+											&seqExpr{
+												pos: position{line: 285, col: 19, offset: 7088},
+												exprs: []any{
+													&litMatcher{
+														pos:        position{line: 285, col: 19, offset: 7088},
+														val:        "\\",
+														ignoreCase: false,
+														want:       "\"\\\\\"",
+													},
+													&anyMatcher{
+														line: 285, col: 24, offset: 7093,
+													},
+												},
+											},
+											&charClassMatcher{
+												pos:        position{line: 285, col: 28, offset: 7097},
+												val:        "[^'\\\\]",
+												chars:      []rune{'\'', '\\'},
+												ignoreCase: false,
+												inverted:   true,
+											},
+										},
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 285, col: 38, offset: 7107},
+									val:        "'",
+									ignoreCase: false,
+									want:       "\"'\"",
+								},
+							},
+						},
+						&seqExpr{
+							pos: position{line: 285, col: 45, offset: 7114},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 285, col: 45, offset: 7114},
+									val:        "\"",
+									ignoreCase: false,
+									want:       "\"\\\"\"",
+								},
+								&zeroOrMoreExpr{
+									pos: position{line: 285, col: 51, offset: 7120},
+									expr: &choiceExpr{
+										pos: position{line: 285, col: 51, offset: 7120},
+										alternatives: []any{
+											&seqExpr{
+												pos: position{line: 285, col: 51, offset: 7120},
+												exprs: []any{
+													&litMatcher{
+														pos:        position{line: 285, col: 51, offset: 7120},
+														val:        "\\",
+														ignoreCase: false,
+														want:       "\"\\\\\"",
+													},
+													&anyMatcher{
+														line: 285, col: 56, offset: 7125,
+													},
+												},
+											},
+											&charClassMatcher{
+												pos:        position{line: 285, col: 60, offset: 7129},
+												val:        "[^\"\\\\]",
+												chars:      []rune{'"', '\\'},
+												ignoreCase: false,
+												inverted:   true,
+											},
+										},
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 285, col: 70, offset: 7139},
+									val:        "\"",
+									ignoreCase: false,
+									want:       "\"\\\"\"",
+								},
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Boolean",
+			pos:  position{line: 289, col: 1, offset: 7191},
+			expr: &actionExpr{
+				pos: position{line: 289, col: 13, offset: 7203},
+				run: (*parser).callonBoolean1,
+				expr: &seqExpr{
+					pos: position{line: 289, col: 13, offset: 7203},
+					exprs: []any{
+						&choiceExpr{
+							pos: position{line: 289, col: 13, offset: 7203},
+							alternatives: []any{
+								&litMatcher{
+									pos:        position{line: 289, col: 13, offset: 7203},
+									val:        "true",
+									ignoreCase: false,
+									want:       "\"true\"",
+								},
+								&litMatcher{
+									pos:        position{line: 289, col: 22, offset: 7212},
+									val:        "false",
+									ignoreCase: false,
+									want:       "\"false\"",
+								},
+							},
+						},
+						&notExpr{
+							pos: position{line: 289, col: 32, offset: 7222},
+							expr: &ruleRefExpr{
+								pos:  position{line: 289, col: 33, offset: 7223},
+								name: "IdentifierChar",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Null",
+			pos:  position{line: 293, col: 1, offset: 7305},
+			expr: &actionExpr{
+				pos: position{line: 293, col: 8, offset: 7312},
+				run: (*parser).callonNull1,
+				expr: &seqExpr{
+					pos: position{line: 293, col: 8, offset: 7312},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 293, col: 8, offset: 7312},
+							val:        "null",
+							ignoreCase: false,
+							want:       "\"null\"",
+						},
+						&notExpr{
+							pos: position{line: 293, col: 15, offset: 7319},
+							expr: &ruleRefExpr{
+								pos:  position{line: 293, col: 16, offset: 7320},
+								name: "IdentifierChar",
+							},
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Paren",
+			pos:  position{line: 297, col: 1, offset: 7381},
+			expr: &actionExpr{
+				pos: position{line: 297, col: 9, offset: 7389},
+				run: (*parser).callonParen1,
+				expr: &seqExpr{
+					pos: position{line: 297, col: 9, offset: 7389},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 297, col: 9, offset: 7389},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 297, col: 13, offset: 7393},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 297, col: 15, offset: 7395},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 297, col: 20, offset: 7400},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 297, col: 25, offset: 7405},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 297, col: 27, offset: 7407},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Variable",
+			pos:  position{line: 301, col: 1, offset: 7437},
+			expr: &actionExpr{
+				pos: position{line: 301, col: 12, offset: 7448},
+				run: (*parser).callonVariable1,
+				expr: &labeledExpr{
+					pos:   position{line: 301, col: 12, offset: 7448},
+					label: "name",
+					expr: &ruleRefExpr{
+						pos:  position{line: 301, col: 17, offset: 7453},
+						name: "Identifier",
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "Identifier",
+			pos:  position{line: 311, col: 1, offset: 7629},
+			expr: &actionExpr{
+				pos: position{line: 311, col: 14, offset: 7642},
+				run: (*parser).callonIdentifier1,
+				expr: &labeledExpr{
+					pos:   position{line: 311, col: 14, offset: 7642},
+					label: "id",
+					expr: &oneOrMoreExpr{
+						pos: position{line: 311, col: 17, offset: 7645},
+						expr: &charClassMatcher{
+							pos:        position{line: 311, col: 17, offset: 7645},
+							val:        "[a-zA-Z0-9_]",
+							chars:      []rune{'_'},
+							ranges:     []rune{'a', 'z', 'A', 'Z', '0', '9'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+					},
+				},
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "IdentifierChar",
+			pos:  position{line: 315, col: 1, offset: 7694},
+			expr: &charClassMatcher{
+				pos:        position{line: 315, col: 18, offset: 7711},
+				val:        "[a-zA-Z0-9_]",
+				chars:      []rune{'_'},
+				ranges:     []rune{'a', 'z', 'A', 'Z', '0', '9'},
+				ignoreCase: false,
+				inverted:   false,
+			},
+			leader:        false,
+			leftRecursive: false,
+		},
+		{
+			name: "UrlEncoder",
+			pos:  position{line: 317, col: 1, offset: 7725},
+			expr: &actionExpr{
+				pos: position{line: 317, col: 14, offset: 7738},
+				run: (*parser).callonUrlEncoder1,
+				expr: &seqExpr{
+					pos: position{line: 317, col: 14, offset: 7738},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 317, col: 14, offset: 7738},
+							val:        "URLEncoder.encode",
+							ignoreCase: false,
+							want:       "\"URLEncoder.encode\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 317, col: 34, offset: 7758},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 317, col: 36, offset: 7760},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 317, col: 40, offset: 7764},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 317, col: 42, offset: 7766},
+							label: "expr",
+							expr: &ruleRefExpr{
+								pos:  position{line: 317, col: 47, offset: 7771},
+								name: "Expr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 317, col: 52, offset: 7776},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 317, col: 54, offset: 7778},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+					},
+				},
 			},
 			leader:        false,
 			leftRecursive: false,
@@ -465,15 +2946,41 @@ var g = &grammar{
 		{
 			name:        "_",
 			displayName: "\"whitespace\"",
-			pos:         position{line: 135, col: 1, offset: 2766},
+			pos:         position{line: 327, col: 1, offset: 7922},
 			expr: &zeroOrMoreExpr{
-				pos: position{line: 135, col: 19, offset: 2784},
-				expr: &charClassMatcher{
-					pos:        position{line: 135, col: 19, offset: 2784},
-					val:        "[ \\n\\t\\r]",
-					chars:      []rune{' ', '\n', '\t', '\r'},
-					ignoreCase: false,
-					inverted:   false,
+				pos: position{line: 327, col: 21, offset: 7942},
+				expr: &choiceExpr{
+					pos: position{line: 327, col: 21, offset: 7942},
+					alternatives: []any{
+						&charClassMatcher{
+							pos:        position{line: 327, col: 21, offset: 7942},
+							val:        "[ \\n\\t\\r]",
+							chars:      []rune{' ', '\n', '\t', '\r'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+						&seqExpr{
+							pos: position{line: 327, col: 33, offset: 7954},
+							exprs: []any{
+								&litMatcher{
+									pos:        position{line: 327, col: 33, offset: 7954},
+									val:        "//",
+									ignoreCase: false,
+									want:       "\"//\"",
+								},
+								&zeroOrMoreExpr{
+									pos: position{line: 327, col: 38, offset: 7959},
+									expr: &charClassMatcher{
+										pos:        position{line: 327, col: 38, offset: 7959},
+										val:        "[^\\n]",
+										chars:      []rune{'\n'},
+										ignoreCase: false,
+										inverted:   true,
+									},
+								},
+							},
+						},
+					},
 				},
 			},
 			leader:        false,
@@ -481,11 +2988,11 @@ var g = &grammar{
 		},
 		{
 			name: "EOF",
-			pos:  position{line: 137, col: 1, offset: 2796},
+			pos:  position{line: 329, col: 1, offset: 7970},
 			expr: &notExpr{
-				pos: position{line: 138, col: 5, offset: 2805},
+				pos: position{line: 330, col: 5, offset: 7978},
 				expr: &anyMatcher{
-					line: 138, col: 6, offset: 2806,
+					line: 330, col: 6, offset: 7979,
 				},
 			},
 			leader:        false,
@@ -494,164 +3001,607 @@ var g = &grammar{
 	},
 }
 
-func (c *current) onExpr14(expr any) (any, error) {
+func (c *current) onScript1(statements any) (any, error) {
+	return newStatements(statements)
+}
+
+func (p *parser) callonScript1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onScript1(stack["statements"])
+}
+
+func (c *current) onStatement1(stmt any) (any, error) {
+	return stmt, nil
+}
+
+func (p *parser) callonStatement1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onStatement1(stack["stmt"])
+}
+
+func (c *current) onIf1(cond, then, otherwise any) (any, error) {
+
+	condVal, err := ExpectExpr(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	thenVal, err := ExpectExpr(then)
+	if err != nil {
+		return nil, err
+	}
+
+	var elseVal Expr
+	if otherwise != nil {
+		elseVal, err = ExpectExpr(otherwise)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ConditionalExpr{Cond: condVal, Then: thenVal, Else: elseVal}, nil
+}
+
+func (p *parser) callonIf1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onIf1(stack["cond"], stack["then"], stack["otherwise"])
+}
+
+func (c *current) onElse1(body any) (any, error) {
+	return body, nil
+}
+
+func (p *parser) callonElse1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onElse1(stack["body"])
+}
+
+func (c *current) onFor2(name, iterable, body any) (any, error) {
+	return newForEach(c.pos.String(), name, iterable, body)
+}
+
+func (p *parser) callonFor2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onFor2(stack["name"], stack["iterable"], stack["body"])
+}
+
+func (c *current) onFor29(init, cond, update, body any) (any, error) {
+	return newFor(c.pos.String(), init, cond, update, body)
+}
+
+func (p *parser) callonFor29() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onFor29(stack["init"], stack["cond"], stack["update"], stack["body"])
+}
+
+func (c *current) onWhile1(cond, body any) (any, error) {
+	return newFor(c.pos.String(), nil, cond, nil, body)
+}
+
+func (p *parser) callonWhile1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onWhile1(stack["cond"], stack["body"])
+}
+
+func (c *current) onBlock1(statements any) (any, error) {
+	return newStatements(statements)
+}
+
+func (p *parser) callonBlock1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onBlock1(stack["statements"])
+}
+
+func (c *current) onReturn1(expr any) (any, error) {
+
+	var exprVal Expr
+	if expr != nil {
+		var err error
+		exprVal, err = ExpectExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ReturnExpr{Expr: exprVal}, nil
+}
+
+func (p *parser) callonReturn1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onReturn1(stack["expr"])
+}
+
+func (c *current) onDeclaration2(assignment any) (any, error) {
+	return assignment, nil
+}
+
+func (p *parser) callonDeclaration2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onDeclaration2(stack["assignment"])
+}
+
+func (c *current) onDeclaration8(name any) (any, error) {
+	return newAssignment(c.pos.String(), &VariableExpr{Position: c.pos.String(), Name: name.(string)}, "=", &LiteralExpr{Value: nil})
+}
+
+func (p *parser) callonDeclaration8() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onDeclaration8(stack["name"])
+}
+
+func (c *current) onType1() (any, error) {
+	return strings.TrimSpace(strings.SplitN(string(c.text), "<", 2)[0]), nil
+}
+
+func (p *parser) callonType1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onType1()
+}
+
+func (c *current) onAssignment1(target, op, expr any) (any, error) {
+	return newAssignment(c.pos.String(), target, op, expr)
+}
+
+func (p *parser) callonAssignment1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onAssignment1(stack["target"], stack["op"], stack["expr"])
+}
+
+func (c *current) onAssignmentOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonAssignmentOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onAssignmentOp1()
+}
+
+func (c *current) onIncrement1(target, op any) (any, error) {
+	return newAssignment(c.pos.String(), target, op, &LiteralExpr{Value: int64(1)})
+}
+
+func (p *parser) callonIncrement1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onIncrement1(stack["target"], stack["op"])
+}
+
+func (c *current) onIncrementOp1() (any, error) {
+	return string(c.text)[:1] + "=", nil
+}
+
+func (p *parser) callonIncrementOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onIncrementOp1()
+}
+
+func (c *current) onExprStatement1(expr any) (any, error) {
 	return expr, nil
 }
 
-func (p *parser) callonExpr14() (any, error) {
+func (p *parser) callonExprStatement1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onExpr14(stack["expr"])
+	return p.cur.onExprStatement1(stack["expr"])
 }
 
-func (c *current) onEmit1(expr any) (any, error) {
+func (c *current) onConditional1(cond, branches any) (any, error) {
+	return newConditional(cond, branches)
+}
 
-	exprVal, err := ExpectExpr(expr)
-	if err != nil {
-		return nil, err
-	}
+func (p *parser) callonConditional1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onConditional1(stack["cond"], stack["branches"])
+}
 
-	return &EmitExpr{Expr: exprVal}, nil
+func (c *current) onOr1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
 }
 
-func (p *parser) callonEmit1() (any, error) {
+func (p *parser) callonOr1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onEmit1(stack["expr"])
+	return p.cur.onOr1(stack["first"], stack["rest"])
 }
 
-func (c *current) onDoc1(key any) (any, error) {
+func (c *current) onOrOp1() (any, error) {
+	return string(c.text), nil
+}
 
-	exprVal, err := ExpectExpr(key)
-	if err != nil {
-		return nil, err
-	}
+func (p *parser) callonOrOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onOrOp1()
+}
 
-	return &DocExpr{FieldName: exprVal}, nil
+func (c *current) onAnd1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
 }
 
-func (p *parser) callonDoc1() (any, error) {
+func (p *parser) callonAnd1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onDoc1(stack["key"])
+	return p.cur.onAnd1(stack["first"], stack["rest"])
 }
 
-func (c *current) onAccessor1(expr, field any) (any, error) {
+func (c *current) onAndOp1() (any, error) {
+	return string(c.text), nil
+}
 
-	exprVal, err := ExpectExpr(expr)
+func (p *parser) callonAndOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onAndOp1()
+}
+
+func (c *current) onEquality1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
+}
+
+func (p *parser) callonEquality1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onEquality1(stack["first"], stack["rest"])
+}
+
+func (c *current) onEqualityOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonEqualityOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onEqualityOp1()
+}
+
+func (c *current) onRelational1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
+}
+
+func (p *parser) callonRelational1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRelational1(stack["first"], stack["rest"])
+}
+
+func (c *current) onRelationalOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonRelationalOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRelationalOp1()
+}
+
+func (c *current) onAdditive1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
+}
+
+func (p *parser) callonAdditive1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onAdditive1(stack["first"], stack["rest"])
+}
+
+func (c *current) onAdditiveOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonAdditiveOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onAdditiveOp1()
+}
+
+func (c *current) onMultiplicative1(first, rest any) (any, error) {
+	return newInfixChain(c.pos.String(), first, rest)
+}
+
+func (p *parser) callonMultiplicative1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMultiplicative1(stack["first"], stack["rest"])
+}
+
+func (c *current) onMultiplicativeOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonMultiplicativeOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMultiplicativeOp1()
+}
+
+func (c *current) onUnary3(op, expr any) (any, error) {
+
+	opVal, err := ExpectString(op)
 	if err != nil {
 		return nil, err
 	}
 
-	strVal, err := ExpectString(field)
+	exprVal, err := ExpectExpr(expr)
 	if err != nil {
 		return nil, err
 	}
 
-	return &AccessorExpr{Position: c.pos.String(), Expr: exprVal, PropertyName: strVal}, nil
+	return &PrefixOpExpr{Position: c.pos.String(), Op: opVal, Expr: exprVal}, nil
 }
 
-func (p *parser) callonAccessor1() (any, error) {
+func (p *parser) callonUnary3() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onUnary3(stack["op"], stack["expr"])
+}
+
+func (c *current) onUnaryOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonUnaryOp1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onAccessor1(stack["expr"], stack["field"])
+	return p.cur.onUnaryOp1()
 }
 
-func (c *current) onMethodCall1(expr, method, args any) (any, error) {
+func (c *current) onCast1(typeName, expr any) (any, error) {
 
 	exprVal, err := ExpectExpr(expr)
 	if err != nil {
 		return nil, err
 	}
 
+	return &CastExpr{Position: c.pos.String(), Type: typeName.(string), Expr: exprVal}, nil
+}
+
+func (p *parser) callonCast1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onCast1(stack["typeName"], stack["expr"])
+}
+
+func (c *current) onPostfix1(primary, selectors any) (any, error) {
+	return applySelectors(primary, selectors)
+}
+
+func (p *parser) callonPostfix1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPostfix1(stack["primary"], stack["selectors"])
+}
+
+func (c *current) onMethodCall1(method, args any) (any, error) {
+
 	strVal, err := ExpectString(method)
 	if err != nil {
 		return nil, err
 	}
 
 	var argsVal []Expr
+	if args != nil {
+		argsVal = args.([]Expr)
+	}
 
-	switch argsVals := args.(type) {
-
-	case nil:
-		argsVal = []Expr{}
-	case []any:
+	return &MethodCallExpr{Position: c.pos.String(), MethodName: strVal, Args: argsVal}, nil
+}
 
-		for _, arg := range argsVals {
-			argVal, err := ExpectExpr(arg)
-			if err != nil {
-				return nil, err
-			}
-			argsVal = append(argsVal, argVal)
-		}
+func (p *parser) callonMethodCall1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMethodCall1(stack["method"], stack["args"])
+}
 
-	default:
-		return nil, fmt.Errorf("internal parser error. '%T' is not valid method argument", args)
-	}
+func (c *current) onAccessor1(field any) (any, error) {
 
-	for _, arg := range argsVal {
-		argVal, err := ExpectExpr(arg)
-		if err != nil {
-			return nil, err
-		}
-		argsVal = append(argsVal, argVal)
+	strVal, err := ExpectString(field)
+	if err != nil {
+		return nil, err
 	}
 
-	return &MethodCallExpr{Position: c.pos.String(), Expr: exprVal, MethodName: strVal, Args: argsVal}, nil
+	return &AccessorExpr{Position: c.pos.String(), PropertyName: strVal}, nil
 }
 
-func (p *parser) callonMethodCall1() (any, error) {
+func (p *parser) callonAccessor1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onMethodCall1(stack["expr"], stack["method"], stack["args"])
+	return p.cur.onAccessor1(stack["field"])
 }
 
-func (c *current) onOpExpr1(left, op, right any) (any, error) {
-	leftVal, err := ExpectExpr(left)
+func (c *current) onIndex1(index any) (any, error) {
+
+	indexVal, err := ExpectExpr(index)
 	if err != nil {
 		return nil, err
 	}
 
-	rightVal, err := ExpectExpr(right)
+	return &IndexExpr{Position: c.pos.String(), Index: indexVal}, nil
+}
+
+func (p *parser) callonIndex1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onIndex1(stack["index"])
+}
+
+func (c *current) onArguments1(first, rest any) (any, error) {
+	return newArguments(first, rest)
+}
+
+func (p *parser) callonArguments1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onArguments1(stack["first"], stack["rest"])
+}
+
+func (c *current) onEmit1(expr any) (any, error) {
+
+	exprVal, err := ExpectExpr(expr)
 	if err != nil {
 		return nil, err
 	}
 
-	opVal, err := ExpectString(op)
+	return &EmitExpr{Expr: exprVal}, nil
+}
+
+func (p *parser) callonEmit1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onEmit1(stack["expr"])
+}
+
+func (c *current) onDoc1(key any) (any, error) {
+
+	exprVal, err := ExpectExpr(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &InfixOpExpr{Position: c.pos.String(), Left: leftVal, Op: opVal, Right: rightVal}, nil
+	return &DocExpr{FieldName: exprVal}, nil
+}
+
+func (p *parser) callonDoc1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onDoc1(stack["key"])
+}
+
+func (c *current) onNew1(class any) (any, error) {
+	return &NewExpr{Position: c.pos.String(), Class: class.(string)}, nil
+}
+
+func (p *parser) callonNew1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onNew1(stack["class"])
+}
+
+func (c *current) onListLiteral1(elements any) (any, error) {
+
+	var elementsVal []Expr
+	if elements != nil {
+		elementsVal = elements.([]Expr)
+	}
+
+	return &ListExpr{Elements: elementsVal}, nil
 }
 
-func (p *parser) callonOpExpr1() (any, error) {
+func (p *parser) callonListLiteral1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onOpExpr1(stack["left"], stack["op"], stack["right"])
+	return p.cur.onListLiteral1(stack["elements"])
 }
 
-func (c *current) onOp1(op any) (any, error) {
-	return string(c.text), nil
+func (c *current) onMapLiteral2() (any, error) {
+	return &MapExpr{}, nil
+}
+
+func (p *parser) callonMapLiteral2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMapLiteral2()
+}
+
+func (c *current) onMapLiteral9(first, rest any) (any, error) {
+	return newMap(first, rest)
+}
+
+func (p *parser) callonMapLiteral9() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMapLiteral9(stack["first"], stack["rest"])
+}
+
+func (c *current) onMapEntry1(key, value any) (any, error) {
+	return []any{key, value}, nil
 }
 
-func (p *parser) callonOp1() (any, error) {
+func (p *parser) callonMapEntry1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onOp1(stack["op"])
+	return p.cur.onMapEntry1(stack["key"], stack["value"])
+}
+
+func (c *current) onNumber1() (any, error) {
+	return parseNumber(string(c.text))
 }
 
-func (c *current) onString1(s any) (any, error) {
+func (p *parser) callonNumber1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onNumber1()
+}
 
-	strVal := string(c.text)
-	strVal = strings.Trim(strVal, "'")
-	return &LiteralExpr{Value: strVal}, nil
+func (c *current) onString1() (any, error) {
+	return unquoteString(string(c.text))
 }
 
 func (p *parser) callonString1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onString1(stack["s"])
+	return p.cur.onString1()
+}
+
+func (c *current) onBoolean1() (any, error) {
+	return &LiteralExpr{Value: string(c.text) == "true"}, nil
+}
+
+func (p *parser) callonBoolean1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onBoolean1()
+}
+
+func (c *current) onNull1() (any, error) {
+	return &LiteralExpr{Value: nil}, nil
+}
+
+func (p *parser) callonNull1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onNull1()
+}
+
+func (c *current) onParen1(expr any) (any, error) {
+	return expr, nil
+}
+
+func (p *parser) callonParen1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onParen1(stack["expr"])
+}
+
+func (c *current) onVariable1(name any) (any, error) {
+
+	strVal, err := ExpectString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VariableExpr{Position: c.pos.String(), Name: strVal}, nil
+}
+
+func (p *parser) callonVariable1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onVariable1(stack["name"])
 }
 
 func (c *current) onIdentifier1(id any) (any, error) {
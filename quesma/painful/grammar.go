@@ -0,0 +1,278 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Helpers used by the actions of painless.peg
+
+// newStatements returns a single statement as is, or StatementsExpr for a list of them
+func newStatements(statements any) (Expr, error) {
+	var result []Expr
+	if statementsList, ok := statements.([]any); ok {
+		for _, statement := range statementsList {
+			statementVal, err := ExpectExpr(statement)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, statementVal)
+		}
+	}
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return &StatementsExpr{Statements: result}, nil
+}
+
+// newConditional builds `cond ? then : else`. branches is nil, or [_, "?", _, then, _, ":", _, else]
+func newConditional(cond, branches any) (Expr, error) {
+	condVal, err := ExpectExpr(cond)
+	if err != nil {
+		return nil, err
+	}
+	if branches == nil {
+		return condVal, nil
+	}
+
+	branchesList, ok := branches.([]any)
+	if !ok || len(branchesList) != 8 {
+		return nil, fmt.Errorf("internal parser error. '%T' is not a valid conditional", branches)
+	}
+	thenVal, err := ExpectExpr(branchesList[3])
+	if err != nil {
+		return nil, err
+	}
+	elseVal, err := ExpectExpr(branchesList[7])
+	if err != nil {
+		return nil, err
+	}
+	return &ConditionalExpr{Cond: condVal, Then: thenVal, Else: elseVal}, nil
+}
+
+// newInfixChain builds a left-associative chain of infix operators. Each element of rest is [_, op, _, expr]
+func newInfixChain(position string, first, rest any) (Expr, error) {
+	result, err := ExpectExpr(first)
+	if err != nil {
+		return nil, err
+	}
+
+	restList, _ := rest.([]any)
+	for _, element := range restList {
+		elementList, ok := element.([]any)
+		if !ok || len(elementList) != 4 {
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid operand", element)
+		}
+		op, err := ExpectString(elementList[1])
+		if err != nil {
+			return nil, err
+		}
+		right, err := ExpectExpr(elementList[3])
+		if err != nil {
+			return nil, err
+		}
+		result = &InfixOpExpr{Position: position, Left: result, Op: op, Right: right}
+	}
+	return result, nil
+}
+
+// applySelectors applies `.method(...)`, `.property` and `[index]` selectors to the primary expression.
+// Each element of selectors is [_, selector], where selector has no target expression set yet.
+func applySelectors(primary, selectors any) (Expr, error) {
+	result, err := ExpectExpr(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	selectorsList, _ := selectors.([]any)
+	for _, element := range selectorsList {
+		elementList, ok := element.([]any)
+		if !ok || len(elementList) != 2 {
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid selector", element)
+		}
+		switch selector := elementList[1].(type) {
+		case *MethodCallExpr:
+			selector.Expr = result
+		case *AccessorExpr:
+			selector.Expr = result
+		case *IndexExpr:
+			selector.Expr = result
+		default:
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid selector", selector)
+		}
+		result = elementList[1].(Expr)
+	}
+	return result, nil
+}
+
+// newArguments builds method arguments. Each element of rest is [_, ",", _, expr]
+func newArguments(first, rest any) ([]Expr, error) {
+	firstVal, err := ExpectExpr(first)
+	if err != nil {
+		return nil, err
+	}
+	result := []Expr{firstVal}
+
+	restList, _ := rest.([]any)
+	for _, element := range restList {
+		elementList, ok := element.([]any)
+		if !ok || len(elementList) != 4 {
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid argument", element)
+		}
+		argVal, err := ExpectExpr(elementList[3])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, argVal)
+	}
+	return result, nil
+}
+
+// parseNumber parses integer (int64) and floating point (float64) literals, e.g. 42, 10L, 1.5, 2e3, 3f
+func parseNumber(text string) (Expr, error) {
+	isFloat := strings.ContainsAny(text, ".eEfFdD")
+	text = strings.TrimRight(text, "lLfFdD")
+	if isFloat {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &LiteralExpr{Value: value}, nil
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &LiteralExpr{Value: value}, nil
+}
+
+// unquoteString removes quotes ('...' or "...") and backslash escapes from a string literal
+func unquoteString(text string) (Expr, error) {
+	if len(text) < 2 {
+		return nil, fmt.Errorf("internal parser error. '%s' is not a valid string", text)
+	}
+	text = text[1 : len(text)-1]
+
+	var result strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+			switch text[i] {
+			case 'n':
+				result.WriteByte('\n')
+			case 't':
+				result.WriteByte('\t')
+			case 'r':
+				result.WriteByte('\r')
+			default:
+				result.WriteByte(text[i])
+			}
+			continue
+		}
+		result.WriteByte(text[i])
+	}
+	return &LiteralExpr{Value: result.String()}, nil
+}
+
+// newAssignment builds `target op expr`, where target is a variable, `x.y` or `x[y]`.
+// Compound assignments (e.g. `x += 1`) are desugared into `x = x + 1`.
+func newAssignment(position string, target, op, expr any) (Expr, error) {
+	targetVal, err := ExpectExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	opVal, err := ExpectString(op)
+	if err != nil {
+		return nil, err
+	}
+	exprVal, err := ExpectExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opVal != "=" {
+		exprVal = &InfixOpExpr{Position: position, Left: targetVal, Op: strings.TrimSuffix(opVal, "="), Right: exprVal}
+	}
+
+	switch t := targetVal.(type) {
+	case *VariableExpr:
+		return &AssignExpr{Position: position, Name: t.Name, Expr: exprVal}, nil
+	case *AccessorExpr:
+		return &SetExpr{Position: position, Container: t.Expr, Key: &LiteralExpr{Value: t.PropertyName}, Expr: exprVal}, nil
+	case *IndexExpr:
+		return &SetExpr{Position: position, Container: t.Expr, Key: t.Index, Expr: exprVal}, nil
+	default:
+		return nil, fmt.Errorf("%s: cannot assign to '%T'", position, targetVal)
+	}
+}
+
+// newForEach builds `for (x in iterable) body` and `for (def x : iterable) body`
+func newForEach(position string, name, iterable, body any) (Expr, error) {
+	nameVal, err := ExpectString(name)
+	if err != nil {
+		return nil, err
+	}
+	iterableVal, err := ExpectExpr(iterable)
+	if err != nil {
+		return nil, err
+	}
+	bodyVal, err := ExpectExpr(body)
+	if err != nil {
+		return nil, err
+	}
+	return &ForEachExpr{Position: position, Name: nameVal, Iterable: iterableVal, Body: bodyVal}, nil
+}
+
+// newFor builds `for (init; cond; update) body` and `while (cond) body`. init, cond and update may be nil.
+func newFor(position string, init, cond, update, body any) (Expr, error) {
+	result := &ForExpr{Position: position}
+	for _, part := range []struct {
+		value any
+		dest  *Expr
+	}{{init, &result.Init}, {cond, &result.Cond}, {update, &result.Update}, {body, &result.Body}} {
+		if part.value == nil {
+			continue
+		}
+		partVal, err := ExpectExpr(part.value)
+		if err != nil {
+			return nil, err
+		}
+		*part.dest = partVal
+	}
+	return result, nil
+}
+
+// newMap builds a map literal `[k1: v1, k2: v2]`. first is [key, value], each element of rest is [_, ",", _, [key, value]]
+func newMap(first, rest any) (Expr, error) {
+	entries := []any{first}
+	restList, _ := rest.([]any)
+	for _, element := range restList {
+		elementList, ok := element.([]any)
+		if !ok || len(elementList) != 4 {
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid map entry", element)
+		}
+		entries = append(entries, elementList[3])
+	}
+
+	result := &MapExpr{}
+	for _, entry := range entries {
+		entryList, ok := entry.([]any)
+		if !ok || len(entryList) != 2 {
+			return nil, fmt.Errorf("internal parser error. '%T' is not a valid map entry", entry)
+		}
+		key, err := ExpectExpr(entryList[0])
+		if err != nil {
+			return nil, err
+		}
+		value, err := ExpectExpr(entryList[1])
+		if err != nil {
+			return nil, err
+		}
+		result.Keys = append(result.Keys, key)
+		result.Values = append(result.Values, value)
+	}
+	return result, nil
+}
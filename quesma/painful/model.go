@@ -28,9 +28,13 @@ func ParsePainless(script string) (Expr, error) {
 }
 
 type Env struct {
-	Doc map[string]any
+	Doc       map[string]any
+	Params    map[string]any
+	Variables map[string]any
 
 	EmitValue any
+
+	returned bool // a return statement has been executed
 }
 
 type Expr interface {
@@ -59,6 +63,26 @@ func (i *InfixOpExpr) Eval(env *Env) (any, error) {
 		return nil, err
 	}
 
+	// boolean operators are short-circuit
+	if i.Op == "&&" || i.Op == "||" {
+		leftVal, err := ExpectBool(left)
+		if err != nil {
+			return nil, fmt.Errorf("%s: '%s' operator: %v", i.Position, i.Op, err)
+		}
+		if leftVal == (i.Op == "||") {
+			return leftVal, nil
+		}
+		right, err := i.Right.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rightVal, err := ExpectBool(right)
+		if err != nil {
+			return nil, fmt.Errorf("%s: '%s' operator: %v", i.Position, i.Op, err)
+		}
+		return rightVal, nil
+	}
+
 	right, err := i.Right.Eval(env)
 	if err != nil {
 		return nil, err
@@ -68,14 +92,32 @@ func (i *InfixOpExpr) Eval(env *Env) (any, error) {
 
 	case "+":
 
-		switch left.(type) {
+		if _, isNumber := asNumber(left); isNumber {
+			if _, isNumber := asNumber(right); isNumber {
+				return evalArithmetic(i.Op, left, right)
+			}
+		}
+		return fmt.Sprintf("%v%v", left, right), nil
 
-		case string:
-			return fmt.Sprintf("%v%v", left, right), nil
+	case "-", "*", "/", "%":
 
-		default:
-			return fmt.Sprintf("%v%v", left, right), nil
+		result, err := evalArithmetic(i.Op, left, right)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", i.Position, err)
 		}
+		return result, nil
+
+	case "==", "!=":
+
+		return equals(left, right) == (i.Op == "=="), nil
+
+	case "<", "<=", ">", ">=":
+
+		result, err := evalComparison(i.Op, left, right)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", i.Position, err)
+		}
+		return result, nil
 
 	default:
 
@@ -84,6 +126,44 @@ func (i *InfixOpExpr) Eval(env *Env) (any, error) {
 	}
 }
 
+type PrefixOpExpr struct {
+	Position string
+	Op       string
+	Expr     Expr
+}
+
+func (p *PrefixOpExpr) Eval(env *Env) (any, error) {
+
+	val, err := p.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Op {
+
+	case "!":
+
+		boolVal, err := ExpectBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: '%s' operator: %v", p.Position, p.Op, err)
+		}
+		return !boolVal, nil
+
+	case "-":
+
+		result, err := evalArithmetic("-", int64(0), val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.Position, err)
+		}
+		return result, nil
+
+	default:
+
+		return nil, fmt.Errorf("%s: '%s' operator is not supported", p.Position, p.Op)
+	}
+}
+
+// ConditionalExpr is both `cond ? then : else` and `if (cond) then else`, Else is nil for if without else
 type ConditionalExpr struct {
 	Cond Expr
 	Then Expr
@@ -97,10 +177,20 @@ func (c *ConditionalExpr) Eval(env *Env) (any, error) {
 		return nil, err
 	}
 
-	if cond.(bool) {
+	condVal, err := ExpectBool(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	if condVal {
 		return c.Then.Eval(env)
 	}
 
+	// if statement without else
+	if c.Else == nil {
+		return nil, nil
+	}
+
 	return c.Else.Eval(env)
 }
 
@@ -119,6 +209,334 @@ func (d *DocExpr) Eval(env *Env) (any, error) {
 	return env.Doc[key], nil
 }
 
+type VariableExpr struct {
+	Position string
+	Name     string
+}
+
+func (v *VariableExpr) Eval(env *Env) (any, error) {
+
+	if v.Name == "params" {
+		return env.Params, nil
+	}
+
+	val, ok := env.Variables[v.Name]
+	if !ok && v.Name == "doc" { // doc.field
+		return env.Doc, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: cannot resolve symbol [%s]", v.Position, v.Name)
+	}
+	return val, nil
+}
+
+type IndexExpr struct {
+	Position string
+	Expr     Expr
+	Index    Expr
+}
+
+func (i *IndexExpr) Eval(env *Env) (any, error) {
+
+	val, err := i.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := i.Index.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := val.(type) {
+	case map[string]any:
+		return container[fmt.Sprintf("%v", index)], nil
+	case []any:
+		n, isNumber := asNumber(index)
+		if !isNumber || n < 0 || int(n) >= len(container) {
+			return nil, fmt.Errorf("%s: index %v out of bounds for length %d", i.Position, index, len(container))
+		}
+		return container[int(n)], nil
+	case *[]any:
+		return evalListMethod(i.Position, container, "get", []any{index})
+	default:
+		return nil, fmt.Errorf("%s: cannot index '%T'", i.Position, val)
+	}
+}
+
+// AssignExpr is a declaration or an assignment of a local variable, e.g. `def x = 1`
+type AssignExpr struct {
+	Position string
+	Name     string
+	Expr     Expr
+}
+
+func (a *AssignExpr) Eval(env *Env) (any, error) {
+
+	val, err := a.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.Variables == nil {
+		env.Variables = make(map[string]any)
+	}
+	env.Variables[a.Name] = val
+
+	return val, nil
+}
+
+// SetExpr is an assignment of a map entry or a list element, e.g. `state.x = 1` or `state['x'] = 1`
+type SetExpr struct {
+	Position  string
+	Container Expr
+	Key       Expr
+	Expr      Expr
+}
+
+func (s *SetExpr) Eval(env *Env) (any, error) {
+
+	container, err := s.Container.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.Key.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := s.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := container.(type) {
+	case map[string]any:
+		c[fmt.Sprintf("%v", key)] = val
+		return val, nil
+	case *[]any:
+		if _, err = evalListMethod(s.Position, c, "set", []any{key, val}); err != nil {
+			return nil, err
+		}
+		return val, nil
+	default:
+		return nil, fmt.Errorf("%s: cannot assign an element of '%T'", s.Position, container)
+	}
+}
+
+// ForEachExpr is `for (x in iterable) body` or `for (def x : iterable) body`
+type ForEachExpr struct {
+	Position string
+	Name     string
+	Iterable Expr
+	Body     Expr
+}
+
+func (f *ForEachExpr) Eval(env *Env) (any, error) {
+
+	iterable, err := f.Iterable.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	elements, err := asList(iterable)
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot iterate: %v", f.Position, err)
+	}
+
+	if env.Variables == nil {
+		env.Variables = make(map[string]any)
+	}
+	for i, element := range elements {
+		if i >= MaxLoopIterations {
+			return nil, fmt.Errorf("%s: loop exceeded the limit of %d iterations", f.Position, MaxLoopIterations)
+		}
+		env.Variables[f.Name] = element
+		val, err := f.Body.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if env.returned {
+			return val, nil
+		}
+	}
+	return nil, nil
+}
+
+// ForExpr is `for (init; cond; update) body` or `while (cond) body`. Init, Cond and Update may be nil.
+type ForExpr struct {
+	Position string
+	Init     Expr
+	Cond     Expr
+	Update   Expr
+	Body     Expr
+}
+
+func (f *ForExpr) Eval(env *Env) (any, error) {
+
+	if f.Init != nil {
+		if _, err := f.Init.Eval(env); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; ; i++ {
+		if i >= MaxLoopIterations {
+			return nil, fmt.Errorf("%s: loop exceeded the limit of %d iterations", f.Position, MaxLoopIterations)
+		}
+
+		if f.Cond != nil {
+			cond, err := f.Cond.Eval(env)
+			if err != nil {
+				return nil, err
+			}
+			condVal, err := ExpectBool(cond)
+			if err != nil {
+				return nil, fmt.Errorf("%s: loop condition: %v", f.Position, err)
+			}
+			if !condVal {
+				return nil, nil
+			}
+		}
+
+		val, err := f.Body.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if env.returned {
+			return val, nil
+		}
+
+		if f.Update != nil {
+			if _, err = f.Update.Eval(env); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// ListExpr is a list literal, e.g. `[1, 2]`. Lists are represented as *[]any, so that they can be modified in place.
+type ListExpr struct {
+	Elements []Expr
+}
+
+func (l *ListExpr) Eval(env *Env) (any, error) {
+
+	list := make([]any, 0, len(l.Elements))
+	for _, element := range l.Elements {
+		val, err := element.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, val)
+	}
+	return &list, nil
+}
+
+// MapExpr is a map literal, e.g. `[:]` or `['a': 1]`
+type MapExpr struct {
+	Keys   []Expr
+	Values []Expr
+}
+
+func (m *MapExpr) Eval(env *Env) (any, error) {
+
+	result := make(map[string]any, len(m.Keys))
+	for i := range m.Keys {
+		key, err := m.Keys[i].Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		val, err := m.Values[i].Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		result[fmt.Sprintf("%v", key)] = val
+	}
+	return result, nil
+}
+
+// NewExpr is a constructor call of a collection, e.g. `new ArrayList()` or `new HashMap()`
+type NewExpr struct {
+	Position string
+	Class    string
+}
+
+func (n *NewExpr) Eval(env *Env) (any, error) {
+
+	switch n.Class {
+	case "ArrayList", "LinkedList":
+		list := make([]any, 0)
+		return &list, nil
+	case "HashMap", "TreeMap", "LinkedHashMap":
+		return make(map[string]any), nil
+	default:
+		return nil, fmt.Errorf("%s: 'new %s()' is not supported", n.Position, n.Class)
+	}
+}
+
+// CastExpr is a type cast, e.g. `(double) x`
+type CastExpr struct {
+	Position string
+	Type     string
+	Expr     Expr
+}
+
+func (c *CastExpr) Eval(env *Env) (any, error) {
+
+	val, err := c.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := evalCast(c.Type, val)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.Position, err)
+	}
+	return result, nil
+}
+
+type ReturnExpr struct {
+	Expr Expr // nil for `return;`
+}
+
+func (r *ReturnExpr) Eval(env *Env) (any, error) {
+
+	var val any
+	if r.Expr != nil {
+		var err error
+		val, err = r.Expr.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	env.returned = true
+	return val, nil
+}
+
+// StatementsExpr is a list of statements. Its value is the returned value, or the value of the last statement.
+type StatementsExpr struct {
+	Statements []Expr
+}
+
+func (s *StatementsExpr) Eval(env *Env) (any, error) {
+
+	var val any
+	for _, statement := range s.Statements {
+		var err error
+		val, err = statement.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if env.returned {
+			break
+		}
+	}
+	return val, nil
+}
+
 type EmitExpr struct {
 	Expr Expr
 }
@@ -143,17 +561,40 @@ type AccessorExpr struct {
 
 func (a *AccessorExpr) Eval(env *Env) (any, error) {
 
+	if v, isVariable := a.Expr.(*VariableExpr); isVariable && v.Name == "Math" {
+		return evalMathConstant(a.Position, a.PropertyName)
+	}
+
+	if v, isVariable := a.Expr.(*VariableExpr); isVariable && isNumberClass(v.Name) {
+		return evalNumberConstant(a.Position, v.Name, a.PropertyName)
+	}
+
 	val, err := a.Expr.Eval(env)
 	if err != nil {
 		return nil, err
 	}
 
+	// params.x
+	if valMap, isMap := val.(map[string]any); isMap {
+		return valMap[a.PropertyName], nil
+	}
+
 	// value property is a special case
 	// it's just a current value of the expression
 	if a.PropertyName == "value" {
 		return val, nil
 	}
 
+	// doc['field'].empty
+	if a.PropertyName == "empty" {
+		return val == nil, nil
+	}
+
+	// doc['date'].value.millis
+	if date, isDate := val.(time.Time); isDate && a.PropertyName == "millis" {
+		return date.UnixMilli(), nil
+	}
+
 	// for testing purposes
 	if a.PropertyName == "type" {
 		return fmt.Sprintf("%T", val), nil
@@ -172,13 +613,68 @@ type MethodCallExpr struct {
 
 func (m *MethodCallExpr) Eval(env *Env) (any, error) {
 
+	if v, isVariable := m.Expr.(*VariableExpr); isVariable && v.Name == "Math" {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalMathFunction(m.Position, m.MethodName, args)
+	}
+
+	if v, isVariable := m.Expr.(*VariableExpr); isVariable && v.Name == MovingFunctions {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalMovingFunction(m.Position, m.MethodName, args)
+	}
+
+	if v, isVariable := m.Expr.(*VariableExpr); isVariable && v.Name == "Collections" {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalCollectionsMethod(m.Position, m.MethodName, args)
+	}
+
 	val, err := m.Expr.Eval(env)
 	if err != nil {
 		return nil, err
 	}
 
+	if str, isString := val.(string); isString && isStringMethod(m.MethodName) {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalStringMethod(m.Position, str, m.MethodName, args)
+	}
+
+	if list, isList := val.(*[]any); isList {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalListMethod(m.Position, list, m.MethodName, args)
+	}
+
+	if valMap, isMap := val.(map[string]any); isMap && isMapMethod(m.MethodName) {
+		args, err := m.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return evalMapMethod(m.Position, valMap, m.MethodName, args)
+	}
+
 	switch m.MethodName {
 
+	case "size": // doc['field'].size(), number of values of the field
+
+		if val == nil {
+			return int64(0), nil
+		}
+		return int64(1), nil
+
 	case "getHour":
 
 		typeVal, err := ExpectDate(val)
@@ -189,6 +685,26 @@ func (m *MethodCallExpr) Eval(env *Env) (any, error) {
 
 		return typeVal.Hour(), nil
 
+	case "toInstant": // ZonedDateTime.toInstant(), dates are instants already
+
+		typeVal, err := ExpectDate(val)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: method '%s' failed to coerce '%v' into a datetime: %v ", m.Position, m.MethodName, val, err)
+		}
+
+		return typeVal, nil
+
+	case "toEpochMilli", "getMillis":
+
+		typeVal, err := ExpectDate(val)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: method '%s' failed to coerce '%v' into a datetime: %v ", m.Position, m.MethodName, val, err)
+		}
+
+		return typeVal.UnixMilli(), nil
+
 	case "formatISO8601": // TODO maybe more easier to remember name
 
 		typeVal, err := ExpectDate(val)
@@ -214,6 +730,18 @@ func (m *MethodCallExpr) Eval(env *Env) (any, error) {
 	}
 }
 
+func (m *MethodCallExpr) evalArgs(env *Env) ([]any, error) {
+	args := make([]any, 0, len(m.Args))
+	for _, arg := range m.Args {
+		val, err := arg.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, val)
+	}
+	return args, nil
+}
+
 type UrlEncodeExpr struct {
 	Expr Expr
 }
@@ -253,6 +781,16 @@ func ExpectString(potentialExpr any) (string, error) {
 	}
 }
 
+func ExpectBool(potentialExpr any) (bool, error) {
+
+	switch b := potentialExpr.(type) {
+	case bool:
+		return b, nil
+	default:
+		return false, fmt.Errorf("expected boolean, got %T", potentialExpr)
+	}
+}
+
 func ExpectDate(potentialExpr any) (time.Time, error) {
 
 	switch date := potentialExpr.(type) {
@@ -0,0 +1,237 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"math"
+)
+
+// MovingFunctions is the Painless class available in `moving_fn` pipeline aggregation scripts.
+// Its methods work on a window of bucket values (`values`), and skip NaNs the same way Elastic does.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-movfn-aggregation.html
+const MovingFunctions = "MovingFunctions"
+
+// MovingFunctionArgs is the number of arguments of supported MovingFunctions methods (first one is always `values`)
+var MovingFunctionArgs = map[string]int{
+	"max": 1, "min": 1, "sum": 1, "unweightedAvg": 1, "linearWeightedAvg": 1,
+	"stdDev": 2, "ewma": 2, "holt": 3, "holtWinters": 6,
+}
+
+func evalMovingFunction(position, name string, args []any) (any, error) {
+	wantArgs, ok := MovingFunctionArgs[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: '%s.%s' method is not supported", position, MovingFunctions, name)
+	}
+	if len(args) != wantArgs {
+		return nil, fmt.Errorf("%s: '%s.%s' expects %d arguments, got %d", position, MovingFunctions, name, wantArgs, len(args))
+	}
+
+	values, ok := args[0].([]float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: '%s.%s' expects values as its first argument, got %T", position, MovingFunctions, name, args[0])
+	}
+
+	// holtWinters has a boolean last argument, all others are numbers
+	numberArgs := args[1:]
+	multiplicative := false
+	if name == "holtWinters" {
+		numberArgs = args[1:5]
+		if multiplicative, ok = args[5].(bool); !ok {
+			return nil, fmt.Errorf("%s: '%s.%s' expects a boolean as its last argument, got %T", position, MovingFunctions, name, args[5])
+		}
+	}
+	params := make([]float64, 0, len(numberArgs))
+	for _, arg := range numberArgs {
+		param, isNumber := asNumber(arg)
+		if !isNumber {
+			return nil, fmt.Errorf("%s: '%s.%s' expects numbers, got %T", position, MovingFunctions, name, arg)
+		}
+		params = append(params, param)
+	}
+
+	switch name {
+	case "max":
+		return movingMax(values), nil
+	case "min":
+		return movingMin(values), nil
+	case "sum":
+		return movingSum(values), nil
+	case "unweightedAvg":
+		return movingUnweightedAvg(values), nil
+	case "linearWeightedAvg":
+		return movingLinearWeightedAvg(values), nil
+	case "stdDev":
+		return movingStdDev(values, params[0]), nil
+	case "ewma":
+		return movingEwma(values, params[0]), nil
+	case "holt":
+		return movingHolt(values, params[0], params[1]), nil
+	default: // holtWinters
+		period := int(params[3])
+		if period <= 0 || len(values) < 2*period {
+			return nil, fmt.Errorf("%s: Holt-Winters requires at least (2 * period == %d) data-points to function. Only [%d] were provided",
+				position, 2*period, len(values))
+		}
+		return movingHoltWinters(values, params[0], params[1], params[2], period, multiplicative), nil
+	}
+}
+
+func nonNaN(values []float64) []float64 {
+	result := make([]float64, 0, len(values))
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func movingMax(values []float64) float64 {
+	result := math.NaN()
+	for i, value := range values {
+		if i == 0 || value > result {
+			result = value
+		}
+	}
+	return result
+}
+
+func movingMin(values []float64) float64 {
+	result := math.NaN()
+	for i, value := range values {
+		if i == 0 || value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+func movingSum(values []float64) float64 {
+	sum := 0.0
+	for _, value := range nonNaN(values) {
+		sum += value
+	}
+	return sum
+}
+
+func movingUnweightedAvg(values []float64) float64 {
+	values = nonNaN(values)
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	return movingSum(values) / float64(len(values))
+}
+
+func movingStdDev(values []float64, avg float64) float64 {
+	if math.IsNaN(avg) {
+		return math.NaN()
+	}
+	values = nonNaN(values)
+	squaredMean := 0.0
+	for _, value := range values {
+		squaredMean += math.Pow(value-avg, 2)
+	}
+	return math.Sqrt(squaredMean / float64(len(values)))
+}
+
+func movingLinearWeightedAvg(values []float64) float64 {
+	avg, totalWeight, current := 0.0, 1.0, 1.0
+	for _, value := range nonNaN(values) {
+		avg += value * current
+		totalWeight += current
+		current += 1
+	}
+	if totalWeight == 1 {
+		return math.NaN()
+	}
+	return avg / totalWeight
+}
+
+func movingEwma(values []float64, alpha float64) float64 {
+	avg := math.NaN()
+	for i, value := range nonNaN(values) {
+		if i == 0 {
+			avg = value
+		} else {
+			avg = value*alpha + avg*(1-alpha)
+		}
+	}
+	return avg
+}
+
+func movingHolt(values []float64, alpha, beta float64) float64 {
+	values = nonNaN(values)
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	var s, lastS, b, lastB float64
+	for i, value := range values {
+		if i == 0 {
+			s, b = value, 0
+		} else {
+			s = alpha*value + (1-alpha)*(lastS+lastB)
+			b = beta*(s-lastS) + (1-beta)*lastB
+		}
+		lastS, lastB = s, b
+	}
+	return s
+}
+
+// movingHoltWinters follows Elastic's implementation closely, including its quirks (e.g. additive seasonal update),
+// so that we return the same numbers.
+func movingHoltWinters(values []float64, alpha, beta, gamma float64, period int, multiplicative bool) float64 {
+	padding := 0.0
+	if multiplicative {
+		padding = 0.0000000001
+	}
+	vs := make([]float64, len(values)) // NaNs are skipped, so the tail stays 0, as in Elastic
+	counter := 0
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			vs[counter] = value + padding
+			counter++
+		}
+	}
+	if counter == 0 {
+		return math.NaN()
+	}
+
+	// Initial level value is average of first season, initial trend is the average slope between the first two seasons
+	var s, b float64
+	for i := 0; i < period; i++ {
+		s += vs[i]
+		b += (vs[i+period] - vs[i]) / float64(period)
+	}
+	s /= float64(period)
+	b /= float64(period)
+	lastS, lastB := s, 0.0
+
+	seasonal := make([]float64, len(vs))
+	if s != 0 {
+		for i := 0; i < period; i++ {
+			seasonal[i] = vs[i] / s
+		}
+	}
+
+	for i := period; i < len(vs); i++ {
+		if multiplicative {
+			s = alpha*(vs[i]/seasonal[i-period]) + (1-alpha)*(lastS+lastB)
+		} else {
+			s = alpha*(vs[i]-seasonal[i-period]) + (1-alpha)*(lastS+lastB)
+		}
+		b = beta*(s-lastS) + (1-beta)*lastB
+		if multiplicative {
+			seasonal[i] = gamma*(vs[i]/(lastS+lastB)) + (1-gamma)*seasonal[i-period]
+		} else {
+			seasonal[i] = gamma*(vs[i]-(lastS-lastB)) + (1-gamma)*seasonal[i-period]
+		}
+		lastS, lastB = s, b
+	}
+
+	idx := len(values) - period
+	if multiplicative {
+		return (s + b) * seasonal[idx]
+	}
+	return s + b + seasonal[idx]
+}
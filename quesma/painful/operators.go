@@ -0,0 +1,352 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// asNumber returns the value as float64, if it's a number
+func asNumber(val any) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func isInteger(val any) bool {
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// evalArithmetic computes +, -, *, / or %. Like in Java, it's integer arithmetic if both operands are integers.
+func evalArithmetic(op string, left, right any) (any, error) {
+	l, isNumber := asNumber(left)
+	if !isNumber {
+		return nil, fmt.Errorf("'%s' operator: expected number, got %T", op, left)
+	}
+	r, isNumber := asNumber(right)
+	if !isNumber {
+		return nil, fmt.Errorf("'%s' operator: expected number, got %T", op, right)
+	}
+
+	if isInteger(left) && isInteger(right) {
+		li, ri := int64(l), int64(r)
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("/ by zero")
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "%":
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("'%s' operator is not supported", op)
+}
+
+func equals(left, right any) bool {
+	l, leftIsNumber := asNumber(left)
+	r, rightIsNumber := asNumber(right)
+	if leftIsNumber && rightIsNumber {
+		return l == r
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func evalComparison(op string, left, right any) (bool, error) {
+	var cmp int
+	l, leftIsNumber := asNumber(left)
+	r, rightIsNumber := asNumber(right)
+	leftStr, leftIsString := left.(string)
+	rightStr, rightIsString := right.(string)
+	switch {
+	case leftIsNumber && rightIsNumber:
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case leftIsString && rightIsString:
+		cmp = strings.Compare(leftStr, rightStr)
+	default:
+		return false, fmt.Errorf("'%s' operator: cannot compare %T and %T", op, left, right)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("'%s' operator is not supported", op)
+}
+
+func evalMathConstant(position, name string) (any, error) {
+	switch name {
+	case "PI":
+		return math.Pi, nil
+	case "E":
+		return math.E, nil
+	default:
+		return nil, fmt.Errorf("%s: 'Math.%s' is not supported", position, name)
+	}
+}
+
+var mathFunctions = map[string]func(args []float64) float64{
+	"abs":    func(args []float64) float64 { return math.Abs(args[0]) },
+	"ceil":   func(args []float64) float64 { return math.Ceil(args[0]) },
+	"floor":  func(args []float64) float64 { return math.Floor(args[0]) },
+	"round":  func(args []float64) float64 { return math.Floor(args[0] + 0.5) },
+	"sqrt":   func(args []float64) float64 { return math.Sqrt(args[0]) },
+	"exp":    func(args []float64) float64 { return math.Exp(args[0]) },
+	"log":    func(args []float64) float64 { return math.Log(args[0]) },
+	"log10":  func(args []float64) float64 { return math.Log10(args[0]) },
+	"signum": func(args []float64) float64 { return float64(sign(args[0])) },
+	"pow":    func(args []float64) float64 { return math.Pow(args[0], args[1]) },
+	"max":    func(args []float64) float64 { return math.Max(args[0], args[1]) },
+	"min":    func(args []float64) float64 { return math.Min(args[0], args[1]) },
+}
+
+// MathFunctionArgs is the number of arguments of supported Math functions
+var MathFunctionArgs = map[string]int{
+	"abs": 1, "ceil": 1, "floor": 1, "round": 1, "sqrt": 1, "exp": 1, "log": 1, "log10": 1, "signum": 1,
+	"pow": 2, "max": 2, "min": 2,
+}
+
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func evalMathFunction(position, name string, args []any) (any, error) {
+	function, ok := mathFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: 'Math.%s' method is not supported", position, name)
+	}
+	if len(args) != MathFunctionArgs[name] {
+		return nil, fmt.Errorf("%s: 'Math.%s' expects %d arguments, got %d", position, name, MathFunctionArgs[name], len(args))
+	}
+
+	argsVal := make([]float64, 0, len(args))
+	for _, arg := range args {
+		argVal, isNumber := asNumber(arg)
+		if !isNumber {
+			return nil, fmt.Errorf("%s: 'Math.%s' expects numbers, got %T", position, name, arg)
+		}
+		argsVal = append(argsVal, argVal)
+	}
+
+	result := function(argsVal)
+	switch name {
+	case "abs", "max", "min":
+		// keep integers integers
+		if isInteger(args[0]) && (len(args) == 1 || isInteger(args[1])) {
+			return int64(result), nil
+		}
+	case "round":
+		return int64(result), nil
+	}
+	return result, nil
+}
+
+// StringMethodArgs is the number of arguments of supported String methods, -1 means 1 or 2
+var StringMethodArgs = map[string]int{
+	"length": 0, "toLowerCase": 0, "toUpperCase": 0, "trim": 0, "isEmpty": 0,
+	"contains": 1, "startsWith": 1, "endsWith": 1, "indexOf": 1, "equals": 1,
+	"replace": 2, "substring": -1,
+}
+
+func isStringMethod(name string) bool {
+	_, ok := StringMethodArgs[name]
+	return ok
+}
+
+func evalStringMethod(position, str, name string, args []any) (any, error) {
+	wantArgs := StringMethodArgs[name]
+	if (wantArgs >= 0 && len(args) != wantArgs) || (wantArgs < 0 && (len(args) < 1 || len(args) > 2)) {
+		return nil, fmt.Errorf("%s: wrong number of arguments of '%s' method: %d", position, name, len(args))
+	}
+
+	var strArgs []string
+	for _, arg := range args {
+		if argStr, isString := arg.(string); isString {
+			strArgs = append(strArgs, argStr)
+		}
+	}
+	if name != "substring" && name != "equals" && len(strArgs) != len(args) {
+		return nil, fmt.Errorf("%s: '%s' method expects string arguments", position, name)
+	}
+
+	switch name {
+	case "length":
+		return int64(len([]rune(str))), nil
+	case "toLowerCase":
+		return strings.ToLower(str), nil
+	case "toUpperCase":
+		return strings.ToUpper(str), nil
+	case "trim":
+		return strings.TrimSpace(str), nil
+	case "isEmpty":
+		return len(str) == 0, nil
+	case "contains":
+		return strings.Contains(str, strArgs[0]), nil
+	case "startsWith":
+		return strings.HasPrefix(str, strArgs[0]), nil
+	case "endsWith":
+		return strings.HasSuffix(str, strArgs[0]), nil
+	case "indexOf":
+		index := strings.Index(str, strArgs[0])
+		if index < 0 {
+			return int64(-1), nil
+		}
+		return int64(len([]rune(str[:index]))), nil
+	case "equals":
+		return equals(str, args[0]), nil
+	case "replace":
+		return strings.ReplaceAll(str, strArgs[0], strArgs[1]), nil
+	case "substring":
+		runes := []rune(str)
+		begin, isNumber := asNumber(args[0])
+		end := float64(len(runes))
+		if len(args) == 2 {
+			var endIsNumber bool
+			end, endIsNumber = asNumber(args[1])
+			isNumber = isNumber && endIsNumber
+		}
+		if !isNumber || begin < 0 || end > float64(len(runes)) || begin > end {
+			return nil, fmt.Errorf("%s: invalid arguments of 'substring' method: %v", position, args)
+		}
+		return string(runes[int(begin):int(end)]), nil
+	}
+	return nil, fmt.Errorf("%s: '%s' method is not supported", position, name)
+}
+
+func isNumberClass(name string) bool {
+	return name == "Long" || name == "Integer" || name == "Double"
+}
+
+func evalNumberConstant(position, class, name string) (any, error) {
+	switch class + "." + name {
+	case "Long.MAX_VALUE":
+		return int64(math.MaxInt64), nil
+	case "Long.MIN_VALUE":
+		return int64(math.MinInt64), nil
+	case "Integer.MAX_VALUE":
+		return int64(math.MaxInt32), nil
+	case "Integer.MIN_VALUE":
+		return int64(math.MinInt32), nil
+	case "Double.MAX_VALUE":
+		return math.MaxFloat64, nil
+	case "Double.MIN_VALUE":
+		return math.SmallestNonzeroFloat64, nil
+	case "Double.POSITIVE_INFINITY":
+		return math.Inf(1), nil
+	case "Double.NEGATIVE_INFINITY":
+		return math.Inf(-1), nil
+	default:
+		return nil, fmt.Errorf("%s: '%s.%s' is not supported", position, class, name)
+	}
+}
+
+// evalCast converts numbers between integer and floating point types, other casts only check the type
+func evalCast(typeName string, val any) (any, error) {
+	switch typeName {
+	case "int", "long":
+		n, isNumber := asNumber(val)
+		if !isNumber {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return int64(n), nil
+	case "float", "double":
+		n, isNumber := asNumber(val)
+		if !isNumber {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return n, nil
+	case "boolean":
+		if _, isBool := val.(bool); !isBool {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return val, nil
+	case "String":
+		if _, isString := val.(string); !isString && val != nil {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return val, nil
+	case "List", "ArrayList":
+		if _, err := asList(val); err != nil && val != nil {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return val, nil
+	case "Map", "HashMap":
+		if _, isMap := val.(map[string]any); !isMap && val != nil {
+			return nil, fmt.Errorf("cannot cast %T to %s", val, typeName)
+		}
+		return val, nil
+	default: // def, Object
+		return val, nil
+	}
+}
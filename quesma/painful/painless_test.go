@@ -3,6 +3,7 @@
 package painful
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
@@ -109,3 +110,202 @@ func TestPainless(t *testing.T) {
 		})
 	}
 }
+
+func TestPainlessExpressionsAndStatements(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		doc    map[string]any
+		params map[string]any
+		script string
+		output any
+	}{
+		{
+			name:   "arithmetic precedence",
+			script: "1 + 2 * 3 - (4 - 2) / 2",
+			output: int64(6),
+		},
+		{
+			name:   "floating point and modulo",
+			script: "7.5 % 2 + -1",
+			output: 0.5,
+		},
+		{
+			name:   "comparison and boolean logic",
+			doc:    map[string]any{"bytes": 1024, "status": "ok"},
+			script: "doc['bytes'].value > 1000 && (doc['status'].value == 'ok' || false) && !doc['status'].empty",
+			output: true,
+		},
+		{
+			name:   "params",
+			doc:    map[string]any{"bytes": 1024},
+			params: map[string]any{"threshold": 2000.0, "names": map[string]any{"a": "b"}},
+			script: "doc['bytes'].value >= params.threshold ? 'big' : params['names'].a",
+			output: "b",
+		},
+		{
+			name:   "math functions",
+			script: "Math.max(Math.abs(-3), 2) + Math.pow(2, 3) + Math.round(Math.PI)",
+			output: 14.0,
+		},
+		{
+			name:   "string methods",
+			doc:    map[string]any{"message": "  Hello World "},
+			script: `doc['message'].value.trim().toLowerCase().substring(6) + "," + doc['message'].value.indexOf("World")`,
+			output: "world,8",
+		},
+		{
+			name: "if, local variables and return",
+			doc:  map[string]any{"bytes": 500},
+			script: `
+				def limit = 1000; // bytes
+				if (doc['bytes'].value > limit) {
+					return 'large';
+				} else if (doc['bytes'].value > limit / 2) {
+					return 'medium';
+				}
+				return 'small';`,
+			output: "small",
+		},
+		{
+			name: "loops, collections and assignments",
+			script: `
+				Map counts = new HashMap();
+				List<Long> values = [3, 1, 2];
+				values.add(4L);
+				for (def v : values) {
+					String key = v % 2 == 0 ? 'even' : 'odd';
+					counts[key] = counts.getOrDefault(key, 0) + v;
+				}
+				int i = 0;
+				def total = 0;
+				for (i = 0; i < values.size(); i++) { total += values[i]; }
+				while (i > 0) { i--; }
+				Collections.sort(values);
+				return [counts.odd, counts['even'], total, i, values.get(0), [:].isEmpty(), (double) 3 / 2, (long) 3.7];`,
+			output: &[]any{int64(4), int64(6), int64(10), int64(0), int64(1), true, 1.5, int64(3)},
+		},
+		{
+			name: "state map, doc fields and dates",
+			doc:  map[string]any{"@timestamp": "2022-09-22T12:16:59.985Z", "bytes": int64(5)},
+			script: `
+				def state = ['max': Long.MIN_VALUE];
+				state.max = Math.max(state.max, doc.bytes.value);
+				state.millis = doc['@timestamp'].value.toInstant().toEpochMilli();
+				return state;`,
+			output: map[string]any{"max": int64(5), "millis": int64(1663849019985)},
+		},
+		{
+			name:   "return from a loop",
+			script: `for (x in [1, 2, 3]) { if (x > 1) { return x; } } return 0;`,
+			output: int64(2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParsePainless(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := expr.Eval(&Env{Doc: tt.doc, Params: tt.params})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tt.output, res) {
+				t.Errorf("expected %v (%T), got %v (%T)", tt.output, tt.output, res, res)
+			}
+		})
+	}
+}
+
+func TestPainlessMovingFunctions(t *testing.T) {
+	values := []float64{1, 2, math.NaN(), 4, 8}
+	tests := []struct {
+		script string
+		output float64
+	}{
+		{"MovingFunctions.max(values)", 8},
+		{"MovingFunctions.min(values)", 1},
+		{"MovingFunctions.sum(values)", 15},
+		{"MovingFunctions.unweightedAvg(values)", 3.75},
+		{"MovingFunctions.linearWeightedAvg(values)", (1*1 + 2*2 + 4*3 + 8*4) / 11.0},
+		{"MovingFunctions.stdDev(values, MovingFunctions.unweightedAvg(values))", math.Sqrt((2.75*2.75 + 1.75*1.75 + 0.25*0.25 + 4.25*4.25) / 4)},
+		{"MovingFunctions.ewma(values, 0.5)", 5.375},
+		{"return MovingFunctions.holt(values, 0.5, 0.5);", 5.84375},
+		{"MovingFunctions.holtWinters(values, 0.5, 0.5, 0.5, 2, false)", 5.450520833333334},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			expr, err := ParsePainless(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := expr.Eval(&Env{Variables: map[string]any{"values": values}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resFloat, ok := res.(float64); !ok || math.Abs(resFloat-tt.output) > 1e-9 {
+				t.Errorf("expected %v, got %v (%T)", tt.output, res, res)
+			}
+		})
+	}
+
+	expr, err := ParsePainless("MovingFunctions.unweightedAvg(values)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := expr.Eval(&Env{Variables: map[string]any{"values": []float64{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resFloat, ok := res.(float64); !ok || !math.IsNaN(resFloat) {
+		t.Errorf("expected NaN for empty values, got %v", res)
+	}
+}
+
+func TestDocFields(t *testing.T) {
+	expr, err := ParsePainless("if (doc.containsKey('a')) { state.x += doc['b'].value + doc.c.value } else { state.y = doc['b'].size() }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := DocFields(expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"a", "b", "c"}, fields) {
+		t.Errorf("expected [a b c], got %v", fields)
+	}
+
+	expr, err = ParsePainless("doc[params.field].value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DocFields(expr); err == nil {
+		t.Error("expected an error for a non-literal field name")
+	}
+}
+
+func TestPainlessLoopLimit(t *testing.T) {
+	expr, err := ParsePainless("while (true) { }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = expr.Eval(&Env{}); err == nil {
+		t.Error("expected an error for an endless loop")
+	}
+}
+
+func TestPainlessSyntaxErrors(t *testing.T) {
+	for _, script := range []string{"1 +", "doc['a'].value >", "if (true) { return 1;", "'unterminated"} {
+		t.Run(script, func(t *testing.T) {
+			if _, err := ParsePainless(script); err == nil {
+				t.Errorf("expected an error for: %s", script)
+			}
+		})
+	}
+}
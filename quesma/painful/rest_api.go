@@ -99,11 +99,16 @@ func (s ScriptRequest) Eval() (res ScriptResponse, err error) {
 		return res, err
 	}
 
-	_, err = evalTree.Eval(env)
+	val, err := evalTree.Eval(env)
 	if err != nil {
 		return res, err
 	}
 
+	// scripts of runtime fields emit values, others return them
+	if env.EmitValue == nil {
+		env.EmitValue = val
+	}
+
 	res.Result = []any{env.EmitValue}
 
 	return res, nil
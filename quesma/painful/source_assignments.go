@@ -0,0 +1,139 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Update scripts (e.g. `_update_by_query`) are executed in ClickHouse as `ALTER TABLE ... UPDATE`,
+// so only a simple form is supported: a list of assignments to `ctx._source` fields, like
+//
+//	ctx._source.status = 'closed'; ctx._source.count += params.increment; ctx._source.remove('tmp')
+
+// SourceAssignment is a single statement of an update script
+type SourceAssignment struct {
+	Field    string
+	Operator string // "=", "+=", "-=", "*=", or "remove"
+	Value    any    // string, float64, bool, nil (literals or params) or SourceField
+}
+
+// SourceField is a reference to another field of the document, `ctx._source.field`
+type SourceField string
+
+const RemoveOperator = "remove"
+
+var (
+	sourceFieldPattern  = `ctx\._source(?:\.([A-Za-z_@][\w.@]*)|\[\s*(?:'([^']+)'|"([^"]+)")\s*])`
+	assignmentRegex     = regexp.MustCompile(`^` + sourceFieldPattern + `\s*([+\-*]?=)\s*(.+)$`)
+	removeRegex         = regexp.MustCompile(`^ctx\._source\.remove\(\s*(?:'([^']+)'|"([^"]+)")\s*\)$`)
+	sourceFieldRegex    = regexp.MustCompile(`^` + sourceFieldPattern + `$`)
+	paramReferenceRegex = regexp.MustCompile(`^params(?:\.([\w.]+)|\[\s*(?:'([^']+)'|"([^"]+)")\s*])$`)
+)
+
+func ParseSourceAssignments(source string, params map[string]any) ([]SourceAssignment, error) {
+	statements, err := splitStatements(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []SourceAssignment
+	for _, statement := range statements {
+		if match := removeRegex.FindStringSubmatch(statement); match != nil {
+			assignments = append(assignments, SourceAssignment{Field: firstNonEmpty(match[1:]), Operator: RemoveOperator})
+			continue
+		}
+
+		match := assignmentRegex.FindStringSubmatch(statement)
+		if match == nil {
+			return nil, fmt.Errorf("unsupported statement [%s], only assignments to ctx._source fields are supported", statement)
+		}
+		value, err := parseValue(strings.TrimSpace(match[5]), params)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, SourceAssignment{Field: firstNonEmpty(match[1:4]), Operator: match[4], Value: value})
+	}
+
+	if len(assignments) == 0 {
+		return nil, fmt.Errorf("script [%s] has no statements", source)
+	}
+	return assignments, nil
+}
+
+// splitStatements splits the script on `;`, skipping the ones inside string literals
+func splitStatements(source string) ([]string, error) {
+	var statements []string
+	var quote rune
+	start := 0
+	for i, c := range source {
+		switch {
+		case quote != 0 && c == '\\':
+			continue
+		case quote != 0 && c == quote && source[i-1] != '\\':
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == 0 && c == ';':
+			statements = append(statements, source[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string literal in script [%s]", source)
+	}
+	statements = append(statements, source[start:])
+
+	result := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			result = append(result, statement)
+		}
+	}
+	return result, nil
+}
+
+func parseValue(value string, params map[string]any) (any, error) {
+	switch {
+	case value == "null":
+		return nil, nil
+	case value == "true" || value == "false":
+		return value == "true", nil
+	case len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]:
+		unescaped := strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\"`, `"`).Replace(value[1 : len(value)-1])
+		return unescaped, nil
+	}
+
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number, nil
+	}
+	if match := sourceFieldRegex.FindStringSubmatch(value); match != nil {
+		return SourceField(firstNonEmpty(match[1:])), nil
+	}
+	if match := paramReferenceRegex.FindStringSubmatch(value); match != nil {
+		name := firstNonEmpty(match[1:])
+		param, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("parameter [%s] is not defined", name)
+		}
+		switch param.(type) {
+		case string, float64, bool, nil:
+			return param, nil
+		default:
+			return nil, fmt.Errorf("parameter [%s] of type [%T] is not supported", name, param)
+		}
+	}
+	return nil, fmt.Errorf("unsupported expression [%s], only literals, params and ctx._source fields are supported", value)
+}
+
+func firstNonEmpty(values []string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painful
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseSourceAssignments(t *testing.T) {
+	params := map[string]any{"status": "closed", "inc": 2.0, "obj": map[string]any{}}
+
+	assignments, err := ParseSourceAssignments(`ctx._source.status = params.status; ctx._source['count'] += params["inc"];
+		ctx._source.note = 'a;b \'c\''; ctx._source.copy = ctx._source.other; ctx._source.flag = true; ctx._source.remove('tmp');`, params)
+	require.NoError(t, err)
+	assert.Equal(t, []SourceAssignment{
+		{Field: "status", Operator: "=", Value: "closed"},
+		{Field: "count", Operator: "+=", Value: 2.0},
+		{Field: "note", Operator: "=", Value: "a;b 'c'"},
+		{Field: "copy", Operator: "=", Value: SourceField("other")},
+		{Field: "flag", Operator: "=", Value: true},
+		{Field: "tmp", Operator: RemoveOperator},
+	}, assignments)
+
+	for _, script := range []string{
+		"",
+		"ctx._source.a = params.missing",
+		"ctx._source.a = params.obj",
+		"ctx._source.a = 'unterminated",
+		"if (ctx._source.a == null) { ctx._source.a = 1 }",
+		"ctx._source.a = ctx._source.b + 1",
+	} {
+		_, err := ParseSourceAssignments(script, params)
+		assert.Error(t, err, script)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/metrics_aggregations"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
 	"regexp"
 	"slices"
 	"strconv"
@@ -16,17 +18,26 @@ const keyedDefaultValuePercentileRanks = true
 
 type metricsAggregation struct {
 	AggrType            string
-	Fields              []model.Expr            // on these fields we're doing aggregation. Array, because e.g. 'top_hits' can have multiple fields
-	OrderBy             []model.OrderByExpr     // only for top_hits
-	FieldType           clickhouse.DateTimeType // field type of FieldNames[0]. If it's a date field, a slightly different response is needed
-	Percentiles         map[string]float64      // Only for percentiles and percentile_ranks aggregation
-	Keyed               bool                    // Only for percentiles aggregation
-	CutValues           []string                // Only for percentile_ranks
-	SortBy              string                  // Only for top_metrics
-	Size                int                     // Only for top_metrics
-	Order               string                  // Only for top_metrics
-	IsFieldNameCompound bool                    // Only for a few aggregations, where we have only 1 field. It's a compound, so e.g. toHour(timestamp), not just "timestamp"
-	sigma               float64                 // only for standard deviation
+	Fields              []model.Expr                               // on these fields we're doing aggregation. Array, because e.g. 'top_hits' can have multiple fields
+	OrderBy             []model.OrderByExpr                        // only for top_hits
+	FieldType           clickhouse.DateTimeType                    // field type of FieldNames[0]. If it's a date field, a slightly different response is needed
+	Percentiles         map[string]float64                         // Only for percentiles and percentile_ranks aggregation
+	Keyed               bool                                       // Only for percentiles aggregation
+	CutValues           []string                                   // Only for percentile_ranks
+	SortBy              string                                     // Only for top_metrics
+	Size                int                                        // Only for top_metrics
+	Order               string                                     // Only for top_metrics
+	IsFieldNameCompound bool                                       // Only for a few aggregations, where we have only 1 field. It's a compound, so e.g. toHour(timestamp), not just "timestamp"
+	sigma               float64                                    // only for standard deviation
+	FieldNames          []string                                   // only for matrix_stats and scripted_metric, names of Fields, as requested by the user
+	Filters             []model.Expr                               // only for t_test, filters of samples 'a' and 'b' (nil if there's no filter)
+	TTestType           metrics_aggregations.TTestType             // only for t_test
+	Tails               int                                        // only for t_test
+	Unit                string                                     // only for rate
+	Mode                string                                     // only for rate
+	ShowDistribution    bool                                       // only for string_stats
+	Scripts             metrics_aggregations.ScriptedMetricScripts // only for scripted_metric
+	Significance        significanceParams                         // only for significant_text
 }
 
 type aggregationParser = func(queryMap QueryMap) (model.QueryType, error)
@@ -34,16 +45,17 @@ type aggregationParser = func(queryMap QueryMap) (model.QueryType, error)
 const metricsAggregationDefaultFieldType = clickhouse.Invalid
 
 // Tries to parse metrics aggregation from queryMap. If it's not a metrics aggregation, returns false.
-func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (metricAggregation metricsAggregation, success bool) {
+// Error is returned only if it's a metrics aggregation, but with invalid parameters.
+func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (metricAggregation metricsAggregation, success bool, err error) {
 	if len(queryMap) != 1 {
-		return metricsAggregation{}, false
+		return metricsAggregation{}, false, nil
 	}
 	const dateInSchemaExpected = false
 
 	// full list: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-Aggregations-metrics.html
 	// shouldn't be hard to handle others, if necessary
 
-	metricsAggregations := []string{"sum", "avg", "min", "max", "cardinality", "value_count", "stats", "geo_centroid"}
+	metricsAggregations := []string{"sum", "avg", "min", "max", "cardinality", "value_count", "stats", "geo_centroid", "geo_bounds"}
 	for k, v := range queryMap {
 		if slices.Contains(metricsAggregations, k) {
 			field, isFromScript := cw.parseFieldFieldMaybeScript(v, k)
@@ -53,7 +65,7 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 				Fields:              []model.Expr{field},
 				FieldType:           cw.GetDateTimeTypeFromSelectClause(cw.Ctx, field, dateInSchemaExpected),
 				IsFieldNameCompound: isFromScript,
-			}, true
+			}, true, nil
 		}
 	}
 
@@ -70,7 +82,7 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 			FieldType:   cw.GetDateTimeTypeFromSelectClause(cw.Ctx, field, dateInSchemaExpected),
 			Percentiles: percentiles,
 			Keyed:       keyed,
-		}, true
+		}, true, nil
 	}
 
 	if topMetrics, ok := queryMap["top_metrics"]; ok {
@@ -79,11 +91,11 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 			logger.WarnWithCtx(cw.Ctx).Msgf("top_metrics is not a map, but %T, value: %v. Using empty map.", topMetrics, topMetrics)
 		}
 		topMetricsAggrParams := cw.ParseTopMetricsAggregation(topMetricsMap)
-		return topMetricsAggrParams, true
+		return topMetricsAggrParams, true, nil
 	}
 
 	if parsedTopHits, ok := cw.parseTopHits(queryMap); ok {
-		return parsedTopHits, true
+		return parsedTopHits, true, nil
 	}
 
 	// Shortcut here. Percentile_ranks has "field" and a list of "values"
@@ -133,14 +145,14 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 			Keyed:       keyed,
 			CutValues:   cutValues,
 			Percentiles: percentiles,
-		}, true
+		}, true, nil
 	}
 
 	if extendedStatsRaw, exists := queryMap["extended_stats"]; exists {
 		extendedStats, ok := extendedStatsRaw.(QueryMap)
 		if !ok {
 			logger.WarnWithCtx(cw.Ctx).Msgf("extended_stats is not a map, but %T, value: %v. Skipping.", extendedStatsRaw, extendedStatsRaw)
-			return metricsAggregation{}, false
+			return metricsAggregation{}, false, nil
 		}
 		const defaultSigma = 2.0
 		sigma := defaultSigma
@@ -155,10 +167,32 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 			AggrType: "extended_stats",
 			Fields:   []model.Expr{cw.parseFieldField(extendedStats, "extended_stats")},
 			sigma:    sigma,
-		}, true
+		}, true, nil
+	}
+
+	for aggrType, parse := range map[string]func(QueryMap) (metricsAggregation, error){
+		"weighted_avg":              cw.parseWeightedAvg,
+		"median_absolute_deviation": cw.parseMedianAbsoluteDeviation,
+		"boxplot":                   cw.parseBoxplot,
+		"string_stats":              cw.parseStringStats,
+		"rate":                      cw.parseRate,
+		"t_test":                    cw.parseTTest,
+		"matrix_stats":              cw.parseMatrixStats,
+		"scripted_metric":           cw.parseScriptedMetric,
+		"significant_text":          cw.parseSignificantText, // without sub-aggregations it's like a metric, see bucket_aggregations.SignificantText
+		"reverse_nested":            cw.parseReverseNested,   // same as above, see bucket_aggregations.ReverseNested
+	} {
+		if paramsRaw, exists := queryMap[aggrType]; exists {
+			params, ok := paramsRaw.(QueryMap)
+			if !ok {
+				return metricsAggregation{}, true, fmt.Errorf("%s is not a map, but %T, value: %v", aggrType, paramsRaw, paramsRaw)
+			}
+			metricAggregation, err = parse(params)
+			return metricAggregation, true, err
+		}
 	}
 
-	return metricsAggregation{}, false
+	return metricsAggregation{}, false, nil
 }
 
 func (cw *ClickhouseQueryTranslator) parseTopHits(queryMap QueryMap) (parsedTopHits metricsAggregation, success bool) {
@@ -193,6 +227,201 @@ func (cw *ClickhouseQueryTranslator) parseTopHits(queryMap QueryMap) (parsedTopH
 	}, true
 }
 
+// parseMetricsField parses 'field' (or 'script') and 'missing' of a metrics aggregation
+func (cw *ClickhouseQueryTranslator) parseMetricsField(params QueryMap, aggrType string) (model.Expr, error) {
+	field, _ := cw.parseFieldFieldMaybeScript(params, aggrType)
+	if field == nil {
+		return nil, fmt.Errorf("%s aggregation needs a field or a script, params: %v", aggrType, params)
+	}
+	field, _ = cw.addMissingParameterIfPresent(field, params)
+	return field, nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseWeightedAvg(params QueryMap) (metricsAggregation, error) {
+	fields := make([]model.Expr, 0, 2)
+	for _, name := range []string{"value", "weight"} {
+		source, ok := params[name].(QueryMap)
+		if !ok {
+			return metricsAggregation{}, fmt.Errorf("weighted_avg needs '%s' map, params: %v", name, params)
+		}
+		field, err := cw.parseMetricsField(source, "weighted_avg")
+		if err != nil {
+			return metricsAggregation{}, err
+		}
+		fields = append(fields, field)
+	}
+	return metricsAggregation{AggrType: "weighted_avg", Fields: fields}, nil
+}
+
+// parseMedianAbsoluteDeviation ignores 'compression', as we compute it exactly
+func (cw *ClickhouseQueryTranslator) parseMedianAbsoluteDeviation(params QueryMap) (metricsAggregation, error) {
+	field, err := cw.parseMetricsField(params, "median_absolute_deviation")
+	return metricsAggregation{AggrType: "median_absolute_deviation", Fields: []model.Expr{field}}, err
+}
+
+// parseBoxplot ignores 'compression' and 'execution_hint', as we compute it exactly
+func (cw *ClickhouseQueryTranslator) parseBoxplot(params QueryMap) (metricsAggregation, error) {
+	field, err := cw.parseMetricsField(params, "boxplot")
+	return metricsAggregation{AggrType: "boxplot", Fields: []model.Expr{field}}, err
+}
+
+func (cw *ClickhouseQueryTranslator) parseStringStats(params QueryMap) (metricsAggregation, error) {
+	field, err := cw.parseMetricsField(params, "string_stats")
+	return metricsAggregation{
+		AggrType:         "string_stats",
+		Fields:           []model.Expr{field},
+		ShowDistribution: cw.parseBoolField(params, "show_distribution", false),
+	}, err
+}
+
+// parseRate: Fields is empty, if there's no field (then rate is a doc count per unit)
+func (cw *ClickhouseQueryTranslator) parseRate(params QueryMap) (metricsAggregation, error) {
+	const defaultMode = "sum"
+	rate := metricsAggregation{
+		AggrType: "rate",
+		Unit:     cw.parseStringField(params, "unit", ""),
+		Mode:     cw.parseStringField(params, "mode", defaultMode),
+	}
+	if _, hasField := params["field"]; hasField || params["script"] != nil {
+		field, err := cw.parseMetricsField(params, "rate")
+		if err != nil {
+			return metricsAggregation{}, err
+		}
+		rate.Fields = []model.Expr{field}
+	} else if _, hasMode := params["mode"]; hasMode {
+		return metricsAggregation{}, fmt.Errorf("the mode parameter is only supported with field or script, params: %v", params)
+	}
+	if rate.Unit != "" && !metrics_aggregations.IsRateUnit(rate.Unit) {
+		return metricsAggregation{}, fmt.Errorf("unsupported rate unit: %s", rate.Unit)
+	}
+	if rate.Mode != "sum" && rate.Mode != "value_count" {
+		return metricsAggregation{}, fmt.Errorf("unsupported rate mode: %s", rate.Mode)
+	}
+	return rate, nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseTTest(params QueryMap) (metricsAggregation, error) {
+	const defaultTails = 2
+	tTest := metricsAggregation{
+		AggrType:  "t_test",
+		TTestType: metrics_aggregations.TTestType(cw.parseStringField(params, "type", string(metrics_aggregations.TTestHeteroscedastic))),
+		Tails:     cw.parseIntField(params, "tails", defaultTails),
+	}
+	switch tTest.TTestType {
+	case metrics_aggregations.TTestPaired, metrics_aggregations.TTestHomoscedastic, metrics_aggregations.TTestHeteroscedastic:
+	default:
+		return metricsAggregation{}, fmt.Errorf("unsupported t_test type: %s", tTest.TTestType)
+	}
+	if tTest.Tails != 1 && tTest.Tails != 2 {
+		return metricsAggregation{}, fmt.Errorf("t_test tails must be 1 or 2, got: %d", tTest.Tails)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		sample, ok := params[name].(QueryMap)
+		if !ok {
+			return metricsAggregation{}, fmt.Errorf("t_test needs '%s' map, params: %v", name, params)
+		}
+		field, err := cw.parseMetricsField(sample, "t_test")
+		if err != nil {
+			return metricsAggregation{}, err
+		}
+		var filter model.Expr
+		if filterRaw, exists := sample["filter"]; exists {
+			if tTest.TTestType == metrics_aggregations.TTestPaired {
+				return metricsAggregation{}, fmt.Errorf("paired t-test doesn't support filters")
+			}
+			filterMap, ok := filterRaw.(QueryMap)
+			if !ok {
+				return metricsAggregation{}, fmt.Errorf("t_test filter is not a map, but %T, value: %v", filterRaw, filterRaw)
+			}
+			filter = cw.parseQueryMap(filterMap).WhereClause
+		}
+		tTest.Fields = append(tTest.Fields, field)
+		tTest.Filters = append(tTest.Filters, filter)
+	}
+	return tTest, nil
+}
+
+// parseMatrixStats ignores 'mode', as all our fields are single-valued, and then all modes are the same
+func (cw *ClickhouseQueryTranslator) parseMatrixStats(params QueryMap) (metricsAggregation, error) {
+	fieldsRaw, err := cw.parseArrayField(params, "fields")
+	if err != nil {
+		return metricsAggregation{}, err
+	}
+	missing, _ := params["missing"].(QueryMap)
+
+	matrixStats := metricsAggregation{AggrType: "matrix_stats"}
+	for _, fieldRaw := range fieldsRaw {
+		fieldName, ok := fieldRaw.(string)
+		if !ok {
+			return metricsAggregation{}, fmt.Errorf("matrix_stats field is not a string, but %T, value: %v", fieldRaw, fieldRaw)
+		}
+		field, _ := cw.addMissingParameterIfPresent(model.NewColumnRef(ResolveField(cw.Ctx, fieldName, cw.Schema)),
+			QueryMap{"missing": missing[fieldName]})
+		matrixStats.Fields = append(matrixStats.Fields, field)
+		matrixStats.FieldNames = append(matrixStats.FieldNames, fieldName)
+	}
+	if len(matrixStats.Fields) == 0 {
+		return metricsAggregation{}, fmt.Errorf("matrix_stats needs at least one field")
+	}
+	return matrixStats, nil
+}
+
+// parseScriptedMetric parses init/map/combine/reduce scripts. Like in Elastic, only init_script is optional.
+// Params of the aggregation and of all scripts are merged, as they're available in all of them.
+func (cw *ClickhouseQueryTranslator) parseScriptedMetric(params QueryMap) (metricsAggregation, error) {
+	scripts := metrics_aggregations.ScriptedMetricScripts{Params: make(map[string]any)}
+	if paramsRaw, exists := params["params"]; exists {
+		aggrParams, ok := paramsRaw.(QueryMap)
+		if !ok {
+			return metricsAggregation{}, fmt.Errorf("scripted_metric params are not a map, but %T, value: %v", paramsRaw, paramsRaw)
+		}
+		for name, value := range aggrParams {
+			scripts.Params[name] = value
+		}
+	}
+
+	for _, script := range []struct {
+		name     string
+		dest     *painful.Expr
+		optional bool
+	}{
+		{"init_script", &scripts.Init, true},
+		{"map_script", &scripts.Map, false},
+		{"combine_script", &scripts.Combine, false},
+		{"reduce_script", &scripts.Reduce, false},
+	} {
+		scriptRaw, exists := params[script.name]
+		if !exists {
+			if script.optional {
+				continue
+			}
+			return metricsAggregation{}, fmt.Errorf("[%s] must not be null: [scripted_metric]", script.name)
+		}
+		source, scriptParams, err := parseScriptSource(scriptRaw)
+		if err != nil {
+			return metricsAggregation{}, fmt.Errorf("scripted_metric %s: %v", script.name, err)
+		}
+		if *script.dest, err = painful.ParsePainless(source); err != nil {
+			return metricsAggregation{}, fmt.Errorf("scripted_metric %s: %v", script.name, err)
+		}
+		for name, value := range scriptParams {
+			scripts.Params[name] = value
+		}
+	}
+
+	// combine and reduce scripts have no access to documents
+	fieldNames, err := painful.DocFields(scripts.Init, scripts.Map)
+	if err != nil {
+		return metricsAggregation{}, fmt.Errorf("scripted_metric: %v", err)
+	}
+	scriptedMetric := metricsAggregation{AggrType: "scripted_metric", Scripts: scripts, FieldNames: fieldNames}
+	for _, fieldName := range fieldNames {
+		scriptedMetric.Fields = append(scriptedMetric.Fields, model.NewColumnRef(ResolveField(cw.Ctx, fieldName, cw.Schema)))
+	}
+	return scriptedMetric, nil
+}
+
 // It's not 100% full support, but 2 most common ones: source: string, and source: {includes: []string}
 // https://www.elastic.co/guide/en/elasticsearch/reference/current/search-fields.html#source-filtering
 func (cw *ClickhouseQueryTranslator) parseSourceField(source any) (fields []model.Expr) {
@@ -380,7 +609,13 @@ func (cw *ClickhouseQueryTranslator) parseFieldFromScriptField(queryMap QueryMap
 		return model.NewInfixExpr(model.NewColumnRef(matches[1]), "=", model.NewColumnRef(matches[2])), true
 	}
 
-	return
+	// c) any other script is compiled to SQL
+	compiled, err := cw.compileScript(script, nil)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't compile script: %v", err)
+		return
+	}
+	return compiled.expr, true
 }
 
 // quoteArray returns a new array with the same elements, but quoted
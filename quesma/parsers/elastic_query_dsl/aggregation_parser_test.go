@@ -700,9 +700,10 @@ func Test_parseFieldFromScriptField(t *testing.T) {
 		expectedSuccess bool
 	}{
 		{goodQueryMap("doc['field1'].value.getHour()"), model.NewFunction("toHour", model.NewColumnRef("field1")), true},
-		{goodQueryMap("doc['field1'].value.getHour() + doc['field2'].value.getHour()"), nil, false},
+		{goodQueryMap("doc['field1'].value.getHour() + doc['field2'].value.getHour()"),
+			model.NewFunction("plus", model.NewFunction("toHour", model.NewColumnRef("field1")), model.NewFunction("toHour", model.NewColumnRef("field2"))), true},
 		{goodQueryMap("doc['field1'].value.hourOfDay"), model.NewFunction("toHour", model.NewColumnRef("field1")), true},
-		{goodQueryMap("doc['field1'].value"), nil, false},
+		{goodQueryMap("doc['field1'].value"), model.NewColumnRef("field1"), true},
 		{goodQueryMap("value.getHour() + doc['field2'].value.getHour()"), nil, false},
 		{QueryMap{}, nil, false},
 		{QueryMap{"script": QueryMap{}}, nil, false},
@@ -76,6 +76,8 @@ func (p *luceneParser) buildWhereStatement(addDefaultOperator bool) model.Expr {
 		)
 	case termToken:
 		currentStatement = newLeafStatement(p.defaultFieldNames, newTermValue(currentToken.term))
+	case fuzzyTermToken:
+		currentStatement = newLeafStatement(p.defaultFieldNames, newFuzzyValue(currentToken.term, currentToken.fuzziness, p.fuzzyOptions))
 	case andToken:
 		return model.NewInfixExpr(p.WhereStatement, "AND", p.buildWhereStatement(false))
 	case orToken:
@@ -97,11 +99,16 @@ func (p *luceneParser) buildWhereStatement(addDefaultOperator bool) model.Expr {
 			return invalidStatement
 		}
 		return p.WhereStatement
+	case boostToken:
+		// boost of what we don't keep as one statement, e.g. "(a b)^2", is ignored
+		return p.WhereStatement
 	default:
 		logger.Error().Msgf("buildExpression: invalid expression, unexpected token: %#v, tokens: %v", currentToken, p.tokens)
 		return invalidStatement
 	}
 
+	currentStatement = p.withBoost(currentStatement)
+
 	if !addDefaultOperator || p.WhereStatement == nil {
 		return currentStatement
 	}
@@ -17,8 +17,9 @@ import (
 // Mainly based on this doc: https://lucene.apache.org/core/2_9_4/queryparsersyntax.html
 // Alternatively: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-query-string-query.html
 
+// Fuzzy search (e.g. roam~, roam~1 or old style roam~0.8) is supported, proximity search ("jakarta apache"~10) is not, ~10 is simply removed.
+
 // We don't support:
-// - Fuzzy search (e.g. roam~0.8, ~0.8 is simply removed)
 // - Wildcards ? and * - they are treated as regular characters
 //   (I think I'll add at least some basic support for them quite soon, it's needed for sample dashboards)
 // - escaped " inside quoted fieldnames, so e.g.
@@ -42,11 +43,21 @@ type (
 		WhereStatement model.Expr
 
 		currentSchema schema.Schema
+		fuzzyOptions  FuzzyOptions
 	}
 )
 
+// FuzzyOptions are `query_string` parameters for fuzzy terms (term~N)
+type FuzzyOptions struct {
+	Fuzziness      model.Fuzziness // used for term~ without the number
+	PrefixLength   int
+	Transpositions bool
+}
+
+var DefaultFuzzyOptions = FuzzyOptions{Fuzziness: model.FuzzinessAuto, Transpositions: true}
+
 func newLuceneParser(ctx context.Context, defaultFieldNames []string, currentSchema schema.Schema) luceneParser {
-	return luceneParser{ctx: ctx, defaultFieldNames: defaultFieldNames, tokens: make([]token, 0), currentSchema: currentSchema}
+	return luceneParser{ctx: ctx, defaultFieldNames: defaultFieldNames, tokens: make([]token, 0), currentSchema: currentSchema, fuzzyOptions: DefaultFuzzyOptions}
 }
 
 const fuzzyOperator = '~'
@@ -74,14 +85,26 @@ var specialOperators = map[string]token{
 	string(rightParenthesis): rightParenthesisToken{},
 }
 
-func TranslateToSQL(ctx context.Context, query string, fields []string, currentSchema schema.Schema) model.Expr {
+func TranslateToSQL(ctx context.Context, query string, fields []string, currentSchema schema.Schema, fuzzyOptions FuzzyOptions) model.Expr {
 	parser := newLuceneParser(ctx, fields, currentSchema)
+	parser.fuzzyOptions = fuzzyOptions
 	return parser.translateToSQL(query)
 }
 
+// TranslateToSQLWithScore is TranslateToSQL, which also returns the relevance score of matching documents (boosts, e.g. abc^2, included)
+func TranslateToSQLWithScore(ctx context.Context, query string, fields []string, currentSchema schema.Schema, fuzzyOptions FuzzyOptions) (whereClause, score model.Expr) {
+	parser := newLuceneParser(ctx, fields, currentSchema)
+	parser.fuzzyOptions = fuzzyOptions
+	whereWithBoosts := parser.translateToSQLWithBoosts(query)
+	return model.RemoveBoosts(whereWithBoosts), model.MatchScore(whereWithBoosts)
+}
+
 func (p *luceneParser) translateToSQL(query string) model.Expr {
-	query = p.removeFuzzySearchOperator(query)
-	query = p.removeBoostingOperator(query)
+	return model.RemoveBoosts(p.translateToSQLWithBoosts(query))
+}
+
+// translateToSQLWithBoosts returns the WHERE clause with boosts marked by model.NewBoostExpr
+func (p *luceneParser) translateToSQLWithBoosts(query string) model.Expr {
 	p.tokenizeQuery(query)
 	if len(p.tokens) == 1 {
 		if _, isInvalidToken := p.tokens[0].(invalidToken); isInvalidToken {
@@ -116,8 +139,13 @@ func (p *luceneParser) nextToken(query string) (tokens []token, remainingQuery s
 		}
 	}
 
+	if query[0] == boostingOperator {
+		return p.parseBoost(query)
+	}
+
 	// parsing term(:value)
 	term, remainingQuery := p.parseTerm(query, false)
+	term, remainingQuery = p.parseFuzzyOperator(term, remainingQuery)
 
 	// case 1. there's no ":value"
 	remainingQuery = strings.TrimSpace(remainingQuery)
@@ -151,7 +179,8 @@ func (p *luceneParser) parseTerm(query string, closingBoundTerm bool) (token tok
 		return p.parseRange(query)
 	default:
 		for i, r := range query {
-			if r == ' ' || r == delimiterCharacter || r == rightParenthesis || (closingBoundTerm && (r == exclusiveRangeClosingCharacter || r == inclusiveRangeClosingCharacter)) {
+			if r == ' ' || r == delimiterCharacter || r == rightParenthesis || (closingBoundTerm && (r == exclusiveRangeClosingCharacter || r == inclusiveRangeClosingCharacter)) ||
+				(r == boostingOperator && i > 0 && query[i-1] != escapeCharacter) {
 				return newTermToken(query[:i]), query[i:]
 			}
 		}
@@ -167,7 +196,7 @@ func (p *luceneParser) parseRange(query string) (token token, remainingQuery str
 			logger.Error().Msgf("parseRange: invalid range, missing value, query: %s", query)
 			return newInvalidToken(), ""
 		}
-		acceptableCharactersAfterNumber := []rune{' ', rightParenthesis}
+		acceptableCharactersAfterNumber := []rune{' ', rightParenthesis, boostingOperator}
 		if query[1] == '=' { // >=, <=
 			number, remainingQuery = p.parseNumber(query[2:], true, acceptableCharactersAfterNumber)
 			switch query[0] {
@@ -279,32 +308,70 @@ func (p *luceneParser) parseOneBound(query string, closingBound bool) (bound any
 	}
 }
 
-func (p *luceneParser) removeFuzzySearchOperator(query string) string {
-	return p.removeSpecialCharacter(query, fuzzyOperator)
+// parseFuzzyOperator turns term~[N] into a fuzzyTermToken. For a quoted term it's a proximity search, which we ignore.
+func (p *luceneParser) parseFuzzyOperator(tok token, remainingQuery string) (token, string) {
+	term, isTerm := tok.(termToken)
+	if !isTerm {
+		return tok, remainingQuery
+	}
+	if alreadyQuoted(term.term) {
+		if len(remainingQuery) > 0 && remainingQuery[0] == fuzzyOperator {
+			return tok, strings.TrimLeft(remainingQuery[1:], "0123456789.")
+		}
+		return tok, remainingQuery
+	}
+
+	operatorIdx := strings.LastIndexByte(term.term, fuzzyOperator)
+	if operatorIdx <= 0 || term.term[operatorIdx-1] == escapeCharacter {
+		return tok, remainingQuery
+	}
+	termWithoutOperator, distance := term.term[:operatorIdx], term.term[operatorIdx+1:]
+	if distance == "" {
+		return newFuzzyTermToken(termWithoutOperator, p.fuzzyOptions.Fuzziness), remainingQuery
+	}
+	similarity, err := strconv.ParseFloat(distance, 64)
+	if err != nil || similarity < 0 {
+		return tok, remainingQuery
+	}
+	// like Lucene: >= 1 is the number of edits, < 1 is the (deprecated) minimum similarity
+	var edits int
+	if similarity >= 1 {
+		edits = min(int(similarity), 2)
+	} else {
+		edits = min(int((1-similarity)*float64(len([]rune(termWithoutOperator)))), 2)
+	}
+	return newFuzzyTermToken(termWithoutOperator, model.Fuzziness{Edits: edits}), remainingQuery
 }
 
-func (p *luceneParser) removeBoostingOperator(query string) string {
-	return p.removeSpecialCharacter(query, boostingOperator)
+// parseBoost parses ^N (N may be a float, ^ alone means 1) following a term, a field:value or a parenthesis
+func (p *luceneParser) parseBoost(query string) (tokens []token, remainingQuery string) {
+	i := 1
+	for i < len(query) && (unicode.IsDigit(rune(query[i])) || query[i] == '.') {
+		i++
+	}
+	if i == 1 {
+		return []token{newBoostToken(1)}, query[1:]
+	}
+	boost, err := strconv.ParseFloat(query[1:i], 64)
+	if err != nil || boost < 0 {
+		logger.Error().Msgf("invalid boost, query: %s", query)
+		return []token{newInvalidToken()}, ""
+	}
+	return []token{newBoostToken(boost)}, query[i:]
 }
 
-func (p *luceneParser) removeSpecialCharacter(query string, specialChar byte) string {
-	var afterRemoval strings.Builder
-	for i := 0; i < len(query); i++ {
-		if query[i] == escapeCharacter && i+1 < len(query) && query[i+1] == specialChar {
-			// it's escaped, we don't remove it
-			i++
-		} else if query[i] == specialChar {
-			// remove the character together with the following number (may be float)
-			for ; i+1 < len(query) && unicode.IsDigit(rune(query[i+1])); i++ {
-			}
-			if i+1 < len(query) && query[i+1] == '.' {
-				i++
-				for ; i+1 < len(query) && unicode.IsDigit(rune(query[i+1])); i++ {
-				}
-			}
-		} else {
-			afterRemoval.WriteByte(query[i])
-		}
+// withBoost marks the statement as boosted, if the next token is a boost
+func (p *luceneParser) withBoost(statement model.Expr) model.Expr {
+	if len(p.tokens) == 0 {
+		return statement
+	}
+	boost, isBoost := p.tokens[0].(boostToken)
+	if !isBoost {
+		return statement
+	}
+	p.tokens = p.tokens[1:]
+	if boost.boost == 1 {
+		return statement
 	}
-	return afterRemoval.String()
+	return model.NewBoostExpr(statement, boost.boost)
 }
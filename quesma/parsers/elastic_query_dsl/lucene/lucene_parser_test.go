@@ -19,8 +19,8 @@ func TestTranslatingLuceneQueriesToSQL(t *testing.T) {
 	}{
 		{`title:"The Right Way" AND text:go!!`, `("title" ILIKE '%The Right Way%' AND "text" ILIKE '%go!!%')`},
 		{`title:Do it right AND right`, `((("title" ILIKE '%Do%' OR ("title" ILIKE '%it%' OR "text" ILIKE '%it%')) OR ("title" ILIKE '%right%' OR "text" ILIKE '%right%')) AND ("title" ILIKE '%right%' OR "text" ILIKE '%right%'))`},
-		{`roam~`, `("title" ILIKE '%roam%' OR "text" ILIKE '%roam%')`},
-		{`roam~0.8`, `("title" ILIKE '%roam%' OR "text" ILIKE '%roam%')`},
+		{`roam~`, `(("title" __quesma_fuzzy 'roam'~AUTO:3,6) OR ("text" __quesma_fuzzy 'roam'~AUTO:3,6))`},
+		{`roam~0.8`, `(("title" __quesma_fuzzy 'roam'~0) OR ("text" __quesma_fuzzy 'roam'~0))`},
 		{`jakarta^4 apache`, `(("title" ILIKE '%jakarta%' OR "text" ILIKE '%jakarta%') OR ("title" ILIKE '%apache%' OR "text" ILIKE '%apache%'))`},
 		{`"jakarta apache"^10`, `("title" ILIKE '%jakarta apache%' OR "text" ILIKE '%jakarta apache%')`},
 		{`"jakarta apache"~10`, `("title" ILIKE '%jakarta apache%' OR "text" ILIKE '%jakarta apache%')`},
@@ -83,6 +83,9 @@ func TestTranslatingLuceneQueriesToSQL(t *testing.T) {
 		{"log:  \"lalala lala la\" AND log: \"troll\"", `("log" ILIKE '%lalala lala la%' AND "log" ILIKE '%troll%')`},
 		{"int: 20", `"int" = 20`},
 		{`int: "20"`, `"int" ILIKE '%20%'`},
+		{`title:roam~1 AND text:foam~5`, `(("title" __quesma_fuzzy 'roam'~1) AND ("text" __quesma_fuzzy 'foam'~2))`},
+		{`title:roam\~`, `"title" ILIKE '%roam~%'`},
+		{`age:10~1`, `"age" = 10`},
 	}
 	var randomQueriesWithPossiblyIncorrectInput = []struct {
 		query string
@@ -148,3 +151,29 @@ func TestResolvePropertyNamesWhenTranslatingToSQL(t *testing.T) {
 		})
 	}
 }
+
+func TestTranslatingLuceneQueriesWithBoostsToScore(t *testing.T) {
+	defaultFieldNames := []string{"title"}
+	var queries = []struct {
+		query       string
+		wantedWhere string
+		wantedScore string
+	}{
+		{`jakarta^4 apache`, `("title" ILIKE '%jakarta%' OR "title" ILIKE '%apache%')`,
+			`plus(if("title" ILIKE '%jakarta%',multiply(("title" __quesma_score 'jakarta'),4),0),if("title" ILIKE '%apache%',("title" __quesma_score 'apache'),0))`},
+		{`title:"The Right Way"^2 AND age:>10`, `("title" ILIKE '%The Right Way%' AND "age" > '10')`,
+			`plus(multiply(("title" __quesma_score 'The Right Way'),2),1)`},
+		{`title:abc^`, `"title" ILIKE '%abc%'`, `("title" __quesma_score 'abc')`},
+	}
+	for i, tt := range queries {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			where, score := TranslateToSQLWithScore(context.Background(), tt.query, defaultFieldNames, schema.Schema{Fields: map[schema.FieldName]schema.Field{}}, FuzzyOptions{})
+			if got := model.AsString(where); got != tt.wantedWhere {
+				t.Errorf("\ngot  [%q]\nwant [%q]", got, tt.wantedWhere)
+			}
+			if got := model.AsString(score); got != tt.wantedScore {
+				t.Errorf("\ngot score  [%q]\nwant score [%q]", got, tt.wantedScore)
+			}
+		})
+	}
+}
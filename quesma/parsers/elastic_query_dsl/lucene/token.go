@@ -2,6 +2,8 @@
 // SPDX-License-Identifier: Elastic-2.0
 package lucene
 
+import "github.com/QuesmaOrg/quesma/quesma/model"
+
 type token interface{}
 
 type invalidToken struct{}
@@ -51,3 +53,20 @@ type termToken struct {
 func newTermToken(term string) termToken {
 	return termToken{term}
 }
+
+type fuzzyTermToken struct {
+	term      string
+	fuzziness model.Fuzziness
+}
+
+func newFuzzyTermToken(term string, fuzziness model.Fuzziness) fuzzyTermToken {
+	return fuzzyTermToken{term: term, fuzziness: fuzziness}
+}
+
+type boostToken struct {
+	boost float64
+}
+
+func newBoostToken(boost float64) boostToken {
+	return boostToken{boost: boost}
+}
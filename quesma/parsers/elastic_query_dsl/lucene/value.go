@@ -88,6 +88,43 @@ func (v termValue) transformSpecialCharacters() (termFinal string) {
 	return returnTerm.String()
 }
 
+// fuzzyValue is a term~N, translated to model.FuzzyOperator
+type fuzzyValue struct {
+	termValue
+	match model.FuzzyMatch
+}
+
+func newFuzzyValue(term string, fuzziness model.Fuzziness, options FuzzyOptions) fuzzyValue {
+	value := termValue{term: term}
+	return fuzzyValue{termValue: value, match: model.FuzzyMatch{
+		Term:           value.unescape(),
+		Fuzziness:      fuzziness,
+		PrefixLength:   options.PrefixLength,
+		Transpositions: options.Transpositions,
+	}}
+}
+
+func (v fuzzyValue) toExpression(fieldName string) model.Expr {
+	if _, err := strconv.ParseFloat(v.match.Term, 64); err == nil {
+		// fuzziness doesn't apply to numbers
+		return v.termValue.toExpression(fieldName)
+	}
+	return model.NewFuzzyMatchExpr(model.NewColumnRef(fieldName), v.match)
+}
+
+// unescape removes escaping of special characters, without transforming wildcards (unlike transformSpecialCharacters)
+func (v termValue) unescape() string {
+	strAsRunes := []rune(v.term)
+	var returnTerm strings.Builder
+	for i := 0; i < len(strAsRunes); i++ {
+		if strAsRunes[i] == escapeCharacter && i+1 < len(strAsRunes) && slices.Contains(specialCharacters, strAsRunes[i+1]) {
+			i++
+		}
+		returnTerm.WriteRune(strAsRunes[i])
+	}
+	return returnTerm.String()
+}
+
 type rangeValue struct {
 	lowerBound          any  // unbounded (nil) means no lower bound
 	upperBound          any  // unbounded (nil) means no upper bound
@@ -228,6 +265,9 @@ func (p *luceneParser) buildValue(stack []value, parenthesisLevel int) value {
 
 		tok := p.tokens[0]
 		p.tokens = p.tokens[1:]
+		if _, isBoost := tok.(boostToken); isBoost {
+			continue // boosts inside a field's value, e.g. title:(a^2 b), are ignored
+		}
 
 		// let's add the default OR separator, unless last token wasn't already an operator
 		var addOrSeparator bool
@@ -279,6 +319,8 @@ func (p *luceneParser) buildValue(stack []value, parenthesisLevel int) value {
 			stack = append(stack, newNotValue(p.buildValue([]value{}, 0)))
 		case termToken:
 			stack = append(stack, newTermValue(currentToken.term))
+		case fuzzyTermToken:
+			stack = append(stack, newFuzzyValue(currentToken.term, currentToken.fuzziness, p.fuzzyOptions))
 		case rangeToken:
 			stack = append(stack, currentToken.rangeValue)
 		default:
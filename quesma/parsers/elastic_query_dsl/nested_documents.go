@@ -0,0 +1,204 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/bucket_aggregations"
+	"github.com/QuesmaOrg/quesma/quesma/model/metrics_aggregations"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"strconv"
+	"strings"
+)
+
+// Nested documents (Elastic's `nested` field type) are stored as a single Array(Tuple(...)) column,
+// e.g. `comments Array(Tuple(author Nullable(String), stars Nullable(Int64)))`.
+// Queries and aggregations reference their fields by path, e.g. `comments.author`,
+// and we translate such references to elements of one nested document, e.g. `tupleElement(nested_doc, 'author')`.
+
+const (
+	nestedDocLambdaArg     = "nested_doc"             // nested query: arrayExists(nested_doc -> ..., "comments")
+	nestedDocColumnAlias   = "__quesma_nested"        // nested aggregation: ... ARRAY JOIN "comments" AS "__quesma_nested"
+	nestedParentIdAlias    = "__quesma_nested_parent" // nested aggregation: identifies parent document of a nested document
+	nestedParentIdFunction = "rowNumberInAllBlocks"
+)
+
+// nestedField returns the schema field at `path`, if it's of nested type.
+func (cw *ClickhouseQueryTranslator) nestedField(path string) (schema.Field, bool) {
+	field, found := cw.Schema.ResolveField(path)
+	return field, found && field.Type.Equal(schema.QuesmaTypeNested)
+}
+
+// nestedSubPath: e.g. for nested field `comments` and column `comments.author.keyword` returns `author`
+func nestedSubPath(nested schema.Field, columnName string) (string, bool) {
+	columnName = strings.TrimSuffix(columnName, ".keyword")
+	for _, path := range []string{nested.PropertyName.AsString(), nested.InternalPropertyName.AsString()} {
+		if subPath, found := strings.CutPrefix(columnName, path+"."); found {
+			return subPath, true
+		}
+	}
+	return "", false
+}
+
+// nestedElement: e.g. (nested_doc, `author.name`) -> tupleElement(tupleElement(nested_doc, 'author'), 'name')
+func nestedElement(nestedDoc model.Expr, subPath string) model.Expr {
+	for _, name := range strings.Split(subPath, ".") {
+		nestedDoc = model.NewFunction("tupleElement", nestedDoc, model.NewLiteralSingleQuoteString(name))
+	}
+	return nestedDoc
+}
+
+// rewriteNestedFields replaces all references to fields of `nested` documents in `expr` with elements of `nestedDoc`.
+// It also lowers MatchOperator on them, as schema transformer lowers it only for real columns.
+// Values compared with numeric or boolean fields have to be valid numbers or booleans, otherwise it fails.
+func rewriteNestedFields(expr model.Expr, nested schema.Field, nestedDoc model.Expr) (model.Expr, error) {
+	visitor := model.NewBaseVisitor()
+	var err error
+
+	// nested aggregation: parent documents (left side of ARRAY JOIN) can't reference nested documents' fields
+	visitor.OverrideVisitJoinExpr = func(b *model.BaseExprVisitor, e model.JoinExpr) interface{} {
+		return e
+	}
+
+	visitor.OverrideVisitColumnRef = func(b *model.BaseExprVisitor, e model.ColumnRef) interface{} {
+		if subPath, isNested := nestedSubPath(nested, e.ColumnName); isNested {
+			return nestedElement(nestedDoc, subPath)
+		}
+		return e
+	}
+
+	visitor.OverrideVisitInfix = func(b *model.BaseExprVisitor, e model.InfixExpr) interface{} {
+		column, isColumn := e.Left.(model.ColumnRef)
+		value, isLiteral := e.Right.(model.LiteralExpr)
+		if isColumn && isLiteral && e.Op == model.MatchOperator {
+			subPath, isNested := nestedSubPath(nested, column.ColumnName)
+			valueAsString, isString := value.Value.(string)
+			if isNested && isString {
+				valueAsString = strings.TrimSuffix(strings.TrimPrefix(valueAsString, "'"), "'")
+				elementType, _ := clickhouse.NestedElementType(nested.InternalPropertyType, subPath)
+				quesmaType, _ := clickhouse.SchemaTypeAdapter{}.Convert(elementType)
+				switch quesmaType.Name {
+				case schema.QuesmaTypeInteger.Name, schema.QuesmaTypeLong.Name, schema.QuesmaTypeUnsignedLong.Name, schema.QuesmaTypeBoolean.Name:
+					if !isValidNestedValue(quesmaType, valueAsString) {
+						err = fmt.Errorf("failed to parse [%s] as %s, value of nested field [%s]", valueAsString, quesmaType.Name, column.ColumnName)
+						return model.NewLiteral(false)
+					}
+					return model.NewInfixExpr(nestedElement(nestedDoc, subPath), "=", model.NewLiteral(valueAsString))
+				default:
+					return model.NewInfixExpr(nestedElement(nestedDoc, subPath), "iLIKE", model.NewLiteralWithEscapeType(valueAsString, model.NotEscapedLikeFull))
+				}
+			}
+		}
+		return model.NewInfixExpr(e.Left.Accept(b).(model.Expr), e.Op, e.Right.Accept(b).(model.Expr))
+	}
+
+	result := expr.Accept(visitor).(model.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isValidNestedValue tells whether the value is a literal of the numeric or boolean type, it's inlined into SQL unquoted
+func isValidNestedValue(quesmaType schema.QuesmaType, value string) bool {
+	var err error
+	switch quesmaType.Name {
+	case schema.QuesmaTypeInteger.Name, schema.QuesmaTypeLong.Name:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case schema.QuesmaTypeUnsignedLong.Name:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case schema.QuesmaTypeBoolean.Name:
+		return value == "true" || value == "false"
+	}
+	return err == nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseNestedAggregation(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	path, ok := params["path"].(string)
+	if !ok {
+		return fmt.Errorf("nested aggregation needs a path, params: %v", params)
+	}
+	nested, isNested := cw.nestedField(path)
+	if !isNested {
+		return fmt.Errorf("nested aggregation: field %s isn't of nested type", path)
+	}
+	aggregation.queryType = bucket_aggregations.NewNested(cw.Ctx, nested)
+	return nil
+}
+
+// parseReverseNestedWithSubAggregations: reverse_nested without sub-aggregations is parsed as a metrics aggregation
+func (cw *ClickhouseQueryTranslator) parseReverseNestedWithSubAggregations(*pancakeAggregationTreeNode, QueryMap) error {
+	return fmt.Errorf("reverse_nested with sub-aggregations is not supported")
+}
+
+func (cw *ClickhouseQueryTranslator) parseReverseNested(params QueryMap) (metricsAggregation, error) {
+	if _, exists := params["path"]; exists {
+		return metricsAggregation{}, fmt.Errorf("path of reverse_nested is not supported, it always goes back to the root documents")
+	}
+	return metricsAggregation{AggrType: "reverse_nested"}, nil
+}
+
+// nestedAggregation returns the top-most aggregation of the pancake, if it's nested
+func (p *pancakeModel) nestedAggregation() (bucket_aggregations.Nested, bool) {
+	if len(p.layers) == 0 || p.layers[0].nextBucketAggregation == nil {
+		return bucket_aggregations.Nested{}, false
+	}
+	nested, isNested := p.layers[0].nextBucketAggregation.queryType.(bucket_aggregations.Nested)
+	return nested, isNested
+}
+
+// checkNestedSupported: nested aggregation has to be top-level, as its pancake's FROM clause is different,
+// and reverse_nested has to be inside it.
+func checkNestedSupported(layers []*pancakeModelLayer) error {
+	isInsideNested := false
+	for i, layer := range layers {
+		for _, metric := range layer.currentMetricAggregations {
+			switch metric.queryType.(type) {
+			case bucket_aggregations.ReverseNested:
+				if !isInsideNested {
+					return fmt.Errorf("reverse_nested aggregation %s has to be inside nested aggregation", metric.name)
+				}
+			case *metrics_aggregations.TopHits, *metrics_aggregations.TopMetrics:
+				if isInsideNested {
+					return fmt.Errorf("%s aggregation %s inside nested aggregation is not supported", metric.queryType, metric.name)
+				}
+			}
+		}
+		if layer.nextBucketAggregation == nil {
+			continue
+		}
+		if _, isNested := layer.nextBucketAggregation.queryType.(bucket_aggregations.Nested); isNested {
+			if i > 0 {
+				return fmt.Errorf("nested aggregation %s is supported only as a top-level aggregation", layer.nextBucketAggregation.name)
+			}
+			isInsideNested = true
+		}
+	}
+	return nil
+}
+
+// nestedFromClause: parent documents matching the query, each joined with each of its nested documents
+// (SELECT *, rowNumberInAllBlocks() AS "__quesma_nested_parent" FROM table WHERE ...) ARRAY JOIN "comments" AS "__quesma_nested"
+func nestedFromClause(nested bucket_aggregations.Nested, table, whereClause model.Expr) model.Expr {
+	parentDocuments := model.SelectCommand{
+		Columns:     []model.Expr{model.NewWildcardExpr, model.NewAliasedExpr(model.NewFunction(nestedParentIdFunction), nestedParentIdAlias)},
+		FromClause:  table,
+		WhereClause: whereClause,
+	}
+	nestedDocuments := model.NewAliasedExpr(model.NewColumnRef(nested.Field().InternalPropertyName.AsString()), nestedDocColumnAlias)
+	return model.NewJoinExpr(model.NewParenExpr(parentDocuments), nestedDocuments, "ARRAY", nil)
+}
+
+// rewriteNestedAggregationFields: sub-aggregations of nested aggregation reference fields of nested documents,
+// which are elements of the ARRAY JOIN-ed "__quesma_nested" column
+func rewriteNestedAggregationFields(query *model.SelectCommand, nested bucket_aggregations.Nested) (*model.SelectCommand, error) {
+	nestedDoc := model.NewLiteral(strconv.Quote(nestedDocColumnAlias))
+	rewritten, err := rewriteNestedFields(query, nested.Field(), nestedDoc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return rewritten.(*model.SelectCommand), nil
+}
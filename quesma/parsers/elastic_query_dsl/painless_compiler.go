@@ -0,0 +1,549 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+)
+
+// painlessCompiler compiles Painless scripts (parsed by painful package) to SQL expressions,
+// so that script queries, script sorts and script aggregations are executed by ClickHouse.
+//
+// It's a compiler, not an interpreter: params are inlined as literals, local variables are inlined as expressions,
+// and if/else with returns becomes if(cond, then, else). Side effects and loops are not supported.
+type painlessCompiler struct {
+	ctx       context.Context
+	schema    schema.Schema
+	params    map[string]any
+	variables map[string]compiledScriptExpr
+}
+
+type scriptValueType int
+
+const (
+	scriptUnknownType scriptValueType = iota
+	scriptStringType
+	scriptNumberType
+	scriptBoolType
+	scriptDateType
+	scriptArrayType
+)
+
+type compiledScriptExpr struct {
+	expr      model.Expr
+	valueType scriptValueType
+	docValues bool // doc['field'], without .value
+}
+
+func newPainlessCompiler(ctx context.Context, schemaInstance schema.Schema, params map[string]any) *painlessCompiler {
+	return &painlessCompiler{ctx: ctx, schema: schemaInstance, params: params, variables: make(map[string]compiledScriptExpr)}
+}
+
+// compileScript parses and compiles the script, returning the SQL expression of its (returned or emitted) value
+func (c *painlessCompiler) compileScript(source string) (compiledScriptExpr, error) {
+	script, err := painful.ParsePainless(source)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+	return c.compileStatements([]painful.Expr{script})
+}
+
+// withScope returns a copy of the compiler with its own local variables, for compiling one branch of if/else
+func (c *painlessCompiler) withScope() *painlessCompiler {
+	scoped := *c
+	scoped.variables = make(map[string]compiledScriptExpr, len(c.variables))
+	for name, value := range c.variables {
+		scoped.variables[name] = value
+	}
+	return &scoped
+}
+
+func (c *painlessCompiler) compileStatements(statements []painful.Expr) (compiledScriptExpr, error) {
+	for i, statement := range statements {
+		rest := statements[i+1:]
+		switch stmt := statement.(type) {
+		case *painful.StatementsExpr:
+			return c.compileStatements(append(append([]painful.Expr{}, stmt.Statements...), rest...))
+		case *painful.AssignExpr:
+			value, err := c.compileExpr(stmt.Expr)
+			if err != nil {
+				return compiledScriptExpr{}, err
+			}
+			c.variables[stmt.Name] = value
+			if len(rest) == 0 {
+				return value, nil
+			}
+		case *painful.SetExpr, *painful.ForExpr, *painful.ForEachExpr:
+			return compiledScriptExpr{}, fmt.Errorf("'%T' is not supported in scripts", statement)
+		case *painful.ReturnExpr:
+			if stmt.Expr == nil {
+				return compiledScriptExpr{}, fmt.Errorf("script must return a value")
+			}
+			return c.compileExpr(stmt.Expr)
+		case *painful.EmitExpr:
+			return c.compileExpr(stmt.Expr)
+		case *painful.ConditionalExpr:
+			// the rest of statements is executed after the branch, unless the branch returns
+			cond, err := c.compileExpr(stmt.Cond)
+			if err != nil {
+				return compiledScriptExpr{}, err
+			}
+			then, err := c.withScope().compileStatements(append([]painful.Expr{stmt.Then}, rest...))
+			if err != nil {
+				return compiledScriptExpr{}, err
+			}
+			otherwise := rest
+			if stmt.Else != nil {
+				otherwise = append([]painful.Expr{stmt.Else}, rest...)
+			}
+			if len(otherwise) == 0 {
+				return compiledScriptExpr{}, fmt.Errorf("script must return a value in all branches of if")
+			}
+			elseValue, err := c.withScope().compileStatements(otherwise)
+			if err != nil {
+				return compiledScriptExpr{}, err
+			}
+			return newIf(cond, then, elseValue), nil
+		default:
+			// value of the last expression is returned, values of others are discarded
+			if len(rest) == 0 {
+				return c.compileExpr(statement)
+			}
+		}
+	}
+	return compiledScriptExpr{}, fmt.Errorf("script must return a value")
+}
+
+func (c *painlessCompiler) compileExpr(expr painful.Expr) (compiledScriptExpr, error) {
+	switch e := expr.(type) {
+	case *painful.LiteralExpr:
+		return newScriptLiteral(e.Value)
+	case *painful.DocExpr:
+		return c.compileDoc(e)
+	case *painful.VariableExpr:
+		if value, ok := c.variables[e.Name]; ok {
+			return value, nil
+		}
+		return compiledScriptExpr{}, fmt.Errorf("%s: cannot resolve symbol [%s]", e.Position, e.Name)
+	case *painful.AccessorExpr:
+		return c.compileAccessor(e)
+	case *painful.IndexExpr:
+		if value, isParam := c.paramValue(e); isParam {
+			return newScriptLiteral(value)
+		}
+		return compiledScriptExpr{}, fmt.Errorf("%s: indexing is not supported", e.Position)
+	case *painful.MethodCallExpr:
+		return c.compileMethodCall(e)
+	case *painful.InfixOpExpr:
+		return c.compileInfixOp(e)
+	case *painful.PrefixOpExpr:
+		return c.compilePrefixOp(e)
+	case *painful.ConditionalExpr:
+		if e.Else == nil {
+			return compiledScriptExpr{}, fmt.Errorf("if without else is not an expression")
+		}
+		return c.compileStatements([]painful.Expr{e})
+	case *painful.EmitExpr:
+		return c.compileExpr(e.Expr)
+	case *painful.UrlEncodeExpr:
+		value, err := c.compileValue(e.Expr)
+		if err != nil {
+			return compiledScriptExpr{}, err
+		}
+		return compiledScriptExpr{expr: model.NewFunction("encodeURLComponent", toStringExpr(value)), valueType: scriptStringType}, nil
+	case *painful.StatementsExpr, *painful.AssignExpr, *painful.ReturnExpr:
+		return c.compileStatements([]painful.Expr{e})
+	default:
+		return compiledScriptExpr{}, fmt.Errorf("'%T' is not supported in scripts", expr)
+	}
+}
+
+// compileValue compiles the expression, using the value of doc['field'] if needed
+func (c *painlessCompiler) compileValue(expr painful.Expr) (compiledScriptExpr, error) {
+	value, err := c.compileExpr(expr)
+	value.docValues = false
+	return value, err
+}
+
+func (c *painlessCompiler) compileDoc(doc *painful.DocExpr) (compiledScriptExpr, error) {
+	key, err := c.compileValue(doc.FieldName)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+	literal, isLiteral := key.expr.(model.LiteralExpr)
+	fieldName, isString := literal.Value.(string)
+	if !isLiteral || !isString || key.valueType != scriptStringType {
+		return compiledScriptExpr{}, fmt.Errorf("doc[...] needs a constant field name, got %s", model.AsString(key.expr))
+	}
+	fieldName = fieldName[1 : len(fieldName)-1] // remove quotes
+
+	valueType := scriptUnknownType
+	if field, found := c.schema.ResolveField(fieldName); found {
+		switch field.Type.Name {
+		case schema.QuesmaTypeText.Name, schema.QuesmaTypeKeyword.Name, schema.QuesmaTypeIp.Name:
+			valueType = scriptStringType
+		case schema.QuesmaTypeInteger.Name, schema.QuesmaTypeLong.Name, schema.QuesmaTypeUnsignedLong.Name, schema.QuesmaTypeFloat.Name:
+			valueType = scriptNumberType
+		case schema.QuesmaTypeDate.Name, schema.QuesmaTypeTimestamp.Name:
+			valueType = scriptDateType
+		case schema.QuesmaTypeBoolean.Name:
+			valueType = scriptBoolType
+		}
+	}
+	return compiledScriptExpr{expr: model.NewColumnRef(ResolveField(c.ctx, fieldName, c.schema)), valueType: valueType, docValues: true}, nil
+}
+
+// paramValue returns the value of params.x, params['x'], params.x.y, etc.
+func (c *painlessCompiler) paramValue(expr painful.Expr) (value any, isParam bool) {
+	var key painful.Expr
+	var container painful.Expr
+	switch e := expr.(type) {
+	case *painful.VariableExpr:
+		return c.params, e.Name == "params"
+	case *painful.AccessorExpr:
+		key, container = &painful.LiteralExpr{Value: e.PropertyName}, e.Expr
+	case *painful.IndexExpr:
+		key, container = e.Index, e.Expr
+	default:
+		return nil, false
+	}
+
+	containerValue, isParam := c.paramValue(container)
+	if !isParam {
+		return nil, false
+	}
+	keyLiteral, isLiteral := key.(*painful.LiteralExpr)
+	if !isLiteral {
+		return nil, false
+	}
+	switch containerTyped := containerValue.(type) {
+	case map[string]any:
+		return containerTyped[fmt.Sprintf("%v", keyLiteral.Value)], true
+	case []any:
+		if index, ok := util.ExtractInt64Maybe(keyLiteral.Value); ok && index >= 0 && int(index) < len(containerTyped) {
+			return containerTyped[index], true
+		}
+	}
+	return nil, false
+}
+
+var scriptDateProperties = map[string]string{
+	"year":         "toYear",
+	"monthOfYear":  "toMonth",
+	"dayOfMonth":   "toDayOfMonth",
+	"dayOfWeek":    "toDayOfWeek",
+	"dayOfYear":    "toDayOfYear",
+	"hourOfDay":    "toHour",
+	"minuteOfHour": "toMinute",
+	"millis":       "toUnixTimestamp64Milli",
+}
+
+func (c *painlessCompiler) compileAccessor(accessor *painful.AccessorExpr) (compiledScriptExpr, error) {
+	if value, isParam := c.paramValue(accessor); isParam {
+		return newScriptLiteral(value)
+	}
+	if variable, isVariable := accessor.Expr.(*painful.VariableExpr); isVariable && variable.Name == "Math" {
+		switch accessor.PropertyName {
+		case "PI":
+			return compiledScriptExpr{expr: model.NewFunction("pi"), valueType: scriptNumberType}, nil
+		case "E":
+			return compiledScriptExpr{expr: model.NewFunction("e"), valueType: scriptNumberType}, nil
+		}
+		return compiledScriptExpr{}, fmt.Errorf("%s: 'Math.%s' is not supported", accessor.Position, accessor.PropertyName)
+	}
+
+	target, err := c.compileExpr(accessor.Expr)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+	if target.docValues {
+		switch accessor.PropertyName {
+		case "value":
+			target.docValues = false
+			return target, nil
+		case "empty":
+			return compiledScriptExpr{expr: model.NewFunction("isNull", target.expr), valueType: scriptBoolType}, nil
+		case "length":
+			return compiledScriptExpr{expr: docValuesSize(target.expr), valueType: scriptNumberType}, nil
+		}
+	}
+	if function, isDateProperty := scriptDateProperties[accessor.PropertyName]; isDateProperty && target.valueType != scriptStringType {
+		return compiledScriptExpr{expr: dateFunction(function, target.expr), valueType: scriptNumberType}, nil
+	}
+	return compiledScriptExpr{}, fmt.Errorf("%s: '%s' property is not supported", accessor.Position, accessor.PropertyName)
+}
+
+var scriptDateMethods = map[string]string{
+	"getYear":       "toYear",
+	"getMonthValue": "toMonth",
+	"getDayOfMonth": "toDayOfMonth",
+	"getDayOfWeek":  "toDayOfWeek",
+	"getDayOfYear":  "toDayOfYear",
+	"getHour":       "toHour",
+	"getMinute":     "toMinute",
+	"getSecond":     "toSecond",
+	"getMillis":     "toUnixTimestamp64Milli",
+	"toEpochMilli":  "toUnixTimestamp64Milli",
+}
+
+var scriptMathFunctions = map[string]string{
+	"abs":    "abs",
+	"ceil":   "ceil",
+	"floor":  "floor",
+	"round":  "round",
+	"sqrt":   "sqrt",
+	"exp":    "exp",
+	"log":    "log",
+	"log10":  "log10",
+	"signum": "sign",
+	"pow":    "pow",
+	"max":    "greatest",
+	"min":    "least",
+}
+
+func (c *painlessCompiler) compileMethodCall(call *painful.MethodCallExpr) (compiledScriptExpr, error) {
+	args := make([]compiledScriptExpr, 0, len(call.Args))
+	argExprs := make([]model.Expr, 0, len(call.Args))
+	for _, arg := range call.Args {
+		argValue, err := c.compileValue(arg)
+		if err != nil {
+			return compiledScriptExpr{}, err
+		}
+		args = append(args, argValue)
+		argExprs = append(argExprs, argValue.expr)
+	}
+
+	if variable, isVariable := call.Expr.(*painful.VariableExpr); isVariable && variable.Name == "Math" {
+		function, ok := scriptMathFunctions[call.MethodName]
+		if !ok {
+			return compiledScriptExpr{}, fmt.Errorf("%s: 'Math.%s' method is not supported", call.Position, call.MethodName)
+		}
+		if len(args) != painful.MathFunctionArgs[call.MethodName] {
+			return compiledScriptExpr{}, fmt.Errorf("%s: 'Math.%s' expects %d arguments, got %d", call.Position, call.MethodName, painful.MathFunctionArgs[call.MethodName], len(args))
+		}
+		return compiledScriptExpr{expr: model.NewFunction(function, argExprs...), valueType: scriptNumberType}, nil
+	}
+
+	target, err := c.compileExpr(call.Expr)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+
+	if target.docValues {
+		switch call.MethodName {
+		case "size":
+			return compiledScriptExpr{expr: docValuesSize(target.expr), valueType: scriptNumberType}, nil
+		case "isEmpty":
+			return compiledScriptExpr{expr: model.NewFunction("isNull", target.expr), valueType: scriptBoolType}, nil
+		case "getValue":
+			target.docValues = false
+			return target, nil
+		}
+		target.docValues = false
+	}
+
+	_, isStringMethod := painful.StringMethodArgs[call.MethodName]
+	switch {
+	case target.valueType == scriptArrayType && call.MethodName == "contains" && len(args) == 1:
+		return compiledScriptExpr{expr: model.NewFunction("has", target.expr, argExprs[0]), valueType: scriptBoolType}, nil
+	case target.valueType != scriptStringType && scriptDateMethods[call.MethodName] != "":
+		return compiledScriptExpr{expr: dateFunction(scriptDateMethods[call.MethodName], target.expr), valueType: scriptNumberType}, nil
+	case call.MethodName == "toInstant" && len(args) == 0:
+		return target, nil
+	case isStringMethod && (target.valueType == scriptStringType || target.valueType == scriptUnknownType):
+		return compileStringMethod(call, target.expr, argExprs)
+	}
+	return compiledScriptExpr{}, fmt.Errorf("%s: '%s' method is not supported", call.Position, call.MethodName)
+}
+
+func compileStringMethod(call *painful.MethodCallExpr, str model.Expr, args []model.Expr) (compiledScriptExpr, error) {
+	wantArgs := painful.StringMethodArgs[call.MethodName]
+	if (wantArgs >= 0 && len(args) != wantArgs) || (wantArgs < 0 && (len(args) < 1 || len(args) > 2)) {
+		return compiledScriptExpr{}, fmt.Errorf("%s: wrong number of arguments of '%s' method: %d", call.Position, call.MethodName, len(args))
+	}
+
+	stringResult := func(expr model.Expr) (compiledScriptExpr, error) {
+		return compiledScriptExpr{expr: expr, valueType: scriptStringType}, nil
+	}
+	numberResult := func(expr model.Expr) (compiledScriptExpr, error) {
+		return compiledScriptExpr{expr: expr, valueType: scriptNumberType}, nil
+	}
+	boolResult := func(expr model.Expr) (compiledScriptExpr, error) {
+		return compiledScriptExpr{expr: expr, valueType: scriptBoolType}, nil
+	}
+
+	switch call.MethodName {
+	case "length":
+		return numberResult(model.NewFunction("lengthUTF8", str))
+	case "toLowerCase":
+		return stringResult(model.NewFunction("lower", str))
+	case "toUpperCase":
+		return stringResult(model.NewFunction("upper", str))
+	case "trim":
+		return stringResult(model.NewFunction("trimBoth", str))
+	case "isEmpty":
+		return boolResult(model.NewFunction("empty", str))
+	case "contains":
+		return boolResult(model.NewInfixExpr(model.NewFunction("positionUTF8", str, args[0]), ">", model.NewLiteral(0)))
+	case "startsWith":
+		return boolResult(model.NewFunction("startsWith", str, args[0]))
+	case "endsWith":
+		return boolResult(model.NewFunction("endsWith", str, args[0]))
+	case "indexOf":
+		return numberResult(model.NewFunction("minus", model.NewFunction("positionUTF8", str, args[0]), model.NewLiteral(1)))
+	case "equals":
+		return boolResult(model.NewInfixExpr(str, "=", args[0]))
+	case "replace":
+		return stringResult(model.NewFunction("replaceAll", str, args[0], args[1]))
+	case "substring":
+		// Java: substring(begin[, end]), 0-based, end exclusive; ClickHouse: substringUTF8(s, offset[, length]), 1-based
+		offset := model.NewFunction("plus", args[0], model.NewLiteral(1))
+		if len(args) == 1 {
+			return stringResult(model.NewFunction("substringUTF8", str, offset))
+		}
+		return stringResult(model.NewFunction("substringUTF8", str, offset, model.NewFunction("minus", args[1], args[0])))
+	}
+	return compiledScriptExpr{}, fmt.Errorf("%s: '%s' method is not supported", call.Position, call.MethodName)
+}
+
+var scriptComparisonOperators = map[string]string{"==": "=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+var scriptArithmeticFunctions = map[string]string{"+": "plus", "-": "minus", "*": "multiply", "/": "divide", "%": "modulo"}
+
+func (c *painlessCompiler) compileInfixOp(op *painful.InfixOpExpr) (compiledScriptExpr, error) {
+	left, err := c.compileValue(op.Left)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+	right, err := c.compileValue(op.Right)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+
+	switch op.Op {
+	case "&&":
+		return compiledScriptExpr{expr: model.NewInfixExpr(left.expr, "AND", right.expr), valueType: scriptBoolType}, nil
+	case "||":
+		return compiledScriptExpr{expr: model.NewInfixExpr(left.expr, "OR", right.expr), valueType: scriptBoolType}, nil
+	case "+":
+		if left.valueType == scriptStringType || right.valueType == scriptStringType {
+			return compiledScriptExpr{expr: model.NewFunction("concat", toStringExpr(left), toStringExpr(right)), valueType: scriptStringType}, nil
+		}
+	}
+
+	if function, isArithmetic := scriptArithmeticFunctions[op.Op]; isArithmetic {
+		return compiledScriptExpr{expr: model.NewFunction(function, left.expr, right.expr), valueType: scriptNumberType}, nil
+	}
+
+	if sqlOp, isComparison := scriptComparisonOperators[op.Op]; isComparison {
+		// x == null, x != null
+		if isNullLiteral(right.expr) || isNullLiteral(left.expr) {
+			value := left.expr
+			if isNullLiteral(left.expr) {
+				value = right.expr
+			}
+			switch op.Op {
+			case "==":
+				return compiledScriptExpr{expr: model.NewFunction("isNull", value), valueType: scriptBoolType}, nil
+			case "!=":
+				return compiledScriptExpr{expr: model.NewFunction("isNotNull", value), valueType: scriptBoolType}, nil
+			}
+		}
+		return compiledScriptExpr{expr: model.NewInfixExpr(parenthesized(left.expr), sqlOp, parenthesized(right.expr)), valueType: scriptBoolType}, nil
+	}
+
+	return compiledScriptExpr{}, fmt.Errorf("%s: '%s' operator is not supported", op.Position, op.Op)
+}
+
+func (c *painlessCompiler) compilePrefixOp(op *painful.PrefixOpExpr) (compiledScriptExpr, error) {
+	value, err := c.compileValue(op.Expr)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+
+	switch op.Op {
+	case "!":
+		return compiledScriptExpr{expr: model.NewPrefixExpr("NOT", []model.Expr{value.expr}), valueType: scriptBoolType}, nil
+	case "-":
+		if literal, isLiteral := value.expr.(model.LiteralExpr); isLiteral {
+			switch number := literal.Value.(type) {
+			case int64:
+				return compiledScriptExpr{expr: model.NewLiteral(-number), valueType: scriptNumberType}, nil
+			case float64:
+				return compiledScriptExpr{expr: model.NewLiteral(-number), valueType: scriptNumberType}, nil
+			}
+		}
+		return compiledScriptExpr{expr: model.NewFunction("negate", value.expr), valueType: scriptNumberType}, nil
+	}
+	return compiledScriptExpr{}, fmt.Errorf("%s: '%s' operator is not supported", op.Position, op.Op)
+}
+
+func newScriptLiteral(value any) (compiledScriptExpr, error) {
+	switch v := value.(type) {
+	case nil:
+		return compiledScriptExpr{expr: model.NewLiteral("NULL")}, nil
+	case string:
+		return compiledScriptExpr{expr: model.NewLiteral(util.SingleQuote(v)), valueType: scriptStringType}, nil
+	case bool:
+		return compiledScriptExpr{expr: model.NewLiteral(v), valueType: scriptBoolType}, nil
+	case int64, float64, int:
+		return compiledScriptExpr{expr: model.NewLiteral(v), valueType: scriptNumberType}, nil
+	case []any:
+		elements := make([]model.Expr, 0, len(v))
+		for _, element := range v {
+			elementLiteral, err := newScriptLiteral(element)
+			if err != nil {
+				return compiledScriptExpr{}, err
+			}
+			elements = append(elements, elementLiteral.expr)
+		}
+		return compiledScriptExpr{expr: model.NewFunction("array", elements...), valueType: scriptArrayType}, nil
+	default:
+		return compiledScriptExpr{}, fmt.Errorf("unsupported script value: %v (%T)", value, value)
+	}
+}
+
+func newIf(cond, then, otherwise compiledScriptExpr) compiledScriptExpr {
+	valueType := scriptUnknownType
+	if then.valueType == otherwise.valueType {
+		valueType = then.valueType
+	}
+	return compiledScriptExpr{expr: model.NewFunction("if", cond.expr, then.expr, otherwise.expr), valueType: valueType}
+}
+
+func toStringExpr(value compiledScriptExpr) model.Expr {
+	if value.valueType == scriptStringType {
+		return value.expr
+	}
+	return model.NewFunction("toString", value.expr)
+}
+
+// docValuesSize is the number of values of doc['field'], 0 or 1 as we don't have multi-valued fields
+func docValuesSize(column model.Expr) model.Expr {
+	return model.NewFunction("if", model.NewFunction("isNull", column), model.NewLiteral(0), model.NewLiteral(1))
+}
+
+func dateFunction(function string, date model.Expr) model.Expr {
+	if function == "toUnixTimestamp64Milli" {
+		return model.NewFunction(function, model.NewFunction("toDateTime64", date, model.NewLiteral(3)))
+	}
+	return model.NewFunction(function, date)
+}
+
+func isNullLiteral(expr model.Expr) bool {
+	literal, isLiteral := expr.(model.LiteralExpr)
+	return isLiteral && literal.Value == "NULL"
+}
+
+// parenthesized wraps infix expressions in parentheses, as they're rendered without them
+func parenthesized(expr model.Expr) model.Expr {
+	if _, isInfix := expr.(model.InfixExpr); isInfix {
+		return model.NewParenExpr(expr)
+	}
+	return expr
+}
@@ -0,0 +1,132 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var painlessTestSchema = schema.Schema{Fields: map[schema.FieldName]schema.Field{
+	"bytes":      {PropertyName: "bytes", InternalPropertyName: "bytes", Type: schema.QuesmaTypeLong},
+	"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	"host.name":  {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+	"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeTimestamp},
+}}
+
+func TestPainlessCompiler(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		params    map[string]any
+		wantedSql string
+	}{
+		{
+			"comparison with param",
+			"doc['bytes'].value > params.threshold",
+			map[string]any{"threshold": 1000.0},
+			`"bytes">1000`,
+		},
+		{
+			"arithmetic precedence",
+			"(doc['bytes'].value + 1) * 2 >= 10 && doc['bytes'].value % 3 != 0",
+			nil,
+			`(multiply(plus("bytes",1),2)>=10 AND modulo("bytes",3)!=0)`,
+		},
+		{
+			"null checks and negation",
+			"doc['host.name'].size() == 0 || !(doc['host.name'].value != null)",
+			nil,
+			`(if(isNull("host_name"),0,1)=0 OR NOT (isNotNull("host_name")))`,
+		},
+		{
+			"string methods and concatenation",
+			"doc['host.name'].value.toLowerCase().startsWith(params['prefix']) ? doc['host.name'].value.substring(0, 3) + '-' + doc['bytes'].value : 'other'",
+			map[string]any{"prefix": "web"},
+			`if(startsWith(lower("host_name"),'web'),concat(concat(substringUTF8("host_name",plus(0,1),minus(3,0)),'-'),toString("bytes")),'other')`,
+		},
+		{
+			"math functions and dates",
+			"Math.max(Math.abs(-doc['bytes'].value), 10) + doc['@timestamp'].value.getHour() - Math.PI",
+			nil,
+			`minus(plus(greatest(abs(negate("bytes")),10),toHour("@timestamp")),pi())`,
+		},
+		{
+			"if, else if, local variables and return",
+			`def kb = doc['bytes'].value / 1024;
+			 if (kb > params.large) { return 'large'; }
+			 else if (kb > 1) return 'medium';
+			 return 'small';`,
+			map[string]any{"large": 1024.0},
+			`if(divide("bytes",1024)>1024,'large',if(divide("bytes",1024)>1,'medium','small'))`,
+		},
+		{
+			"params list",
+			"params.hosts.contains(doc['host.name'].value)",
+			map[string]any{"hosts": []any{"a", "b"}},
+			`has(array('a','b'),"host_name")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiler := newPainlessCompiler(context.Background(), painlessTestSchema, tt.params)
+			compiled, err := compiler.compileScript(tt.source)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantedSql, model.AsString(compiled.expr))
+		})
+	}
+}
+
+func TestPainlessCompilerErrors(t *testing.T) {
+	for _, source := range []string{
+		"doc['bytes'].value >",                    // syntax error
+		"if (doc['bytes'].value > 1) return true", // no value if the condition isn't met
+		"doc[params.field].value",                 // field name must be constant
+		"unknownVariable + 1",
+		"doc['bytes'].value.someMethod()",
+		"Math.cbrt(8)",
+	} {
+		t.Run(source, func(t *testing.T) {
+			_, err := newPainlessCompiler(context.Background(), painlessTestSchema, map[string]any{"field": 1.0}).compileScript(source)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestScriptQueryAndSort(t *testing.T) {
+	table := clickhouse.Table{Name: tableName, Config: clickhouse.NewDefaultCHConfig(), Cols: map[string]*clickhouse.Column{
+		"bytes": {Name: "bytes", Type: clickhouse.NewBaseType("Int64")},
+	}}
+	cw := ClickhouseQueryTranslator{Table: &table, Ctx: context.Background(), Schema: painlessTestSchema}
+
+	query, err := types.ParseJSON(`{"script": {"script": {"source": "doc['bytes'].value * params.factor > 100", "params": {"factor": 2}, "lang": "painless"}}}`)
+	require.NoError(t, err)
+	simpleQuery := cw.parseQueryMap(query)
+	require.True(t, simpleQuery.CanParse)
+	assert.Equal(t, `multiply("bytes",2)>100`, model.AsString(simpleQuery.WhereClause))
+
+	query, err = types.ParseJSON(`{"script": {"script": "doc['bytes'].value * 2"}}`)
+	require.NoError(t, err)
+	assert.False(t, cw.parseQueryMap(query).CanParse, "script query must return a boolean")
+
+	sort, err := types.ParseJSON(`{"sort": [{"_script": {"type": "number", "script": {"source": "doc['bytes'].value % 10"}, "order": "desc"}}, {"bytes": "asc"}]}`)
+	require.NoError(t, err)
+	sortColumns := cw.parseSortFields(sort["sort"])
+	require.Len(t, sortColumns, 2)
+	assert.Equal(t, `modulo("bytes",10) DESC`, model.AsString(sortColumns[0]))
+	assert.Equal(t, `"bytes" ASC`, model.AsString(sortColumns[1]))
+}
+
+func TestScriptFieldInAggregation(t *testing.T) {
+	cw := ClickhouseQueryTranslator{Ctx: context.Background(), Schema: painlessTestSchema}
+	field, isFromScript := cw.parseFieldFromScriptField(QueryMap{"script": QueryMap{"source": "doc['bytes'].value > 1000 ? 'big' : 'small'", "lang": "painless"}})
+	require.True(t, isFromScript)
+	assert.Equal(t, `if("bytes">1000,'big','small')`, model.AsString(field))
+}
@@ -45,6 +45,12 @@ func (cw *ClickhouseQueryTranslator) PancakeParseAggregationJson(body types.JSON
 			if err != nil {
 				return nil, err
 			}
+			if err = linkRatesToDateHistograms(subAggregations, nil); err != nil {
+				return nil, err
+			}
+			if err = linkCumulativeCardinalities(cw.Ctx, subAggregations); err != nil {
+				return nil, err
+			}
 			topLevel.children = subAggregations
 		} else {
 			logger.WarnWithCtx(cw.Ctx).Msgf("aggs is not a map, but %T, aggs: %v", aggsRaw, aggsRaw)
@@ -73,6 +79,14 @@ func (cw *ClickhouseQueryTranslator) PancakeParseAggregationJson(body types.JSON
 			selectedColumns: []model.Expr{model.NewCountFunc()},
 		}
 
+		// global ignores the query, and nested counts nested documents, so we can't count hits there. We need another pancake for that.
+		if _, isNested := pancakeQueries[0].nestedAggregation(); isNested || pancakeQueries[0].isGlobal() {
+			countPancake := &pancakeModel{
+				layers:      []*pancakeModelLayer{newPancakeModelLayer(nil)},
+				whereClause: topLevel.whereClause,
+			}
+			pancakeQueries = append([]*pancakeModel{countPancake}, pancakeQueries...)
+		}
 		pancakeQueries[0].layers[0].currentMetricAggregations = append(pancakeQueries[0].layers[0].currentMetricAggregations, augmentedCountAggregation)
 	}
 
@@ -129,7 +143,10 @@ func (cw *ClickhouseQueryTranslator) pancakeParseAggregation(aggregationName str
 	}
 
 	// 1. Metrics aggregation => always leaf
-	if metricsAggrResult, isMetrics := cw.tryMetricsAggregation(queryMap); isMetrics {
+	if metricsAggrResult, isMetrics, err := cw.tryMetricsAggregation(queryMap); isMetrics || err != nil {
+		if err != nil {
+			return nil, err
+		}
 		columns, err := generateMetricSelectedColumns(cw.Ctx, metricsAggrResult)
 		if err != nil {
 			return nil, err
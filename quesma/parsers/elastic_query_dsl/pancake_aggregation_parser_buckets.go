@@ -38,13 +38,22 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		{"range", cw.parseRangeAggregation},
 		{"auto_date_histogram", cw.parseAutoDateHistogram},
 		{"geotile_grid", cw.parseGeotileGrid},
-		{"significant_terms", func(node *pancakeAggregationTreeNode, params QueryMap) error {
-			return cw.parseTermsAggregation(node, params, "significant_terms")
-		}},
+		{"geohash_grid", cw.parseGeohashGrid},
+		{"geohex_grid", cw.parseGeohexGrid},
+		{"significant_terms", cw.parseSignificantTerms},
+		{"significant_text", cw.parseSignificantTextWithSubAggregations},
 		{"multi_terms", cw.parseMultiTerms},
 		{"composite", cw.parseComposite},
 		{"ip_range", cw.parseIpRange},
 		{"ip_prefix", cw.parseIpPrefix},
+		{"rare_terms", cw.parseRareTerms},
+		{"adjacency_matrix", cw.parseAdjacencyMatrix},
+		{"variable_width_histogram", cw.parseVariableWidthHistogram},
+		{"diversified_sampler", cw.parseDiversifiedSampler},
+		{"missing", cw.parseMissing},
+		{"global", cw.parseGlobal},
+		{"nested", cw.parseNestedAggregation},
+		{"reverse_nested", cw.parseReverseNestedWithSubAggregations},
 	}
 
 	for _, aggr := range aggregationHandlers {
@@ -158,9 +167,7 @@ func (cw *ClickhouseQueryTranslator) parseTermsAggregation(aggregation *pancakeA
 		return err
 	}
 
-	terms := bucket_aggregations.NewTerms(
-		cw.Ctx, aggrName == "significant_terms", params["include"], params["exclude"],
-	)
+	terms := bucket_aggregations.NewTerms(cw.Ctx, params["include"], params["exclude"])
 
 	var didWeAddMissing, didWeUpdateFieldHere bool
 	field, isFromScript := cw.parseFieldFieldMaybeScript(params, aggrName)
@@ -197,16 +204,27 @@ func (cw *ClickhouseQueryTranslator) parseFilters(aggregation *pancakeAggregatio
 	if !exists {
 		return fmt.Errorf("filters is not a map, but %T, value: %v", params, params)
 	}
+	filters, err := cw.parseNamedFilters(filtersParamRaw)
+	if err != nil {
+		return err
+	}
+	aggregation.queryType = bucket_aggregations.NewFilters(cw.Ctx, filters)
+	aggregation.isKeyed = true
+	return nil
+}
+
+// parseNamedFilters parses {"name": {query}, ...} map of filters, used in filters and adjacency_matrix. Result is sorted by name.
+func (cw *ClickhouseQueryTranslator) parseNamedFilters(filtersParamRaw any) ([]bucket_aggregations.Filter, error) {
 	filtersParam, ok := filtersParamRaw.(QueryMap)
 	if !ok {
-		return fmt.Errorf("filters is not a map, but %T, value: %v", filtersParamRaw, filtersParamRaw)
+		return nil, fmt.Errorf("filters is not a map, but %T, value: %v", filtersParamRaw, filtersParamRaw)
 	}
 
 	filters := make([]bucket_aggregations.Filter, 0, len(filtersParam))
 	for name, filterRaw := range filtersParam {
 		filterMap, ok := filterRaw.(QueryMap)
 		if !ok {
-			return fmt.Errorf("filter is not a map, but %T, value: %v", filterRaw, filterRaw)
+			return nil, fmt.Errorf("filter is not a map, but %T, value: %v", filterRaw, filterRaw)
 		}
 		filter := cw.parseQueryMap(filterMap)
 		if filter.WhereClause == nil {
@@ -219,8 +237,72 @@ func (cw *ClickhouseQueryTranslator) parseFilters(aggregation *pancakeAggregatio
 	sort.Slice(filters, func(i, j int) bool {
 		return filters[i].Name < filters[j].Name
 	})
-	aggregation.queryType = bucket_aggregations.NewFilters(cw.Ctx, filters)
-	aggregation.isKeyed = true
+	return filters, nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseAdjacencyMatrix(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultSeparator = "&"
+	const maxFilters = 100 // index.max_adjacency_matrix_filters in Elastic
+	filters, err := cw.parseNamedFilters(params["filters"])
+	if err != nil {
+		return err
+	}
+	if len(filters) > maxFilters {
+		return fmt.Errorf("too many filters in adjacency_matrix: %d, max is %d", len(filters), maxFilters)
+	}
+	aggregation.queryType = bucket_aggregations.NewAdjacencyMatrix(cw.Ctx, filters, cw.parseStringField(params, "separator", defaultSeparator))
+	return nil
+}
+
+// rare_terms: terms with at most max_doc_count documents.
+// We order buckets by count ascending, so the rare ones come first. Others are dropped while rendering JSON.
+func (cw *ClickhouseQueryTranslator) parseRareTerms(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultMaxDocCount, maxMaxDocCount = 1, 100
+	maxDocCount := cw.parseIntField(params, "max_doc_count", defaultMaxDocCount)
+	if maxDocCount < 1 || maxDocCount > maxMaxDocCount {
+		return fmt.Errorf("max_doc_count of rare_terms must be between 1 and %d, got: %d", maxMaxDocCount, maxDocCount)
+	}
+
+	field := cw.parseFieldField(params, "rare_terms")
+	field, didWeAddMissing := cw.addMissingParameterIfPresent(field, params)
+	field, didWeUpdateField := bucket_aggregations.NewTerms(cw.Ctx, params["include"], params["exclude"]).UpdateFieldForIncludeAndExclude(field)
+	if !didWeAddMissing || didWeUpdateField {
+		aggregation.filterOutEmptyKeyBucket = true
+	}
+
+	aggregation.queryType = bucket_aggregations.NewRareTerms(cw.Ctx, maxDocCount)
+	aggregation.selectedColumns = append(aggregation.selectedColumns, field)
+	aggregation.orderBy = []model.OrderByExpr{model.NewOrderByExpr(model.NewCountFunc(), model.AscOrder)}
+	aggregation.limit = bucket_aggregations.RareTermsLimit
+	return nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseVariableWidthHistogram(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultBuckets = 10
+	buckets := cw.parseIntField(params, "buckets", defaultBuckets)
+	if buckets < 1 {
+		return fmt.Errorf("buckets of variable_width_histogram must be positive, got: %d", buckets)
+	}
+	field := cw.parseFieldField(params, "variable_width_histogram")
+
+	aggregation.queryType = bucket_aggregations.NewVariableWidthHistogram(cw.Ctx, buckets)
+	aggregation.selectedColumns = []model.Expr{
+		// Rare function that has two brackets: histogram(10)(x)
+		model.FunctionExpr{Name: fmt.Sprintf("histogram(%d)", buckets), Args: []model.Expr{model.NewFunction("toFloat64", field)}},
+	}
+	return nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseMissing(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	aggregation.queryType = bucket_aggregations.NewMissing(cw.Ctx, cw.parseFieldField(params, "missing"))
+	return nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseGlobal(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	if len(params) > 0 {
+		return fmt.Errorf("global aggregation doesn't accept any parameters, got: %v", params)
+	}
+	aggregation.queryType = bucket_aggregations.NewGlobal(cw.Ctx)
 	return nil
 }
 
@@ -230,6 +312,17 @@ func (cw *ClickhouseQueryTranslator) parseSampler(aggregation *pancakeAggregatio
 	return nil
 }
 
+func (cw *ClickhouseQueryTranslator) parseDiversifiedSampler(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultSize, defaultMaxDocsPerValue = 100, 1
+	field, _ := cw.parseFieldFieldMaybeScript(params, "diversified_sampler")
+	aggregation.queryType = bucket_aggregations.NewDiversifiedSampler(cw.Ctx,
+		cw.parseIntField(params, "shard_size", defaultSize),
+		field,
+		cw.parseIntField(params, "max_docs_per_value", defaultMaxDocsPerValue),
+	)
+	return nil
+}
+
 func (cw *ClickhouseQueryTranslator) parseRandomSampler(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
 	const defaultProbability = 0.0 // theoretically it's required
 	const defaultSeed = 0
@@ -353,6 +446,80 @@ func (cw *ClickhouseQueryTranslator) parseGeotileGrid(aggregation *pancakeAggreg
 	return nil
 }
 
+// geohash_grid: bucket key is geohashEncode(lon, lat, precision), precision is the length of the geohash (1-12)
+func (cw *ClickhouseQueryTranslator) parseGeohashGrid(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultPrecision, maxPrecision = 5, 12
+	precision, err := cw.parseGeoGridPrecision(params, "geohash_grid", defaultPrecision, maxPrecision)
+	if err != nil {
+		return err
+	}
+	fieldName, err := strconv.Unquote(model.AsString(cw.parseFieldField(params, "geohash_grid")))
+	if err != nil {
+		return err
+	}
+
+	lon := model.NewFunction("toFloat64", model.NewGeoLon(fieldName))
+	lat := model.NewFunction("toFloat64", model.NewGeoLat(fieldName))
+	cell := model.NewFunction("geohashEncode", lon, lat, model.NewLiteral(precision))
+	cw.addGeoGridBuckets(aggregation, params, cell)
+	aggregation.queryType = bucket_aggregations.NewGeoHashGrid(cw.Ctx)
+	return nil
+}
+
+// geohex_grid: bucket key is the H3 cell geoToH3(lon, lat, precision), precision is the H3 resolution (0-15)
+func (cw *ClickhouseQueryTranslator) parseGeohexGrid(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	const defaultPrecision, maxPrecision = 6, 15
+	precision, err := cw.parseGeoGridPrecision(params, "geohex_grid", defaultPrecision, maxPrecision)
+	if err != nil {
+		return err
+	}
+	fieldName, err := strconv.Unquote(model.AsString(cw.parseFieldField(params, "geohex_grid")))
+	if err != nil {
+		return err
+	}
+
+	// geoToH3 takes (lon, lat) in ClickHouse up to 24.x (newer versions can switch the order with a setting)
+	lon := model.NewFunction("toFloat64", model.NewGeoLon(fieldName))
+	lat := model.NewFunction("toFloat64", model.NewGeoLat(fieldName))
+	cell := model.NewFunction("geoToH3", lon, lat, model.NewLiteral(precision))
+	cw.addGeoGridBuckets(aggregation, params, cell)
+	aggregation.queryType = bucket_aggregations.NewGeoHexGrid(cw.Ctx)
+	return nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseGeoGridPrecision(params QueryMap, aggregationType string, defaultPrecision, maxPrecision int) (int, error) {
+	precisionRaw, exists := params["precision"]
+	if !exists {
+		return defaultPrecision, nil
+	}
+	var precision int
+	switch precisionTyped := precisionRaw.(type) {
+	case float64:
+		precision = int(precisionTyped)
+	case int:
+		precision = precisionTyped
+	case string:
+		var err error
+		if precision, err = strconv.Atoi(precisionTyped); err != nil {
+			return 0, fmt.Errorf("precision of %s as a distance is not supported: %v", aggregationType, precisionRaw)
+		}
+	default:
+		return 0, fmt.Errorf("precision of %s has unexpected type %T, value: %v", aggregationType, precisionRaw, precisionRaw)
+	}
+	if precision < 0 || precision > maxPrecision {
+		return 0, fmt.Errorf("invalid precision of %s: %d, must be between 0 and %d", aggregationType, precision, maxPrecision)
+	}
+	return precision, nil
+}
+
+// addGeoGridBuckets groups by the cell, like Elasticsearch returns `size` (default 10000) buckets with the most documents
+func (cw *ClickhouseQueryTranslator) addGeoGridBuckets(aggregation *pancakeAggregationTreeNode, params QueryMap, cell model.Expr) {
+	const defaultSize = 10000
+	aggregation.selectedColumns = append(aggregation.selectedColumns, cell)
+	aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExpr(model.NewCountFunc(), model.DescOrder))
+	aggregation.limit = cw.parseSize(params, defaultSize)
+}
+
 // TODO: In geotile_grid, without order specidfied, Elastic returns sort by key (a/b/c earlier than x/y/z if a<x or (a=x && b<y), etc.)
 // Maybe add some ordering, but doesn't seem to be very important.
 func (cw *ClickhouseQueryTranslator) parseComposite(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
@@ -362,11 +529,9 @@ func (cw *ClickhouseQueryTranslator) parseComposite(aggregation *pancakeAggregat
 	// 1) Terms (but NOT Significant Terms) 2) Histogram 3) Date histogram 4) GeoTile grid
 	// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-composite-aggregation.html
 	isValidSourceType := func(queryType model.QueryType) bool {
-		switch typed := queryType.(type) {
-		case *bucket_aggregations.Histogram, *bucket_aggregations.DateHistogram, bucket_aggregations.GeoTileGrid:
+		switch queryType.(type) {
+		case *bucket_aggregations.Histogram, *bucket_aggregations.DateHistogram, bucket_aggregations.GeoTileGrid, bucket_aggregations.Terms:
 			return true
-		case bucket_aggregations.Terms:
-			return !typed.IsSignificant()
 		default:
 			return false
 		}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/bucket_aggregations"
 	"github.com/QuesmaOrg/quesma/quesma/model/metrics_aggregations"
 	"github.com/QuesmaOrg/quesma/quesma/util"
 	"strconv"
@@ -118,6 +119,127 @@ func generateMetricSelectedColumns(ctx context.Context, metricsAggr metricsAggre
 			result = append(result, model.NewFunction("avgOrNull", castLon))
 			result = append(result, model.NewCountFunc())
 		}
+	case "geo_bounds":
+		firstExpr := getFirstExpression()
+		result = make([]model.Expr, 0, 4)
+		if col, ok := firstExpr.(model.ColumnRef); ok {
+			colName := util.FieldToColumnEncoder(col.ColumnName)
+			castLat := model.NewFunction("CAST", model.NewGeoLat(colName), model.NewLiteral("'Float'"))
+			castLon := model.NewFunction("CAST", model.NewGeoLon(colName), model.NewLiteral("'Float'"))
+			// top, left, bottom, right
+			result = append(result, model.NewFunction("maxOrNull", castLat))
+			result = append(result, model.NewFunction("minOrNull", castLon))
+			result = append(result, model.NewFunction("minOrNull", castLat))
+			result = append(result, model.NewFunction("maxOrNull", castLon))
+		}
+	case "weighted_avg":
+		result = []model.Expr{model.NewFunction("avgWeightedOrNull", metricsAggr.Fields...)}
+	case "median_absolute_deviation":
+		field := getFirstExpression()
+		median := model.FunctionExpr{Name: "quantileExact(0.5)", Args: []model.Expr{field}}
+		deviations := arrayFunctionWithAggregate("arrayMap", field, median,
+			model.NewFunction("abs", model.NewInfixExpr(model.NewLiteral("x"), "-", model.NewLiteral("y"))))
+		result = []model.Expr{model.NewFunction("arrayReduce", model.NewLiteral("'quantileExact(0.5)'"), deviations)}
+	case "boxplot":
+		field := getFirstExpression()
+		q1 := model.FunctionExpr{Name: "quantileExact(0.25)", Args: []model.Expr{field}}
+		q3 := model.FunctionExpr{Name: "quantileExact(0.75)", Args: []model.Expr{field}}
+		whiskerLength := model.NewInfixExpr(model.NewLiteral(1.5), "*", model.NewParenExpr(model.NewInfixExpr(q3, "-", q1)))
+		lowerWhisker := arrayFunctionWithAggregate("arrayFilter", field, model.NewInfixExpr(q1, "-", whiskerLength),
+			model.NewInfixExpr(model.NewLiteral("x"), ">=", model.NewLiteral("y")))
+		upperWhisker := arrayFunctionWithAggregate("arrayFilter", field, model.NewInfixExpr(q3, "+", whiskerLength),
+			model.NewInfixExpr(model.NewLiteral("x"), "<=", model.NewLiteral("y")))
+		result = []model.Expr{
+			model.NewFunction("minOrNull", field),
+			model.NewFunction("maxOrNull", field),
+			model.FunctionExpr{Name: "quantilesExact(0.25, 0.5, 0.75)", Args: []model.Expr{field}},
+			model.NewFunction("arrayMin", lowerWhisker),
+			model.NewFunction("arrayMax", upperWhisker),
+		}
+	case "string_stats":
+		field := getFirstExpression()
+		length := model.NewFunction("lengthUTF8", field)
+		// ngrams(s, 1) splits UTF-8 string into characters, and sumMap counts each of them
+		notNullField := model.NewFunction("COALESCE", field, model.NewLiteral("''"))
+		chars := model.NewFunction("ngrams", notNullField, model.NewLiteral(1))
+		ones := model.NewFunction("arrayWithConstant", model.NewFunction("lengthUTF8", notNullField), model.NewLiteral(1))
+		result = []model.Expr{
+			model.NewCountFunc(field),
+			model.NewFunction("minOrNull", length),
+			model.NewFunction("maxOrNull", length),
+			model.NewFunction("avgOrNull", length),
+			model.NewFunction("sumMap", chars, ones),
+		}
+	case "rate":
+		switch {
+		case len(metricsAggr.Fields) == 0:
+			result = []model.Expr{model.NewCountFunc()}
+		case metricsAggr.Mode == "value_count":
+			result = []model.Expr{model.NewCountFunc(getFirstExpression())}
+		default:
+			result = []model.Expr{model.NewFunction("sumOrNull", getFirstExpression())}
+		}
+	case "t_test":
+		if len(metricsAggr.Fields) != 2 || len(metricsAggr.Filters) != 2 {
+			return nil, fmt.Errorf("t_test needs 2 samples, got: %v", metricsAggr.Fields)
+		}
+		if metricsAggr.TTestType == metrics_aggregations.TTestPaired {
+			difference := model.NewInfixExpr(metricsAggr.Fields[0], "-", metricsAggr.Fields[1])
+			return []model.Expr{
+				model.NewCountFunc(difference),
+				model.NewFunction("avgOrNull", difference),
+				model.NewFunction("varSamp", difference),
+			}, nil
+		}
+		result = make([]model.Expr, 0, 6)
+		for i, field := range metricsAggr.Fields {
+			if filter := metricsAggr.Filters[i]; filter != nil {
+				result = append(result,
+					model.NewFunction("countIf", field, filter),
+					model.NewFunction("avgOrNullIf", field, filter),
+					model.NewFunction("varSampIf", field, filter))
+			} else {
+				result = append(result,
+					model.NewCountFunc(field),
+					model.NewFunction("avgOrNull", field),
+					model.NewFunction("varSamp", field))
+			}
+		}
+	case "matrix_stats":
+		// only documents with all fields present are taken into account
+		allPresent := make([]model.Expr, 0, len(metricsAggr.Fields))
+		for _, field := range metricsAggr.Fields {
+			allPresent = append(allPresent, model.NewInfixExpr(field, "IS", model.NewLiteral("NOT NULL")))
+		}
+		condition := model.And(allPresent)
+
+		result = []model.Expr{model.NewFunction("countIf", condition)}
+		for _, field := range metricsAggr.Fields {
+			for _, function := range []string{"avgOrNullIf", "varSampIf", "skewPopIf", "kurtPopIf"} {
+				result = append(result, model.NewFunction(function, field, condition))
+			}
+		}
+		for i, field := range metricsAggr.Fields {
+			for _, otherField := range metricsAggr.Fields[i+1:] {
+				result = append(result,
+					model.NewFunction("covarSampIf", field, otherField, condition),
+					model.NewFunction("corrIf", field, otherField, condition))
+			}
+		}
+	case "scripted_metric":
+		// documents are sent to Quesma, and scripts are evaluated there
+		result = []model.Expr{model.NewCountFunc()}
+		if len(metricsAggr.Fields) > 0 {
+			documents := model.FunctionExpr{
+				Name: fmt.Sprintf("groupArray(%d)", metrics_aggregations.ScriptedMetricMaxDocs),
+				Args: []model.Expr{model.NewFunction("tuple", metricsAggr.Fields...)},
+			}
+			result = append(result, documents)
+		}
+	case "significant_text":
+		result = significantTextSelectedColumns(getFirstExpression(), metricsAggr.Significance.backgroundFilter)
+	case "reverse_nested":
+		result = []model.Expr{model.NewFunction("uniqExact", model.NewLiteral(strconv.Quote(nestedParentIdAlias)))}
 	default:
 		logger.WarnWithCtx(ctx).Msgf("unknown metrics aggregation: %s", metricsAggr.AggrType)
 		return nil, fmt.Errorf("unknown metrics aggregation %s", metricsAggr.AggrType)
@@ -153,6 +275,69 @@ func generateMetricsType(ctx context.Context, metricsAggr metricsAggregation) mo
 		return metrics_aggregations.NewPercentileRanks(ctx, metricsAggr.CutValues, metricsAggr.Keyed)
 	case "geo_centroid":
 		return metrics_aggregations.NewGeoCentroid(ctx)
+	case "geo_bounds":
+		return metrics_aggregations.NewGeoBounds(ctx)
+	case "weighted_avg":
+		return metrics_aggregations.NewWeightedAvg(ctx)
+	case "median_absolute_deviation":
+		return metrics_aggregations.NewMedianAbsoluteDeviation(ctx)
+	case "boxplot":
+		return metrics_aggregations.NewBoxplot(ctx)
+	case "string_stats":
+		return metrics_aggregations.NewStringStats(ctx, metricsAggr.ShowDistribution)
+	case "rate":
+		return metrics_aggregations.NewRate(ctx, metricsAggr.Unit)
+	case "t_test":
+		return metrics_aggregations.NewTTest(ctx, metricsAggr.TTestType, metricsAggr.Tails)
+	case "matrix_stats":
+		return metrics_aggregations.NewMatrixStats(ctx, metricsAggr.FieldNames)
+	case "scripted_metric":
+		return metrics_aggregations.NewScriptedMetric(ctx, metricsAggr.Scripts, metricsAggr.FieldNames)
+	case "significant_text":
+		significance := metricsAggr.Significance
+		return bucket_aggregations.NewSignificantText(ctx, significance.heuristic, significance.minDocCount, significance.size)
+	case "reverse_nested":
+		return bucket_aggregations.NewReverseNested(ctx)
+	}
+	return nil
+}
+
+// arrayFunctionWithAggregate returns e.g. arrayMap((x, y) -> lambdaBody, groupArray(field), arrayWithConstant(count(field), aggregate)),
+// so lambdaBody can use every value of the field (x) together with an aggregate over it (y), e.g. median.
+// Clickhouse doesn't allow aggregate functions inside lambdas, that's why we pass it as an array.
+func arrayFunctionWithAggregate(arrayFunction string, field, aggregate, lambdaBody model.Expr) model.Expr {
+	return model.NewFunction(arrayFunction,
+		model.NewLambdaExpr([]string{"x", "y"}, lambdaBody),
+		model.NewFunction("groupArray", field),
+		model.NewFunction("arrayWithConstant", model.NewCountFunc(field), aggregate),
+	)
+}
+
+// linkRatesToDateHistograms passes the nearest parent date_histogram's interval to every rate aggregation.
+// Some rates (e.g. per day in monthly buckets) also need the bucket's start, so we select it here as well.
+func linkRatesToDateHistograms(nodes []*pancakeAggregationTreeNode, parentDateHistogram *bucket_aggregations.DateHistogram) error {
+	for _, node := range nodes {
+		dateHistogram := parentDateHistogram
+		switch queryType := node.queryType.(type) {
+		case *metrics_aggregations.Rate:
+			if dateHistogram == nil {
+				return fmt.Errorf("rate aggregation %s must be inside a date_histogram", node.name)
+			}
+			interval, intervalType := dateHistogram.Interval()
+			isCalendar := intervalType == bucket_aggregations.DateHistogramCalendarInterval
+			needsBucketStart, err := queryType.SetDateHistogramInterval(interval, isCalendar, dateHistogram.Timezone())
+			if err != nil {
+				return err
+			}
+			if needsBucketStart {
+				node.selectedColumns = append(node.selectedColumns, model.NewFunction("minOrNull", dateHistogram.Field()))
+			}
+		case *bucket_aggregations.DateHistogram:
+			dateHistogram = queryType
+		}
+		if err := linkRatesToDateHistograms(node.children, dateHistogram); err != nil {
+			return err
+		}
 	}
 	return nil
 }
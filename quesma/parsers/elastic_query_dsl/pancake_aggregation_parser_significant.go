@@ -0,0 +1,173 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/bucket_aggregations"
+	"slices"
+)
+
+// significanceParams are parameters shared by significant_terms and significant_text
+type significanceParams struct {
+	heuristic        bucket_aggregations.SignificanceHeuristic
+	backgroundFilter model.Expr // nil <=> whole table is the background
+	size             int
+	shardSize        int
+	minDocCount      int64
+}
+
+// significanceParamNames are parameters of significant_terms which terms doesn't have
+var significanceParamNames = []string{"background_filter", "min_doc_count", "shard_size",
+	"jlh", "mutual_information", "chi_square", "gnd", "percentage", "script_heuristic"}
+
+func (cw *ClickhouseQueryTranslator) parseSignificanceParams(params QueryMap, aggrType string) (result significanceParams, err error) {
+	const defaultSize = 10
+	result.size = cw.parseSize(params, defaultSize)
+	// Elastic's default: 2 * (1.5 * size + 10). We request that many most frequent terms from the database.
+	result.shardSize = cw.parseIntField(params, "shard_size", 3*result.size+20)
+	if result.shardSize < result.size {
+		result.shardSize = result.size
+	}
+	result.minDocCount = cw.parseInt64Field(params, "min_doc_count", bucket_aggregations.SignificantTermsDefaultMinDocCount)
+
+	if filterRaw, exists := params["background_filter"]; exists {
+		filter, ok := filterRaw.(QueryMap)
+		if !ok {
+			return result, fmt.Errorf("background_filter of %s is not a map, but %T, value: %v", aggrType, filterRaw, filterRaw)
+		}
+		result.backgroundFilter = cw.parseQueryMap(filter).WhereClause
+	}
+
+	result.heuristic = bucket_aggregations.JLH{}
+	heuristicsNr := 0
+	for _, name := range []string{"jlh", "mutual_information", "chi_square", "gnd", "percentage", "script_heuristic"} {
+		heuristicParamsRaw, exists := params[name]
+		if !exists {
+			continue
+		}
+		heuristicsNr++
+		heuristicParams, ok := heuristicParamsRaw.(QueryMap)
+		if !ok {
+			return result, fmt.Errorf("%s of %s is not a map, but %T, value: %v", name, aggrType, heuristicParamsRaw, heuristicParamsRaw)
+		}
+		includeNegatives := cw.parseBoolField(heuristicParams, "include_negatives", false)
+		backgroundIsSuperset := cw.parseBoolField(heuristicParams, "background_is_superset", true)
+		switch name {
+		case "jlh":
+			result.heuristic = bucket_aggregations.JLH{}
+		case "mutual_information":
+			result.heuristic = bucket_aggregations.MutualInformation{IncludeNegatives: includeNegatives, BackgroundIsSuperset: backgroundIsSuperset}
+		case "chi_square":
+			result.heuristic = bucket_aggregations.ChiSquare{IncludeNegatives: includeNegatives, BackgroundIsSuperset: backgroundIsSuperset}
+		case "gnd":
+			result.heuristic = bucket_aggregations.GND{BackgroundIsSuperset: backgroundIsSuperset}
+		case "percentage":
+			result.heuristic = bucket_aggregations.Percentage{}
+		default:
+			return result, fmt.Errorf("%s is not supported in %s", name, aggrType)
+		}
+	}
+	if heuristicsNr > 1 {
+		return result, fmt.Errorf("%s accepts at most one significance heuristic, params: %v", aggrType, params)
+	}
+	return result, nil
+}
+
+// parseSignificantTerms: we request shard_size most frequent terms, each with its background count
+// (see generateSignificantTermsQuery), then they're scored, filtered and sorted while rendering JSON.
+func (cw *ClickhouseQueryTranslator) parseSignificantTerms(aggregation *pancakeAggregationTreeNode, params QueryMap) error {
+	significance, err := cw.parseSignificanceParams(params, "significant_terms")
+	if err != nil {
+		return err
+	}
+
+	termsParams := make(QueryMap, len(params))
+	for name, value := range params {
+		if !slices.Contains(significanceParamNames, name) {
+			termsParams[name] = value
+		}
+	}
+	if err = cw.parseTermsAggregation(aggregation, termsParams, "significant_terms"); err != nil {
+		return err
+	}
+
+	aggregation.queryType = bucket_aggregations.NewSignificantTerms(cw.Ctx, significance.heuristic, significance.backgroundFilter,
+		significance.minDocCount, significance.size)
+	aggregation.limit = significance.shardSize
+	return nil
+}
+
+// parseSignificantTextWithSubAggregations: significant_text without sub-aggregations is parsed as a metrics aggregation
+func (cw *ClickhouseQueryTranslator) parseSignificantTextWithSubAggregations(*pancakeAggregationTreeNode, QueryMap) error {
+	return fmt.Errorf("significant_text with sub-aggregations is not supported")
+}
+
+func (cw *ClickhouseQueryTranslator) parseSignificantText(params QueryMap) (metricsAggregation, error) {
+	significance, err := cw.parseSignificanceParams(params, "significant_text")
+	if err != nil {
+		return metricsAggregation{}, err
+	}
+	for _, unsupported := range []string{"source_fields", "include", "exclude"} {
+		if _, exists := params[unsupported]; exists {
+			return metricsAggregation{}, fmt.Errorf("%s of significant_text is not supported", unsupported)
+		}
+	}
+	// filter_duplicate_text is ignored, we have no near-duplicate detection
+	field := cw.parseFieldField(params, "significant_text")
+	if field == nil {
+		return metricsAggregation{}, fmt.Errorf("significant_text needs a field, params: %v", params)
+	}
+	return metricsAggregation{AggrType: "significant_text", Fields: []model.Expr{field}, Significance: significance}, nil
+}
+
+// significantTextSelectedColumns returns: foreground size, foreground doc counts of words ([words], [counts]),
+// background doc counts of the same words, background size
+func significantTextSelectedColumns(field model.Expr, backgroundFilter model.Expr) []model.Expr {
+	// words of a document, lowercase, without duplicates
+	words := model.NewFunction("arrayDistinct",
+		model.NewFunction("splitByNonAlpha", model.NewFunction("lower", model.NewFunction("COALESCE", field, model.NewLiteral("''")))))
+	ones := model.NewFunction("arrayWithConstant", model.NewFunction("length", words), model.NewLiteral(1))
+
+	foregroundCounts := model.NewFunction("sumMap", words, ones)
+	backgroundCounts := significantBackgroundCounts(words, ones, backgroundFilter)
+	return []model.Expr{
+		model.NewCountFunc(),
+		foregroundCounts,
+		model.NewFunction("arrayMap",
+			model.NewLambdaExpr([]string{"x"}, significantBackgroundCount(model.NewLiteral("x"), backgroundCounts)),
+			model.NewFunction("tupleElement", foregroundCounts, model.NewLiteral(1)),
+		),
+		significantBackgroundSize(backgroundFilter),
+	}
+}
+
+// significantBackgroundCounts returns a scalar subquery with background doc counts of all keys:
+// (SELECT sumMap(keys, ones) FROM table WHERE whereClause), where keys are distinct keys of a single document.
+// Its result is ([keys], [counts]).
+func significantBackgroundCounts(keys, ones, whereClause model.Expr) model.Expr {
+	return model.NewParenExpr(model.SelectCommand{
+		Columns:     []model.Expr{model.NewFunction("sumMap", keys, ones)},
+		FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+		WhereClause: whereClause,
+	})
+}
+
+// significantBackgroundCount returns background doc count of a key, 0 if it's absent in background
+func significantBackgroundCount(key, backgroundCounts model.Expr) model.Expr {
+	return model.NewFunction("transform", key,
+		model.NewFunction("tupleElement", backgroundCounts, model.NewLiteral(1)),
+		model.NewFunction("tupleElement", backgroundCounts, model.NewLiteral(2)),
+		model.NewFunction("toUInt64", model.NewLiteral(0)),
+	)
+}
+
+// significantBackgroundSize returns a scalar subquery: (SELECT count(*) FROM table WHERE backgroundFilter)
+func significantBackgroundSize(backgroundFilter model.Expr) model.Expr {
+	return model.NewParenExpr(model.SelectCommand{
+		Columns:     []model.Expr{model.NewCountFunc()},
+		FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+		WhereClause: backgroundFilter,
+	})
+}
@@ -181,7 +181,7 @@ func (p *pancakeJSONRenderer) potentiallyRemoveExtraBucket(layer *pancakeModelLa
 func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeModelLayer, rows []model.QueryResultRow) (model.JsonMap, error) {
 	layer := remainingLayers[0]
 	switch queryType := layer.nextBucketAggregation.queryType.(type) {
-	case bucket_aggregations.SamplerInterface, bucket_aggregations.FilterAgg:
+	case bucket_aggregations.SamplerInterface, bucket_aggregations.FilterAgg, bucket_aggregations.Missing, bucket_aggregations.Global, bucket_aggregations.Nested:
 		selectedRows := p.selectMetricRows(layer.nextBucketAggregation.InternalNameForCount(), rows)
 		aggJson := layer.nextBucketAggregation.queryType.TranslateSqlResponseToJson(selectedRows)
 		subAggr, err := p.layerToJSON(remainingLayers[1:], rows)
@@ -205,6 +205,9 @@ func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeM
 
 			selectedRows := p.selectMetricRows(layer.nextBucketAggregation.InternalNameForCount(), selectedRowsWithoutPrefix)
 			aggJson := queryType.CombinatorTranslateSqlResponseToJson(subGroup, selectedRows)
+			if aggJson == nil { // e.g. empty bucket of adjacency_matrix, which Elastic omits
+				continue
+			}
 
 			mergeResult, mergeErr := util.MergeMaps(aggJson, subAggr)
 			if mergeErr != nil {
@@ -236,6 +239,40 @@ func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeM
 	}
 }
 
+// selectBucketRows returns rows of buckets with given indexes, in the same order
+func (p *pancakeJSONRenderer) selectBucketRows(indexes []int, bucketRows []model.QueryResultRow,
+	subAggrRows [][]model.QueryResultRow) ([]model.QueryResultRow, [][]model.QueryResultRow) {
+
+	selectedBucketRows := make([]model.QueryResultRow, 0, len(indexes))
+	selectedSubAggrRows := make([][]model.QueryResultRow, 0, len(indexes))
+	for _, idx := range indexes {
+		selectedBucketRows = append(selectedBucketRows, bucketRows[idx])
+		selectedSubAggrRows = append(selectedSubAggrRows, subAggrRows[idx])
+	}
+	return selectedBucketRows, selectedSubAggrRows
+}
+
+// rowsOfSelectedBuckets returns only rows of buckets which end up in the response, if the next bucket aggregation
+// selects its buckets in Quesma (e.g. significant_terms). Sibling pipelines need to see the same buckets as the response.
+func (p *pancakeJSONRenderer) rowsOfSelectedBuckets(layer *pancakeModelLayer, rows []model.QueryResultRow) []model.QueryResultRow {
+	if layer.nextBucketAggregation == nil {
+		return rows
+	}
+	selector, ok := layer.nextBucketAggregation.queryType.(bucket_aggregations.BucketsSelectorInterface)
+	if !ok {
+		return rows
+	}
+
+	bucketRows, subAggrRows := p.splitBucketRows(layer.nextBucketAggregation, rows)
+	bucketRows, subAggrRows = p.potentiallyRemoveExtraBucket(layer, bucketRows, subAggrRows)
+	_, subAggrRows = p.selectBucketRows(selector.SelectBuckets(bucketRows), bucketRows, subAggrRows)
+	selectedRows := make([]model.QueryResultRow, 0, len(rows))
+	for _, bucketRows := range subAggrRows {
+		selectedRows = append(selectedRows, bucketRows...)
+	}
+	return selectedRows
+}
+
 func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer, rows []model.QueryResultRow) (model.JsonMap, error) {
 	result := model.JsonMap{}
 	if len(remainingLayers) == 0 {
@@ -259,7 +296,7 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 	}
 
 	// pipeline aggregations of metric type behave just like metric
-	for metricPipelineAggrName, metricPipelineAggrResult := range p.pipeline.currentPipelineMetricAggregations(layer, rows) {
+	for metricPipelineAggrName, metricPipelineAggrResult := range p.pipeline.currentPipelineMetricAggregations(layer, p.rowsOfSelectedBuckets(layer, rows)) {
 		result[metricPipelineAggrName] = metricPipelineAggrResult
 		// TODO: maybe add metadata also here? probably not needed
 	}
@@ -286,7 +323,8 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 			nextLayer = remainingLayers[1]
 			anyPipelineParentAggregation := false
 			for _, pipeline := range nextLayer.childrenPipelineAggregations {
-				if pipeline.queryType.PipelineAggregationType() == model.PipelineParentAggregation {
+				_, isBucketsTransformer := pipeline.queryType.(bucketsTransformer)
+				if pipeline.queryType.PipelineAggregationType() == model.PipelineParentAggregation && !isBucketsTransformer {
 					anyPipelineParentAggregation = true
 					break
 				}
@@ -305,6 +343,10 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 		bucketRows, subAggrRows = p.potentiallyRemoveExtraBucket(layer, bucketRows, subAggrRows)
 
 		buckets := layer.nextBucketAggregation.queryType.TranslateSqlResponseToJson(bucketRows)
+		if selector, ok := layer.nextBucketAggregation.queryType.(bucket_aggregations.BucketsSelectorInterface); ok {
+			// buckets are already selected and ordered, so we do the same with rows of their sub-aggregations
+			bucketRows, subAggrRows = p.selectBucketRows(selector.SelectBuckets(bucketRows), bucketRows, subAggrRows)
+		}
 
 		if len(buckets) == 0 { // without this we'd generate {"buckets": []} in the response, which Elastic doesn't do.
 			if layer.nextBucketAggregation.metadata != nil {
@@ -388,6 +430,7 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 			for i := 0; i < len(bucketArr); i++ {
 				delete(bucketArr[i], bucket_aggregations.OriginalKeyName)
 			}
+			buckets["buckets"] = p.pipeline.transformBuckets(nextLayer, bucketArr)
 		}
 
 		if layer.nextBucketAggregation.metadata != nil {
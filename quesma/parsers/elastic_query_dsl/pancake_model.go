@@ -18,6 +18,9 @@ type pancakeModel struct {
 
 	whereClause model.Expr
 	sampleLimit int
+	// diversified_sampler: at most sampleMaxDocsPerValue documents with the same sampleDiversifyBy value are sampled
+	sampleDiversifyBy     model.Expr
+	sampleMaxDocsPerValue int
 }
 
 // Clone isn't a shallow copy, isn't also a full deep copy, but it's enough for our purposes.
@@ -30,12 +33,23 @@ func (p *pancakeModel) Clone() *pancakeModel {
 		layers[i].childrenPipelineAggregations = p.layers[i].childrenPipelineAggregations
 	}
 	return &pancakeModel{
-		layers:      layers,
-		whereClause: p.whereClause,
-		sampleLimit: p.sampleLimit,
+		layers:                layers,
+		whereClause:           p.whereClause,
+		sampleLimit:           p.sampleLimit,
+		sampleDiversifyBy:     p.sampleDiversifyBy,
+		sampleMaxDocsPerValue: p.sampleMaxDocsPerValue,
 	}
 }
 
+// isGlobal <=> the top-most aggregation is global, so the pancake ignores the query
+func (p *pancakeModel) isGlobal() bool {
+	if len(p.layers) == 0 || p.layers[0].nextBucketAggregation == nil {
+		return false
+	}
+	_, isGlobal := p.layers[0].nextBucketAggregation.queryType.(bucket_aggregations.Global)
+	return isGlobal
+}
+
 type pancakeModelLayer struct {
 	nextBucketAggregation       *pancakeModelBucketAggregation
 	currentMetricAggregations   []*pancakeModelMetricAggregation
@@ -162,6 +176,15 @@ func (p pancakeModelBucketAggregation) isInternalNameCountColumn(internalName st
 	return strings.HasSuffix(internalName, "count")
 }
 
+// isInternalNameSignificanceColumn: significant_terms has background count and size as extra key columns,
+// they're not a part of the bucket's key
+func (p pancakeModelBucketAggregation) isInternalNameSignificanceColumn(internalName string) bool {
+	if _, isSignificantTerms := p.queryType.(bucket_aggregations.SignificantTerms); !isSignificantTerms {
+		return false
+	}
+	return internalName == p.InternalNameForKey(1) || internalName == p.InternalNameForKey(2)
+}
+
 func (p pancakeModelBucketAggregation) DoesHaveGroupBy() bool {
 	_, noGroupBy := p.queryType.(bucket_aggregations.NoGroupByInterface)
 	return !noGroupBy
@@ -15,6 +15,12 @@ type pancakePipelinesProcessor struct {
 	ctx context.Context
 }
 
+// bucketsTransformer is a pipeline aggregation which doesn't add any results, but prunes/reorders
+// already rendered buckets of its parent aggregation (bucket_selector, bucket_sort)
+type bucketsTransformer interface {
+	TransformBuckets(buckets []model.JsonMap) []model.JsonMap
+}
+
 func (p pancakePipelinesProcessor) selectPipelineRows(pipeline model.PipelineQueryType, rows []model.QueryResultRow,
 	bucketAggregation *pancakeModelBucketAggregation) (
 	result []model.QueryResultRow) {
@@ -30,6 +36,9 @@ func (p pancakePipelinesProcessor) selectPipelineRows(pipeline model.PipelineQue
 			if !isCount && bucketAggregation.isInternalNameCountColumn(col.ColName) {
 				continue
 			}
+			if bucketAggregation.isInternalNameSignificanceColumn(col.ColName) {
+				continue
+			}
 			if !bucketAggregation.isInternalNameOrderByColumn(col.ColName) {
 				// we don't need order by (and actually it would break if we included them)
 				newRow.Cols = append(newRow.Cols, col)
@@ -96,6 +105,9 @@ func (p pancakePipelinesProcessor) currentPipelineBucketAggregations(layer, next
 		if childPipeline.queryType.AggregationType() != model.PipelineBucketAggregation {
 			continue
 		}
+		if _, isBucketsTransformer := childPipeline.queryType.(bucketsTransformer); isBucketsTransformer {
+			continue
+		}
 
 		bucketRowsWithRightLastColumn := bucketRows
 		needToAddProperMetricColumn := !childPipeline.queryType.IsCount() // If count, last column of bucketRows is already count we need.
@@ -128,6 +140,17 @@ func (p pancakePipelinesProcessor) currentPipelineBucketAggregations(layer, next
 	return
 }
 
+// transformBuckets applies all bucket_selector/bucket_sort pipelines of nextLayer, in order, to buckets of the current layer.
+// It needs to be done at the very end, when all buckets are fully rendered.
+func (p pancakePipelinesProcessor) transformBuckets(nextLayer *pancakeModelLayer, buckets []model.JsonMap) []model.JsonMap {
+	for _, childPipeline := range nextLayer.childrenPipelineAggregations {
+		if transformer, ok := childPipeline.queryType.(bucketsTransformer); ok {
+			buckets = transformer.TransformBuckets(buckets)
+		}
+	}
+	return buckets
+}
+
 func (p pancakePipelinesProcessor) calcSinglePipelineBucket(layer *pancakeModelLayer, pipeline *pancakeModelPipelineAggregation,
 	bucketRows []model.QueryResultRow) (resultRowsPerPipeline map[string][]model.QueryResultRow) {
 
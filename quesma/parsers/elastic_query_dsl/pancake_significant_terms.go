@@ -0,0 +1,153 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/bucket_aggregations"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// significantTermsAggregations returns all significant_terms aggregations of the query
+func (p *pancakeSqlQueryGenerator) significantTermsAggregations(aggregation *pancakeModel) []*pancakeModelBucketAggregation {
+	var result []*pancakeModelBucketAggregation
+	for _, layer := range aggregation.layers {
+		if layer.nextBucketAggregation == nil {
+			continue
+		}
+		if _, isSignificantTerms := layer.nextBucketAggregation.queryType.(bucket_aggregations.SignificantTerms); isSignificantTerms {
+			result = append(result, layer.nextBucketAggregation)
+		}
+	}
+	return result
+}
+
+// columnAlias returns the name of a column of a pancake query, which is either aliased, or a quoted alias of an inner query
+func (p *pancakeSqlQueryGenerator) columnAlias(column model.Expr) (string, error) {
+	switch typed := column.(type) {
+	case model.AliasedExpr:
+		return typed.Alias, nil
+	case model.LiteralExpr:
+		if value, ok := typed.Value.(string); ok {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted, nil
+			}
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected column of pancake query: %s", model.AsString(column))
+}
+
+// generateSignificantTermsQuery adds background counts to buckets of significant_terms aggregations.
+// The original query returns shard_size candidate terms. We count only those terms in the background
+// and JOIN the counts to the original query:
+//
+//	WITH quesma_significant_terms_group_table AS (original query),
+//	  quesma_significant_terms_background_1 AS (SELECT key, count(*) FROM table
+//	    WHERE key IN (SELECT key FROM quesma_significant_terms_group_table) AND background_filter GROUP BY key)
+//	SELECT group_table.*, background_1.count, (SELECT count(*) FROM table WHERE background_filter)
+//	FROM quesma_significant_terms_group_table AS group_table
+//	LEFT OUTER JOIN quesma_significant_terms_background_1 AS background_1 ON group_table.key = background_1.key
+func (p *pancakeSqlQueryGenerator) generateSignificantTermsQuery(significantTerms []*pancakeModelBucketAggregation,
+	origQuery *model.SelectCommand) (*model.SelectCommand, error) {
+
+	groupTableName := "group_table"
+	groupTableSourceName := "quesma_significant_terms_group_table"
+	groupTableLiteral := func(alias string) model.Expr {
+		return model.NewLiteral(strconv.Quote(groupTableName) + "." + strconv.Quote(alias))
+	}
+
+	aliases := make([]string, 0, len(origQuery.Columns))
+	for _, column := range origQuery.Columns {
+		alias, err := p.columnAlias(column)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	// we order by the original query's columns, and they need to be returned by it
+	orderBy := make([]model.OrderByExpr, 0, len(origQuery.OrderBy))
+	for _, origOrderBy := range origQuery.OrderBy {
+		alias, err := p.columnAlias(origOrderBy.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(aliases, alias) {
+			origQuery.Columns = append(origQuery.Columns, origOrderBy.Expr)
+		}
+		orderBy = append(orderBy, model.NewOrderByExpr(groupTableLiteral(alias), origOrderBy.Direction))
+	}
+
+	namedCTEs := []*model.CTE{{Name: groupTableSourceName, SelectCommand: origQuery}}
+	fromClause := model.Expr(model.NewAliasedExpr(model.NewLiteral(groupTableSourceName), groupTableName))
+	backgroundColumns := make(map[string][]model.AliasedExpr) // key alias -> background count and size
+
+	for i, bucket := range significantTerms {
+		keyAlias := bucket.InternalNameForKey(0)
+		var keyColumnAliases []string // key is repeated with different prefixes if there's e.g. a filters aggregation above
+		for _, alias := range aliases {
+			if alias == keyAlias || strings.HasSuffix(alias, "__"+keyAlias) {
+				keyColumnAliases = append(keyColumnAliases, alias)
+			}
+		}
+		if len(keyColumnAliases) == 0 {
+			return nil, fmt.Errorf("no key column %s of significant_terms in the query", keyAlias)
+		}
+
+		backgroundFilter := bucket.queryType.(bucket_aggregations.SignificantTerms).BackgroundFilter()
+		key := bucket.selectedColumns[0]
+		candidates := model.NewInfixExpr(key, "IN", model.NewParenExpr(model.SelectCommand{
+			Columns:    []model.Expr{model.NewLiteral(strconv.Quote(keyColumnAliases[0]))},
+			FromClause: model.NewLiteral(groupTableSourceName),
+		}))
+		backgroundName := fmt.Sprintf("background_%d", i+1)
+		backgroundSourceName := "quesma_significant_terms_" + backgroundName
+		aliasedKey := model.NewAliasedExpr(key, keyAlias)
+		namedCTEs = append(namedCTEs, &model.CTE{
+			Name: backgroundSourceName,
+			SelectCommand: &model.SelectCommand{
+				Columns:     []model.Expr{aliasedKey, model.NewAliasedExpr(model.NewCountFunc(), bucket.InternalNameForKey(1))},
+				FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+				WhereClause: model.And([]model.Expr{candidates, backgroundFilter}),
+				GroupBy:     []model.Expr{aliasedKey},
+			},
+		})
+		fromClause = model.NewJoinExpr(
+			fromClause,
+			model.NewAliasedExpr(model.NewLiteral(backgroundSourceName), backgroundName),
+			"LEFT OUTER",
+			model.NewInfixExpr(groupTableLiteral(keyColumnAliases[0]), "=",
+				model.NewLiteral(strconv.Quote(backgroundName)+"."+strconv.Quote(keyAlias))),
+		)
+
+		backgroundSize := significantBackgroundSize(backgroundFilter)
+		for _, keyColumnAlias := range keyColumnAliases {
+			prefix := strings.TrimSuffix(keyColumnAlias, keyAlias)
+			backgroundColumns[keyColumnAlias] = []model.AliasedExpr{
+				model.NewAliasedExpr(model.NewLiteral(strconv.Quote(backgroundName)+"."+strconv.Quote(bucket.InternalNameForKey(1))),
+					prefix+bucket.InternalNameForKey(1)),
+				model.NewAliasedExpr(backgroundSize, prefix+bucket.InternalNameForKey(2)),
+			}
+		}
+	}
+
+	// columns of the original query, with background count and size right after the key, see bucket_aggregations.SignificantTerms
+	columns := make([]model.Expr, 0, len(aliases)+2*len(backgroundColumns))
+	for _, alias := range aliases {
+		columns = append(columns, model.NewAliasedExpr(groupTableLiteral(alias), alias))
+		for _, backgroundColumn := range backgroundColumns[alias] {
+			columns = append(columns, backgroundColumn)
+		}
+	}
+
+	return &model.SelectCommand{
+		Columns:    columns,
+		FromClause: fromClause,
+		OrderBy:    orderBy,
+		NamedCTEs:  namedCTEs,
+	}, nil
+}
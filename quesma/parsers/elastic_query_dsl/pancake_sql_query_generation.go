@@ -54,15 +54,17 @@ func (p *pancakeSqlQueryGenerator) generateAccumAggrFunctions(origExpr model.Exp
 			return origExpr, origFunc.Name, nil
 		case "count", "countIf":
 			return model.NewFunction(origFunc.Name, origFunc.Args...), "sum", nil
-		case "avg", "avgOrNull", "varPop", "varSamp", "stddevPop", "stddevSamp", "uniq":
+		case "avg", "avgOrNull", "varPop", "varSamp", "stddevPop", "stddevSamp", "uniq", "groupUniqArray", "avgWeightedOrNull", "sumMap":
 			// TODO: I debate whether make that default
 			// This is ClickHouse specific: https://clickhouse.com/docs/en/sql-reference/aggregate-functions/combinators
 			return model.NewFunction(origFunc.Name+"State", origFunc.Args...), origFunc.Name + "Merge", nil
 		}
 
-		if strings.HasPrefix(origFunc.Name, "quantiles") {
-			return model.NewFunction(strings.Replace(origFunc.Name, "quantiles", "quantilesState", 1), origFunc.Args...),
-				strings.Replace(origFunc.Name, "quantiles", "quantilesMerge", 1), nil
+		for _, parametricFunction := range []string{"quantiles", "quantilesExact", "histogram", "groupArray"} {
+			if strings.HasPrefix(origFunc.Name, parametricFunction+"(") {
+				return model.NewFunction(strings.Replace(origFunc.Name, parametricFunction, parametricFunction+"State", 1), origFunc.Args...),
+					strings.Replace(origFunc.Name, parametricFunction, parametricFunction+"Merge", 1), nil
+			}
 		}
 	}
 	debugQueryType := "<nil>"
@@ -271,6 +273,26 @@ func (p *pancakeSqlQueryGenerator) countRealBucketAggregations(aggregation *panc
 	return bucketAggregationCount
 }
 
+// generateFromAndWhereClause returns the table and the query's WHERE clause, except for:
+//   - diversified_sampler. Then we sample from a subquery: SELECT * FROM table WHERE ... LIMIT maxDocsPerValue BY field
+//   - nested. Then we aggregate nested documents of matching documents, see nestedFromClause
+func (p *pancakeSqlQueryGenerator) generateFromAndWhereClause(aggregation *pancakeModel) (fromClause, whereClause model.Expr) {
+	table := model.NewTableRef(model.SingleTableNamePlaceHolder)
+	if nested, isNested := aggregation.nestedAggregation(); isNested {
+		return nestedFromClause(nested, table, aggregation.whereClause), nil
+	}
+	if aggregation.sampleDiversifyBy == nil {
+		return table, aggregation.whereClause
+	}
+	return model.SelectCommand{
+		Columns:     []model.Expr{model.NewWildcardExpr},
+		FromClause:  table,
+		WhereClause: aggregation.whereClause,
+		LimitBy:     []model.Expr{aggregation.sampleDiversifyBy},
+		Limit:       aggregation.sampleMaxDocsPerValue,
+	}, nil
+}
+
 func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeModel) (resultQuery *model.SelectCommand, optimizerName string, err error) {
 	if aggregation == nil {
 		return nil, "", errors.New("aggregation is nil in generateQuery")
@@ -389,22 +411,24 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 		}
 		rankColumns = []model.AliasedExpr{} // needed if there would be top hits
 
+		fromClause, whereClause := p.generateFromAndWhereClause(aggregation)
 		resultQuery = &model.SelectCommand{
 			Columns:     p.aliasedExprArrayToExpr(selectColumns),
 			GroupBy:     p.aliasedExprArrayToExpr(groupBys),
-			WhereClause: aggregation.whereClause,
-			FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+			WhereClause: whereClause,
+			FromClause:  fromClause,
 			OrderBy:     orderBy,
 			Limit:       limit,
 			SampleLimit: aggregation.sampleLimit,
 		}
 		optimizerName = PancakeOptimizerName + "(half)"
 	} else {
+		fromClause, whereClause := p.generateFromAndWhereClause(aggregation)
 		windowCte := model.SelectCommand{
 			Columns:     p.aliasedExprArrayToExpr(selectColumns),
 			GroupBy:     p.aliasedExprArrayToExpr(groupBys),
-			WhereClause: aggregation.whereClause,
-			FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+			WhereClause: whereClause,
+			FromClause:  fromClause,
 			SampleLimit: aggregation.sampleLimit,
 		}
 
@@ -428,6 +452,10 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 		optimizerName = PancakeOptimizerName + "(with top_hits)"
 	}
 
+	if significantTerms := p.significantTermsAggregations(aggregation); len(significantTerms) > 0 && err == nil {
+		resultQuery, err = p.generateSignificantTermsQuery(significantTerms, resultQuery)
+	}
+
 	return
 }
 
@@ -440,6 +468,11 @@ func (p *pancakeSqlQueryGenerator) generateQuery(aggregation *pancakeModel) (*mo
 	if err != nil {
 		return nil, err
 	}
+	if nested, isNested := aggregation.nestedAggregation(); isNested {
+		if resultSelectCommand, err = rewriteNestedAggregationFields(resultSelectCommand, nested); err != nil {
+			return nil, err
+		}
+	}
 
 	resultQuery := &model.Query{
 		SelectCommand: *resultSelectCommand,
@@ -38,7 +38,10 @@ func TestPancakeQueryGeneration(t *testing.T) {
 	}
 
 	currentSchema := schema.Schema{
-		Fields:             nil,
+		Fields: map[schema.FieldName]schema.Field{
+			"comments": {PropertyName: "comments", InternalPropertyName: "comments", Type: schema.QuesmaTypeNested,
+				InternalPropertyType: "Array(Tuple(author Nullable(String), stars Nullable(Int64)))"},
+		},
 		Aliases:            nil,
 		ExistsInDataSource: false,
 		DatabaseName:       "",
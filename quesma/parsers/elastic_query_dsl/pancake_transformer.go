@@ -65,6 +65,9 @@ func (a *pancakeTransformer) metricAggregationTreeNodeToModel(previousAggrNames
 		return nil, fmt.Errorf("metric aggregation is nil")
 
 	}
+	if len(metric.children) > 0 {
+		return nil, fmt.Errorf("%s aggregation %s can't have sub-aggregations", metric.queryType.String(), metric.name)
+	}
 	if metric.queryType.AggregationType() != model.MetricsAggregation {
 		// we can occasionally treat filter as metric if it has no childs
 		if _, isFilter := metric.queryType.(bucket_aggregations.FilterAgg); !isFilter {
@@ -175,12 +178,15 @@ func (a *pancakeTransformer) createLayer(previousAggrNames []string, childAggreg
 				return nil, err
 			}
 
-			if result[0].nextBucketAggregation == nil {
+			// global ignores the query, and nested aggregates nested documents, so they always need their own pancakes
+			_, isGlobal := bucket.queryType.(bucket_aggregations.Global)
+			_, isNested := bucket.queryType.(bucket_aggregations.Nested)
+			if result[0].nextBucketAggregation == nil && !isGlobal && !isNested {
 				result[0].layer.nextBucketAggregation = bucket
 				result[0].nextBucketAggregation = childAgg
 			} else {
 				// if both leaf optimizations are filter and second one doesn't have children we can treat second as metric
-				if a.optimizeSimpleFilter(previousAggrNames, &result[0], childAgg) {
+				if result[0].nextBucketAggregation != nil && a.optimizeSimpleFilter(previousAggrNames, &result[0], childAgg) {
 					continue
 				}
 
@@ -202,6 +208,12 @@ func (a *pancakeTransformer) createLayer(previousAggrNames []string, childAggreg
 				childAgg.name, childAgg.queryType.AggregationType().String())
 		}
 	}
+
+	// first layer can be empty only if all aggregations have their own pancakes (e.g. only global)
+	first := result[0].layer
+	if first.nextBucketAggregation == nil && len(first.currentMetricAggregations) == 0 && len(first.currentPipelineAggregations) == 0 {
+		result = result[1:]
+	}
 	return result, nil
 }
 
@@ -241,8 +253,8 @@ func (a *pancakeTransformer) aggregationChildrenToLayers(aggrNames []string, chi
 
 func (a *pancakeTransformer) checkIfSupported(layers []*pancakeModelLayer) error {
 	// Let's say we support everything. That'll be true when I add support for filters/date_range/range in the middle of aggregation tree (@trzysiek)
-	// Erase this function by then.
-	return nil
+	// Erase this function by then. (except nested aggregation, which we support only at the top level)
+	return checkNestedSupported(layers)
 }
 
 func (a *pancakeTransformer) connectPipelineAggregations(layers []*pancakeModelLayer) {
@@ -339,9 +351,11 @@ func (a *pancakeTransformer) createTopHitAndTopMetricsPancakes(pancake *pancakeM
 						newLayers = append(newLayers, newLayer)
 
 						newPancake := pancakeModel{
-							layers:      newLayers,
-							whereClause: pancake.whereClause,
-							sampleLimit: pancake.sampleLimit,
+							layers:                newLayers,
+							whereClause:           pancake.whereClause,
+							sampleLimit:           pancake.sampleLimit,
+							sampleDiversifyBy:     pancake.sampleDiversifyBy,
+							sampleMaxDocsPerValue: pancake.sampleMaxDocsPerValue,
 						}
 						result = append(result, &newPancake)
 					}
@@ -384,25 +398,30 @@ func (a *pancakeTransformer) aggregationTreeToPancakes(topLevel pancakeAggregati
 	}
 
 	for _, layers := range resultLayers {
-		sampleLimit := noSampleLimit
+		newPancake := pancakeModel{
+			layers:      layers,
+			whereClause: topLevel.whereClause,
+			sampleLimit: noSampleLimit,
+		}
 		if layers[0].nextBucketAggregation != nil {
 			if sampler, ok := layers[0].nextBucketAggregation.queryType.(bucket_aggregations.SamplerInterface); ok {
-				sampleLimit = sampler.GetSampleLimit()
+				newPancake.sampleLimit = sampler.GetSampleLimit()
+			}
+			if diversified, ok := layers[0].nextBucketAggregation.queryType.(bucket_aggregations.DiversifiedSampler); ok {
+				newPancake.sampleDiversifyBy, newPancake.sampleMaxDocsPerValue = diversified.DiversifyBy()
 			}
 		}
+		if newPancake.isGlobal() {
+			newPancake.whereClause = nil
+		}
 
 		if err := a.checkIfSupported(layers); err != nil {
 			return nil, err
 		}
 
 		a.connectPipelineAggregations(layers)
-		a.transformAutoDateHistogram(layers, topLevel.whereClause)
+		a.transformAutoDateHistogram(layers, newPancake.whereClause)
 
-		newPancake := pancakeModel{
-			layers:      layers,
-			whereClause: topLevel.whereClause,
-			sampleLimit: sampleLimit,
-		}
 		pancakeResults = append(pancakeResults, &newPancake)
 
 		// TODO: if both top_hits/top_metrics, and filters, it probably won't work...
@@ -433,6 +452,10 @@ func (a *pancakeTransformer) createCombinatorPancakes(pancake *pancakeModel) (ne
 	if !isCombinator {
 		return
 	}
+	if _, isAdjacencyMatrix := combinator.(bucket_aggregations.AdjacencyMatrix); isAdjacencyMatrix {
+		// its buckets are an array (not keyed by name), which we can't merge from many pancakes, so -If combinators are used instead
+		return
+	}
 
 	noMoreBucket := len(pancake.layers) <= 1 || (len(pancake.layers) == 2 && pancake.layers[1].nextBucketAggregation == nil)
 	noMetricOnFirstLayer := len(firstLayer.currentMetricAggregations) == 0 && len(firstLayer.currentPipelineAggregations) == 0
@@ -3,11 +3,15 @@
 package elastic_query_dsl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/metrics_aggregations"
 	"github.com/QuesmaOrg/quesma/quesma/model/pipeline_aggregations"
+	"github.com/QuesmaOrg/quesma/quesma/painful"
 	"github.com/QuesmaOrg/quesma/quesma/util"
+	"slices"
 	"strings"
 )
 
@@ -23,6 +27,14 @@ func (cw *ClickhouseQueryTranslator) parsePipelineAggregations(queryMap QueryMap
 		"min_bucket":     cw.parseMinBucket,
 		"max_bucket":     cw.parseMaxBucket,
 		"sum_bucket":     cw.parseSumBucket,
+
+		"moving_fn":              cw.parseMovingFn,
+		"bucket_selector":        cw.parseBucketSelector,
+		"bucket_sort":            cw.parseBucketSort,
+		"percentiles_bucket":     cw.parsePercentilesBucket,
+		"stats_bucket":           cw.parseStatsBucket,
+		"cumulative_cardinality": cw.parseCumulativeCardinality,
+		"normalize":              cw.parseNormalize,
 	}
 
 	for aggrName, aggrParser := range parsers {
@@ -106,6 +118,196 @@ func (cw *ClickhouseQueryTranslator) parseSerialDiff(params QueryMap) (model.Que
 	return nil, fmt.Errorf("lag is not a float64, but %T, value: %v", lagRaw, lagRaw)
 }
 
+func (cw *ClickhouseQueryTranslator) parseStatsBucket(params QueryMap) (model.QueryType, error) {
+	bucketsPath, err := cw.parseBucketsPath(params, "stats_bucket")
+	if err != nil {
+		return nil, err
+	}
+	return pipeline_aggregations.NewStatsBucket(cw.Ctx, bucketsPath), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parsePercentilesBucket(params QueryMap) (model.QueryType, error) {
+	bucketsPath, err := cw.parseBucketsPath(params, "percentiles_bucket")
+	if err != nil {
+		return nil, err
+	}
+
+	percents := pipeline_aggregations.PercentilesBucketDefaultPercents
+	if percentsRaw, exists := params["percents"]; exists {
+		percentsArr, ok := percentsRaw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("percents is not an array, but %T, value: %v", percentsRaw, percentsRaw)
+		}
+		percents = make([]float64, 0, len(percentsArr))
+		for _, percentRaw := range percentsArr {
+			percent, ok := percentRaw.(float64)
+			if !ok || percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("percent must be a number in [0, 100], got: %v", percentRaw)
+			}
+			percents = append(percents, percent)
+		}
+	}
+
+	keyed := true
+	if keyedRaw, exists := params["keyed"]; exists {
+		var ok bool
+		if keyed, ok = keyedRaw.(bool); !ok {
+			return nil, fmt.Errorf("keyed is not a bool, but %T, value: %v", keyedRaw, keyedRaw)
+		}
+	}
+	return pipeline_aggregations.NewPercentilesBucket(cw.Ctx, bucketsPath, percents, keyed), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseCumulativeCardinality(params QueryMap) (model.QueryType, error) {
+	bucketsPath, err := cw.parseBucketsPath(params, "cumulative_cardinality")
+	if err != nil {
+		return nil, err
+	}
+	return pipeline_aggregations.NewCumulativeCardinality(cw.Ctx, bucketsPath), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseNormalize(params QueryMap) (model.QueryType, error) {
+	bucketsPath, err := cw.parseBucketsPath(params, "normalize")
+	if err != nil {
+		return nil, err
+	}
+	method, ok := params["method"].(string)
+	if !ok {
+		return nil, fmt.Errorf("normalize: method is required and must be a string, got: %v", params["method"])
+	}
+	if !slices.Contains(pipeline_aggregations.NormalizeMethods, method) {
+		return nil, fmt.Errorf("normalize: unknown method %s, supported methods: %v", method, pipeline_aggregations.NormalizeMethods)
+	}
+	return pipeline_aggregations.NewNormalize(cw.Ctx, bucketsPath, method), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseMovingFn(params QueryMap) (model.QueryType, error) {
+	bucketsPath, err := cw.parseBucketsPath(params, "moving_fn")
+	if err != nil {
+		return nil, err
+	}
+
+	window, ok := params["window"].(float64)
+	if !ok || window <= 0 {
+		return nil, fmt.Errorf("moving_fn: window is required and must be a positive integer, got: %v", params["window"])
+	}
+	shift := 0.0
+	if shiftRaw, exists := params["shift"]; exists {
+		if shift, ok = shiftRaw.(float64); !ok {
+			return nil, fmt.Errorf("shift is not a float64, but %T, value: %v", shiftRaw, shiftRaw)
+		}
+	}
+
+	script, scriptParams, err := cw.parsePipelineScript(params, "moving_fn")
+	if err != nil {
+		return nil, err
+	}
+	return pipeline_aggregations.NewMovingFn(cw.Ctx, bucketsPath, script, scriptParams, int(window), int(shift)), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseBucketSelector(params QueryMap) (model.QueryType, error) {
+	var bucketsPaths map[string]string
+	switch bucketsPathRaw := params["buckets_path"].(type) {
+	case string:
+		bucketsPaths = map[string]string{"_value": bucketsPathRaw}
+	case QueryMap:
+		bucketsPaths = make(map[string]string, len(bucketsPathRaw))
+		for name, pathRaw := range bucketsPathRaw {
+			path, ok := pathRaw.(string)
+			if !ok {
+				return nil, fmt.Errorf("buckets_path is not a map with string values, but %T %v", pathRaw, pathRaw)
+			}
+			bucketsPaths[name] = path
+		}
+	default:
+		return nil, fmt.Errorf("no buckets_path in bucket_selector, or it's in wrong format, type: %T, value: %v", bucketsPathRaw, bucketsPathRaw)
+	}
+
+	script, scriptParams, err := cw.parsePipelineScript(params, "bucket_selector")
+	if err != nil {
+		return nil, err
+	}
+	return pipeline_aggregations.NewBucketSelector(cw.Ctx, bucketsPaths, script, scriptParams), nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseBucketSort(params QueryMap) (model.QueryType, error) {
+	var sortArr []any
+	switch sortRaw := params["sort"].(type) {
+	case nil:
+	case []any:
+		sortArr = sortRaw
+	default:
+		sortArr = []any{sortRaw}
+	}
+
+	sort := make([]pipeline_aggregations.BucketSortField, 0, len(sortArr))
+	for _, sortFieldRaw := range sortArr {
+		switch sortField := sortFieldRaw.(type) {
+		case string:
+			sort = append(sort, pipeline_aggregations.BucketSortField{BucketsPath: sortField})
+		case QueryMap:
+			for path, orderRaw := range sortField {
+				order := "asc"
+				switch orderTyped := orderRaw.(type) {
+				case string:
+					order = orderTyped
+				case QueryMap:
+					if orderStr, ok := orderTyped["order"].(string); ok {
+						order = orderStr
+					}
+				}
+				if order != "asc" && order != "desc" {
+					return nil, fmt.Errorf("bucket_sort: unknown order %s for %s", order, path)
+				}
+				sort = append(sort, pipeline_aggregations.BucketSortField{BucketsPath: path, Desc: order == "desc"})
+			}
+		default:
+			return nil, fmt.Errorf("bucket_sort: sort field is neither a string nor a map, but %T, value: %v", sortFieldRaw, sortFieldRaw)
+		}
+	}
+
+	from, size := 0.0, float64(pipeline_aggregations.BucketSortNoSize)
+	for name, value := range map[string]*float64{"from": &from, "size": &size} {
+		if valueRaw, exists := params[name]; exists {
+			valueFloat, ok := valueRaw.(float64)
+			if !ok || valueFloat < 0 {
+				return nil, fmt.Errorf("bucket_sort: %s must be a non-negative integer, got: %v", name, valueRaw)
+			}
+			*value = valueFloat
+		}
+	}
+	return pipeline_aggregations.NewBucketSort(cw.Ctx, sort, int(from), int(size)), nil
+}
+
+// parsePipelineScript parses `script` of a pipeline aggregation: either a string, or a map with `source` and optional `params`
+func (cw *ClickhouseQueryTranslator) parsePipelineScript(params QueryMap, aggregationName string) (script painful.Expr, scriptParams map[string]any, err error) {
+	var source string
+	switch scriptRaw := params["script"].(type) {
+	case string:
+		source = scriptRaw
+	case QueryMap:
+		var ok bool
+		if source, ok = scriptRaw["source"].(string); !ok {
+			return nil, nil, fmt.Errorf("no source in script of %s", aggregationName)
+		}
+		if lang, ok := scriptRaw["lang"].(string); ok && lang != "painless" {
+			return nil, nil, fmt.Errorf("%s: unsupported script language: %s", aggregationName, lang)
+		}
+		if paramsRaw, exists := scriptRaw["params"]; exists {
+			if scriptParams, ok = paramsRaw.(QueryMap); !ok {
+				return nil, nil, fmt.Errorf("script params is not a map, but %T, value: %v", paramsRaw, paramsRaw)
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("no script in %s, or it's in wrong format, type: %T, value: %v", aggregationName, scriptRaw, scriptRaw)
+	}
+
+	if script, err = painful.ParsePainless(source); err != nil {
+		return nil, nil, fmt.Errorf("%s: could not parse script '%s': %w", aggregationName, source, err)
+	}
+	return script, scriptParams, nil
+}
+
 func (cw *ClickhouseQueryTranslator) parseBucketScriptBasic(params QueryMap) (model.QueryType, error) {
 	bucketsPath, err := cw.parseBucketsPath(params, "bucket_script")
 	if err != nil {
@@ -174,3 +376,39 @@ func (cw *ClickhouseQueryTranslator) parseBucketsPath(params QueryMap, aggregati
 
 	return "", fmt.Errorf("buckets_path in wrong format, type: %T, value: %v", bucketsPathRaw, bucketsPathRaw)
 }
+
+// linkCumulativeCardinalities makes cardinality aggregations used by cumulative_cardinality select distinct values
+// instead of their number, as we need them to compute the cumulative cardinality.
+func linkCumulativeCardinalities(ctx context.Context, nodes []*pancakeAggregationTreeNode) error {
+	for _, node := range nodes {
+		if cumulativeCardinality, ok := node.queryType.(pipeline_aggregations.CumulativeCardinality); ok {
+			cardinalityNode := findAggregationTreeNode(nodes, append(cumulativeCardinality.GetPathToParent(), cumulativeCardinality.GetParent()))
+			if cardinalityNode == nil {
+				return fmt.Errorf("buckets_path of cumulative_cardinality %s must point to a cardinality aggregation", node.name)
+			}
+			if _, isCardinality := cardinalityNode.queryType.(metrics_aggregations.Cardinality); !isCardinality || len(cardinalityNode.selectedColumns) != 1 {
+				return fmt.Errorf("buckets_path of cumulative_cardinality %s must point to a cardinality aggregation", node.name)
+			}
+			if uniq, ok := cardinalityNode.selectedColumns[0].(model.FunctionExpr); ok && uniq.Name == "uniq" {
+				cardinalityNode.selectedColumns = []model.Expr{model.NewFunction("groupUniqArray", uniq.Args...)}
+				cardinalityNode.queryType = metrics_aggregations.NewCardinalityFromValues(ctx)
+			}
+		}
+		if err := linkCumulativeCardinalities(ctx, node.children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findAggregationTreeNode(nodes []*pancakeAggregationTreeNode, path []string) *pancakeAggregationTreeNode {
+	for _, node := range nodes {
+		if node.name == path[0] {
+			if len(path) == 1 {
+				return node
+			}
+			return findAggregationTreeNode(node.children, path[1:])
+		}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/model/bucket_aggregations"
@@ -19,6 +20,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/util/regex"
 	"github.com/goccy/go-json"
 	"github.com/k0kubun/pp"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -119,8 +121,12 @@ func (cw *ClickhouseQueryTranslator) buildListQueryIfNeeded(
 	}
 	if fullQuery != nil {
 		highlighter.SetTokensToHighlight(fullQuery.SelectCommand)
+		sortFieldNames := fullQuery.SelectCommand.OrderByFieldNames()
+		if cw.Scoring {
+			cw.addScoreToHitsQuery(fullQuery, simpleQuery)
+		}
 		// TODO: pass right arguments
-		queryType := typical_queries.NewHits(cw.Ctx, cw.Table, &highlighter, fullQuery.SelectCommand.OrderByFieldNames(), true, false, false, cw.Indexes)
+		queryType := typical_queries.NewHits(cw.Ctx, cw.Table, &highlighter, sortFieldNames, true, false, false, cw.Indexes)
 		fullQuery.Type = &queryType
 		fullQuery.Highlighter = highlighter
 	}
@@ -128,6 +134,15 @@ func (cw *ClickhouseQueryTranslator) buildListQueryIfNeeded(
 	return fullQuery
 }
 
+// addScoreToHitsQuery adds the relevance score column to the hits query.
+// Without an explicit sort, hits are sorted by the score (like in Elasticsearch), but there's no `sort` in hits.
+func (cw *ClickhouseQueryTranslator) addScoreToHitsQuery(query *model.Query, simpleQuery *model.SimpleQuery) {
+	query.SelectCommand.Columns = append(query.SelectCommand.Columns, model.NewAliasedExpr(simpleQuery.ScoreOrDefault(), model.ScoreFieldName))
+	if len(query.SelectCommand.OrderBy) == 0 {
+		query.SelectCommand.OrderBy = []model.OrderByExpr{model.NewSortColumn(model.ScoreFieldName, model.DescOrder)}
+	}
+}
+
 func (cw *ClickhouseQueryTranslator) buildCountQueryIfNeeded(simpleQuery *model.SimpleQuery, queryInfo model.HitsCountInfo) *model.Query {
 	if queryInfo.TrackTotalHits == model.TrackTotalHitsFalse {
 		return nil
@@ -153,6 +168,10 @@ func (cw *ClickhouseQueryTranslator) parseQueryInternal(body types.JSON) (*model
 	} else {
 		parsedQuery = model.NewSimpleQuery(nil, true)
 	}
+	if len(cw.invalidParameters) > 0 {
+		return &parsedQuery, model.HitsCountInfo{}, highlighter,
+			fmt.Errorf("%w: %s", quesma_errors.ErrCouldNotParseRequest(), strings.Join(cw.invalidParameters, ", "))
+	}
 
 	if sortPart, ok := queryAsMap["sort"]; ok {
 		parsedQuery.OrderBy = cw.parseSortFields(sortPart)
@@ -257,7 +276,38 @@ func (cw *ClickhouseQueryTranslator) ParseAutocomplete(indexFilter *QueryMap, fi
 	return model.NewSimpleQuery(model.And(stmts), canParse)
 }
 
+// ParseQueryMap parses a standalone Query DSL query, e.g. `filter` of EQL request
+func (cw *ClickhouseQueryTranslator) ParseQueryMap(queryMap QueryMap) model.SimpleQuery {
+	return cw.parseQueryMap(queryMap)
+}
+
+// relaxed logs a part of the query, which isn't translated exactly. It returns true in strict mode,
+// then the query can't be parsed.
+func (cw *ClickhouseQueryTranslator) relaxed(format string, args ...any) bool {
+	reason := fmt.Sprintf(format, args...)
+	logger.WarnWithCtx(cw.Ctx).Msg(reason)
+	if cw.Strict {
+		cw.relaxations = append(cw.relaxations, reason)
+	}
+	return cw.Strict
+}
+
+// invalidParameter records a part of the query, which Elasticsearch rejects. The query can't be parsed then.
+func (cw *ClickhouseQueryTranslator) invalidParameter(format string, args ...any) {
+	reason := fmt.Sprintf(format, args...)
+	logger.WarnWithCtx(cw.Ctx).Msg(reason)
+	cw.invalidParameters = append(cw.invalidParameters, reason)
+}
+
+// Relaxations returns reasons why the query couldn't be parsed in strict mode
+func (cw *ClickhouseQueryTranslator) Relaxations() []string {
+	return cw.relaxations
+}
+
 func (cw *ClickhouseQueryTranslator) parseQueryMap(queryMap QueryMap) model.SimpleQuery {
+	if len(queryMap) > 1 && cw.Strict && cw.relaxed("query object with more than one key %v, only one of them would be applied", util.MapKeysSorted(queryMap)) {
+		return model.NewSimpleQueryInvalid()
+	}
 	if len(queryMap) != 1 {
 		// TODO suppress metadata for now
 		_ = cw.parseMetadata(queryMap)
@@ -271,17 +321,25 @@ func (cw *ClickhouseQueryTranslator) parseQueryMap(queryMap QueryMap) model.Simp
 		"terms":               cw.parseTerms,
 		"query":               cw.parseQueryMap,
 		"prefix":              cw.parsePrefix,
+		"fuzzy":               cw.parseFuzzy,
 		"nested":              cw.parseNested,
 		"match_phrase":        func(qm QueryMap) model.SimpleQuery { return cw.parseMatch(qm, true) },
 		"range":               cw.parseRange,
 		"exists":              cw.parseExists,
 		"ids":                 cw.parseIds,
 		"constant_score":      cw.parseConstantScore,
+		"dis_max":             cw.parseDisMax,
+		"boosting":            cw.parseBoosting,
+		"function_score":      cw.parseFunctionScore,
+		"script":              cw.parseScriptQuery,
 		"wildcard":            cw.parseWildcard,
 		"query_string":        cw.parseQueryString,
 		"simple_query_string": cw.parseQueryString,
 		"regexp":              cw.parseRegexp,
 		"geo_bounding_box":    cw.parseGeoBoundingBox,
+		"geo_distance":        cw.parseGeoDistance,
+		"geo_polygon":         cw.parseGeoPolygon,
+		"geo_shape":           cw.parseGeoShape,
 	}
 	for k, v := range queryMap {
 		if f, ok := parseMap[k]; ok {
@@ -292,6 +350,10 @@ func (cw *ClickhouseQueryTranslator) parseQueryMap(queryMap QueryMap) model.Simp
 			}
 		} else {
 			logger.WarnWithCtxAndReason(cw.Ctx, logger.ReasonUnsupportedQuery(k)).Msgf("unsupported query type: %s, value: %v", k, v)
+			if cw.Strict {
+				cw.relaxations = append(cw.relaxations, fmt.Sprintf("unsupported query type: %s", k))
+				return model.NewSimpleQueryInvalid()
+			}
 		}
 	}
 	if len(queryMap) == 0 { // empty query is a valid query
@@ -307,10 +369,12 @@ func (cw *ClickhouseQueryTranslator) parseQueryMap(queryMap QueryMap) model.Simp
 	return model.NewSimpleQueryInvalid()
 }
 
-// `constant_score` query is just a wrapper for filter query which returns constant relevance score, which we ignore anyway
+// `constant_score` query is just a wrapper for filter query which returns constant relevance score (`boost`, default 1)
 func (cw *ClickhouseQueryTranslator) parseConstantScore(queryMap QueryMap) model.SimpleQuery {
 	if _, ok := queryMap["filter"]; ok {
-		return cw.parseBool(queryMap)
+		query := cw.parseBool(QueryMap{"filter": queryMap["filter"]})
+		query.Score = model.NewLiteral(cw.parseFloatField(queryMap, "boost", 1))
+		return query
 	} else {
 		logger.Error().Msgf("parsing error: `constant_score` needs to wrap `filter` query")
 		return model.NewSimpleQueryInvalid()
@@ -399,14 +463,16 @@ func (cw *ClickhouseQueryTranslator) parseIds(queryMap QueryMap) model.SimpleQue
 	return model.NewSimpleQuery(whereStmt, true)
 }
 
-// Parses each model.SimpleQuery separately, returns list of translated SQLs
-func (cw *ClickhouseQueryTranslator) parseQueryMapArray(queryMaps []interface{}) (stmts []model.Expr, canParse bool) {
+// Parses each model.SimpleQuery separately, returns list of translated SQLs, and their scores (scores[i] is the score of stmts[i])
+func (cw *ClickhouseQueryTranslator) parseQueryMapArray(queryMaps []interface{}) (stmts, scores []model.Expr, canParse bool) {
 	stmts = make([]model.Expr, len(queryMaps))
+	scores = make([]model.Expr, len(queryMaps))
 	canParse = true
 	for i, v := range queryMaps {
 		if vAsMap, ok := v.(QueryMap); ok {
 			query := cw.parseQueryMap(vAsMap)
 			stmts[i] = query.WhereClause
+			scores[i] = query.ScoreOrDefault()
 			if !query.CanParse {
 				canParse = false
 			}
@@ -415,33 +481,37 @@ func (cw *ClickhouseQueryTranslator) parseQueryMapArray(queryMaps []interface{})
 			canParse = false
 		}
 	}
-	return stmts, canParse
+	return stmts, scores, canParse
 }
 
-func (cw *ClickhouseQueryTranslator) iterateListOrDictAndParse(queryMaps interface{}) (stmts []model.Expr, canParse bool) {
+func (cw *ClickhouseQueryTranslator) iterateListOrDictAndParse(queryMaps interface{}) (stmts, scores []model.Expr, canParse bool) {
 	switch queryMapsTyped := queryMaps.(type) {
 	case []interface{}:
 		return cw.parseQueryMapArray(queryMapsTyped)
 	case QueryMap:
 		simpleQuery := cw.parseQueryMap(queryMapsTyped)
 		if simpleQuery.WhereClause != nil {
-			return []model.Expr{simpleQuery.WhereClause}, simpleQuery.CanParse
+			return []model.Expr{simpleQuery.WhereClause}, []model.Expr{simpleQuery.ScoreOrDefault()}, simpleQuery.CanParse
 		}
-		return []model.Expr{}, simpleQuery.CanParse
+		return []model.Expr{}, []model.Expr{}, simpleQuery.CanParse
 	default:
 		logger.WarnWithCtx(cw.Ctx).Msgf("Invalid query type: %T, value: %v", queryMapsTyped, queryMapsTyped)
-		return []model.Expr{}, false
+		return []model.Expr{}, []model.Expr{}, false
 	}
 }
 
 // TODO: minimum_should_match parameter. Now only ints supported and >1 changed into 1
+// Score is the sum of scores of `must` and matching `should` queries (`filter` and `must_not` don't score).
 func (cw *ClickhouseQueryTranslator) parseBool(queryMap QueryMap) model.SimpleQuery {
-	var andStmts []model.Expr
+	var andStmts, scores []model.Expr
 	canParse := true // will stay true only if all subqueries can be parsed
 	for _, andPhrase := range []string{"must", "filter"} {
 		if queries, ok := queryMap[andPhrase]; ok {
-			newAndStmts, canParseThis := cw.iterateListOrDictAndParse(queries)
+			newAndStmts, newScores, canParseThis := cw.iterateListOrDictAndParse(queries)
 			andStmts = append(andStmts, newAndStmts...)
+			if andPhrase == "must" {
+				scores = append(scores, newScores...)
+			}
 			canParse = canParse && canParseThis
 		}
 	}
@@ -451,30 +521,37 @@ func (cw *ClickhouseQueryTranslator) parseBool(queryMap QueryMap) model.SimpleQu
 	if v, ok := queryMap["minimum_should_match"]; ok {
 		if vAsFloat, ok := v.(float64); ok {
 			minimumShouldMatch = int(vAsFloat)
-		} else {
-			logger.WarnWithCtx(cw.Ctx).Msgf("invalid minimum_should_match type: %T, value: %v", v, v)
+		} else if cw.relaxed("unsupported minimum_should_match type: %T, value: %v", v, v) {
+			return model.NewSimpleQueryInvalid()
 		}
 	}
-	if len(andStmts) == 0 {
+	if len(andStmts) == 0 && minimumShouldMatch == 0 {
 		minimumShouldMatch = 1
 	}
 	if minimumShouldMatch > 1 {
-		logger.WarnWithCtx(cw.Ctx).Msgf("minimum_should_match > 1 not supported, changed to 1")
+		if cw.relaxed("minimum_should_match > 1 not supported, changed to 1") {
+			return model.NewSimpleQueryInvalid()
+		}
 		minimumShouldMatch = 1
 	}
-	if queries, ok := queryMap["should"]; ok && minimumShouldMatch == 1 {
-		orSqls, canParseThis := cw.iterateListOrDictAndParse(queries)
-		orSql := model.Or(orSqls)
-		canParse = canParse && canParseThis
-		if len(andStmts) == 0 {
-			sql = orSql
-		} else if orSql != nil {
-			sql = model.And([]model.Expr{sql, orSql})
+	if queries, ok := queryMap["should"]; ok {
+		orSqls, orScores, canParseThis := cw.iterateListOrDictAndParse(queries)
+		for i, orSql := range orSqls {
+			scores = append(scores, model.ScoreIf(orSql, orScores[i]))
+		}
+		if minimumShouldMatch == 1 {
+			orSql := model.Or(orSqls)
+			canParse = canParse && canParseThis
+			if len(andStmts) == 0 {
+				sql = orSql
+			} else if orSql != nil {
+				sql = model.And([]model.Expr{sql, orSql})
+			}
 		}
 	}
 
 	if queries, ok := queryMap["must_not"]; ok {
-		sqlNots, canParseThis := cw.iterateListOrDictAndParse(queries)
+		sqlNots, _, canParseThis := cw.iterateListOrDictAndParse(queries)
 		canParse = canParse && canParseThis
 		if len(sqlNots) > 0 {
 			// transform NOT a && NOT b && NOT c --> NOT (a OR b OR c)
@@ -482,7 +559,9 @@ func (cw *ClickhouseQueryTranslator) parseBool(queryMap QueryMap) model.SimpleQu
 			sql = model.And([]model.Expr{sql, sqlNot})
 		}
 	}
-	return model.NewSimpleQuery(sql, canParse)
+	query := model.NewSimpleQuery(sql, canParse)
+	query.Score = model.ScoreBoost(model.ScoreSum(scores...), cw.parseFloatField(queryMap, "boost", 1))
+	return query
 }
 
 func (cw *ClickhouseQueryTranslator) parseTerm(queryMap QueryMap) model.SimpleQuery {
@@ -490,7 +569,9 @@ func (cw *ClickhouseQueryTranslator) parseTerm(queryMap QueryMap) model.SimpleQu
 	if len(queryMap) == 1 {
 		for k, v := range queryMap {
 			if k == "_index" { // index is a table name, already taken from URI and moved to FROM clause
-				logger.WarnWithCtx(cw.Ctx).Msgf("term %s=%v in query body, ignoring in result SQL", k, v)
+				if cw.relaxed("term %s=%v in query body, ignoring in result SQL", k, v) {
+					return model.NewSimpleQueryInvalid()
+				}
 				return model.NewSimpleQuery(model.TrueExpr, true)
 			}
 			fieldName := ResolveField(cw.Ctx, k, cw.Schema)
@@ -513,6 +594,9 @@ func (cw *ClickhouseQueryTranslator) parseTerms(queryMap QueryMap) model.SimpleQ
 		if strings.HasPrefix(k, "_") {
 			// terms enum API uses _tier terms ( data_hot, data_warm, etc.)
 			// we don't want these internal fields to percolate to the SQL query
+			if cw.relaxed("terms on internal field %s in query body, ignoring in result SQL", k) {
+				return model.NewSimpleQueryInvalid()
+			}
 			return model.NewSimpleQuery(nil, true)
 		}
 		vAsArray, ok := v.([]interface{})
@@ -538,8 +622,12 @@ func (cw *ClickhouseQueryTranslator) parseTerms(queryMap QueryMap) model.SimpleQ
 	return model.NewSimpleQueryInvalid()
 }
 
-func (cw *ClickhouseQueryTranslator) parseMatchAll(_ QueryMap) model.SimpleQuery {
-	return model.NewSimpleQuery(nil, true)
+func (cw *ClickhouseQueryTranslator) parseMatchAll(queryMap QueryMap) model.SimpleQuery {
+	query := model.NewSimpleQuery(nil, true)
+	if boost := cw.parseFloatField(queryMap, "boost", 1); boost != 1 {
+		query.Score = model.NewLiteral(boost)
+	}
+	return query
 }
 
 // Supports 'match' and 'match_phrase' queries.
@@ -563,8 +651,30 @@ func (cw *ClickhouseQueryTranslator) parseMatch(queryMap QueryMap, matchPhrase b
 		// (fieldName, v) = either e.g. ("message", "this is a test")
 		//                  or  ("message", map["query": "this is a test", ...]). Here we only care about "query" until we find a case where we need more.
 		vUnNested := v
+		var fuzzyMatch *model.FuzzyMatch
+		boost := 1.0
 		if vAsQueryMap, ok := v.(QueryMap); ok {
 			vUnNested = vAsQueryMap["query"]
+			boost = cw.parseFloatField(vAsQueryMap, "boost", boost)
+			// words are always ORed
+			if operator, ok := vAsQueryMap["operator"].(string); ok && !strings.EqualFold(operator, "or") && !matchPhrase && cw.relaxed("match operator %s not supported", operator) {
+				return model.NewSimpleQueryInvalid()
+			}
+			if _, ok := vAsQueryMap["minimum_should_match"]; ok && cw.relaxed("minimum_should_match of match query not supported") {
+				return model.NewSimpleQueryInvalid()
+			}
+			if fuzzinessRaw, exists := vAsQueryMap["fuzziness"]; exists && !matchPhrase {
+				fuzziness, err := model.ParseFuzziness(fuzzinessRaw)
+				if err != nil {
+					logger.WarnWithCtx(cw.Ctx).Msgf("match query: %v", err)
+					return model.NewSimpleQueryInvalid()
+				}
+				fuzzyMatch = &model.FuzzyMatch{
+					Fuzziness:      fuzziness,
+					PrefixLength:   cw.parseIntField(vAsQueryMap, "prefix_length", 0),
+					Transpositions: cw.parseBoolField(vAsQueryMap, "fuzzy_transpositions", true),
+				}
+			}
 		}
 		if vAsString, ok := vUnNested.(string); ok {
 			var subQueries []string
@@ -577,13 +687,22 @@ func (cw *ClickhouseQueryTranslator) parseMatch(queryMap QueryMap, matchPhrase b
 			for _, subQuery := range subQueries {
 				if fieldName == "_id" { // We compute this field on the fly using our custom logic, so we have to parse it differently
 					computedIdMatchingQuery := cw.parseIds(QueryMap{"values": []interface{}{subQuery}})
+					if !computedIdMatchingQuery.CanParse && cw.relaxed("match on invalid _id %s", subQuery) {
+						return model.NewSimpleQueryInvalid()
+					}
 					statements = append(statements, computedIdMatchingQuery.WhereClause)
+				} else if fuzzyMatch != nil {
+					match := *fuzzyMatch
+					match.Term = subQuery
+					statements = append(statements, model.NewFuzzyMatchExpr(model.NewColumnRef(fieldName), match))
 				} else {
 					simpleStat := model.NewInfixExpr(model.NewColumnRef(fieldName), model.MatchOperator, model.NewLiteral("'"+subQuery+"'"))
 					statements = append(statements, simpleStat)
 				}
 			}
-			return model.NewSimpleQuery(model.Or(statements), true)
+			query := model.NewSimpleQuery(model.Or(statements), true)
+			query.Score = model.ScoreBoost(model.MatchScore(query.WhereClause), boost)
+			return query
 		}
 
 		// so far we assume that only strings can be ORed here
@@ -648,7 +767,9 @@ func (cw *ClickhouseQueryTranslator) parseMultiMatch(queryMap QueryMap) model.Si
 			i++
 		}
 	}
-	return model.NewSimpleQuery(model.Or(sqls), true)
+	multiMatch := model.NewSimpleQuery(model.Or(sqls), true)
+	multiMatch.Score = model.ScoreBoost(model.MatchScore(multiMatch.WhereClause), cw.parseFloatField(queryMap, "boost", 1))
+	return multiMatch
 }
 
 // prefix works only on strings
@@ -679,6 +800,47 @@ func (cw *ClickhouseQueryTranslator) parsePrefix(queryMap QueryMap) model.Simple
 	return model.NewSimpleQueryInvalid()
 }
 
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-fuzzy-query.html
+// We don't look at `max_expansions` and `rewrite`, as we don't expand terms at all.
+func (cw *ClickhouseQueryTranslator) parseFuzzy(queryMap QueryMap) model.SimpleQuery {
+	if len(queryMap) != 1 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("we expect only 1 fuzzy, got: %d. value: %v", len(queryMap), queryMap)
+		return model.NewSimpleQueryInvalid()
+	}
+
+	for fieldName, v := range queryMap {
+		fieldName = ResolveField(cw.Ctx, fieldName, cw.Schema)
+		params, ok := v.(QueryMap)
+		if !ok {
+			params = QueryMap{"value": v}
+		}
+		value, ok := params["value"].(string)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid fuzzy value type: %T, value: %v", params["value"], params["value"])
+			return model.NewSimpleQueryInvalid()
+		}
+		fuzziness := model.FuzzinessAuto
+		if fuzzinessRaw, exists := params["fuzziness"]; exists {
+			var err error
+			if fuzziness, err = model.ParseFuzziness(fuzzinessRaw); err != nil {
+				logger.WarnWithCtx(cw.Ctx).Msgf("fuzzy query: %v", err)
+				return model.NewSimpleQueryInvalid()
+			}
+		}
+		match := model.FuzzyMatch{
+			Term:           value,
+			Fuzziness:      fuzziness,
+			PrefixLength:   cw.parseIntField(params, "prefix_length", 0),
+			Transpositions: cw.parseBoolField(params, "transpositions", true),
+		}
+		return model.NewSimpleQuery(model.NewFuzzyMatchExpr(model.NewColumnRef(fieldName), match), true)
+	}
+
+	// unreachable unless something really weird happens
+	logger.ErrorWithCtx(cw.Ctx).Msg("theoretically unreachable code")
+	return model.NewSimpleQueryInvalid()
+}
+
 // Not supporting 'case_insensitive' (optional)
 // Also not supporting wildcard (Required, string) (??) In both our example, and their in docs,
 // it's not provided.
@@ -726,15 +888,49 @@ func (cw *ClickhouseQueryTranslator) parseQueryString(queryMap QueryMap) model.S
 
 	query := queryMap["query"].(string) // query: (Required, string)
 
+	fuzzyOptions := lucene.DefaultFuzzyOptions
+	if fuzzinessRaw, exists := queryMap["fuzziness"]; exists {
+		if fuzziness, err := model.ParseFuzziness(fuzzinessRaw); err == nil {
+			fuzzyOptions.Fuzziness = fuzziness
+		} else {
+			logger.WarnWithCtx(cw.Ctx).Msgf("query_string: %v, using default fuzziness", err)
+		}
+	}
+	fuzzyOptions.PrefixLength = cw.parseIntField(queryMap, "fuzzy_prefix_length", fuzzyOptions.PrefixLength)
+	fuzzyOptions.Transpositions = cw.parseBoolField(queryMap, "fuzzy_transpositions", fuzzyOptions.Transpositions)
+
 	// we always call `TranslateToSQL` - Lucene parser returns "false" in case of invalid query
-	whereStmtFromLucene := lucene.TranslateToSQL(cw.Ctx, query, fields, cw.Schema)
-	return model.NewSimpleQuery(whereStmtFromLucene, true)
+	whereStmtFromLucene, score := lucene.TranslateToSQLWithScore(cw.Ctx, query, fields, cw.Schema, fuzzyOptions)
+	queryString := model.NewSimpleQuery(whereStmtFromLucene, true)
+	queryString.Score = model.ScoreBoost(score, cw.parseFloatField(queryMap, "boost", 1))
+	return queryString
 }
 
+// parseNested: the inner query has to match a single nested document (object of an array of objects at `path`).
+// If the field at `path` isn't nested (e.g. it's a regular object), it's the same as the inner query.
 func (cw *ClickhouseQueryTranslator) parseNested(queryMap QueryMap) model.SimpleQuery {
 	if query, ok := queryMap["query"]; ok {
 		if queryAsMap, ok := query.(QueryMap); ok {
-			return cw.parseQueryMap(queryAsMap)
+			innerQuery := cw.parseQueryMap(queryAsMap)
+			path, _ := queryMap["path"].(string)
+			nested, isNested := cw.nestedField(path)
+			if !isNested || !innerQuery.CanParse {
+				return innerQuery
+			}
+
+			innerQuery.Score = nil // relevance of a parent document isn't computed from its nested documents
+			nestedColumn := model.NewColumnRef(nested.InternalPropertyName.AsString())
+			if innerQuery.WhereClause == nil { // e.g. match_all: any nested document matches
+				innerQuery.WhereClause = model.NewFunction("notEmpty", nestedColumn)
+				return innerQuery
+			}
+			lambdaBody, err := rewriteNestedFields(innerQuery.WhereClause, nested, model.NewLiteral(nestedDocLambdaArg))
+			if err != nil {
+				cw.invalidParameter("%v", err)
+				return model.NewSimpleQueryInvalid()
+			}
+			innerQuery.WhereClause = model.NewFunction("arrayExists", model.NewLambdaExpr([]string{nestedDocLambdaArg}, lambdaBody), nestedColumn)
+			return innerQuery
 		} else {
 			logger.WarnWithCtx(cw.Ctx).Msgf("invalid nested query type: %T, value: %v", query, query)
 			return model.NewSimpleQueryInvalid()
@@ -858,7 +1054,9 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 			case "format":
 				// ignored
 			default:
-				logger.WarnWithCtx(cw.Ctx).Msgf("invalid range operator: %s", op)
+				if cw.relaxed("invalid range operator: %s", op) {
+					return model.NewSimpleQueryInvalid()
+				}
 			}
 		}
 		return model.NewSimpleQuery(model.And(stmts), true)
@@ -1088,6 +1286,16 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 
 			// sortMap has only 1 key, so we can just iterate over it
 			for k, v := range sortMap {
+				if k == model.ScoreFieldName && cw.Scoring {
+					sortColumns = append(sortColumns, cw.parseScoreSortColumn(v))
+					continue
+				}
+				if k == "_script" {
+					if col, ok := cw.parseScriptSortColumn(v); ok {
+						sortColumns = append(sortColumns, col)
+					}
+					continue
+				}
 				// TODO replace cw.Table.GetFieldInfo with schema.Field[]
 				if strings.HasPrefix(k, "_") && cw.Table.GetFieldInfo(cw.Ctx, ResolveField(cw.Ctx, k, cw.Schema)) == clickhouse.NotExists {
 					// we're skipping ELK internal fields, like "_doc", "_id", etc.
@@ -1123,6 +1331,16 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 		return sortColumns
 	case map[string]interface{}:
 		for fieldName, fieldValue := range sortMaps {
+			if fieldName == model.ScoreFieldName && cw.Scoring {
+				sortColumns = append(sortColumns, cw.parseScoreSortColumn(fieldValue))
+				continue
+			}
+			if fieldName == "_script" {
+				if col, ok := cw.parseScriptSortColumn(fieldValue); ok {
+					sortColumns = append(sortColumns, col)
+				}
+				continue
+			}
 			if strings.HasPrefix(fieldName, "_") && cw.Table.GetFieldInfo(cw.Ctx, ResolveField(cw.Ctx, fieldName, cw.Schema)) == clickhouse.NotExists {
 				// TODO Elastic internal fields will need to be supported in the future
 				continue
@@ -1158,6 +1376,23 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 	}
 }
 
+// parseScoreSortColumn parses sort by relevance score, which (unlike other fields) is descending by default
+func (cw *ClickhouseQueryTranslator) parseScoreSortColumn(sortValue any) model.OrderByExpr {
+	order := "desc"
+	switch sortValue := sortValue.(type) {
+	case string:
+		order = sortValue
+	case QueryMap:
+		order = cw.parseStringField(sortValue, "order", order)
+	}
+	col, err := createSortColumn(model.ScoreFieldName, order)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msg(err.Error())
+		return model.NewSortColumn(model.ScoreFieldName, model.DescOrder)
+	}
+	return col
+}
+
 func createSortColumn(fieldName, ordering string) (model.OrderByExpr, error) {
 	ordering = strings.ToLower(ordering)
 	switch ordering {
@@ -1264,3 +1499,314 @@ func (cw *ClickhouseQueryTranslator) parseGeoBoundingBox(queryMap QueryMap) mode
 	}
 	return model.NewSimpleQuery(model.And(stmts), true)
 }
+
+// geoQueryParameters are keys of geo queries which aren't the field name
+var geoQueryParameters = []string{"distance", "distance_type", "validation_method", "ignore_unmapped", "_name", "boost"}
+
+// geoQueryField returns the single field of a geo query (`geo_distance`, `geo_polygon`, `geo_shape`) with its value
+func (cw *ClickhouseQueryTranslator) geoQueryField(queryMap QueryMap, queryType string) (field string, value any, ok bool) {
+	for k, v := range queryMap {
+		if slices.Contains(geoQueryParameters, k) {
+			continue
+		}
+		if field != "" {
+			logger.WarnWithCtx(cw.Ctx).Msgf("%s query supports only one field, got: %v", queryType, queryMap)
+			return "", nil, false
+		}
+		field, value = k, v
+	}
+	if field == "" {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no field in %s query: %v", queryType, queryMap)
+		return "", nil, false
+	}
+	return field, value, true
+}
+
+// geoPointColumns returns (lon, lat) of a geo_point field, resolved later by the geo schema transformation
+func geoPointColumns(field string) (lon, lat model.Expr) {
+	return model.NewFunction("toFloat64", model.NewGeoLon(field)), model.NewFunction("toFloat64", model.NewGeoLat(field))
+}
+
+// parseGeoPoint parses all geo_point formats but geohash: {"lat": 1, "lon": 2}, [2, 1], "1,2" and "POINT (2 1)"
+func parseGeoPoint(point any) (lon, lat float64, err error) {
+	switch p := point.(type) {
+	case QueryMap:
+		var okLat, okLon bool
+		lat, okLat = util.ExtractFloat64Maybe(p["lat"])
+		lon, okLon = util.ExtractFloat64Maybe(p["lon"])
+		if okLat && okLon {
+			return lon, lat, nil
+		}
+	case []any:
+		if len(p) == 2 {
+			var okLat, okLon bool
+			lon, okLon = util.ExtractFloat64Maybe(p[0])
+			lat, okLat = util.ExtractFloat64Maybe(p[1])
+			if okLat && okLon {
+				return lon, lat, nil
+			}
+		}
+	case string:
+		if wkt, found := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(p)), "POINT"); found {
+			coordinates := strings.Fields(strings.Trim(strings.TrimSpace(wkt), "()"))
+			if len(coordinates) == 2 {
+				var errLat, errLon error
+				lon, errLon = strconv.ParseFloat(coordinates[0], 64)
+				lat, errLat = strconv.ParseFloat(coordinates[1], 64)
+				if errLat == nil && errLon == nil {
+					return lon, lat, nil
+				}
+			}
+		} else if latStr, lonStr, found := strings.Cut(p, ","); found {
+			var errLat, errLon error
+			lat, errLat = strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+			lon, errLon = strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+			if errLat == nil && errLon == nil {
+				return lon, lat, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("unsupported geo point: %v", point)
+}
+
+// geoDistanceUnits maps Elasticsearch distance units to meters
+var geoDistanceUnits = []struct {
+	suffixes []string
+	meters   float64
+}{
+	// longer suffixes first, so e.g. "nmi" isn't taken for "mi"
+	{[]string{"nauticalmiles", "nmi", "NM"}, 1852},
+	{[]string{"kilometers", "km"}, 1000},
+	{[]string{"centimeters", "cm"}, 0.01},
+	{[]string{"millimeters", "mm"}, 0.001},
+	{[]string{"miles", "mi"}, 1609.344},
+	{[]string{"yards", "yd"}, 0.9144},
+	{[]string{"feet", "ft"}, 0.3048},
+	{[]string{"inch", "in"}, 0.0254},
+	{[]string{"meters", "m"}, 1},
+}
+
+// parseGeoDistance parses a distance like "12km" or 200 (meters by default) and returns it in meters
+func parseGeoDistance(distance any) (float64, error) {
+	switch d := distance.(type) {
+	case float64:
+		return d, nil
+	case int:
+		return float64(d), nil
+	case string:
+		d = strings.TrimSpace(d)
+		meters := 1.0
+	unitsLoop:
+		for _, unit := range geoDistanceUnits {
+			for _, suffix := range unit.suffixes {
+				if number, found := strings.CutSuffix(d, suffix); found {
+					d, meters = number, unit.meters
+					break unitsLoop
+				}
+			}
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(d), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid distance: %v", distance)
+		}
+		return value * meters, nil
+	}
+	return 0, fmt.Errorf("invalid distance: %v", distance)
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-geo-distance-query.html
+// Translated to greatCircleDistance(lon, lat, point_lon, point_lat) <= distance in meters
+func (cw *ClickhouseQueryTranslator) parseGeoDistance(queryMap QueryMap) model.SimpleQuery {
+	field, pointRaw, ok := cw.geoQueryField(queryMap, "geo_distance")
+	if !ok {
+		return model.NewSimpleQueryInvalid()
+	}
+	pointLon, pointLat, err := parseGeoPoint(pointRaw)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_distance query: %v", err)
+		return model.NewSimpleQueryInvalid()
+	}
+	distance, err := parseGeoDistance(queryMap["distance"])
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_distance query: %v", err)
+		return model.NewSimpleQueryInvalid()
+	}
+
+	lon, lat := geoPointColumns(field)
+	greatCircleDistance := model.NewFunction("greatCircleDistance", lon, lat, model.NewLiteral(pointLon), model.NewLiteral(pointLat))
+	return model.NewSimpleQuery(model.NewInfixExpr(greatCircleDistance, "<=", model.NewLiteral(distance)), true)
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-geo-polygon-query.html
+// Translated to pointInPolygon((lon, lat), [(lon_1, lat_1), ...])
+func (cw *ClickhouseQueryTranslator) parseGeoPolygon(queryMap QueryMap) model.SimpleQuery {
+	field, paramsRaw, ok := cw.geoQueryField(queryMap, "geo_polygon")
+	if !ok {
+		return model.NewSimpleQueryInvalid()
+	}
+	params, ok := paramsRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid geo_polygon parameters type: %T, value: %v", paramsRaw, paramsRaw)
+		return model.NewSimpleQueryInvalid()
+	}
+	pointsRaw, ok := params["points"].([]any)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no points in geo_polygon query: %v", queryMap)
+		return model.NewSimpleQueryInvalid()
+	}
+	ring := make([][2]float64, 0, len(pointsRaw))
+	for _, pointRaw := range pointsRaw {
+		lon, lat, err := parseGeoPoint(pointRaw)
+		if err != nil {
+			logger.WarnWithCtx(cw.Ctx).Msgf("geo_polygon query: %v", err)
+			return model.NewSimpleQueryInvalid()
+		}
+		ring = append(ring, [2]float64{lon, lat})
+	}
+	polygon, err := geoPolygonExpr(field, [][][2]float64{ring})
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_polygon query: %v", err)
+		return model.NewSimpleQueryInvalid()
+	}
+	return model.NewSimpleQuery(polygon, true)
+}
+
+// geoPolygonExpr checks if the point is in a polygon: the first ring is the outer one, the others are holes
+func geoPolygonExpr(field string, rings [][][2]float64) (model.Expr, error) {
+	if len(rings) == 0 || len(rings[0]) < 3 {
+		return nil, fmt.Errorf("polygon needs at least 3 points")
+	}
+	lon, lat := geoPointColumns(field)
+	args := []model.Expr{model.NewTupleExpr(lon, lat)}
+	for _, ring := range rings {
+		points := make([]string, 0, len(ring))
+		for _, point := range ring {
+			points = append(points, fmt.Sprintf("(%v, %v)", point[0], point[1]))
+		}
+		args = append(args, model.NewLiteral("["+strings.Join(points, ", ")+"]"))
+	}
+	return model.NewFunction("pointInPolygon", args...), nil
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-geo-shape-query.html
+// Only inline shapes (point, envelope, polygon, multipolygon) queried against geo_point fields are supported,
+// as we store points only. For points `intersects` and `within` are the same, `disjoint` is their negation.
+func (cw *ClickhouseQueryTranslator) parseGeoShape(queryMap QueryMap) model.SimpleQuery {
+	field, paramsRaw, ok := cw.geoQueryField(queryMap, "geo_shape")
+	if !ok {
+		return model.NewSimpleQueryInvalid()
+	}
+	params, ok := paramsRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid geo_shape parameters type: %T, value: %v", paramsRaw, paramsRaw)
+		return model.NewSimpleQueryInvalid()
+	}
+	shape, ok := params["shape"].(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_shape query supports only inline shapes, got: %v", params)
+		return model.NewSimpleQueryInvalid()
+	}
+	shapeExpr, err := cw.geoShapeExpr(field, shape)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_shape query: %v", err)
+		return model.NewSimpleQueryInvalid()
+	}
+
+	switch relation := strings.ToLower(cw.parseStringField(params, "relation", "intersects")); relation {
+	case "intersects", "within":
+		return model.NewSimpleQuery(shapeExpr, true)
+	case "disjoint":
+		return model.NewSimpleQuery(model.NewPrefixExpr("NOT", []model.Expr{shapeExpr}), true)
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported geo_shape relation: %s", relation)
+		return model.NewSimpleQueryInvalid()
+	}
+}
+
+func (cw *ClickhouseQueryTranslator) geoShapeExpr(field string, shape QueryMap) (model.Expr, error) {
+	shapeType := strings.ToLower(cw.parseStringField(shape, "type", ""))
+	coordinates := shape["coordinates"]
+	lon, lat := geoPointColumns(field)
+
+	switch shapeType {
+	case "point":
+		pointLon, pointLat, err := parseGeoPoint(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return model.And([]model.Expr{
+			model.NewInfixExpr(lon, "=", model.NewLiteral(pointLon)),
+			model.NewInfixExpr(lat, "=", model.NewLiteral(pointLat)),
+		}), nil
+	case "envelope":
+		// [[min_lon, max_lat], [max_lon, min_lat]]
+		corners, ok := coordinates.([]any)
+		if !ok || len(corners) != 2 {
+			return nil, fmt.Errorf("envelope needs 2 corners, got: %v", coordinates)
+		}
+		left, top, err := parseGeoPoint(corners[0])
+		if err != nil {
+			return nil, err
+		}
+		right, bottom, err := parseGeoPoint(corners[1])
+		if err != nil {
+			return nil, err
+		}
+		return model.And([]model.Expr{
+			model.NewInfixExpr(lon, ">=", model.NewLiteral(left)),
+			model.NewInfixExpr(lon, "<=", model.NewLiteral(right)),
+			model.NewInfixExpr(lat, ">=", model.NewLiteral(bottom)),
+			model.NewInfixExpr(lat, "<=", model.NewLiteral(top)),
+		}), nil
+	case "polygon":
+		rings, err := parseGeoRings(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return geoPolygonExpr(field, rings)
+	case "multipolygon":
+		polygonsRaw, ok := coordinates.([]any)
+		if !ok || len(polygonsRaw) == 0 {
+			return nil, fmt.Errorf("invalid multipolygon coordinates: %v", coordinates)
+		}
+		polygons := make([]model.Expr, 0, len(polygonsRaw))
+		for _, polygonRaw := range polygonsRaw {
+			rings, err := parseGeoRings(polygonRaw)
+			if err != nil {
+				return nil, err
+			}
+			polygon, err := geoPolygonExpr(field, rings)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, polygon)
+		}
+		return model.Or(polygons), nil
+	}
+	return nil, fmt.Errorf("unsupported shape type: %v", shape["type"])
+}
+
+// parseGeoRings parses GeoJSON polygon coordinates: a list of rings, each a list of [lon, lat]
+func parseGeoRings(coordinates any) ([][][2]float64, error) {
+	ringsRaw, ok := coordinates.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid polygon coordinates: %v", coordinates)
+	}
+	rings := make([][][2]float64, 0, len(ringsRaw))
+	for _, ringRaw := range ringsRaw {
+		pointsRaw, ok := ringRaw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid polygon ring: %v", ringRaw)
+		}
+		ring := make([][2]float64, 0, len(pointsRaw))
+		for _, pointRaw := range pointsRaw {
+			lon, lat, err := parseGeoPoint(pointRaw)
+			if err != nil {
+				return nil, err
+			}
+			ring = append(ring, [2]float64{lon, lat})
+		}
+		rings = append(rings, ring)
+	}
+	return rings, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/config"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
 	"github.com/QuesmaOrg/quesma/quesma/model"
 	"github.com/QuesmaOrg/quesma/quesma/model/typical_queries"
@@ -21,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO:
@@ -318,3 +320,326 @@ func TestInvalidQueryRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestGeoQueries(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantedSql string // empty means the query is invalid
+	}{
+		{
+			"geo_distance, point as object",
+			`{"geo_distance": {"distance": "12km", "OriginLocation": {"lat": 40, "lon": -70}}}`,
+			`greatCircleDistance(toFloat64(__quesma_geo_lon("OriginLocation")),toFloat64(__quesma_geo_lat("OriginLocation")),-70,40)<=12000`,
+		},
+		{
+			"geo_distance, point as string, distance in miles",
+			`{"geo_distance": {"distance": "2mi", "OriginLocation": "40.5,-70"}}`,
+			`greatCircleDistance(toFloat64(__quesma_geo_lon("OriginLocation")),toFloat64(__quesma_geo_lat("OriginLocation")),-70,40.5)<=3218.688`,
+		},
+		{
+			"geo_distance, WKT point, distance in nautical miles",
+			`{"geo_distance": {"distance": "1nmi", "OriginLocation": "POINT (-70 40)"}}`,
+			`greatCircleDistance(toFloat64(__quesma_geo_lon("OriginLocation")),toFloat64(__quesma_geo_lat("OriginLocation")),-70,40)<=1852`,
+		},
+		{
+			"geo_distance without distance",
+			`{"geo_distance": {"OriginLocation": [-70, 40]}}`,
+			"",
+		},
+		{
+			"geo_polygon",
+			`{"geo_polygon": {"OriginLocation": {"points": [[-70, 40], {"lat": 30, "lon": -80}, "20,-90"]}}}`,
+			`pointInPolygon(tuple(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(__quesma_geo_lat("OriginLocation"))),[(-70, 40), (-80, 30), (-90, 20)])`,
+		},
+		{
+			"geo_shape, envelope",
+			`{"geo_shape": {"OriginLocation": {"shape": {"type": "envelope", "coordinates": [[13, 53], [14, 52]]}, "relation": "within"}}}`,
+			`(((toFloat64(__quesma_geo_lon("OriginLocation"))>=13 AND toFloat64(__quesma_geo_lon("OriginLocation"))<=14) AND toFloat64(__quesma_geo_lat("OriginLocation"))>=52) AND toFloat64(__quesma_geo_lat("OriginLocation"))<=53)`,
+		},
+		{
+			"geo_shape, polygon with a hole, disjoint",
+			`{"geo_shape": {"OriginLocation": {"shape": {"type": "Polygon", "coordinates": [[[0, 0], [10, 0], [10, 10], [0, 0]], [[1, 1], [2, 1], [2, 2], [1, 1]]]}, "relation": "disjoint"}}}`,
+			`NOT (pointInPolygon(tuple(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(__quesma_geo_lat("OriginLocation"))),[(0, 0), (10, 0), (10, 10), (0, 0)],[(1, 1), (2, 1), (2, 2), (1, 1)]))`,
+		},
+		{
+			"geo_shape, multipolygon",
+			`{"geo_shape": {"OriginLocation": {"shape": {"type": "multipolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}}}}`,
+			`(pointInPolygon(tuple(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(__quesma_geo_lat("OriginLocation"))),[(0, 0), (1, 0), (1, 1), (0, 0)]) OR pointInPolygon(tuple(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(__quesma_geo_lat("OriginLocation"))),[(5, 5), (6, 5), (6, 6), (5, 5)]))`,
+		},
+		{
+			"geo_shape, indexed shape",
+			`{"geo_shape": {"OriginLocation": {"indexed_shape": {"index": "shapes", "id": "deu"}}}}`,
+			"",
+		},
+	}
+
+	cw := ClickhouseQueryTranslator{Table: &clickhouse.Table{Name: tableName}, Ctx: context.Background()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := types.ParseJSON(tt.query)
+			assert.NoError(t, err)
+			simpleQuery := cw.parseQueryMap(query)
+			if tt.wantedSql == "" {
+				assert.False(t, simpleQuery.CanParse)
+				return
+			}
+			assert.True(t, simpleQuery.CanParse)
+			assert.Equal(t, tt.wantedSql, model.AsString(simpleQuery.WhereClause))
+		})
+	}
+}
+
+func TestNestedQueries(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantedSql string
+	}{
+		{
+			"both conditions have to match the same nested document",
+			`{"nested": {"path": "comments", "query": {"bool": {"must": [{"match": {"comments.author": "alice"}}, {"range": {"comments.stars": {"gte": 4}}}]}}}}`,
+			`arrayExists((nested_doc) -> (tupleElement(nested_doc,'author') iLIKE '%alice%' AND tupleElement(nested_doc,'stars')>=4),"comments")`,
+		},
+		{
+			"match on a numeric element",
+			`{"nested": {"path": "comments", "query": {"match": {"comments.stars": "5"}}}}`,
+			`arrayExists((nested_doc) -> tupleElement(nested_doc,'stars')=5,"comments")`,
+		},
+		{
+			"match_all: any nested document",
+			`{"nested": {"path": "comments", "query": {"match_all": {}}}}`,
+			`notEmpty("comments")`,
+		},
+		{
+			"path isn't a nested field",
+			`{"nested": {"path": "user", "query": {"term": {"user.id": "kimchy"}}}}`,
+			`"user.id"='kimchy'`,
+		},
+	}
+
+	cw := ClickhouseQueryTranslator{Table: &clickhouse.Table{Name: tableName, Config: clickhouse.NewDefaultCHConfig()}, Ctx: context.Background(),
+		Schema: schema.Schema{Fields: map[schema.FieldName]schema.Field{
+			"comments": {PropertyName: "comments", InternalPropertyName: "comments", Type: schema.QuesmaTypeNested,
+				InternalPropertyType: "Array(Tuple(author Nullable(String), stars Nullable(Int64)))"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := types.ParseJSON(tt.query)
+			assert.NoError(t, err)
+			simpleQuery := cw.parseQueryMap(query)
+			assert.True(t, simpleQuery.CanParse)
+			assert.Equal(t, tt.wantedSql, model.AsString(simpleQuery.WhereClause))
+		})
+	}
+
+	// values of numeric elements are inlined unquoted, so they have to be numbers
+	for _, value := range []string{"5) OR 1=1 --", "five"} {
+		t.Run("match on a numeric element with "+value, func(t *testing.T) {
+			body := types.JSON{"query": map[string]any{"nested": map[string]any{"path": "comments", "query": map[string]any{"match": map[string]any{"comments.stars": value}}}}}
+			cw := cw
+			_, err := cw.ParseQuery(body)
+			assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+		})
+	}
+}
+
+func TestFuzzyQueries(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantedSql string // empty means the query is invalid
+	}{
+		{
+			"fuzzy, short form",
+			`{"fuzzy": {"customer": "smith"}}`,
+			`("customer" __quesma_fuzzy 'smith'~AUTO:3,6)`,
+		},
+		{
+			"fuzzy with parameters",
+			`{"fuzzy": {"customer": {"value": "smith", "fuzziness": 1, "prefix_length": 2, "transpositions": false}}}`,
+			`("customer" __quesma_fuzzy 'smith'~1)`,
+		},
+		{
+			"fuzzy with invalid fuzziness",
+			`{"fuzzy": {"customer": {"value": "smith", "fuzziness": 3}}}`,
+			"",
+		},
+		{
+			"match with fuzziness",
+			`{"match": {"message": {"query": "jon smith", "fuzziness": "AUTO:2,4"}}}`,
+			`(("message" __quesma_fuzzy 'jon'~AUTO:2,4) OR ("message" __quesma_fuzzy 'smith'~AUTO:2,4))`,
+		},
+		{
+			"query_string with fuzzy term",
+			`{"query_string": {"query": "customer:smith~ AND message:error", "fuzziness": 1}}`,
+			`(("customer" __quesma_fuzzy 'smith'~1) AND "message" ILIKE '%error%')`,
+		},
+	}
+
+	cw := ClickhouseQueryTranslator{Table: &clickhouse.Table{Name: tableName}, Ctx: context.Background()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := types.ParseJSON(tt.query)
+			assert.NoError(t, err)
+			simpleQuery := cw.parseQueryMap(query)
+			if tt.wantedSql == "" {
+				assert.False(t, simpleQuery.CanParse)
+				return
+			}
+			assert.True(t, simpleQuery.CanParse)
+			assert.Equal(t, tt.wantedSql, model.AsString(simpleQuery.WhereClause))
+		})
+	}
+}
+
+func TestScoringQueries(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantedWhere string
+		wantedScore string
+	}{
+		{
+			"match with boost",
+			`{"match": {"message": {"query": "quick fox", "boost": 2}}}`,
+			`(("message" __quesma_match 'quick') OR ("message" __quesma_match 'fox'))`,
+			`multiply(plus(if(("message" __quesma_match 'quick'),("message" __quesma_score 'quick'),0),if(("message" __quesma_match 'fox'),("message" __quesma_score 'fox'),0)),2)`,
+		},
+		{
+			"query_string with ^ boost",
+			`{"query_string": {"query": "message:quick^3 AND status:ok"}}`,
+			`("message" ILIKE '%quick%' AND "status" ILIKE '%ok%')`,
+			`plus(multiply(("message" __quesma_score 'quick'),3),("status" __quesma_score 'ok'))`,
+		},
+		{
+			"bool: must and matching should add up, filter doesn't score",
+			`{"bool": {"must": {"match": {"message": "quick"}}, "should": [{"term": {"status": "ok"}}], "filter": [{"range": {"age": {"gte": 18}}}]}}`,
+			`(("message" __quesma_match 'quick') AND "age">=18)`,
+			`plus(("message" __quesma_score 'quick'),if("status"='ok',1,0))`,
+		},
+		{
+			"constant_score",
+			`{"constant_score": {"filter": {"term": {"status": "ok"}}, "boost": 1.5}}`,
+			`"status"='ok'`,
+			`1.5`,
+		},
+		{
+			"dis_max",
+			`{"dis_max": {"queries": [{"term": {"status": "ok"}}, {"match": {"message": "quick"}}], "tie_breaker": 0.5}}`,
+			`("status"='ok' OR ("message" __quesma_match 'quick'))`,
+			`plus(greatest(if("status"='ok',1,0),if(("message" __quesma_match 'quick'),("message" __quesma_score 'quick'),0)),multiply(minus(plus(if("status"='ok',1,0),if(("message" __quesma_match 'quick'),("message" __quesma_score 'quick'),0)),greatest(if("status"='ok',1,0),if(("message" __quesma_match 'quick'),("message" __quesma_score 'quick'),0))),0.5))`,
+		},
+		{
+			"boosting",
+			`{"boosting": {"positive": {"match": {"message": "quick"}}, "negative": {"term": {"status": "error"}}, "negative_boost": 0.5}}`,
+			`("message" __quesma_match 'quick')`,
+			`multiply(("message" __quesma_score 'quick'),if("status"='error',0.5,1))`,
+		},
+		{
+			"function_score: field_value_factor and weight with filter",
+			`{"function_score": {"query": {"match": {"message": "quick"}}, "functions": [
+				{"field_value_factor": {"field": "likes", "factor": 1.2, "modifier": "log1p", "missing": 1}},
+				{"filter": {"term": {"status": "ok"}}, "weight": 3}
+			], "score_mode": "sum", "boost_mode": "replace", "max_boost": 10}}`,
+			`("message" __quesma_match 'quick')`,
+			`least(plus(log10(plus(multiply(coalesce("likes",1),1.2),1)),if("status"='ok',3,0)),10)`,
+		},
+		{
+			"function_score: decay function, min_score",
+			`{"function_score": {"gauss": {"age": {"origin": 30, "scale": 10, "offset": 5}}, "boost_mode": "sum", "min_score": 1.5}}`,
+			`plus(1,exp(multiply(pow(greatest(minus(abs(minus("age",30)),5),0),2),-0.006931471805599453)))>=1.5`,
+			`plus(1,exp(multiply(pow(greatest(minus(abs(minus("age",30)),5),0),2),-0.006931471805599453)))`,
+		},
+		{
+			"function_score: first matching function",
+			`{"function_score": {"functions": [{"filter": {"term": {"status": "ok"}}, "weight": 2}, {"filter": {"term": {"status": "error"}}, "weight": 0.5}], "score_mode": "first"}}`,
+			`<nil>`,
+			`multiply(1,multiIf("status"='ok',2,"status"='error',0.5,1))`,
+		},
+	}
+
+	table := clickhouse.Table{Name: tableName, Config: clickhouse.NewDefaultCHConfig(), Cols: map[string]*clickhouse.Column{
+		"message": {Name: "message", Type: clickhouse.NewBaseType("String")},
+		"status":  {Name: "status", Type: clickhouse.NewBaseType("String")},
+		"age":     {Name: "age", Type: clickhouse.NewBaseType("Int64")},
+		"likes":   {Name: "likes", Type: clickhouse.NewBaseType("Int64")},
+	}}
+	cw := ClickhouseQueryTranslator{Table: &table, Ctx: context.Background(), Scoring: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := types.ParseJSON(tt.query)
+			require.NoError(t, err)
+			simpleQuery := cw.parseQueryMap(query)
+			require.True(t, simpleQuery.CanParse)
+			if simpleQuery.WhereClause == nil {
+				assert.Equal(t, tt.wantedWhere, "<nil>")
+			} else {
+				assert.Equal(t, tt.wantedWhere, model.AsString(simpleQuery.WhereClause))
+			}
+			assert.Equal(t, tt.wantedScore, model.AsString(simpleQuery.Score))
+		})
+	}
+}
+
+func TestScoringQueriesInvalidParameters(t *testing.T) {
+	queries := []string{
+		`{"function_score": {"field_value_factor": {"field": "likes", "missing": "1) OR 1=1 --"}}}`,
+		`{"function_score": {"weight": 2, "max_boost": "1); DROP TABLE logs"}}`,
+		`{"function_score": {"weight": 2, "min_score": "0 OR 1=1"}}`,
+	}
+
+	table := clickhouse.Table{Name: tableName, Config: clickhouse.NewDefaultCHConfig(), Cols: map[string]*clickhouse.Column{
+		"likes": {Name: "likes", Type: clickhouse.NewBaseType("Int64")},
+	}}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			body, err := types.ParseJSON(`{"query": ` + query + `}`)
+			require.NoError(t, err)
+			cw := ClickhouseQueryTranslator{Table: &table, Ctx: context.Background(), Scoring: true}
+			_, err = cw.ParseQuery(body)
+			assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+		})
+	}
+}
+
+func TestScoringHitsQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantedSql string
+	}{
+		{
+			"no sort: sorted by score",
+			`{"query": {"match": {"message": "quick"}}}`,
+			`SELECT "message", ("message" __quesma_score 'quick') AS "_score" ` +
+				`FROM __quesma_table_name WHERE ("message" __quesma_match 'quick') ORDER BY "_score" DESC LIMIT 10`,
+		},
+		{
+			"explicit sort by score",
+			`{"query": {"match": {"message": "quick"}}, "sort": [{"@timestamp": "desc"}, {"_score": {"order": "asc"}}]}`,
+			`SELECT "message", ("message" __quesma_score 'quick') AS "_score" ` +
+				`FROM __quesma_table_name WHERE ("message" __quesma_match 'quick') ORDER BY "@timestamp" DESC, "_score" ASC LIMIT 10`,
+		},
+	}
+
+	table := clickhouse.Table{Name: tableName, Config: clickhouse.NewDefaultCHConfig(), Cols: map[string]*clickhouse.Column{
+		"message":    {Name: "message", Type: clickhouse.NewBaseType("String")},
+		"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+	}}
+	cw := ClickhouseQueryTranslator{Table: &table, Ctx: context.Background(), Scoring: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := types.ParseJSON(tt.body)
+			require.NoError(t, err)
+			simpleQuery, hitsInfo, highlighter, err := cw.parseQueryInternal(body)
+			require.NoError(t, err)
+			hitsInfo.Type = model.ListByField
+			hitsInfo.RequestedFields = []string{"message"}
+			hitsQuery := cw.buildListQueryIfNeeded(simpleQuery, hitsInfo, highlighter)
+			require.NotNil(t, hitsQuery)
+			assert.Equal(t, tt.wantedSql, hitsQuery.SelectCommand.String())
+		})
+	}
+}
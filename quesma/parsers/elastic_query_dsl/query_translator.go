@@ -23,6 +23,17 @@ type ClickhouseQueryTranslator struct {
 
 	Indexes []string
 
+	// Scoring <=> relevance score (_score) of hits is computed (see model/scoring.go), otherwise it's always 1
+	Scoring bool
+
+	// Strict <=> queries, which can't be translated exactly (would match more documents), can't be parsed.
+	// Searches are translated leniently, strict mode is for destructive requests, like `_delete_by_query`.
+	Strict      bool
+	relaxations []string
+
+	// invalidParameters are parts of the query which Elasticsearch rejects, the request is answered with 400 then
+	invalidParameters []string
+
 	// TODO this will be removed
 	Table *clickhouse.Table
 }
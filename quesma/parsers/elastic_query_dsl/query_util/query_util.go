@@ -23,7 +23,7 @@ func IsNonAggregationQuery(query *model.Query) bool {
 // IsAnyKindOfTerms returns true if queryType is Terms, Significant Terms, or Multi Terms
 func IsAnyKindOfTerms(queryType model.QueryType) bool {
 	switch queryType.(type) {
-	case bucket_aggregations.Terms, bucket_aggregations.MultiTerms:
+	case bucket_aggregations.Terms, bucket_aggregations.SignificantTerms, bucket_aggregations.MultiTerms:
 		return true
 	default:
 		return false
@@ -0,0 +1,411 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"math"
+	"strings"
+)
+
+// Compound queries which only change relevance score (see model/scoring.go).
+// Their WHERE clause is just that of the wrapped queries.
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-dis-max-query.html
+// Score is the highest score of matching queries, plus tie_breaker * scores of other matching queries.
+func (cw *ClickhouseQueryTranslator) parseDisMax(queryMap QueryMap) model.SimpleQuery {
+	queries, exists := queryMap["queries"]
+	if !exists {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no queries in dis_max query: %v", queryMap)
+		return model.NewSimpleQueryInvalid()
+	}
+	stmts, scores, canParse := cw.iterateListOrDictAndParse(queries)
+	if len(stmts) == 0 {
+		return model.NewSimpleQuery(nil, canParse)
+	}
+
+	matchedScores := make([]model.Expr, len(stmts))
+	for i, stmt := range stmts {
+		matchedScores[i] = model.ScoreIf(stmt, scores[i])
+	}
+	score := matchedScores[0]
+	if len(matchedScores) > 1 {
+		score = model.NewFunction("greatest", matchedScores...)
+		if tieBreaker := cw.parseFloatField(queryMap, "tie_breaker", 0); tieBreaker != 0 {
+			others := model.NewFunction("minus", model.ScoreSum(matchedScores...), score)
+			score = model.NewFunction("plus", score, model.ScoreBoost(others, tieBreaker))
+		}
+	}
+
+	query := model.NewSimpleQuery(model.Or(stmts), canParse)
+	query.Score = model.ScoreBoost(score, cw.parseFloatField(queryMap, "boost", 1))
+	return query
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-boosting-query.html
+// Documents matching `positive` are returned, and the score of those also matching `negative` is multiplied by negative_boost.
+func (cw *ClickhouseQueryTranslator) parseBoosting(queryMap QueryMap) model.SimpleQuery {
+	positiveMap, okPositive := queryMap["positive"].(QueryMap)
+	negativeMap, okNegative := queryMap["negative"].(QueryMap)
+	negativeBoost, okNegativeBoost := queryMap["negative_boost"].(float64)
+	if !okPositive || !okNegative || !okNegativeBoost {
+		logger.WarnWithCtx(cw.Ctx).Msgf("boosting query needs positive, negative and negative_boost, got: %v", queryMap)
+		return model.NewSimpleQueryInvalid()
+	}
+
+	positive := cw.parseQueryMap(positiveMap)
+	negative := cw.parseQueryMap(negativeMap)
+	if !positive.CanParse || !negative.CanParse {
+		return model.NewSimpleQueryInvalid()
+	}
+
+	query := model.NewSimpleQuery(positive.WhereClause, true)
+	if negative.WhereClause == nil { // everything is negative
+		query.Score = model.ScoreBoost(positive.ScoreOrDefault(), negativeBoost)
+	} else {
+		query.Score = model.NewFunction("multiply", positive.ScoreOrDefault(), model.NewFunction("if", negative.WhereClause, model.NewLiteral(negativeBoost), model.NewLiteral(1)))
+	}
+	return query
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-function-score-query.html
+// Supported functions: weight, field_value_factor, random_score, script_score and decay functions (gauss, exp, linear) on numeric and date fields.
+// Unsupported ones (e.g. scripts which can't be compiled to SQL) are ignored, i.e. they're treated like a function returning 1.
+func (cw *ClickhouseQueryTranslator) parseFunctionScore(queryMap QueryMap) model.SimpleQuery {
+	query := model.NewSimpleQuery(nil, true)
+	if innerQueryMap, exists := queryMap["query"]; exists {
+		innerQueryMapTyped, ok := innerQueryMap.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid query type in function_score: %T, value: %v", innerQueryMap, innerQueryMap)
+			return model.NewSimpleQueryInvalid()
+		}
+		query = cw.parseQueryMap(innerQueryMapTyped)
+		if !query.CanParse {
+			return query
+		}
+	}
+
+	// functions: either a list, or a single function in the query itself
+	var functionMaps []QueryMap
+	if functions, exists := queryMap["functions"]; exists {
+		functionsArray, ok := functions.([]any)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid functions type in function_score: %T, value: %v", functions, functions)
+			return model.NewSimpleQueryInvalid()
+		}
+		for _, function := range functionsArray {
+			if functionMap, ok := function.(QueryMap); ok {
+				functionMaps = append(functionMaps, functionMap)
+			} else {
+				logger.WarnWithCtx(cw.Ctx).Msgf("invalid function type in function_score: %T, value: %v", function, function)
+				return model.NewSimpleQueryInvalid()
+			}
+		}
+	} else {
+		functionMaps = append(functionMaps, queryMap)
+	}
+
+	var functions, filters []model.Expr // filters[i] == nil <=> i-th function applies to all documents
+	queryScore := query.ScoreOrDefault()
+	invalidParametersCount := len(cw.invalidParameters)
+	for _, functionMap := range functionMaps {
+		function, isFunction := cw.parseScoreFunction(functionMap, queryScore)
+		if len(cw.invalidParameters) > invalidParametersCount {
+			return model.NewSimpleQueryInvalid()
+		}
+		if !isFunction {
+			continue
+		}
+		var filter model.Expr
+		if filterMap, exists := functionMap["filter"].(QueryMap); exists {
+			filterQuery := cw.parseQueryMap(filterMap)
+			if !filterQuery.CanParse {
+				return model.NewSimpleQueryInvalid()
+			}
+			filter = filterQuery.WhereClause
+		}
+		functions = append(functions, function)
+		filters = append(filters, filter)
+	}
+
+	score := queryScore
+	if len(functions) > 0 {
+		functionScore, err := combineScoreFunctions(functions, filters, cw.parseStringField(queryMap, "score_mode", "multiply"))
+		if err != nil {
+			logger.WarnWithCtx(cw.Ctx).Msgf("function_score: %v", err)
+			return model.NewSimpleQueryInvalid()
+		}
+		if maxBoostRaw, exists := queryMap["max_boost"]; exists {
+			maxBoost, ok := maxBoostRaw.(float64)
+			if !ok {
+				cw.invalidParameter("function_score: max_boost must be a number, got: %v", maxBoostRaw)
+				return model.NewSimpleQueryInvalid()
+			}
+			functionScore = model.NewFunction("least", functionScore, model.NewLiteral(maxBoost))
+		}
+
+		switch boostMode := cw.parseStringField(queryMap, "boost_mode", "multiply"); boostMode {
+		case "multiply":
+			score = model.NewFunction("multiply", queryScore, functionScore)
+		case "replace":
+			score = functionScore
+		case "sum":
+			score = model.NewFunction("plus", queryScore, functionScore)
+		case "avg":
+			score = model.NewFunction("divide", model.NewFunction("plus", queryScore, functionScore), model.NewLiteral(2))
+		case "max":
+			score = model.NewFunction("greatest", queryScore, functionScore)
+		case "min":
+			score = model.NewFunction("least", queryScore, functionScore)
+		default:
+			logger.WarnWithCtx(cw.Ctx).Msgf("unknown boost_mode in function_score: %s", boostMode)
+			return model.NewSimpleQueryInvalid()
+		}
+	}
+	query.Score = model.ScoreBoost(score, cw.parseFloatField(queryMap, "boost", 1))
+
+	if minScoreRaw, exists := queryMap["min_score"]; exists {
+		minScore, ok := minScoreRaw.(float64)
+		if !ok {
+			cw.invalidParameter("function_score: min_score must be a number, got: %v", minScoreRaw)
+			return model.NewSimpleQueryInvalid()
+		}
+		query.WhereClause = model.And([]model.Expr{query.WhereClause, model.NewInfixExpr(query.Score, ">=", model.NewLiteral(minScore))})
+	}
+	return query
+}
+
+// parseScoreFunction returns the score function (multiplied by its weight), or false if there's none (or it's unsupported).
+// queryScore is the score of the query, available as _score in scripts.
+func (cw *ClickhouseQueryTranslator) parseScoreFunction(functionMap QueryMap, queryScore model.Expr) (function model.Expr, isFunction bool) {
+	weight, hasWeight := functionMap["weight"].(float64)
+
+	for name, params := range functionMap {
+		paramsMap, _ := params.(QueryMap)
+		switch name {
+		case "field_value_factor":
+			function = cw.parseFieldValueFactor(paramsMap)
+		case "random_score":
+			// seed and field are ignored, so it's not reproducible
+			function = model.NewFunction("randCanonical")
+		case "gauss", "exp", "linear":
+			function = cw.parseDecayFunction(name, paramsMap)
+		case "script_score":
+			variables := map[string]compiledScriptExpr{model.ScoreFieldName: {expr: queryScore, valueType: scriptNumberType}}
+			if script, err := cw.compileScript(paramsMap["script"], variables); err == nil {
+				function = script.expr
+			} else {
+				logger.WarnWithCtx(cw.Ctx).Msgf("function_score: can't compile script_score, ignoring it: %v", err)
+			}
+		}
+	}
+
+	switch {
+	case function != nil && hasWeight:
+		return model.ScoreBoost(function, weight), true
+	case function != nil:
+		return function, true
+	case hasWeight:
+		return model.NewLiteral(weight), true
+	default:
+		return nil, false
+	}
+}
+
+// field_value_factor: modifier(factor * field), `missing` is used for documents without the field
+func (cw *ClickhouseQueryTranslator) parseFieldValueFactor(params QueryMap) model.Expr {
+	fieldName, ok := params["field"].(string)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("field_value_factor needs a field, got: %v", params)
+		return nil
+	}
+	var value model.Expr = model.NewColumnRef(ResolveField(cw.Ctx, fieldName, cw.Schema))
+	if missingRaw, exists := params["missing"]; exists {
+		missing, ok := missingRaw.(float64)
+		if !ok {
+			cw.invalidParameter("field_value_factor: missing must be a number, got: %v", missingRaw)
+			return nil
+		}
+		value = model.NewFunction("coalesce", value, model.NewLiteral(missing))
+	}
+	value = model.ScoreBoost(value, cw.parseFloatField(params, "factor", 1))
+
+	plus := func(addend int) model.Expr { return model.NewFunction("plus", value, model.NewLiteral(addend)) }
+	switch modifier := cw.parseStringField(params, "modifier", "none"); modifier {
+	case "none":
+		return value
+	case "log":
+		return model.NewFunction("log10", value)
+	case "log1p":
+		return model.NewFunction("log10", plus(1))
+	case "log2p":
+		return model.NewFunction("log10", plus(2))
+	case "ln":
+		return model.NewFunction("log", value)
+	case "ln1p":
+		return model.NewFunction("log", plus(1))
+	case "ln2p":
+		return model.NewFunction("log", plus(2))
+	case "square":
+		return model.NewFunction("pow", value, model.NewLiteral(2))
+	case "sqrt":
+		return model.NewFunction("sqrt", value)
+	case "reciprocal":
+		return model.NewFunction("divide", model.NewLiteral(1), value)
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("unknown field_value_factor modifier: %s", modifier)
+		return nil
+	}
+}
+
+// Decay functions: score decays with the distance from origin, it's `decay` at distance `scale` (+ `offset`).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-function-score-query.html#function-decay
+func (cw *ClickhouseQueryTranslator) parseDecayFunction(name string, params QueryMap) model.Expr {
+	for fieldName, fieldParamsRaw := range params {
+		if fieldName == "multi_value_mode" {
+			continue
+		}
+		fieldParams, ok := fieldParamsRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid %s decay function params: %v", name, fieldParamsRaw)
+			return nil
+		}
+		distance, scale, offset, err := cw.parseDecayDistance(fieldName, fieldParams)
+		if err != nil {
+			logger.WarnWithCtx(cw.Ctx).Msgf("%s decay function: %v", name, err)
+			return nil
+		}
+		decay := cw.parseFloatField(fieldParams, "decay", 0.5)
+		if scale <= 0 || decay <= 0 || decay >= 1 {
+			logger.WarnWithCtx(cw.Ctx).Msgf("%s decay function needs scale > 0 and 0 < decay < 1, got: %v", name, fieldParams)
+			return nil
+		}
+
+		if offset > 0 {
+			distance = model.NewFunction("greatest", model.NewFunction("minus", distance, model.NewLiteral(offset)), model.NewLiteral(0))
+		}
+		switch name {
+		case "gauss":
+			return model.NewFunction("exp", model.NewFunction("multiply", model.NewFunction("pow", distance, model.NewLiteral(2)), model.NewLiteral(math.Log(decay)/(scale*scale))))
+		case "exp":
+			return model.NewFunction("exp", model.NewFunction("multiply", distance, model.NewLiteral(math.Log(decay)/scale)))
+		case "linear":
+			s := scale / (1 - decay)
+			return model.NewFunction("greatest", model.NewFunction("divide", model.NewFunction("minus", model.NewLiteral(s), distance), model.NewLiteral(s)), model.NewLiteral(0))
+		}
+	}
+	logger.WarnWithCtx(cw.Ctx).Msgf("no field in %s decay function: %v", name, params)
+	return nil
+}
+
+// parseDecayDistance returns the distance of the field from origin, and scale and offset in the same unit.
+// For dates it's milliseconds, origin is a date or date math (default: now), scale and offset are like "10d".
+func (cw *ClickhouseQueryTranslator) parseDecayDistance(fieldName string, params QueryMap) (distance model.Expr, scale, offset float64, err error) {
+	field := ResolveField(cw.Ctx, fieldName, cw.Schema)
+	var fieldType schema.QuesmaType
+	if schemaField, found := cw.Schema.ResolveField(fieldName); found {
+		fieldType = schemaField.Type
+	}
+
+	if fieldType.Name != schema.QuesmaTypeDate.Name && fieldType.Name != schema.QuesmaTypeTimestamp.Name {
+		origin, okOrigin := params["origin"].(float64)
+		scale, okScale := params["scale"].(float64)
+		if !okOrigin || !okScale {
+			return nil, 0, 0, fmt.Errorf("numeric origin and scale are required for field %s, got: %v", fieldName, params)
+		}
+		distance = model.NewFunction("abs", model.NewFunction("minus", model.NewColumnRef(field), model.NewLiteral(origin)))
+		return distance, scale, cw.parseFloatField(params, "offset", 0), nil
+	}
+
+	var originExpr model.Expr
+	if origin := cw.parseStringField(params, "origin", "now"); strings.HasPrefix(origin, "now") {
+		if sql, err := cw.parseDateMathExpression(origin); err == nil {
+			originExpr = model.NewLiteral(sql)
+		} else {
+			return nil, 0, 0, fmt.Errorf("invalid origin %s: %v", origin, err)
+		}
+	} else {
+		originExpr = model.NewFunction("parseDateTime64BestEffort", model.NewLiteral(util.SingleQuote(origin)))
+	}
+	toMillis := func(date model.Expr) model.Expr {
+		return model.NewFunction("toUnixTimestamp64Milli", model.NewFunction("toDateTime64", date, model.NewLiteral(3)))
+	}
+	distance = model.NewFunction("abs", model.NewFunction("minus", toMillis(model.NewColumnRef(field)), toMillis(originExpr)))
+
+	scaleDuration, err := util.ParseInterval(cw.parseStringField(params, "scale", ""))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid scale: %v", err)
+	}
+	offsetDuration, err := util.ParseInterval(cw.parseStringField(params, "offset", "0ms"))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid offset: %v", err)
+	}
+	return distance, float64(scaleDuration.Milliseconds()), float64(offsetDuration.Milliseconds()), nil
+}
+
+// combineScoreFunctions combines function scores according to score_mode.
+// Functions with a filter apply only to matching documents. If no function applies, the result is 1.
+func combineScoreFunctions(functions, filters []model.Expr, scoreMode string) (model.Expr, error) {
+	var anyApplies model.Expr = model.TrueExpr
+	if filtersNotNil := model.FilterOutEmptyStatements(filters); len(filtersNotNil) == len(filters) {
+		anyApplies = model.Or(filtersNotNil)
+	}
+	valueIfApplies := func(i int, otherwise model.Expr) model.Expr {
+		if filters[i] == nil {
+			return functions[i]
+		}
+		return model.NewFunction("if", filters[i], functions[i], otherwise)
+	}
+	foldAll := func(functionName string, otherwise model.Expr) model.Expr {
+		result := valueIfApplies(0, otherwise)
+		for i := 1; i < len(functions); i++ {
+			result = model.NewFunction(functionName, result, valueIfApplies(i, otherwise))
+		}
+		return result
+	}
+	orOne := func(score model.Expr) model.Expr {
+		if anyApplies == model.TrueExpr {
+			return score
+		}
+		return model.NewFunction("if", anyApplies, score, model.NewLiteral(1))
+	}
+
+	switch scoreMode {
+	case "multiply":
+		return foldAll("multiply", model.NewLiteral(1)), nil
+	case "sum":
+		return orOne(foldAll("plus", model.NewLiteral(0))), nil
+	case "avg":
+		count := model.NewLiteral(len(functions))
+		if anyApplies != model.TrueExpr {
+			counts := make([]model.Expr, len(filters))
+			for i, filter := range filters {
+				counts[i] = model.ScoreIf(filter, model.NewLiteral(1))
+			}
+			return orOne(model.NewFunction("divide", foldAll("plus", model.NewLiteral(0)), model.ScoreSum(counts...))), nil
+		}
+		return model.NewFunction("divide", foldAll("plus", model.NewLiteral(0)), count), nil
+	case "max":
+		return orOne(foldAll("greatest", model.NewLiteral("-inf"))), nil
+	case "min":
+		return orOne(foldAll("least", model.NewLiteral("inf"))), nil
+	case "first":
+		args := make([]model.Expr, 0, 2*len(functions)+1)
+		for i, function := range functions {
+			if filters[i] == nil {
+				if len(args) == 0 {
+					return function, nil
+				}
+				return model.NewFunction("multiIf", append(args, function)...), nil
+			}
+			args = append(args, filters[i], function)
+		}
+		return model.NewFunction("multiIf", append(args, model.NewLiteral(1))...), nil
+	default:
+		return nil, fmt.Errorf("unknown score_mode: %s", scoreMode)
+	}
+}
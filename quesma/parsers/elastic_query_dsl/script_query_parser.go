@@ -0,0 +1,103 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_query_dsl
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+)
+
+// compileScript compiles a Painless script, given as in Elastic (see parseScriptSource).
+// variables are predefined variables available in the script (e.g. _score)
+func (cw *ClickhouseQueryTranslator) compileScript(scriptRaw any, variables map[string]compiledScriptExpr) (compiledScriptExpr, error) {
+	source, params, err := parseScriptSource(scriptRaw)
+	if err != nil {
+		return compiledScriptExpr{}, err
+	}
+
+	compiler := newPainlessCompiler(cw.Ctx, cw.Schema, params)
+	for name, value := range variables {
+		compiler.variables[name] = value
+	}
+	return compiler.compileScript(source)
+}
+
+// parseScriptSource parses a script given as in Elastic: either a string (source),
+// or {"source": "...", "params": {...}, "lang": "painless"}. Stored scripts ("id") aren't supported.
+func parseScriptSource(scriptRaw any) (source string, params QueryMap, err error) {
+	switch script := scriptRaw.(type) {
+	case string:
+		source = script
+	case QueryMap:
+		if lang, exists := script["lang"]; exists && lang != "painless" {
+			return "", nil, fmt.Errorf("unsupported script language: %v", lang)
+		}
+		if _, exists := script["id"]; exists {
+			return "", nil, fmt.Errorf("stored scripts are not supported")
+		}
+		sourceRaw, exists := script["source"]
+		if !exists {
+			sourceRaw = script["inline"] // deprecated name of source
+		}
+		var ok bool
+		if source, ok = sourceRaw.(string); !ok {
+			return "", nil, fmt.Errorf("script source is not a string, but %T, value: %v", sourceRaw, sourceRaw)
+		}
+		if paramsRaw, exists := script["params"]; exists {
+			if params, ok = paramsRaw.(QueryMap); !ok {
+				return "", nil, fmt.Errorf("script params are not a map, but %T, value: %v", paramsRaw, paramsRaw)
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid script type: %T, value: %v", scriptRaw, scriptRaw)
+	}
+	return source, params, nil
+}
+
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-script-query.html
+// The script is compiled to SQL (see painlessCompiler) and becomes the WHERE clause.
+func (cw *ClickhouseQueryTranslator) parseScriptQuery(queryMap QueryMap) model.SimpleQuery {
+	scriptRaw, exists := queryMap["script"]
+	if !exists {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no script in script query: %v", queryMap)
+		return model.NewSimpleQueryInvalid()
+	}
+
+	script, err := cw.compileScript(scriptRaw, nil)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't compile script query: %v", err)
+		return model.NewSimpleQueryInvalid()
+	}
+	if script.valueType != scriptBoolType && script.valueType != scriptUnknownType {
+		logger.WarnWithCtx(cw.Ctx).Msgf("script query must return a boolean, got: %s", model.AsString(script.expr))
+		return model.NewSimpleQueryInvalid()
+	}
+	return model.NewSimpleQuery(script.expr, true)
+}
+
+// parseScriptSortColumn parses `"_script": {"type": "number", "script": {...}, "order": "asc"}`.
+// It returns false if the script can't be compiled.
+func (cw *ClickhouseQueryTranslator) parseScriptSortColumn(sortValue any) (model.OrderByExpr, bool) {
+	sortMap, ok := sortValue.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid _script sort type: %T, value: %v", sortValue, sortValue)
+		return model.OrderByExpr{}, false
+	}
+
+	script, err := cw.compileScript(sortMap["script"], nil)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't compile _script sort: %v", err)
+		return model.OrderByExpr{}, false
+	}
+
+	switch order := cw.parseStringField(sortMap, "order", "asc"); order {
+	case "asc":
+		return model.NewOrderByExpr(script.expr, model.AscOrder), true
+	case "desc":
+		return model.NewOrderByExpr(script.expr, model.DescOrder), true
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("unexpected order value: [%s] for _script sort", order)
+		return model.OrderByExpr{}, false
+	}
+}
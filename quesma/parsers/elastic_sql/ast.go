@@ -0,0 +1,102 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+// Statement is a parsed Elasticsearch SQL query. Only SELECT statements are supported.
+type Statement struct {
+	Distinct bool
+	Columns  []SelectItem
+	Index    string // index name or pattern from the FROM clause
+	Where    Node   // nil if there's no WHERE clause
+	GroupBy  []Node
+	OrderBy  []OrderItem
+	Limit    int // noLimit if there's no LIMIT clause
+}
+
+const noLimit = -1
+
+// SelectItem is a single element of the SELECT list. Name is the name of the resulting column:
+// alias if present, otherwise the original text of the expression (that's what Elasticsearch does).
+type SelectItem struct {
+	Expr Node
+	Name string
+}
+
+type OrderItem struct {
+	Expr Node
+	Desc bool
+}
+
+type Node interface {
+	isNode()
+}
+
+// Star is `*`, either in the SELECT list or in COUNT(*)
+type Star struct{}
+
+type Field struct {
+	Name string
+}
+
+type Literal struct {
+	Value any // string, int64, float64, bool or nil
+}
+
+type Binary struct {
+	Op    string // arithmetic or comparison operator, AND, OR
+	Left  Node
+	Right Node
+}
+
+type Unary struct {
+	Op   string // NOT or -
+	Expr Node
+}
+
+type FunctionCall struct {
+	Name     string // upper-cased
+	Distinct bool   // COUNT(DISTINCT x)
+	Args     []Node
+}
+
+type In struct {
+	Expr    Node
+	Values  []Node
+	Negated bool
+}
+
+type Between struct {
+	Expr    Node
+	From    Node
+	To      Node
+	Negated bool
+}
+
+type Like struct {
+	Expr    Node
+	Pattern string
+	Regex   bool // RLIKE
+	Negated bool
+}
+
+type IsNull struct {
+	Expr    Node
+	Negated bool
+}
+
+type Cast struct {
+	Expr Node
+	Type string // upper-cased SQL type name
+}
+
+func (Star) isNode()         {}
+func (Field) isNode()        {}
+func (Literal) isNode()      {}
+func (Binary) isNode()       {}
+func (Unary) isNode()        {}
+func (FunctionCall) isNode() {}
+func (In) isNode()           {}
+func (Between) isNode()      {}
+func (Like) isNode()         {}
+func (IsNull) isNode()       {}
+func (Cast) isNode()         {}
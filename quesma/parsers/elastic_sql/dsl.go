@@ -0,0 +1,318 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"strings"
+)
+
+// This file translates SQL statements into equivalent Query DSL requests, which is what `_sql/translate` returns.
+// Only the subset which maps directly to Query DSL is supported: conditions comparing fields with literals,
+// full-text functions, plain columns and simple GROUP BY (as `composite` aggregation).
+
+const defaultCompositeSize = 1000
+
+func fullTextFunctionToDSL(call FunctionCall) (types.JSON, error) {
+	switch call.Name {
+	case "MATCH":
+		if len(call.Args) != 2 {
+			return nil, fmt.Errorf("MATCH requires 2 arguments, got %d", len(call.Args))
+		}
+		text, err := stringArg(call, 1)
+		if err != nil {
+			return nil, err
+		}
+		if field, ok := call.Args[0].(Field); ok {
+			return types.JSON{"match": map[string]any{field.Name: map[string]any{"query": text}}}, nil
+		}
+		// MATCH('field1^2,field2', 'text')
+		fields, err := stringArg(call, 0)
+		if err != nil {
+			return nil, fmt.Errorf("first argument of MATCH must be a field or a string with fields")
+		}
+		return types.JSON{"multi_match": map[string]any{"query": text, "fields": strings.Split(fields, ",")}}, nil
+	case "QUERY":
+		if len(call.Args) != 1 {
+			return nil, fmt.Errorf("QUERY requires 1 argument, got %d", len(call.Args))
+		}
+		query, err := stringArg(call, 0)
+		if err != nil {
+			return nil, err
+		}
+		return types.JSON{"query_string": map[string]any{"query": query}}, nil
+	}
+	return nil, fmt.Errorf("%s is not a full-text function", call.Name)
+}
+
+func boolQuery(occur string, queries ...any) types.JSON {
+	return types.JSON{"bool": map[string]any{occur: queries}}
+}
+
+func notDSLTranslatable(node Node) error {
+	return fmt.Errorf("can't translate [%T] condition to Query DSL", node)
+}
+
+// conditionToDSL translates WHERE clause into Query DSL query
+func conditionToDSL(node Node) (types.JSON, error) {
+	switch n := node.(type) {
+	case Binary:
+		switch n.Op {
+		case "AND", "OR":
+			left, err := conditionToDSL(n.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := conditionToDSL(n.Right)
+			if err != nil {
+				return nil, err
+			}
+			if n.Op == "AND" {
+				return boolQuery("filter", left, right), nil
+			}
+			return boolQuery("should", left, right), nil
+		}
+		return comparisonToDSL(n)
+	case Unary:
+		if n.Op != "NOT" {
+			return nil, notDSLTranslatable(node)
+		}
+		inner, err := conditionToDSL(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return boolQuery("must_not", inner), nil
+	case In:
+		field, ok := n.Expr.(Field)
+		if !ok {
+			return nil, notDSLTranslatable(node)
+		}
+		values := make([]any, 0, len(n.Values))
+		for _, value := range n.Values {
+			lit, ok := value.(Literal)
+			if !ok {
+				return nil, notDSLTranslatable(node)
+			}
+			values = append(values, lit.Value)
+		}
+		result := types.JSON{"terms": map[string]any{field.Name: values}}
+		if n.Negated {
+			return boolQuery("must_not", result), nil
+		}
+		return result, nil
+	case Between:
+		field, fieldOk := n.Expr.(Field)
+		from, fromOk := n.From.(Literal)
+		to, toOk := n.To.(Literal)
+		if !fieldOk || !fromOk || !toOk {
+			return nil, notDSLTranslatable(node)
+		}
+		result := types.JSON{"range": map[string]any{field.Name: map[string]any{"gte": from.Value, "lte": to.Value}}}
+		if n.Negated {
+			return boolQuery("must_not", result), nil
+		}
+		return result, nil
+	case Like:
+		field, ok := n.Expr.(Field)
+		if !ok {
+			return nil, notDSLTranslatable(node)
+		}
+		var result types.JSON
+		if n.Regex {
+			result = types.JSON{"regexp": map[string]any{field.Name: map[string]any{"value": n.Pattern}}}
+		} else {
+			wildcard := strings.NewReplacer("%", "*", "_", "?").Replace(n.Pattern)
+			result = types.JSON{"wildcard": map[string]any{field.Name: map[string]any{"wildcard": wildcard}}}
+		}
+		if n.Negated {
+			return boolQuery("must_not", result), nil
+		}
+		return result, nil
+	case IsNull:
+		field, ok := n.Expr.(Field)
+		if !ok {
+			return nil, notDSLTranslatable(node)
+		}
+		result := types.JSON{"exists": map[string]any{"field": field.Name}}
+		if n.Negated {
+			return result, nil
+		}
+		return boolQuery("must_not", result), nil
+	case FunctionCall:
+		return fullTextFunctionToDSL(n)
+	case Literal:
+		if b, ok := n.Value.(bool); ok {
+			if b {
+				return types.JSON{"match_all": map[string]any{}}, nil
+			}
+			return types.JSON{"match_none": map[string]any{}}, nil
+		}
+	}
+	return nil, notDSLTranslatable(node)
+}
+
+var rangeOperators = map[string]string{"<": "lt", "<=": "lte", ">": "gt", ">=": "gte"}
+var flippedOperators = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<=", "=": "=", "!=": "!="}
+
+func comparisonToDSL(n Binary) (types.JSON, error) {
+	field, fieldOk := n.Left.(Field)
+	lit, litOk := n.Right.(Literal)
+	op := n.Op
+	if !fieldOk || !litOk {
+		// `5 < field`
+		field, fieldOk = n.Right.(Field)
+		lit, litOk = n.Left.(Literal)
+		op = flippedOperators[n.Op]
+	}
+	if !fieldOk || !litOk {
+		return nil, notDSLTranslatable(n)
+	}
+
+	switch op {
+	case "=":
+		return types.JSON{"term": map[string]any{field.Name: map[string]any{"value": lit.Value}}}, nil
+	case "!=":
+		return boolQuery("must_not", types.JSON{"term": map[string]any{field.Name: map[string]any{"value": lit.Value}}}), nil
+	}
+	if rangeOp, ok := rangeOperators[op]; ok {
+		return types.JSON{"range": map[string]any{field.Name: map[string]any{rangeOp: lit.Value}}}, nil
+	}
+	return nil, notDSLTranslatable(n)
+}
+
+// ToQueryDSL translates the statement into an equivalent Query DSL request (`_sql/translate`)
+func (s *Statement) ToQueryDSL(filter types.JSON, fieldNames []string, fetchSize int) (types.JSON, error) {
+	request := types.JSON{"_source": false}
+
+	var conditions []any
+	if s.Where != nil {
+		where, err := conditionToDSL(s.Where)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, where)
+	}
+	if filter != nil {
+		conditions = append(conditions, filter)
+	}
+	switch len(conditions) {
+	case 0:
+	case 1:
+		request["query"] = conditions[0]
+	default:
+		request["query"] = boolQuery("filter", conditions...)
+	}
+
+	aggregations, isAggregation, err := s.aggregationsToDSL()
+	if err != nil {
+		return nil, err
+	}
+	if isAggregation {
+		request["size"] = 0
+		request["aggregations"] = aggregations
+		request["track_total_hits"] = -1
+		return request, nil
+	}
+
+	fields := make([]any, 0, len(fieldNames))
+	for _, name := range fieldNames {
+		fields = append(fields, map[string]any{"field": name})
+	}
+	request["fields"] = fields
+
+	size := fetchSize
+	if s.Limit != noLimit && s.Limit < size {
+		size = s.Limit
+	}
+	request["size"] = size
+
+	sort := make([]any, 0, len(s.OrderBy))
+	for _, item := range s.OrderBy {
+		field, ok := item.Expr.(Field)
+		if !ok {
+			return nil, fmt.Errorf("can't translate ORDER BY [%T] to Query DSL", item.Expr)
+		}
+		order := "asc"
+		if item.Desc {
+			order = "desc"
+		}
+		sort = append(sort, map[string]any{field.Name: map[string]any{"order": order, "missing": "_last"}})
+	}
+	if len(sort) == 0 {
+		sort = append(sort, map[string]any{"_doc": map[string]any{"order": "asc"}})
+	}
+	request["sort"] = sort
+	return request, nil
+}
+
+// aggregationsToDSL translates GROUP BY and aggregate functions.
+// isAggregation is false, if the statement is not an aggregation.
+func (s *Statement) aggregationsToDSL() (aggregations types.JSON, isAggregation bool, err error) {
+	metrics := types.JSON{}
+	for _, item := range s.Columns {
+		call, ok := item.Expr.(FunctionCall)
+		if !ok {
+			continue
+		}
+		if _, isAggregate := aggregateFunctions[call.Name]; !isAggregate {
+			continue
+		}
+		metric, err := metricToDSL(call)
+		if err != nil {
+			return nil, false, err
+		}
+		if metric != nil {
+			metrics[item.Name] = metric
+		}
+		isAggregation = true
+	}
+
+	if len(s.GroupBy) == 0 {
+		return metrics, isAggregation, nil
+	}
+
+	sources := make([]any, 0, len(s.GroupBy))
+	for _, groupBy := range s.GroupBy {
+		field, ok := groupBy.(Field)
+		if !ok {
+			return nil, false, fmt.Errorf("can't translate GROUP BY [%T] to Query DSL", groupBy)
+		}
+		sources = append(sources, map[string]any{
+			field.Name: map[string]any{"terms": map[string]any{"field": field.Name, "missing_bucket": true, "order": "asc"}},
+		})
+	}
+	groupBy := types.JSON{"composite": map[string]any{"size": defaultCompositeSize, "sources": sources}}
+	if len(metrics) > 0 {
+		groupBy["aggregations"] = metrics
+	}
+	return types.JSON{"groupby": groupBy}, true, nil
+}
+
+var metricAggregations = map[string]string{
+	"SUM": "sum", "AVG": "avg", "MIN": "min", "MAX": "max",
+}
+
+// metricToDSL returns nil for COUNT(*), which is a doc_count in Query DSL
+func metricToDSL(call FunctionCall) (types.JSON, error) {
+	if call.Name == "COUNT" && (len(call.Args) == 0 || call.Args[0] == Star{}) {
+		return nil, nil
+	}
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+	}
+	field, ok := call.Args[0].(Field)
+	if !ok {
+		return nil, fmt.Errorf("can't translate %s of [%T] to Query DSL", call.Name, call.Args[0])
+	}
+	if call.Name == "COUNT" {
+		if call.Distinct {
+			return types.JSON{"cardinality": map[string]any{"field": field.Name}}, nil
+		}
+		return types.JSON{"value_count": map[string]any{"field": field.Name}}, nil
+	}
+	if name, ok := metricAggregations[call.Name]; ok {
+		return types.JSON{name: map[string]any{"field": field.Name}}, nil
+	}
+	return types.JSON{"extended_stats": map[string]any{"field": field.Name}}, nil
+}
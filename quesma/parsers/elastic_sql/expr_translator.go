@@ -0,0 +1,418 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strings"
+)
+
+// Elasticsearch SQL data types, as returned in `columns` of the response
+const (
+	typeKeyword  = "keyword"
+	typeText     = "text"
+	typeInteger  = "integer"
+	typeLong     = "long"
+	typeDouble   = "double"
+	typeBoolean  = "boolean"
+	typeDatetime = "datetime"
+	typeIp       = "ip"
+	typeGeoPoint = "geo_point"
+	typeObject   = "object"
+	typeNull     = "null"
+)
+
+func sqlType(t schema.QuesmaType) string {
+	switch t.Name {
+	case schema.QuesmaTypeText.Name:
+		return typeText
+	case schema.QuesmaTypeKeyword.Name:
+		return typeKeyword
+	case schema.QuesmaTypeInteger.Name:
+		return typeInteger
+	case schema.QuesmaTypeLong.Name, schema.QuesmaTypeUnsignedLong.Name:
+		return typeLong
+	case schema.QuesmaTypeFloat.Name:
+		return typeDouble
+	case schema.QuesmaTypeBoolean.Name:
+		return typeBoolean
+	case schema.QuesmaTypeTimestamp.Name, schema.QuesmaTypeDate.Name:
+		return typeDatetime
+	case schema.QuesmaTypeIp.Name:
+		return typeIp
+	case schema.QuesmaTypePoint.Name:
+		return typeGeoPoint
+	case schema.QuesmaTypeObject.Name, schema.QuesmaTypeMap.Name:
+		return typeObject
+	default:
+		return "" // unknown, will be inferred from values
+	}
+}
+
+func isNumericType(t string) bool {
+	return t == typeInteger || t == typeLong || t == typeDouble
+}
+
+// exprTranslator translates SQL expressions into ClickHouse expressions.
+// Field references are kept as public field names, they are resolved later by the schema transformation pipeline.
+type exprTranslator struct {
+	schema         schema.Schema
+	dslTranslator  *elastic_query_dsl.ClickhouseQueryTranslator
+	aggregateFound bool // set when an aggregate function is translated
+}
+
+type typedExpr struct {
+	expr    model.Expr
+	sqlType string
+}
+
+var aggregateFunctions = map[string]string{
+	"COUNT":       "count",
+	"SUM":         "sum",
+	"AVG":         "avg",
+	"MIN":         "min",
+	"MAX":         "max",
+	"STDDEV_POP":  "stddevPop",
+	"STDDEV_SAMP": "stddevSamp",
+	"VAR_POP":     "varPop",
+	"VAR_SAMP":    "varSamp",
+	"KURTOSIS":    "kurtPop",
+	"SKEWNESS":    "skewPop",
+}
+
+type scalarFunction struct {
+	clickhouseName   string
+	minArgs, maxArgs int
+	sqlType          string // empty <=> same as the first argument
+}
+
+var scalarFunctions = map[string]scalarFunction{
+	"ABS":               {"abs", 1, 1, ""},
+	"CEIL":              {"ceil", 1, 1, ""},
+	"CEILING":           {"ceil", 1, 1, ""},
+	"FLOOR":             {"floor", 1, 1, ""},
+	"ROUND":             {"round", 1, 2, ""},
+	"TRUNCATE":          {"trunc", 1, 2, ""},
+	"SQRT":              {"sqrt", 1, 1, typeDouble},
+	"POWER":             {"pow", 2, 2, typeDouble},
+	"LOG":               {"log", 1, 1, typeDouble},
+	"LOG10":             {"log10", 1, 1, typeDouble},
+	"EXP":               {"exp", 1, 1, typeDouble},
+	"LENGTH":            {"lengthUTF8", 1, 1, typeInteger},
+	"CHAR_LENGTH":       {"lengthUTF8", 1, 1, typeInteger},
+	"LCASE":             {"lower", 1, 1, typeKeyword},
+	"LOWER":             {"lower", 1, 1, typeKeyword},
+	"UCASE":             {"upper", 1, 1, typeKeyword},
+	"UPPER":             {"upper", 1, 1, typeKeyword},
+	"LTRIM":             {"trimLeft", 1, 1, typeKeyword},
+	"RTRIM":             {"trimRight", 1, 1, typeKeyword},
+	"TRIM":              {"trimBoth", 1, 1, typeKeyword},
+	"CONCAT":            {"concat", 2, 2, typeKeyword},
+	"SUBSTRING":         {"substringUTF8", 3, 3, typeKeyword},
+	"LEFT":              {"leftUTF8", 2, 2, typeKeyword},
+	"RIGHT":             {"rightUTF8", 2, 2, typeKeyword},
+	"REPLACE":           {"replaceAll", 3, 3, typeKeyword},
+	"COALESCE":          {"coalesce", 1, -1, ""},
+	"IFNULL":            {"ifNull", 2, 2, ""},
+	"ISNULL":            {"ifNull", 2, 2, ""},
+	"NULLIF":            {"nullIf", 2, 2, ""},
+	"GREATEST":          {"greatest", 1, -1, ""},
+	"LEAST":             {"least", 1, -1, ""},
+	"YEAR":              {"toYear", 1, 1, typeInteger},
+	"MONTH":             {"toMonth", 1, 1, typeInteger},
+	"MONTH_OF_YEAR":     {"toMonth", 1, 1, typeInteger},
+	"DAY":               {"toDayOfMonth", 1, 1, typeInteger},
+	"DAY_OF_MONTH":      {"toDayOfMonth", 1, 1, typeInteger},
+	"DAY_OF_WEEK":       {"toDayOfWeek", 1, 1, typeInteger},
+	"DAY_OF_YEAR":       {"toDayOfYear", 1, 1, typeInteger},
+	"HOUR":              {"toHour", 1, 1, typeInteger},
+	"HOUR_OF_DAY":       {"toHour", 1, 1, typeInteger},
+	"MINUTE":            {"toMinute", 1, 1, typeInteger},
+	"MINUTE_OF_HOUR":    {"toMinute", 1, 1, typeInteger},
+	"SECOND":            {"toSecond", 1, 1, typeInteger},
+	"SECOND_OF_MINUTE":  {"toSecond", 1, 1, typeInteger},
+	"DATE_TRUNC":        {"date_trunc", 2, 2, typeDatetime},
+	"NOW":               {"now64", 0, 0, typeDatetime},
+	"CURRENT_TIMESTAMP": {"now64", 0, 0, typeDatetime},
+}
+
+var castTypes = map[string]struct {
+	clickhouseName string
+	sqlType        string
+}{
+	"INT":       {"toInt32OrNull", typeInteger},
+	"INTEGER":   {"toInt32OrNull", typeInteger},
+	"LONG":      {"toInt64OrNull", typeLong},
+	"BIGINT":    {"toInt64OrNull", typeLong},
+	"DOUBLE":    {"toFloat64OrNull", typeDouble},
+	"FLOAT":     {"toFloat64OrNull", typeDouble},
+	"REAL":      {"toFloat64OrNull", typeDouble},
+	"KEYWORD":   {"toString", typeKeyword},
+	"VARCHAR":   {"toString", typeKeyword},
+	"TEXT":      {"toString", typeKeyword},
+	"STRING":    {"toString", typeKeyword},
+	"BOOLEAN":   {"toBool", typeBoolean},
+	"DATETIME":  {"parseDateTime64BestEffortOrNull", typeDatetime},
+	"TIMESTAMP": {"parseDateTime64BestEffortOrNull", typeDatetime},
+}
+
+func (t *exprTranslator) field(name string) (typedExpr, error) {
+	field, ok := t.schema.ResolveField(name)
+	if !ok {
+		return typedExpr{}, fmt.Errorf("unknown column [%s]", name)
+	}
+	return typedExpr{expr: model.NewColumnRef(name), sqlType: sqlType(field.Type)}, nil
+}
+
+func literal(value any) typedExpr {
+	switch v := value.(type) {
+	case nil:
+		return typedExpr{model.NullExpr, typeNull}
+	case string:
+		return typedExpr{model.NewLiteral(util.SingleQuote(v)), typeKeyword}
+	case bool:
+		return typedExpr{model.NewLiteral(v), typeBoolean}
+	case int64, int:
+		return typedExpr{model.NewLiteral(v), typeLong}
+	case float64:
+		return typedExpr{model.NewLiteral(v), typeDouble}
+	default:
+		return typedExpr{model.NewLiteral(util.SingleQuote(fmt.Sprintf("%v", v))), typeKeyword}
+	}
+}
+
+func (t *exprTranslator) translateAll(nodes []Node) ([]model.Expr, []string, error) {
+	exprs := make([]model.Expr, 0, len(nodes))
+	types := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		translated, err := t.translate(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		exprs = append(exprs, translated.expr)
+		types = append(types, translated.sqlType)
+	}
+	return exprs, types, nil
+}
+
+func (t *exprTranslator) translate(node Node) (typedExpr, error) {
+	switch n := node.(type) {
+	case Field:
+		return t.field(n.Name)
+	case Literal:
+		return literal(n.Value), nil
+	case Star:
+		return typedExpr{}, fmt.Errorf("* is allowed only in SELECT list and COUNT(*)")
+	case Unary:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if n.Op == "NOT" {
+			return typedExpr{model.NewPrefixExpr("NOT", []model.Expr{expr.expr}), typeBoolean}, nil
+		}
+		return typedExpr{model.NewPrefixExpr("-", []model.Expr{expr.expr}), expr.sqlType}, nil
+	case Binary:
+		return t.binary(n)
+	case In:
+		left, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		values, _, err := t.translateAll(n.Values)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		op := "IN"
+		if n.Negated {
+			op = "NOT IN"
+		}
+		return typedExpr{model.NewInfixExpr(left.expr, op, model.NewTupleExpr(values...)), typeBoolean}, nil
+	case Between:
+		exprs, _, err := t.translateAll([]Node{n.Expr, n.From, n.To})
+		if err != nil {
+			return typedExpr{}, err
+		}
+		result := model.And([]model.Expr{
+			model.NewInfixExpr(exprs[0], ">=", exprs[1]),
+			model.NewInfixExpr(exprs[0], "<=", exprs[2]),
+		})
+		if n.Negated {
+			result = model.NewPrefixExpr("NOT", []model.Expr{result})
+		}
+		return typedExpr{result, typeBoolean}, nil
+	case Like:
+		left, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		var result model.Expr
+		if n.Regex {
+			result = model.NewFunction("match", left.expr, model.NewLiteral(util.SingleQuote("^(?:"+n.Pattern+")$")))
+		} else {
+			// Elasticsearch SQL has no escape character in LIKE, while in ClickHouse it's \
+			pattern := strings.ReplaceAll(n.Pattern, `\`, `\\`)
+			result = model.NewInfixExpr(left.expr, "LIKE", model.NewLiteral(util.SingleQuote(pattern)))
+		}
+		if n.Negated {
+			result = model.NewPrefixExpr("NOT", []model.Expr{result})
+		}
+		return typedExpr{result, typeBoolean}, nil
+	case IsNull:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		null := "NULL"
+		if n.Negated {
+			null = "NOT NULL"
+		}
+		return typedExpr{model.NewInfixExpr(expr.expr, "IS", model.NewLiteral(null)), typeBoolean}, nil
+	case Cast:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		target, ok := castTypes[n.Type]
+		if !ok {
+			return typedExpr{}, fmt.Errorf("unsupported CAST type [%s]", n.Type)
+		}
+		if target.clickhouseName == "toString" || n.Type == "BOOLEAN" {
+			return typedExpr{model.NewFunction(target.clickhouseName, expr.expr), target.sqlType}, nil
+		}
+		// *OrNull functions accept only strings
+		return typedExpr{model.NewFunction(target.clickhouseName, model.NewFunction("toString", expr.expr)), target.sqlType}, nil
+	case FunctionCall:
+		return t.function(n)
+	default:
+		return typedExpr{}, fmt.Errorf("unsupported expression %T", node)
+	}
+}
+
+func (t *exprTranslator) binary(n Binary) (typedExpr, error) {
+	left, err := t.translate(n.Left)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	right, err := t.translate(n.Right)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	switch n.Op {
+	case "AND":
+		return typedExpr{model.And([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	case "OR":
+		return typedExpr{model.Or([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return typedExpr{model.NewInfixExpr(left.expr, n.Op, right.expr), typeBoolean}, nil
+	case "/":
+		return typedExpr{model.NewParenExpr(model.NewInfixExpr(left.expr, n.Op, right.expr)), typeDouble}, nil
+	default:
+		resultType := typeLong
+		if left.sqlType == typeDouble || right.sqlType == typeDouble {
+			resultType = typeDouble
+		}
+		return typedExpr{model.NewParenExpr(model.NewInfixExpr(left.expr, n.Op, right.expr)), resultType}, nil
+	}
+}
+
+func (t *exprTranslator) function(call FunctionCall) (typedExpr, error) {
+	if name, ok := aggregateFunctions[call.Name]; ok {
+		return t.aggregate(call, name)
+	}
+
+	switch call.Name {
+	case "MATCH", "QUERY":
+		return t.fullTextFunction(call)
+	case "HISTOGRAM":
+		if len(call.Args) != 2 {
+			return typedExpr{}, fmt.Errorf("HISTOGRAM requires 2 arguments, got %d", len(call.Args))
+		}
+		args, types, err := t.translateAll(call.Args)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if !isNumericType(types[0]) {
+			return typedExpr{}, fmt.Errorf("HISTOGRAM is supported only for numeric fields")
+		}
+		bucket := model.NewInfixExpr(model.NewFunction("floor", model.NewInfixExpr(args[0], "/", args[1])), "*", args[1])
+		return typedExpr{bucket, types[0]}, nil
+	}
+
+	function, ok := scalarFunctions[call.Name]
+	if !ok {
+		return typedExpr{}, fmt.Errorf("unknown function [%s]", call.Name)
+	}
+	if len(call.Args) < function.minArgs || (function.maxArgs >= 0 && len(call.Args) > function.maxArgs) {
+		return typedExpr{}, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+	}
+	args, types, err := t.translateAll(call.Args)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	resultType := function.sqlType
+	if resultType == "" && len(types) > 0 {
+		resultType = types[0]
+	}
+	return typedExpr{model.NewFunction(function.clickhouseName, args...), resultType}, nil
+}
+
+func (t *exprTranslator) aggregate(call FunctionCall, clickhouseName string) (typedExpr, error) {
+	t.aggregateFound = true
+	if call.Name == "COUNT" && (len(call.Args) == 0 || call.Args[0] == Star{}) {
+		return typedExpr{model.NewCountFunc(), typeLong}, nil
+	}
+	if len(call.Args) != 1 {
+		return typedExpr{}, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+	}
+	arg, err := t.translate(call.Args[0])
+	if err != nil {
+		return typedExpr{}, err
+	}
+	switch call.Name {
+	case "COUNT":
+		if call.Distinct {
+			return typedExpr{model.NewFunction("uniqExact", arg.expr), typeLong}, nil
+		}
+		return typedExpr{model.NewCountFunc(arg.expr), typeLong}, nil
+	case "MIN", "MAX":
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), arg.sqlType}, nil
+	case "SUM":
+		resultType := typeDouble
+		if arg.sqlType == typeLong || arg.sqlType == typeInteger {
+			resultType = typeLong
+		}
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), resultType}, nil
+	default:
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), typeDouble}, nil
+	}
+}
+
+// fullTextFunction translates MATCH(field, 'text') and QUERY('query string') using Query DSL parser,
+// so that they behave exactly like `match` and `query_string` in `_search`.
+func (t *exprTranslator) fullTextFunction(call FunctionCall) (typedExpr, error) {
+	dsl, err := fullTextFunctionToDSL(call)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	parsed := t.dslTranslator.ParseQueryMap(dsl)
+	if !parsed.CanParse || parsed.WhereClause == nil {
+		return typedExpr{}, fmt.Errorf("can't translate %s function", call.Name)
+	}
+	return typedExpr{parsed.WhereClause, typeBoolean}, nil
+}
+
+func stringArg(call FunctionCall, i int) (string, error) {
+	if i < len(call.Args) {
+		if lit, ok := call.Args[i].(Literal); ok {
+			if s, ok := lit.Value.(string); ok {
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("argument %d of %s must be a string literal", i+1, call.Name)
+}
@@ -0,0 +1,659 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/sql/lexer/core"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/sql/lexer/dialect_sqlparse"
+	"strconv"
+	"strings"
+)
+
+// reservedWords can't be used as unquoted field names
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP BY": true, "ORDER BY": true, "HAVING": true, "LIMIT": true,
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true, "NOT NULL": true, "TRUE": true, "FALSE": true,
+	"BETWEEN": true, "LIKE": true, "NOT LIKE": true, "RLIKE": true, "NOT RLIKE": true, "AS": true, "DISTINCT": true,
+	"ALL": true, "ASC": true, "DESC": true,
+}
+
+type parser struct {
+	input  string
+	tokens []core.Token
+	pos    int
+	params []any
+	param  int // index of the next `?` parameter
+}
+
+// Parse parses Elasticsearch SQL query. `?` placeholders are replaced with params, in order.
+func Parse(query string, params []any) (*Statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: query, tokens: tokens, params: params}
+	statement, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if p.param < len(params) {
+		return nil, fmt.Errorf("too many parameters, expected %d, got %d", p.param, len(params))
+	}
+	return statement, nil
+}
+
+func tokenize(query string) ([]core.Token, error) {
+	var tokens []core.Token
+	for _, token := range core.Lex(query, dialect_sqlparse.SqlparseRules) {
+		switch token.Type {
+		case &dialect_sqlparse.WhitespaceTokenType, &dialect_sqlparse.NewlineTokenType,
+			&dialect_sqlparse.SingleCommentTokenType, &dialect_sqlparse.MultilineCommentTokenType:
+			continue
+		case &dialect_sqlparse.ErrorTokenType, core.ErrorTokenType:
+			return nil, fmt.Errorf("line 1:%d: token recognition error at: '%s'", token.Position+1, token.RawValue)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func (p *parser) peek() (core.Token, bool) {
+	if p.pos >= len(p.tokens) {
+		return core.EmptyToken, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (core.Token, bool) {
+	token, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return token, ok
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	position := len(p.input)
+	if token, ok := p.peek(); ok {
+		position = token.Position
+	}
+	return fmt.Errorf("line 1:%d: %s", position+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) unexpected(expected string) error {
+	token, ok := p.peek()
+	if !ok {
+		return p.errorf("expected %s, got end of query", expected)
+	}
+	return p.errorf("expected %s, got '%s'", expected, token.RawValue)
+}
+
+// word returns the upper-cased text of the token, with whitespaces normalized (e.g. `GROUP   BY` -> `GROUP BY`)
+func word(token core.Token) string {
+	switch token.Type {
+	case &dialect_sqlparse.SingleStringTokenType, &dialect_sqlparse.SymbolStringTokenType:
+		return ""
+	}
+	return strings.Join(strings.Fields(strings.ToUpper(token.RawValue)), " ")
+}
+
+// isIdentifier is true for tokens which can be (unquoted) field or function names
+func isIdentifier(token core.Token) bool {
+	switch token.Type {
+	case &dialect_sqlparse.NameTokenType, &dialect_sqlparse.BuiltinNameTokenType, &dialect_sqlparse.KeywordTokenType,
+		&dialect_sqlparse.DMLKeywordTokenType, &dialect_sqlparse.DDLKeywordTokenType, &dialect_sqlparse.DCLKeywordTokenType,
+		&dialect_sqlparse.CTEKeywordTokenType:
+		return !reservedWords[word(token)]
+	}
+	return false
+}
+
+func (p *parser) isWord(words ...string) bool {
+	token, ok := p.peek()
+	if !ok {
+		return false
+	}
+	w := word(token)
+	for _, expected := range words {
+		if w == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) acceptWord(words ...string) bool {
+	if p.isWord(words...) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectWord(expected string) error {
+	if !p.acceptWord(expected) {
+		return p.unexpected(expected)
+	}
+	return nil
+}
+
+func (p *parser) isPunct(punct string) bool {
+	token, ok := p.peek()
+	return ok && token.RawValue == punct &&
+		(token.Type == &dialect_sqlparse.PunctuationTokenType || token.Type == &dialect_sqlparse.WildcardTokenType ||
+			token.Type == &dialect_sqlparse.OperatorTokenType || token.Type == &dialect_sqlparse.ComparisonOperatorTokenType)
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	if p.isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.acceptPunct(punct) {
+		return p.unexpected(fmt.Sprintf("'%s'", punct))
+	}
+	return nil
+}
+
+func (p *parser) parseStatement() (*Statement, error) {
+	if err := p.expectWord("SELECT"); err != nil {
+		return nil, err
+	}
+	statement := &Statement{Limit: noLimit}
+	if p.acceptWord("DISTINCT") {
+		statement.Distinct = true
+	} else {
+		p.acceptWord("ALL")
+	}
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		statement.Columns = append(statement.Columns, item)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if err := p.expectWord("FROM"); err != nil {
+		return nil, err
+	}
+	index, err := p.parseIndexName()
+	if err != nil {
+		return nil, err
+	}
+	statement.Index = index
+
+	if p.acceptWord("WHERE") {
+		if statement.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptWord("GROUP BY") {
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			statement.GroupBy = append(statement.GroupBy, expr)
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+	if p.isWord("HAVING") {
+		return nil, p.errorf("HAVING is not supported")
+	}
+	if p.acceptWord("ORDER BY") {
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: expr}
+			if token, ok := p.peek(); ok && token.Type == &dialect_sqlparse.OrderKeywordTokenType {
+				p.pos++
+				item.Desc = strings.HasPrefix(word(token), "DESC")
+			}
+			statement.OrderBy = append(statement.OrderBy, item)
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+	if p.acceptWord("LIMIT") {
+		token, ok := p.next()
+		limit, err := strconv.Atoi(token.RawValue)
+		if !ok || err != nil || limit < 0 {
+			p.pos--
+			return nil, p.unexpected("non-negative number after LIMIT")
+		}
+		statement.Limit = limit
+	}
+	p.acceptPunct(";")
+	if _, ok := p.peek(); ok {
+		return nil, p.unexpected("end of query")
+	}
+	return statement, nil
+}
+
+func (p *parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptPunct("*") {
+		return SelectItem{Expr: Star{}, Name: "*"}, nil
+	}
+	start, _ := p.peek()
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	last := p.tokens[p.pos-1]
+	name := p.input[start.Position : last.Position+len(last.RawValue)]
+	if field, ok := expr.(Field); ok {
+		name = field.Name
+	}
+
+	if p.acceptWord("AS") {
+		token, ok := p.next()
+		if !ok {
+			return SelectItem{}, p.unexpected("alias")
+		}
+		name = unquoteIdentifier(token)
+	} else if token, ok := p.peek(); ok && (isIdentifier(token) || token.Type == &dialect_sqlparse.SymbolStringTokenType) {
+		p.pos++
+		name = unquoteIdentifier(token)
+	}
+	return SelectItem{Expr: expr, Name: name}, nil
+}
+
+// parseIndexName parses FROM target. It can be quoted ("logs-*") or not (logs-generic-default),
+// in the latter case it's a sequence of adjacent tokens.
+func (p *parser) parseIndexName() (string, error) {
+	token, ok := p.next()
+	if !ok {
+		return "", p.unexpected("index name")
+	}
+	if token.Type == &dialect_sqlparse.SymbolStringTokenType || strings.HasPrefix(token.RawValue, "`") {
+		return unquoteIdentifier(token), nil
+	}
+	if !isIdentifier(token) && token.Type != &dialect_sqlparse.WildcardTokenType {
+		p.pos--
+		return "", p.unexpected("index name")
+	}
+	name := token.RawValue
+	end := token.Position + len(token.RawValue)
+	for {
+		next, ok := p.peek()
+		if !ok || next.Position != end || next.RawValue == ";" || next.RawValue == "," {
+			break
+		}
+		name += next.RawValue
+		end += len(next.RawValue)
+		p.pos++
+	}
+	return name, nil
+}
+
+func unquoteIdentifier(token core.Token) string {
+	raw := token.RawValue
+	if len(raw) >= 2 {
+		switch raw[0] {
+		case '"':
+			return strings.ReplaceAll(raw[1:len(raw)-1], `""`, `"`)
+		case '`':
+			return strings.ReplaceAll(raw[1:len(raw)-1], "``", "`")
+		}
+	}
+	return raw
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.acceptWord("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+var comparisonOperators = map[string]string{"=": "=", "==": "=", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (p *parser) parsePredicate() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := p.peek()
+	if !ok {
+		return left, nil
+	}
+	if op, isComparison := comparisonOperators[token.RawValue]; isComparison && token.Type == &dialect_sqlparse.ComparisonOperatorTokenType {
+		p.pos++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return Binary{Op: op, Left: left, Right: right}, nil
+	}
+
+	switch w := word(token); w {
+	case "IS":
+		p.pos++
+		if p.acceptWord("NOT NULL") {
+			return IsNull{Expr: left, Negated: true}, nil
+		}
+		negated := p.acceptWord("NOT")
+		if err := p.expectWord("NULL"); err != nil {
+			return nil, err
+		}
+		return IsNull{Expr: left, Negated: negated}, nil
+	case "LIKE", "NOT LIKE", "RLIKE", "NOT RLIKE":
+		p.pos++
+		pattern, ok := p.next()
+		if !ok || pattern.Type != &dialect_sqlparse.SingleStringTokenType {
+			p.pos--
+			return nil, p.unexpected("string pattern")
+		}
+		return Like{Expr: left, Pattern: unquoteString(pattern.RawValue), Regex: strings.HasSuffix(w, "RLIKE"), Negated: strings.HasPrefix(w, "NOT")}, nil
+	case "NOT", "IN", "BETWEEN":
+		negated := p.acceptWord("NOT")
+		if p.acceptWord("IN") {
+			values, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			return In{Expr: left, Values: values, Negated: negated}, nil
+		}
+		if p.acceptWord("BETWEEN") {
+			from, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectWord("AND"); err != nil {
+				return nil, err
+			}
+			to, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return Between{Expr: left, From: from, To: to, Negated: negated}, nil
+		}
+		return nil, p.unexpected("IN or BETWEEN")
+	}
+	return left, nil
+}
+
+func (p *parser) parseExprList() ([]Node, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var values []Node
+	for {
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	return values, p.expectPunct(")")
+}
+
+// splitNegativeNumber handles `a-1`, which the lexer tokenizes as `a` and `-1`
+func (p *parser) splitNegativeNumber() bool {
+	token, ok := p.peek()
+	if !ok || !strings.HasPrefix(token.RawValue, "-") ||
+		(token.Type != &dialect_sqlparse.IntegerNumberTokenType && token.Type != &dialect_sqlparse.FloatNumberTokenType) {
+		return false
+	}
+	minus := core.MakeToken(token.Position, "-", &dialect_sqlparse.OperatorTokenType)
+	number := core.MakeToken(token.Position+1, token.RawValue[1:], token.Type)
+	p.tokens = append(p.tokens[:p.pos], append([]core.Token{minus, number}, p.tokens[p.pos+1:]...)...)
+	return true
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.splitNegativeNumber()
+		var op string
+		switch {
+		case p.acceptPunct("+"):
+			op = "+"
+		case p.acceptPunct("-"):
+			op = "-"
+		default:
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptPunct("*"):
+			op = "*"
+		case p.acceptPunct("/"):
+			op = "/"
+		case p.acceptPunct("%"):
+			op = "%"
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.acceptPunct("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: "-", Expr: expr}, nil
+	}
+	p.acceptPunct("+")
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, p.unexpected("expression")
+	}
+
+	switch token.Type {
+	case &dialect_sqlparse.IntegerNumberTokenType:
+		p.pos++
+		value, err := strconv.ParseInt(token.RawValue, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number '%s'", token.RawValue)
+		}
+		return Literal{Value: value}, nil
+	case &dialect_sqlparse.FloatNumberTokenType:
+		p.pos++
+		value, err := strconv.ParseFloat(token.RawValue, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number '%s'", token.RawValue)
+		}
+		return Literal{Value: value}, nil
+	case &dialect_sqlparse.SingleStringTokenType:
+		p.pos++
+		return Literal{Value: unquoteString(token.RawValue)}, nil
+	case &dialect_sqlparse.SymbolStringTokenType:
+		p.pos++
+		return Field{Name: unquoteIdentifier(token)}, nil
+	case &dialect_sqlparse.PlaceholderNameTokenType:
+		p.pos++
+		if token.RawValue != "?" {
+			return nil, p.errorf("named parameters are not supported")
+		}
+		if p.param >= len(p.params) {
+			return nil, p.errorf("not enough parameters")
+		}
+		p.param++
+		return Literal{Value: normalizeParam(p.params[p.param-1])}, nil
+	}
+
+	if p.acceptPunct("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectPunct(")")
+	}
+
+	switch word(token) {
+	case "NULL":
+		p.pos++
+		return Literal{Value: nil}, nil
+	case "TRUE", "FALSE":
+		p.pos++
+		return Literal{Value: word(token) == "TRUE"}, nil
+	}
+	if !isIdentifier(token) {
+		return nil, p.unexpected("expression")
+	}
+
+	p.pos++
+	if p.isPunct("(") {
+		return p.parseFunctionCall(word(token))
+	}
+	return p.parseField(token)
+}
+
+func (p *parser) parseFunctionCall(name string) (Node, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	if name == "CAST" || name == "CONVERT" {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptWord("AS") && !p.acceptPunct(",") {
+			return nil, p.unexpected("AS")
+		}
+		typeToken, ok := p.next()
+		if !ok || word(typeToken) == "" {
+			p.pos--
+			return nil, p.unexpected("type name")
+		}
+		return Cast{Expr: expr, Type: word(typeToken)}, p.expectPunct(")")
+	}
+
+	call := FunctionCall{Name: name}
+	if p.acceptPunct(")") {
+		return call, nil
+	}
+	if p.acceptPunct("*") {
+		call.Args = []Node{Star{}}
+		return call, p.expectPunct(")")
+	}
+	call.Distinct = p.acceptWord("DISTINCT")
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	return call, p.expectPunct(")")
+}
+
+// parseField parses (possibly dotted) field name, starting with already consumed token
+func (p *parser) parseField(first core.Token) (Node, error) {
+	name := unquoteIdentifier(first)
+	for p.acceptPunct(".") {
+		token, ok := p.next()
+		if !ok || (!isIdentifier(token) && token.Type != &dialect_sqlparse.SymbolStringTokenType) {
+			p.pos--
+			return nil, p.unexpected("field name")
+		}
+		name += "." + unquoteIdentifier(token)
+	}
+	return Field{Name: name}, nil
+}
+
+func unquoteString(raw string) string {
+	inner := raw[1 : len(raw)-1]
+	inner = strings.ReplaceAll(inner, "''", "'")
+	return strings.ReplaceAll(inner, `\'`, "'")
+}
+
+// normalizeParam converts `params` JSON values into literal values
+func normalizeParam(param any) any {
+	if typed, ok := param.(map[string]any); ok {
+		// {"type": "integer", "value": 5} form
+		param = typed["value"]
+	}
+	if f, ok := param.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return param
+}
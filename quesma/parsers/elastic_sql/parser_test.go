@@ -0,0 +1,58 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseSelect(t *testing.T) {
+	statement, err := Parse(`SELECT host.name AS host, COUNT(*) FROM "logs-*" WHERE status >= 500 AND message LIKE 'err%' GROUP BY host ORDER BY 2 DESC LIMIT 5`, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "logs-*", statement.Index)
+	require.Len(t, statement.Columns, 2)
+	assert.Equal(t, SelectItem{Expr: Field{Name: "host.name"}, Name: "host"}, statement.Columns[0])
+	assert.Equal(t, "COUNT(*)", statement.Columns[1].Name)
+	assert.Equal(t, Binary{
+		Op:    "AND",
+		Left:  Binary{Op: ">=", Left: Field{Name: "status"}, Right: Literal{Value: int64(500)}},
+		Right: Like{Expr: Field{Name: "message"}, Pattern: "err%"},
+	}, statement.Where)
+	assert.Equal(t, []Node{Field{Name: "host"}}, statement.GroupBy)
+	require.Len(t, statement.OrderBy, 1)
+	assert.True(t, statement.OrderBy[0].Desc)
+	assert.Equal(t, 5, statement.Limit)
+}
+
+func TestParseParams(t *testing.T) {
+	statement, err := Parse(`SELECT * FROM logs WHERE status = ? AND host IN (?, 'b')`, []any{float64(200), map[string]any{"type": "keyword", "value": "a"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, noLimit, statement.Limit)
+	assert.Equal(t, Binary{
+		Op:    "AND",
+		Left:  Binary{Op: "=", Left: Field{Name: "status"}, Right: Literal{Value: int64(200)}},
+		Right: In{Expr: Field{Name: "host"}, Values: []Node{Literal{Value: "a"}, Literal{Value: "b"}}},
+	}, statement.Where)
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		query         string
+		expectedError string
+	}{
+		{`SELECT a FROM logs GROUP BY a HAVING COUNT(*) > 1`, "HAVING is not supported"},
+		{`SELECT a FROM logs WHERE a = ?`, "not enough parameters"},
+		{`SELECT a`, "FROM"},
+		{`SELECT a FROM logs LIMIT x`, "LIMIT"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := Parse(tc.query, nil)
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
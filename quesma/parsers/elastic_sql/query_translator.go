@@ -0,0 +1,311 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"slices"
+	"strings"
+)
+
+const defaultFetchSize = 1000
+
+// Request is a parsed body of `_sql` (or `_sql/translate`) request.
+// If it's a request for the next page, fields are restored from the cursor.
+type Request struct {
+	Query     string
+	Params    []any
+	FetchSize int
+	Filter    types.JSON // optional Query DSL filter
+
+	offset     int  // number of rows already returned in previous pages
+	isNextPage bool // true <=> request was made with a cursor
+}
+
+func ParseRequest(body types.JSON) (*Request, error) {
+	if rawCursor, ok := body["cursor"].(string); ok && rawCursor != "" {
+		request, err := decodeCursor(rawCursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+		}
+		return request, nil
+	}
+
+	request := &Request{FetchSize: defaultFetchSize}
+	query, ok := body["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	request.Query = query
+
+	if fetchSize, ok := body["fetch_size"].(float64); ok {
+		if fetchSize <= 0 {
+			return nil, fmt.Errorf("%w: fetch_size must be positive", quesma_errors.ErrCouldNotParseRequest())
+		}
+		request.FetchSize = int(fetchSize)
+	}
+	if params, ok := body["params"].([]any); ok {
+		request.Params = params
+	}
+	if filter, ok := body["filter"].(map[string]any); ok {
+		request.Filter = filter
+	}
+	return request, nil
+}
+
+// ParseStatement parses the query of the request
+func (r *Request) ParseStatement() (*Statement, error) {
+	statement, err := Parse(r.Query, r.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return statement, nil
+}
+
+// ClickhouseSQLTranslator translates Elasticsearch SQL statements into ClickHouse queries.
+type ClickhouseSQLTranslator struct {
+	Ctx         context.Context
+	Schema      schema.Schema
+	Table       *clickhouse.Table
+	Indexes     []string
+	AliasFilter types.JSON // Query DSL filter of aliases the indexes were matched by, nil if there is none
+}
+
+func (t *ClickhouseSQLTranslator) exprTranslator() *exprTranslator {
+	return &exprTranslator{
+		schema:        t.Schema,
+		dslTranslator: &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: t.Ctx, Schema: t.Schema, Table: t.Table, Indexes: t.Indexes},
+	}
+}
+
+// selectedFieldNames expands `*` into all (non-object) fields of the schema, in alphabetical order, like Elasticsearch does
+func (t *ClickhouseSQLTranslator) selectedFieldNames() []string {
+	var names []string
+	for name, field := range t.Schema.Fields {
+		if field.Type.Name == schema.QuesmaTypeObject.Name {
+			continue
+		}
+		names = append(names, name.AsString())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (t *ClickhouseSQLTranslator) expandStar(statement *Statement) []SelectItem {
+	var items []SelectItem
+	for _, item := range statement.Columns {
+		if _, isStar := item.Expr.(Star); isStar {
+			for _, name := range t.selectedFieldNames() {
+				items = append(items, SelectItem{Expr: Field{Name: name}, Name: name})
+			}
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// resolveAlias replaces references to SELECT aliases (allowed in GROUP BY and ORDER BY) with aliased expressions
+func resolveAlias(node Node, items []SelectItem) Node {
+	if field, ok := node.(Field); ok {
+		for _, item := range items {
+			if aliased, isField := item.Expr.(Field); item.Name == field.Name && (!isField || aliased.Name != field.Name) {
+				return item.Expr
+			}
+		}
+	}
+	return node
+}
+
+// BuildQuery builds a query which fetches the page of results requested.
+func (t *ClickhouseSQLTranslator) BuildQuery(statement *Statement, request *Request) (*model.Query, error) {
+	query, err := t.buildQuery(statement, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return query, nil
+}
+
+func (t *ClickhouseSQLTranslator) buildQuery(statement *Statement, request *Request) (*model.Query, error) {
+	translator := t.exprTranslator()
+	items := t.expandStar(statement)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no columns to select in [%s]", statement.Index)
+	}
+
+	columns := make([]model.Expr, 0, len(items))
+	resultColumns := make([]Column, 0, len(items))
+	for _, item := range items {
+		translated, err := translator.translate(item.Expr)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, translated.expr)
+		resultColumns = append(resultColumns, Column{Name: item.Name, Type: translated.sqlType})
+	}
+
+	var conditions []model.Expr
+	if statement.Where != nil {
+		where, err := translator.translate(statement.Where)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, where.expr)
+	}
+	for _, filter := range []types.JSON{request.Filter, t.AliasFilter} {
+		if filter == nil {
+			continue
+		}
+		parsed := translator.dslTranslator.ParseQueryMap(filter)
+		if !parsed.CanParse {
+			return nil, fmt.Errorf("can't parse filter: %v", filter)
+		}
+		conditions = append(conditions, parsed.WhereClause)
+	}
+
+	groupBy := make([]model.Expr, 0, len(statement.GroupBy))
+	for _, node := range statement.GroupBy {
+		translated, err := translator.translate(resolveAlias(node, items))
+		if err != nil {
+			return nil, err
+		}
+		groupBy = append(groupBy, translated.expr)
+	}
+
+	orderBy := make([]model.OrderByExpr, 0, len(statement.OrderBy))
+	for _, item := range statement.OrderBy {
+		translated, err := translator.translate(resolveAlias(item.Expr, items))
+		if err != nil {
+			return nil, err
+		}
+		direction := model.AscOrder
+		if item.Desc {
+			direction = model.DescOrder
+		}
+		orderBy = append(orderBy, model.NewOrderByExpr(translated.expr, direction))
+	}
+
+	// One row more is fetched, to know if there is a next page.
+	limit := request.FetchSize + 1
+	if statement.Limit != noLimit && statement.Limit-request.offset < limit {
+		limit = statement.Limit - request.offset
+	}
+	if statement.Limit == noLimit || statement.Limit > request.FetchSize {
+		// Results may span several pages, so their order has to be the same in every query
+		orderBy = appendTieBreakers(orderBy, columns)
+	}
+	if statement.Limit == 0 || limit <= 0 {
+		// LIMIT 0 is a valid query, returning columns only
+		conditions = append(conditions, model.NewLiteral("false"))
+		limit = 1
+	}
+
+	selectCommand := model.NewSelectCommand(columns, groupBy, orderBy, model.NewTableRef(model.SingleTableNamePlaceHolder),
+		model.And(conditions), []model.Expr{}, limit, 0, statement.Distinct, nil)
+	selectCommand.Offset = request.offset
+
+	return &model.Query{
+		SelectCommand: *selectCommand,
+		TableName:     t.Table.Name,
+		Indexes:       t.Indexes,
+		Schema:        t.Schema,
+		Type:          &tabularResultType{columns: resultColumns, request: request},
+	}, nil
+}
+
+// appendTieBreakers orders rows by all selected columns after the requested order, so they're sorted the same way
+// in every page. Rows equal in all of them are indistinguishable, so their order doesn't matter.
+func appendTieBreakers(orderBy []model.OrderByExpr, columns []model.Expr) []model.OrderByExpr {
+	for _, column := range columns {
+		if !slices.ContainsFunc(orderBy, func(item model.OrderByExpr) bool { return model.AsString(item.Expr) == model.AsString(column) }) {
+			orderBy = append(orderBy, model.NewOrderByExpr(column, model.AscOrder))
+		}
+	}
+	return orderBy
+}
+
+// MakeResponse renders a page of results
+func (t *ClickhouseSQLTranslator) MakeResponse(query *model.Query, rows []model.QueryResultRow) (*Response, error) {
+	resultType, ok := query.Type.(*tabularResultType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected query type %T", query.Type)
+	}
+	return resultType.makeResponse(rows)
+}
+
+// Translate returns Query DSL equivalent of the request (`_sql/translate`)
+func (t *ClickhouseSQLTranslator) Translate(statement *Statement, request *Request) (types.JSON, error) {
+	var fieldNames []string
+	for _, item := range t.expandStar(statement) {
+		field, ok := item.Expr.(Field)
+		if !ok {
+			if call, isCall := item.Expr.(FunctionCall); isCall {
+				if _, isAggregate := aggregateFunctions[call.Name]; isAggregate {
+					continue
+				}
+			}
+			return nil, fmt.Errorf("%w: can't translate [%s] to Query DSL", quesma_errors.ErrCouldNotParseRequest(), item.Name)
+		}
+		if _, ok := t.Schema.ResolveField(field.Name); !ok {
+			return nil, fmt.Errorf("%w: unknown column [%s]", quesma_errors.ErrCouldNotParseRequest(), field.Name)
+		}
+		fieldNames = append(fieldNames, field.Name)
+	}
+	dsl, err := statement.ToQueryDSL(request.Filter, fieldNames, request.FetchSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return dsl, nil
+}
+
+// tabularResultType keeps what's needed to render the results of SQL query
+type tabularResultType struct {
+	columns []Column
+	request *Request
+}
+
+func (r *tabularResultType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (r *tabularResultType) String() string {
+	return "sql"
+}
+
+func (r *tabularResultType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	response, err := r.makeResponse(rows)
+	if err != nil {
+		return model.JsonMap{}
+	}
+	return model.JsonMap{"columns": response.Columns, "rows": response.Rows, "cursor": response.Cursor}
+}
+
+func (r *tabularResultType) makeResponse(rows []model.QueryResultRow) (*Response, error) {
+	pageEnd := min(r.request.FetchSize, len(rows))
+	values := make([][]any, 0, pageEnd)
+	for _, row := range rows[:pageEnd] {
+		values = append(values, rowValues(row, len(r.columns)))
+	}
+
+	response := &Response{Rows: values}
+	if !r.request.isNextPage {
+		response.Columns = inferColumnTypes(r.columns, values)
+	}
+	if len(rows) > pageEnd {
+		next := *r.request
+		next.offset = r.request.offset + pageEnd
+		cursor, err := encodeCursor(&next)
+		if err != nil {
+			return nil, err
+		}
+		response.Cursor = cursor
+	}
+	return response, nil
+}
@@ -0,0 +1,201 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testTranslator() *ClickhouseSQLTranslator {
+	fields := map[schema.FieldName]schema.Field{
+		"host.name": {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+		"status":    {PropertyName: "status", InternalPropertyName: "status", Type: schema.QuesmaTypeInteger},
+		"message":   {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	}
+	return &ClickhouseSQLTranslator{
+		Ctx:     context.Background(),
+		Schema:  schema.Schema{Fields: fields},
+		Table:   &clickhouse.Table{Name: "logs"},
+		Indexes: []string{"logs"},
+	}
+}
+
+func buildQuery(t *testing.T, body types.JSON) (*model.Query, *Request) {
+	request, err := ParseRequest(body)
+	require.NoError(t, err)
+	statement, err := request.ParseStatement()
+	require.NoError(t, err)
+	query, err := testTranslator().BuildQuery(statement, request)
+	require.NoError(t, err)
+	return query, request
+}
+
+func TestBuildQuery(t *testing.T) {
+	testcases := []struct {
+		query       string
+		expectedSQL string
+	}{
+		{
+			query:       `SELECT * FROM logs`,
+			expectedSQL: `SELECT "host.name", "message", "status" FROM __quesma_table_name ORDER BY "host.name" ASC, "message" ASC, "status" ASC LIMIT 1001`,
+		},
+		{
+			query:       `SELECT "host.name" h, COUNT(*) c FROM logs WHERE status BETWEEN 200 AND 299 GROUP BY h ORDER BY c DESC LIMIT 10`,
+			expectedSQL: `SELECT "host.name", count(*) FROM __quesma_table_name WHERE ("status">=200 AND "status"<=299) GROUP BY "host.name" ORDER BY count(*) DESC LIMIT 10`,
+		},
+		{
+			query:       `SELECT status FROM logs ORDER BY status DESC LIMIT 2000`,
+			expectedSQL: `SELECT "status" FROM __quesma_table_name ORDER BY "status" DESC LIMIT 1001`,
+		},
+		{
+			query:       `SELECT message FROM logs WHERE message RLIKE 'a.*' OR status IS NULL`,
+			expectedSQL: `SELECT "message" FROM __quesma_table_name WHERE (match("message",'^(?:a.*)$') OR "status" IS NULL) ORDER BY "message" ASC LIMIT 1001`,
+		},
+		{
+			query:       `SELECT message FROM logs WHERE message LIKE 'a\' AND status = 1`,
+			expectedSQL: `SELECT "message" FROM __quesma_table_name WHERE ("message" LIKE 'a\\\\' AND "status"=1) ORDER BY "message" ASC LIMIT 1001`,
+		},
+		{
+			query:       `SELECT message FROM logs WHERE message LIKE 'it''s%' OR message RLIKE '\d+'''`,
+			expectedSQL: `SELECT "message" FROM __quesma_table_name WHERE ("message" LIKE 'it\'s%' OR match("message",'^(?:\\d+\')$')) ORDER BY "message" ASC LIMIT 1001`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := buildQuery(t, types.JSON{"query": tc.query})
+			assert.Equal(t, tc.expectedSQL, query.SelectCommand.String())
+		})
+	}
+}
+
+func TestBuildQueryWithAliasFilter(t *testing.T) {
+	request, err := ParseRequest(types.JSON{"query": `SELECT status FROM logs WHERE status > 200 LIMIT 5`})
+	require.NoError(t, err)
+	statement, err := request.ParseStatement()
+	require.NoError(t, err)
+	translator := testTranslator()
+	translator.AliasFilter = types.JSON{"term": map[string]any{"host.name": "web-1"}}
+	query, err := translator.BuildQuery(statement, request)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "status" FROM __quesma_table_name WHERE ("status">200 AND "host_name"='web-1') LIMIT 5`, query.SelectCommand.String())
+}
+
+func TestUnknownColumn(t *testing.T) {
+	request, err := ParseRequest(types.JSON{"query": `SELECT foo FROM logs`})
+	require.NoError(t, err)
+	statement, err := request.ParseStatement()
+	require.NoError(t, err)
+	_, err = testTranslator().BuildQuery(statement, request)
+	assert.ErrorContains(t, err, "unknown column [foo]")
+}
+
+func resultRows(values ...[]any) []model.QueryResultRow {
+	rows := make([]model.QueryResultRow, 0, len(values))
+	for _, row := range values {
+		cols := make([]model.QueryResultCol, 0, len(row))
+		for _, value := range row {
+			cols = append(cols, model.QueryResultCol{Value: value})
+		}
+		rows = append(rows, model.QueryResultRow{Cols: cols})
+	}
+	return rows
+}
+
+func TestPagination(t *testing.T) {
+	query, _ := buildQuery(t, types.JSON{"query": `SELECT "host.name", status FROM logs`, "fetch_size": float64(2)})
+	assert.Equal(t, `SELECT "host.name", "status" FROM __quesma_table_name ORDER BY "host.name" ASC, "status" ASC LIMIT 3`, query.SelectCommand.String())
+
+	rows := resultRows([]any{"a", int64(1)}, []any{"b", int64(2)}, []any{"c", int64(3)})
+	response, err := testTranslator().MakeResponse(query, rows)
+	require.NoError(t, err)
+	assert.Equal(t, []Column{{Name: "host.name", Type: typeKeyword}, {Name: "status", Type: typeInteger}}, response.Columns)
+	assert.Equal(t, [][]any{{"a", int64(1)}, {"b", int64(2)}}, response.Rows)
+	require.NotEmpty(t, response.Cursor)
+	assert.True(t, IsQuesmaCursor(response.Cursor))
+
+	query, _ = buildQuery(t, types.JSON{"cursor": response.Cursor})
+	assert.Equal(t, `SELECT "host.name", "status" FROM __quesma_table_name ORDER BY "host.name" ASC, "status" ASC LIMIT 3 OFFSET 2`, query.SelectCommand.String())
+	response, err = testTranslator().MakeResponse(query, rows[2:])
+	require.NoError(t, err)
+	assert.Empty(t, response.Columns)
+	assert.Equal(t, [][]any{{"c", int64(3)}}, response.Rows)
+	assert.Empty(t, response.Cursor)
+}
+
+func TestPaginationWithLimit(t *testing.T) {
+	query, _ := buildQuery(t, types.JSON{"query": `SELECT status FROM logs LIMIT 3`, "fetch_size": float64(2)})
+	assert.Equal(t, `SELECT "status" FROM __quesma_table_name ORDER BY "status" ASC LIMIT 3`, query.SelectCommand.String())
+
+	response, err := testTranslator().MakeResponse(query, resultRows([]any{int64(1)}, []any{int64(2)}, []any{int64(3)}))
+	require.NoError(t, err)
+	require.NotEmpty(t, response.Cursor)
+
+	query, _ = buildQuery(t, types.JSON{"cursor": response.Cursor})
+	assert.Equal(t, `SELECT "status" FROM __quesma_table_name ORDER BY "status" ASC LIMIT 1 OFFSET 2`, query.SelectCommand.String())
+	response, err = testTranslator().MakeResponse(query, resultRows([]any{int64(3)}))
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(3)}}, response.Rows)
+	assert.Empty(t, response.Cursor)
+}
+
+func TestTranslate(t *testing.T) {
+	request, err := ParseRequest(types.JSON{"query": `SELECT status FROM logs WHERE "host.name" = 'a' AND status > 200 ORDER BY status DESC LIMIT 10`})
+	require.NoError(t, err)
+	statement, err := request.ParseStatement()
+	require.NoError(t, err)
+
+	dsl, err := testTranslator().Translate(statement, request)
+	require.NoError(t, err)
+	assert.Equal(t, types.JSON{
+		"_source": false,
+		"query": boolQuery("filter",
+			types.JSON{"term": map[string]any{"host.name": map[string]any{"value": "a"}}},
+			types.JSON{"range": map[string]any{"status": map[string]any{"gt": int64(200)}}},
+		),
+		"fields": []any{map[string]any{"field": "status"}},
+		"size":   10,
+		"sort":   []any{map[string]any{"status": map[string]any{"order": "desc", "missing": "_last"}}},
+	}, dsl)
+}
+
+func TestRender(t *testing.T) {
+	response := &Response{
+		Columns: []Column{{Name: "host", Type: typeKeyword}, {Name: "count", Type: typeLong}},
+		Rows:    [][]any{{"a,b", int64(1)}, {nil, int64(2)}},
+	}
+
+	csv, err := response.Render(FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "host,count\r\n\"a,b\",1\r\n,2\r\n", string(csv))
+
+	tsv, err := response.Render(FormatTSV)
+	require.NoError(t, err)
+	assert.Equal(t, "host\tcount\na,b\t1\n\t2\n", string(tsv))
+
+	txt, err := response.Render(FormatText)
+	require.NoError(t, err)
+	assert.Equal(t, "     host      |     count     \n"+
+		"---------------+---------------\n"+
+		"a,b            |1              \n"+
+		"               |2              \n", string(txt))
+}
+
+func TestResolveFormat(t *testing.T) {
+	format, err := ResolveFormat("", "text/csv; charset=UTF-8")
+	require.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+
+	format, err = ResolveFormat("TXT", "text/csv")
+	require.NoError(t, err)
+	assert.Equal(t, FormatText, format)
+
+	_, err = ResolveFormat("yaml", "")
+	assert.Error(t, err)
+}
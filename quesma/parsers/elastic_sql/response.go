@@ -0,0 +1,303 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package elastic_sql
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/goccy/go-json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Response is the response of `_sql` endpoint. Columns are returned only for the first page.
+type Response struct {
+	Columns []Column `json:"columns,omitempty"`
+	Rows    [][]any  `json:"rows"`
+	Cursor  string   `json:"cursor,omitempty"`
+}
+
+const datetimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func rowValues(row model.QueryResultRow, columnsCount int) []any {
+	values := make([]any, columnsCount)
+	for i := 0; i < columnsCount && i < len(row.Cols); i++ {
+		switch value := row.Cols[i].ExtractValue().(type) {
+		case time.Time:
+			values[i] = value.UTC().Format(datetimeFormat)
+		default:
+			values[i] = value
+		}
+	}
+	return values
+}
+
+func inferredType(value any) string {
+	switch value.(type) {
+	case bool:
+		return typeBoolean
+	case int8, int16, int32, uint8, uint16:
+		return typeInteger
+	case int, int64, uint32, uint64:
+		return typeLong
+	case float32, float64:
+		return typeDouble
+	case string:
+		return typeKeyword
+	}
+	return typeObject
+}
+
+// inferColumnTypes fills in types which are unknown from the schema, based on the first non-null value
+func inferColumnTypes(columns []Column, rows [][]any) []Column {
+	result := make([]Column, len(columns))
+	copy(result, columns)
+	for i := range result {
+		if result[i].Type != "" && result[i].Type != typeNull {
+			continue
+		}
+		result[i].Type = typeNull
+		for _, row := range rows {
+			if row[i] != nil {
+				result[i].Type = inferredType(row[i])
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Response formats, see https://www.elastic.co/guide/en/elasticsearch/reference/current/sql-rest-format.html
+const (
+	FormatJSON = "json"
+	FormatText = "txt"
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+)
+
+var formatsByMediaType = map[string]string{
+	"application/json":          FormatJSON,
+	"text/plain":                FormatText,
+	"text/csv":                  FormatCSV,
+	"text/tab-separated-values": FormatTSV,
+}
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatText: "text/plain; charset=UTF-8",
+	FormatCSV:  "text/csv; charset=UTF-8",
+	FormatTSV:  "text/tab-separated-values; charset=UTF-8",
+}
+
+// ResolveFormat picks response format, based on `format` URL parameter (preferred) or `Accept` header
+func ResolveFormat(formatParam, acceptHeader string) (string, error) {
+	if formatParam != "" {
+		format := strings.ToLower(formatParam)
+		if _, ok := contentTypes[format]; !ok {
+			return "", fmt.Errorf("invalid format [%s], supported formats: json, txt, csv, tsv", formatParam)
+		}
+		return format, nil
+	}
+	for _, mediaType := range strings.Split(acceptHeader, ",") {
+		mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+		if format, ok := formatsByMediaType[mediaType]; ok {
+			return format, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Render renders the response in the given format. For text formats, cursor has to be returned in `Cursor` header.
+func (r *Response) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatText:
+		return r.renderText(), nil
+	case FormatCSV:
+		return r.renderCSV()
+	case FormatTSV:
+		return r.renderTSV(), nil
+	default:
+		return json.Marshal(r)
+	}
+}
+
+func formatValue(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// renderText renders a table like Elasticsearch does: centered header, left-aligned values, `---+---` separator
+func (r *Response) renderText() []byte {
+	widths := make([]int, len(r.Columns))
+	for i, column := range r.Columns {
+		widths[i] = max(utf8.RuneCountInString(column.Name), 15)
+	}
+	for _, row := range r.Rows {
+		for i, value := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(formatValue(value)))
+			}
+		}
+	}
+
+	var sb strings.Builder
+	if len(r.Columns) > 0 {
+		for i, column := range r.Columns {
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			padding := widths[i] - utf8.RuneCountInString(column.Name)
+			left := padding / 2
+			sb.WriteString(strings.Repeat(" ", left) + column.Name + strings.Repeat(" ", padding-left))
+		}
+		sb.WriteString("\n")
+		for i, width := range widths {
+			if i > 0 {
+				sb.WriteString("+")
+			}
+			sb.WriteString(strings.Repeat("-", width))
+		}
+		sb.WriteString("\n")
+	}
+	for _, row := range r.Rows {
+		for i, value := range row {
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			text := formatValue(value)
+			width := utf8.RuneCountInString(text)
+			if i < len(widths) {
+				width = widths[i]
+			}
+			sb.WriteString(text + strings.Repeat(" ", width-utf8.RuneCountInString(text)))
+		}
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+func (r *Response) renderCSV() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.UseCRLF = true
+	if len(r.Columns) > 0 {
+		header := make([]string, 0, len(r.Columns))
+		for _, column := range r.Columns {
+			header = append(header, column.Name)
+		}
+		if err := writer.Write(header); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range r.Rows {
+		record := make([]string, 0, len(row))
+		for _, value := range row {
+			record = append(record, formatValue(value))
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (r *Response) renderTSV() []byte {
+	var sb strings.Builder
+	writeLine := func(values []string) {
+		for i, value := range values {
+			if i > 0 {
+				sb.WriteString("\t")
+			}
+			sb.WriteString(tsvEscaper.Replace(value))
+		}
+		sb.WriteString("\n")
+	}
+	if len(r.Columns) > 0 {
+		header := make([]string, 0, len(r.Columns))
+		for _, column := range r.Columns {
+			header = append(header, column.Name)
+		}
+		writeLine(header)
+	}
+	for _, row := range r.Rows {
+		record := make([]string, 0, len(row))
+		for _, value := range row {
+			record = append(record, formatValue(value))
+		}
+		writeLine(record)
+	}
+	return []byte(sb.String())
+}
+
+// Cursors are stateless: they contain the original request and the offset of the next page.
+// That's why closing a cursor (`_sql/close`) is a no-op.
+const cursorPrefix = "quesma_sql:"
+
+type cursorContent struct {
+	Query     string     `json:"query"`
+	Params    []any      `json:"params,omitempty"`
+	FetchSize int        `json:"fetch_size"`
+	Filter    types.JSON `json:"filter,omitempty"`
+	Offset    int        `json:"offset"`
+}
+
+func encodeCursor(request *Request) (string, error) {
+	content, err := json.Marshal(cursorContent{
+		Query:     request.Query,
+		Params:    request.Params,
+		FetchSize: request.FetchSize,
+		Filter:    request.Filter,
+		Offset:    request.offset,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(append([]byte(cursorPrefix), content...)), nil
+}
+
+func decodeCursor(cursor string) (*Request, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !bytes.HasPrefix(decoded, []byte(cursorPrefix)) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var content cursorContent
+	if err := json.Unmarshal(decoded[len(cursorPrefix):], &content); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	if content.FetchSize <= 0 {
+		return nil, fmt.Errorf("invalid cursor: wrong fetch size")
+	}
+	return &Request{
+		Query:      content.Query,
+		Params:     content.Params,
+		FetchSize:  content.FetchSize,
+		Filter:     content.Filter,
+		offset:     content.Offset,
+		isNextPage: true,
+	}, nil
+}
+
+// IsQuesmaCursor tells whether the cursor was issued by Quesma (and not by Elasticsearch)
+func IsQuesmaCursor(cursor string) bool {
+	_, err := decodeCursor(cursor)
+	return err == nil
+}
@@ -0,0 +1,119 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import "time"
+
+// Query is a parsed EQL query. Exactly one of Event, Sequence, Sample is set.
+type Query struct {
+	Event    *EventQuery
+	Sequence *SequenceQuery
+	Sample   *SampleQuery
+	Pipes    []Pipe
+}
+
+// EventQuery is `<category> where <condition>`
+type EventQuery struct {
+	Category  string // AnyCategory means no filtering on event category
+	Condition Node
+}
+
+const AnyCategory = "any"
+
+// SequenceStep is a single `[<event query>] by <keys>` element of sequence or sample
+type SequenceStep struct {
+	Query    EventQuery
+	JoinKeys []Field
+}
+
+type SequenceQuery struct {
+	JoinKeys []Field // `sequence by ...`, shared by all steps
+	MaxSpan  time.Duration
+	Steps    []SequenceStep
+	Until    *SequenceStep
+}
+
+type SampleQuery struct {
+	JoinKeys []Field
+	Steps    []SequenceStep
+}
+
+type PipeKind string
+
+const (
+	PipeHead PipeKind = "head"
+	PipeTail PipeKind = "tail"
+)
+
+type Pipe struct {
+	Kind  PipeKind
+	Count int
+}
+
+// Node is a node of EQL condition expression tree
+type Node interface {
+	node()
+}
+
+type (
+	Field struct {
+		Name     string
+		Optional bool // `?field`, missing field is treated as null
+	}
+
+	Literal struct {
+		Value any // string, int64, float64, bool or nil
+	}
+
+	// Comparison covers ==, !=, <, <=, >, >= and `:`
+	Comparison struct {
+		Left  Node
+		Op    string
+		Right Node
+	}
+
+	// Lookup covers `in`, `like` and `regex` families, e.g. `x in~ ("a", "b")`
+	Lookup struct {
+		Left            Node
+		Op              string // "in", "like", "regex"
+		CaseInsensitive bool
+		Negated         bool
+		Values          []Node
+	}
+
+	Logical struct {
+		Op    string // "and", "or"
+		Left  Node
+		Right Node
+	}
+
+	Not struct {
+		Expr Node
+	}
+
+	Arithmetic struct {
+		Left  Node
+		Op    string
+		Right Node
+	}
+
+	Negate struct {
+		Expr Node
+	}
+
+	FunctionCall struct {
+		Name            string
+		CaseInsensitive bool
+		Args            []Node
+	}
+)
+
+func (Field) node()        {}
+func (Literal) node()      {}
+func (Comparison) node()   {}
+func (Lookup) node()       {}
+func (Logical) node()      {}
+func (Not) node()          {}
+func (Arithmetic) node()   {}
+func (Negate) node()       {}
+func (FunctionCall) node() {}
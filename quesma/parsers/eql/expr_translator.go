@@ -0,0 +1,353 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strings"
+)
+
+// exprTranslator translates EQL condition AST into SQL expression.
+// Field references are kept as public field names, they are resolved later by the schema transformation pipeline.
+type exprTranslator struct {
+	schema schema.Schema
+}
+
+func (t *exprTranslator) field(f Field) (model.Expr, error) {
+	if _, ok := t.schema.ResolveField(f.Name); !ok {
+		if f.Optional {
+			return model.NullExpr, nil
+		}
+		return nil, fmt.Errorf("unknown column [%s]", f.Name)
+	}
+	return model.NewColumnRef(f.Name), nil
+}
+
+func (t *exprTranslator) translate(node Node) (model.Expr, error) {
+	switch n := node.(type) {
+	case Field:
+		return t.field(n)
+	case Literal:
+		return literal(n.Value), nil
+	case Logical:
+		left, err := t.translate(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.translate(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == "and" {
+			return model.And([]model.Expr{left, right}), nil
+		}
+		return model.Or([]model.Expr{left, right}), nil
+	case Not:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewPrefixExpr("NOT", []model.Expr{expr}), nil
+	case Negate:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewPrefixExpr("-", []model.Expr{expr}), nil
+	case Arithmetic:
+		left, err := t.translate(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.translate(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewParenExpr(model.NewInfixExpr(left, n.Op, right)), nil
+	case Comparison:
+		return t.comparison(n)
+	case Lookup:
+		return t.lookup(n)
+	case FunctionCall:
+		return t.function(n)
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", node)
+	}
+}
+
+func literal(value any) model.Expr {
+	switch v := value.(type) {
+	case nil:
+		return model.NullExpr
+	case string:
+		return model.NewLiteral(util.SingleQuote(v))
+	default:
+		return model.NewLiteral(v)
+	}
+}
+
+func (t *exprTranslator) comparison(n Comparison) (model.Expr, error) {
+	if n.Op == ":" {
+		return t.lookup(Lookup{Left: n.Left, Op: ":", CaseInsensitive: true, Values: []Node{n.Right}})
+	}
+
+	left, err := t.translate(n.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	// comparisons with null are `IS [NOT] NULL` in SQL
+	if lit, ok := n.Right.(Literal); ok && lit.Value == nil {
+		switch n.Op {
+		case "==":
+			return model.NewInfixExpr(left, "IS", model.NewLiteral("NULL")), nil
+		case "!=":
+			return model.NewInfixExpr(left, "IS", model.NewLiteral("NOT NULL")), nil
+		}
+	}
+
+	right, err := t.translate(n.Right)
+	if err != nil {
+		return nil, err
+	}
+	op := n.Op
+	if op == "==" {
+		op = "="
+	}
+	return model.NewInfixExpr(left, op, right), nil
+}
+
+func (t *exprTranslator) lookup(n Lookup) (model.Expr, error) {
+	left, err := t.translate(n.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.Expr
+	switch n.Op {
+	case "in":
+		values := make([]model.Expr, 0, len(n.Values))
+		for _, v := range n.Values {
+			value, err := t.translate(v)
+			if err != nil {
+				return nil, err
+			}
+			if n.CaseInsensitive {
+				value = model.NewFunction("lower", value)
+			}
+			values = append(values, value)
+		}
+		if n.CaseInsensitive {
+			left = model.NewFunction("lower", left)
+		}
+		result = model.NewInfixExpr(left, "IN", model.NewParenExpr(values...))
+		if len(values) > 1 {
+			result = model.NewInfixExpr(left, "IN", model.NewTupleExpr(values...))
+		}
+	case ":", "like":
+		var alternatives []model.Expr
+		for _, v := range n.Values {
+			lit, isLiteral := v.(Literal)
+			pattern, isString := lit.Value.(string)
+			if !isLiteral || !isString {
+				if n.Op == "like" {
+					return nil, fmt.Errorf("like operator requires string patterns")
+				}
+				// `:` against non-strings is just an equality
+				value, err := t.translate(v)
+				if err != nil {
+					return nil, err
+				}
+				alternatives = append(alternatives, model.NewInfixExpr(left, "=", value))
+				continue
+			}
+			op := "LIKE"
+			if n.CaseInsensitive {
+				op = "ILIKE"
+			}
+			alternatives = append(alternatives, model.NewInfixExpr(left, op, wildcardToLike(pattern)))
+		}
+		result = model.NewParenExpr(model.Or(alternatives))
+		if len(alternatives) == 1 {
+			result = alternatives[0]
+		}
+	case "regex":
+		var alternatives []model.Expr
+		for _, v := range n.Values {
+			lit, isLiteral := v.(Literal)
+			pattern, isString := lit.Value.(string)
+			if !isLiteral || !isString {
+				return nil, fmt.Errorf("regex operator requires string patterns")
+			}
+			if n.CaseInsensitive {
+				pattern = "(?i)" + pattern
+			}
+			// EQL regex must match the whole value, ClickHouse's match() looks for a substring
+			alternatives = append(alternatives, model.NewFunction("match", left, literal("^(?:"+pattern+")$")))
+		}
+		result = model.NewParenExpr(model.Or(alternatives))
+		if len(alternatives) == 1 {
+			result = alternatives[0]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", n.Op)
+	}
+
+	if n.Negated {
+		return model.NewPrefixExpr("NOT", []model.Expr{result}), nil
+	}
+	return result, nil
+}
+
+// wildcardToLike converts EQL wildcard pattern (`*` and `?`) to SQL LIKE pattern
+func wildcardToLike(pattern string) model.Expr {
+	var sb strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteRune('%')
+		case '?':
+			sb.WriteRune('_')
+		case '%', '_', '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '\'':
+			sb.WriteString(`\'`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return model.NewLiteralWithEscapeType(sb.String(), model.FullyEscaped)
+}
+
+func (t *exprTranslator) args(call FunctionCall, minArgs, maxArgs int) ([]model.Expr, error) {
+	if len(call.Args) < minArgs || (maxArgs >= 0 && len(call.Args) > maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+	}
+	args := make([]model.Expr, 0, len(call.Args))
+	for _, arg := range call.Args {
+		expr, err := t.translate(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, expr)
+	}
+	return args, nil
+}
+
+func (t *exprTranslator) function(call FunctionCall) (model.Expr, error) {
+	const unlimited = -1
+
+	lowerIfCaseInsensitive := func(e model.Expr) model.Expr {
+		if call.CaseInsensitive {
+			return model.NewFunction("lower", e)
+		}
+		return e
+	}
+
+	// anyOf builds `fn(source, arg1) OR fn(source, arg2) ...`
+	anyOf := func(fn func(source, arg model.Expr) model.Expr) (model.Expr, error) {
+		args, err := t.args(call, 2, unlimited)
+		if err != nil {
+			return nil, err
+		}
+		source := lowerIfCaseInsensitive(args[0])
+		var alternatives []model.Expr
+		for _, arg := range args[1:] {
+			alternatives = append(alternatives, fn(source, lowerIfCaseInsensitive(arg)))
+		}
+		if len(alternatives) == 1 {
+			return alternatives[0], nil
+		}
+		return model.NewParenExpr(model.Or(alternatives)), nil
+	}
+
+	infix := func(op string) (model.Expr, error) {
+		args, err := t.args(call, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewParenExpr(model.NewInfixExpr(args[0], op, args[1])), nil
+	}
+
+	switch strings.ToLower(call.Name) {
+	case "startswith":
+		return anyOf(func(source, arg model.Expr) model.Expr { return model.NewFunction("startsWith", source, arg) })
+	case "endswith":
+		return anyOf(func(source, arg model.Expr) model.Expr { return model.NewFunction("endsWith", source, arg) })
+	case "stringcontains":
+		return anyOf(func(source, arg model.Expr) model.Expr {
+			return model.NewInfixExpr(model.NewFunction("position", source, arg), ">", model.NewLiteral(0))
+		})
+	case "cidrmatch":
+		return anyOf(func(source, arg model.Expr) model.Expr {
+			return model.NewFunction("isIPAddressInRange", model.NewFunction("toString", source), arg)
+		})
+	case "length":
+		args, err := t.args(call, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewFunction("lengthUTF8", args[0]), nil
+	case "concat":
+		args, err := t.args(call, 1, unlimited)
+		if err != nil {
+			return nil, err
+		}
+		for i := range args {
+			args[i] = model.NewFunction("toString", args[i])
+		}
+		return model.NewFunction("concat", args...), nil
+	case "indexof":
+		args, err := t.args(call, 2, 3)
+		if err != nil {
+			return nil, err
+		}
+		// EQL is 0-based and returns null when not found, ClickHouse is 1-based and returns 0
+		positionArgs := []model.Expr{lowerIfCaseInsensitive(args[0]), lowerIfCaseInsensitive(args[1])}
+		if len(args) == 3 {
+			positionArgs = append(positionArgs, model.NewInfixExpr(args[2], "+", model.NewLiteral(1)))
+		}
+		position := model.NewFunction("position", positionArgs...)
+		return model.NewFunction("nullIf", model.NewInfixExpr(position, "-", model.NewLiteral(1)), model.NewLiteral(-1)), nil
+	case "substring":
+		args, err := t.args(call, 2, 3)
+		if err != nil {
+			return nil, err
+		}
+		// EQL: substring(source, start[, end]), 0-based, end exclusive
+		start := model.NewInfixExpr(args[1], "+", model.NewLiteral(1))
+		if len(args) == 2 {
+			return model.NewFunction("substringUTF8", args[0], start), nil
+		}
+		length := model.NewParenExpr(model.NewInfixExpr(args[2], "-", args[1]))
+		return model.NewFunction("substringUTF8", args[0], start, length), nil
+	case "number":
+		args, err := t.args(call, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewFunction("toFloat64OrNull", model.NewFunction("toString", args[0])), nil
+	case "string":
+		args, err := t.args(call, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewFunction("toString", args[0]), nil
+	case "add":
+		return infix("+")
+	case "subtract":
+		return infix("-")
+	case "multiply":
+		return infix("*")
+	case "divide":
+		return infix("/")
+	case "modulo":
+		return infix("%")
+	default:
+		return nil, fmt.Errorf("unknown function [%s]", call.Name)
+	}
+}
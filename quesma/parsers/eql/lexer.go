@@ -0,0 +1,186 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // for tokenString it's already unescaped value
+	pos   int
+	lower string // lowercase text of identifiers, used for keyword lookup
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	if t.kind != kind {
+		return false
+	}
+	if kind == tokenIdent {
+		return t.lower == text
+	}
+	return t.text == text
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.is(tokenIdent, keyword)
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// operators sorted by length, so that the longest one is matched first
+var operators = []string{
+	"==", "!=", "<=", ">=", "<", ">", ":", "+", "-", "*", "/", "%", "=", "~", "!",
+}
+
+var punctuation = "()[],|"
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated comment at position %d", i)
+			}
+			i += 2 + len([]rune(string(runes[i+2:])[:end])) + 2
+		case r == '"' || r == '\'':
+			value, next, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: i})
+			i = next
+		case r == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != '`' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated escaped field name at position %d", i)
+			}
+			name := string(runes[i+1 : end])
+			tokens = append(tokens, token{kind: tokenIdent, text: name, pos: i, lower: "`" + name})
+			i = end + 1
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// durations, e.g. 10s, 5m
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			kind := tokenNumber
+			if unicode.IsLetter(runes[i-1]) {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: start, lower: strings.ToLower(text)})
+		case isIdentStart(r):
+			start := i
+			i++
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenIdent, text: text, pos: start, lower: strings.ToLower(text)})
+		case strings.ContainsRune(punctuation, r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: i})
+			i++
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@' || r == '?'
+}
+
+func isIdentPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '@'
+}
+
+// readString reads both regular ("...") and raw ("""...""") strings, starting at position start.
+// It returns unescaped value and the position right after the closing quote.
+func readString(runes []rune, start int) (value string, next int, err error) {
+	quote := runes[start]
+	if quote == '"' && start+2 < len(runes) && runes[start+1] == '"' && runes[start+2] == '"' {
+		rest := string(runes[start+3:])
+		end := strings.Index(rest, `"""`)
+		if end == -1 {
+			return "", 0, fmt.Errorf("unterminated raw string at position %d", start)
+		}
+		raw := rest[:end]
+		return raw, start + 3 + len([]rune(raw)) + 3, nil
+	}
+
+	var sb strings.Builder
+	i := start + 1
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == quote:
+			return sb.String(), i + 1, nil
+		case r == '\\' && i+1 < len(runes):
+			i++
+			switch runes[i] {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			default:
+				sb.WriteRune(runes[i])
+			}
+		default:
+			sb.WriteRune(r)
+		}
+		i++
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
@@ -0,0 +1,541 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse parses EQL query into its AST. It supports event queries, sequences, samples and head/tail pipes.
+func Parse(input string) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	query, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is(tokenEOF, "") {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return query, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line 1:%d: %s", p.peek().pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.peek().is(kind, text) {
+		return p.errorf("expected '%s', got %s", text, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+// acceptCaseInsensitiveMarker consumes `~` directly following the previous token, e.g. `in~`
+func (p *parser) acceptCaseInsensitiveMarker() bool {
+	prev := p.tokens[p.pos-1]
+	t := p.peek()
+	if t.is(tokenOperator, "~") && t.pos == prev.pos+len([]rune(prev.text)) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	query := &Query{}
+	var err error
+	switch {
+	case p.peek().isKeyword("sequence"):
+		p.next()
+		query.Sequence, err = p.parseSequence()
+	case p.peek().isKeyword("sample"):
+		p.next()
+		query.Sample, err = p.parseSample()
+	default:
+		var event EventQuery
+		event, err = p.parseEventQuery()
+		query.Event = &event
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is(tokenPunct, "|") {
+		p.next()
+		pipe, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		query.Pipes = append(query.Pipes, pipe)
+	}
+	return query, nil
+}
+
+func (p *parser) parsePipe() (Pipe, error) {
+	name := p.next()
+	var kind PipeKind
+	switch {
+	case name.isKeyword(string(PipeHead)):
+		kind = PipeHead
+	case name.isKeyword(string(PipeTail)):
+		kind = PipeTail
+	default:
+		return Pipe{}, fmt.Errorf("line 1:%d: unsupported pipe %s, only head and tail are supported", name.pos+1, name)
+	}
+	count := p.next()
+	if count.kind != tokenNumber {
+		return Pipe{}, fmt.Errorf("line 1:%d: expected number after %s, got %s", count.pos+1, kind, count)
+	}
+	n, err := strconv.Atoi(count.text)
+	if err != nil || n < 0 {
+		return Pipe{}, fmt.Errorf("line 1:%d: invalid %s value %s", count.pos+1, kind, count)
+	}
+	return Pipe{Kind: kind, Count: n}, nil
+}
+
+func (p *parser) parseEventQuery() (EventQuery, error) {
+	category := p.next()
+	var categoryName string
+	switch category.kind {
+	case tokenIdent:
+		categoryName = category.text
+		if category.isKeyword(AnyCategory) {
+			categoryName = AnyCategory
+		}
+	case tokenString:
+		categoryName = category.text
+	default:
+		return EventQuery{}, fmt.Errorf("line 1:%d: expected event category, got %s", category.pos+1, category)
+	}
+	if err := p.expect(tokenIdent, "where"); err != nil {
+		return EventQuery{}, err
+	}
+	condition, err := p.parseExpression()
+	if err != nil {
+		return EventQuery{}, err
+	}
+	return EventQuery{Category: categoryName, Condition: condition}, nil
+}
+
+func (p *parser) parseJoinKeys() ([]Field, error) {
+	var keys []Field
+	for {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, fmt.Errorf("line 1:%d: expected field name, got %s", t.pos+1, t)
+		}
+		keys = append(keys, newField(t))
+		if !p.peek().is(tokenPunct, ",") {
+			return keys, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseStep() (SequenceStep, error) {
+	if p.peek().is(tokenOperator, "!") {
+		return SequenceStep{}, p.errorf("missing events (`![...]`) are not supported")
+	}
+	if err := p.expect(tokenPunct, "["); err != nil {
+		return SequenceStep{}, err
+	}
+	query, err := p.parseEventQuery()
+	if err != nil {
+		return SequenceStep{}, err
+	}
+	if err = p.expect(tokenPunct, "]"); err != nil {
+		return SequenceStep{}, err
+	}
+	step := SequenceStep{Query: query}
+	if p.peek().isKeyword("by") {
+		p.next()
+		if step.JoinKeys, err = p.parseJoinKeys(); err != nil {
+			return SequenceStep{}, err
+		}
+	}
+	return step, nil
+}
+
+func (p *parser) parseSteps() (steps []SequenceStep, err error) {
+	for p.peek().is(tokenPunct, "[") || p.peek().is(tokenOperator, "!") {
+		step, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func (p *parser) parseSequence() (*SequenceQuery, error) {
+	sequence := &SequenceQuery{}
+	var err error
+	// `by` and `with maxspan` can go in any order
+	for i := 0; i < 2; i++ {
+		switch {
+		case p.peek().isKeyword("by"):
+			p.next()
+			if sequence.JoinKeys, err = p.parseJoinKeys(); err != nil {
+				return nil, err
+			}
+		case p.peek().isKeyword("with"):
+			p.next()
+			if err = p.expect(tokenIdent, "maxspan"); err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokenOperator, "="); err != nil {
+				return nil, err
+			}
+			if sequence.MaxSpan, err = p.parseDuration(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if sequence.Steps, err = p.parseSteps(); err != nil {
+		return nil, err
+	}
+	if len(sequence.Steps) < 2 {
+		return nil, p.errorf("a sequence requires a minimum of 2 queries, found [%d]", len(sequence.Steps))
+	}
+
+	if p.peek().isKeyword("until") {
+		p.next()
+		until, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		sequence.Until = &until
+	}
+
+	if err = checkJoinKeysCount(sequence.Steps, sequence.Until); err != nil {
+		return nil, err
+	}
+	return sequence, nil
+}
+
+func (p *parser) parseSample() (*SampleQuery, error) {
+	sample := &SampleQuery{}
+	var err error
+	if p.peek().isKeyword("by") {
+		p.next()
+		if sample.JoinKeys, err = p.parseJoinKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if sample.Steps, err = p.parseSteps(); err != nil {
+		return nil, err
+	}
+	if len(sample.Steps) < 2 {
+		return nil, p.errorf("a sample requires a minimum of 2 queries, found [%d]", len(sample.Steps))
+	}
+	if err = checkJoinKeysCount(sample.Steps, nil); err != nil {
+		return nil, err
+	}
+	if len(sample.JoinKeys)+len(sample.Steps[0].JoinKeys) == 0 {
+		return nil, p.errorf("a sample requires at least one join key")
+	}
+	return sample, nil
+}
+
+// checkJoinKeysCount verifies that every step defines the same number of its own join keys
+func checkJoinKeysCount(steps []SequenceStep, until *SequenceStep) error {
+	expected := len(steps[0].JoinKeys)
+	for i, step := range steps {
+		if len(step.JoinKeys) != expected {
+			return fmt.Errorf("inconsistent number of join keys specified; expected [%d] but found [%d] in query [%d]", expected, len(step.JoinKeys), i+1)
+		}
+	}
+	if until != nil && len(until.JoinKeys) != expected {
+		return fmt.Errorf("inconsistent number of join keys specified; expected [%d] but found [%d] in until query", expected, len(until.JoinKeys))
+	}
+	return nil
+}
+
+var durationRegexp = regexp.MustCompile(`^(\d+)(ms|s|m|h|d)$`)
+
+func (p *parser) parseDuration() (time.Duration, error) {
+	t := p.next()
+	text := t.lower
+	if t.kind == tokenString {
+		text = strings.ToLower(t.text)
+	}
+	match := durationRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0, fmt.Errorf("line 1:%d: invalid maxspan value %s", t.pos+1, t)
+	}
+	value, _ := strconv.Atoi(match[1])
+	units := map[string]time.Duration{
+		"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour,
+	}
+	return time.Duration(value) * units[match[2]], nil
+}
+
+// Expressions, from the lowest to the highest precedence:
+// or, and, not, comparisons and lookups, +/-, * / %, unary minus, primary
+
+func (p *parser) parseExpression() (Node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.peek().isKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, ":": true}
+
+func (p *parser) parseComparison() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenOperator && comparisonOperators[t.text]:
+		p.next()
+		if t.text == ":" && p.peek().is(tokenPunct, "(") {
+			values, err := p.parseValueList()
+			if err != nil {
+				return nil, err
+			}
+			return Lookup{Left: left, Op: ":", CaseInsensitive: true, Values: values}, nil
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Left: left, Op: t.text, Right: right}, nil
+	case t.isKeyword("not") && p.peekAt(1).isKeyword("in"):
+		p.next()
+		p.next()
+		return p.parseLookupValues(left, "in", true)
+	case t.isKeyword("in") || t.isKeyword("like") || t.isKeyword("regex"):
+		p.next()
+		return p.parseLookupValues(left, t.lower, false)
+	}
+	return left, nil
+}
+
+func (p *parser) parseLookupValues(left Node, op string, negated bool) (Node, error) {
+	caseInsensitive := p.acceptCaseInsensitiveMarker()
+	var values []Node
+	var err error
+	if p.peek().is(tokenPunct, "(") {
+		values, err = p.parseValueList()
+	} else if op != "in" {
+		var value Node
+		value, err = p.parsePrimary()
+		values = []Node{value}
+	} else {
+		err = p.errorf("expected '(' after 'in', got %s", p.peek())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Lookup{Left: left, Op: op, CaseInsensitive: caseInsensitive, Negated: negated, Values: values}, nil
+}
+
+func (p *parser) parseValueList() ([]Node, error) {
+	if err := p.expect(tokenPunct, "("); err != nil {
+		return nil, err
+	}
+	var values []Node
+	for {
+		value, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.peek().is(tokenPunct, ",") {
+			p.next()
+			continue
+		}
+		if err = p.expect(tokenPunct, ")"); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOperator, "+") || p.peek().is(tokenOperator, "-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = Arithmetic{Left: left, Op: op, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOperator, "*") || p.peek().is(tokenOperator, "/") || p.peek().is(tokenOperator, "%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = Arithmetic{Left: left, Op: op, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().is(tokenOperator, "-") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if literal, ok := expr.(Literal); ok {
+			switch v := literal.Value.(type) {
+			case int64:
+				return Literal{Value: -v}, nil
+			case float64:
+				return Literal{Value: -v}, nil
+			}
+		}
+		return Negate{Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return Literal{Value: t.text}, nil
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return Literal{Value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line 1:%d: invalid number %s", t.pos+1, t)
+		}
+		return Literal{Value: f}, nil
+	case tokenPunct:
+		if t.text == "(" {
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokenPunct, ")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	case tokenIdent:
+		switch t.lower {
+		case "true":
+			return Literal{Value: true}, nil
+		case "false":
+			return Literal{Value: false}, nil
+		case "null":
+			return Literal{Value: nil}, nil
+		}
+		caseInsensitive := false
+		if p.peek().is(tokenOperator, "~") && p.peekAt(1).is(tokenPunct, "(") {
+			caseInsensitive = p.acceptCaseInsensitiveMarker()
+		}
+		if p.peek().is(tokenPunct, "(") && !strings.HasPrefix(t.lower, "`") {
+			args, err := p.parseValueList()
+			if err != nil {
+				return nil, err
+			}
+			return FunctionCall{Name: t.text, CaseInsensitive: caseInsensitive, Args: args}, nil
+		}
+		return newField(t), nil
+	}
+	return nil, fmt.Errorf("line 1:%d: unexpected %s", t.pos+1, t)
+}
+
+func newField(t token) Field {
+	if strings.HasPrefix(t.text, "?") {
+		return Field{Name: strings.TrimPrefix(t.text, "?"), Optional: true}
+	}
+	return Field{Name: t.text}
+}
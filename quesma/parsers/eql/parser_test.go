@@ -0,0 +1,66 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseEventQuery(t *testing.T) {
+	query, err := Parse(`process where process.name == "cmd.exe" and not user.name in~ ("root", "admin") | head 5`)
+	require.NoError(t, err)
+	require.NotNil(t, query.Event)
+
+	assert.Equal(t, "process", query.Event.Category)
+	assert.Equal(t, []Pipe{{Kind: PipeHead, Count: 5}}, query.Pipes)
+	assert.Equal(t, Logical{
+		Op:   "and",
+		Left: Comparison{Left: Field{Name: "process.name"}, Op: "==", Right: Literal{Value: "cmd.exe"}},
+		Right: Not{Expr: Lookup{
+			Left:            Field{Name: "user.name"},
+			Op:              "in",
+			CaseInsensitive: true,
+			Values:          []Node{Literal{Value: "root"}, Literal{Value: "admin"}},
+		}},
+	}, query.Event.Condition)
+}
+
+func TestParseSequence(t *testing.T) {
+	query, err := Parse(`sequence by host.id with maxspan=5m
+		[process where true] by process.pid
+		[network where destination.port == 443] by process.pid
+		until [process where event.type == "end"] by process.pid`)
+	require.NoError(t, err)
+	require.NotNil(t, query.Sequence)
+
+	sequence := query.Sequence
+	assert.Equal(t, []Field{{Name: "host.id"}}, sequence.JoinKeys)
+	assert.Equal(t, 5*time.Minute, sequence.MaxSpan)
+	assert.Len(t, sequence.Steps, 2)
+	assert.Equal(t, "network", sequence.Steps[1].Query.Category)
+	assert.Equal(t, []Field{{Name: "process.pid"}}, sequence.Steps[1].JoinKeys)
+	require.NotNil(t, sequence.Until)
+	assert.Equal(t, "process", sequence.Until.Query.Category)
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		``,
+		`process where`,
+		`process where (a == 1`,
+		`sequence [process where true]`,
+		`sequence by host.id [process where true] by a, b [file where true] by a`,
+		`sample [process where true] [file where true]`,
+		`process where true | head x`,
+		`sequence with maxspan=5 [process where true] [file where true]`,
+	}
+	for _, input := range invalid {
+		t.Run(input, func(t *testing.T) {
+			_, err := Parse(input)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"strconv"
+)
+
+const (
+	defaultSize               = 10
+	defaultFetchSize          = 1000
+	maxSequenceCandidates     = 100_000 // guardrail for the number of events we fetch to assemble sequences/samples
+	defaultTimestampField     = model.TimestampFieldName
+	defaultEventCategoryField = "event.category"
+
+	// technical columns added to sequence and sample queries, they're stripped before rendering hits
+	technicalColumnPrefix = "__eql_"
+	timestampColumn       = technicalColumnPrefix + "timestamp"
+	untilColumn           = technicalColumnPrefix + "until"
+)
+
+func stepColumn(step int) string {
+	return technicalColumnPrefix + "step_" + strconv.Itoa(step)
+}
+
+func joinKeyColumn(step, key int) string {
+	return fmt.Sprintf("%sstep_%d_key_%d", technicalColumnPrefix, step, key)
+}
+
+// ClickhouseEQLQueryTranslator translates EQL search requests (`/:index/_eql/search`) into ClickHouse queries.
+//
+// Event queries are translated into a single SELECT. Sequences and samples are translated into a single SELECT
+// which fetches candidate events (ordered by timestamp) together with a flag per sequence step and the join keys.
+// Matching of candidates into sequences/samples is done afterward, in a windowFunnel-like fashion, see sequence.go.
+// The number of candidates is limited, for `| tail` we fetch the latest ones. If the limit is hit, results
+// are reported as partial.
+type ClickhouseEQLQueryTranslator struct {
+	Ctx     context.Context
+	Schema  schema.Schema
+	Table   *clickhouse.Table
+	Indexes []string
+}
+
+type searchRequest struct {
+	query              string
+	size               int
+	fetchSize          int
+	filter             model.Expr
+	timestampField     string
+	eventCategoryField string
+	tiebreakerField    string
+}
+
+func (t *ClickhouseEQLQueryTranslator) parseRequest(body types.JSON) (searchRequest, error) {
+	request := searchRequest{
+		size:               defaultSize,
+		fetchSize:          defaultFetchSize,
+		timestampField:     defaultTimestampField,
+		eventCategoryField: defaultEventCategoryField,
+	}
+
+	query, ok := body["query"].(string)
+	if !ok {
+		return request, fmt.Errorf("query is required and must be a string")
+	}
+	request.query = query
+
+	intParam := func(name string, target *int) error {
+		if v, exists := body[name]; exists {
+			f, ok := v.(float64)
+			if !ok || f < 0 {
+				return fmt.Errorf("%s must be a non-negative number, got: %v", name, v)
+			}
+			*target = int(f)
+		}
+		return nil
+	}
+	if err := intParam("size", &request.size); err != nil {
+		return request, err
+	}
+	if err := intParam("fetch_size", &request.fetchSize); err != nil {
+		return request, err
+	}
+
+	stringParam := func(name string, target *string) {
+		if v, ok := body[name].(string); ok && v != "" {
+			*target = v
+		}
+	}
+	stringParam("timestamp_field", &request.timestampField)
+	stringParam("event_category_field", &request.eventCategoryField)
+	stringParam("tiebreaker_field", &request.tiebreakerField)
+
+	if filter, ok := body["filter"].(map[string]any); ok {
+		dslTranslator := &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: t.Ctx, Schema: t.Schema, Table: t.Table, Indexes: t.Indexes}
+		parsed := dslTranslator.ParseQueryMap(filter)
+		if !parsed.CanParse {
+			return request, fmt.Errorf("can't parse filter: %v", filter)
+		}
+		request.filter = parsed.WhereClause
+	}
+
+	return request, nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) ParseQuery(body types.JSON) (*model.ExecutionPlan, error) {
+	request, err := t.parseRequest(body)
+	if err != nil {
+		return &model.ExecutionPlan{}, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	eqlQuery, err := Parse(request.query)
+	if err != nil {
+		return &model.ExecutionPlan{}, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	var query *model.Query
+	switch {
+	case eqlQuery.Event != nil:
+		query, err = t.buildEventQuery(request, eqlQuery)
+	case eqlQuery.Sequence != nil:
+		query, err = t.buildSequenceQuery(request, eqlQuery)
+	case eqlQuery.Sample != nil:
+		query, err = t.buildSampleQuery(request, eqlQuery)
+	}
+	if err != nil {
+		return &model.ExecutionPlan{}, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	query.TableName = t.Table.Name
+	query.Indexes = t.Indexes
+	query.Schema = t.Schema
+
+	return &model.ExecutionPlan{
+		Queries:               []*model.Query{query},
+		QueryRowsTransformers: make([]model.QueryRowsTransformer, 1),
+	}, nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) MakeSearchResponse(queries []*model.Query, resultSets [][]model.QueryResultRow) *model.SearchResp {
+	response := &model.SearchResp{
+		Shards: model.ResponseShards{Total: 1, Successful: 1},
+		Hits:   model.SearchHits{Total: &model.Total{Value: 0, Relation: "eq"}},
+	}
+	if len(queries) == 0 || len(resultSets) == 0 {
+		return response
+	}
+
+	rendered := queries[0].Type.TranslateSqlResponseToJson(resultSets[0])
+	if hits, ok := rendered["hits"].(model.SearchHits); ok {
+		response.Hits = hits
+		if hits.Total != nil && hits.Total.Relation == totalRelationPartial {
+			isPartial := true
+			response.IsPartial = &isPartial
+		}
+	} else {
+		logger.ErrorWithCtx(t.Ctx).Msgf("unexpected EQL response shape: %v", rendered)
+	}
+	return response
+}
+
+// resultLimit computes how many results (events or sequences) we return, taking `size` and head/tail pipes into account.
+// fromTail is true <=> the last results should be returned.
+func resultLimit(request searchRequest, query *Query) (limit int, fromTail bool) {
+	limit = request.size
+	for _, pipe := range query.Pipes {
+		if pipe.Count < limit {
+			limit = pipe.Count
+		}
+		fromTail = pipe.Kind == PipeTail
+	}
+	return limit, fromTail
+}
+
+// eventCondition translates `<category> where <condition>`
+func (t *ClickhouseEQLQueryTranslator) eventCondition(request searchRequest, event EventQuery) (model.Expr, error) {
+	translator := &exprTranslator{schema: t.Schema}
+	condition, err := translator.translate(event.Condition)
+	if err != nil {
+		return nil, err
+	}
+	if event.Category == AnyCategory {
+		return condition, nil
+	}
+	if _, ok := t.Schema.ResolveField(request.eventCategoryField); !ok {
+		return nil, fmt.Errorf("event category field [%s] not found", request.eventCategoryField)
+	}
+	category := model.NewInfixExpr(model.NewColumnRef(request.eventCategoryField), "=", literal(event.Category))
+	return model.And([]model.Expr{category, condition}), nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) orderBy(request searchRequest, direction model.OrderByDirection) []model.OrderByExpr {
+	orderBy := []model.OrderByExpr{model.NewSortColumn(request.timestampField, direction)}
+	if request.tiebreakerField != "" {
+		orderBy = append(orderBy, model.NewSortColumn(request.tiebreakerField, direction))
+	}
+	return orderBy
+}
+
+func (t *ClickhouseEQLQueryTranslator) checkTimestampField(request searchRequest) error {
+	if _, ok := t.Schema.ResolveField(request.timestampField); !ok {
+		return fmt.Errorf("timestamp field [%s] not found", request.timestampField)
+	}
+	return nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) buildEventQuery(request searchRequest, query *Query) (*model.Query, error) {
+	if err := t.checkTimestampField(request); err != nil {
+		return nil, err
+	}
+	condition, err := t.eventCondition(request, *query.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, fromTail := resultLimit(request, query)
+	direction := model.AscOrder
+	if fromTail {
+		direction = model.DescOrder
+	}
+
+	where := model.And([]model.Expr{request.filter, condition})
+	selectCommand := model.NewSelectCommand([]model.Expr{model.NewWildcardExpr}, nil, t.orderBy(request, direction),
+		model.NewTableRef(model.SingleTableNamePlaceHolder), where, []model.Expr{}, limit, 0, false, nil)
+
+	return &model.Query{
+		SelectCommand: *selectCommand,
+		Type:          newEventsType(t.newHits(), fromTail),
+	}, nil
+}
+
+// candidatesLimit is the maximum number of candidate events fetched for a sequence or a sample
+func candidatesLimit(request searchRequest, stepsCount int) int {
+	limit := request.fetchSize * stepsCount
+	if limit > maxSequenceCandidates || limit == 0 {
+		limit = maxSequenceCandidates
+	}
+	return limit
+}
+
+// candidatesSelect builds the query which fetches all events matching at least one of the steps.
+// Each row has a flag per step telling which steps it matches and join keys of each step.
+// Descending direction fetches the latest events, if there are more than candidatesLimit of them.
+func (t *ClickhouseEQLQueryTranslator) candidatesSelect(request searchRequest, sharedKeys []Field, steps []SequenceStep,
+	until *SequenceStep, direction model.OrderByDirection) (*model.SelectCommand, error) {
+	if err := t.checkTimestampField(request); err != nil {
+		return nil, err
+	}
+	translator := &exprTranslator{schema: t.Schema}
+
+	columns := []model.Expr{
+		model.NewWildcardExpr,
+		model.NewAliasedExpr(model.NewColumnRef(request.timestampField), timestampColumn),
+	}
+	var anyStep []model.Expr
+
+	addStep := func(stepColumnName string, stepIdx int, step SequenceStep) error {
+		condition, err := t.eventCondition(request, step.Query)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, model.NewAliasedExpr(condition, stepColumnName))
+		anyStep = append(anyStep, condition)
+
+		keys := append(append([]Field{}, sharedKeys...), step.JoinKeys...)
+		for i, key := range keys {
+			keyExpr, err := translator.field(key)
+			if err != nil {
+				return err
+			}
+			columns = append(columns, model.NewAliasedExpr(keyExpr, joinKeyColumn(stepIdx, i)))
+		}
+		return nil
+	}
+
+	for i, step := range steps {
+		if err := addStep(stepColumn(i), i, step); err != nil {
+			return nil, err
+		}
+	}
+	if until != nil {
+		if err := addStep(untilColumn, len(steps), *until); err != nil {
+			return nil, err
+		}
+	}
+
+	where := model.And([]model.Expr{request.filter, model.NewParenExpr(model.Or(anyStep))})
+	return model.NewSelectCommand(columns, nil, t.orderBy(request, direction), model.NewTableRef(model.SingleTableNamePlaceHolder),
+		where, []model.Expr{}, candidatesLimit(request, len(steps)), 0, false, nil), nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) buildSequenceQuery(request searchRequest, query *Query) (*model.Query, error) {
+	sequence := query.Sequence
+	limit, fromTail := resultLimit(request, query)
+	direction := model.AscOrder
+	if fromTail {
+		direction = model.DescOrder
+	}
+	selectCommand, err := t.candidatesSelect(request, sequence.JoinKeys, sequence.Steps, sequence.Until, direction)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Query{
+		SelectCommand: *selectCommand,
+		Type: &sequencesType{
+			hits:            t.newHits(),
+			stepsCount:      len(sequence.Steps),
+			hasUntil:        sequence.Until != nil,
+			maxSpan:         sequence.MaxSpan,
+			limit:           limit,
+			fromTail:        fromTail,
+			candidatesLimit: candidatesLimit(request, len(sequence.Steps)),
+		},
+	}, nil
+}
+
+func (t *ClickhouseEQLQueryTranslator) buildSampleQuery(request searchRequest, query *Query) (*model.Query, error) {
+	sample := query.Sample
+	selectCommand, err := t.candidatesSelect(request, sample.JoinKeys, sample.Steps, nil, model.AscOrder)
+	if err != nil {
+		return nil, err
+	}
+	limit, _ := resultLimit(request, query)
+	return &model.Query{
+		SelectCommand: *selectCommand,
+		Type: &samplesType{
+			hits:            t.newHits(),
+			stepsCount:      len(sample.Steps),
+			limit:           limit,
+			candidatesLimit: candidatesLimit(request, len(sample.Steps)),
+		},
+	}, nil
+}
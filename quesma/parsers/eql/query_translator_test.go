@@ -0,0 +1,124 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func testTranslator() *ClickhouseEQLQueryTranslator {
+	fields := map[schema.FieldName]schema.Field{}
+	for _, name := range []string{"@timestamp", "event.category", "process.name", "process.pid", "host.id"} {
+		fields[schema.FieldName(name)] = schema.Field{PropertyName: schema.FieldName(name), InternalPropertyName: schema.FieldName(name), Type: schema.QuesmaTypeKeyword}
+	}
+	return &ClickhouseEQLQueryTranslator{
+		Ctx:     context.Background(),
+		Schema:  schema.Schema{Fields: fields},
+		Table:   &clickhouse.Table{Name: "logs"},
+		Indexes: []string{"logs"},
+	}
+}
+
+func TestTranslateEventQuery(t *testing.T) {
+	testcases := []struct {
+		query       string
+		expectedSQL string
+	}{
+		{
+			query: `process where process.name : "cmd*"`,
+			expectedSQL: `SELECT * FROM __quesma_table_name WHERE ("event.category"='process' AND "process.name" ILIKE 'cmd%') ` +
+				`ORDER BY "@timestamp" ASC LIMIT 10`,
+		},
+		{
+			query:       `any where process.pid in (1, 2) | tail 3`,
+			expectedSQL: `SELECT * FROM __quesma_table_name WHERE "process.pid" IN tuple(1, 2) ORDER BY "@timestamp" DESC LIMIT 3`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			plan, err := testTranslator().ParseQuery(types.JSON{"query": tc.query})
+			require.NoError(t, err)
+			require.Len(t, plan.Queries, 1)
+			assert.Equal(t, tc.expectedSQL, plan.Queries[0].SelectCommand.String())
+		})
+	}
+}
+
+func TestTranslateUnknownField(t *testing.T) {
+	_, err := testTranslator().ParseQuery(types.JSON{"query": `process where foo == 1`})
+	assert.ErrorContains(t, err, "unknown column [foo]")
+
+	_, err = testTranslator().ParseQuery(types.JSON{"query": `process where ?foo == 1`})
+	assert.NoError(t, err)
+}
+
+func candidateRow(ts time.Time, step0, step1 bool, key string) model.QueryResultRow {
+	return model.QueryResultRow{Cols: []model.QueryResultCol{
+		model.NewQueryResultCol(timestampColumn, ts),
+		model.NewQueryResultCol(stepColumn(0), step0),
+		model.NewQueryResultCol(joinKeyColumn(0, 0), key),
+		model.NewQueryResultCol(stepColumn(1), step1),
+		model.NewQueryResultCol(joinKeyColumn(1, 0), key),
+	}}
+}
+
+func TestSequenceMatching(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []model.QueryResultRow{
+		candidateRow(start, true, false, "a"),
+		candidateRow(start.Add(time.Second), true, false, "b"),
+		candidateRow(start.Add(2*time.Second), false, true, "a"),
+		candidateRow(start.Add(10*time.Minute), false, true, "b"), // too late for maxspan
+		candidateRow(start.Add(11*time.Minute), true, false, "a"),
+		candidateRow(start.Add(12*time.Minute), false, true, "a"),
+	}
+
+	sequences := (&sequencesType{stepsCount: 2, maxSpan: 5 * time.Minute, limit: 10}).match(extractCandidates(rows, 2))
+	require.Len(t, sequences, 2)
+	assert.Equal(t, []any{"a"}, sequences[0].joinKeys)
+	assert.Equal(t, 0, sequences[0].events[0].position)
+	assert.Equal(t, 2, sequences[0].events[1].position)
+	assert.Equal(t, 4, sequences[1].events[0].position)
+	assert.Equal(t, 5, sequences[1].events[1].position)
+}
+
+func TestTranslateSequenceTail(t *testing.T) {
+	plan, err := testTranslator().ParseQuery(types.JSON{
+		"query":      `sequence by host.id [process where process.name == "a"] [process where process.name == "b"] | tail 1`,
+		"fetch_size": 2.0,
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.Queries, 1)
+	// the latest candidates are fetched, so that tail isn't computed from the earliest events
+	assert.Contains(t, plan.Queries[0].SelectCommand.String(), `ORDER BY "@timestamp" DESC LIMIT 4`)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []model.QueryResultRow{ // in the descending order, as returned by the query
+		candidateRow(start.Add(3*time.Second), false, true, "b"),
+		candidateRow(start.Add(2*time.Second), true, false, "b"),
+		candidateRow(start.Add(time.Second), false, true, "a"),
+		candidateRow(start, true, false, "a"),
+	}
+	rendered := plan.Queries[0].Type.TranslateSqlResponseToJson(rows)
+	hits := rendered["hits"].(model.SearchHits)
+	require.Len(t, hits.Sequences, 1)
+	assert.Equal(t, []any{"b"}, hits.Sequences[0].JoinKeys)
+	// we've fetched as many candidates as the limit, there might be more sequences
+	assert.Equal(t, &model.Total{Value: 2, Relation: totalRelationPartial}, hits.Total)
+
+	response := (&ClickhouseEQLQueryTranslator{}).MakeSearchResponse(plan.Queries, [][]model.QueryResultRow{rows})
+	require.NotNil(t, response.IsPartial)
+	assert.True(t, *response.IsPartial)
+
+	response = (&ClickhouseEQLQueryTranslator{}).MakeSearchResponse(plan.Queries, [][]model.QueryResultRow{rows[:2]})
+	assert.Nil(t, response.IsPartial)
+	assert.Equal(t, &model.Total{Value: 1, Relation: "eq"}, response.Hits.Total)
+}
@@ -0,0 +1,348 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/model/typical_queries"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/goccy/go-json"
+	"slices"
+	"strings"
+	"time"
+)
+
+func (t *ClickhouseEQLQueryTranslator) newHits() typical_queries.Hits {
+	highlighter := elastic_query_dsl.NewEmptyHighlighter()
+	return typical_queries.NewHits(t.Ctx, t.Table, &highlighter, nil, true, false, false, t.Indexes)
+}
+
+// renderHits renders rows as hits, with technical columns stripped
+func renderHits(hits typical_queries.Hits, rows []model.QueryResultRow) []model.SearchHit {
+	stripped := make([]model.QueryResultRow, 0, len(rows))
+	for _, row := range rows {
+		cols := make([]model.QueryResultCol, 0, len(row.Cols))
+		for _, col := range row.Cols {
+			if !strings.HasPrefix(col.ColName, technicalColumnPrefix) {
+				cols = append(cols, col)
+			}
+		}
+		stripped = append(stripped, model.QueryResultRow{Index: row.Index, Cols: cols})
+	}
+	rendered := hits.TranslateSqlResponseToJson(stripped)
+	if searchHits, ok := rendered["hits"].(model.SearchHits); ok {
+		return searchHits.Hits
+	}
+	return []model.SearchHit{}
+}
+
+// totalRelationPartial is the relation of the total number of sequences/samples, when there were more
+// candidate events than we fetched. There might be more matches, the response is partial then.
+const totalRelationPartial = "gte"
+
+func searchHits(total int, partial bool) model.SearchHits {
+	if partial {
+		return model.SearchHits{Total: &model.Total{Value: total, Relation: totalRelationPartial}}
+	}
+	return model.SearchHits{Total: &model.Total{Value: total, Relation: "eq"}}
+}
+
+// eventsType renders results of plain event queries
+type eventsType struct {
+	hits     typical_queries.Hits
+	reversed bool // true <=> rows are in the descending order (tail pipe), we need to reverse them
+}
+
+func newEventsType(hits typical_queries.Hits, reversed bool) *eventsType {
+	return &eventsType{hits: hits, reversed: reversed}
+}
+
+func (e *eventsType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (e *eventsType) String() string {
+	return "eql_events"
+}
+
+func (e *eventsType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if e.reversed {
+		rows = slices.Clone(rows)
+		slices.Reverse(rows)
+	}
+	result := searchHits(len(rows), false)
+	result.Events = renderHits(e.hits, rows)
+	return model.JsonMap{"hits": result}
+}
+
+// candidate is a single event fetched by the sequence/sample query
+type candidate struct {
+	position  int
+	timestamp time.Time
+	steps     []bool   // steps[i] <=> event matches i-th step (last one is `until`, if present)
+	keys      [][]any  // join key values for each step
+	keyIds    []string // keys serialized, used for grouping
+}
+
+func columnValue(row model.QueryResultRow, name string) (any, bool) {
+	for _, col := range row.Cols {
+		if col.ColName == name {
+			return col.ExtractValue(), true
+		}
+	}
+	return nil, false
+}
+
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case uint8:
+		return v != 0
+	case int64:
+		return v != 0
+	case uint64:
+		return v != 0
+	case int:
+		return v != 0
+	}
+	return false
+}
+
+func asTime(value any) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case int64:
+		return time.UnixMilli(v)
+	case uint64:
+		return time.UnixMilli(int64(v))
+	case float64:
+		return time.UnixMilli(int64(v))
+	}
+	return time.Time{}
+}
+
+func extractCandidates(rows []model.QueryResultRow, stepsCount int) []candidate {
+	candidates := make([]candidate, 0, len(rows))
+	for i, row := range rows {
+		c := candidate{position: i, steps: make([]bool, stepsCount), keys: make([][]any, stepsCount), keyIds: make([]string, stepsCount)}
+		if ts, ok := columnValue(row, timestampColumn); ok {
+			c.timestamp = asTime(ts)
+		}
+		for step := 0; step < stepsCount; step++ {
+			name := stepColumn(step)
+			if step == stepsCount-1 {
+				// `until` is always the last one, if present
+				if _, isUntil := columnValue(row, untilColumn); isUntil {
+					name = untilColumn
+				}
+			}
+			flag, _ := columnValue(row, name)
+			c.steps[step] = isTrue(flag)
+			for key := 0; ; key++ {
+				value, ok := columnValue(row, joinKeyColumn(step, key))
+				if !ok {
+					break
+				}
+				c.keys[step] = append(c.keys[step], value)
+			}
+			serialized, _ := json.Marshal(c.keys[step])
+			c.keyIds[step] = string(serialized)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// sequencesType assembles sequences from candidate events, ordered by timestamp.
+//
+// It's the same state machine Elasticsearch (and ClickHouse's windowFunnel) uses: for every join key
+// we keep at most one in-flight sequence per stage. An event matching stage N moves the in-flight sequence from
+// stage N-1 to stage N. An event matching the first stage starts a new sequence, replacing the previous one.
+// `until` event drops all in-flight sequences of its join key, and `maxspan` limits the duration of a sequence.
+type sequencesType struct {
+	hits            typical_queries.Hits
+	stepsCount      int
+	hasUntil        bool
+	maxSpan         time.Duration
+	limit           int
+	fromTail        bool // true <=> candidates are in the descending order (tail pipe), we need to reverse them
+	candidatesLimit int
+}
+
+func (s *sequencesType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (s *sequencesType) String() string {
+	return fmt.Sprintf("eql_sequence(steps: %d)", s.stepsCount)
+}
+
+type partialSequence struct {
+	events   []candidate
+	joinKeys []any
+}
+
+func (s *sequencesType) match(candidates []candidate) []partialSequence {
+	var completed []partialSequence
+	inFlight := make(map[string][]*partialSequence) // join key -> in-flight sequence per stage
+
+	for _, event := range candidates {
+		if s.hasUntil && event.steps[s.stepsCount] {
+			delete(inFlight, event.keyIds[s.stepsCount])
+		}
+		// going backwards, so that a single event doesn't advance the same sequence twice
+		for stage := s.stepsCount - 1; stage >= 0; stage-- {
+			if !event.steps[stage] {
+				continue
+			}
+			key := event.keyIds[stage]
+			stages, ok := inFlight[key]
+			if !ok {
+				stages = make([]*partialSequence, s.stepsCount)
+				inFlight[key] = stages
+			}
+			if stage == 0 {
+				stages[0] = &partialSequence{events: []candidate{event}, joinKeys: event.keys[0]}
+				continue
+			}
+			previous := stages[stage-1]
+			if previous == nil {
+				continue
+			}
+			stages[stage-1] = nil
+			if s.maxSpan > 0 && event.timestamp.Sub(previous.events[0].timestamp) > s.maxSpan {
+				continue
+			}
+			advanced := &partialSequence{events: append(slices.Clone(previous.events), event), joinKeys: previous.joinKeys}
+			if stage == s.stepsCount-1 {
+				completed = append(completed, *advanced)
+			} else {
+				stages[stage] = advanced
+			}
+		}
+	}
+
+	slices.SortStableFunc(completed, func(a, b partialSequence) int {
+		return a.events[0].position - b.events[0].position
+	})
+	return completed
+}
+
+func (s *sequencesType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	stepsCount := s.stepsCount
+	if s.hasUntil {
+		stepsCount++
+	}
+	if s.fromTail {
+		rows = slices.Clone(rows)
+		slices.Reverse(rows)
+	}
+	sequences := s.match(extractCandidates(rows, stepsCount))
+	total := len(sequences)
+
+	if len(sequences) > s.limit {
+		if s.fromTail {
+			sequences = sequences[len(sequences)-s.limit:]
+		} else {
+			sequences = sequences[:s.limit]
+		}
+	}
+
+	result := searchHits(total, len(rows) >= s.candidatesLimit)
+	result.Sequences = renderSequences(s.hits, rows, sequences)
+	return model.JsonMap{"hits": result}
+}
+
+// renderSequences renders all used rows at once, so that hits have unique ids within the response
+func renderSequences(hits typical_queries.Hits, rows []model.QueryResultRow, sequences []partialSequence) []model.EqlSequence {
+	hitPosition := make(map[int]int)
+	var usedRows []model.QueryResultRow
+	for _, sequence := range sequences {
+		for _, event := range sequence.events {
+			if _, ok := hitPosition[event.position]; !ok {
+				hitPosition[event.position] = len(usedRows)
+				usedRows = append(usedRows, rows[event.position])
+			}
+		}
+	}
+	rendered := renderHits(hits, usedRows)
+
+	result := make([]model.EqlSequence, 0, len(sequences))
+	for _, sequence := range sequences {
+		eqlSequence := model.EqlSequence{JoinKeys: sequence.joinKeys, Events: make([]model.SearchHit, 0, len(sequence.events))}
+		for _, event := range sequence.events {
+			eqlSequence.Events = append(eqlSequence.Events, rendered[hitPosition[event.position]])
+		}
+		result = append(result, eqlSequence)
+	}
+	return result
+}
+
+// samplesType assembles samples: sets of events sharing the same join keys, one event per filter, in any order.
+// Like Elasticsearch with default `max_samples_per_key`, we return at most one sample per join key.
+type samplesType struct {
+	hits            typical_queries.Hits
+	stepsCount      int
+	limit           int
+	candidatesLimit int
+}
+
+func (s *samplesType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (s *samplesType) String() string {
+	return fmt.Sprintf("eql_sample(filters: %d)", s.stepsCount)
+}
+
+func (s *samplesType) match(candidates []candidate) []partialSequence {
+	var keysOrder []string
+	byKey := make(map[string][][]candidate) // join key -> candidates for each step
+	for _, event := range candidates {
+		for step := 0; step < s.stepsCount; step++ {
+			if !event.steps[step] {
+				continue
+			}
+			key := event.keyIds[step]
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = make([][]candidate, s.stepsCount)
+				keysOrder = append(keysOrder, key)
+			}
+			byKey[key][step] = append(byKey[key][step], event)
+		}
+	}
+	slices.Sort(keysOrder)
+
+	var samples []partialSequence
+	for _, key := range keysOrder {
+		used := make(map[int]bool)
+		sample := partialSequence{}
+		for step := 0; step < s.stepsCount; step++ {
+			for _, event := range byKey[key][step] {
+				if !used[event.position] {
+					used[event.position] = true
+					sample.events = append(sample.events, event)
+					sample.joinKeys = event.keys[step]
+					break
+				}
+			}
+		}
+		if len(sample.events) == s.stepsCount {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+func (s *samplesType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	samples := s.match(extractCandidates(rows, s.stepsCount))
+	if len(samples) > s.limit {
+		samples = samples[:s.limit]
+	}
+	result := searchHits(len(samples), len(rows) >= s.candidatesLimit)
+	result.Sequences = renderSequences(s.hits, rows, samples)
+	return model.JsonMap{"hits": result}
+}
@@ -0,0 +1,149 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import "time"
+
+// Query is a parsed ES|QL query: a source command (FROM) followed by processing commands.
+type Query struct {
+	Indexes  []string
+	Metadata []string // METADATA fields requested in FROM, e.g. _index
+	Commands []Command
+}
+
+type Command interface {
+	isCommand()
+}
+
+// Assignment is `name = expr`, or just `expr`. Then name is the source text of the expression, like in Elasticsearch.
+type Assignment struct {
+	Name string
+	Expr Node
+}
+
+type (
+	Where struct {
+		Condition Node
+	}
+	Eval struct {
+		Assignments []Assignment
+	}
+	Stats struct {
+		Aggregations []Assignment
+		By           []Assignment
+	}
+	Sort struct {
+		Items []SortItem
+	}
+	Limit struct {
+		Count int
+	}
+	Keep struct {
+		Patterns []string
+	}
+	Drop struct {
+		Patterns []string
+	}
+	Rename struct {
+		Renames []RenameItem
+	}
+	Dissect struct {
+		Input           Node
+		Pattern         string
+		AppendSeparator string
+	}
+	Grok struct {
+		Input   Node
+		Pattern string
+	}
+)
+
+type SortItem struct {
+	Expr       Node
+	Desc       bool
+	NullsFirst bool
+}
+
+type RenameItem struct {
+	From string
+	To   string
+}
+
+func (Where) isCommand()   {}
+func (Eval) isCommand()    {}
+func (Stats) isCommand()   {}
+func (Sort) isCommand()    {}
+func (Limit) isCommand()   {}
+func (Keep) isCommand()    {}
+func (Drop) isCommand()    {}
+func (Rename) isCommand()  {}
+func (Dissect) isCommand() {}
+func (Grok) isCommand()    {}
+
+type Node interface {
+	isNode()
+}
+
+type (
+	Field struct {
+		Name string
+	}
+	// Literal value: nil, bool, int64, float64 or string
+	Literal struct {
+		Value any
+	}
+	// TimeSpan is a time span literal, e.g. `1 hour`
+	TimeSpan struct {
+		Duration time.Duration
+		Unit     string // normalized unit, e.g. "hour"
+		Count    int64
+	}
+	Binary struct {
+		Op    string // AND, OR, ==, !=, <, <=, >, >=, +, -, *, /, %
+		Left  Node
+		Right Node
+	}
+	Unary struct {
+		Op   string // NOT, -
+		Expr Node
+	}
+	// FunctionCall is a call of scalar or aggregate function, with uppercase name
+	FunctionCall struct {
+		Name string
+		Args []Node
+	}
+	In struct {
+		Expr    Node
+		Values  []Node
+		Negated bool
+	}
+	Like struct {
+		Expr    Node
+		Pattern string
+		Regex   bool // RLIKE
+		Negated bool
+	}
+	IsNull struct {
+		Expr    Node
+		Negated bool
+	}
+	// Cast is `expr::type`
+	Cast struct {
+		Expr Node
+		Type string
+	}
+	// Star is `*` in COUNT(*)
+	Star struct{}
+)
+
+func (Field) isNode()        {}
+func (Literal) isNode()      {}
+func (TimeSpan) isNode()     {}
+func (Binary) isNode()       {}
+func (Unary) isNode()        {}
+func (FunctionCall) isNode() {}
+func (In) isNode()           {}
+func (Like) isNode()         {}
+func (IsNull) isNode()       {}
+func (Cast) isNode()         {}
+func (Star) isNode()         {}
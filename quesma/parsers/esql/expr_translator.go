@@ -0,0 +1,560 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/util"
+	"strings"
+)
+
+// ES|QL types, see https://www.elastic.co/guide/en/elasticsearch/reference/current/esql-supported-types.html
+const (
+	typeKeyword     = "keyword"
+	typeText        = "text"
+	typeInteger     = "integer"
+	typeLong        = "long"
+	typeDouble      = "double"
+	typeBoolean     = "boolean"
+	typeDate        = "date"
+	typeIp          = "ip"
+	typeGeoPoint    = "geo_point"
+	typeDatePeriod  = "date_period"
+	typeNull        = "null"
+	typeUnsupported = "unsupported"
+)
+
+func esqlType(t schema.QuesmaType) string {
+	switch t.Name {
+	case schema.QuesmaTypeText.Name:
+		return typeText
+	case schema.QuesmaTypeKeyword.Name:
+		return typeKeyword
+	case schema.QuesmaTypeInteger.Name:
+		return typeInteger
+	case schema.QuesmaTypeLong.Name, schema.QuesmaTypeUnsignedLong.Name:
+		return typeLong
+	case schema.QuesmaTypeFloat.Name:
+		return typeDouble
+	case schema.QuesmaTypeBoolean.Name:
+		return typeBoolean
+	case schema.QuesmaTypeTimestamp.Name, schema.QuesmaTypeDate.Name:
+		return typeDate
+	case schema.QuesmaTypeIp.Name:
+		return typeIp
+	case schema.QuesmaTypePoint.Name:
+		return typeGeoPoint
+	default:
+		return typeUnsupported
+	}
+}
+
+func isNumericType(t string) bool {
+	return t == typeInteger || t == typeLong || t == typeDouble
+}
+
+func isStringType(t string) bool {
+	return t == typeKeyword || t == typeText
+}
+
+// column is a column of an intermediate result of the query, which can be referenced by the next commands
+type column struct {
+	name     string
+	expr     model.Expr
+	esqlType string
+}
+
+type typedExpr struct {
+	expr     model.Expr
+	esqlType string
+}
+
+// exprTranslator translates ES|QL expressions into ClickHouse expressions.
+// References to columns are replaced with expressions computing them (which are resolved later by the schema transformation pipeline).
+type exprTranslator struct {
+	columns         []column
+	allowAggregates bool // true <=> we're translating STATS
+}
+
+func (t *exprTranslator) column(name string) (typedExpr, error) {
+	for i := len(t.columns) - 1; i >= 0; i-- {
+		if t.columns[i].name == name {
+			return typedExpr{t.columns[i].expr, t.columns[i].esqlType}, nil
+		}
+	}
+	return typedExpr{}, fmt.Errorf("Unknown column [%s]", name)
+}
+
+func literal(value any) typedExpr {
+	switch v := value.(type) {
+	case nil:
+		return typedExpr{model.NullExpr, typeNull}
+	case string:
+		return typedExpr{model.NewLiteral(util.SingleQuote(v)), typeKeyword}
+	case bool:
+		return typedExpr{model.NewLiteral(v), typeBoolean}
+	case int64:
+		if v == int64(int32(v)) {
+			return typedExpr{model.NewLiteral(v), typeInteger}
+		}
+		return typedExpr{model.NewLiteral(v), typeLong}
+	case float64:
+		return typedExpr{model.NewLiteral(v), typeDouble}
+	default:
+		return typedExpr{model.NewLiteral(util.SingleQuote(fmt.Sprintf("%v", v))), typeKeyword}
+	}
+}
+
+// interval renders time span as ClickHouse interval, e.g. INTERVAL 1 hour
+func interval(span TimeSpan) model.Expr {
+	return model.NewLiteral(fmt.Sprintf("INTERVAL %d %s", span.Count, span.Unit))
+}
+
+func (t *exprTranslator) translateAll(nodes []Node) ([]model.Expr, []string, error) {
+	exprs := make([]model.Expr, 0, len(nodes))
+	types := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		translated, err := t.translate(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		exprs = append(exprs, translated.expr)
+		types = append(types, translated.esqlType)
+	}
+	return exprs, types, nil
+}
+
+func (t *exprTranslator) translate(node Node) (typedExpr, error) {
+	switch n := node.(type) {
+	case Field:
+		return t.column(n.Name)
+	case Literal:
+		return literal(n.Value), nil
+	case TimeSpan:
+		return typedExpr{interval(n), typeDatePeriod}, nil
+	case Star:
+		return typedExpr{}, fmt.Errorf("* is allowed only in COUNT(*)")
+	case Unary:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if n.Op == "NOT" {
+			return typedExpr{model.NewPrefixExpr("NOT", []model.Expr{expr.expr}), typeBoolean}, nil
+		}
+		return typedExpr{model.NewPrefixExpr("-", []model.Expr{expr.expr}), expr.esqlType}, nil
+	case In:
+		left, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		values, _, err := t.translateAll(n.Values)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		op := "IN"
+		if n.Negated {
+			op = "NOT IN"
+		}
+		return typedExpr{model.NewInfixExpr(left.expr, op, model.NewTupleExpr(values...)), typeBoolean}, nil
+	case Like:
+		left, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		var result model.Expr
+		if n.Regex {
+			// RLIKE patterns match the whole string
+			result = model.NewFunction("match", left.expr, literal("^(?:"+n.Pattern+")$").expr)
+		} else {
+			result = model.NewInfixExpr(left.expr, "LIKE", literal(wildcardToLike(n.Pattern)).expr)
+		}
+		if n.Negated {
+			result = model.NewPrefixExpr("NOT", []model.Expr{result})
+		}
+		return typedExpr{result, typeBoolean}, nil
+	case IsNull:
+		expr, err := t.translate(n.Expr)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		op := "IS NULL"
+		if n.Negated {
+			op = "IS NOT NULL"
+		}
+		return typedExpr{model.NewInfixExpr(expr.expr, "IS", model.NewLiteral(strings.TrimPrefix(op, "IS "))), typeBoolean}, nil
+	case Cast:
+		return t.cast(n.Expr, n.Type)
+	case FunctionCall:
+		return t.function(n)
+	case Binary:
+		return t.binary(n)
+	}
+	return typedExpr{}, fmt.Errorf("unsupported expression %T", node)
+}
+
+// wildcardToLike converts ES|QL LIKE pattern (with * and ? wildcards) into SQL LIKE pattern
+func wildcardToLike(pattern string) string {
+	var sb strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			sb.WriteRune('%')
+		case r == '?':
+			sb.WriteRune('_')
+		case r == '%' || r == '_':
+			sb.WriteString(`\` + string(r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+var comparisonClickhouseOperators = map[string]string{"==": "=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (t *exprTranslator) binary(n Binary) (typedExpr, error) {
+	left, err := t.translate(n.Left)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	right, err := t.translate(n.Right)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	switch n.Op {
+	case "AND":
+		return typedExpr{model.And([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	case "OR":
+		return typedExpr{model.Or([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	}
+	if op, ok := comparisonClickhouseOperators[n.Op]; ok {
+		return typedExpr{model.NewInfixExpr(left.expr, op, right.expr), typeBoolean}, nil
+	}
+
+	// date arithmetic, e.g. @timestamp - 1 hour
+	if left.esqlType == typeDate || right.esqlType == typeDatePeriod {
+		return typedExpr{model.NewParenExpr(model.NewInfixExpr(left.expr, n.Op, right.expr)), typeDate}, nil
+	}
+
+	resultType := typeInteger
+	switch {
+	case left.esqlType == typeDouble || right.esqlType == typeDouble:
+		resultType = typeDouble
+	case left.esqlType == typeLong || right.esqlType == typeLong:
+		resultType = typeLong
+	}
+	op := n.Op
+	if op == "/" && resultType != typeDouble {
+		// integer division, like in Elasticsearch
+		return typedExpr{model.NewFunction("intDiv", left.expr, right.expr), resultType}, nil
+	}
+	return typedExpr{model.NewParenExpr(model.NewInfixExpr(left.expr, op, right.expr)), resultType}, nil
+}
+
+type conversion struct {
+	fromString    string // function converting strings
+	fromNonString string // function converting other types
+	esqlType      string
+}
+
+// conversions are used both by TO_* functions and `::` casts
+var conversions = map[string]conversion{
+	"integer":  {"toInt32OrNull", "toInt32", typeInteger},
+	"int":      {"toInt32OrNull", "toInt32", typeInteger},
+	"long":     {"toInt64OrNull", "toInt64", typeLong},
+	"double":   {"toFloat64OrNull", "toFloat64", typeDouble},
+	"keyword":  {"toString", "toString", typeKeyword},
+	"string":   {"toString", "toString", typeKeyword},
+	"text":     {"toString", "toString", typeKeyword},
+	"boolean":  {"toBool", "toBool", typeBoolean},
+	"bool":     {"toBool", "toBool", typeBoolean},
+	"datetime": {"parseDateTime64BestEffortOrNull", "fromUnixTimestamp64Milli", typeDate}, // numbers are milliseconds since epoch
+	"date":     {"parseDateTime64BestEffortOrNull", "fromUnixTimestamp64Milli", typeDate},
+	"ip":       {"toIPv6OrNull", "toIPv6", typeIp},
+}
+
+var conversionFunctions = map[string]string{
+	"TO_INTEGER": "integer", "TO_INT": "integer", "TO_LONG": "long", "TO_DOUBLE": "double", "TO_DBL": "double",
+	"TO_STRING": "keyword", "TO_STR": "keyword", "TO_BOOLEAN": "boolean", "TO_BOOL": "boolean",
+	"TO_DATETIME": "datetime", "TO_DT": "datetime", "TO_IP": "ip",
+}
+
+func (t *exprTranslator) cast(node Node, typeName string) (typedExpr, error) {
+	target, ok := conversions[typeName]
+	if !ok {
+		return typedExpr{}, fmt.Errorf("unsupported conversion to [%s]", typeName)
+	}
+	expr, err := t.translate(node)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	switch {
+	case expr.esqlType == target.esqlType:
+		return expr, nil
+	case isStringType(expr.esqlType):
+		return typedExpr{model.NewFunction(target.fromString, expr.expr), target.esqlType}, nil
+	case target.esqlType == typeDate:
+		return typedExpr{model.NewFunction(target.fromNonString, model.NewFunction("toInt64", expr.expr)), target.esqlType}, nil
+	default:
+		return typedExpr{model.NewFunction(target.fromNonString, expr.expr), target.esqlType}, nil
+	}
+}
+
+type scalarFunction struct {
+	clickhouseName   string
+	minArgs, maxArgs int
+	esqlType         string // empty <=> same as the first argument
+}
+
+var scalarFunctions = map[string]scalarFunction{
+	"ABS":         {"abs", 1, 1, ""},
+	"CEIL":        {"ceil", 1, 1, ""},
+	"FLOOR":       {"floor", 1, 1, ""},
+	"ROUND":       {"round", 1, 2, ""},
+	"SIGNUM":      {"sign", 1, 1, typeDouble},
+	"SQRT":        {"sqrt", 1, 1, typeDouble},
+	"CBRT":        {"cbrt", 1, 1, typeDouble},
+	"POW":         {"pow", 2, 2, typeDouble},
+	"EXP":         {"exp", 1, 1, typeDouble},
+	"LOG10":       {"log10", 1, 1, typeDouble},
+	"PI":          {"pi", 0, 0, typeDouble},
+	"E":           {"e", 0, 0, typeDouble},
+	"LENGTH":      {"lengthUTF8", 1, 1, typeInteger},
+	"TO_UPPER":    {"upperUTF8", 1, 1, typeKeyword},
+	"TO_LOWER":    {"lowerUTF8", 1, 1, typeKeyword},
+	"TRIM":        {"trimBoth", 1, 1, typeKeyword},
+	"LTRIM":       {"trimLeft", 1, 1, typeKeyword},
+	"RTRIM":       {"trimRight", 1, 1, typeKeyword},
+	"CONCAT":      {"concat", 2, -1, typeKeyword},
+	"SUBSTRING":   {"substringUTF8", 2, 3, typeKeyword},
+	"LEFT":        {"leftUTF8", 2, 2, typeKeyword},
+	"RIGHT":       {"rightUTF8", 2, 2, typeKeyword},
+	"REVERSE":     {"reverseUTF8", 1, 1, typeKeyword},
+	"REPLACE":     {"replaceRegexpAll", 3, 3, typeKeyword},
+	"STARTS_WITH": {"startsWith", 2, 2, typeBoolean},
+	"ENDS_WITH":   {"endsWith", 2, 2, typeBoolean},
+	"LOCATE":      {"positionUTF8", 2, 3, typeInteger},
+	"COALESCE":    {"coalesce", 1, -1, ""},
+	"GREATEST":    {"greatest", 1, -1, ""},
+	"LEAST":       {"least", 1, -1, ""},
+	"NOW":         {"now64", 0, 0, typeDate},
+}
+
+func (t *exprTranslator) function(call FunctionCall) (typedExpr, error) {
+	if _, ok := aggregateFunctions[call.Name]; ok {
+		if !t.allowAggregates {
+			return typedExpr{}, fmt.Errorf("aggregate function [%s] is allowed only in STATS", call.Name)
+		}
+		return t.aggregate(call)
+	}
+	if typeName, ok := conversionFunctions[call.Name]; ok {
+		if len(call.Args) != 1 {
+			return typedExpr{}, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+		}
+		return t.cast(call.Args[0], typeName)
+	}
+
+	switch call.Name {
+	case "CASE":
+		// CASE(condition1, value1, condition2, value2, ..., [else_value])
+		if len(call.Args) < 2 {
+			return typedExpr{}, fmt.Errorf("CASE requires at least 2 arguments, got %d", len(call.Args))
+		}
+		args, types, err := t.translateAll(call.Args)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if len(args)%2 == 0 {
+			args = append(args, model.NullExpr)
+		}
+		return typedExpr{model.NewFunction("multiIf", args...), types[1]}, nil
+	case "DATE_TRUNC":
+		// DATE_TRUNC(1 hour, @timestamp)
+		if len(call.Args) != 2 {
+			return typedExpr{}, fmt.Errorf("DATE_TRUNC requires 2 arguments, got %d", len(call.Args))
+		}
+		span, ok := call.Args[0].(TimeSpan)
+		if !ok {
+			return typedExpr{}, fmt.Errorf("first argument of DATE_TRUNC must be a time span, e.g. 1 hour")
+		}
+		date, err := t.translate(call.Args[1])
+		if err != nil {
+			return typedExpr{}, err
+		}
+		return typedExpr{model.NewFunction("toStartOfInterval", date.expr, interval(span)), typeDate}, nil
+	case "BUCKET", "BIN":
+		return t.bucket(call)
+	case "DATE_EXTRACT":
+		return t.dateExtract(call)
+	}
+
+	function, ok := scalarFunctions[call.Name]
+	if !ok {
+		return typedExpr{}, fmt.Errorf("Unknown function [%s]", call.Name)
+	}
+	if len(call.Args) < function.minArgs || (function.maxArgs >= 0 && len(call.Args) > function.maxArgs) {
+		return typedExpr{}, fmt.Errorf("wrong number of arguments for function %s: %d", call.Name, len(call.Args))
+	}
+	args, types, err := t.translateAll(call.Args)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	resultType := function.esqlType
+	if resultType == "" && len(types) > 0 {
+		resultType = types[0]
+	}
+	return typedExpr{model.NewFunction(function.clickhouseName, args...), resultType}, nil
+}
+
+// bucket translates BUCKET(field, span), with numeric or time span.
+// Variant with the number of buckets and range, e.g. BUCKET(@timestamp, 20, "2023-01-01", "2023-02-01"), isn't supported.
+func (t *exprTranslator) bucket(call FunctionCall) (typedExpr, error) {
+	if len(call.Args) != 2 {
+		return typedExpr{}, fmt.Errorf("only BUCKET(field, span) variant of %s is supported", call.Name)
+	}
+	field, err := t.translate(call.Args[0])
+	if err != nil {
+		return typedExpr{}, err
+	}
+	if span, ok := call.Args[1].(TimeSpan); ok {
+		return typedExpr{model.NewFunction("toStartOfInterval", field.expr, interval(span)), typeDate}, nil
+	}
+	span, err := t.translate(call.Args[1])
+	if err != nil {
+		return typedExpr{}, err
+	}
+	if !isNumericType(field.esqlType) || !isNumericType(span.esqlType) {
+		return typedExpr{}, fmt.Errorf("%s requires a numeric field and span, or a date field and time span", call.Name)
+	}
+	bucket := model.NewInfixExpr(model.NewFunction("floor", model.NewInfixExpr(field.expr, "/", span.expr)), "*", span.expr)
+	return typedExpr{bucket, typeDouble}, nil
+}
+
+var dateParts = map[string]string{
+	"year": "toYear", "month_of_year": "toMonth", "day_of_month": "toDayOfMonth", "day_of_week": "toDayOfWeek",
+	"day_of_year": "toDayOfYear", "hour_of_day": "toHour", "minute_of_hour": "toMinute", "second_of_minute": "toSecond",
+}
+
+// dateExtract translates DATE_EXTRACT("hour_of_day", @timestamp)
+func (t *exprTranslator) dateExtract(call FunctionCall) (typedExpr, error) {
+	if len(call.Args) != 2 {
+		return typedExpr{}, fmt.Errorf("DATE_EXTRACT requires 2 arguments, got %d", len(call.Args))
+	}
+	part, ok := call.Args[0].(Literal)
+	if !ok {
+		return typedExpr{}, fmt.Errorf("first argument of DATE_EXTRACT must be a string")
+	}
+	partName, _ := part.Value.(string)
+	function, ok := dateParts[strings.ToLower(partName)]
+	if !ok {
+		return typedExpr{}, fmt.Errorf("unsupported date part [%v]", part.Value)
+	}
+	date, err := t.translate(call.Args[1])
+	if err != nil {
+		return typedExpr{}, err
+	}
+	return typedExpr{model.NewFunction(function, date.expr), typeLong}, nil
+}
+
+var aggregateFunctions = map[string]string{
+	"COUNT":          "count",
+	"COUNT_DISTINCT": "uniq",
+	"SUM":            "sum",
+	"AVG":            "avg",
+	"MIN":            "min",
+	"MAX":            "max",
+	"MEDIAN":         "quantile(0.5)",
+	"PERCENTILE":     "quantile",
+	"STD_DEV":        "stddevPop",
+	"VALUES":         "groupUniqArray",
+}
+
+func (t *exprTranslator) aggregate(call FunctionCall) (typedExpr, error) {
+	if call.Name == "COUNT" && (len(call.Args) == 0 || call.Args[0] == Star{}) {
+		return typedExpr{model.NewCountFunc(), typeLong}, nil
+	}
+	if len(call.Args) == 0 {
+		return typedExpr{}, fmt.Errorf("wrong number of arguments for function %s: 0", call.Name)
+	}
+
+	// nested aggregations aren't allowed
+	t.allowAggregates = false
+	defer func() { t.allowAggregates = true }()
+
+	arg, err := t.translate(call.Args[0])
+	if err != nil {
+		return typedExpr{}, err
+	}
+	clickhouseName := aggregateFunctions[call.Name]
+	switch call.Name {
+	case "COUNT", "COUNT_DISTINCT":
+		// COUNT_DISTINCT(field, precision) is approximate in Elasticsearch too
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), typeLong}, nil
+	case "MIN", "MAX", "VALUES":
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), arg.esqlType}, nil
+	case "SUM":
+		resultType := typeDouble
+		if arg.esqlType == typeLong || arg.esqlType == typeInteger {
+			resultType = typeLong
+		}
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), resultType}, nil
+	case "PERCENTILE":
+		if len(call.Args) != 2 {
+			return typedExpr{}, fmt.Errorf("PERCENTILE requires 2 arguments, got %d", len(call.Args))
+		}
+		percentile, ok := call.Args[1].(Literal)
+		if !ok {
+			return typedExpr{}, fmt.Errorf("second argument of PERCENTILE must be a number")
+		}
+		var percent float64
+		switch v := percentile.Value.(type) {
+		case int64:
+			percent = float64(v)
+		case float64:
+			percent = v
+		default:
+			return typedExpr{}, fmt.Errorf("second argument of PERCENTILE must be a number")
+		}
+		// Rare function that has two brackets: quantile(0.5)(x)
+		return typedExpr{model.NewFunction(fmt.Sprintf("quantile(%v)", percent/100), arg.expr), typeDouble}, nil
+	default:
+		return typedExpr{model.NewFunction(clickhouseName, arg.expr), typeDouble}, nil
+	}
+}
+
+// containsAggregate tells whether the expression uses an aggregate function
+func containsAggregate(node Node) bool {
+	switch n := node.(type) {
+	case FunctionCall:
+		if _, ok := aggregateFunctions[n.Name]; ok {
+			return true
+		}
+		for _, arg := range n.Args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case Binary:
+		return containsAggregate(n.Left) || containsAggregate(n.Right)
+	case Unary:
+		return containsAggregate(n.Expr)
+	case Cast:
+		return containsAggregate(n.Expr)
+	case In:
+		return containsAggregate(n.Expr)
+	case Like:
+		return containsAggregate(n.Expr)
+	case IsNull:
+		return containsAggregate(n.Expr)
+	}
+	return false
+}
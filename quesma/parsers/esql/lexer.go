@@ -0,0 +1,218 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent // `escaped identifier`
+	tokenString
+	tokenNumber
+	tokenParam // ?, ?1, ?name
+	tokenOperator
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // for tokenString and tokenQuotedIdent it's already unescaped value
+	pos   int    // position of the first rune
+	end   int    // position right after the last rune
+	lower string // lowercase text of identifiers, used for keyword lookup
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	if t.kind != kind {
+		return false
+	}
+	if kind == tokenIdent {
+		return t.lower == text
+	}
+	return t.text == text
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.is(tokenIdent, keyword)
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// operators sorted by length, so that the longest one is matched first
+var operators = []string{
+	"::", "==", "!=", "<=", ">=", "=~", "<", ">", "+", "-", "*", "/", "%", "=",
+}
+
+var punctuation = "()[],|."
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated comment at position %d", i)
+			}
+			i += 2 + len([]rune(string(runes[i+2:])[:end])) + 2
+		case r == '"':
+			value, next, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: i, end: next})
+			i = next
+		case r == '`':
+			var sb strings.Builder
+			end := i + 1
+			for ; end < len(runes); end++ {
+				if runes[end] == '`' {
+					// `` is an escaped backquote
+					if end+1 < len(runes) && runes[end+1] == '`' {
+						sb.WriteRune('`')
+						end++
+						continue
+					}
+					break
+				}
+				sb.WriteRune(runes[end])
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted identifier at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: sb.String(), pos: i, end: end + 1})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) && !followsIdent(tokens, i)):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// exponent, e.g. 1e10, 1.5E-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					i = j
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start, end: i})
+		case r == '?':
+			start := i
+			i++
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: string(runes[start:i]), pos: start, end: i})
+		case isIdentStart(r):
+			start := i
+			i++
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenIdent, text: text, pos: start, end: i, lower: strings.ToLower(text)})
+		case strings.ContainsRune(punctuation, r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: i, end: i + 1})
+			i++
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					end := i + len([]rune(op))
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i, end: end})
+					i = end
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes), end: len(runes)})
+	return tokens, nil
+}
+
+// followsIdent tells whether position i directly follows an identifier (so `.` is a part of a field name, not of a number)
+func followsIdent(tokens []token, i int) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.end == i && (last.kind == tokenIdent || last.kind == tokenQuotedIdent)
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@'
+}
+
+func isIdentPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@'
+}
+
+// readString reads both regular ("...") and triple-quoted ("""...""") strings, starting at position start.
+// It returns unescaped value and the position right after the closing quote.
+func readString(runes []rune, start int) (value string, next int, err error) {
+	if start+2 < len(runes) && runes[start+1] == '"' && runes[start+2] == '"' {
+		rest := string(runes[start+3:])
+		end := strings.Index(rest, `"""`)
+		if end == -1 {
+			return "", 0, fmt.Errorf("unterminated string at position %d", start)
+		}
+		raw := rest[:end]
+		return raw, start + 3 + len([]rune(raw)) + 3, nil
+	}
+
+	var sb strings.Builder
+	i := start + 1
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == '"':
+			return sb.String(), i + 1, nil
+		case r == '\\' && i+1 < len(runes):
+			i++
+			switch runes[i] {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			default:
+				sb.WriteRune(runes[i])
+			}
+		default:
+			sb.WriteRune(r)
+		}
+		i++
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
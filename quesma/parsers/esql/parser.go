@@ -0,0 +1,774 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse parses ES|QL query into its AST. Query parameters (`?`, `?1`, `?name`) are substituted with params.
+// params are either positional values, or single-key objects for named parameters, e.g. [{"name": "value"}].
+func Parse(input string, params []any) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: []rune(input), tokens: tokens, params: params}
+	query, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is(tokenEOF, "") {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return query, nil
+}
+
+type parser struct {
+	input  []rune
+	tokens []token
+	pos    int
+
+	params          []any
+	nextParamNumber int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line 1:%d: %s", p.peek().pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.peek().is(kind, text) {
+		return p.errorf("expected '%s', got %s", text, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.peek().isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) isCommandEnd() bool {
+	t := p.peek()
+	return t.kind == tokenEOF || t.is(tokenPunct, "|")
+}
+
+// sourceText returns the original text of tokens from token number `from` to the current position
+func (p *parser) sourceText(from int) string {
+	if from >= p.pos {
+		return ""
+	}
+	return strings.TrimSpace(string(p.input[p.tokens[from].pos:p.tokens[p.pos-1].end]))
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	if !p.acceptKeyword("from") {
+		if p.peek().kind == tokenIdent {
+			return nil, p.errorf("source command [%s] is not supported, only FROM is", p.peek().text)
+		}
+		return nil, p.errorf("expected FROM, got %s", p.peek())
+	}
+
+	query := &Query{}
+	for {
+		index, err := p.parseAdjacentText()
+		if err != nil {
+			return nil, err
+		}
+		query.Indexes = append(query.Indexes, index)
+		if !p.peek().is(tokenPunct, ",") {
+			break
+		}
+		p.next()
+	}
+	if p.acceptKeyword("metadata") {
+		for {
+			name, err := p.parseAdjacentText()
+			if err != nil {
+				return nil, err
+			}
+			query.Metadata = append(query.Metadata, name)
+			if !p.peek().is(tokenPunct, ",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	for p.peek().is(tokenPunct, "|") {
+		p.next()
+		command, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		query.Commands = append(query.Commands, command)
+	}
+	return query, nil
+}
+
+// parseAdjacentText parses index patterns and KEEP/DROP patterns, e.g. `logs-*`, `host.*`,
+// which are made of several tokens not separated by whitespace.
+func (p *parser) parseAdjacentText() (string, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenString, tokenQuotedIdent:
+		p.next()
+		return t.text, nil
+	case tokenEOF:
+		return "", p.errorf("expected a name, got %s", t)
+	}
+
+	var sb strings.Builder
+	end := -1
+	for {
+		t = p.peek()
+		if t.kind == tokenEOF || (end != -1 && t.pos != end) || t.is(tokenPunct, ",") || t.is(tokenPunct, "|") {
+			break
+		}
+		switch t.kind {
+		case tokenIdent, tokenNumber, tokenOperator, tokenPunct:
+			sb.WriteString(t.text)
+		case tokenQuotedIdent:
+			sb.WriteString(t.text)
+		default:
+			return "", p.errorf("unexpected %s", t)
+		}
+		end = t.end
+		p.next()
+	}
+	if sb.Len() == 0 {
+		return "", p.errorf("expected a name, got %s", p.peek())
+	}
+	return sb.String(), nil
+}
+
+func (p *parser) parseCommand() (Command, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, p.errorf("expected a command, got %s", t)
+	}
+	switch t.lower {
+	case "where":
+		condition, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return Where{Condition: condition}, nil
+	case "eval":
+		assignments, err := p.parseAssignments()
+		if err != nil {
+			return nil, err
+		}
+		return Eval{Assignments: assignments}, nil
+	case "stats":
+		stats := Stats{}
+		var err error
+		if !p.peek().isKeyword("by") && !p.isCommandEnd() {
+			if stats.Aggregations, err = p.parseAssignments(); err != nil {
+				return nil, err
+			}
+		}
+		if p.acceptKeyword("by") {
+			if stats.By, err = p.parseAssignments(); err != nil {
+				return nil, err
+			}
+		}
+		if len(stats.Aggregations) == 0 && len(stats.By) == 0 {
+			return nil, p.errorf("at least one aggregation or grouping expression required in STATS")
+		}
+		return stats, nil
+	case "sort":
+		return p.parseSort()
+	case "limit":
+		count := p.next()
+		if count.kind != tokenNumber {
+			return nil, p.errorf("expected a number after LIMIT, got %s", count)
+		}
+		value, err := strconv.Atoi(count.text)
+		if err != nil || value < 0 {
+			return nil, p.errorf("invalid LIMIT [%s]", count.text)
+		}
+		return Limit{Count: value}, nil
+	case "keep", "drop":
+		var patterns []string
+		for {
+			pattern, err := p.parseAdjacentText()
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, pattern)
+			if !p.peek().is(tokenPunct, ",") {
+				break
+			}
+			p.next()
+		}
+		if t.lower == "keep" {
+			return Keep{Patterns: patterns}, nil
+		}
+		return Drop{Patterns: patterns}, nil
+	case "rename":
+		return p.parseRename()
+	case "dissect", "grok":
+		input, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return nil, p.errorf("expected a pattern string, got %s", pattern)
+		}
+		if t.lower == "grok" {
+			return Grok{Input: input, Pattern: pattern.text}, nil
+		}
+		dissect := Dissect{Input: input, Pattern: pattern.text}
+		if p.peek().kind == tokenIdent && p.peek().lower == "append_separator" {
+			p.next()
+			if err = p.expect(tokenOperator, "="); err != nil {
+				return nil, err
+			}
+			separator := p.next()
+			if separator.kind != tokenString {
+				return nil, p.errorf("expected a string, got %s", separator)
+			}
+			dissect.AppendSeparator = separator.text
+		}
+		return dissect, nil
+	}
+	return nil, fmt.Errorf("line 1:%d: command [%s] is not supported", t.pos+1, strings.ToUpper(t.text))
+}
+
+func (p *parser) parseAssignments() ([]Assignment, error) {
+	var assignments []Assignment
+	for {
+		assignment, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+		if !p.peek().is(tokenPunct, ",") {
+			return assignments, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseAssignment() (Assignment, error) {
+	start := p.pos
+	if p.peek().kind == tokenIdent || p.peek().kind == tokenQuotedIdent {
+		name, err := p.parseQualifiedName()
+		if err != nil {
+			return Assignment{}, err
+		}
+		if p.peek().is(tokenOperator, "=") {
+			p.next()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return Assignment{}, err
+			}
+			return Assignment{Name: name, Expr: expr}, nil
+		}
+		p.pos = start
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return Assignment{}, err
+	}
+	return Assignment{Name: p.sourceText(start), Expr: expr}, nil
+}
+
+func (p *parser) parseSort() (Command, error) {
+	var sort Sort
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := SortItem{Expr: expr}
+		if p.acceptKeyword("desc") {
+			item.Desc = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+		// by default nulls are last for ascending order, and first for descending one
+		item.NullsFirst = item.Desc
+		if p.acceptKeyword("nulls") {
+			switch {
+			case p.acceptKeyword("first"):
+				item.NullsFirst = true
+			case p.acceptKeyword("last"):
+				item.NullsFirst = false
+			default:
+				return nil, p.errorf("expected FIRST or LAST, got %s", p.peek())
+			}
+		}
+		sort.Items = append(sort.Items, item)
+		if !p.peek().is(tokenPunct, ",") {
+			return sort, nil
+		}
+		p.next()
+	}
+}
+
+// parseRename parses both `old AS new` and `new = old` forms
+func (p *parser) parseRename() (Command, error) {
+	var rename Rename
+	for {
+		first, err := p.parseQualifiedName()
+		if err != nil {
+			return nil, err
+		}
+		var item RenameItem
+		switch {
+		case p.acceptKeyword("as"):
+			second, err := p.parseQualifiedName()
+			if err != nil {
+				return nil, err
+			}
+			item = RenameItem{From: first, To: second}
+		case p.peek().is(tokenOperator, "="):
+			p.next()
+			second, err := p.parseQualifiedName()
+			if err != nil {
+				return nil, err
+			}
+			item = RenameItem{From: second, To: first}
+		default:
+			return nil, p.errorf("expected AS, got %s", p.peek())
+		}
+		rename.Renames = append(rename.Renames, item)
+		if !p.peek().is(tokenPunct, ",") {
+			return rename, nil
+		}
+		p.next()
+	}
+}
+
+// parseQualifiedName parses field names, e.g. `host.name`, `@timestamp`, `host.`name with spaces“
+func (p *parser) parseQualifiedName() (string, error) {
+	var parts []string
+	for {
+		t := p.peek()
+		switch t.kind {
+		case tokenIdent, tokenQuotedIdent:
+			parts = append(parts, t.text)
+			p.next()
+		case tokenNumber:
+			// e.g. `field.1`
+			if len(parts) == 0 {
+				return "", p.errorf("expected a field name, got %s", t)
+			}
+			parts = append(parts, t.text)
+			p.next()
+		default:
+			return "", p.errorf("expected a field name, got %s", t)
+		}
+		dot := p.peek()
+		if !dot.is(tokenPunct, ".") || dot.pos != p.tokens[p.pos-1].end {
+			return strings.Join(parts, "."), nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.acceptKeyword("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) parsePredicate() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind == tokenOperator && comparisonOperators[t.text] {
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return Binary{Op: t.text, Left: left, Right: right}, nil
+	}
+
+	if p.acceptKeyword("is") {
+		negated := p.acceptKeyword("not")
+		if !p.acceptKeyword("null") {
+			return nil, p.errorf("expected NULL, got %s", p.peek())
+		}
+		return IsNull{Expr: left, Negated: negated}, nil
+	}
+
+	negated := false
+	if p.peek().isKeyword("not") && (p.peekAt(1).isKeyword("like") || p.peekAt(1).isKeyword("rlike") || p.peekAt(1).isKeyword("in")) {
+		p.next()
+		negated = true
+	}
+	switch {
+	case p.peek().isKeyword("like"), p.peek().isKeyword("rlike"):
+		regex := p.next().lower == "rlike"
+		pattern, err := p.parseStringValue()
+		if err != nil {
+			return nil, err
+		}
+		return Like{Expr: left, Pattern: pattern, Regex: regex, Negated: negated}, nil
+	case p.acceptKeyword("in"):
+		if err := p.expect(tokenPunct, "("); err != nil {
+			return nil, err
+		}
+		var values []Node
+		for {
+			value, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if !p.peek().is(tokenPunct, ",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(tokenPunct, ")"); err != nil {
+			return nil, err
+		}
+		return In{Expr: left, Values: values, Negated: negated}, nil
+	}
+	return left, nil
+}
+
+// parseStringValue parses a string literal or a parameter with string value
+func (p *parser) parseStringValue() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenParam:
+		value, err := p.paramValue(t)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	}
+	return "", p.errorf("expected a string, got %s", t)
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOperator, "+") || p.peek().is(tokenOperator, "-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOperator, "*") || p.peek().is(tokenOperator, "/") || p.peek().is(tokenOperator, "%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().is(tokenOperator, "-") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch lit := expr.(type) {
+		case Literal:
+			switch v := lit.Value.(type) {
+			case int64:
+				return Literal{Value: -v}, nil
+			case float64:
+				return Literal{Value: -v}, nil
+			}
+		case TimeSpan:
+			return TimeSpan{Duration: -lit.Duration, Unit: lit.Unit, Count: -lit.Count}, nil
+		}
+		return Unary{Op: "-", Expr: expr}, nil
+	}
+	if p.peek().is(tokenOperator, "+") {
+		p.next()
+		return p.parseUnary()
+	}
+	return p.parseCast()
+}
+
+func (p *parser) parseCast() (Node, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOperator, "::") {
+		p.next()
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, p.errorf("expected a type, got %s", t)
+		}
+		expr = Cast{Expr: expr, Type: t.lower}
+	}
+	return expr, nil
+}
+
+// timeUnits maps all spellings of time units to the normalized unit and its (approximate) duration
+var timeUnits = map[string]struct {
+	unit     string
+	duration time.Duration
+}{}
+
+func init() {
+	for _, unit := range []struct {
+		names    []string
+		duration time.Duration
+	}{
+		{[]string{"millisecond", "milliseconds", "ms"}, time.Millisecond},
+		{[]string{"second", "seconds", "sec", "s"}, time.Second},
+		{[]string{"minute", "minutes", "min"}, time.Minute},
+		{[]string{"hour", "hours", "h"}, time.Hour},
+		{[]string{"day", "days", "d"}, 24 * time.Hour},
+		{[]string{"week", "weeks", "w"}, 7 * 24 * time.Hour},
+		{[]string{"month", "months", "mo"}, 30 * 24 * time.Hour},
+		{[]string{"quarter", "quarters", "q"}, 91 * 24 * time.Hour},
+		{[]string{"year", "years", "yr", "y"}, 365 * 24 * time.Hour},
+	} {
+		for _, name := range unit.names {
+			timeUnits[name] = struct {
+				unit     string
+				duration time.Duration
+			}{unit.names[0], unit.duration}
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		if !strings.ContainsAny(t.text, ".eE") {
+			value, err := strconv.ParseInt(t.text, 10, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number [%s]", t.text)
+			}
+			if unit, ok := timeUnits[p.peek().lower]; ok && p.peek().kind == tokenIdent {
+				p.next()
+				return TimeSpan{Duration: time.Duration(value) * unit.duration, Unit: unit.unit, Count: value}, nil
+			}
+			return Literal{Value: value}, nil
+		}
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number [%s]", t.text)
+		}
+		return Literal{Value: value}, nil
+	case tokenString:
+		p.next()
+		return Literal{Value: t.text}, nil
+	case tokenParam:
+		p.next()
+		value, err := p.paramValue(t)
+		if err != nil {
+			return nil, err
+		}
+		return Literal{Value: value}, nil
+	case tokenPunct:
+		if t.text == "(" {
+			p.next()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokenPunct, ")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	case tokenIdent:
+		switch t.lower {
+		case "null":
+			p.next()
+			return Literal{Value: nil}, nil
+		case "true", "false":
+			p.next()
+			return Literal{Value: t.lower == "true"}, nil
+		}
+		if p.peekAt(1).is(tokenPunct, "(") {
+			return p.parseFunctionCall()
+		}
+		name, err := p.parseQualifiedName()
+		if err != nil {
+			return nil, err
+		}
+		return Field{Name: name}, nil
+	case tokenQuotedIdent:
+		name, err := p.parseQualifiedName()
+		if err != nil {
+			return nil, err
+		}
+		return Field{Name: name}, nil
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
+
+func (p *parser) parseFunctionCall() (Node, error) {
+	name := strings.ToUpper(p.next().text)
+	p.next() // (
+	call := FunctionCall{Name: name}
+	if p.peek().is(tokenOperator, "*") && p.peekAt(1).is(tokenPunct, ")") {
+		p.next()
+		call.Args = []Node{Star{}}
+	} else if !p.peek().is(tokenPunct, ")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.peek().is(tokenPunct, ",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(tokenPunct, ")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// paramValue returns value of `?` (next positional parameter), `?1` (1-based positional parameter) or `?name` parameter
+func (p *parser) paramValue(t token) (any, error) {
+	name := strings.TrimPrefix(t.text, "?")
+	var raw any
+	switch {
+	case name == "":
+		if p.nextParamNumber >= len(p.params) {
+			return nil, fmt.Errorf("line 1:%d: not enough actual parameters %d", t.pos+1, len(p.params))
+		}
+		raw = p.params[p.nextParamNumber]
+		p.nextParamNumber++
+	default:
+		if number, err := strconv.Atoi(name); err == nil {
+			if number < 1 || number > len(p.params) {
+				return nil, fmt.Errorf("line 1:%d: no parameter is defined for position %d", t.pos+1, number)
+			}
+			raw = p.params[number-1]
+		} else {
+			found := false
+			for _, param := range p.params {
+				if named, ok := param.(map[string]any); ok {
+					if value, ok := named[name]; ok {
+						raw, found = value, true
+						break
+					}
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("line 1:%d: unknown query parameter [%s]", t.pos+1, name)
+			}
+		}
+	}
+	// positional parameters may be single-key objects too
+	if named, ok := raw.(map[string]any); ok && len(named) == 1 {
+		for _, value := range named {
+			raw = value
+		}
+	}
+	return normalizeParam(raw), nil
+}
+
+// normalizeParam converts JSON numbers which are integers into int64
+func normalizeParam(value any) any {
+	if f, ok := value.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return value
+}
@@ -0,0 +1,81 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	query, err := Parse(`FROM logs-*, "metrics" METADATA _index
+		| WHERE host.name == "a" AND NOT status IN (200, 201) // comment
+		| EVAL duration = `+"`event.duration`"+` / 1000, status + 1
+		| STATS count = COUNT(*), AVG(duration) BY BUCKET(@timestamp, 1 hour)
+		| SORT count DESC NULLS LAST, @timestamp
+		| RENAME count AS c
+		| LIMIT 10`, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"logs-*", "metrics"}, query.Indexes)
+	assert.Equal(t, []string{"_index"}, query.Metadata)
+	assert.Equal(t, []Command{
+		Where{Condition: Binary{
+			Op:    "AND",
+			Left:  Binary{Op: "==", Left: Field{Name: "host.name"}, Right: Literal{Value: "a"}},
+			Right: Unary{Op: "NOT", Expr: In{Expr: Field{Name: "status"}, Values: []Node{Literal{Value: int64(200)}, Literal{Value: int64(201)}}}},
+		}},
+		Eval{Assignments: []Assignment{
+			{Name: "duration", Expr: Binary{Op: "/", Left: Field{Name: "event.duration"}, Right: Literal{Value: int64(1000)}}},
+			{Name: "status + 1", Expr: Binary{Op: "+", Left: Field{Name: "status"}, Right: Literal{Value: int64(1)}}},
+		}},
+		Stats{
+			Aggregations: []Assignment{
+				{Name: "count", Expr: FunctionCall{Name: "COUNT", Args: []Node{Star{}}}},
+				{Name: "AVG(duration)", Expr: FunctionCall{Name: "AVG", Args: []Node{Field{Name: "duration"}}}},
+			},
+			By: []Assignment{{Name: "BUCKET(@timestamp, 1 hour)", Expr: FunctionCall{Name: "BUCKET", Args: []Node{
+				Field{Name: "@timestamp"}, TimeSpan{Duration: time.Hour, Unit: "hour", Count: 1},
+			}}}},
+		},
+		Sort{Items: []SortItem{{Expr: Field{Name: "count"}, Desc: true}, {Expr: Field{Name: "@timestamp"}}}},
+		Rename{Renames: []RenameItem{{From: "count", To: "c"}}},
+		Limit{Count: 10},
+	}, query.Commands)
+}
+
+func TestParseParams(t *testing.T) {
+	query, err := Parse(`FROM logs | WHERE status > ? AND host.name == ?host AND message LIKE ?2`,
+		[]any{float64(200), "*error*", map[string]any{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []Command{Where{Condition: Binary{
+		Op: "AND",
+		Left: Binary{
+			Op:    "AND",
+			Left:  Binary{Op: ">", Left: Field{Name: "status"}, Right: Literal{Value: int64(200)}},
+			Right: Binary{Op: "==", Left: Field{Name: "host.name"}, Right: Literal{Value: "a"}},
+		},
+		Right: Like{Expr: Field{Name: "message"}, Pattern: "*error*"},
+	}}}, query.Commands)
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		query         string
+		expectedError string
+	}{
+		{`ROW a = 1`, "source command [ROW] is not supported"},
+		{`FROM logs | MV_EXPAND tags`, "command [MV_EXPAND] is not supported"},
+		{`FROM logs | LIMIT x`, "expected a number after LIMIT"},
+		{`FROM logs | WHERE a == ?`, "not enough actual parameters"},
+		{`FROM logs | WHERE a == "unterminated`, "unterminated string"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := Parse(tc.query, nil)
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
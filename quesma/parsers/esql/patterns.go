@@ -0,0 +1,221 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/util/grok"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DISSECT and GROK are translated into regular expressions, evaluated by ClickHouse.
+// For each extracted key we build a separate regular expression, in which only this key is a capturing group,
+// as ClickHouse's `extract` returns the first capturing group only.
+
+// extractedKey is a key extracted by DISSECT or GROK, possibly from several places of the input (DISSECT's %{+key})
+type extractedKey struct {
+	name        string
+	regexes     []string // one per occurrence of the key
+	convertWith string   // GROK's type conversion function, e.g. toInt32OrNull
+	esqlType    string
+}
+
+type patternPart struct {
+	literal   string // literal text, if key is empty
+	key       string
+	skip      bool // %{?key} or %{}
+	appendKey bool // %{+key}
+	padding   bool // %{key->}
+}
+
+var dissectKeyRegex = regexp.MustCompile(`%\{([^}]*)\}`)
+
+func parseDissectPattern(pattern string) ([]patternPart, error) {
+	var parts []patternPart
+	last := 0
+	for _, match := range dissectKeyRegex.FindAllStringSubmatchIndex(pattern, -1) {
+		if match[0] > last {
+			parts = append(parts, patternPart{literal: pattern[last:match[0]]})
+		} else if len(parts) > 0 && parts[len(parts)-1].literal == "" {
+			return nil, fmt.Errorf("invalid dissect pattern [%s]: keys have to be separated", pattern)
+		}
+		last = match[1]
+
+		part := patternPart{key: pattern[match[2]:match[3]]}
+		if strings.HasSuffix(part.key, "->") {
+			part.padding = true
+			part.key = strings.TrimSuffix(part.key, "->")
+		}
+		switch {
+		case part.key == "" || strings.HasPrefix(part.key, "?"):
+			part.skip = true
+		case strings.HasPrefix(part.key, "+"):
+			part.appendKey = true
+			part.key = strings.TrimPrefix(part.key, "+")
+			if i := strings.Index(part.key, "/"); i != -1 {
+				// append order, e.g. %{+key/2}, is not supported, keys are appended in order of appearance
+				part.key = part.key[:i]
+			}
+		case strings.HasPrefix(part.key, "*"), strings.HasPrefix(part.key, "&"):
+			return nil, fmt.Errorf("reference keys [%s] are not supported in dissect pattern", part.key)
+		}
+		parts = append(parts, part)
+	}
+	if last < len(pattern) {
+		parts = append(parts, patternPart{literal: pattern[last:]})
+	}
+	return parts, nil
+}
+
+// dissectRegexes returns regular expressions for all keys of the pattern, in order of appearance
+func dissectRegexes(pattern string) (keys []*extractedKey, fullRegex string, err error) {
+	parts, err := parseDissectPattern(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+
+	render := func(capture int) string {
+		var sb strings.Builder
+		sb.WriteString("^")
+		occurrence := 0
+		for i, part := range parts {
+			if part.key == "" && !part.skip {
+				if i > 0 && parts[i-1].padding {
+					// %{key->} skips repeated padding, e.g. spaces, before the delimiter
+					padding, _ := utf8.DecodeRuneInString(part.literal)
+					sb.WriteString("(?:" + regexp.QuoteMeta(string(padding)) + ")*")
+				}
+				sb.WriteString(regexp.QuoteMeta(part.literal))
+				continue
+			}
+			value := ".*?"
+			if i == len(parts)-1 {
+				value = ".*"
+			}
+			if !part.skip && occurrence == capture {
+				sb.WriteString("(" + value + ")")
+			} else {
+				sb.WriteString("(?:" + value + ")")
+			}
+			if !part.skip {
+				occurrence++
+			}
+		}
+		sb.WriteString("$")
+		return sb.String()
+	}
+
+	byName := map[string]*extractedKey{}
+	occurrence := 0
+	for _, part := range parts {
+		if part.key == "" || part.skip {
+			continue
+		}
+		key, exists := byName[part.key]
+		if !exists {
+			key = &extractedKey{name: part.key, esqlType: typeKeyword}
+			byName[part.key] = key
+			keys = append(keys, key)
+		} else if !part.appendKey {
+			return nil, "", fmt.Errorf("key [%s] is used more than once in dissect pattern", part.key)
+		}
+		key.regexes = append(key.regexes, render(occurrence))
+		occurrence++
+	}
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("no keys in dissect pattern [%s]", pattern)
+	}
+	return keys, render(-1), nil
+}
+
+var grokConversions = map[string]conversion{
+	"int":    {"toInt32OrNull", "", typeInteger},
+	"long":   {"toInt64OrNull", "", typeLong},
+	"float":  {"toFloat64OrNull", "", typeDouble},
+	"double": {"toFloat64OrNull", "", typeDouble},
+}
+
+// grokRegexes returns regular expressions for all named keys of the pattern, in order of appearance
+func grokRegexes(pattern string) (keys []*extractedKey, fullRegex string, err error) {
+	type grokKey struct {
+		name        string
+		convertWith string
+		esqlType    string
+	}
+	var found []grokKey
+
+	var expand func(pattern string, depth int, topLevel bool, capture int) (string, error)
+	expand = func(pattern string, depth int, topLevel bool, capture int) (string, error) {
+		if depth > 10 {
+			return "", fmt.Errorf("grok pattern [%s] is too deeply nested", pattern)
+		}
+		var sb strings.Builder
+		last := 0
+		keyNumber := 0
+		for _, match := range grok.KeyRegex.FindAllStringSubmatchIndex(pattern, -1) {
+			sb.WriteString(grok.NonCapturing(pattern[last:match[0]]))
+			last = match[1]
+
+			name := pattern[match[2]:match[3]]
+			definition, ok := grok.Patterns[name]
+			if !ok {
+				return "", fmt.Errorf("unable to find pattern [%s] in Grok's pattern dictionary", name)
+			}
+			expanded, err := expand(definition, depth+1, false, -1)
+			if err != nil {
+				return "", err
+			}
+
+			if topLevel && match[4] != -1 {
+				if capture == -1 && len(found) == keyNumber {
+					key := grokKey{name: pattern[match[4]:match[5]], esqlType: typeKeyword}
+					if match[6] != -1 {
+						conversion, ok := grokConversions[pattern[match[6]:match[7]]]
+						if !ok {
+							return "", fmt.Errorf("unsupported grok type [%s]", pattern[match[6]:match[7]])
+						}
+						key.convertWith, key.esqlType = conversion.fromString, conversion.esqlType
+					}
+					found = append(found, key)
+				}
+				if keyNumber == capture {
+					sb.WriteString("(" + expanded + ")")
+				} else {
+					sb.WriteString("(?:" + expanded + ")")
+				}
+				keyNumber++
+			} else {
+				sb.WriteString("(?:" + expanded + ")")
+			}
+		}
+		sb.WriteString(grok.NonCapturing(pattern[last:]))
+		return sb.String(), nil
+	}
+
+	fullRegex, err = expand(pattern, 0, true, -1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(found) == 0 {
+		return nil, "", fmt.Errorf("no named keys in grok pattern [%s]", pattern)
+	}
+
+	byName := map[string]*extractedKey{}
+	for i, key := range found {
+		regex, err := expand(pattern, 0, true, i)
+		if err != nil {
+			return nil, "", err
+		}
+		if existing, ok := byName[key.name]; ok {
+			// the first non-empty match wins
+			existing.regexes = append(existing.regexes, regex)
+			continue
+		}
+		extracted := &extractedKey{name: key.name, regexes: []string{regex}, convertWith: key.convertWith, esqlType: key.esqlType}
+		byName[key.name] = extracted
+		keys = append(keys, extracted)
+	}
+	return keys, fullRegex, nil
+}
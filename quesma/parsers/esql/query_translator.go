@@ -0,0 +1,455 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"context"
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	quesma_errors "github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/parsers/elastic_query_dsl"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultLimit is applied when the query has no LIMIT, like in Elasticsearch
+const defaultLimit = 1000
+
+// Request is a parsed body of `_query` (or `_query/async`) request
+type Request struct {
+	Query    string
+	Params   []any
+	Filter   types.JSON // optional Query DSL filter
+	Columnar bool       // true <=> values are returned column by column
+}
+
+func ParseRequest(body types.JSON) (*Request, error) {
+	query, ok := body["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	request := &Request{Query: query}
+	if params, ok := body["params"].([]any); ok {
+		request.Params = params
+	}
+	if filter, ok := body["filter"].(map[string]any); ok {
+		request.Filter = filter
+	}
+	if columnar, ok := body["columnar"].(bool); ok {
+		request.Columnar = columnar
+	}
+	return request, nil
+}
+
+// ParseQuery parses the query of the request
+func (r *Request) ParseQuery() (*Query, error) {
+	query, err := Parse(r.Query, r.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return query, nil
+}
+
+// IndexPattern returns comma-separated index patterns from the FROM command
+func (q *Query) IndexPattern() string {
+	return strings.Join(q.Indexes, ",")
+}
+
+// ClickhouseESQLTranslator translates ES|QL queries into ClickHouse queries.
+type ClickhouseESQLTranslator struct {
+	Ctx         context.Context
+	Schema      schema.Schema
+	Table       *clickhouse.Table
+	Indexes     []string
+	AliasFilter types.JSON // Query DSL filter of aliases the indexes were matched by, nil if there is none
+}
+
+// stage is a single SELECT being built. Processing commands are merged into the current stage as long as
+// it's possible, e.g. WHERE after STATS can't be, so then the current stage becomes a subquery of the next one.
+type stage struct {
+	from       model.Expr
+	columns    []column
+	where      []model.Expr
+	groupBy    []model.Expr
+	aggregated bool
+	orderBy    []model.OrderByExpr
+	limit      int // 0 <=> no limit yet
+	limitZero  bool
+}
+
+func (s *stage) translator() *exprTranslator {
+	return &exprTranslator{columns: s.columns}
+}
+
+func (s *stage) hasLimit() bool {
+	return s.limit > 0 || s.limitZero
+}
+
+func (s *stage) selectCommand(limit int) *model.SelectCommand {
+	columns := make([]model.Expr, 0, len(s.columns))
+	for _, col := range s.columns {
+		if model.AsString(col.expr) == strconv.Quote(col.name) {
+			columns = append(columns, col.expr)
+		} else {
+			columns = append(columns, model.NewAliasedExpr(col.expr, col.name))
+		}
+	}
+	where := slices.Clone(s.where)
+	if s.limitZero {
+		// LIMIT 0 is a valid query, returning columns only
+		where = append(where, model.NewLiteral("false"))
+		limit = 1
+	}
+	return model.NewSelectCommand(columns, s.groupBy, s.orderBy, s.from, model.And(where), []model.Expr{}, limit, 0, false, nil)
+}
+
+// wrap makes the current stage a subquery of a new stage, whose columns refer to the subquery's ones
+func (s *stage) wrap() *stage {
+	inner := s.selectCommand(s.limit)
+	next := &stage{from: *inner}
+	for _, col := range s.columns {
+		next.columns = append(next.columns, column{name: col.name, expr: model.NewLiteral(strconv.Quote(col.name)), esqlType: col.esqlType})
+	}
+	// keep the order (if it's by the selected columns), as subqueries don't guarantee it
+	for _, orderBy := range s.orderBy {
+		for i, col := range s.columns {
+			if model.AsString(col.expr) == model.AsString(orderBy.Expr) {
+				next.orderBy = append(next.orderBy, model.NewOrderByExpr(next.columns[i].expr, orderBy.Direction))
+			}
+		}
+	}
+	return next
+}
+
+// sourceColumns are columns of FROM: all fields of the schema, in alphabetical order, like in Elasticsearch
+func (t *ClickhouseESQLTranslator) sourceColumns(metadata []string) []column {
+	var columns []column
+	for name, field := range t.Schema.Fields {
+		if field.Type.Name == schema.QuesmaTypeObject.Name || field.Type.Name == schema.QuesmaTypeMap.Name {
+			continue
+		}
+		columns = append(columns, column{name: name.AsString(), expr: model.NewColumnRef(name.AsString()), esqlType: esqlType(field.Type)})
+	}
+	slices.SortFunc(columns, func(a, b column) int { return strings.Compare(a.name, b.name) })
+
+	for _, name := range metadata {
+		if name == "_index" && len(t.Indexes) == 1 {
+			columns = append(columns, column{name: name, expr: literal(t.Indexes[0]).expr, esqlType: typeKeyword})
+		}
+	}
+	return columns
+}
+
+// BuildQuery builds ClickHouse query for the ES|QL query
+func (t *ClickhouseESQLTranslator) BuildQuery(query *Query, request *Request) (*model.Query, error) {
+	result, err := t.buildQuery(query, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	return result, nil
+}
+
+func (t *ClickhouseESQLTranslator) buildQuery(query *Query, request *Request) (*model.Query, error) {
+	current := &stage{from: model.NewTableRef(model.SingleTableNamePlaceHolder), columns: t.sourceColumns(query.Metadata)}
+	for _, filter := range []types.JSON{request.Filter, t.AliasFilter} {
+		if filter == nil {
+			continue
+		}
+		dslTranslator := &elastic_query_dsl.ClickhouseQueryTranslator{Ctx: t.Ctx, Schema: t.Schema, Table: t.Table, Indexes: t.Indexes}
+		parsed := dslTranslator.ParseQueryMap(filter)
+		if !parsed.CanParse {
+			return nil, fmt.Errorf("can't parse filter: %v", filter)
+		}
+		if parsed.WhereClause != nil {
+			current.where = append(current.where, parsed.WhereClause)
+		}
+	}
+
+	var err error
+	for _, command := range query.Commands {
+		if current, err = t.apply(current, command); err != nil {
+			return nil, err
+		}
+	}
+	if len(current.columns) == 0 {
+		return nil, fmt.Errorf("no columns left to return")
+	}
+
+	limit := current.limit
+	if !current.hasLimit() {
+		limit = defaultLimit
+	}
+	resultColumns := make([]Column, 0, len(current.columns))
+	for _, col := range current.columns {
+		resultColumns = append(resultColumns, Column{Name: col.name, Type: col.esqlType})
+	}
+	return &model.Query{
+		SelectCommand: *current.selectCommand(limit),
+		TableName:     t.Table.Name,
+		Indexes:       t.Indexes,
+		Schema:        t.Schema,
+		Type:          &tabularResultType{columns: resultColumns, columnar: request.Columnar},
+	}, nil
+}
+
+func (t *ClickhouseESQLTranslator) apply(current *stage, command Command) (*stage, error) {
+	switch c := command.(type) {
+	case Where:
+		if containsAggregate(c.Condition) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+		}
+		// conditions after STATS refer to aggregated values, and conditions after LIMIT can't change which rows are taken
+		if current.aggregated || current.hasLimit() {
+			current = current.wrap()
+		}
+		condition, err := current.translator().translate(c.Condition)
+		if err != nil {
+			return nil, err
+		}
+		current.where = append(current.where, condition.expr)
+
+	case Eval:
+		for _, assignment := range c.Assignments {
+			if containsAggregate(assignment.Expr) {
+				return nil, fmt.Errorf("aggregate functions are not allowed in EVAL")
+			}
+			translated, err := current.translator().translate(assignment.Expr)
+			if err != nil {
+				return nil, err
+			}
+			current.columns = setColumn(current.columns, column{name: assignment.Name, expr: translated.expr, esqlType: translated.esqlType})
+		}
+
+	case Stats:
+		if current.aggregated || current.hasLimit() {
+			current = current.wrap()
+		}
+		return t.stats(current, c)
+
+	case Sort:
+		// sorting after LIMIT sorts only the rows taken
+		if current.hasLimit() {
+			current = current.wrap()
+		}
+		translator := current.translator()
+		orderBy := make([]model.OrderByExpr, 0, len(c.Items))
+		for _, item := range c.Items {
+			translated, err := translator.translate(item.Expr)
+			if err != nil {
+				return nil, err
+			}
+			direction := model.AscOrder
+			if item.Desc {
+				direction = model.DescOrder
+			}
+			// ClickHouse puts NULLs last regardless of the direction
+			if item.NullsFirst {
+				orderBy = append(orderBy, model.NewOrderByExpr(model.NewFunction("isNull", translated.expr), model.DescOrder))
+			}
+			orderBy = append(orderBy, model.NewOrderByExpr(translated.expr, direction))
+		}
+		// the last SORT is the most important one
+		current.orderBy = append(orderBy, current.orderBy...)
+
+	case Limit:
+		if c.Count == 0 {
+			current.limitZero = true
+		} else if current.limit == 0 || c.Count < current.limit {
+			current.limit = c.Count
+		}
+
+	case Keep:
+		var kept []column
+		for _, pattern := range c.Patterns {
+			matched := false
+			for _, col := range current.columns {
+				if ok, _ := path.Match(pattern, col.name); ok {
+					matched = true
+					kept = setColumn(kept, col)
+				}
+			}
+			if !matched && !strings.Contains(pattern, "*") {
+				return nil, fmt.Errorf("Unknown column [%s]", pattern)
+			}
+		}
+		current.columns = kept
+
+	case Drop:
+		for _, pattern := range c.Patterns {
+			matched := false
+			current.columns = slices.DeleteFunc(current.columns, func(col column) bool {
+				ok, _ := path.Match(pattern, col.name)
+				matched = matched || ok
+				return ok
+			})
+			if !matched && !strings.Contains(pattern, "*") {
+				return nil, fmt.Errorf("Unknown column [%s]", pattern)
+			}
+		}
+
+	case Rename:
+		for _, rename := range c.Renames {
+			i := slices.IndexFunc(current.columns, func(col column) bool { return col.name == rename.From })
+			if i == -1 {
+				return nil, fmt.Errorf("Unknown column [%s]", rename.From)
+			}
+			if rename.From == rename.To {
+				continue
+			}
+			// the renamed column keeps its position, an existing column with the new name is dropped
+			columns := make([]column, 0, len(current.columns))
+			for j, col := range current.columns {
+				switch {
+				case j == i:
+					col.name = rename.To
+					columns = append(columns, col)
+				case col.name != rename.To:
+					columns = append(columns, col)
+				}
+			}
+			current.columns = columns
+		}
+
+	case Dissect:
+		keys, fullRegex, err := dissectRegexes(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return t.extract(current, c.Input, keys, fullRegex, c.AppendSeparator)
+
+	case Grok:
+		keys, fullRegex, err := grokRegexes(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return t.extract(current, c.Input, keys, fullRegex, "")
+
+	default:
+		return nil, fmt.Errorf("unsupported command %T", command)
+	}
+	return current, nil
+}
+
+// setColumn adds the column at the end, removing the previous one with the same name, like EVAL does
+func setColumn(columns []column, col column) []column {
+	columns = slices.DeleteFunc(columns, func(c column) bool { return c.name == col.name })
+	return append(columns, col)
+}
+
+func (t *ClickhouseESQLTranslator) stats(current *stage, stats Stats) (*stage, error) {
+	translator := current.translator()
+
+	var groupColumns []column
+	for _, by := range stats.By {
+		if containsAggregate(by.Expr) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in STATS ... BY")
+		}
+		translated, err := translator.translate(by.Expr)
+		if err != nil {
+			return nil, err
+		}
+		groupColumns = append(groupColumns, column{name: by.Name, expr: translated.expr, esqlType: translated.esqlType})
+		current.groupBy = append(current.groupBy, translated.expr)
+	}
+
+	translator.allowAggregates = true
+	var columns []column
+	for _, aggregation := range stats.Aggregations {
+		if !containsAggregate(aggregation.Expr) {
+			return nil, fmt.Errorf("expected an aggregate function in STATS, found [%s]", aggregation.Name)
+		}
+		translated, err := translator.translate(aggregation.Expr)
+		if err != nil {
+			return nil, err
+		}
+		columns = setColumn(columns, column{name: aggregation.Name, expr: translated.expr, esqlType: translated.esqlType})
+	}
+	for _, col := range groupColumns {
+		columns = setColumn(columns, col)
+	}
+
+	current.columns = columns
+	current.aggregated = true
+	// order of rows before aggregation doesn't matter
+	current.orderBy = nil
+	return current, nil
+}
+
+// extract adds columns extracted by DISSECT or GROK. If the input doesn't match the pattern, all of them are null.
+func (t *ClickhouseESQLTranslator) extract(current *stage, input Node, keys []*extractedKey, fullRegex, appendSeparator string) (*stage, error) {
+	translatedInput, err := current.translator().translate(input)
+	if err != nil {
+		return nil, err
+	}
+	if !isStringType(translatedInput.esqlType) {
+		return nil, fmt.Errorf("input of DISSECT and GROK must be a string, found [%s]", translatedInput.esqlType)
+	}
+
+	matches := model.NewFunction("match", translatedInput.expr, literal(fullRegex).expr)
+	for _, key := range keys {
+		parts := make([]model.Expr, 0, len(key.regexes))
+		for i, regex := range key.regexes {
+			if i > 0 && appendSeparator != "" {
+				parts = append(parts, literal(appendSeparator).expr)
+			}
+			parts = append(parts, model.NewFunction("extract", translatedInput.expr, literal(regex).expr))
+		}
+		value := parts[0]
+		if len(parts) > 1 {
+			value = model.NewFunction("concat", parts...)
+		}
+		if key.convertWith != "" {
+			value = model.NewFunction(key.convertWith, value)
+		}
+		current.columns = setColumn(current.columns, column{
+			name:     key.name,
+			expr:     model.NewFunction("if", matches, value, model.NullExpr),
+			esqlType: key.esqlType,
+		})
+	}
+	return current, nil
+}
+
+// MakeResponse renders the results
+func (t *ClickhouseESQLTranslator) MakeResponse(query *model.Query, rows []model.QueryResultRow) (*Response, error) {
+	resultType, ok := query.Type.(*tabularResultType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected query type %T", query.Type)
+	}
+	return resultType.makeResponse(rows), nil
+}
+
+// tabularResultType keeps what's needed to render the results of ES|QL query
+type tabularResultType struct {
+	columns  []Column
+	columnar bool
+}
+
+func (r *tabularResultType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (r *tabularResultType) String() string {
+	return "esql"
+}
+
+func (r *tabularResultType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	response := r.makeResponse(rows)
+	return model.JsonMap{"columns": response.Columns, "values": response.Values}
+}
+
+func (r *tabularResultType) makeResponse(rows []model.QueryResultRow) *Response {
+	values := make([][]any, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, rowValues(row, r.columns))
+	}
+	if r.columnar {
+		values = transpose(values, len(r.columns))
+	}
+	return &Response{Columns: r.columns, Values: values}
+}
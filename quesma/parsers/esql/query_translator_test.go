@@ -0,0 +1,144 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"context"
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"github.com/QuesmaOrg/quesma/quesma/schema"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+)
+
+func testTranslator() *ClickhouseESQLTranslator {
+	fields := map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeTimestamp},
+		"host.name":  {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+		"status":     {PropertyName: "status", InternalPropertyName: "status", Type: schema.QuesmaTypeInteger},
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	}
+	return &ClickhouseESQLTranslator{
+		Ctx:     context.Background(),
+		Schema:  schema.Schema{Fields: fields},
+		Table:   &clickhouse.Table{Name: "logs"},
+		Indexes: []string{"logs"},
+	}
+}
+
+func buildQuery(t *testing.T, body types.JSON) *model.Query {
+	request, err := ParseRequest(body)
+	require.NoError(t, err)
+	query, err := request.ParseQuery()
+	require.NoError(t, err)
+	result, err := testTranslator().BuildQuery(query, request)
+	require.NoError(t, err)
+	return result
+}
+
+func TestBuildQuery(t *testing.T) {
+	testcases := []struct {
+		query       string
+		expectedSQL string
+	}{
+		{`FROM logs | KEEP status, host.* | LIMIT 5`,
+			`SELECT "status", "host.name" FROM __quesma_table_name LIMIT 5`},
+		{`FROM logs | WHERE status >= 500 AND host.name LIKE "web-*" | EVAL s = status * 2 | SORT s DESC | KEEP s`,
+			`SELECT ("status"*2) AS "s" FROM __quesma_table_name WHERE ("status">=500 AND "host.name" LIKE 'web-%') ORDER BY isNull(("status"*2)) DESC, ("status"*2) DESC LIMIT 1000`},
+		{`FROM logs | STATS c = COUNT(*), AVG(status) BY host.name | WHERE c > 10 | SORT c DESC | LIMIT 3`,
+			`SELECT "c", "AVG(status)", "host.name" FROM (SELECT count(*) AS "c", avg("status") AS "AVG(status)", "host.name" FROM __quesma_table_name GROUP BY "host.name") WHERE "c">10 ORDER BY isNull("c") DESC, "c" DESC LIMIT 3`},
+		{`FROM logs | STATS COUNT(*) BY h = BUCKET(@timestamp, 1 hour)`,
+			`SELECT count(*) AS "COUNT(*)", toStartOfInterval("@timestamp",INTERVAL 1 hour) AS "h" FROM __quesma_table_name GROUP BY toStartOfInterval("@timestamp",INTERVAL 1 hour) LIMIT 1000`},
+		{`FROM logs | DISSECT message "%{a} %{b}" | KEEP a, b`,
+			`SELECT if(match("message",'^(?:.*?) (?:.*)$'),extract("message",'^(.*?) (?:.*)$'),NULL) AS "a", if(match("message",'^(?:.*?) (?:.*)$'),extract("message",'^(?:.*?) (.*)$'),NULL) AS "b" FROM __quesma_table_name LIMIT 1000`},
+		{`FROM logs | GROK message "%{WORD:verb} %{INT:code:int}" | KEEP verb, code`,
+			`SELECT if(match("message",'(?:\\b\\w+\\b) (?:(?:[+-]?(?:[0-9]+)))'),extract("message",'(\\b\\w+\\b) (?:(?:[+-]?(?:[0-9]+)))'),NULL) AS "verb", if(match("message",'(?:\\b\\w+\\b) (?:(?:[+-]?(?:[0-9]+)))'),toInt32OrNull(extract("message",'(?:\\b\\w+\\b) ((?:[+-]?(?:[0-9]+)))')),NULL) AS "code" FROM __quesma_table_name LIMIT 1000`},
+		{`FROM logs | RENAME status AS status, message AS host.name | LIMIT 5`,
+			`SELECT "@timestamp", "message" AS "host.name", "status" FROM __quesma_table_name LIMIT 5`},
+		{`FROM logs | RENAME status AS code | DROP message, @timestamp | LIMIT 0`,
+			`SELECT "host.name", "status" AS "code" FROM __quesma_table_name WHERE false LIMIT 1`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			query := buildQuery(t, types.JSON{"query": tc.query})
+			assert.Equal(t, tc.expectedSQL, query.SelectCommand.String())
+		})
+	}
+}
+
+func TestBuildQueryWithAliasFilter(t *testing.T) {
+	request, err := ParseRequest(types.JSON{"query": `FROM logs | KEEP status`, "filter": map[string]any{"term": map[string]any{"status": 500}}})
+	require.NoError(t, err)
+	query, err := request.ParseQuery()
+	require.NoError(t, err)
+	translator := testTranslator()
+	translator.AliasFilter = types.JSON{"term": map[string]any{"host.name": "web-1"}}
+	result, err := translator.BuildQuery(query, request)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "status" FROM __quesma_table_name WHERE ("status"=500 AND "host_name"='web-1') LIMIT 1000`, result.SelectCommand.String())
+}
+
+func TestBuildQueryErrors(t *testing.T) {
+	testcases := []struct {
+		query         string
+		expectedError string
+	}{
+		{`FROM logs | KEEP foo`, "Unknown column [foo]"},
+		{`FROM logs | STATS c = COUNT(*) | KEEP status`, "Unknown column [status]"},
+		{`FROM logs | WHERE COUNT(*) > 1`, "aggregate functions are not allowed in WHERE"},
+		{`FROM logs | STATS status`, "expected an aggregate function in STATS"},
+		{`FROM logs | EVAL x = FOO(status)`, "Unknown function [FOO]"},
+		{`FROM logs | DISSECT status "%{a}"`, "must be a string"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.query, func(t *testing.T) {
+			request, err := ParseRequest(types.JSON{"query": tc.query})
+			require.NoError(t, err)
+			query, err := request.ParseQuery()
+			require.NoError(t, err)
+			_, err = testTranslator().BuildQuery(query, request)
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestDissectRegexes(t *testing.T) {
+	keys, fullRegex, err := dissectRegexes(`%{clientip} [%{?ts}] "%{verb} %{+verb}" %{status->} end`)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	input := `1.2.3.4 [10/Oct/2023] "GET /index" 200   end`
+	assert.Regexp(t, fullRegex, input)
+	extract := func(regex string) string {
+		return regexp.MustCompile(regex).FindStringSubmatch(input)[1]
+	}
+	assert.Equal(t, "clientip", keys[0].name)
+	assert.Equal(t, "1.2.3.4", extract(keys[0].regexes[0]))
+	assert.Equal(t, "verb", keys[1].name)
+	require.Len(t, keys[1].regexes, 2)
+	assert.Equal(t, "GET", extract(keys[1].regexes[0]))
+	assert.Equal(t, "/index", extract(keys[1].regexes[1]))
+	assert.Equal(t, "status", keys[2].name)
+	assert.Equal(t, "200", extract(keys[2].regexes[0]))
+}
+
+func TestMakeResponse(t *testing.T) {
+	rows := []model.QueryResultRow{
+		{Cols: []model.QueryResultCol{{Value: "a"}, {Value: int64(1)}}},
+		{Cols: []model.QueryResultCol{{Value: "b"}, {Value: nil}}},
+	}
+
+	query := buildQuery(t, types.JSON{"query": `FROM logs | KEEP host.name, status`})
+	response, err := testTranslator().MakeResponse(query, rows)
+	require.NoError(t, err)
+	assert.Equal(t, []Column{{Name: "host.name", Type: typeKeyword}, {Name: "status", Type: typeInteger}}, response.Columns)
+	assert.Equal(t, [][]any{{"a", int64(1)}, {"b", nil}}, response.Values)
+
+	query = buildQuery(t, types.JSON{"query": `FROM logs | KEEP host.name, status`, "columnar": true})
+	response, err = testTranslator().MakeResponse(query, rows)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"a", "b"}, {int64(1), nil}}, response.Values)
+}
@@ -0,0 +1,56 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package esql
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/model"
+	"net"
+	"time"
+)
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Response is the response of `_query` endpoint
+type Response struct {
+	Columns []Column `json:"columns"`
+	Values  [][]any  `json:"values"`
+}
+
+// AsyncResponse is the response of `_query/async` endpoint. Queries are always run synchronously,
+// so the response is complete and there's no id to poll for results.
+type AsyncResponse struct {
+	IsRunning bool `json:"is_running"`
+	*Response
+}
+
+const dateFormat = "2006-01-02T15:04:05.000Z"
+
+func rowValues(row model.QueryResultRow, columns []Column) []any {
+	values := make([]any, len(columns))
+	for i := 0; i < len(columns) && i < len(row.Cols); i++ {
+		switch value := row.Cols[i].ExtractValue().(type) {
+		case time.Time:
+			values[i] = value.UTC().Format(dateFormat)
+		case net.IP:
+			values[i] = value.String()
+		default:
+			values[i] = value
+		}
+	}
+	return values
+}
+
+// transpose returns values column by column (`columnar` response)
+func transpose(rows [][]any, columnsCount int) [][]any {
+	columns := make([][]any, columnsCount)
+	for i := range columns {
+		columns[i] = make([]any, 0, len(rows))
+		for _, row := range rows {
+			columns[i] = append(columns[i], row[i])
+		}
+	}
+	return columns
+}
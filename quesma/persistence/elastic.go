@@ -103,6 +103,23 @@ func (p *ElasticJSONDatabase) Get(key string) (string, bool, error) {
 	return wrapper.Content, true, err
 }
 
+func (p *ElasticJSONDatabase) Delete(key string) error {
+	elasticsearchURL := fmt.Sprintf("%s/_doc/%s", p.indexName, key)
+
+	resp, err := p.httpClient.Request(context.Background(), "DELETE", elasticsearchURL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete from elastic: %v", resp.Status)
+	}
+}
+
 func (p *ElasticJSONDatabase) List() ([]string, error) {
 
 	// Define the Elasticsearch endpoint and the index you want to query
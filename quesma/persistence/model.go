@@ -14,4 +14,5 @@ type JSONDatabase interface {
 	List() (keys []string, err error)
 	Get(key string) (string, bool, error)
 	Put(key string, data string) error
+	Delete(key string) error // no-op if the key doesn't exist
 }
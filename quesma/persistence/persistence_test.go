@@ -79,4 +79,16 @@ func TestNewElasticPersistence(t *testing.T) {
 		t.Fatal("expected bar")
 	}
 
+	if err = p.Delete("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err = p.Get("t1"); err != nil || ok {
+		t.Fatal("expected deleted")
+	}
+
+	if err = p.Delete("t1"); err != nil {
+		t.Fatal(err)
+	}
+
 }
@@ -45,3 +45,11 @@ func (db *StaticJSONDatabase) Put(key string, val string) error {
 	db.data[key] = val
 	return nil
 }
+
+func (db *StaticJSONDatabase) Delete(key string) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	delete(db.data, key)
+	return nil
+}
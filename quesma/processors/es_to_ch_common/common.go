@@ -156,6 +156,9 @@ func InitializeLegacyQuesmaDependencies(baseDeps *quesma_api.DependenciesImpl, o
 		schemaRegistry,
 		virtualTableStorage,
 		dummyTableResolver,
+		persistence.NewElasticJSONDatabase(oldQuesmaConfig.Elasticsearch, ingest.IndexTemplatesElasticIndexName),
+		persistence.NewElasticJSONDatabase(oldQuesmaConfig.Elasticsearch, ingest.IndexLifecycleElasticIndexName),
+		persistence.NewElasticJSONDatabase(oldQuesmaConfig.Elasticsearch, ingest.IngestPipelinesElasticIndexName),
 	)
 	ingestProcessor.Start()
 
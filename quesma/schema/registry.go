@@ -301,6 +301,9 @@ func (s *schemaRegistry) populateSchemaFromTableDefinition(definitions map[strin
 		logger.Debug().Msgf("loading schema for table %s", indexName)
 
 		for _, column := range tableDefinition.Columns {
+			if column.Name == IngestTimeColumnName {
+				continue
+			}
 
 			var propertyName FieldName
 			if internalField, ok := internalToPublicFieldsEncodings[EncodedFieldName(column.Name)]; ok {
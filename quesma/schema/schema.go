@@ -14,6 +14,10 @@ const (
 	FieldSourceMapping
 )
 
+// IngestTimeColumnName is a column of tables created by Quesma, with the time documents were inserted at.
+// It's internal, so it isn't a field of the schema.
+const IngestTimeColumnName = "__quesma_ingest_time"
+
 type (
 	Schema struct {
 		Fields             map[FieldName]Field
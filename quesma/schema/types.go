@@ -26,6 +26,7 @@ var (
 	QuesmaTypeBoolean      = QuesmaType{Name: "boolean", Properties: []QuesmaTypeProperty{Searchable, Aggregatable}}
 	QuesmaTypeObject       = QuesmaType{Name: "object", Properties: []QuesmaTypeProperty{Searchable}}
 	QuesmaTypeArray        = QuesmaType{Name: "array", Properties: []QuesmaTypeProperty{Searchable}}
+	QuesmaTypeNested       = QuesmaType{Name: "nested", Properties: []QuesmaTypeProperty{Searchable}}
 	QuesmaTypeMap          = QuesmaType{Name: "map", Properties: []QuesmaTypeProperty{Searchable}}
 	QuesmaTypeIp           = QuesmaType{Name: "ip", Properties: []QuesmaTypeProperty{Searchable, Aggregatable}}
 	QuesmaTypePoint        = QuesmaType{Name: "point", Properties: []QuesmaTypeProperty{Searchable, Aggregatable}}
@@ -78,6 +79,8 @@ func ParseQuesmaType(t string) (QuesmaType, bool) {
 		return QuesmaTypeObject, true
 	case QuesmaTypeArray.Name:
 		return QuesmaTypeArray, true
+	case QuesmaTypeNested.Name:
+		return QuesmaTypeNested, true
 	case QuesmaTypeMap.Name:
 		return QuesmaTypeMap, true
 	case QuesmaTypeIp.Name:
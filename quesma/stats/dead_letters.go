@@ -0,0 +1,72 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package stats
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	DeadLetterStagePipeline   = "pipeline"   // the ingest pipeline failed
+	DeadLetterStageValidation = "validation" // some fields didn't match types of their columns, the document was stored with them in attributes
+	DeadLetterStageInsert     = "insert"     // the document couldn't be inserted
+)
+
+// DeadLetterStages lists stages of ingest, which may reject a document
+var DeadLetterStages = []string{DeadLetterStagePipeline, DeadLetterStageValidation, DeadLetterStageInsert}
+
+// GlobalDeadLetters counts documents rejected during ingest, shown in the management console
+var GlobalDeadLetters = &DeadLetterCounters{counters: make(map[string]DeadLetterStatistics)}
+
+type DeadLetterStatistics struct {
+	Index    string
+	Stored   map[string]int64 // documents stored in the dead letter queue, by the stage which rejected them
+	Replayed int64
+	Lost     int64 // rejected documents, which couldn't be stored in the dead letter queue
+}
+
+type DeadLetterCounters struct {
+	m        sync.Mutex
+	counters map[string]DeadLetterStatistics
+}
+
+func (c *DeadLetterCounters) update(index string, update func(statistics *DeadLetterStatistics)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	statistics, ok := c.counters[index]
+	if !ok {
+		statistics = DeadLetterStatistics{Index: index, Stored: make(map[string]int64)}
+	}
+	update(&statistics)
+	c.counters[index] = statistics
+}
+
+func (c *DeadLetterCounters) AddStored(index, stage string, count int64) {
+	c.update(index, func(statistics *DeadLetterStatistics) { statistics.Stored[stage] += count })
+}
+
+func (c *DeadLetterCounters) AddReplayed(index string, count int64) {
+	c.update(index, func(statistics *DeadLetterStatistics) { statistics.Replayed += count })
+}
+
+func (c *DeadLetterCounters) AddLost(index string, count int64) {
+	c.update(index, func(statistics *DeadLetterStatistics) { statistics.Lost += count })
+}
+
+// Sorted returns statistics sorted by index name
+func (c *DeadLetterCounters) Sorted() []DeadLetterStatistics {
+	c.m.Lock()
+	defer c.m.Unlock()
+	result := make([]DeadLetterStatistics, 0, len(c.counters))
+	for _, statistics := range c.counters {
+		stored := make(map[string]int64, len(statistics.Stored))
+		for stage, count := range statistics.Stored {
+			stored[stage] = count
+		}
+		statistics.Stored = stored
+		result = append(result, statistics)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Index < result[j].Index })
+	return result
+}
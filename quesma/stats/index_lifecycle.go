@@ -0,0 +1,59 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// GlobalIndexLifecycle is the status of indexes managed by lifecycle policies, shown in the management console
+var GlobalIndexLifecycle = &IndexLifecycleStatuses{statuses: make(map[string]IndexLifecycleStatus)}
+
+type IndexLifecycleStatus struct {
+	Index             string
+	Policy            string
+	Table             string // "" if the table hasn't been created yet
+	CommonTable       bool   // rows of the index are deleted, as partitions and TTL are shared with other indexes
+	DeletePhase       bool
+	DeleteAfter       time.Duration
+	LastRun           time.Time // zero if retention hasn't been enforced yet
+	LastError         string
+	DroppedPartitions int64
+}
+
+type IndexLifecycleStatuses struct {
+	m        sync.Mutex
+	statuses map[string]IndexLifecycleStatus
+}
+
+// Update modifies the status of the index, creating it if needed
+func (s *IndexLifecycleStatuses) Update(index string, update func(status *IndexLifecycleStatus)) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	status, ok := s.statuses[index]
+	if !ok {
+		status = IndexLifecycleStatus{Index: index}
+	}
+	update(&status)
+	s.statuses[index] = status
+}
+
+func (s *IndexLifecycleStatuses) Remove(index string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.statuses, index)
+}
+
+// Sorted returns statuses sorted by index name
+func (s *IndexLifecycleStatuses) Sorted() []IndexLifecycleStatus {
+	s.m.Lock()
+	defer s.m.Unlock()
+	result := make([]IndexLifecycleStatus, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Index < result[j].Index })
+	return result
+}
@@ -0,0 +1,62 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// GlobalIngestBuffer counts documents going through the ingest buffer, shown in the management console
+var GlobalIngestBuffer = &IngestBufferCounters{}
+
+type IngestBufferStatistics struct {
+	Buffered  int64 // documents waiting for a flush, including the ones being flushed
+	Recovered int64 // documents read from the write-ahead log on start
+	Flushes   int64
+	Inserted  int64
+	Rejected  int64 // documents rejected with 429, because the buffer was full
+	Lost      int64 // documents not inserted before Quesma stopped, without the write-ahead log
+	LastFlush time.Time
+}
+
+type IngestBufferCounters struct {
+	m          sync.Mutex
+	statistics IngestBufferStatistics
+}
+
+func (c *IngestBufferCounters) update(update func(statistics *IngestBufferStatistics)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	update(&c.statistics)
+}
+
+func (c *IngestBufferCounters) AddBuffered(count int64) {
+	c.update(func(statistics *IngestBufferStatistics) { statistics.Buffered += count })
+}
+
+func (c *IngestBufferCounters) AddRecovered(count int64) {
+	c.update(func(statistics *IngestBufferStatistics) { statistics.Recovered += count })
+}
+
+func (c *IngestBufferCounters) AddRejected(count int64) {
+	c.update(func(statistics *IngestBufferStatistics) { statistics.Rejected += count })
+}
+
+func (c *IngestBufferCounters) AddLost(count int64) {
+	c.update(func(statistics *IngestBufferStatistics) { statistics.Lost += count })
+}
+
+func (c *IngestBufferCounters) AddFlush(inserted int64) {
+	c.update(func(statistics *IngestBufferStatistics) {
+		statistics.Flushes++
+		statistics.Inserted += inserted
+		statistics.LastFlush = time.Now()
+	})
+}
+
+func (c *IngestBufferCounters) Snapshot() IngestBufferStatistics {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.statistics
+}
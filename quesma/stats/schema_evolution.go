@@ -0,0 +1,48 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+const schemaEvolutionLogSize = 1000
+
+// GlobalSchemaEvolution is the log of schema changes made during ingest, shown in the management console
+var GlobalSchemaEvolution = &SchemaEvolutionLog{}
+
+type SchemaEvolutionEvent struct {
+	Time   time.Time
+	Table  string
+	Column string
+	Kind   string // strategy which changed the schema, e.g. "widen"
+	From   string // type of the column before the change
+	To     string // type of the column after the change, for shadow columns: type of the shadow column
+}
+
+type SchemaEvolutionLog struct {
+	m      sync.Mutex
+	events []SchemaEvolutionEvent
+}
+
+// Record appends the event, only the most recent events are kept
+func (l *SchemaEvolutionLog) Record(event SchemaEvolutionEvent) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.events = append(l.events, event)
+	if len(l.events) > schemaEvolutionLogSize {
+		l.events = l.events[len(l.events)-schemaEvolutionLogSize:]
+	}
+}
+
+// Recent returns events, the most recent first
+func (l *SchemaEvolutionLog) Recent() []SchemaEvolutionEvent {
+	l.m.Lock()
+	defer l.m.Unlock()
+	result := make([]SchemaEvolutionEvent, 0, len(l.events))
+	for i := len(l.events) - 1; i >= 0; i-- {
+		result = append(result, l.events[i])
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package table_resolver
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/errors"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	"github.com/goccy/go-json"
+	"reflect"
+	"sort"
+)
+
+// Index aliases (https://www.elastic.co/guide/en/elasticsearch/reference/current/aliases.html) managed by Quesma.
+// Aliases are stored in a JSONDatabase, one entry per alias.
+//
+// Query pipeline: an alias is expanded into its indexes by the pattern splitter, then each index is resolved as usual
+// and the decisions are merged. Alias filters are passed in ConnectorDecisionClickhouse.AliasFilters.
+// Ingest pipeline: an alias is replaced by its write index.
+
+const AliasesElasticIndexName = "quesma_aliases"
+
+const (
+	AliasActionAdd    = "add"
+	AliasActionRemove = "remove"
+)
+
+type AliasTarget struct {
+	Index        string         `json:"index"`
+	Filter       map[string]any `json:"filter,omitempty"`
+	IsWriteIndex bool           `json:"is_write_index,omitempty"`
+}
+
+type Alias struct {
+	Name    string        `json:"name"`
+	Targets []AliasTarget `json:"targets"`
+}
+
+// writeIndex returns the index documents sent to the alias are written to
+func (a Alias) writeIndex() (string, error) {
+	if len(a.Targets) == 1 {
+		return a.Targets[0].Index, nil
+	}
+	for _, target := range a.Targets {
+		if target.IsWriteIndex {
+			return target.Index, nil
+		}
+	}
+	return "", fmt.Errorf("no write index is defined for alias [%s]", a.Name)
+}
+
+type AliasAction struct {
+	Type         string // AliasActionAdd or AliasActionRemove
+	Alias        string
+	Index        string
+	Filter       map[string]any
+	IsWriteIndex bool
+}
+
+// ParseAliasActions parses the body of `POST /_aliases`
+func ParseAliasActions(body types.JSON) ([]AliasAction, error) {
+	actionsRaw, ok := body["actions"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: [actions] is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+
+	var actions []AliasAction
+	for _, actionRaw := range actionsRaw {
+		actionMap, ok := actionRaw.(map[string]any)
+		if !ok || len(actionMap) != 1 {
+			return nil, fmt.Errorf("%w: each action must be an object with a single key", quesma_errors.ErrCouldNotParseRequest())
+		}
+		for actionType, paramsRaw := range actionMap {
+			if actionType != AliasActionAdd && actionType != AliasActionRemove {
+				return nil, fmt.Errorf("%w: unsupported alias action [%s]", quesma_errors.ErrCouldNotParseRequest(), actionType)
+			}
+			params, ok := paramsRaw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: [%s] must be an object", quesma_errors.ErrCouldNotParseRequest(), actionType)
+			}
+			indexes := stringOrList(params, "index", "indices")
+			aliases := stringOrList(params, "alias", "aliases")
+			if len(indexes) == 0 || len(aliases) == 0 {
+				return nil, fmt.Errorf("%w: [%s] requires an index and an alias", quesma_errors.ErrCouldNotParseRequest(), actionType)
+			}
+			filter, _ := params["filter"].(map[string]any)
+			isWriteIndex, _ := params["is_write_index"].(bool)
+			for _, index := range indexes {
+				for _, alias := range aliases {
+					actions = append(actions, AliasAction{Type: actionType, Alias: alias, Index: index, Filter: filter, IsWriteIndex: isWriteIndex})
+				}
+			}
+		}
+	}
+	return actions, nil
+}
+
+func stringOrList(params map[string]any, singleKey, listKey string) []string {
+	if value, ok := params[singleKey].(string); ok {
+		return []string{value}
+	}
+	var result []string
+	if values, ok := params[listKey].([]any); ok {
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+func (r *tableRegistryImpl) loadAliases() {
+	if r.aliasStorage == nil {
+		return
+	}
+	keys, err := r.aliasStorage.List()
+	if err != nil {
+		logger.Warn().Msgf("could not load aliases: %v", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := r.aliasStorage.Get(key)
+		if err != nil || !ok {
+			logger.Warn().Msgf("could not load alias %s: %v", key, err)
+			continue
+		}
+		var alias Alias
+		if err = json.Unmarshal([]byte(data), &alias); err != nil {
+			logger.Warn().Msgf("could not parse alias %s: %v", key, err)
+			continue
+		}
+		if len(alias.Targets) > 0 {
+			r.aliases[alias.Name] = alias
+		}
+	}
+}
+
+// UpdateAliases applies all actions atomically, and persists the aliases which have changed
+func (r *tableRegistryImpl) UpdateAliases(actions []AliasAction) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	updated := make(map[string]Alias)
+	current := func(name string) Alias {
+		if alias, ok := updated[name]; ok {
+			return alias
+		}
+		alias := r.aliases[name]
+		alias.Name = name
+		alias.Targets = append([]AliasTarget{}, alias.Targets...)
+		return alias
+	}
+
+	for _, action := range actions {
+		if _, isIndex := r.conf.IndexConfig[action.Alias]; isIndex || r.clickhouseIndexes[action.Alias].name != "" {
+			return fmt.Errorf("%w: an index exists with the same name as the alias [%s]", quesma_errors.ErrCouldNotParseRequest(), action.Alias)
+		}
+		alias := current(action.Alias)
+		position := -1
+		for i, target := range alias.Targets {
+			if target.Index == action.Index {
+				position = i
+			}
+		}
+		switch action.Type {
+		case AliasActionAdd:
+			target := AliasTarget{Index: action.Index, Filter: action.Filter, IsWriteIndex: action.IsWriteIndex}
+			if position >= 0 {
+				alias.Targets[position] = target
+			} else {
+				alias.Targets = append(alias.Targets, target)
+			}
+		case AliasActionRemove:
+			if position < 0 {
+				return fmt.Errorf("%w: aliases [%s] missing for index [%s]", quesma_errors.ErrCouldNotParseRequest(), action.Alias, action.Index)
+			}
+			alias.Targets = append(alias.Targets[:position], alias.Targets[position+1:]...)
+		}
+		updated[action.Alias] = alias
+	}
+
+	for name, alias := range updated {
+		if r.aliasStorage != nil {
+			data, err := json.Marshal(alias)
+			if err != nil {
+				return err
+			}
+			if err = r.aliasStorage.Put(name, string(data)); err != nil {
+				return fmt.Errorf("could not store alias [%s]: %w", name, err)
+			}
+		}
+		if len(alias.Targets) == 0 {
+			delete(r.aliases, name)
+		} else {
+			r.aliases[name] = alias
+		}
+	}
+
+	r.invalidateRecentDecisions()
+	return nil
+}
+
+// Aliases returns all aliases sorted by name
+func (r *tableRegistryImpl) Aliases() []Alias {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	result := make([]Alias, 0, len(r.aliases))
+	for _, alias := range r.aliases {
+		result = append(result, alias)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// aliasExpansion collects indexes of aliases used in a pattern, with their filters
+type aliasExpansion struct {
+	filters    map[string][]map[string]any
+	unfiltered map[string]bool // indexes used without a filter (directly or by an alias), they are not filtered at all
+}
+
+func newAliasExpansion() *aliasExpansion {
+	return &aliasExpansion{filters: make(map[string][]map[string]any), unfiltered: make(map[string]bool)}
+}
+
+func (e *aliasExpansion) add(index string, filter map[string]any) {
+	if filter == nil {
+		e.unfiltered[index] = true
+		return
+	}
+	for _, existing := range e.filters[index] {
+		if reflect.DeepEqual(existing, filter) {
+			return
+		}
+	}
+	e.filters[index] = append(e.filters[index], filter)
+}
+
+// indexFilters returns a filter for each index which is used only by filtered aliases,
+// an index used by several aliases matches any of their filters
+func (e *aliasExpansion) indexFilters() map[string]any {
+	result := make(map[string]any)
+	for index, filters := range e.filters {
+		if e.unfiltered[index] {
+			continue
+		}
+		if len(filters) == 1 {
+			result[index] = filters[0]
+		} else {
+			should := make([]any, 0, len(filters))
+			for _, filter := range filters {
+				should = append(should, filter)
+			}
+			result[index] = map[string]any{"bool": map[string]any{"should": should, "minimum_should_match": 1}}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// expandAlias adds indexes of the alias to the pattern parts, alias indexes may be patterns too
+func (r *tableRegistryImpl) expandAlias(alias Alias, expansion *aliasExpansion) []string {
+	var indexes []string
+	for _, target := range alias.Targets {
+		for _, index := range r.matchingIndexNames(target.Index) {
+			indexes = append(indexes, index)
+			expansion.add(index, target.Filter)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,88 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package table_resolver
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/common_table"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	"github.com/QuesmaOrg/quesma/quesma/types"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newAliasTestResolver(storage persistence.JSONDatabase) TableResolver {
+	indexConf := map[string]config.IndexConfiguration{
+		"logs-1": {UseCommonTable: true, QueryTarget: []string{"clickhouse"}, IngestTarget: []string{"clickhouse"}},
+		"logs-2": {UseCommonTable: true, QueryTarget: []string{"clickhouse"}, IngestTarget: []string{"clickhouse"}},
+		"orders": {QueryTarget: []string{"clickhouse"}, IngestTarget: []string{"clickhouse"}},
+	}
+	cfg := config.QuesmaConfiguration{IndexConfig: indexConf, DefaultQueryTarget: []string{config.ElasticsearchTarget}, DefaultIngestTarget: []string{config.ElasticsearchTarget}}
+	return NewTableResolver(cfg, clickhouse.NewEmptyTableDiscovery(), elasticsearch.NewFixedIndexManagement(), storage, persistence.NewStaticJSONDatabase())
+}
+
+func TestAliasResolving(t *testing.T) {
+	storage := persistence.NewStaticJSONDatabase()
+	resolver := newAliasTestResolver(storage)
+
+	actions, err := ParseAliasActions(types.MustJSON(`{"actions": [
+		{"add": {"indices": ["logs-1", "logs-2"], "alias": "logs"}},
+		{"add": {"index": "logs-2", "alias": "logs-write", "is_write_index": true}},
+		{"add": {"index": "logs-1", "alias": "logs-write"}},
+		{"add": {"index": "logs-*", "alias": "errors", "filter": {"term": {"level": "error"}}}}]}`))
+	require.NoError(t, err)
+	require.NoError(t, resolver.UpdateAliases(actions))
+
+	decision := resolver.Resolve(mux.QueryPipeline, "logs")
+	require.NoError(t, decision.Err)
+	assert.Equal(t, []mux.ConnectorDecision{&mux.ConnectorDecisionClickhouse{
+		ClickhouseTableName: common_table.TableName,
+		ClickhouseIndexes:   []string{"logs-1", "logs-2"},
+		IsCommonTable:       true,
+	}}, decision.UseConnectors)
+
+	decision = resolver.Resolve(mux.QueryPipeline, "errors")
+	require.NoError(t, decision.Err)
+	filter := map[string]any{"term": map[string]any{"level": "error"}}
+	assert.Equal(t, map[string]any{"logs-1": filter, "logs-2": filter}, decision.UseConnectors[0].(*mux.ConnectorDecisionClickhouse).AliasFilters)
+
+	// an index used directly isn't filtered
+	decision = resolver.Resolve(mux.QueryPipeline, "errors,logs-1")
+	require.NoError(t, decision.Err)
+	assert.Equal(t, map[string]any{"logs-2": filter}, decision.UseConnectors[0].(*mux.ConnectorDecisionClickhouse).AliasFilters)
+
+	decision = resolver.Resolve(mux.IngestPipeline, "logs-write")
+	require.NoError(t, decision.Err)
+	assert.Equal(t, []string{"logs-2"}, decision.UseConnectors[0].(*mux.ConnectorDecisionClickhouse).ClickhouseIndexes)
+
+	decision = resolver.Resolve(mux.IngestPipeline, "logs")
+	assert.ErrorContains(t, decision.Err, "no write index is defined for alias [logs]")
+
+	// aliases are persisted
+	reloaded := newAliasTestResolver(storage)
+	assert.Equal(t, resolver.Aliases(), reloaded.Aliases())
+	assert.Len(t, reloaded.Aliases(), 3)
+}
+
+func TestAliasUpdates(t *testing.T) {
+	resolver := newAliasTestResolver(persistence.NewStaticJSONDatabase())
+
+	require.NoError(t, resolver.UpdateAliases([]AliasAction{{Type: AliasActionAdd, Alias: "all", Index: "logs-1"}, {Type: AliasActionAdd, Alias: "all", Index: "orders"}}))
+	require.NoError(t, resolver.UpdateAliases([]AliasAction{{Type: AliasActionRemove, Alias: "all", Index: "orders"}}))
+	assert.Equal(t, []Alias{{Name: "all", Targets: []AliasTarget{{Index: "logs-1"}}}}, resolver.Aliases())
+
+	// actions are applied atomically
+	err := resolver.UpdateAliases([]AliasAction{{Type: AliasActionRemove, Alias: "all", Index: "logs-1"}, {Type: AliasActionRemove, Alias: "all", Index: "orders"}})
+	assert.ErrorContains(t, err, "aliases [all] missing for index [orders]")
+	assert.Len(t, resolver.Aliases(), 1)
+
+	require.NoError(t, resolver.UpdateAliases([]AliasAction{{Type: AliasActionRemove, Alias: "all", Index: "logs-1"}}))
+	assert.Empty(t, resolver.Aliases())
+
+	err = resolver.UpdateAliases([]AliasAction{{Type: AliasActionAdd, Alias: "orders", Index: "logs-1"}})
+	assert.ErrorContains(t, err, "an index exists with the same name as the alias [orders]")
+}
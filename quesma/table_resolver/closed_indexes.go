@@ -0,0 +1,93 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package table_resolver
+
+import (
+	"fmt"
+	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"sort"
+)
+
+// Indexes closed with `POST /:index/_close` (https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-close.html).
+// A closed index is resolved as closed in all pipelines, so it can't be searched nor written to until it's opened again.
+// Its data stays untouched. Closed indexes are stored in a JSONDatabase, one entry per index.
+
+const ClosedIndexesElasticIndexName = "quesma_closed_indexes"
+
+func (r *tableRegistryImpl) loadClosedIndexes() {
+	if r.closedIndexStorage == nil {
+		return
+	}
+	keys, err := r.closedIndexStorage.List()
+	if err != nil {
+		logger.Warn().Msgf("could not load closed indexes: %v", err)
+		return
+	}
+	for _, key := range keys {
+		r.closedIndexes[key] = true
+	}
+}
+
+func (r *tableRegistryImpl) CloseIndex(name string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.closedIndexes[name] {
+		return nil
+	}
+	if r.closedIndexStorage != nil {
+		if err := r.closedIndexStorage.Put(name, `{"closed":true}`); err != nil {
+			return fmt.Errorf("could not store closed index [%s]: %w", name, err)
+		}
+	}
+	r.closedIndexes[name] = true
+	r.invalidateRecentDecisions()
+	return nil
+}
+
+func (r *tableRegistryImpl) OpenIndex(name string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if !r.closedIndexes[name] {
+		return nil
+	}
+	if r.closedIndexStorage != nil {
+		if err := r.closedIndexStorage.Delete(name); err != nil {
+			return fmt.Errorf("could not store opened index [%s]: %w", name, err)
+		}
+	}
+	delete(r.closedIndexes, name)
+	r.invalidateRecentDecisions()
+	return nil
+}
+
+// ClosedIndexes returns names of closed indexes, sorted
+func (r *tableRegistryImpl) ClosedIndexes() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	result := make([]string, 0, len(r.closedIndexes))
+	for name := range r.closedIndexes {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (r *tableRegistryImpl) resolveClosedIndex(part string) *quesma_api.Decision {
+	if r.closedIndexes[part] {
+		return &quesma_api.Decision{
+			IsClosed: true,
+			Reason:   "Index is closed.",
+		}
+	}
+	return nil
+}
+
+func (r *tableRegistryImpl) invalidateRecentDecisions() {
+	for _, res := range r.pipelineResolvers {
+		res.recentDecisions = make(map[string]*quesma_api.Decision)
+	}
+}
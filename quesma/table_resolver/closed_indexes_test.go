@@ -0,0 +1,49 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package table_resolver
+
+import (
+	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
+	"github.com/QuesmaOrg/quesma/quesma/config"
+	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
+	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCloseAndOpenIndex(t *testing.T) {
+	indexConf := map[string]config.IndexConfiguration{
+		"orders": {QueryTarget: []string{"clickhouse"}, IngestTarget: []string{"clickhouse"}},
+	}
+	cfg := config.QuesmaConfiguration{IndexConfig: indexConf, DefaultQueryTarget: []string{config.ElasticsearchTarget}, DefaultIngestTarget: []string{config.ElasticsearchTarget}}
+	storage := persistence.NewStaticJSONDatabase()
+	newResolver := func() TableResolver {
+		return NewTableResolver(cfg, clickhouse.NewEmptyTableDiscovery(), elasticsearch.NewFixedIndexManagement(), persistence.NewStaticJSONDatabase(), storage)
+	}
+	resolver := newResolver()
+
+	// warm up the decision cache, closing must invalidate it
+	assert.False(t, resolver.Resolve(mux.QueryPipeline, "orders").IsClosed)
+
+	require.NoError(t, resolver.CloseIndex("orders"))
+	assert.Equal(t, []string{"orders"}, resolver.ClosedIndexes())
+	for _, pipeline := range []string{mux.QueryPipeline, mux.IngestPipeline} {
+		decision := resolver.Resolve(pipeline, "orders")
+		assert.True(t, decision.IsClosed, pipeline)
+		assert.Empty(t, decision.UseConnectors, pipeline)
+	}
+
+	// closed indexes are loaded from the storage
+	reloaded := newResolver()
+	assert.Equal(t, []string{"orders"}, reloaded.ClosedIndexes())
+	assert.True(t, reloaded.Resolve(mux.QueryPipeline, "orders").IsClosed)
+
+	require.NoError(t, resolver.OpenIndex("orders"))
+	assert.Empty(t, resolver.ClosedIndexes())
+	decision := resolver.Resolve(mux.QueryPipeline, "orders")
+	assert.False(t, decision.IsClosed)
+	assert.NoError(t, decision.Err)
+	assert.Empty(t, newResolver().ClosedIndexes())
+}
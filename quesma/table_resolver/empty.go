@@ -40,6 +40,26 @@ func (r *EmptyTableResolver) Pipelines() []string {
 	return r.PipelinesList
 }
 
+func (r *EmptyTableResolver) UpdateAliases(actions []AliasAction) error {
+	return fmt.Errorf("aliases are not supported by EmptyTableResolver")
+}
+
+func (r *EmptyTableResolver) Aliases() []Alias {
+	return nil
+}
+
+func (r *EmptyTableResolver) CloseIndex(name string) error {
+	return fmt.Errorf("closing indexes is not supported by EmptyTableResolver")
+}
+
+func (r *EmptyTableResolver) OpenIndex(name string) error {
+	return fmt.Errorf("opening indexes is not supported by EmptyTableResolver")
+}
+
+func (r *EmptyTableResolver) ClosedIndexes() []string {
+	return nil
+}
+
 func (r *EmptyTableResolver) Start() {
 }
 
@@ -14,4 +14,11 @@ type TableResolver interface {
 
 	Pipelines() []string
 	RecentDecisions() []quesma_api.PatternDecisions
+
+	UpdateAliases(actions []AliasAction) error
+	Aliases() []Alias
+
+	CloseIndex(name string) error
+	OpenIndex(name string) error
+	ClosedIndexes() []string
 }
@@ -22,32 +22,23 @@ func (r *tableRegistryImpl) wildcardPatternSplitter(pattern string) (parsedPatte
 
 	// Given a (potentially wildcard) pattern, find all non-wildcard index names that match the pattern
 	var matchingSingleNames []string
+	expansion := newAliasExpansion()
 	for _, pattern := range patterns {
-		// If pattern is not an actual pattern (so it's a single index), just add it to the list
-		// and skip further processing.
-		// If pattern is an internal Kibana index, add it to the list without any processing - resolveInternalElasticName
-		// will take care of it.
-		if !elasticsearch.IsIndexPattern(pattern) || elasticsearch.IsInternalIndex(pattern) {
-			matchingSingleNames = append(matchingSingleNames, pattern)
+		if alias, ok := r.aliases[pattern]; ok {
+			matchingSingleNames = append(matchingSingleNames, r.expandAlias(alias, expansion)...)
 			continue
 		}
 
-		for indexName := range r.conf.IndexConfig {
-			if matches, _ := util.IndexPatternMatches(pattern, indexName); matches {
-				matchingSingleNames = append(matchingSingleNames, indexName)
-			}
+		for _, indexName := range r.matchingIndexNames(pattern) {
+			matchingSingleNames = append(matchingSingleNames, indexName)
+			expansion.add(indexName, nil)
 		}
 
-		// but maybe we should also check against the actual indexes ??
-		for indexName := range r.elasticIndexes {
-			if matches, _ := util.IndexPatternMatches(pattern, indexName); matches {
-				matchingSingleNames = append(matchingSingleNames, indexName)
-			}
-		}
-		if r.conf.AutodiscoveryEnabled {
-			for tableName := range r.clickhouseIndexes {
-				if matches, _ := util.IndexPatternMatches(pattern, tableName); matches {
-					matchingSingleNames = append(matchingSingleNames, tableName)
+		// aliases matching the pattern are expanded as well
+		if elasticsearch.IsIndexPattern(pattern) && !elasticsearch.IsInternalIndex(pattern) {
+			for aliasName, alias := range r.aliases {
+				if matches, _ := util.IndexPatternMatches(pattern, aliasName); matches {
+					matchingSingleNames = append(matchingSingleNames, r.expandAlias(alias, expansion)...)
 				}
 			}
 		}
@@ -56,13 +47,47 @@ func (r *tableRegistryImpl) wildcardPatternSplitter(pattern string) (parsedPatte
 	matchingSingleNames = util.Distinct(matchingSingleNames)
 
 	return parsedPattern{
-		source:    pattern,
-		isPattern: len(patterns) > 1 || strings.Contains(pattern, "*"),
-		parts:     matchingSingleNames,
+		source:       pattern,
+		isPattern:    len(patterns) > 1 || strings.Contains(pattern, "*"),
+		parts:        matchingSingleNames,
+		aliasFilters: expansion.indexFilters(),
 	}, nil
 }
 
-func singleIndexSplitter(pattern string) (parsedPattern, *quesma_api.Decision) {
+// matchingIndexNames returns index names matching the pattern, a single index name is returned as is
+func (r *tableRegistryImpl) matchingIndexNames(pattern string) []string {
+	// If pattern is not an actual pattern (so it's a single index), just return it
+	// and skip further processing.
+	// If pattern is an internal Kibana index, return it without any processing - resolveInternalElasticName
+	// will take care of it.
+	if !elasticsearch.IsIndexPattern(pattern) || elasticsearch.IsInternalIndex(pattern) {
+		return []string{pattern}
+	}
+
+	var matchingSingleNames []string
+	for indexName := range r.conf.IndexConfig {
+		if matches, _ := util.IndexPatternMatches(pattern, indexName); matches {
+			matchingSingleNames = append(matchingSingleNames, indexName)
+		}
+	}
+
+	// but maybe we should also check against the actual indexes ??
+	for indexName := range r.elasticIndexes {
+		if matches, _ := util.IndexPatternMatches(pattern, indexName); matches {
+			matchingSingleNames = append(matchingSingleNames, indexName)
+		}
+	}
+	if r.conf.AutodiscoveryEnabled {
+		for tableName := range r.clickhouseIndexes {
+			if matches, _ := util.IndexPatternMatches(pattern, tableName); matches {
+				matchingSingleNames = append(matchingSingleNames, tableName)
+			}
+		}
+	}
+	return matchingSingleNames
+}
+
+func (r *tableRegistryImpl) singleIndexSplitter(pattern string) (parsedPattern, *quesma_api.Decision) {
 	patterns := strings.Split(pattern, ",")
 	if len(patterns) > 1 || strings.Contains(pattern, "*") {
 		return parsedPattern{}, &quesma_api.Decision{
@@ -71,6 +96,18 @@ func singleIndexSplitter(pattern string) (parsedPattern, *quesma_api.Decision) {
 		}
 	}
 
+	// documents sent to an alias are written to its write index
+	if alias, ok := r.aliases[pattern]; ok {
+		writeIndex, err := alias.writeIndex()
+		if err != nil {
+			return parsedPattern{}, &quesma_api.Decision{
+				Reason: "Alias has no write index.",
+				Err:    err,
+			}
+		}
+		patterns = []string{writeIndex}
+	}
+
 	return parsedPattern{
 		source:    pattern,
 		isPattern: false,
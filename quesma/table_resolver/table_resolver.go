@@ -9,6 +9,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/config"
 	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
 	"github.com/QuesmaOrg/quesma/quesma/logger"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
 	"github.com/QuesmaOrg/quesma/quesma/recovery"
 	"github.com/QuesmaOrg/quesma/quesma/types"
 	"github.com/QuesmaOrg/quesma/quesma/v2/core"
@@ -26,8 +27,9 @@ type parsedPattern struct {
 	source string
 
 	// parsed data
-	isPattern bool
-	parts     []string
+	isPattern    bool
+	parts        []string
+	aliasFilters map[string]any // index name -> filter of aliases the index was matched by
 }
 
 type patternSplitter struct {
@@ -75,7 +77,15 @@ func (ir *compoundResolver) resolve(indexName string) *quesma_api.Decision {
 		}
 	}
 
-	return ir.decisionMerger.merger(decisions)
+	merged := ir.decisionMerger.merger(decisions)
+	if input.aliasFilters != nil {
+		for _, connectorDecision := range merged.UseConnectors {
+			if clickhouseDecision, ok := connectorDecision.(*quesma_api.ConnectorDecisionClickhouse); ok {
+				clickhouseDecision.AliasFilters = input.aliasFilters
+			}
+		}
+	}
+	return merged
 }
 
 // HACK: we should have separate config for each pipeline
@@ -117,6 +127,12 @@ type tableRegistryImpl struct {
 
 	pipelineResolvers map[string]*pipelineResolver
 	conf              config.QuesmaConfiguration
+
+	aliasStorage persistence.JSONDatabase
+	aliases      map[string]Alias
+
+	closedIndexStorage persistence.JSONDatabase
+	closedIndexes      map[string]bool
 }
 
 func (r *tableRegistryImpl) Resolve(pipeline string, indexPattern string) *quesma_api.Decision {
@@ -278,7 +294,7 @@ func (r *tableRegistryImpl) Pipelines() []string {
 	return res
 }
 
-func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhouse.TableDiscovery, elasticResolver elasticsearch.IndexManagement) TableResolver {
+func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhouse.TableDiscovery, elasticResolver elasticsearch.IndexManagement, aliasStorage persistence.JSONDatabase, closedIndexStorage persistence.JSONDatabase) TableResolver {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	indexConf := quesmaConf.IndexConfig
@@ -292,6 +308,12 @@ func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhous
 		tableDiscovery:    discovery,
 		indexManager:      elasticResolver,
 		pipelineResolvers: make(map[string]*pipelineResolver),
+
+		aliasStorage: aliasStorage,
+		aliases:      make(map[string]Alias),
+
+		closedIndexStorage: closedIndexStorage,
+		closedIndexes:      make(map[string]bool),
 	}
 
 	// TODO Here we should read the config and create resolver for each pipeline defined.
@@ -303,10 +325,11 @@ func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhous
 		resolver: &compoundResolver{
 			patternSplitter: patternSplitter{
 				name:     "singleIndexSplitter",
-				resolver: singleIndexSplitter,
+				resolver: res.singleIndexSplitter,
 			},
 			decisionLadder: []basicResolver{
 				{"kibanaInternal", resolveInternalElasticName},
+				{"closed", res.resolveClosedIndex},
 				{"disabled", makeIsDisabledInConfig(indexConf, quesma_api.IngestPipeline)},
 
 				{"singleIndex", res.singleIndex(indexConf, quesma_api.IngestPipeline)},
@@ -335,6 +358,7 @@ func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhous
 			decisionLadder: []basicResolver{
 				// checking if we can handle the parsedPattern
 				{"kibanaInternal", resolveInternalElasticName},
+				{"closed", res.resolveClosedIndex},
 				{"disabled", makeIsDisabledInConfig(indexConf, quesma_api.QueryPipeline)},
 
 				{"singleIndex", res.singleIndex(indexConf, quesma_api.QueryPipeline)},
@@ -353,6 +377,8 @@ func NewTableResolver(quesmaConf config.QuesmaConfiguration, discovery clickhous
 
 	res.pipelineResolvers[quesma_api.QueryPipeline] = queryResolver
 	// update the state ASAP
+	res.loadAliases()
+	res.loadClosedIndexes()
 	res.updateState()
 	return res
 }
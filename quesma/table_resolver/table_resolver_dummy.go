@@ -4,6 +4,7 @@
 package table_resolver
 
 import (
+	"fmt"
 	"github.com/QuesmaOrg/quesma/quesma/common_table"
 	"github.com/QuesmaOrg/quesma/quesma/config"
 	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
@@ -50,6 +51,22 @@ func (t DummyTableResolver) RecentDecisions() []mux.PatternDecisions {
 	return []mux.PatternDecisions{}
 }
 
+func (t DummyTableResolver) UpdateAliases(_ []AliasAction) error {
+	return fmt.Errorf("aliases are not supported by DummyTableResolver")
+}
+
+func (t DummyTableResolver) Aliases() []Alias { return nil }
+
+func (t DummyTableResolver) CloseIndex(_ string) error {
+	return fmt.Errorf("closing indexes is not supported by DummyTableResolver")
+}
+
+func (t DummyTableResolver) OpenIndex(_ string) error {
+	return fmt.Errorf("opening indexes is not supported by DummyTableResolver")
+}
+
+func (t DummyTableResolver) ClosedIndexes() []string { return nil }
+
 func (t DummyTableResolver) resolveElastic() *mux.Decision {
 	return &mux.Decision{
 		UseConnectors: []mux.ConnectorDecision{
@@ -8,6 +8,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/common_table"
 	"github.com/QuesmaOrg/quesma/quesma/config"
 	"github.com/QuesmaOrg/quesma/quesma/elasticsearch"
+	"github.com/QuesmaOrg/quesma/quesma/persistence"
 	mux "github.com/QuesmaOrg/quesma/quesma/v2/core"
 	"github.com/k0kubun/pp"
 	"github.com/stretchr/testify/assert"
@@ -418,7 +419,7 @@ func TestTableResolver(t *testing.T) {
 
 			elasticResolver := elasticsearch.NewFixedIndexManagement(tt.elasticIndexes...)
 
-			resolver := NewTableResolver(currentQuesmaConf, tableDiscovery, elasticResolver)
+			resolver := NewTableResolver(currentQuesmaConf, tableDiscovery, elasticResolver, persistence.NewStaticJSONDatabase(), persistence.NewStaticJSONDatabase())
 
 			decision := resolver.Resolve(tt.pipeline, tt.pattern)
 
@@ -4411,7 +4411,7 @@ var AggregationTests = []AggregationTestCase{
 			WHERE ("timestamp">=fromUnixTimestamp64Milli(1712388530059) AND "timestamp"<=fromUnixTimestamp64Milli(1713288530059))`,
 	},
 	{ // [23]
-		TestName: "significant terms aggregation: same as terms for now",
+		TestName: "significant terms aggregation: match_all query, so foreground is the same as background and no term is significant",
 		QueryRequestJson: `
 		{
 			"_source": {
@@ -4472,20 +4472,7 @@ var AggregationTests = []AggregationTestCase{
 					"2": {
 						"bg_count": 825,
 						"doc_count": 825,
-						"buckets": [
-							{
-								"bg_count": 619,
-								"doc_count": 619,
-								"key": "a",
-								"score": 619
-							},
-							{
-								"bg_count": 206,
-								"doc_count": 206,
-								"key": "zip",
-								"score": 206
-							}
-						]
+						"buckets": []
 					}
 				},
 				"hits": {
@@ -4504,22 +4491,43 @@ var AggregationTests = []AggregationTestCase{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__2__parent_count", uint64(825)),
 				model.NewQueryResultCol("aggr__2__key_0", "a"),
+				model.NewQueryResultCol("aggr__2__key_1", uint64(619)),
+				model.NewQueryResultCol("aggr__2__key_2", uint64(825)),
 				model.NewQueryResultCol("aggr__2__count", uint64(619)),
 			}},
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__2__parent_count", uint64(825)),
 				model.NewQueryResultCol("aggr__2__key_0", "zip"),
+				model.NewQueryResultCol("aggr__2__key_1", uint64(206)),
+				model.NewQueryResultCol("aggr__2__key_2", uint64(825)),
 				model.NewQueryResultCol("aggr__2__count", uint64(206)),
 			}},
 		},
 		ExpectedPancakeSQL: `
-			SELECT sum(count(*)) OVER () AS "aggr__2__parent_count",
-			  "message" AS "aggr__2__key_0", 
-			  count(*) AS "aggr__2__count"
-			FROM ` + TableName + `
-			GROUP BY "message" AS "aggr__2__key_0"
-			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 5`,
+			WITH quesma_significant_terms_group_table AS (
+			  SELECT sum(count(*)) OVER () AS "aggr__2__parent_count",
+			    "message" AS "aggr__2__key_0", count(*) AS "aggr__2__count"
+			  FROM ` + TableName + `
+			  GROUP BY "message" AS "aggr__2__key_0"
+			  ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
+			  LIMIT 33) ,
+			quesma_significant_terms_background_1 AS (
+			  SELECT "message" AS "aggr__2__key_0", count(*) AS "aggr__2__key_1"
+			  FROM __quesma_table_name
+			  WHERE "message" IN (
+			    SELECT "aggr__2__key_0"
+			    FROM quesma_significant_terms_group_table)
+			  GROUP BY "message" AS "aggr__2__key_0")
+			SELECT "group_table"."aggr__2__parent_count" AS "aggr__2__parent_count",
+			  "group_table"."aggr__2__key_0" AS "aggr__2__key_0",
+			  "background_1"."aggr__2__key_1" AS "aggr__2__key_1", (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__key_2",
+			  "group_table"."aggr__2__count" AS "aggr__2__count"
+			FROM quesma_significant_terms_group_table AS "group_table" LEFT OUTER JOIN
+			  quesma_significant_terms_background_1 AS "background_1" ON (
+			  "group_table"."aggr__2__key_0"="background_1"."aggr__2__key_0")
+			ORDER BY "group_table"."aggr__2__count" DESC, "group_table"."aggr__2__key_0" ASC`,
 	},
 	{ // [24]
 		TestName: "meta field in aggregation",
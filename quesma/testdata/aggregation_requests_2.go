@@ -550,7 +550,7 @@ var AggregationTests2 = []AggregationTestCase{
 			},
 			"aggregations": {
 				"2": {
-					"bg_count": 2786,
+					"bg_count": 14074,
 					"doc_count": 2786,
 					"buckets": [
 						{
@@ -571,10 +571,10 @@ var AggregationTests2 = []AggregationTestCase{
 							"2": {
 								"value": 10
 							},
-							"bg_count": 2570,
+							"bg_count": 12000,
 							"doc_count": 2570,
 							"key": "200",
-							"score": 2570
+							"score": 0.07555298842346969
 						}
 					]
 				}
@@ -594,6 +594,8 @@ var AggregationTests2 = []AggregationTestCase{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__2__parent_count", 2786),
 				model.NewQueryResultCol("aggr__2__key_0", "200"),
+				model.NewQueryResultCol("aggr__2__key_1", uint64(12000)),
+				model.NewQueryResultCol("aggr__2__key_2", uint64(14074)),
 				model.NewQueryResultCol("aggr__2__count", 2570),
 				model.NewQueryResultCol("metric__2__1_col_0", []time.Time{util.ParseTime("2024-04-21T06:11:13.619Z")}),
 				model.NewQueryResultCol("metric__2__1_col_1", []time.Time{util.ParseTime("2024-04-21T12:21:13.414Z")}),
@@ -601,16 +603,38 @@ var AggregationTests2 = []AggregationTestCase{
 			}},
 		},
 		ExpectedPancakeSQL: `
-			SELECT sum(count(*)) OVER () AS "aggr__2__parent_count",
-			  "response" AS "aggr__2__key_0", count(*) AS "aggr__2__count",
-			  quantiles(0.010000)("timestamp") AS "metric__2__1_col_0",
-			  quantiles(0.020000)("timestamp") AS "metric__2__1_col_1",
-			  sumOrNull("count") AS "metric__2__2_col_0"
-			FROM __quesma_table_name
-			WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401475845) AND "timestamp"<=fromUnixTimestamp64Milli(1714697475845))
-			GROUP BY "response" AS "aggr__2__key_0"
-			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 4`,
+			WITH quesma_significant_terms_group_table AS (
+			  SELECT sum(count(*)) OVER () AS "aggr__2__parent_count",
+			    "response" AS "aggr__2__key_0", count(*) AS "aggr__2__count",
+			    quantiles(0.010000)("timestamp") AS "metric__2__1_col_0",
+			    quantiles(0.020000)("timestamp") AS "metric__2__1_col_1",
+			    sumOrNull("count") AS "metric__2__2_col_0"
+			  FROM __quesma_table_name
+			  WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401475845) AND "timestamp"<=
+			    fromUnixTimestamp64Milli(1714697475845))
+			  GROUP BY "response" AS "aggr__2__key_0"
+			  ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
+			  LIMIT 30) ,
+			quesma_significant_terms_background_1 AS (
+			  SELECT "response" AS "aggr__2__key_0", count(*) AS "aggr__2__key_1"
+			  FROM __quesma_table_name
+			  WHERE "response" IN (
+			    SELECT "aggr__2__key_0"
+			    FROM quesma_significant_terms_group_table)
+			  GROUP BY "response" AS "aggr__2__key_0")
+			SELECT "group_table"."aggr__2__parent_count" AS "aggr__2__parent_count",
+			  "group_table"."aggr__2__key_0" AS "aggr__2__key_0",
+			  "background_1"."aggr__2__key_1" AS "aggr__2__key_1", (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__key_2",
+			  "group_table"."aggr__2__count" AS "aggr__2__count",
+			  "group_table"."metric__2__1_col_0" AS "metric__2__1_col_0",
+			  "group_table"."metric__2__1_col_1" AS "metric__2__1_col_1",
+			  "group_table"."metric__2__2_col_0" AS "metric__2__2_col_0"
+			FROM quesma_significant_terms_group_table AS "group_table" LEFT OUTER JOIN
+			  quesma_significant_terms_background_1 AS "background_1" ON (
+			  "group_table"."aggr__2__key_0"="background_1"."aggr__2__key_0")
+			ORDER BY "group_table"."aggr__2__count" DESC, "group_table"."aggr__2__key_0" ASC`,
 	},
 	{ // [44]
 		TestName: "2x terms with nulls 1/4, nulls in second aggregation, with missing parameter",
@@ -5442,4 +5466,2395 @@ var AggregationTests2 = []AggregationTestCase{
 			ORDER BY "aggr__terms__count" DESC, "aggr__terms__key_0" ASC
 			LIMIT 1`,
 	},
+	{ // [79]
+		TestName: "geohash_grid with geo_bounds",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"grid": {
+					"geohash_grid": {
+						"field": "OriginLocation",
+						"precision": 3,
+						"size": 2
+					},
+					"aggs": {
+						"bounds": {
+							"geo_bounds": {
+								"field": "OriginLocation"
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 17,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"grid": {
+					"buckets": [
+						{
+							"key": "u09",
+							"doc_count": 12,
+							"bounds": {
+								"bounds": {
+									"top_left": {
+										"lat": 48.9,
+										"lon": 2.2
+									},
+									"bottom_right": {
+										"lat": 48.7,
+										"lon": 2.5
+									}
+								}
+							}
+						},
+						{
+							"key": "gcp",
+							"doc_count": 5,
+							"bounds": {
+								"bounds": {
+									"top_left": {
+										"lat": 51.6,
+										"lon": -0.5
+									},
+									"bottom_right": {
+										"lat": 51.4,
+										"lon": 0.1
+									}
+								}
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__grid__key_0", "u09"),
+				model.NewQueryResultCol("aggr__grid__count", int64(12)),
+				model.NewQueryResultCol("metric__grid__bounds_col_0", 48.9),
+				model.NewQueryResultCol("metric__grid__bounds_col_1", 2.2),
+				model.NewQueryResultCol("metric__grid__bounds_col_2", 48.7),
+				model.NewQueryResultCol("metric__grid__bounds_col_3", 2.5),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__grid__key_0", "gcp"),
+				model.NewQueryResultCol("aggr__grid__count", int64(5)),
+				model.NewQueryResultCol("metric__grid__bounds_col_0", 51.6),
+				model.NewQueryResultCol("metric__grid__bounds_col_1", -0.5),
+				model.NewQueryResultCol("metric__grid__bounds_col_2", 51.4),
+				model.NewQueryResultCol("metric__grid__bounds_col_3", 0.1),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT geohashEncode(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(
+			  __quesma_geo_lat("OriginLocation")), 3) AS "aggr__grid__key_0",
+			  count(*) AS "aggr__grid__count",
+			  maxOrNull(CAST(__quesma_geo_lat("originlocation"), 'Float')) AS
+			  "metric__grid__bounds_col_0",
+			  minOrNull(CAST(__quesma_geo_lon("originlocation"), 'Float')) AS
+			  "metric__grid__bounds_col_1",
+			  minOrNull(CAST(__quesma_geo_lat("originlocation"), 'Float')) AS
+			  "metric__grid__bounds_col_2",
+			  maxOrNull(CAST(__quesma_geo_lon("originlocation"), 'Float')) AS
+			  "metric__grid__bounds_col_3"
+			FROM __quesma_table_name
+			GROUP BY geohashEncode(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(
+			  __quesma_geo_lat("OriginLocation")), 3) AS "aggr__grid__key_0"
+			ORDER BY "aggr__grid__count" DESC, "aggr__grid__key_0" ASC
+			LIMIT 2`,
+	},
+	{ // [80]
+		TestName: "geohex_grid",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"grid": {
+					"geohex_grid": {
+						"field": "OriginLocation",
+						"precision": 6
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"grid": {
+					"buckets": [
+						{
+							"key": "861fb4667ffffff",
+							"doc_count": 7
+						},
+						{
+							"key": "86195da4fffffff",
+							"doc_count": 3
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__grid__key_0", uint64(0x861fb4667ffffff)),
+				model.NewQueryResultCol("aggr__grid__count", int64(7)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__grid__key_0", uint64(0x86195da4fffffff)),
+				model.NewQueryResultCol("aggr__grid__count", int64(3)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT geoToH3(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(
+			  __quesma_geo_lat("OriginLocation")), 6) AS "aggr__grid__key_0",
+			  count(*) AS "aggr__grid__count"
+			FROM __quesma_table_name
+			GROUP BY geoToH3(toFloat64(__quesma_geo_lon("OriginLocation")), toFloat64(
+			  __quesma_geo_lat("OriginLocation")), 6) AS "aggr__grid__key_0"
+			ORDER BY "aggr__grid__count" DESC, "aggr__grid__key_0" ASC
+			LIMIT 10000`,
+	},
+	{ // [81]
+		TestName: "rare_terms",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"rare": {
+					"rare_terms": {
+						"field": "message",
+						"max_doc_count": 2
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"rare": {
+					"buckets": [
+						{
+							"key": "a",
+							"doc_count": 1
+						},
+						{
+							"key": "b",
+							"doc_count": 2
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__rare__key_0", "a"),
+				model.NewQueryResultCol("aggr__rare__count", int64(1)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__rare__key_0", "b"),
+				model.NewQueryResultCol("aggr__rare__count", int64(2)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__rare__key_0", "c"),
+				model.NewQueryResultCol("aggr__rare__count", int64(3)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "message" AS "aggr__rare__key_0", count(*) AS "aggr__rare__count"
+			FROM __quesma_table_name
+			GROUP BY "message" AS "aggr__rare__key_0"
+			ORDER BY "aggr__rare__count" ASC, "aggr__rare__key_0" ASC
+			LIMIT 10001`,
+	},
+	{ // [82]
+		TestName: "adjacency_matrix",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"interactions": {
+					"adjacency_matrix": {
+						"filters": {
+							"grpA": {
+								"terms": {
+									"message": ["a", "b"]
+								}
+							},
+							"grpB": {
+								"term": {
+									"message": "c"
+								}
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"interactions": {
+					"buckets": [
+						{
+							"key": "grpA",
+							"doc_count": 5
+						},
+						{
+							"key": "grpB",
+							"doc_count": 2
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("adjacency_0__aggr__interactions__count", int64(5)),
+				model.NewQueryResultCol("adjacency_1__aggr__interactions__count", int64(0)),
+				model.NewQueryResultCol("adjacency_2__aggr__interactions__count", int64(2)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf("message" IN tuple('a', 'b')) AS
+			  "adjacency_0__aggr__interactions__count",
+			  countIf(("message" IN tuple('a', 'b') AND "message"='c')) AS
+			  "adjacency_1__aggr__interactions__count",
+			  countIf("message"='c') AS "adjacency_2__aggr__interactions__count"
+			FROM __quesma_table_name`,
+	},
+	{ // [83]
+		TestName: "missing",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"no_message": {
+					"missing": {
+						"field": "message"
+					},
+					"aggs": {
+						"max_bytes": {
+							"max": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"no_message": {
+					"doc_count": 3,
+					"max_bytes": {
+						"value": 100
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__no_message__count", int64(3)),
+				model.NewQueryResultCol("metric__no_message__max_bytes_col_0", int64(100)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf("message" IS NULL) AS "aggr__no_message__count",
+			  maxOrNullIf("bytes_gauge", "message" IS NULL) AS
+			  "metric__no_message__max_bytes_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [84]
+		TestName: "global with query and sibling aggregation",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"query": {
+				"term": {
+					"message": "error"
+				}
+			},
+			"aggs": {
+				"all": {
+					"global": {},
+					"aggs": {
+						"avg_bytes": {
+							"avg": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				},
+				"avg_bytes": {
+					"avg": {
+						"field": "bytes_gauge"
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"all": {
+					"doc_count": 100,
+					"avg_bytes": {
+						"value": 50.5
+					}
+				},
+				"avg_bytes": {
+					"value": 7.5
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__avg_bytes_col_0", 7.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT avgOrNull("bytes_gauge") AS "metric__avg_bytes_col_0"
+			FROM __quesma_table_name
+			WHERE "message"='error'`,
+		ExpectedAdditionalPancakeResults: [][]model.QueryResultRow{
+			{
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__all__count", int64(100)),
+					model.NewQueryResultCol("metric__all__avg_bytes_col_0", 50.5),
+				}},
+			},
+		},
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT count(*) AS "aggr__all__count",
+			  avgOrNull("bytes_gauge") AS "metric__all__avg_bytes_col_0"
+			FROM __quesma_table_name`,
+		},
+	},
+	{ // [85]
+		TestName: "diversified_sampler",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"sample": {
+					"diversified_sampler": {
+						"shard_size": 200,
+						"field": "host.name",
+						"max_docs_per_value": 3
+					},
+					"aggs": {
+						"keywords": {
+							"terms": {
+								"field": "message",
+								"size": 2
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"sample": {
+					"doc_count": 15,
+					"keywords": {
+						"doc_count_error_upper_bound": 0,
+						"sum_other_doc_count": 5,
+						"buckets": [
+							{
+								"key": "a",
+								"doc_count": 6
+							},
+							{
+								"key": "b",
+								"doc_count": 4
+							}
+						]
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__sample__count", int64(15)),
+				model.NewQueryResultCol("aggr__sample__keywords__parent_count", int64(15)),
+				model.NewQueryResultCol("aggr__sample__keywords__key_0", "a"),
+				model.NewQueryResultCol("aggr__sample__keywords__count", int64(6)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__sample__count", int64(15)),
+				model.NewQueryResultCol("aggr__sample__keywords__parent_count", int64(15)),
+				model.NewQueryResultCol("aggr__sample__keywords__key_0", "b"),
+				model.NewQueryResultCol("aggr__sample__keywords__count", int64(4)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__sample__count",
+			  sum(count(*)) OVER () AS "aggr__sample__keywords__parent_count",
+			  "message" AS "aggr__sample__keywords__key_0",
+			  count(*) AS "aggr__sample__keywords__count"
+			FROM (
+			  SELECT "message"
+			  FROM (
+			    SELECT *
+			    FROM __quesma_table_name
+			    LIMIT 3 BY "host.name")
+			  LIMIT 800)
+			GROUP BY "message" AS "aggr__sample__keywords__key_0"
+			ORDER BY "aggr__sample__keywords__count" DESC,
+			  "aggr__sample__keywords__key_0" ASC
+			LIMIT 3`,
+	},
+	{ // [86]
+		TestName: "variable_width_histogram",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"prices": {
+					"variable_width_histogram": {
+						"field": "bytes_gauge",
+						"buckets": 3
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"prices": {
+					"buckets": [
+						{
+							"min": 1,
+							"key": 3,
+							"max": 5,
+							"doc_count": 4
+						},
+						{
+							"min": 10,
+							"key": 15,
+							"max": 20,
+							"doc_count": 6
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__prices_col_0", []any{
+					[]any{1.0, 5.0, 4.0},
+					[]any{5.0, 10.0, 0.0},
+					[]any{10.0, 20.0, 6.0},
+				}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT histogram(3)(toFloat64("bytes_gauge")) AS "metric__prices_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [87]
+		TestName: "weighted_avg",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"weighted": {
+					"weighted_avg": {
+						"value": {
+							"field": "bytes_gauge"
+						},
+						"weight": {
+							"field": "weight",
+							"missing": 1
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"weighted": {
+					"value": 70.5
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__weighted_col_0", 70.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT avgWeightedOrNull("bytes_gauge", COALESCE("weight", 1)) AS
+			  "metric__weighted_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [88]
+		TestName: "median_absolute_deviation",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"mad": {
+					"median_absolute_deviation": {
+						"field": "bytes_gauge",
+						"compression": 1000
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"mad": {
+					"value": 2.5
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__mad_col_0", 2.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT arrayReduce('quantileExact(0.5)', arrayMap((x, y) -> abs(x-y), groupArray
+			  ("bytes_gauge"), arrayWithConstant(count("bytes_gauge"), quantileExact(0.5)(
+			  "bytes_gauge")))) AS "metric__mad_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [89]
+		TestName: "boxplot",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"load_time": {
+					"boxplot": {
+						"field": "bytes_gauge"
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"load_time": {
+					"min": 0,
+					"max": 990,
+					"q1": 167.5,
+					"q2": 445,
+					"q3": 722.5,
+					"lower": 0,
+					"upper": 990
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__load_time_col_0", int64(0)),
+				model.NewQueryResultCol("metric__load_time_col_1", int64(990)),
+				model.NewQueryResultCol("metric__load_time_col_2", []float64{167.5, 445, 722.5}),
+				model.NewQueryResultCol("metric__load_time_col_3", int64(0)),
+				model.NewQueryResultCol("metric__load_time_col_4", int64(990)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT minOrNull("bytes_gauge") AS "metric__load_time_col_0",
+			  maxOrNull("bytes_gauge") AS "metric__load_time_col_1",
+			  quantilesExact(0.25, 0.5, 0.75)("bytes_gauge") AS "metric__load_time_col_2",
+			  arrayMin(arrayFilter((x, y) -> x>=y, groupArray("bytes_gauge"),
+			  arrayWithConstant(count("bytes_gauge"), quantileExact(0.25)("bytes_gauge")-1.5
+			  *(quantileExact(0.75)("bytes_gauge")-quantileExact(0.25)("bytes_gauge"))))) AS
+			  "metric__load_time_col_3",
+			  arrayMax(arrayFilter((x, y) -> x<=y, groupArray("bytes_gauge"),
+			  arrayWithConstant(count("bytes_gauge"), quantileExact(0.75)("bytes_gauge")+1.5
+			  *(quantileExact(0.75)("bytes_gauge")-quantileExact(0.25)("bytes_gauge"))))) AS
+			  "metric__load_time_col_4"
+			FROM __quesma_table_name`,
+	},
+	{ // [90]
+		TestName: "string_stats",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"message_stats": {
+					"string_stats": {
+						"field": "message",
+						"show_distribution": true
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"message_stats": {
+					"count": 2,
+					"min_length": 1,
+					"max_length": 3,
+					"avg_length": 2.0,
+					"entropy": 1.5,
+					"distribution": {
+						"a": 0.5,
+						"b": 0.25,
+						"c": 0.25
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__message_stats_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__message_stats_col_1", uint64(1)),
+				model.NewQueryResultCol("metric__message_stats_col_2", uint64(3)),
+				model.NewQueryResultCol("metric__message_stats_col_3", 2.0),
+				model.NewQueryResultCol("metric__message_stats_col_4", []any{[]string{"a", "b", "c"}, []uint64{2, 1, 1}}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT count("message") AS "metric__message_stats_col_0",
+			  minOrNull(lengthUTF8("message")) AS "metric__message_stats_col_1",
+			  maxOrNull(lengthUTF8("message")) AS "metric__message_stats_col_2",
+			  avgOrNull(lengthUTF8("message")) AS "metric__message_stats_col_3",
+			  sumMap(ngrams(COALESCE("message", ''), 1), arrayWithConstant(lengthUTF8(
+			  COALESCE("message", '')), 1)) AS "metric__message_stats_col_4"
+			FROM __quesma_table_name`,
+	},
+	{ // [91]
+		TestName: "rate in monthly date_histogram",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"by_date": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"calendar_interval": "month"
+					},
+					"aggs": {
+						"per_year": {
+							"rate": {
+								"field": "bytes_gauge",
+								"unit": "year"
+							}
+						},
+						"per_day": {
+							"rate": {
+								"unit": "day"
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"by_date": {
+					"buckets": [
+						{
+							"key_as_string": "2015-01-01T00:00:00.000",
+							"key": 1420070400000,
+							"doc_count": 3,
+							"per_year": {
+								"value": 6600.0
+							},
+							"per_day": {
+								"value": 0.0967741935483871
+							}
+						},
+						{
+							"key_as_string": "2015-02-01T00:00:00.000",
+							"key": 1422748800000,
+							"doc_count": 2,
+							"per_year": {
+								"value": 720.0
+							},
+							"per_day": {
+								"value": 0.07142857142857142
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_date__key_0", int64(1420070400000)),
+				model.NewQueryResultCol("aggr__by_date__count", int64(3)),
+				model.NewQueryResultCol("metric__by_date__per_day_col_0", int64(3)),
+				model.NewQueryResultCol("metric__by_date__per_day_col_1", util.ParseTime("2015-01-03T10:00:00.000Z")),
+				model.NewQueryResultCol("metric__by_date__per_year_col_0", int64(550)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_date__key_0", int64(1422748800000)),
+				model.NewQueryResultCol("aggr__by_date__count", int64(2)),
+				model.NewQueryResultCol("metric__by_date__per_day_col_0", int64(2)),
+				model.NewQueryResultCol("metric__by_date__per_day_col_1", util.ParseTime("2015-02-28T23:00:00.000Z")),
+				model.NewQueryResultCol("metric__by_date__per_year_col_0", int64(60)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp(toStartOfMonth(toTimezone("@timestamp", 'UTC'))))
+			  *1000 AS "aggr__by_date__key_0", count(*) AS "aggr__by_date__count",
+			  count(*) AS "metric__by_date__per_day_col_0",
+			  minOrNull("@timestamp") AS "metric__by_date__per_day_col_1",
+			  sumOrNull("bytes_gauge") AS "metric__by_date__per_year_col_0"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp(toStartOfMonth(toTimezone("@timestamp", 'UTC'))
+			  ))*1000 AS "aggr__by_date__key_0"
+			ORDER BY "aggr__by_date__key_0" ASC`,
+	},
+	{ // [92]
+		TestName: "t_test heteroscedastic with filters",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"startup_time_ttest": {
+					"t_test": {
+						"a": {
+							"field": "bytes_gauge",
+							"filter": {
+								"term": {
+									"message": "A"
+								}
+							}
+						},
+						"b": {
+							"field": "bytes_gauge",
+							"filter": {
+								"term": {
+									"message": "B"
+								}
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"startup_time_ttest": {
+					"value": 0.18350341907227397
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__startup_time_ttest_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_1", 3.0),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_2", 1.0),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_3", uint64(2)),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_4", 1.0),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_5", 1.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf("bytes_gauge", "message"='A') AS
+			  "metric__startup_time_ttest_col_0",
+			  avgOrNullIf("bytes_gauge", "message"='A') AS
+			  "metric__startup_time_ttest_col_1",
+			  varSampIf("bytes_gauge", "message"='A') AS "metric__startup_time_ttest_col_2",
+			  countIf("bytes_gauge", "message"='B') AS "metric__startup_time_ttest_col_3",
+			  avgOrNullIf("bytes_gauge", "message"='B') AS
+			  "metric__startup_time_ttest_col_4",
+			  varSampIf("bytes_gauge", "message"='B') AS "metric__startup_time_ttest_col_5"
+			FROM __quesma_table_name`,
+	},
+	{ // [93]
+		TestName: "t_test paired",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"startup_time_ttest": {
+					"t_test": {
+						"a": {
+							"field": "startup_time_before"
+						},
+						"b": {
+							"field": "startup_time_after"
+						},
+						"type": "paired"
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"startup_time_ttest": {
+					"value": 0.18350341907227397
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__startup_time_ttest_col_0", uint64(3)),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_1", 2.0),
+				model.NewQueryResultCol("metric__startup_time_ttest_col_2", 3.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT count("startup_time_before"-"startup_time_after") AS
+			  "metric__startup_time_ttest_col_0",
+			  avgOrNull("startup_time_before"-"startup_time_after") AS
+			  "metric__startup_time_ttest_col_1",
+			  varSamp("startup_time_before"-"startup_time_after") AS
+			  "metric__startup_time_ttest_col_2"
+			FROM __quesma_table_name`,
+	},
+	{ // [94]
+		TestName: "matrix_stats",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"statistics": {
+					"matrix_stats": {
+						"fields": ["poverty", "income"]
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"statistics": {
+					"doc_count": 50,
+					"fields": [
+						{
+							"name": "poverty",
+							"count": 50,
+							"mean": 12.732000000000001,
+							"variance": 8.637730612244896,
+							"skewness": 0.4516049811903419,
+							"kurtosis": 2.5902771458184396,
+							"covariance": {
+								"poverty": 8.637730612244896,
+								"income": -28013.642061224482
+							},
+							"correlation": {
+								"poverty": 1.0,
+								"income": -0.8352655256272504
+							}
+						},
+						{
+							"name": "income",
+							"count": 50,
+							"mean": 51985.1,
+							"variance": 1.2955068690612245E8,
+							"skewness": 0.5716959666044232,
+							"kurtosis": 2.1779116520364026,
+							"covariance": {
+								"poverty": -28013.642061224482,
+								"income": 1.2955068690612245E8
+							},
+							"correlation": {
+								"poverty": -0.8352655256272504,
+								"income": 1.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__statistics_col_0", uint64(50)),
+				model.NewQueryResultCol("metric__statistics_col_1", 12.732000000000001),
+				model.NewQueryResultCol("metric__statistics_col_2", 8.637730612244896),
+				model.NewQueryResultCol("metric__statistics_col_3", 0.4516049811903419),
+				model.NewQueryResultCol("metric__statistics_col_4", 2.5902771458184396),
+				model.NewQueryResultCol("metric__statistics_col_5", 51985.1),
+				model.NewQueryResultCol("metric__statistics_col_6", 1.2955068690612245e8),
+				model.NewQueryResultCol("metric__statistics_col_7", 0.5716959666044232),
+				model.NewQueryResultCol("metric__statistics_col_8", 2.1779116520364026),
+				model.NewQueryResultCol("metric__statistics_col_9", -28013.642061224482),
+				model.NewQueryResultCol("metric__statistics_col_10", -0.8352655256272504),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf(("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_0",
+			  avgOrNullIf("poverty", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_1",
+			  varSampIf("poverty", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_2",
+			  skewPopIf("poverty", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_3",
+			  kurtPopIf("poverty", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_4",
+			  avgOrNullIf("income", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_5",
+			  varSampIf("income", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_6",
+			  skewPopIf("income", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_7",
+			  kurtPopIf("income", ("poverty" IS NOT NULL AND "income" IS NOT NULL)) AS
+			  "metric__statistics_col_8",
+			  covarSampIf("poverty", "income", ("poverty" IS NOT NULL AND "income" IS NOT
+			  NULL)) AS "metric__statistics_col_9",
+			  corrIf("poverty", "income", ("poverty" IS NOT NULL AND "income" IS NOT NULL))
+			  AS "metric__statistics_col_10"
+			FROM __quesma_table_name`,
+	},
+	{ // [95]
+		TestName: "moving_fn, normalize and cumulative_cardinality in histogram",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"by_price": {
+					"histogram": {
+						"field": "price",
+						"interval": 10
+					},
+					"aggs": {
+						"the_sum": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"users": {
+							"cardinality": {
+								"field": "message"
+							}
+						},
+						"moving_avg": {
+							"moving_fn": {
+								"buckets_path": "the_sum",
+								"window": 2,
+								"script": "MovingFunctions.unweightedAvg(values)"
+							}
+						},
+						"normalized": {
+							"normalize": {
+								"buckets_path": "the_sum",
+								"method": "percent_of_sum"
+							}
+						},
+						"total_users": {
+							"cumulative_cardinality": {
+								"buckets_path": "users"
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"by_price": {
+					"buckets": [
+						{
+							"key": 0.0,
+							"doc_count": 2,
+							"the_sum": {
+								"value": 10.0
+							},
+							"users": {
+								"value": 2
+							},
+							"moving_avg": {
+								"value": null
+							},
+							"normalized": {
+								"value": 0.1
+							},
+							"total_users": {
+								"value": 2
+							}
+						},
+						{
+							"key": 10.0,
+							"doc_count": 1,
+							"the_sum": {
+								"value": 20.0
+							},
+							"users": {
+								"value": 1
+							},
+							"moving_avg": {
+								"value": 10.0
+							},
+							"normalized": {
+								"value": 0.2
+							},
+							"total_users": {
+								"value": 2
+							}
+						},
+						{
+							"key": 20.0,
+							"doc_count": 1,
+							"the_sum": {
+								"value": 30.0
+							},
+							"users": {
+								"value": 1
+							},
+							"moving_avg": {
+								"value": 15.0
+							},
+							"normalized": {
+								"value": 0.3
+							},
+							"total_users": {
+								"value": 3
+							}
+						},
+						{
+							"key": 30.0,
+							"doc_count": 2,
+							"the_sum": {
+								"value": 40.0
+							},
+							"users": {
+								"value": 2
+							},
+							"moving_avg": {
+								"value": 25.0
+							},
+							"normalized": {
+								"value": 0.4
+							},
+							"total_users": {
+								"value": 4
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_price__key_0", 0.0),
+				model.NewQueryResultCol("aggr__by_price__count", int64(2)),
+				model.NewQueryResultCol("metric__by_price__the_sum_col_0", 10.0),
+				model.NewQueryResultCol("metric__by_price__users_col_0", []string{"a", "b"}),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_price__key_0", 10.0),
+				model.NewQueryResultCol("aggr__by_price__count", int64(1)),
+				model.NewQueryResultCol("metric__by_price__the_sum_col_0", 20.0),
+				model.NewQueryResultCol("metric__by_price__users_col_0", []string{"b"}),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_price__key_0", 20.0),
+				model.NewQueryResultCol("aggr__by_price__count", int64(1)),
+				model.NewQueryResultCol("metric__by_price__the_sum_col_0", 30.0),
+				model.NewQueryResultCol("metric__by_price__users_col_0", []string{"c"}),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_price__key_0", 30.0),
+				model.NewQueryResultCol("aggr__by_price__count", int64(2)),
+				model.NewQueryResultCol("metric__by_price__the_sum_col_0", 40.0),
+				model.NewQueryResultCol("metric__by_price__users_col_0", []string{"a", "d"}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor("price"/10)*10 AS "aggr__by_price__key_0",
+			  count(*) AS "aggr__by_price__count",
+			  sumOrNull("bytes_gauge") AS "metric__by_price__the_sum_col_0",
+			  groupUniqArray("message") AS "metric__by_price__users_col_0"
+			FROM __quesma_table_name
+			GROUP BY floor("price"/10)*10 AS "aggr__by_price__key_0"
+			ORDER BY "aggr__by_price__key_0" ASC`,
+	},
+	{ // [96]
+		TestName: "bucket_selector and bucket_sort in terms",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"by_user": {
+					"terms": {
+						"field": "message",
+						"size": 4
+					},
+					"aggs": {
+						"total": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"big_only": {
+							"bucket_selector": {
+								"buckets_path": {
+									"total": "total",
+									"count": "_count"
+								},
+								"script": {
+									"source": "params.total > params.threshold && params.count >= 1",
+									"params": {
+										"threshold": 15
+									}
+								}
+							}
+						},
+						"sorted": {
+							"bucket_sort": {
+								"sort": [
+									{
+										"total": {
+											"order": "desc"
+										}
+									}
+								],
+								"size": 2
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"by_user": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "c",
+							"doc_count": 2,
+							"total": {
+								"value": 50.0
+							}
+						},
+						{
+							"key": "a",
+							"doc_count": 3,
+							"total": {
+								"value": 30.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "a"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(3)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 30.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "b"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(2)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 10.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "c"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(2)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 50.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "d"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(1)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 20.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__by_user__parent_count",
+			  "message" AS "aggr__by_user__key_0", count(*) AS "aggr__by_user__count",
+			  sumOrNull("bytes_gauge") AS "metric__by_user__total_col_0"
+			FROM __quesma_table_name
+			GROUP BY "message" AS "aggr__by_user__key_0"
+			ORDER BY "aggr__by_user__count" DESC, "aggr__by_user__key_0" ASC
+			LIMIT 5`,
+	},
+	{ // [97]
+		TestName: "stats_bucket and percentiles_bucket",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"by_user": {
+					"terms": {
+						"field": "message",
+						"size": 4
+					},
+					"aggs": {
+						"total": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				},
+				"stats": {
+					"stats_bucket": {
+						"buckets_path": "by_user>total"
+					}
+				},
+				"percentiles": {
+					"percentiles_bucket": {
+						"buckets_path": "by_user>total",
+						"percents": [25, 50, 99.9]
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 10,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"by_user": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "a",
+							"doc_count": 3,
+							"total": {
+								"value": 30.0
+							}
+						},
+						{
+							"key": "b",
+							"doc_count": 2,
+							"total": {
+								"value": 10.0
+							}
+						},
+						{
+							"key": "c",
+							"doc_count": 2,
+							"total": {
+								"value": 50.0
+							}
+						},
+						{
+							"key": "d",
+							"doc_count": 1,
+							"total": {
+								"value": 20.0
+							}
+						}
+					]
+				},
+				"stats": {
+					"count": 4,
+					"min": 10.0,
+					"max": 50.0,
+					"avg": 27.5,
+					"sum": 110.0
+				},
+				"percentiles": {
+					"values": {
+						"25.0": 20.0,
+						"50.0": 30.0,
+						"99.9": 50.0
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "a"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(3)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 30.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "b"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(2)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 10.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "c"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(2)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 50.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(8)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "d"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(1)),
+				model.NewQueryResultCol("metric__by_user__total_col_0", 20.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__by_user__parent_count",
+			  "message" AS "aggr__by_user__key_0", count(*) AS "aggr__by_user__count",
+			  sumOrNull("bytes_gauge") AS "metric__by_user__total_col_0"
+			FROM __quesma_table_name
+			GROUP BY "message" AS "aggr__by_user__key_0"
+			ORDER BY "aggr__by_user__count" DESC, "aggr__by_user__key_0" ASC
+			LIMIT 5`,
+	},
+	{ // [98]
+		TestName: "scripted_metric: session length per user",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"by_user": {
+					"terms": {
+						"field": "message",
+						"size": 2
+					},
+					"aggs": {
+						"session_length": {
+							"scripted_metric": {
+								"init_script": "state.min = Long.MAX_VALUE; state.max = Long.MIN_VALUE",
+								"map_script": "long t = doc['@timestamp'].value.toInstant().toEpochMilli(); state.min = Math.min(state.min, t); state.max = Math.max(state.max, t)",
+								"combine_script": "return state.max - state.min",
+								"reduce_script": "long longest = 0; for (s in states) { longest = Math.max(longest, s) } return longest"
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 5,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"by_user": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "a",
+							"doc_count": 3,
+							"session_length": {
+								"value": 90000
+							}
+						},
+						{
+							"key": "b",
+							"doc_count": 2,
+							"session_length": {
+								"value": 1500
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(5)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "a"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(3)),
+				model.NewQueryResultCol("metric__by_user__session_length_col_0", int64(3)),
+				model.NewQueryResultCol("metric__by_user__session_length_col_1", []any{
+					[]any{time.UnixMilli(1706871600000).UTC()},
+					[]any{time.UnixMilli(1706871690000).UTC()},
+					[]any{time.UnixMilli(1706871630000).UTC()},
+				}),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(5)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "b"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(2)),
+				model.NewQueryResultCol("metric__by_user__session_length_col_0", int64(2)),
+				model.NewQueryResultCol("metric__by_user__session_length_col_1", []any{
+					[]any{time.UnixMilli(1706871601500).UTC()},
+					[]any{time.UnixMilli(1706871600000).UTC()},
+				}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__by_user__parent_count",
+			  "message" AS "aggr__by_user__key_0", count(*) AS "aggr__by_user__count",
+			  count(*) AS "metric__by_user__session_length_col_0",
+			  groupArray(100000)(tuple("@timestamp")) AS
+			  "metric__by_user__session_length_col_1"
+			FROM __quesma_table_name
+			GROUP BY "message" AS "aggr__by_user__key_0"
+			ORDER BY "aggr__by_user__count" DESC, "aggr__by_user__key_0" ASC
+			LIMIT 3`,
+	},
+	{ // [99]
+		TestName: "scripted_metric: profit, example from Elastic docs",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"profit": {
+					"scripted_metric": {
+						"init_script": "state.transactions = []",
+						"map_script": "state.transactions.add(doc.message.value == 'sale' ? doc.bytes_gauge.value : -1 * doc.bytes_gauge.value)",
+						"combine_script": "double profit = 0; for (t in state.transactions) { profit += t } return profit",
+						"reduce_script": {
+							"source": "double profit = 0; for (a in states) { profit += a } return profit * params.multiplier",
+							"params": {
+								"multiplier": 2
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 4,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"profit": {
+					"value": 340.0
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__profit_col_0", int64(4)),
+				model.NewQueryResultCol("metric__profit_col_1", []any{
+					[]any{uint64(80), "sale"},
+					[]any{uint64(10), "cost"},
+					[]any{uint64(130), "sale"},
+					[]any{util.Pointer(uint64(30)), nil},
+				}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT count(*) AS "metric__profit_col_0",
+			  groupArray(100000)(tuple("bytes_gauge", "message")) AS "metric__profit_col_1"
+			FROM __quesma_table_name`,
+	},
+	{ // [100]
+		TestName: "significant_terms with background_filter, chi_square and min_doc_count",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"query": {
+				"term": {
+					"host.name": "apollo"
+				}
+			},
+			"aggs": {
+				"significant": {
+					"significant_terms": {
+						"field": "response",
+						"size": 2,
+						"min_doc_count": 1,
+						"background_filter": {
+							"range": {
+								"bytes_gauge": {
+									"gte": 100
+								}
+							}
+						},
+						"chi_square": {}
+					}
+				}
+			}
+		}`,
+		// "200" is less frequent in the foreground than in the background, so it's not significant
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 100,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"significant": {
+					"doc_count": 100,
+					"bg_count": 1000,
+					"buckets": [
+						{
+							"key": "503",
+							"doc_count": 30,
+							"score": 146.19883040935673,
+							"bg_count": 50
+						},
+						{
+							"key": "404",
+							"doc_count": 2,
+							"score": 18.03607214428858,
+							"bg_count": 2
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__significant__parent_count", uint64(100)),
+				model.NewQueryResultCol("aggr__significant__key_0", "200"),
+				model.NewQueryResultCol("aggr__significant__key_1", uint64(900)),
+				model.NewQueryResultCol("aggr__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__significant__count", uint64(60)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__significant__parent_count", uint64(100)),
+				model.NewQueryResultCol("aggr__significant__key_0", "503"),
+				model.NewQueryResultCol("aggr__significant__key_1", uint64(50)),
+				model.NewQueryResultCol("aggr__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__significant__count", uint64(30)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__significant__parent_count", uint64(100)),
+				model.NewQueryResultCol("aggr__significant__key_0", "404"),
+				model.NewQueryResultCol("aggr__significant__key_1", uint64(2)),
+				model.NewQueryResultCol("aggr__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__significant__count", uint64(2)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			WITH quesma_significant_terms_group_table AS (
+			  SELECT sum(count(*)) OVER () AS "aggr__significant__parent_count",
+			    "response" AS "aggr__significant__key_0",
+			    count(*) AS "aggr__significant__count"
+			  FROM __quesma_table_name
+			  WHERE "host.name"='apollo'
+			  GROUP BY "response" AS "aggr__significant__key_0"
+			  ORDER BY "aggr__significant__count" DESC, "aggr__significant__key_0" ASC
+			  LIMIT 27) ,
+			quesma_significant_terms_background_1 AS (
+			  SELECT "response" AS "aggr__significant__key_0",
+			    count(*) AS "aggr__significant__key_1"
+			  FROM __quesma_table_name
+			  WHERE ("response" IN (
+			    SELECT "aggr__significant__key_0"
+			    FROM quesma_significant_terms_group_table) AND "bytes_gauge">=100)
+			  GROUP BY "response" AS "aggr__significant__key_0")
+			SELECT "group_table"."aggr__significant__parent_count" AS
+			  "aggr__significant__parent_count",
+			  "group_table"."aggr__significant__key_0" AS "aggr__significant__key_0",
+			  "background_1"."aggr__significant__key_1" AS "aggr__significant__key_1",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name
+			  WHERE "bytes_gauge">=100) AS "aggr__significant__key_2",
+			  "group_table"."aggr__significant__count" AS "aggr__significant__count"
+			FROM quesma_significant_terms_group_table AS "group_table" LEFT OUTER JOIN
+			  quesma_significant_terms_background_1 AS "background_1" ON (
+			  "group_table"."aggr__significant__key_0"=
+			  "background_1"."aggr__significant__key_0")
+			ORDER BY "group_table"."aggr__significant__count" DESC,
+			  "group_table"."aggr__significant__key_0" ASC`,
+	},
+	{ // [101]
+		TestName: "significant_text, words appearing in less than min_doc_count documents are skipped",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"query": {
+				"term": {
+					"host.name": "apollo"
+				}
+			},
+			"aggs": {
+				"keywords": {
+					"significant_text": {
+						"field": "message",
+						"filter_duplicate_text": true
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 100,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"keywords": {
+					"doc_count": 100,
+					"bg_count": 1000,
+					"buckets": [
+						{
+							"key": "timeout",
+							"doc_count": 30,
+							"score": 2.2714285714285714,
+							"bg_count": 35
+						},
+						{
+							"key": "error",
+							"doc_count": 40,
+							"score": 1.2000000000000002,
+							"bg_count": 100
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__keywords_col_0", uint64(100)),
+				model.NewQueryResultCol("metric__keywords_col_1", []any{[]string{"error", "timeout", "ok"}, []uint64{40, 30, 2}}),
+				model.NewQueryResultCol("metric__keywords_col_2", []uint64{100, 35, 500}),
+				model.NewQueryResultCol("metric__keywords_col_3", uint64(1000)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT count(*) AS "metric__keywords_col_0",
+			  sumMap(arrayDistinct(splitByNonAlpha(lower(COALESCE("message", '')))),
+			  arrayWithConstant(length(arrayDistinct(splitByNonAlpha(lower(COALESCE(
+			  "message", ''))))), 1)) AS "metric__keywords_col_1",
+			  arrayMap((x) -> transform(x, tupleElement((
+			  SELECT sumMap(arrayDistinct(splitByNonAlpha(lower(COALESCE("message", '')))),
+			    arrayWithConstant(length(arrayDistinct(splitByNonAlpha(lower(COALESCE(
+			    "message", ''))))), 1))
+			  FROM __quesma_table_name), 1), tupleElement((
+			  SELECT sumMap(arrayDistinct(splitByNonAlpha(lower(COALESCE("message", '')))),
+			    arrayWithConstant(length(arrayDistinct(splitByNonAlpha(lower(COALESCE(
+			    "message", ''))))), 1))
+			  FROM __quesma_table_name), 2), toUInt64(0)), tupleElement(sumMap(arrayDistinct
+			  (splitByNonAlpha(lower(COALESCE("message", '')))), arrayWithConstant(length(
+			  arrayDistinct(splitByNonAlpha(lower(COALESCE("message", ''))))), 1)), 1)) AS
+			  "metric__keywords_col_2", (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "metric__keywords_col_3"
+			FROM __quesma_table_name
+			WHERE "host.name"='apollo'`,
+	},
+	{ // [102]
+		TestName: "nested with terms, avg and reverse_nested over nested documents",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"query": {
+				"nested": {
+					"path": "comments",
+					"query": {
+						"range": {
+							"comments.stars": {
+								"gte": 4
+							}
+						}
+					}
+				}
+			},
+			"aggs": {
+				"comments": {
+					"nested": {
+						"path": "comments"
+					},
+					"aggs": {
+						"authors": {
+							"terms": {
+								"field": "comments.author",
+								"size": 2
+							},
+							"aggs": {
+								"avg_stars": {
+									"avg": {
+										"field": "comments.stars"
+									}
+								},
+								"posts": {
+									"reverse_nested": {}
+								}
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 4,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"comments": {
+					"doc_count": 9,
+					"authors": {
+						"doc_count_error_upper_bound": 0,
+						"sum_other_doc_count": 2,
+						"buckets": [
+							{
+								"key": "alice",
+								"doc_count": 4,
+								"avg_stars": {
+									"value": 4.25
+								},
+								"posts": {
+									"doc_count": 3
+								}
+							},
+							{
+								"key": "bob",
+								"doc_count": 3,
+								"avg_stars": {
+									"value": 2.0
+								},
+								"posts": {
+									"doc_count": 3
+								}
+							}
+						]
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__comments__count", int64(9)),
+				model.NewQueryResultCol("aggr__comments__authors__parent_count", int64(9)),
+				model.NewQueryResultCol("aggr__comments__authors__key_0", "alice"),
+				model.NewQueryResultCol("aggr__comments__authors__count", int64(4)),
+				model.NewQueryResultCol("metric__comments__authors__avg_stars_col_0", 4.25),
+				model.NewQueryResultCol("metric__comments__authors__posts_col_0", uint64(3)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__comments__count", int64(9)),
+				model.NewQueryResultCol("aggr__comments__authors__parent_count", int64(9)),
+				model.NewQueryResultCol("aggr__comments__authors__key_0", "bob"),
+				model.NewQueryResultCol("aggr__comments__authors__count", int64(3)),
+				model.NewQueryResultCol("metric__comments__authors__avg_stars_col_0", 2.0),
+				model.NewQueryResultCol("metric__comments__authors__posts_col_0", uint64(3)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__comments__count",
+			  sum(count(*)) OVER () AS "aggr__comments__authors__parent_count",
+			  tupleElement("__quesma_nested", 'author') AS "aggr__comments__authors__key_0",
+			  count(*) AS "aggr__comments__authors__count",
+			  avgOrNull(tupleElement("__quesma_nested", 'stars')) AS
+			  "metric__comments__authors__avg_stars_col_0",
+			  uniqExact("__quesma_nested_parent") AS
+			  "metric__comments__authors__posts_col_0"
+			FROM (
+			  SELECT *, rowNumberInAllBlocks() AS "__quesma_nested_parent"
+			  FROM __quesma_table_name
+			  WHERE arrayExists((nested_doc) -> tupleElement(nested_doc, 'stars')>=4,
+			    "comments")) ARRAY JOIN "comments" AS "__quesma_nested"
+			GROUP BY tupleElement("__quesma_nested", 'author') AS
+			  "aggr__comments__authors__key_0"
+			ORDER BY "aggr__comments__authors__count" DESC,
+			  "aggr__comments__authors__key_0" ASC
+			LIMIT 3`,
+	},
+	{ // [103]
+		TestName: "significant_terms inside terms, background counts are computed only for candidate terms",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"aggs": {
+				"hosts": {
+					"terms": {
+						"field": "host.name",
+						"size": 2
+					},
+					"aggs": {
+						"significant": {
+							"significant_terms": {
+								"field": "response",
+								"size": 1,
+								"min_doc_count": 1
+							}
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 3,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 150,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"hosts": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "apollo",
+							"doc_count": 100,
+							"significant": {
+								"doc_count": 100,
+								"bg_count": 1000,
+								"buckets": [
+									{
+										"key": "503",
+										"doc_count": 30,
+										"score": 1.4999999999999998,
+										"bg_count": 50
+									}
+								]
+							}
+						},
+						{
+							"key": "zeus",
+							"doc_count": 50,
+							"significant": {
+								"doc_count": 50,
+								"bg_count": 1000,
+								"buckets": [
+									{
+										"key": "404",
+										"doc_count": 10,
+										"score": 3.1333333333333337,
+										"bg_count": 12
+									}
+								]
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", uint64(150)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "apollo"),
+				model.NewQueryResultCol("aggr__hosts__count", uint64(100)),
+				model.NewQueryResultCol("aggr__hosts__significant__parent_count", uint64(100)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_0", "200"),
+				model.NewQueryResultCol("aggr__hosts__significant__key_1", uint64(900)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__hosts__significant__count", uint64(60)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", uint64(150)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "apollo"),
+				model.NewQueryResultCol("aggr__hosts__count", uint64(100)),
+				model.NewQueryResultCol("aggr__hosts__significant__parent_count", uint64(100)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_0", "503"),
+				model.NewQueryResultCol("aggr__hosts__significant__key_1", uint64(50)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__hosts__significant__count", uint64(30)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", uint64(150)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "zeus"),
+				model.NewQueryResultCol("aggr__hosts__count", uint64(50)),
+				model.NewQueryResultCol("aggr__hosts__significant__parent_count", uint64(50)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_0", "200"),
+				model.NewQueryResultCol("aggr__hosts__significant__key_1", uint64(900)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__hosts__significant__count", uint64(40)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", uint64(150)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "zeus"),
+				model.NewQueryResultCol("aggr__hosts__count", uint64(50)),
+				model.NewQueryResultCol("aggr__hosts__significant__parent_count", uint64(50)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_0", "404"),
+				model.NewQueryResultCol("aggr__hosts__significant__key_1", uint64(12)),
+				model.NewQueryResultCol("aggr__hosts__significant__key_2", uint64(1000)),
+				model.NewQueryResultCol("aggr__hosts__significant__count", uint64(10)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			WITH quesma_significant_terms_group_table AS (
+			  SELECT "aggr__hosts__parent_count", "aggr__hosts__key_0",
+			    "aggr__hosts__count", "aggr__hosts__significant__parent_count",
+			    "aggr__hosts__significant__key_0", "aggr__hosts__significant__count",
+			    "aggr__hosts__order_1_rank", "aggr__hosts__significant__order_1_rank"
+			  FROM (
+			    SELECT "aggr__hosts__parent_count", "aggr__hosts__key_0",
+			      "aggr__hosts__count", "aggr__hosts__significant__parent_count",
+			      "aggr__hosts__significant__key_0", "aggr__hosts__significant__count",
+			      dense_rank() OVER (ORDER BY "aggr__hosts__count" DESC,
+			      "aggr__hosts__key_0" ASC) AS "aggr__hosts__order_1_rank",
+			      dense_rank() OVER (PARTITION BY "aggr__hosts__key_0" ORDER BY
+			      "aggr__hosts__significant__count" DESC, "aggr__hosts__significant__key_0"
+			      ASC) AS "aggr__hosts__significant__order_1_rank"
+			    FROM (
+			      SELECT sum(count(*)) OVER () AS "aggr__hosts__parent_count",
+			        "host.name" AS "aggr__hosts__key_0",
+			        sum(count(*)) OVER (PARTITION BY "aggr__hosts__key_0") AS
+			        "aggr__hosts__count",
+			        sum(count(*)) OVER (PARTITION BY "aggr__hosts__key_0") AS
+			        "aggr__hosts__significant__parent_count",
+			        "response" AS "aggr__hosts__significant__key_0",
+			        count(*) AS "aggr__hosts__significant__count"
+			      FROM __quesma_table_name
+			      GROUP BY "host.name" AS "aggr__hosts__key_0",
+			        "response" AS "aggr__hosts__significant__key_0"))
+			  WHERE ("aggr__hosts__order_1_rank"<=3 AND
+			    "aggr__hosts__significant__order_1_rank"<=24)
+			  ORDER BY "aggr__hosts__order_1_rank" ASC,
+			    "aggr__hosts__significant__order_1_rank" ASC) ,
+			quesma_significant_terms_background_1 AS (
+			  SELECT "response" AS "aggr__hosts__significant__key_0",
+			    count(*) AS "aggr__hosts__significant__key_1"
+			  FROM __quesma_table_name
+			  WHERE "response" IN (
+			    SELECT "aggr__hosts__significant__key_0"
+			    FROM quesma_significant_terms_group_table)
+			  GROUP BY "response" AS "aggr__hosts__significant__key_0")
+			SELECT "group_table"."aggr__hosts__parent_count" AS "aggr__hosts__parent_count",
+			  "group_table"."aggr__hosts__key_0" AS "aggr__hosts__key_0",
+			  "group_table"."aggr__hosts__count" AS "aggr__hosts__count",
+			  "group_table"."aggr__hosts__significant__parent_count" AS
+			  "aggr__hosts__significant__parent_count",
+			  "group_table"."aggr__hosts__significant__key_0" AS
+			  "aggr__hosts__significant__key_0",
+			  "background_1"."aggr__hosts__significant__key_1" AS
+			  "aggr__hosts__significant__key_1", (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__hosts__significant__key_2",
+			  "group_table"."aggr__hosts__significant__count" AS
+			  "aggr__hosts__significant__count"
+			FROM quesma_significant_terms_group_table AS "group_table" LEFT OUTER JOIN
+			  quesma_significant_terms_background_1 AS "background_1" ON (
+			  "group_table"."aggr__hosts__significant__key_0"=
+			  "background_1"."aggr__hosts__significant__key_0")
+			ORDER BY "group_table"."aggr__hosts__order_1_rank" ASC,
+			  "group_table"."aggr__hosts__significant__order_1_rank" ASC`,
+	},
+	{ // [104]
+		TestName: "sum_bucket over terms without buckets is 0, as in Elastic",
+		QueryRequestJson: `
+		{
+			"size": 0,
+			"query": {
+				"term": {
+					"host.name": "not-a-host"
+				}
+			},
+			"aggs": {
+				"responses": {
+					"terms": {
+						"field": "response"
+					},
+					"aggs": {
+						"bytes": {
+							"avg": {
+								"field": "bytes"
+							}
+						}
+					}
+				},
+				"total_bytes": {
+					"sum_bucket": {
+						"buckets_path": "responses>bytes"
+					}
+				}
+			}
+		}`,
+		ExpectedResponse: `
+		{
+			"took": 1,
+			"timed_out": false,
+			"_shards": {
+				"total": 1,
+				"successful": 1,
+				"skipped": 0,
+				"failed": 0
+			},
+			"hits": {
+				"total": {
+					"value": 0,
+					"relation": "eq"
+				},
+				"max_score": null,
+				"hits": []
+			},
+			"aggregations": {
+				"responses": {
+					"doc_count_error_upper_bound": 0,
+					"buckets": []
+				},
+				"total_bytes": {
+					"value": 0.0
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__responses__parent_count",
+			  "response" AS "aggr__responses__key_0", count(*) AS "aggr__responses__count",
+			  avgOrNull("bytes") AS "metric__responses__bytes_col_0"
+			FROM __quesma_table_name
+			WHERE "host.name"='not-a-host'
+			GROUP BY "response" AS "aggr__responses__key_0"
+			ORDER BY "aggr__responses__count" DESC, "aggr__responses__key_0" ASC
+			LIMIT 11`,
+	},
 }
@@ -4395,7 +4395,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			],
 			"track_total_hits": true
 		}`,
-		// TODO: change 'sum_other_doc_count' to 'doc_count' in response. Significant_terms return that, unlike terms.
+		// match_all query, so foreground is the same as background and no term is significant
 		ExpectedResponse: `
 		{
 			"_shards": {
@@ -4406,38 +4406,10 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			},
 			"aggregations": {
 				"1": {
-					"value": 37790724732.3343
+					"value": 0
 				},
 				"1-bucket": {
-					"buckets": [
-						{
-							"1-metric": {
-								"value": 12539770587.428572
-							},
-							"bg_count": 224,
-							"doc_count": 224,
-							"key": "deb",
-							"score": 224
-						},
-						{
-							"1-metric": {
-								"value": 12464949530.168888
-							},
-							"bg_count": 225,
-							"doc_count": 225,
-							"key": "zip",
-							"score": 225
-						},
-						{
-							"1-metric": {
-								"value": 12786004614.736841
-							},
-							"bg_count": 76,
-							"doc_count": 76,
-							"key": "rpm",
-							"score": 76
-						}
-					],
+					"buckets": [],
 					"doc_count": 1865,
 					"bg_count": 1865
 				}
@@ -4457,6 +4429,8 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__1-bucket__parent_count", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__key_0", "deb"),
+				model.NewQueryResultCol("aggr__1-bucket__key_1", uint64(224)),
+				model.NewQueryResultCol("aggr__1-bucket__key_2", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__count", uint64(224)),
 				model.NewQueryResultCol("aggr__1-bucket__order_1", "deb"),
 				model.NewQueryResultCol("metric__1-bucket__1-metric_col_0", 12539770587.428572),
@@ -4464,6 +4438,8 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__1-bucket__parent_count", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__key_0", "zip"),
+				model.NewQueryResultCol("aggr__1-bucket__key_1", uint64(225)),
+				model.NewQueryResultCol("aggr__1-bucket__key_2", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__count", uint64(225)),
 				model.NewQueryResultCol("aggr__1-bucket__order_1", "zip"),
 				model.NewQueryResultCol("metric__1-bucket__1-metric_col_0", 12464949530.168888),
@@ -4471,19 +4447,45 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__1-bucket__parent_count", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__key_0", "rpm"),
+				model.NewQueryResultCol("aggr__1-bucket__key_1", uint64(76)),
+				model.NewQueryResultCol("aggr__1-bucket__key_2", uint64(1865)),
 				model.NewQueryResultCol("aggr__1-bucket__count", uint64(76)),
 				model.NewQueryResultCol("aggr__1-bucket__order_1", "rpm"),
 				model.NewQueryResultCol("metric__1-bucket__1-metric_col_0", 12786004614.736841),
 			}},
 		},
 		ExpectedPancakeSQL: `
-			SELECT sum(count(*)) OVER () AS "aggr__1-bucket__parent_count",
-			  "extension" AS "aggr__1-bucket__key_0", count(*) AS "aggr__1-bucket__count",
-			  avgOrNull("machine.ram") AS "metric__1-bucket__1-metric_col_0"
-			FROM __quesma_table_name
-			GROUP BY "extension" AS "aggr__1-bucket__key_0"
-			ORDER BY "aggr__1-bucket__count" DESC, "aggr__1-bucket__key_0" ASC
-			LIMIT 6`,
+			WITH quesma_significant_terms_group_table AS (
+			  SELECT sum(count(*)) OVER () AS "aggr__1-bucket__parent_count",
+			    "extension" AS "aggr__1-bucket__key_0", count(*) AS "aggr__1-bucket__count",
+			    avgOrNull("machine.ram") AS "metric__1-bucket__1-metric_col_0"
+			  FROM __quesma_table_name
+			  GROUP BY "extension" AS "aggr__1-bucket__key_0"
+			  ORDER BY "aggr__1-bucket__count" DESC, "aggr__1-bucket__key_0" ASC
+			  LIMIT 36) ,
+			quesma_significant_terms_background_1 AS (
+			  SELECT "extension" AS "aggr__1-bucket__key_0",
+			    count(*) AS "aggr__1-bucket__key_1"
+			  FROM __quesma_table_name
+			  WHERE "extension" IN (
+			    SELECT "aggr__1-bucket__key_0"
+			    FROM quesma_significant_terms_group_table)
+			  GROUP BY "extension" AS "aggr__1-bucket__key_0")
+			SELECT "group_table"."aggr__1-bucket__parent_count" AS
+			  "aggr__1-bucket__parent_count",
+			  "group_table"."aggr__1-bucket__key_0" AS "aggr__1-bucket__key_0",
+			  "background_1"."aggr__1-bucket__key_1" AS "aggr__1-bucket__key_1",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__1-bucket__key_2",
+			  "group_table"."aggr__1-bucket__count" AS "aggr__1-bucket__count",
+			  "group_table"."metric__1-bucket__1-metric_col_0" AS
+			  "metric__1-bucket__1-metric_col_0"
+			FROM quesma_significant_terms_group_table AS "group_table" LEFT OUTER JOIN
+			  quesma_significant_terms_background_1 AS "background_1" ON (
+			  "group_table"."aggr__1-bucket__key_0"="background_1"."aggr__1-bucket__key_0")
+			ORDER BY "group_table"."aggr__1-bucket__count" DESC,
+			  "group_table"."aggr__1-bucket__key_0" ASC`,
 	},
 	{ // [25]
 		TestName: "complex sum_bucket. Reproduce: Visualize -> Vertical Bar: Metrics: Sum Bucket (Bucket: Date Histogram, Metric: Average), Buckets: X-Asis: Histogram",
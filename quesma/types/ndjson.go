@@ -40,8 +40,9 @@ func ParseNDJSON(body string) (NDJSON, error) {
 }
 
 type DocumentTarget struct {
-	Index *string `json:"_index"`
-	Id    *string `json:"_id"` // document's target id in Elasticsearch, we ignore it when writing to Clickhouse.
+	Index    *string `json:"_index"`
+	Id       *string `json:"_id"` // document's target id in Elasticsearch, we ignore it when writing to Clickhouse.
+	Pipeline *string `json:"pipeline"`
 }
 
 type BulkOperation map[string]DocumentTarget
@@ -56,6 +57,26 @@ func (op BulkOperation) GetIndex() string {
 	return ""
 }
 
+func (op BulkOperation) GetId() string {
+	for _, target := range op {
+		if target.Id != nil {
+			return *target.Id
+		}
+	}
+
+	return ""
+}
+
+func (op BulkOperation) GetPipeline() string {
+	for _, target := range op {
+		if target.Pipeline != nil {
+			return *target.Pipeline
+		}
+	}
+
+	return ""
+}
+
 func (op BulkOperation) GetOperation() string {
 	for operation := range op {
 		return operation
@@ -88,6 +109,9 @@ func (n NDJSON) BulkForEach(f func(entryNumber int, operationParsed BulkOperatio
 				if id, ok := detailsMap["_id"].(string); ok {
 					docTarget.Id = &id
 				}
+				if pipeline, ok := detailsMap["pipeline"].(string); ok {
+					docTarget.Pipeline = &pipeline
+				}
 
 				actionAndMetadataParsed[opType] = docTarget
 			} else {
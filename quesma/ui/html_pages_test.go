@@ -62,10 +62,19 @@ func TestHtmlPages(t *testing.T) {
 		stats.GlobalStatistics.Process(false, xss, types.MustJSON("{}"), clickhouse.NestedSeparator)
 		response := string(qmc.generateStatistics())
 		assert.NotContains(t, response, xss)
+		stats.GlobalDeadLetters.AddStored(xss, xss, 1)
+		response = string(qmc.generateDeadLetterStatistics())
+		assert.NotContains(t, response, xss)
 	})
 
 	// generateTables relies on the LogManager instance, which is not initialized in this test
 	t.Run("schema got no XSS and no panic", func(t *testing.T) {
+		stats.GlobalIndexLifecycle.Update(xss, func(status *stats.IndexLifecycleStatus) {
+			status.Policy = xss
+			status.LastError = xss
+		})
+		defer stats.GlobalIndexLifecycle.Remove(xss)
+		stats.GlobalSchemaEvolution.Record(stats.SchemaEvolutionEvent{Table: xss, Column: xss, Kind: xss, From: xss, To: xss})
 		response := string(qmc.generateTables())
 		assert.NotContains(t, response, xss)
 	})
@@ -7,6 +7,7 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/stats"
 	"github.com/QuesmaOrg/quesma/quesma/ui/internal/builder"
 	"strings"
+	"time"
 )
 
 func (qmc *QuesmaManagementConsole) generateIngestStatistics() []byte {
@@ -14,6 +15,8 @@ func (qmc *QuesmaManagementConsole) generateIngestStatistics() []byte {
 	buffer.Write(qmc.generateTopNavigation("statistics"))
 
 	buffer.Html(`<main id="statistics">`)
+	buffer.Write(qmc.generateIngestBufferStatistics())
+	buffer.Write(qmc.generateDeadLetterStatistics())
 	buffer.Write(qmc.generateStatistics())
 	buffer.Html("\n</main>\n\n")
 
@@ -149,3 +152,73 @@ func (qmc *QuesmaManagementConsole) generateStatistics() []byte {
 	}
 	return buffer.Bytes()
 }
+
+// generateIngestBufferStatistics renders counters of documents batched before inserting them into ClickHouse
+func (qmc *QuesmaManagementConsole) generateIngestBufferStatistics() []byte {
+	var buffer builder.HtmlBuffer
+	buffer.Html("\n<h2>Ingest buffer <small>").Text(qmc.cfg.IngestBuffer.String()).Html("</small></h2>\n")
+	if qmc.cfg.IngestBuffer == nil {
+		return buffer.Bytes()
+	}
+
+	statistics := stats.GlobalIngestBuffer.Snapshot()
+	lastFlush := "never"
+	if !statistics.LastFlush.IsZero() {
+		lastFlush = statistics.LastFlush.Format(time.RFC3339)
+	}
+	buffer.Html("<table>\n")
+	for _, row := range []struct {
+		name  string
+		value string
+	}{
+		{"Buffered documents", fmt.Sprintf("%d", statistics.Buffered)},
+		{"Recovered from the write-ahead log", fmt.Sprintf("%d", statistics.Recovered)},
+		{"Flushes", fmt.Sprintf("%d", statistics.Flushes)},
+		{"Inserted documents", fmt.Sprintf("%d", statistics.Inserted)},
+		{"Rejected documents (429)", fmt.Sprintf("%d", statistics.Rejected)},
+		{"Lost documents", fmt.Sprintf("%d", statistics.Lost)},
+		{"Last flush", lastFlush},
+	} {
+		buffer.Html(`<tr><td class="key">`).Text(row.name).Html(`</td><td class="value-count">`).Text(row.value).Html("</td></tr>\n")
+	}
+	buffer.Html("</table>\n")
+	return buffer.Bytes()
+}
+
+// generateDeadLetterStatistics renders counters of documents rejected during ingest
+func (qmc *QuesmaManagementConsole) generateDeadLetterStatistics() []byte {
+	var buffer builder.HtmlBuffer
+
+	buffer.Html("\n<h2>Dead letter queue <small>").Text(qmc.cfg.DeadLetterQueue.String()).Html("</small></h2>\n")
+	statistics := stats.GlobalDeadLetters.Sorted()
+	if len(statistics) == 0 {
+		buffer.Html("<p>&nbsp;No documents were rejected.</p>\n")
+		return buffer.Bytes()
+	}
+
+	buffer.Html("<table>\n")
+	buffer.Html("<thead>\n")
+	buffer.Html(`<tr>` + "\n")
+	buffer.Html(`<th class="key">Index</th>` + "\n")
+	for _, stage := range stats.DeadLetterStages {
+		buffer.Html(`<th class="value-count">`).Text("Rejected by " + stage).Html("</th>\n")
+	}
+	buffer.Html(`<th class="value-count">Replayed</th>` + "\n")
+	buffer.Html(`<th class="value-count">Lost</th>` + "\n")
+	buffer.Html("</tr>\n")
+	buffer.Html("</thead>\n")
+	buffer.Html("<tbody>\n")
+	for _, index := range statistics {
+		buffer.Html("<tr>\n")
+		buffer.Html(`<td class="key">`).Text(index.Index).Html("</td>\n")
+		for _, stage := range stats.DeadLetterStages {
+			buffer.Html(fmt.Sprintf(`<td class="value-count">%d</td>`+"\n", index.Stored[stage]))
+		}
+		buffer.Html(fmt.Sprintf(`<td class="value-count">%d</td>`+"\n", index.Replayed))
+		buffer.Html(fmt.Sprintf(`<td class="value-count">%d</td>`+"\n", index.Lost))
+		buffer.Html("</tr>\n")
+	}
+	buffer.Html("</tbody>\n")
+	buffer.Html("</table>\n")
+	return buffer.Bytes()
+}
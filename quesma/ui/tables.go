@@ -8,9 +8,12 @@ import (
 	"github.com/QuesmaOrg/quesma/quesma/clickhouse"
 	"github.com/QuesmaOrg/quesma/quesma/common_table"
 	"github.com/QuesmaOrg/quesma/quesma/end_user_errors"
+	"github.com/QuesmaOrg/quesma/quesma/stats"
+	"github.com/QuesmaOrg/quesma/quesma/ui/internal/builder"
 	"github.com/QuesmaOrg/quesma/quesma/util"
 	"sort"
 	"strings"
+	"time"
 )
 
 func (qmc *QuesmaManagementConsole) generateQuesmaAllLogs() []byte {
@@ -457,6 +460,9 @@ func (qmc *QuesmaManagementConsole) generateTables() []byte {
 
 	buffer.Html("\n</table>")
 
+	qmc.generateIndexLifecycle(&buffer)
+	qmc.generateSchemaEvolution(&buffer)
+
 	buffer.Html("\n</main>\n\n")
 
 	buffer.Html(`<div class="menu">`)
@@ -484,6 +490,8 @@ func (qmc *QuesmaManagementConsole) generateTables() []byte {
 	buffer.Html("</ol>")
 
 	buffer.Html(`<h3><a href="#quesma-config">Jump to Quesma Config</a></h3>`)
+	buffer.Html(`<h3><a href="#index-lifecycle">Jump to Index Lifecycle</a></h3>`)
+	buffer.Html(`<h3><a href="#schema-evolution">Jump to Schema Evolution</a></h3>`)
 
 	buffer.Html("\n</div>")
 
@@ -491,3 +499,118 @@ func (qmc *QuesmaManagementConsole) generateTables() []byte {
 	buffer.Html("\n</html>")
 	return buffer.Bytes()
 }
+
+// generateIndexLifecycle renders indexes managed by lifecycle policies and closed indexes
+func (qmc *QuesmaManagementConsole) generateIndexLifecycle(buffer *builder.HtmlBuffer) {
+	buffer.Html("\n<table>")
+	buffer.Html(`<tr class="tableName" id="index-lifecycle">`)
+	buffer.Html(`<th colspan=6><h2>`)
+	buffer.Html(`Index Lifecycle`)
+	buffer.Html(`</h2></th>`)
+	buffer.Html(`</tr>`)
+
+	buffer.Html(`<tr>`)
+	for _, header := range []string{"Index", "Policy", "Table", "Delete after", "Last run", "Status"} {
+		buffer.Html(`<th>`)
+		buffer.Text(header)
+		buffer.Html(`</th>`)
+	}
+	buffer.Html(`</tr>`)
+
+	statuses := stats.GlobalIndexLifecycle.Sorted()
+	if len(statuses) == 0 {
+		buffer.Html(`<tr><td colspan=6>No indexes are managed by lifecycle policies.</td></tr>`)
+	}
+	for _, status := range statuses {
+		buffer.Html(`<tr>`)
+		buffer.Html(`<td>`)
+		buffer.Text(status.Index)
+		buffer.Html(`</td>`)
+		buffer.Html(`<td>`)
+		buffer.Text(status.Policy)
+		buffer.Html(`</td>`)
+		buffer.Html(`<td>`)
+		switch {
+		case status.Table == "":
+			buffer.Html(`&mdash;`)
+		case status.CommonTable:
+			buffer.Text(status.Table + " (common table)")
+		default:
+			buffer.Text(status.Table)
+		}
+		buffer.Html(`</td>`)
+		buffer.Html(`<td>`)
+		if status.DeletePhase {
+			buffer.Text(status.DeleteAfter.String())
+		} else {
+			buffer.Text("never")
+		}
+		buffer.Html(`</td>`)
+		buffer.Html(`<td>`)
+		if status.LastRun.IsZero() {
+			buffer.Text("never")
+		} else {
+			buffer.Text(status.LastRun.Format(time.RFC3339))
+		}
+		buffer.Html(`</td>`)
+		buffer.Html(`<td>`)
+		if status.LastError != "" {
+			buffer.Text("ERROR: " + status.LastError)
+		} else {
+			buffer.Text(fmt.Sprintf("%d partitions dropped", status.DroppedPartitions))
+		}
+		buffer.Html(`</td>`)
+		buffer.Html(`</tr>`)
+	}
+
+	buffer.Html(`<tr>`)
+	buffer.Html(`<th colspan=6>`)
+	buffer.Html(`Closed indexes`)
+	buffer.Html(`</th>`)
+	buffer.Html(`</tr>`)
+	buffer.Html(`<tr>`)
+	buffer.Html(`<td colspan=6>`)
+	if closed := qmc.tableResolver.ClosedIndexes(); len(closed) > 0 {
+		buffer.Text(strings.Join(closed, ", "))
+	} else {
+		buffer.Html(`&mdash;`)
+	}
+	buffer.Html(`</td>`)
+	buffer.Html(`</tr>`)
+
+	buffer.Html("\n</table>")
+}
+
+// generateSchemaEvolution renders the recent schema changes made during ingest
+func (qmc *QuesmaManagementConsole) generateSchemaEvolution(buffer *builder.HtmlBuffer) {
+	buffer.Html("\n<table>")
+	buffer.Html(`<tr class="tableName" id="schema-evolution">`)
+	buffer.Html(`<th colspan=6><h2>`)
+	buffer.Html(`Schema Evolution`)
+	buffer.Html(`</h2></th>`)
+	buffer.Html(`</tr>`)
+
+	buffer.Html(`<tr>`)
+	for _, header := range []string{"Time", "Table", "Column", "Strategy", "From", "To"} {
+		buffer.Html(`<th>`)
+		buffer.Text(header)
+		buffer.Html(`</th>`)
+	}
+	buffer.Html(`</tr>`)
+
+	events := stats.GlobalSchemaEvolution.Recent()
+	if len(events) == 0 {
+		buffer.Html(`<tr><td colspan=6>No schema changes were made during ingest.</td></tr>`)
+	}
+	for _, event := range events {
+		buffer.Html(`<tr>`)
+		for _, value := range []string{event.Time.Format(time.RFC3339), event.Table, event.Column, event.Kind, event.From, event.To} {
+			buffer.Html(`<td>`)
+			buffer.Text(value)
+			buffer.Html(`</td>`)
+		}
+		buffer.Html(`</tr>`)
+	}
+
+	buffer.Html("\n</table>")
+}
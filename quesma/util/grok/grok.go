@@ -0,0 +1,187 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns are the most common patterns from
+// https://github.com/elastic/elasticsearch/blob/main/libs/grok/src/main/resources/patterns/ecs-v1/grok-patterns
+// rewritten for RE2 (no lookarounds), so they can be used both by Go and ClickHouse
+var Patterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"EMAILLOCALPART":    `[a-zA-Z0-9!#$%&'*+\-/=?^_{|}~]+(?:\.[a-zA-Z0-9!#$%&'*+\-/=?^_{|}~]+)*`,
+	"EMAILADDRESS":      `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":               `(?:[+-]?(?:[0-9]+))`,
+	"BASE10NUM":         `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":            `(?:%{BASE10NUM})`,
+	"BASE16NUM":         `(?:0[xX]?[0-9a-fA-F]+)`,
+	"POSINT":            `\b(?:[1-9][0-9]*)\b`,
+	"NONNEGINT":         `\b(?:[0-9]+)\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`(?:[^`\\\\]|\\\\.)*`)",
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:[0-9A-Fa-f]{0,4}|%{IPV4})`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b(?:[0-9A-Za-z][0-9A-Za-z-]{0,62})(?:\.(?:[0-9A-Za-z][0-9A-Za-z-]{0,62}))*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:%{UNIXPATH}|%{WINPATH})`,
+	"UNIXPATH":          `(?:/[\w_%!$@:.,+~-]*)+`,
+	"WINPATH":           `(?:[A-Za-z]+:|\\)(?:\\[^\\?*]*)+`,
+	"URIPROTO":          `[A-Za-z](?:[A-Za-z0-9+\-.]+)+`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"MONTH":             `\b(?:[Jj]an(?:uary|uar)?|[Ff]eb(?:ruary|ruar)?|[Mm]ar(?:ch|z)?|[Aa]pr(?:il)?|[Mm]a(?:y|i)?|[Jj]un(?:e|i)?|[Jj]ul(?:y|i)?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo](?:c|k)?t(?:ober)?|[Nn]ov(?:ember)?|[Dd]e(?:c|z)(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"LOGLEVEL":          `(?:[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo?(?:rmation)?|INFO?(?:RMATION)?|[Ww]arn?(?:ing)?|WARN?(?:ING)?|[Ee]rr?(?:or)?|ERR?(?:OR)?|[Cc]rit?(?:ical)?|CRIT?(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|EMERG(?:ENCY)?|[Ee]merg(?:ency)?)`,
+}
+
+// KeyRegex matches references in grok patterns: %{SYNTAX}, %{SYNTAX:SEMANTIC} or %{SYNTAX:SEMANTIC:TYPE}
+var KeyRegex = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]]+))?(?::(\w+))?\}`)
+
+// NonCapturing turns capturing groups into non-capturing ones, so that only the key we extract is captured
+func NonCapturing(regex string) string {
+	var sb strings.Builder
+	inClass, escaped := false, false
+	for i, r := range regex {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '[':
+			inClass = true
+		case r == ']':
+			inClass = false
+		case r == '(' && !inClass && (i+1 >= len(regex) || regex[i+1] != '?'):
+			sb.WriteString("(?:")
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Key is a named key of a grok pattern, with an optional type conversion (int, long, float, double)
+type Key struct {
+	Name string
+	Type string
+}
+
+// Grok is a grok pattern compiled to a Go regular expression
+type Grok struct {
+	regex *regexp.Regexp
+	keys  []Key // i-th key is captured by the group named k<i>
+}
+
+var conversions = map[string]bool{"int": true, "long": true, "float": true, "double": true}
+
+// Compile expands the pattern, using definitions on top of the predefined Patterns.
+// Only named top-level keys are captured.
+func Compile(pattern string, definitions map[string]string) (*Grok, error) {
+	grok := &Grok{}
+	var expand func(pattern string, depth int, topLevel bool) (string, error)
+	expand = func(pattern string, depth int, topLevel bool) (string, error) {
+		if depth > 10 {
+			return "", fmt.Errorf("grok pattern [%s] is too deeply nested", pattern)
+		}
+		var sb strings.Builder
+		last := 0
+		for _, match := range KeyRegex.FindAllStringSubmatchIndex(pattern, -1) {
+			sb.WriteString(NonCapturing(pattern[last:match[0]]))
+			last = match[1]
+
+			name := pattern[match[2]:match[3]]
+			definition, ok := definitions[name]
+			if !ok {
+				definition, ok = Patterns[name]
+			}
+			if !ok {
+				return "", fmt.Errorf("unable to find pattern [%s] in Grok's pattern dictionary", name)
+			}
+			expanded, err := expand(definition, depth+1, false)
+			if err != nil {
+				return "", err
+			}
+
+			if topLevel && match[4] != -1 {
+				key := Key{Name: pattern[match[4]:match[5]]}
+				if match[6] != -1 {
+					key.Type = pattern[match[6]:match[7]]
+					if !conversions[key.Type] {
+						return "", fmt.Errorf("unsupported grok type [%s]", key.Type)
+					}
+				}
+				sb.WriteString("(?P<k" + strconv.Itoa(len(grok.keys)) + ">" + expanded + ")")
+				grok.keys = append(grok.keys, key)
+			} else {
+				sb.WriteString("(?:" + expanded + ")")
+			}
+		}
+		sb.WriteString(NonCapturing(pattern[last:]))
+		return sb.String(), nil
+	}
+
+	expanded, err := expand(pattern, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if grok.regex, err = regexp.Compile(expanded); err != nil {
+		return nil, fmt.Errorf("invalid grok pattern [%s]: %w", pattern, err)
+	}
+	return grok, nil
+}
+
+// Match returns values of all keys, converted to their types. Keys which didn't match anything are skipped,
+// if a key occurs more than once, the first non-empty value wins.
+func (g *Grok) Match(input string) (map[string]any, bool) {
+	match := g.regex.FindStringSubmatch(input)
+	if match == nil {
+		return nil, false
+	}
+	result := make(map[string]any, len(g.keys))
+	for i, key := range g.keys {
+		value := match[g.regex.SubexpIndex("k"+strconv.Itoa(i))]
+		if _, exists := result[key.Name]; exists || value == "" {
+			continue
+		}
+		result[key.Name] = convert(value, key.Type)
+	}
+	return result, true
+}
+
+func convert(value string, keyType string) any {
+	switch keyType {
+	case "int", "long":
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return number
+		}
+	case "float", "double":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	}
+	return value
+}
@@ -0,0 +1,56 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package grok
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGrok(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		definitions map[string]string
+		input       string
+		expected    map[string]any
+	}{
+		{
+			pattern:  `%{IP:client.ip} %{WORD:http.method} %{URIPATH:url.path} %{NUMBER:bytes:int}`,
+			input:    "55.3.244.1 GET /index.html 15824",
+			expected: map[string]any{"client.ip": "55.3.244.1", "http.method": "GET", "url.path": "/index.html", "bytes": int64(15824)},
+		},
+		{
+			pattern:  `\[%{LOGLEVEL:level}\] (took %{NUMBER:took:float}ms)?%{GREEDYDATA:message}`,
+			input:    "[INFO] done",
+			expected: map[string]any{"level": "INFO", "message": "done"},
+		},
+		{
+			pattern:     `%{FAVORITE_DOG:pet}`,
+			definitions: map[string]string{"FAVORITE_DOG": `beagle|%{WORD}`},
+			input:       "beagle",
+			expected:    map[string]any{"pet": "beagle"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			grok, err := Compile(tt.pattern, tt.definitions)
+			require.NoError(t, err)
+			result, matched := grok.Match(tt.input)
+			assert.True(t, matched)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestGrokErrors(t *testing.T) {
+	_, err := Compile(`%{UNKNOWN:x}`, nil)
+	assert.Error(t, err)
+	_, err = Compile(`%{WORD:x:boolean}`, nil)
+	assert.Error(t, err)
+
+	grok, err := Compile(`%{INT:x}`, nil)
+	require.NoError(t, err)
+	_, matched := grok.Match("abc")
+	assert.False(t, matched)
+}
@@ -79,6 +79,9 @@ type ConnectorDecisionClickhouse struct {
 	ClickhouseTableName string   "json:\"clickhouse_table_name\""
 	ClickhouseIndexes   []string "json:\"clickhouse_tables\""
 	IsCommonTable       bool     "json:\"is_common_table\""
+
+	// AliasFilters are filters (query DSL) of aliases, by index name, only for indexes matched by filtered aliases
+	AliasFilters map[string]any "json:\"alias_filters,omitempty\""
 }
 
 func (d *ConnectorDecisionClickhouse) Message() string {
@@ -94,6 +97,9 @@ func (d *ConnectorDecisionClickhouse) Message() string {
 	if len(d.ClickhouseIndexes) > 0 {
 		lines = append(lines, fmt.Sprintf("Indexes: %v.", d.ClickhouseIndexes))
 	}
+	if len(d.AliasFilters) > 0 {
+		lines = append(lines, fmt.Sprintf("Alias filters: %v.", d.AliasFilters))
+	}
 
 	return strings.Join(lines, " ")
 }
@@ -12,28 +12,66 @@ const (
 	IndexAsyncSearchPath      = "/:index/_async_search"
 	IndexCountPath            = "/:index/_count"
 	IndexDocPath              = "/:index/_doc"
+	IndexDocIdPath            = "/:index/_doc/:id"
+	AliasesPath               = "/_aliases"
+	AliasPath                 = "/_alias/:name"
+	IndexSourceIdPath         = "/:index/_source/:id"
+	IndexMgetPath             = "/:index/_mget"
+	MgetPath                  = "/_mget"
 	IndexRefreshPath          = "/:index/_refresh"
 	IndexBulkPath             = "/:index/_bulk"
 	IndexMappingPath          = "/:index/_mapping"
 	FieldCapsPath             = "/:index/_field_caps"
 	TermsEnumPath             = "/:index/_terms_enum"
 	EQLSearch                 = "/:index/_eql/search"
+	SQLPath                   = "/_sql"
+	SQLTranslatePath          = "/_sql/translate"
+	SQLClosePath              = "/_sql/close"
+	ESQLPath                  = "/_query"
+	ESQLAsyncPath             = "/_query/async"
 	ResolveIndexPath          = "/_resolve/index/:index"
 	ClusterHealthPath         = "/_cluster/health"
 	BulkPath                  = "/_bulk"
 	AsyncSearchIdPrefix       = "/_async_search/"
 	AsyncSearchIdPath         = "/_async_search/:id"
+	ScrollPath                = "/_search/scroll"
+	ScrollIdPath              = "/_search/scroll/:id"
+	IndexPitPath              = "/:index/_pit"
+	PitPath                   = "/_pit"
+	IndexDeleteByQueryPath    = "/:index/_delete_by_query"
+	IndexUpdateByQueryPath    = "/:index/_update_by_query"
+	TaskPath                  = "/_tasks/:id"
 	AsyncSearchStatusPath     = "/_async_search/status/:id"
 	KibanaInternalPrefix      = "/.kibana_"
 	IndexPath                 = "/:index"
 	ExecutePainlessScriptPath = "/_scripts/painless/_execute" // This path is used on the Kibana side to evaluate painless scripts when adding a new scripted field.
 
+	IngestPipelinesPath          = "/_ingest/pipeline"
+	IngestPipelinePath           = "/_ingest/pipeline/:id"
+	IngestPipelineSimulatePath   = "/_ingest/pipeline/_simulate"
+	IngestPipelineIdSimulatePath = "/_ingest/pipeline/:id/_simulate"
+
+	IndexTemplatesPath     = "/_index_template"
+	IndexTemplatePath      = "/_index_template/:name"
+	ComponentTemplatesPath = "/_component_template"
+	ComponentTemplatePath  = "/_component_template/:name"
+
+	IndexClosePath            = "/:index/_close"
+	IndexOpenPath             = "/:index/_open"
+	IndexSettingsPath         = "/:index/_settings"
+	IndexLifecycleExplainPath = "/:index/_ilm/explain"
+	IndexLifecycleRemovePath  = "/:index/_ilm/remove"
+	LifecyclePoliciesPath     = "/_ilm/policy"
+	LifecyclePolicyPath       = "/_ilm/policy/:name"
+
 	IndexMsearchPath  = "/:index/_msearch"
 	GlobalMsearchPath = "/_msearch"
 
 	// Quesma internal paths
 
-	QuesmaTableResolverPath = "/:index/_quesma_table_resolver"
+	QuesmaTableResolverPath     = "/:index/_quesma_table_resolver"
+	QuesmaDeadLettersPath       = "/:index/_quesma_dead_letters"
+	QuesmaDeadLettersReplayPath = "/:index/_quesma_dead_letters/_replay"
 )
 
 var notQueryPaths = []string{
@@ -41,6 +79,10 @@ var notQueryPaths = []string{
 	"_doc",
 	"_field_caps",
 	"_health",
+	"_ingest",
+	"_index_template",
+	"_component_template",
+	"_ilm",
 	"_resolve",
 	"_refresh",
 }